@@ -121,6 +121,40 @@ func main() {
 		log.Printf("created index on employee_id")
 	}
 
+	// 4) store money as Decimal128 instead of float
+	if n, err := migrateCompensationAmounts(ctx, coll); err != nil {
+		log.Printf("compensation amounts warning: %v", err)
+	} else {
+		fmt.Printf("converted compensation amounts in %d employees\n", n)
+	}
+	payrollCollName := os.Getenv("MONGO_PAYROLL_COLLECTION")
+	if payrollCollName == "" {
+		payrollCollName = "payroll"
+	}
+	if n, err := migratePayrollAmounts(ctx, db.Collection(payrollCollName)); err != nil {
+		log.Printf("payroll amounts warning: %v", err)
+	} else {
+		fmt.Printf("converted amounts in %d payroll records\n", n)
+	}
+
+	// 5) payroll records are keyed by payroll_id, as in models.PayrollRecord
+	payrollColl := db.Collection(payrollCollName)
+	if res, err := payrollColl.UpdateMany(ctx,
+		bson.M{"id": bson.M{"$exists": true}, "payroll_id": bson.M{"$exists": false}},
+		bson.M{"$rename": bson.M{"id": "payroll_id"}}); err != nil {
+		log.Printf("payroll_id rename warning: %v", err)
+	} else {
+		fmt.Printf("renamed id to payroll_id in %d payroll records\n", res.ModifiedCount)
+	}
+	if _, err := payrollColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "payroll_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "employee_id", Value: 1}, {Key: "period", Value: 1}}},
+	}); err != nil {
+		log.Printf("payroll index warning: %v", err)
+	} else {
+		log.Printf("created payroll indexes")
+	}
+
 	if err := client.Disconnect(ctx); err != nil {
 		log.Printf("disconnect warning: %v", err)
 	}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ronaldpalay/hris/src/money"
+)
+
+// toDecimal converts a legacy numeric amount to Decimal128, rounded half-even
+// to the currency's minor unit. ok is false for values that need no change.
+func toDecimal(v interface{}, currency string) (primitive.Decimal128, bool) {
+	switch v.(type) {
+	case float64, int32, int64:
+	default:
+		return primitive.Decimal128{}, false
+	}
+	m, err := money.FromValue(v, currency)
+	if err != nil {
+		return primitive.Decimal128{}, false
+	}
+	d, err := primitive.ParseDecimal128(m.Round(money.HalfEven).String())
+	if err != nil {
+		return primitive.Decimal128{}, false
+	}
+	return d, true
+}
+
+func docCurrency(d bson.M) string {
+	if c, ok := d["currency"].(string); ok && c != "" {
+		return c
+	}
+	return money.DefaultCurrency
+}
+
+// migratePayrollAmounts rewrites float payroll amounts as Decimal128.
+func migratePayrollAmounts(ctx context.Context, coll *mongo.Collection) (int, error) {
+	fields := []string{"gross", "deductions", "taxes", "net"}
+	var or []bson.M
+	for _, f := range fields {
+		or = append(or, bson.M{f: bson.M{"$type": bson.A{"double", "int", "long"}}})
+	}
+	cur, err := coll.Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	n := 0
+	for cur.Next(ctx) {
+		var d bson.M
+		if err := cur.Decode(&d); err != nil {
+			continue
+		}
+		set := bson.M{}
+		for _, f := range fields {
+			if dec, ok := toDecimal(d[f], docCurrency(d)); ok {
+				set[f] = dec
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": d["_id"]}, bson.M{"$set": set}); err == nil {
+			n++
+		}
+	}
+	return n, cur.Err()
+}
+
+// migrateCompensationAmounts rewrites compensation_records[].amount as Decimal128.
+func migrateCompensationAmounts(ctx context.Context, coll *mongo.Collection) (int, error) {
+	cur, err := coll.Find(ctx, bson.M{"compensation_records.amount": bson.M{"$type": bson.A{"double", "int", "long"}}})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	n := 0
+	for cur.Next(ctx) {
+		var d bson.M
+		if err := cur.Decode(&d); err != nil {
+			continue
+		}
+		recs, ok := d["compensation_records"].(bson.A)
+		if !ok {
+			continue
+		}
+		changed := false
+		for _, r := range recs {
+			rec, ok := r.(bson.M)
+			if !ok {
+				continue
+			}
+			if dec, ok := toDecimal(rec["amount"], docCurrency(rec)); ok {
+				rec["amount"] = dec
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": d["_id"]}, bson.M{"$set": bson.M{"compensation_records": recs}}); err == nil {
+			n++
+		}
+	}
+	return n, cur.Err()
+}
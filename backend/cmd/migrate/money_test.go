@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestToDecimal(t *testing.T) {
+	for _, c := range []struct {
+		in       interface{}
+		currency string
+		want     string
+	}{
+		{165.44, "PHP", "165.44"},
+		{0.125, "PHP", "0.12"}, // half-even
+		{0.135, "PHP", "0.14"},
+		{int32(1500), "PHP", "1500.00"},
+		{int64(-20), "PHP", "-20.00"},
+		{1234.5, "JPY", "1234"},
+	} {
+		d, ok := toDecimal(c.in, c.currency)
+		if !ok || d.String() != c.want {
+			t.Errorf("%v %s: got %s %v, want %s", c.in, c.currency, d, ok, c.want)
+		}
+	}
+	done, _ := primitive.ParseDecimal128("165.44")
+	for _, v := range []interface{}{done, "165.44", nil} {
+		if _, ok := toDecimal(v, "PHP"); ok {
+			t.Errorf("%T %v should need no change", v, v)
+		}
+	}
+}
+
+func TestDocCurrency(t *testing.T) {
+	if got := docCurrency(bson.M{"currency": "USD"}); got != "USD" {
+		t.Fatalf("got %s", got)
+	}
+	if got := docCurrency(bson.M{"currency": ""}); got != "PHP" {
+		t.Fatalf("empty currency: got %s", got)
+	}
+	if got := docCurrency(bson.M{}); got != "PHP" {
+		t.Fatalf("missing currency: got %s", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -120,13 +121,28 @@ func TestCreateUserAndLogin(t *testing.T) {
 		t.Fatalf("failed to decode login response: %v", err)
 	}
 
+	// weak passwords are rejected by the password policy
+	weak := map[string]interface{}{"username": "alice", "password": "password123", "roles": []string{"employee"}}
+	wb, _ := json.Marshal(weak)
+	wreq, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/secure/users", bytes.NewReader(wb))
+	wreq.Header.Set("Authorization", "Bearer "+body.Token)
+	wreq.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 5 * time.Second}
+	wr, err := client.Do(wreq)
+	if err != nil {
+		t.Fatalf("create user request failed: %v", err)
+	}
+	wr.Body.Close()
+	if wr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for weak password, got %d", wr.StatusCode)
+	}
+
 	// create user
-	newUser := map[string]interface{}{"username": "alice", "password": "password123", "roles": []string{"user"}}
+	newUser := map[string]interface{}{"username": "alice", "password": "Sampaguita-2025", "roles": []string{"employee"}}
 	nb, _ := json.Marshal(newUser)
 	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/secure/users", bytes.NewReader(nb))
 	req.Header.Set("Authorization", "Bearer "+body.Token)
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 5 * time.Second}
 	r2, err := client.Do(req)
 	if err != nil {
 		t.Fatalf("create user request failed: %v", err)
@@ -136,8 +152,21 @@ func TestCreateUserAndLogin(t *testing.T) {
 		t.Fatalf("expected 201 Created, got %d", r2.StatusCode)
 	}
 
+	// admin-created accounts must change their password before logging in
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "alice", "password": "Sampaguita-2025"}, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 password change required, got %d", code)
+	}
+	change := map[string]string{"username": "alice", "current_password": "Sampaguita-2025", "new_password": "Narra-Tree-1898"}
+	if code := postJSON(t, ts.URL+"/api/auth/password/change", change, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 on password change, got %d", code)
+	}
+	again := map[string]string{"username": "alice", "current_password": "Narra-Tree-1898", "new_password": "Mabini-Street-1898"}
+	if code := postJSON(t, ts.URL+"/api/auth/password/change", again, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a session once the change is done, got %d", code)
+	}
+
 	// login as alice
-	creds2 := map[string]string{"username": "alice", "password": "password123"}
+	creds2 := map[string]string{"username": "alice", "password": "Narra-Tree-1898"}
 	b2, _ := json.Marshal(creds2)
 	resp2, err := http.Post(ts.URL+"/api/auth/login", "application/json", bytes.NewReader(b2))
 	if err != nil {
@@ -148,3 +177,31 @@ func TestCreateUserAndLogin(t *testing.T) {
 		t.Fatalf("alice login status: %d", resp2.StatusCode)
 	}
 }
+
+func TestRepeatedLoginFailuresLookTheSameForUnknownUsers(t *testing.T) {
+	r := NewRouter(context.Background())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	attempt := func(username string) (int, string) {
+		b, _ := json.Marshal(map[string]string{"username": username, "password": "wrong"})
+		resp, err := http.Post(ts.URL+"/api/auth/login", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("login request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	for _, u := range []string{"admin", "no-such-user"} {
+		if code, _ := attempt(u); code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401 on first failure, got %d", u, code)
+		}
+	}
+	// an immediate retry is throttled identically for both usernames
+	codeA, bodyA := attempt("admin")
+	codeB, bodyB := attempt("no-such-user")
+	if codeA != http.StatusTooManyRequests || codeA != codeB || bodyA != bodyB {
+		t.Fatalf("expected identical 429 responses, got %d %q vs %d %q", codeA, bodyA, codeB, bodyB)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +15,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/ronaldpalay/hris/src/money"
 	"github.com/ronaldpalay/hris/src/services"
 	"github.com/ronaldpalay/hris/src/middleware"
 	apipkg "github.com/ronaldpalay/hris/src/api"
@@ -31,13 +34,13 @@ type Employee struct {
 
 // Payroll model and in-memory store for fallback
 type PayrollRecord struct {
-	ID         string  `json:"id" bson:"id"`
-	EmployeeID string  `json:"employee_id" bson:"employee_id"`
-	Gross      float64 `json:"gross" bson:"gross"`
-	Deductions float64 `json:"deductions" bson:"deductions"`
-	Taxes      float64 `json:"taxes" bson:"taxes"`
-	Net        float64 `json:"net" bson:"net"`
-	Period     string  `json:"period" bson:"period"`
+	ID         string      `json:"id" bson:"id"`
+	EmployeeID string      `json:"employee_id" bson:"employee_id"`
+	Gross      money.Money `json:"gross" bson:"gross"`
+	Deductions money.Money `json:"deductions" bson:"deductions"`
+	Taxes      money.Money `json:"taxes" bson:"taxes"`
+	Net        money.Money `json:"net" bson:"net"`
+	Period     string      `json:"period" bson:"period"`
 }
 
 // (removed unused payroll in-memory globals)
@@ -63,6 +66,25 @@ var (
 	authStore   services.AuthStore
 	employeeRepo services.EmployeeRepo
 	payrollRepo services.PayrollRepo
+	auditLog    services.AuditLog
+	mfaService  *services.MFAService
+	loginGuard  *services.LoginGuard
+	passwords   *services.PasswordService
+	userService *services.UserService
+	payrollSvc  *services.PayrollService
+	payrollRuns *services.PayrollRunService
+	payslipPDF  *services.PayslipRenderer
+	bankLayouts *services.BankLayouts
+	remittances *services.RemittanceService
+	birReports  *services.BIRService
+	glAccounts  *services.ChartOfAccounts
+	loans       *services.LoanService
+	payrollRecs *services.PayrollRecordService
+	fxRates     *services.ExchangeRateService
+	leave       *services.LeaveService
+	leaveLedger *services.LeaveLedgerService
+	leaveCal    *services.LeaveCalendarService
+	holidays    *services.HolidayCalendar
 )
 
 // simple user model for auth
@@ -115,7 +137,11 @@ func NewRouter(ctx context.Context) *gin.Engine {
 	if useMongo && mongoClient != nil && userColl != nil {
 		dbName := getEnv("MONGO_DB", "hris")
 		usersCollName := getEnv("MONGO_USERS_COLLECTION", "users")
-		authStore = services.NewMongoUserStore(mongoClient, dbName, usersCollName)
+		s := services.NewMongoUserStore(mongoClient, dbName, usersCollName)
+		if err := s.EnsureIndexes(initCtx); err != nil {
+			fmt.Printf("user indexes: %v\n", err)
+		}
+		authStore = s
 	} else {
 		authStore = services.NewInMemoryUserStore()
 	}
@@ -129,11 +155,125 @@ func NewRouter(ctx context.Context) *gin.Engine {
 
 	// wire payroll repo
 	if useMongo && mongoClient != nil {
-		payrollRepo = services.NewMongoPayrollRepo(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_PAYROLL_COLLECTION", "payroll")))
+		repo := services.NewMongoPayrollRepo(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_PAYROLL_COLLECTION", "payroll")))
+		if err := repo.EnsureIndexes(initCtx); err != nil {
+			fmt.Printf("payroll indexes: %v\n", err)
+		}
+		payrollRepo = repo
 	} else {
 		payrollRepo = services.NewInMemoryPayrollRepo()
 	}
 
+	// wire audit log and MFA enrollments
+	if useMongo && mongoClient != nil {
+		db := mongoClient.Database(getEnv("MONGO_DB", "hris"))
+		auditLog = services.NewMongoAuditLog(db.Collection(getEnv("MONGO_AUDIT_COLLECTION", "audit_log")))
+		mfaService = services.NewMFAService(services.NewMongoMFAStore(db.Collection(getEnv("MONGO_MFA_COLLECTION", "mfa_enrollments"))), auditLog, "HRIS", splitList(os.Getenv("HRIS_MFA_REQUIRED_ROLES")))
+	} else {
+		auditLog = services.NewInMemoryAuditLog()
+		mfaService = services.NewMFAService(services.NewInMemoryMFAStore(), auditLog, "HRIS", splitList(os.Getenv("HRIS_MFA_REQUIRED_ROLES")))
+	}
+	payrollRecs = services.NewPayrollRecordService(payrollRepo, auditLog, newRoundingPolicy())
+
+	loginGuard = services.NewLoginGuard(services.DefaultLoginGuardConfig(), auditLog)
+
+	// wire password policy, reset tokens and mailer
+	var resetStore services.PasswordResetStore
+	if useMongo && mongoClient != nil {
+		resetStore = services.NewMongoPasswordResetStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_PASSWORD_RESETS_COLLECTION", "password_resets")))
+	} else {
+		resetStore = services.NewInMemoryPasswordResetStore()
+	}
+	resetURL := getEnv("HRIS_PASSWORD_RESET_URL", strings.TrimRight(getEnv("HRIS_BASE_URL", "http://localhost:8080"), "/")+"/reset-password?token=")
+	passwords = services.NewPasswordService(authStore, newPasswordPolicy(), resetStore, newMailer(), auditLog, resetURL)
+	userService = services.NewUserService(authStore, employeeRepo, auditLog)
+	payrollSvc = services.NewPayrollService(employeeRepo, nil, nil, services.DefaultPayrollConfig(), newRoundingPolicy(), services.DefaultPayrollRules()...)
+	holidays = newHolidayCalendar(initCtx)
+	// holiday premiums are earnings, so they come before contributions and tax
+	payrollSvc.AddRule(services.HolidayPayRule{Calendar: holidays})
+	contributionTables, err := newContributionTables()
+	if err != nil {
+		fatal("contribution tables", err)
+	}
+	for _, rule := range services.ContributionRules(contributionTables, getEnv("HRIS_CONTRIBUTION_SPLIT", services.SplitEven)) {
+		payrollSvc.AddRule(rule)
+	}
+	var runStore services.PayrollRunStore
+	if useMongo && mongoClient != nil {
+		db := mongoClient.Database(getEnv("MONGO_DB", "hris"))
+		runStore = services.NewMongoPayrollRunStore(
+			db.Collection(getEnv("MONGO_PAY_PERIODS_COLLECTION", "pay_periods")),
+			db.Collection(getEnv("MONGO_PAYROLL_RUNS_COLLECTION", "payroll_runs")),
+			db.Collection(getEnv("MONGO_PAYSLIPS_COLLECTION", "payslips")),
+			db.Collection(getEnv("MONGO_PAYROLL_ADJUSTMENTS_COLLECTION", "payroll_adjustments")),
+		)
+	} else {
+		runStore = services.NewInMemoryPayrollRunStore()
+	}
+	payrollRuns = services.NewPayrollRunService(runStore, employeeRepo, payrollSvc, auditLog, splitList(os.Getenv("HRIS_PAYROLL_APPROVER_ROLES")))
+	payrollRuns.SetCalendar(holidays)
+	if err := payrollRuns.SetVariancePolicy(services.VariancePolicy{Threshold: os.Getenv("HRIS_VARIANCE_THRESHOLD"), MinChange: os.Getenv("HRIS_VARIANCE_MIN_CHANGE")}); err != nil {
+		fmt.Printf("variance policy: %v\n", err)
+	}
+	// tax runs last and reads year-to-date figures from finalized runs
+	taxTables, err := newTaxTables()
+	if err != nil {
+		fatal("withholding tax tables", err)
+	}
+	payrollSvc.AddRule(services.WithholdingTaxRule{Tables: taxTables, History: payrollRuns})
+	// loan installments come out of net pay, after tax
+	var loanStore services.LoanStore
+	if useMongo && mongoClient != nil {
+		loanStore = services.NewMongoLoanStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_LOANS_COLLECTION", "loans")))
+	} else {
+		loanStore = services.NewInMemoryLoanStore()
+	}
+	loans = services.NewLoanService(loanStore, employeeRepo, auditLog)
+	payrollSvc.AddRule(services.LoanRule{Loans: loans, Floor: os.Getenv("HRIS_LOAN_NET_PAY_FLOOR"), Deferral: getEnv("HRIS_LOAN_DEFERRAL", services.DeferSkip)})
+	payrollRuns.SetLoanLedger(loans)
+
+	var leaveStore services.LeaveStore
+	if useMongo && mongoClient != nil {
+		leaveStore = services.NewMongoLeaveStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_LEAVE_COLLECTION", "leave_requests")))
+	} else {
+		leaveStore = services.NewInMemoryLeaveStore()
+	}
+	leavePolicies, err := services.ParseLeaveApprovalLevels(os.Getenv("HRIS_LEAVE_APPROVAL_LEVELS"), services.DefaultLeavePolicies())
+	if err != nil {
+		fmt.Printf("leave approval levels: %v\n", err)
+		leavePolicies = services.DefaultLeavePolicies()
+	}
+	leave = services.NewLeaveService(leaveStore, employeeRepo, auditLog, leavePolicies)
+	leave.SetCalendar(holidays)
+	leaveLedger = newLeaveLedger(initCtx, leaveStore)
+	leave.SetBalances(leaveLedger)
+	leaveCal = newLeaveCalendar(initCtx)
+
+	payslipPDF = newPayslipRenderer()
+	// a layout the bank does not expect would misroute salaries
+	if bankLayouts, err = newBankLayouts(); err != nil {
+		fatal("bank layouts", err)
+	}
+	bankLayouts.SetCompany(getEnv("HRIS_COMPANY_NAME", "HRIS"), os.Getenv("HRIS_BANK_COMPANY_ACCOUNT"))
+	// journals posted to the wrong accounts would have to be reversed by hand
+	if glAccounts, err = newChartOfAccounts(); err != nil {
+		fatal("chart of accounts", err)
+	}
+	fxRates = newExchangeRates(initCtx)
+	var remittanceStore services.RemittanceStore
+	if useMongo && mongoClient != nil {
+		remittanceStore = services.NewMongoRemittanceStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_REMITTANCES_COLLECTION", "remittances")))
+	} else {
+		remittanceStore = services.NewInMemoryRemittanceStore()
+	}
+	remittances = services.NewRemittanceService(payrollRuns, remittanceStore, services.RemittanceEmployer{
+		Name:             getEnv("HRIS_COMPANY_NAME", "HRIS"),
+		SSSNumber:        os.Getenv("HRIS_SSS_EMPLOYER_NUMBER"),
+		PhilHealthNumber: os.Getenv("HRIS_PHILHEALTH_EMPLOYER_NUMBER"),
+		PagIBIGNumber:    os.Getenv("HRIS_PAGIBIG_EMPLOYER_NUMBER"),
+	}, auditLog)
+	birReports = newBIRService(taxTables)
+
 	// ensure seeded users exist (will use authStore)
 	if err := initUsers(initCtx); err != nil {
 		fmt.Printf("init users failed: %v\n", err)
@@ -146,14 +286,31 @@ func NewRouter(ctx context.Context) *gin.Engine {
 	// API routes
 	apiGroup := r.Group("/api")
 	// register auth and user routes (authStore needs to be passed)
-	apipkg.RegisterAuthRoutes(apiGroup, authStore, jwtSecret)
+	apipkg.RegisterAuthRoutes(apiGroup, authStore, mfaService, loginGuard, jwtSecret)
+	apipkg.RegisterPasswordRoutes(apiGroup, passwords, loginGuard, jwtSecret)
+	// SAML SSO is optional; it is enabled when the SP/IdP settings are present
+	if sp, err := initSAML(); err != nil {
+		fmt.Printf("saml init failed: %v\n", err)
+	} else if sp != nil {
+		apipkg.RegisterSAMLRoutes(apiGroup, sp, userService, authStore, mfaService, jwtSecret)
+	}
 	// register employee and payroll routes
 	apipkg.RegisterEmployeeRoutes(apiGroup, employeeRepo)
-	apipkg.RegisterPayrollRoutes(apiGroup, payrollRepo)
+	apipkg.RegisterPayrollRoutes(apiGroup, payrollRecs)
+
+	// employee self-service
+	me := apiGroup.Group("", middleware.AuthMiddleware(jwtSecret), middleware.ActiveAccount(userService.ActiveRoles))
+	apipkg.RegisterSelfServiceRoutes(me, userService, payrollRuns, payslipPDF, loans)
+	apipkg.RegisterLeaveRoutes(me, userService, leave)
+	apipkg.RegisterLeaveBalanceRoutes(me, userService, leaveLedger)
+	apipkg.RegisterHolidayRoutes(me, holidays)
+	apipkg.RegisterLeaveCalendarRoutes(me, userService, leaveCal, strings.TrimRight(getEnv("HRIS_BASE_URL", "http://localhost:8080"), "/")+"/api/leave/calendar.ics?token=")
+	// calendar clients subscribe with the feed token instead of a JWT
+	apipkg.RegisterLeaveFeedRoutes(apiGroup, userService, leaveCal)
 
 	// secure endpoints (require JWT)
 	secure := apiGroup.Group("/secure")
-	secure.Use(middleware.AuthMiddleware(jwtSecret))
+	secure.Use(middleware.AuthMiddleware(jwtSecret), middleware.ActiveAccount(userService.ActiveRoles))
 	{
 		// protected employees listing for authenticated clients (used by tests)
 		secure.GET("/employees", func(c *gin.Context) {
@@ -171,8 +328,23 @@ func NewRouter(ctx context.Context) *gin.Engine {
 		secure.GET("/admin", middleware.RequireRole("admin", jwtSecret), func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"admin": true})
 		})
-		// user creation (admin only)
-		secure.POST("/users", middleware.RequireRole("admin", jwtSecret), createUser)
+		// user account management (admin only)
+		adminGroup := secure.Group("", middleware.RequireRole("admin", jwtSecret))
+		apipkg.RegisterUserRoutes(adminGroup, userService, passwords)
+		apipkg.RegisterMFAAdminRoutes(adminGroup, mfaService)
+		apipkg.RegisterLockoutRoutes(adminGroup, loginGuard)
+		hrGroup := secure.Group("", middleware.RequireAnyRole(jwtSecret, services.RoleHR, services.RoleAdmin))
+		apipkg.RegisterHolidayAdminRoutes(hrGroup, holidays, employeeRepo)
+		payrollGroup := secure.Group("", middleware.RequireAnyRole(jwtSecret, services.RolePayroll, services.RoleAdmin))
+		apipkg.RegisterPayrollEngineRoutes(payrollGroup, payrollSvc)
+		apipkg.RegisterPayrollRunRoutes(payrollGroup, payrollRuns)
+		apipkg.RegisterPayrollRecordRoutes(payrollGroup, payrollRecs)
+		apipkg.RegisterDisbursementRoutes(payrollGroup, payrollRuns, bankLayouts)
+		apipkg.RegisterGLRoutes(payrollGroup, payrollRuns, glAccounts)
+		apipkg.RegisterExchangeRateRoutes(payrollGroup, fxRates, payrollRuns, payrollRecs)
+		apipkg.RegisterLoanRoutes(payrollGroup, loans)
+		apipkg.RegisterRemittanceRoutes(payrollGroup, remittances)
+		apipkg.RegisterBIRRoutes(payrollGroup, birReports)
 	}
 
 	return r
@@ -180,12 +352,20 @@ func NewRouter(ctx context.Context) *gin.Engine {
 
 func main() {
 	r := NewRouter(context.Background())
+	scheduleLeaveAccruals()
 	if err := r.Run(":8080"); err != nil {
 		fmt.Printf("server run error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// fatal stops startup on a setting that must not fall back silently, such
+// as payroll tables, where running without it would produce wrong pay.
+func fatal(what string, err error) {
+	fmt.Printf("%s: %v\n", what, err)
+	os.Exit(1)
+}
+
 // initUsers ensures there's at least an admin user available for login.
 func initUsers(ctx context.Context) error {
 	adminUser := getEnv("HRIS_ADMIN_USER", "admin")
@@ -200,27 +380,378 @@ func initUsers(ctx context.Context) error {
 	return authStore.CreateUserWithHash(ctx, adminUser, string(h), []string{"admin"})
 }
 
-// createUser allows admin to create new users with password and roles
-func createUser(c *gin.Context) {
-	var in struct {
-		Username string   `json:"username"`
-		Password string   `json:"password"`
-		Roles    []string `json:"roles"`
+// initSAML builds the SAML service provider from HRIS_SAML_* settings. It
+// returns nil when SAML is not configured.
+func initSAML() (*services.SAMLServiceProvider, error) {
+	idpURL := os.Getenv("HRIS_SAML_IDP_SSO_URL")
+	if idpURL == "" {
+		return nil, nil
 	}
-	if err := c.BindJSON(&in); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid"})
-		return
+	certPEM, err := os.ReadFile(os.Getenv("HRIS_SAML_CERT_FILE"))
+	if err != nil {
+		return nil, err
 	}
-	if in.Username == "" || in.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password required"})
-		return
+	keyPEM, err := os.ReadFile(os.Getenv("HRIS_SAML_KEY_FILE"))
+	if err != nil {
+		return nil, err
 	}
-	// delegate to authStore
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := authStore.CreateUser(ctx, in.Username, in.Password, in.Roles); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "create user failed"})
+	idpPEM, err := os.ReadFile(os.Getenv("HRIS_SAML_IDP_CERT_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := services.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := services.ParseRSAPrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	idpCert, err := services.ParseCertificatePEM(idpPEM)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimRight(getEnv("HRIS_BASE_URL", "http://localhost:8080"), "/")
+	return services.NewSAMLServiceProvider(services.SAMLConfig{
+		EntityID:       getEnv("HRIS_SAML_ENTITY_ID", baseURL+"/api/auth/saml/metadata"),
+		ACSURL:         baseURL + "/api/auth/saml/acs",
+		Certificate:    cert,
+		PrivateKey:     key,
+		IdPEntityID:    os.Getenv("HRIS_SAML_IDP_ENTITY_ID"),
+		IdPSSOURL:      idpURL,
+		IdPCertificate: idpCert,
+		RoleMapper:     newRoleMapper(),
+	})
+}
+
+// splitList splits a comma-separated setting, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// newRoleMapper builds the IdP attribute -> role mapping shared by SSO logins.
+func newRoleMapper() *services.RoleMapper {
+	return &services.RoleMapper{
+		Attributes: splitList(getEnv("HRIS_SSO_ROLE_ATTRIBUTES", "groups,memberOf,Role")),
+		Mapping:    services.ParseRoleMapping(os.Getenv("HRIS_SSO_ROLE_MAP")),
+		Default:    []string{services.RoleEmployee},
+	}
+}
+
+// newPasswordPolicy builds the password policy from HRIS_PASSWORD_* settings.
+func newPasswordPolicy() *services.PasswordPolicy {
+	p := services.DefaultPasswordPolicy()
+	if n, err := strconv.Atoi(os.Getenv("HRIS_PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("HRIS_PASSWORD_HISTORY")); err == nil && n >= 0 {
+		p.HistorySize = n
+	}
+	p.RequireSymbol = os.Getenv("HRIS_PASSWORD_REQUIRE_SYMBOL") == "1"
+	if path := os.Getenv("HRIS_BREACHED_PASSWORDS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("breached password list: %v\n", err)
+			return p
+		}
+		defer f.Close()
+		if err := p.LoadBreachedPasswords(f); err != nil {
+			fmt.Printf("breached password list: %v\n", err)
+		}
+	}
+	return p
+}
+
+// newRoundingPolicy reads per-component payroll rounding from
+// HRIS_PAYROLL_ROUNDING, e.g. "default=half_even;sss=half_up".
+func newRoundingPolicy() money.RoundingPolicy {
+	p, err := money.ParseRoundingPolicy(os.Getenv("HRIS_PAYROLL_ROUNDING"))
+	if err != nil {
+		fmt.Printf("payroll rounding: %v\n", err)
+	}
+	return p
+}
+
+// newContributionTables loads SSS, PhilHealth and Pag-IBIG tables from
+// HRIS_CONTRIBUTION_TABLES_DIR when set, otherwise the embedded copies.
+func newContributionTables() (*services.ContributionTables, error) {
+	if dir := os.Getenv("HRIS_CONTRIBUTION_TABLES_DIR"); dir != "" {
+		return services.LoadContributionTables(os.DirFS(dir))
+	}
+	return services.DefaultContributionTables()
+}
+
+// newTaxTables loads the BIR withholding tables from the same directory as
+// the contribution tables.
+func newTaxTables() (*services.TaxTables, error) {
+	if dir := os.Getenv("HRIS_CONTRIBUTION_TABLES_DIR"); dir != "" {
+		return services.LoadTaxTables(os.DirFS(dir))
+	}
+	return services.DefaultTaxTables()
+}
+
+// newPayslipRenderer builds the payslip PDF renderer from the company
+// settings, an optional template file and the password option. A bad
+// template falls back to the embedded one; the company settings and the
+// password option are always kept.
+func newPayslipRenderer() *services.PayslipRenderer {
+	company := services.PayslipCompany{
+		Name:    getEnv("HRIS_COMPANY_NAME", "HRIS"),
+		Address: os.Getenv("HRIS_COMPANY_ADDRESS"),
+		TIN:     os.Getenv("HRIS_COMPANY_TIN"),
+	}
+	protect := os.Getenv("HRIS_PAYSLIP_PDF_PASSWORD") == "1"
+	if path := os.Getenv("HRIS_PAYSLIP_TEMPLATE_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			var r *services.PayslipRenderer
+			if r, err = services.NewPayslipRenderer(company, string(b), protect); err == nil {
+				return r
+			}
+		}
+		fmt.Printf("payslip template: %v; using the built-in template\n", err)
+	}
+	r, err := services.NewPayslipRenderer(company, "", protect)
+	if err != nil {
+		fatal("payslip template", err)
+	}
+	return r
+}
+
+// newBIRService builds the year-end BIR reports from the company settings
+// and an optional 2316 template file. A bad template falls back to the
+// embedded one; the employer settings are always kept.
+func newBIRService(tables *services.TaxTables) *services.BIRService {
+	employer := services.BIREmployer{
+		Name:    getEnv("HRIS_COMPANY_NAME", "HRIS"),
+		Address: os.Getenv("HRIS_COMPANY_ADDRESS"),
+		TIN:     os.Getenv("HRIS_COMPANY_TIN"),
+		Branch:  os.Getenv("HRIS_BIR_BRANCH_CODE"),
+		RDO:     os.Getenv("HRIS_BIR_RDO"),
+	}
+	if path := os.Getenv("HRIS_BIR_2316_TEMPLATE_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			var s *services.BIRService
+			if s, err = services.NewBIRService(payrollRuns, tables, employer, string(b)); err == nil {
+				return s
+			}
+		}
+		fmt.Printf("2316 template: %v; using the built-in template\n", err)
+	}
+	s, err := services.NewBIRService(payrollRuns, tables, employer, "")
+	if err != nil {
+		fatal("2316 template", err)
+	}
+	return s
+}
+
+// newBankLayouts reads the bank credit file layouts from
+// HRIS_BANK_LAYOUTS_FILE, or uses the built-in generic ones.
+func newBankLayouts() (*services.BankLayouts, error) {
+	if path := os.Getenv("HRIS_BANK_LAYOUTS_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return services.LoadBankLayouts(b)
+	}
+	return services.DefaultBankLayouts()
+}
+
+// newChartOfAccounts reads the general-ledger account mapping from
+// HRIS_GL_ACCOUNTS_FILE, falling back to the built-in chart.
+func newChartOfAccounts() (*services.ChartOfAccounts, error) {
+	if path := os.Getenv("HRIS_GL_ACCOUNTS_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return services.LoadChartOfAccounts(b)
+	}
+	return services.DefaultChartOfAccounts()
+}
+
+// newExchangeRates converts reports to HRIS_REPORTING_CURRENCY at the rate
+// date policy HRIS_FX_RATE_DATE and loads the rates of HRIS_FX_RATES_FILE,
+// a CSV with from, to, rate and effective_date columns. Bad settings fall
+// back to the defaults and a failed import is reported; the configured store
+// is always kept so rates entered later persist.
+func newExchangeRates(ctx context.Context) *services.ExchangeRateService {
+	var store services.ExchangeRateStore
+	if useMongo && mongoClient != nil {
+		s := services.NewMongoExchangeRateStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_EXCHANGE_RATES_COLLECTION", "exchange_rates")))
+		if err := s.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("exchange rate indexes: %v\n", err)
+		}
+		store = s
+	} else {
+		store = services.NewInMemoryExchangeRateStore()
+	}
+	fx, err := services.NewExchangeRateService(store, auditLog, os.Getenv("HRIS_REPORTING_CURRENCY"), os.Getenv("HRIS_FX_RATE_DATE"))
+	if err != nil {
+		fmt.Printf("exchange rate settings: %v\n", err)
+		fx, _ = services.NewExchangeRateService(store, auditLog, "", "")
+	}
+	if path := os.Getenv("HRIS_FX_RATES_FILE"); path != "" {
+		if err := importExchangeRates(ctx, fx, path); err != nil {
+			fmt.Printf("exchange rates file: %v\n", err)
+		}
+	}
+	return fx
+}
+
+func importExchangeRates(ctx context.Context, fx *services.ExchangeRateService, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fx.ImportCSV(ctx, "system", f)
+	return err
+}
+
+// newHolidayCalendar keeps holidays with the work weeks of HRIS_WORK_WEEKS
+// and loads HRIS_HOLIDAYS_FILE, a CSV with date, name and kind columns or an
+// iCalendar (.ics) file of HRIS_HOLIDAYS_KIND holidays. Bad work weeks fall
+// back to the default and a failed import is reported; the configured store
+// is always kept so holidays entered later persist.
+func newHolidayCalendar(ctx context.Context) *services.HolidayCalendar {
+	var store services.HolidayStore
+	if useMongo && mongoClient != nil {
+		s := services.NewMongoHolidayStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_HOLIDAYS_COLLECTION", "holidays")))
+		if err := s.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("holiday indexes: %v\n", err)
+		}
+		store = s
+	} else {
+		store = services.NewInMemoryHolidayStore()
+	}
+	weeks, err := services.ParseWorkWeeks(os.Getenv("HRIS_WORK_WEEKS"))
+	if err != nil {
+		// a nil list gives the calendar the default work week
+		fmt.Printf("work weeks: %v\n", err)
+	}
+	calendar := services.NewHolidayCalendar(store, auditLog, weeks)
+	if path := os.Getenv("HRIS_HOLIDAYS_FILE"); path != "" {
+		if err := importHolidays(ctx, calendar, path); err != nil {
+			fmt.Printf("holidays file: %v\n", err)
+		}
+	}
+	return calendar
+}
+
+func importHolidays(ctx context.Context, calendar *services.HolidayCalendar, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".ics") {
+		_, err = calendar.ImportICal(ctx, "system", f, os.Getenv("HRIS_HOLIDAYS_KIND"), "")
+	} else {
+		_, err = calendar.ImportCSV(ctx, "system", f)
+	}
+	return err
+}
+
+// newLeaveLedger keeps leave balances with the accrual policies of
+// HRIS_LEAVE_ACCRUAL_FILE, posted from HRIS_LEAVE_ACCRUAL_START. Bad settings
+// fall back to the defaults; the configured store is always kept so balances
+// are never charged where they will not persist.
+func newLeaveLedger(ctx context.Context, requests services.LeaveStore) *services.LeaveLedgerService {
+	var store services.LeaveLedgerStore
+	if useMongo && mongoClient != nil {
+		s := services.NewMongoLeaveLedgerStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_LEAVE_LEDGER_COLLECTION", "leave_ledger")))
+		if err := s.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("leave ledger indexes: %v\n", err)
+		}
+		store = s
+	} else {
+		store = services.NewInMemoryLeaveLedgerStore()
+	}
+	policies, err := leaveAccrualPolicies()
+	if err != nil {
+		fmt.Printf("leave accrual policies: %v\n", err)
+		policies, _ = services.DefaultLeaveAccrualPolicies()
+	}
+	l, err := services.NewLeaveLedgerService(store, requests, employeeRepo, auditLog, policies, os.Getenv("HRIS_LEAVE_ACCRUAL_START"))
+	if err != nil {
+		fmt.Printf("leave accrual start: %v\n", err)
+		l, _ = services.NewLeaveLedgerService(store, requests, employeeRepo, auditLog, policies, "")
+	}
+	return l
+}
+
+func leaveAccrualPolicies() ([]services.LeaveAccrualPolicy, error) {
+	path := os.Getenv("HRIS_LEAVE_ACCRUAL_FILE")
+	if path == "" {
+		return services.DefaultLeaveAccrualPolicies()
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return services.LoadLeaveAccrualPolicies(b)
+}
+
+// newLeaveCalendar builds the team leave calendar, flagging days with more
+// than HRIS_LEAVE_MAX_OUT people out.
+func newLeaveCalendar(ctx context.Context) *services.LeaveCalendarService {
+	var feeds services.CalendarFeedStore
+	if useMongo && mongoClient != nil {
+		s := services.NewMongoCalendarFeedStore(mongoClient.Database(getEnv("MONGO_DB", "hris")).Collection(getEnv("MONGO_CALENDAR_FEEDS_COLLECTION", "calendar_feeds")))
+		if err := s.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("calendar feed indexes: %v\n", err)
+		}
+		feeds = s
+	} else {
+		feeds = services.NewInMemoryCalendarFeedStore()
+	}
+	maxOut, err := strconv.Atoi(getEnv("HRIS_LEAVE_MAX_OUT", strconv.Itoa(services.DefaultLeaveMaxOut)))
+	if err != nil {
+		fmt.Printf("leave max out: %v\n", err)
+	}
+	return services.NewLeaveCalendarService(leave, feeds, auditLog, maxOut)
+}
+
+// scheduleLeaveAccruals posts leave accruals and closes leave years now and
+// every HRIS_LEAVE_ACCRUAL_INTERVAL; runs skip what is already posted.
+func scheduleLeaveAccruals() {
+	every, err := time.ParseDuration(getEnv("HRIS_LEAVE_ACCRUAL_INTERVAL", "24h"))
+	if err != nil || every <= 0 {
+		if err != nil {
+			fmt.Printf("leave accrual interval: %v\n", err)
+		}
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"username": in.Username, "roles": in.Roles})
+	system := services.LeaveActor{User: "system", Roles: []string{services.RoleAdmin}}
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			if _, err := leaveLedger.Run(ctx, system, ""); err != nil {
+				fmt.Printf("leave accruals: %v\n", err)
+			}
+			cancel()
+			<-t.C
+		}
+	}()
+}
+
+// newMailer sends through SMTP when HRIS_SMTP_ADDR is set and otherwise
+// drops messages as .eml files into HRIS_MAIL_DIR.
+func newMailer() services.Mailer {
+	from := getEnv("HRIS_MAIL_FROM", "hris@localhost")
+	if addr := os.Getenv("HRIS_SMTP_ADDR"); addr != "" {
+		return services.NewSMTPMailer(addr, from, os.Getenv("HRIS_SMTP_USER"), os.Getenv("HRIS_SMTP_PASSWORD"))
+	}
+	return services.NewFileMailer(getEnv("HRIS_MAIL_DIR", "mail-outbox"), from)
 }
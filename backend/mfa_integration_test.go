@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ronaldpalay/hris/src/services"
+)
+
+func postJSON(t *testing.T, url string, in interface{}, out interface{}) int {
+	t.Helper()
+	b, _ := json.Marshal(in)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("post %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		_ = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestLoginRequiresMFAForPolicyRoles(t *testing.T) {
+	t.Setenv("HRIS_MFA_REQUIRED_ROLES", "admin")
+	r := NewRouter(context.Background())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var login struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAEnrolled bool   `json:"mfa_enrolled"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "admin", "password": "password"}, &login); code != http.StatusOK {
+		t.Fatalf("login status: %d", code)
+	}
+	if login.Token != "" || !login.MFARequired || login.MFAEnrolled || login.MFAToken == "" {
+		t.Fatalf("expected mfa enrollment challenge, got %+v", login)
+	}
+
+	// the challenge token is not a session token
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/secure/employees", nil)
+	req.Header.Set("Authorization", "Bearer "+login.MFAToken)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("protected request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for challenge token, got %d", resp.StatusCode)
+	}
+
+	var enroll struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/mfa/enroll", map[string]string{"mfa_token": login.MFAToken}, &enroll); code != http.StatusOK {
+		t.Fatalf("enroll status: %d", code)
+	}
+	totp, _ := services.TOTPCode(enroll.Secret, time.Now())
+	var confirmed struct {
+		Token         string   `json:"token"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/mfa/enroll/confirm", map[string]string{"mfa_token": login.MFAToken, "code": totp}, &confirmed); code != http.StatusOK {
+		t.Fatalf("confirm status: %d", code)
+	}
+	if confirmed.Token == "" || len(confirmed.RecoveryCodes) == 0 {
+		t.Fatalf("expected session token and recovery codes, got %+v", confirmed)
+	}
+
+	// next login needs the second step; a recovery code completes it
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "admin", "password": "password"}, &login); code != http.StatusOK || !login.MFAEnrolled {
+		t.Fatalf("expected mfa challenge for enrolled user, got %d %+v", code, login)
+	}
+	var verified struct {
+		Token string `json:"token"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/mfa/verify", map[string]string{"mfa_token": login.MFAToken, "code": confirmed.RecoveryCodes[0]}, &verified); code != http.StatusOK || verified.Token == "" {
+		t.Fatalf("verify status: %d", code)
+	}
+}
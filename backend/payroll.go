@@ -1,6 +1,8 @@
 package main
 
+import "github.com/ronaldpalay/hris/src/money"
+
 // CalculateNet returns the net pay computed from gross, deductions and taxes.
-func CalculateNet(gross, deductions, taxes float64) float64 {
-	return gross - deductions - taxes
+func CalculateNet(gross, deductions, taxes money.Money) money.Money {
+	return gross.Sub(deductions).Sub(taxes)
 }
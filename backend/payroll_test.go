@@ -1,14 +1,25 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/ronaldpalay/hris/src/money"
+)
 
 func TestCalculateNet(t *testing.T) {
-	gross := 2000.0
-	deductions := 150.0
-	taxes := 250.0
+	gross := money.MustParse("2000", "PHP")
+	deductions := money.MustParse("150", "PHP")
+	taxes := money.MustParse("250", "PHP")
 	got := CalculateNet(gross, deductions, taxes)
-	want := 1600.0
-	if got != want {
+	want := money.MustParse("1600", "PHP")
+	if !got.Equal(want) {
 		t.Fatalf("CalculateNet = %v; want %v", got, want)
 	}
 }
+
+func TestCalculateNetKeepsCentavos(t *testing.T) {
+	got := CalculateNet(money.MustParse("1500.00", "PHP"), money.MustParse("100.00", "PHP"), money.MustParse("165.44", "PHP"))
+	if got.String() != "1234.56" {
+		t.Fatalf("CalculateNet = %v; want 1234.56", got)
+	}
+}
@@ -2,16 +2,23 @@ package api
 
 import (
     "context"
+    "fmt"
+    "math"
     "net/http"
+    "strconv"
     "time"
 
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
+    "github.com/ronaldpalay/hris/src/middleware"
     "github.com/ronaldpalay/hris/src/services"
 )
 
-// RegisterAuthRoutes registers auth routes on the given router group.
-func RegisterAuthRoutes(rg *gin.RouterGroup, authStore services.AuthStore, jwtSecret []byte) {
+// RegisterAuthRoutes registers auth routes on the given router group. When mfa
+// is non-nil, users with MFA enabled (or required by policy) get a short-lived
+// challenge token from /auth/login instead of a session token. When guard is
+// non-nil, repeated failures are throttled and eventually locked out.
+func RegisterAuthRoutes(rg *gin.RouterGroup, authStore services.AuthStore, mfa *services.MFAService, guard *services.LoginGuard, jwtSecret []byte) {
     rg.POST("/auth/login", func(c *gin.Context) {
         var creds struct {
             Username string `json:"username"`
@@ -21,49 +28,130 @@ func RegisterAuthRoutes(rg *gin.RouterGroup, authStore services.AuthStore, jwtSe
             c.JSON(http.StatusBadRequest, gin.H{"error": "invalid"})
             return
         }
+        if throttled(c, guard, creds.Username) {
+            return
+        }
         ok, roles, err := authStore.ValidateCredentials(context.Background(), creds.Username, creds.Password)
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
             return
         }
         if !ok {
+            recordLoginFailure(guard, creds.Username, c.ClientIP())
             c.JSON(http.StatusUnauthorized, gin.H{"error": "bad credentials"})
             return
         }
-        token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-            "sub":   creds.Username,
-            "roles": roles,
-            "exp":   time.Now().Add(1 * time.Hour).Unix(),
-        })
-        s, err := token.SignedString(jwtSecret)
+        // accounts created by an admin must pick their own password first
+        if u, err := authStore.GetUser(context.Background(), creds.Username); err == nil && u.MustChangePassword {
+            c.JSON(http.StatusForbidden, gin.H{"error": "password change required", "password_change_required": true})
+            return
+        }
+        if mfa != nil {
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            enabled, err := mfa.Enabled(ctx, creds.Username)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
+                return
+            }
+            if enabled || mfa.Required(roles) {
+                s, err := issueMFAChallenge(creds.Username, roles, jwtSecret)
+                if err != nil {
+                    c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
+                    return
+                }
+                c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_enrolled": enabled, "mfa_token": s})
+                return
+            }
+        }
+        s, err := issueToken(creds.Username, roles, jwtSecret)
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
             return
         }
+        loginSucceeded(authStore, guard, creds.Username)
         c.JSON(http.StatusOK, gin.H{"token": s})
     })
 
-    rg.POST("/users", func(c *gin.Context) {
-        var in struct {
-            Username string   `json:"username"`
-            Password string   `json:"password"`
-            Roles    []string `json:"roles"`
-        }
-        if err := c.BindJSON(&in); err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid"})
-            return
-        }
-        if in.Username == "" || in.Password == "" {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "username and password required"})
-            return
-        }
+    if mfa != nil {
+        registerMFARoutes(rg, authStore, mfa, guard, jwtSecret)
+    }
+}
+
+// issueToken signs the session JWT handed out by every login method.
+func issueToken(username string, roles []string, jwtSecret []byte) (string, error) {
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "sub":   username,
+        "roles": roles,
+        "exp":   time.Now().Add(1 * time.Hour).Unix(),
+    })
+    return token.SignedString(jwtSecret)
+}
+
+// issueMFAChallenge signs the token that carries a user from the password step
+// to the MFA step. AuthMiddleware refuses it as a session token.
+func issueMFAChallenge(username string, roles []string, jwtSecret []byte) (string, error) {
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "sub":   username,
+        "roles": roles,
+        "typ":   middleware.TokenTypeMFAChallenge,
+        "exp":   time.Now().Add(5 * time.Minute).Unix(),
+    })
+    return token.SignedString(jwtSecret)
+}
+
+// throttled answers 429 when the guard requires the caller to wait. The
+// answer is the same for existing and unknown usernames.
+func throttled(c *gin.Context, guard *services.LoginGuard, username string) bool {
+    if guard == nil {
+        return false
+    }
+    wait := guard.Check(username, c.ClientIP())
+    if wait <= 0 {
+        return false
+    }
+    c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+    c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts"})
+    return true
+}
+
+func recordLoginFailure(guard *services.LoginGuard, username, ip string) {
+    if guard == nil {
+        return
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := guard.RecordFailure(ctx, username, ip); err != nil {
+        fmt.Printf("record login failure: %v\n", err)
+    }
+}
+
+// loginSucceeded clears the failure history and records the login time.
+func loginSucceeded(authStore services.AuthStore, guard *services.LoginGuard, username string) {
+    if guard != nil {
+        guard.RecordSuccess(username)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := authStore.RecordLogin(ctx, username, time.Now()); err != nil {
+        fmt.Printf("record last login: %v\n", err)
+    }
+}
+
+// RegisterLockoutRoutes registers admin lockout management; mount it behind admin auth.
+func RegisterLockoutRoutes(rg *gin.RouterGroup, guard *services.LoginGuard) {
+    rg.GET("/users/lockouts", func(c *gin.Context) {
+        items := guard.Lockouts()
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.POST("/users/:username/unlock", func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
         defer cancel()
-        if err := authStore.CreateUser(ctx, in.Username, in.Password, in.Roles); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "create user failed"})
+        if err := guard.Unlock(ctx, middleware.CurrentUser(c), c.Param("username")); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "unlock failed"})
             return
         }
-        c.JSON(http.StatusCreated, gin.H{"username": in.Username, "roles": in.Roles})
+        c.Status(http.StatusNoContent)
     })
 }
-
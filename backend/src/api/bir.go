@@ -0,0 +1,124 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterBIRRoutes registers the year-end BIR 2316 certificates, the
+// 1604-C alphalist and the reconciliation report; mount it behind
+// payroll/admin auth. Every endpoint takes ?year=, defaulting to last year.
+func RegisterBIRRoutes(rg *gin.RouterGroup, bir *services.BIRService) {
+    yearOf := func(c *gin.Context) (int, bool) {
+        y := c.Query("year")
+        if y == "" {
+            return time.Now().Year() - 1, true
+        }
+        n, err := strconv.Atoi(y)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "year must be a number"})
+            return 0, false
+        }
+        return n, true
+    }
+
+    rg.GET("/payroll/bir/2316", func(c *gin.Context) {
+        year, ok := yearOf(c)
+        if !ok {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        items, err := bir.Certificates(ctx, year)
+        if err != nil {
+            writeBIRError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // /payroll/bir/2316/E-1.pdf prints the certificate, without the extension it is JSON
+    rg.GET("/payroll/bir/2316/:file", func(c *gin.Context) {
+        year, ok := yearOf(c)
+        if !ok {
+            return
+        }
+        id := strings.TrimSuffix(c.Param("file"), ".pdf")
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        cert, err := bir.Certificate(ctx, year, id)
+        if err != nil {
+            writeBIRError(c, err)
+            return
+        }
+        if id == c.Param("file") {
+            c.JSON(http.StatusOK, cert)
+            return
+        }
+        doc, err := bir.Render2316(cert)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "2316 rendering failed", "detail": err.Error()})
+            return
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("2316-%d-%s.pdf", year, id)))
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusOK, "application/pdf", doc)
+    })
+
+    rg.GET("/payroll/bir/alphalist", func(c *gin.Context) {
+        year, ok := yearOf(c)
+        if !ok {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        content, name, err := bir.Alphalist(ctx, year, c.DefaultQuery("format", "dat"))
+        if err != nil {
+            writeBIRError(c, err)
+            return
+        }
+        contentType := "text/plain; charset=utf-8"
+        if strings.HasSuffix(name, ".csv") {
+            contentType = "text/csv; charset=utf-8"
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusOK, contentType, content)
+    })
+
+    rg.GET("/payroll/bir/reconciliation", func(c *gin.Context) {
+        year, ok := yearOf(c)
+        if !ok {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        rec, err := bir.Reconcile(ctx, year)
+        if err != nil {
+            writeBIRError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, rec)
+    })
+}
+
+// writeBIRError maps BIR report errors to HTTP responses.
+func writeBIRError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments):
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case errors.Is(err, services.ErrNoTaxTables):
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+    default:
+        writeExportError(c, err)
+    }
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterDisbursementRoutes registers bank credit file exports of finalized
+// runs; mount it behind payroll/admin auth.
+func RegisterDisbursementRoutes(rg *gin.RouterGroup, runs *services.PayrollRunService, layouts *services.BankLayouts) {
+    rg.GET("/payroll/bank-layouts", func(c *gin.Context) {
+        items := layouts.List()
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // the file is the response body; the export record travels in headers
+    rg.POST("/payroll/runs/:id/bank-export", func(c *gin.Context) {
+        var in struct {
+            Layout string `json:"layout"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        layout, err := layouts.Get(in.Layout)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        f, err := runs.BankExport(ctx, middleware.CurrentUser(c), c.Param("id"), layout)
+        if err != nil {
+            writeExportError(c, err)
+            return
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Export.FileName))
+        c.Header("X-Export-ID", f.Export.ExportID)
+        c.Header("X-Export-Checksum", f.Export.Checksum)
+        c.Header("Cache-Control", "no-store")
+        contentType := "text/plain; charset=utf-8"
+        if layout.Format == "csv" {
+            contentType = "text/csv; charset=utf-8"
+        }
+        c.Data(http.StatusCreated, contentType, f.Content)
+    })
+
+    rg.POST("/payroll/runs/:id/exports/:export_id/void", func(c *gin.Context) {
+        var in struct {
+            Reason string `json:"reason"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        e, err := runs.VoidExport(ctx, middleware.CurrentUser(c), c.Param("id"), c.Param("export_id"), in.Reason)
+        if err != nil {
+            writeExportError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, e)
+    })
+}
+
+// writeExportError reports every validation problem at once so finance can
+// fix the employee records in one pass.
+func writeExportError(c *gin.Context, err error) {
+    var invalid *services.ExportValidationError
+    switch {
+    case errors.As(err, &invalid):
+        c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrExportValidation.Error(), "problems": invalid.Problems})
+    case errors.Is(err, services.ErrAlreadyExported):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        writeRunError(c, err)
+    }
+}
@@ -7,9 +7,36 @@ import (
     "time"
 
     "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/money"
     "github.com/ronaldpalay/hris/src/services"
 )
 
+// normalizeCompensation converts compensation_records[].amount to money.Money
+// so compensation is stored as Decimal128 like payroll amounts.
+func normalizeCompensation(doc map[string]interface{}) error {
+    recs, ok := doc["compensation_records"].([]interface{})
+    if !ok {
+        return nil
+    }
+    for i, r := range recs {
+        rec, ok := r.(map[string]interface{})
+        if !ok {
+            continue
+        }
+        cur, _ := rec["currency"].(string)
+        if cur == "" {
+            cur = money.DefaultCurrency
+            rec["currency"] = cur
+        }
+        m, err := money.FromValue(rec["amount"], cur)
+        if err != nil {
+            return fmt.Errorf("compensation_records[%d].amount: %w", i, err)
+        }
+        rec["amount"] = m
+    }
+    return nil
+}
+
 func RegisterEmployeeRoutes(rg *gin.RouterGroup, repo services.EmployeeRepo) {
     rg.GET("/employees", func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -34,6 +61,10 @@ func RegisterEmployeeRoutes(rg *gin.RouterGroup, repo services.EmployeeRepo) {
         if in["version"] == nil {
             in["version"] = 1
         }
+        if err := normalizeCompensation(in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid amount", "detail": err.Error()})
+            return
+        }
         ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
         defer cancel()
         doc, err := repo.Create(ctx, in)
@@ -63,6 +94,10 @@ func RegisterEmployeeRoutes(rg *gin.RouterGroup, repo services.EmployeeRepo) {
             c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
             return
         }
+        if err := normalizeCompensation(in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid amount", "detail": err.Error()})
+            return
+        }
         var expected *int
         if v, ok := in["version"].(float64); ok {
             vv := int(v)
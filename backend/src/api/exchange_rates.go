@@ -0,0 +1,107 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// maxRateFileSize bounds uploaded exchange-rate files.
+const maxRateFileSize = 1 << 20
+
+// RegisterExchangeRateRoutes registers the exchange-rate table and the cost
+// reports converted to the reporting currency; mount it behind payroll/admin
+// auth.
+func RegisterExchangeRateRoutes(rg *gin.RouterGroup, fx *services.ExchangeRateService, runs *services.PayrollRunService, records *services.PayrollRecordService) {
+    rg.GET("/payroll/exchange-rates", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := fx.List(ctx, services.ExchangeRateFilter{From: c.Query("from"), To: c.Query("to")})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "reporting_currency": fx.Currency()})
+    })
+
+    // a JSON rate, or a CSV file (text/csv body or multipart field "file")
+    rg.POST("/payroll/exchange-rates", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        var (
+            items []models.ExchangeRate
+            err   error
+        )
+        switch ct := c.ContentType(); {
+        case ct == "text/csv":
+            items, err = fx.ImportCSV(ctx, middleware.CurrentUser(c), http.MaxBytesReader(c.Writer, c.Request.Body, maxRateFileSize))
+        case strings.HasPrefix(ct, "multipart/"):
+            fh, ferr := c.FormFile("file")
+            if ferr != nil || fh.Size > maxRateFileSize {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "file required (max 1 MiB)"})
+                return
+            }
+            f, ferr := fh.Open()
+            if ferr != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "unreadable file"})
+                return
+            }
+            defer f.Close()
+            items, err = fx.ImportCSV(ctx, middleware.CurrentUser(c), f)
+        default:
+            var in models.ExchangeRate
+            if err := c.BindJSON(&in); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+                return
+            }
+            items, err = fx.Add(ctx, middleware.CurrentUser(c), "manual", []models.ExchangeRate{in})
+        }
+        if err != nil {
+            writeExchangeRateError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, gin.H{"items": items, "total": len(items)})
+    })
+
+    // rate_date overrides the configured policy: period_end, pay_date or YYYY-MM-DD
+    rg.GET("/payroll/runs/:id/cost", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        rep, err := fx.RunCost(ctx, runs, c.Param("id"), c.Query("rate_date"))
+        if err != nil {
+            writeExchangeRateError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, rep)
+    })
+
+    rg.GET("/payroll/records/cost", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        rep, err := fx.PeriodCost(ctx, records, c.Query("period"), c.Query("rate_date"))
+        if err != nil {
+            writeExchangeRateError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, rep)
+    })
+}
+
+// writeExchangeRateError maps exchange-rate errors to HTTP responses.
+func writeExchangeRateError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, services.ErrInvalidExchangeRate), errors.Is(err, services.ErrInvalidPayrollRecord):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrNoExchangeRate):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+    default:
+        writeRunError(c, err)
+    }
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterGLRoutes registers the chart of accounts and the general-ledger
+// journals of finalized runs; mount it behind payroll/admin auth.
+func RegisterGLRoutes(rg *gin.RouterGroup, runs *services.PayrollRunService, chart *services.ChartOfAccounts) {
+    rg.GET("/payroll/gl-accounts", func(c *gin.Context) {
+        c.JSON(http.StatusOK, chart)
+    })
+
+    // preview; unbalanced journals are returned with balanced=false
+    rg.GET("/payroll/runs/:id/journal", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.Journal(ctx, c.Param("id"), chart)
+        if err != nil {
+            writeGLError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // the file is the response body; the export record travels in headers
+    rg.POST("/payroll/runs/:id/gl-export", func(c *gin.Context) {
+        var in struct {
+            Format   string `json:"format"`
+            Currency string `json:"currency"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        if in.Format == "" {
+            in.Format = "csv"
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        f, err := runs.GLExport(ctx, middleware.CurrentUser(c), c.Param("id"), chart, in.Currency, in.Format)
+        if err != nil {
+            writeGLError(c, err)
+            return
+        }
+        contentType := "text/csv; charset=utf-8"
+        if in.Format == "json" {
+            contentType = "application/json"
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Export.FileName))
+        c.Header("X-Export-ID", f.Export.ExportID)
+        c.Header("X-Export-Checksum", f.Export.Checksum)
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusCreated, contentType, f.Content)
+    })
+}
+
+// writeGLError maps journal errors to HTTP responses.
+func writeGLError(c *gin.Context, err error) {
+    if errors.Is(err, services.ErrJournalUnbalanced) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    }
+    writeExportError(c, err)
+}
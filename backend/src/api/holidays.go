@@ -0,0 +1,132 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxHolidayFileSize bounds uploaded holiday files.
+const maxHolidayFileSize = 1 << 20
+
+// RegisterHolidayRoutes registers the holiday calendar for any signed-in
+// user; mount it behind AuthMiddleware.
+func RegisterHolidayRoutes(rg *gin.RouterGroup, calendar *services.HolidayCalendar) {
+    rg.GET("/holidays", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := calendar.List(ctx, services.HolidayFilter{From: c.Query("from"), To: c.Query("to"), Location: c.Query("location")})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/holidays/work-weeks", func(c *gin.Context) {
+        items := calendar.WorkWeeks()
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+}
+
+// RegisterHolidayAdminRoutes registers holiday maintenance and employee
+// calendars; mount it behind HR/admin auth.
+func RegisterHolidayAdminRoutes(rg *gin.RouterGroup, calendar *services.HolidayCalendar, employees services.EmployeeRepo) {
+    // a JSON array of holidays, a CSV (text/csv) or iCalendar (text/calendar)
+    // body, or a multipart "file"; iCalendar events take ?kind= and
+    // ?location= unless their CATEGORIES name the kind
+    rg.POST("/holidays", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        actor := middleware.CurrentUser(c)
+        importFile := func(r io.Reader, ical bool) ([]models.Holiday, error) {
+            if ical {
+                return calendar.ImportICal(ctx, actor, r, c.Query("kind"), c.Query("location"))
+            }
+            return calendar.ImportCSV(ctx, actor, r)
+        }
+        var (
+            items []models.Holiday
+            err   error
+        )
+        switch ct := c.ContentType(); {
+        case ct == "text/csv", ct == "text/calendar":
+            items, err = importFile(http.MaxBytesReader(c.Writer, c.Request.Body, maxHolidayFileSize), ct == "text/calendar")
+        case strings.HasPrefix(ct, "multipart/"):
+            fh, ferr := c.FormFile("file")
+            if ferr != nil || fh.Size > maxHolidayFileSize {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "file required (max 1 MiB)"})
+                return
+            }
+            f, ferr := fh.Open()
+            if ferr != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "unreadable file"})
+                return
+            }
+            defer f.Close()
+            items, err = importFile(f, strings.HasSuffix(strings.ToLower(fh.Filename), ".ics"))
+        default:
+            var in []models.Holiday
+            if err := c.BindJSON(&in); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+                return
+            }
+            items, err = calendar.Add(ctx, actor, "manual", in)
+        }
+        if err != nil {
+            writeHolidayError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.DELETE("/holidays/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := calendar.Delete(ctx, middleware.CurrentUser(c), c.Param("id")); err != nil {
+            writeHolidayError(c, err)
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    // an employee's calendar with its working days, e.g. to check a leave span
+    rg.GET("/holidays/days", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        emp, err := employees.Get(ctx, c.Query("employee_id"))
+        if err != nil {
+            writeHolidayError(c, err)
+            return
+        }
+        from, to := c.Query("from"), c.Query("to")
+        items, err := calendar.Days(ctx, emp, from, to)
+        if err != nil {
+            writeHolidayError(c, err)
+            return
+        }
+        days, _ := calendar.WorkingDays(ctx, emp, from, to, false, false)
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "working_days": days})
+    })
+}
+
+// writeHolidayError maps calendar errors to HTTP responses.
+func writeHolidayError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments):
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case errors.Is(err, services.ErrInvalidCalendar):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "calendar request failed", "detail": err.Error()})
+    }
+}
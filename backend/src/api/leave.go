@@ -0,0 +1,131 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterLeaveRoutes registers leave requests and their approval; mount it
+// behind AuthMiddleware. Employees act through the employee linked to their
+// account; HR and admins may act on any request.
+func RegisterLeaveRoutes(rg *gin.RouterGroup, users *services.UserService, leave *services.LeaveService) {
+    actorOf := func(c *gin.Context, ctx context.Context) services.LeaveActor {
+        return leaveActor(c, ctx, users)
+    }
+
+    rg.GET("/leave/types", func(c *gin.Context) {
+        items := leave.Policies()
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/leave/requests", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := leave.List(ctx, actorOf(c, ctx), services.LeaveFilter{
+            EmployeeID: c.Query("employee_id"), Status: c.Query("status"), Type: c.Query("type"), From: c.Query("from"), To: c.Query("to"),
+        })
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.POST("/leave/requests", func(c *gin.Context) {
+        var in models.LeaveRequest
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        r, err := leave.Submit(ctx, actorOf(c, ctx), in)
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, r)
+    })
+
+    // requests waiting on the caller's decision
+    rg.GET("/leave/approvals", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := leave.Pending(ctx, actorOf(c, ctx))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/leave/requests/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        r, err := leave.Get(ctx, actorOf(c, ctx), c.Param("id"))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, r)
+    })
+
+    // approve, reject and cancel take an optional {"comment": ...}
+    decision := func(fn func(context.Context, services.LeaveActor, string, string) (*models.LeaveRequest, error)) gin.HandlerFunc {
+        return func(c *gin.Context) {
+            var in struct {
+                Comment string `json:"comment"`
+            }
+            if c.Request.ContentLength != 0 {
+                if err := c.BindJSON(&in); err != nil {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+                    return
+                }
+            }
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            r, err := fn(ctx, actorOf(c, ctx), c.Param("id"), in.Comment)
+            if err != nil {
+                writeLeaveError(c, err)
+                return
+            }
+            c.JSON(http.StatusOK, r)
+        }
+    }
+    rg.POST("/leave/requests/:id/approve", decision(leave.Approve))
+    rg.POST("/leave/requests/:id/reject", decision(leave.Reject))
+    rg.POST("/leave/requests/:id/cancel", decision(leave.Cancel))
+}
+
+// leaveActor is the caller with the employee linked to their account.
+func leaveActor(c *gin.Context, ctx context.Context, users *services.UserService) services.LeaveActor {
+    a := services.LeaveActor{User: middleware.CurrentUser(c), Roles: middleware.CurrentRoles(c)}
+    if u, err := users.Get(ctx, a.User); err == nil {
+        a.EmployeeID = u.EmployeeID
+    }
+    return a
+}
+
+// writeLeaveError maps leave errors to HTTP responses.
+func writeLeaveError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, services.ErrInvalidFeedToken):
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case errors.Is(err, services.ErrInvalidLeave), errors.Is(err, services.ErrInvalidLeaveAccrual):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrLeaveForbidden):
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrLeaveState), errors.Is(err, services.ErrLeaveOverlap), errors.Is(err, services.ErrInsufficientLeave):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "leave request failed", "detail": err.Error()})
+    }
+}
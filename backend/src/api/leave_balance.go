@@ -0,0 +1,83 @@
+package api
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterLeaveBalanceRoutes registers leave balances, the leave ledger and
+// the accrual run; mount it behind AuthMiddleware. Employees see their own
+// balances; adjustments and runs are for HR and admins.
+func RegisterLeaveBalanceRoutes(rg *gin.RouterGroup, users *services.UserService, ledger *services.LeaveLedgerService) {
+    rg.GET("/leave/accrual-policies", func(c *gin.Context) {
+        items := ledger.Policies()
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/leave/balances", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := ledger.Balances(ctx, leaveActor(c, ctx, users), c.Query("employee_id"), c.Query("as_of"))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/leave/ledger", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := ledger.Entries(ctx, leaveActor(c, ctx, users), services.LeaveLedgerFilter{
+            EmployeeID: c.Query("employee_id"), Type: c.Query("type"), Kind: c.Query("kind"), From: c.Query("from"), To: c.Query("to"),
+        })
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // manual adjustment: {"employee_id", "type", "days", "date", "note"}
+    rg.POST("/leave/ledger", func(c *gin.Context) {
+        var in models.LeaveLedgerEntry
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        e, err := ledger.Adjust(ctx, leaveActor(c, ctx, users), in)
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, e)
+    })
+
+    // posts what the scheduled job would, through an optional {"as_of": ...}
+    rg.POST("/leave/accruals/run", func(c *gin.Context) {
+        var in struct {
+            AsOf string `json:"as_of"`
+        }
+        if c.Request.ContentLength != 0 {
+            if err := c.BindJSON(&in); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+                return
+            }
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        res, err := ledger.Run(ctx, leaveActor(c, ctx, users), in.AsOf)
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, res)
+    })
+}
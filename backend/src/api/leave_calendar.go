@@ -0,0 +1,91 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterLeaveCalendarRoutes registers the team leave calendar and the
+// caller's feed token; mount it behind AuthMiddleware. feedURL is the
+// address of the iCalendar feed that the token is appended to.
+func RegisterLeaveCalendarRoutes(rg *gin.RouterGroup, users *services.UserService, calendar *services.LeaveCalendarService, feedURL string) {
+    rg.GET("/leave/calendar", func(c *gin.Context) {
+        q := services.LeaveCalendarQuery{Unit: c.Query("unit"), From: c.Query("from"), To: c.Query("to")}
+        if v := c.Query("max_out"); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "max_out must be a positive number"})
+                return
+            }
+            q.MaxOut = n
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        cal, err := calendar.Calendar(ctx, leaveActor(c, ctx, users), q)
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, cal)
+    })
+
+    // a new token replaces the previous one; it is shown only once
+    rg.POST("/leave/calendar/feed", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        token, err := calendar.IssueFeedToken(ctx, leaveActor(c, ctx, users))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, gin.H{"token": token, "url": feedURL + token})
+    })
+
+    rg.DELETE("/leave/calendar/feed", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := calendar.RevokeFeedToken(ctx, leaveActor(c, ctx, users)); err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+}
+
+// RegisterLeaveFeedRoutes registers the iCalendar feed, authenticated by its
+// token alone so calendar clients can subscribe; mount it without auth. The
+// feed shows what the token's owner may currently see.
+func RegisterLeaveFeedRoutes(rg *gin.RouterGroup, users *services.UserService, calendar *services.LeaveCalendarService) {
+    rg.GET("/leave/calendar.ics", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        owner, err := calendar.FeedOwner(ctx, c.Query("token"))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        u, err := users.Get(ctx, owner)
+        if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && u.Status == models.UserStatusSuspended) {
+            writeLeaveError(c, services.ErrInvalidFeedToken)
+            return
+        }
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        body, err := calendar.Feed(ctx, services.LeaveActor{User: u.Username, EmployeeID: u.EmployeeID, Roles: u.Roles}, c.Query("unit"))
+        if err != nil {
+            writeLeaveError(c, err)
+            return
+        }
+        c.Data(http.StatusOK, "text/calendar; charset=utf-8", body)
+    })
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterLoanRoutes registers employee loans and recurring deductions;
+// mount it behind payroll/admin auth. Employees see their own loans under
+// /me/loans.
+func RegisterLoanRoutes(rg *gin.RouterGroup, loans *services.LoanService) {
+    rg.GET("/payroll/loans", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := loans.List(ctx, services.LoanFilter{EmployeeID: c.Query("employee_id"), Status: c.Query("status"), Type: c.Query("type")})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.POST("/payroll/loans", func(c *gin.Context) {
+        var in models.Loan
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        l, err := loans.Create(ctx, middleware.CurrentUser(c), in)
+        if err != nil {
+            writeLoanError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, services.NewLoanView(*l))
+    })
+
+    rg.GET("/payroll/loans/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        l, err := loans.Get(ctx, c.Param("id"))
+        if err != nil {
+            writeLoanError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, services.NewLoanView(*l))
+    })
+
+    rg.POST("/payroll/loans/:id/cancel", func(c *gin.Context) {
+        var in struct {
+            Reason string `json:"reason"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        l, err := loans.Cancel(ctx, middleware.CurrentUser(c), c.Param("id"), in.Reason)
+        if err != nil {
+            writeLoanError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, services.NewLoanView(*l))
+    })
+}
+
+// writeLoanError maps loan errors to HTTP responses.
+func writeLoanError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, services.ErrInvalidLoan):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrLoanState):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        writeRunError(c, err)
+    }
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// mfaSubject identifies the caller of an MFA endpoint either by the login
+// challenge token or by a regular session token. challenge reports which.
+func mfaSubject(c *gin.Context, mfaToken string, jwtSecret []byte) (username string, roles []string, challenge bool, err error) {
+    if mfaToken != "" {
+        claims, err := middleware.ParseToken(mfaToken, jwtSecret)
+        if err != nil || claims["typ"] != middleware.TokenTypeMFAChallenge {
+            return "", nil, false, errors.New("invalid mfa token")
+        }
+        sub, _ := claims["sub"].(string)
+        return sub, middleware.ClaimRoles(claims), true, nil
+    }
+    h := c.GetHeader("Authorization")
+    if !strings.HasPrefix(h, "Bearer ") {
+        return "", nil, false, errors.New("missing token")
+    }
+    claims, err := middleware.ParseToken(strings.TrimPrefix(h, "Bearer "), jwtSecret)
+    if err != nil || claims["typ"] == middleware.TokenTypeMFAChallenge {
+        return "", nil, false, errors.New("invalid token")
+    }
+    sub, _ := claims["sub"].(string)
+    return sub, middleware.ClaimRoles(claims), false, nil
+}
+
+func registerMFARoutes(rg *gin.RouterGroup, authStore services.AuthStore, mfa *services.MFAService, guard *services.LoginGuard, jwtSecret []byte) {
+    // second login step: exchange challenge + TOTP/recovery code for a session token
+    rg.POST("/auth/mfa/verify", func(c *gin.Context) {
+        var in struct {
+            MFAToken string `json:"mfa_token"`
+            Code     string `json:"code"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.MFAToken == "" || in.Code == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code required"})
+            return
+        }
+        username, roles, _, err := mfaSubject(c, in.MFAToken, jwtSecret)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
+            return
+        }
+        // codes count towards the same lockout as passwords
+        if throttled(c, guard, username) {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := mfa.Verify(ctx, username, in.Code); err != nil {
+            recordLoginFailure(guard, username, c.ClientIP())
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+            return
+        }
+        s, err := issueToken(username, roles, jwtSecret)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
+            return
+        }
+        loginSucceeded(authStore, guard, username)
+        c.JSON(http.StatusOK, gin.H{"token": s})
+    })
+
+    // enrollment works with a session token (self-service) or with the login
+    // challenge when policy forces a not-yet-enrolled user to set up MFA
+    rg.POST("/auth/mfa/enroll", func(c *gin.Context) {
+        var in struct {
+            MFAToken string `json:"mfa_token"`
+        }
+        _ = c.ShouldBindJSON(&in)
+        username, _, _, err := mfaSubject(c, in.MFAToken, jwtSecret)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        secret, uri, err := mfa.BeginEnrollment(ctx, username)
+        if err != nil {
+            c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
+    })
+
+    rg.POST("/auth/mfa/enroll/confirm", func(c *gin.Context) {
+        var in struct {
+            MFAToken string `json:"mfa_token"`
+            Code     string `json:"code"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.Code == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "code required"})
+            return
+        }
+        username, roles, challenge, err := mfaSubject(c, in.MFAToken, jwtSecret)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        codes, err := mfa.ConfirmEnrollment(ctx, username, in.Code)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+            return
+        }
+        out := gin.H{"recovery_codes": codes}
+        if challenge {
+            s, err := issueToken(username, roles, jwtSecret)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
+                return
+            }
+            out["token"] = s
+            loginSucceeded(authStore, nil, username)
+        }
+        c.JSON(http.StatusOK, out)
+    })
+}
+
+// RegisterMFAAdminRoutes registers admin MFA management; mount it behind admin auth.
+func RegisterMFAAdminRoutes(rg *gin.RouterGroup, mfa *services.MFAService) {
+    rg.POST("/users/:username/mfa/reset", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := mfa.Reset(ctx, middleware.CurrentUser(c), c.Param("username")); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "mfa reset failed"})
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterPasswordRoutes registers password change and reset endpoints.
+func RegisterPasswordRoutes(rg *gin.RouterGroup, pw *services.PasswordService, guard *services.LoginGuard, jwtSecret []byte) {
+    // change works with a session token; username + current password alone is
+    // accepted only for accounts that must change their password before they
+    // can log in
+    rg.POST("/auth/password/change", func(c *gin.Context) {
+        var in struct {
+            Username        string `json:"username"`
+            CurrentPassword string `json:"current_password"`
+            NewPassword     string `json:"new_password"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.CurrentPassword == "" || in.NewPassword == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "current_password and new_password required"})
+            return
+        }
+        username, change := in.Username, pw.ChangeRequired
+        if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+            claims, err := middleware.ParseToken(strings.TrimPrefix(h, "Bearer "), jwtSecret)
+            if err != nil || claims["typ"] == middleware.TokenTypeMFAChallenge {
+                c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+                return
+            }
+            username, _ = claims["sub"].(string)
+            change = pw.Change
+        }
+        if username == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "username required"})
+            return
+        }
+        if throttled(c, guard, username) {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        err := change(ctx, username, in.CurrentPassword, in.NewPassword)
+        if errors.Is(err, services.ErrBadCredentials) {
+            recordLoginFailure(guard, username, c.ClientIP())
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "bad credentials"})
+            return
+        }
+        if errors.Is(err, services.ErrSessionRequired) {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "session token required"})
+            return
+        }
+        if writePasswordError(c, err) {
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    rg.POST("/auth/password/forgot", func(c *gin.Context) {
+        var in struct {
+            Username string `json:"username"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.Username == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "username required"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        if err := pw.RequestReset(ctx, in.Username); err != nil {
+            // never surface the failure: the answer must not reveal whether the account exists
+            fmt.Printf("password reset request failed: %v\n", err)
+        }
+        c.JSON(http.StatusAccepted, gin.H{"status": "if the account exists, a reset link has been sent"})
+    })
+
+    rg.POST("/auth/password/reset", func(c *gin.Context) {
+        var in struct {
+            Token       string `json:"token"`
+            NewPassword string `json:"new_password"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.Token == "" || in.NewPassword == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "token and new_password required"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        err := pw.Reset(ctx, in.Token, in.NewPassword)
+        if errors.Is(err, services.ErrInvalidResetToken) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+            return
+        }
+        if writePasswordError(c, err) {
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+}
+
+// writePasswordError answers policy violations with 400 and other errors with 500.
+func writePasswordError(c *gin.Context, err error) bool {
+    if err == nil {
+        return false
+    }
+    var pe *services.PasswordPolicyError
+    if errors.As(err, &pe) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "password policy", "violations": pe.Violations})
+        return true
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "password update failed"})
+    return true
+}
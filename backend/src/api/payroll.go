@@ -2,44 +2,178 @@ package api
 
 import (
     "context"
-    "fmt"
+    "errors"
     "net/http"
+    "strconv"
     "time"
 
     "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
     "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterPayrollRoutes(rg *gin.RouterGroup, repo services.PayrollRepo) {
+// RegisterPayrollRoutes registers payroll record entry and the employee
+// view.
+func RegisterPayrollRoutes(rg *gin.RouterGroup, records *services.PayrollRecordService) {
     rg.POST("/payroll", func(c *gin.Context) {
-        var in map[string]interface{}
+        var in models.PayrollRecord
         if err := c.BindJSON(&in); err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json", "detail": err.Error()})
             return
         }
-        if in["id"] == nil || in["id"] == "" {
-            in["id"] = fmt.Sprintf("pay-%d", time.Now().UnixNano())
-        }
-        doc := in
         ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
         defer cancel()
-        out, err := repo.Create(ctx, doc)
+        out, err := records.Create(ctx, middleware.CurrentUser(c), in)
         if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "db insert failed"})
+            writePayrollRecordError(c, err)
             return
         }
         c.JSON(http.StatusCreated, out)
     })
 
+    // ?limit=&offset=
     rg.GET("/payroll/employee/:id", func(c *gin.Context) {
-        id := c.Param("id")
+        f := services.PayrollFilter{EmployeeID: c.Param("id")}
+        if !bindPayrollPage(c, &f) {
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, total, err := records.List(ctx, f)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": f.Limit, "offset": f.Offset})
+    })
+}
+
+// RegisterPayrollRecordRoutes registers lookup, search, period totals and
+// voiding of payroll records; mount it behind payroll/admin auth.
+func RegisterPayrollRecordRoutes(rg *gin.RouterGroup, records *services.PayrollRecordService) {
+    // ?employee_id=&period=&status=&limit=&offset=
+    rg.GET("/payroll/records", func(c *gin.Context) {
+        f := services.PayrollFilter{EmployeeID: c.Query("employee_id"), Period: c.Query("period"), Status: c.Query("status")}
+        if !bindPayrollPage(c, &f) {
+            return
+        }
         ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
         defer cancel()
-        items, err := repo.ListByEmployee(ctx, id)
+        items, total, err := records.List(ctx, f)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": f.Limit, "offset": f.Offset})
+    })
+
+    rg.GET("/payroll/records/totals", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        items, err := records.Totals(ctx, c.Query("period"))
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
             return
         }
         c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
     })
+
+    rg.GET("/payroll/records/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        r, err := records.Get(ctx, c.Param("id"))
+        if err != nil {
+            writePayrollRecordError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, r)
+    })
+
+    rg.POST("/payroll/records/:id/void", func(c *gin.Context) {
+        var in struct {
+            Reason string `json:"reason"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        r, err := records.Void(ctx, middleware.CurrentUser(c), c.Param("id"), in.Reason)
+        if err != nil {
+            writePayrollRecordError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, r)
+    })
+}
+
+// bindPayrollPage reads ?limit= and ?offset= into f and pages it (see
+// PayrollFilter.Paged), answering 400 on a malformed value.
+func bindPayrollPage(c *gin.Context, f *services.PayrollFilter) bool {
+    for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+        if v := c.Query(name); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a non-negative number"})
+                return false
+            }
+            *dst = n
+        }
+    }
+    *f = f.Paged()
+    return true
+}
+
+// writePayrollRecordError maps payroll record errors to HTTP responses.
+func writePayrollRecordError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments):
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case errors.Is(err, services.ErrInvalidPayrollRecord):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrPayrollRecordExists), errors.Is(err, services.ErrPayrollRecordVoided), errors.Is(err, services.ErrPayrollRecordChanged):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "db error", "detail": err.Error()})
+    }
+}
+
+// RegisterPayrollEngineRoutes registers payslip calculation; mount it behind
+// payroll/admin auth.
+func RegisterPayrollEngineRoutes(rg *gin.RouterGroup, svc *services.PayrollService) {
+    // preview a payslip; nothing is stored
+    rg.POST("/payroll/calculate", func(c *gin.Context) {
+        var req services.PayrollRequest
+        if err := c.BindJSON(&req); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        if req.EmployeeID == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "employee_id required"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        p, err := svc.Calculate(ctx, req)
+        if err != nil {
+            writePayrollError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, p)
+    })
+}
+
+// writePayrollError maps payroll engine errors to HTTP responses.
+func writePayrollError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments):
+        c.JSON(http.StatusNotFound, gin.H{"error": "employee not found"})
+    case errors.Is(err, services.ErrInvalidPayrollRequest), errors.Is(err, services.ErrNoSalary):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "payroll calculation failed", "detail": err.Error()})
+    }
 }
@@ -0,0 +1,370 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// generateTimeout bounds payslip generation for a whole run.
+const generateTimeout = 60 * time.Second
+
+// RegisterPayrollRunRoutes registers pay periods, payroll runs and their
+// lifecycle; mount it behind payroll/admin auth. Approval is further limited
+// to the service's approver roles.
+func RegisterPayrollRunRoutes(rg *gin.RouterGroup, runs *services.PayrollRunService) {
+    rg.GET("/payroll/periods", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.ListPeriods(ctx)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.POST("/payroll/periods", func(c *gin.Context) {
+        var in models.PayPeriod
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        p, err := runs.CreatePeriod(ctx, middleware.CurrentUser(c), in)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, p)
+    })
+
+    rg.GET("/payroll/runs", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.ListRuns(ctx, c.Query("status"))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // create a draft run for a period and generate its payslips
+    rg.POST("/payroll/runs", func(c *gin.Context) {
+        var in struct {
+            PeriodID string `json:"period_id"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.PeriodID == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "period_id required"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+        defer cancel()
+        run, err := runs.CreateRun(ctx, middleware.CurrentUser(c), in.PeriodID)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, run)
+    })
+
+    rg.GET("/payroll/runs/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.GetRun(ctx, c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.DELETE("/payroll/runs/:id", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := runs.DeleteRun(ctx, middleware.CurrentUser(c), c.Param("id")); err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    rg.GET("/payroll/runs/:id/payslips", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.Payslips(ctx, c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/payroll/runs/:id/diff", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        d, err := runs.Diff(ctx, c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, d)
+    })
+
+    // against defaults to the previous finalized run of the same frequency
+    rg.GET("/payroll/runs/:id/variance", func(c *gin.Context) {
+        format := c.DefaultQuery("format", "json")
+        if format != "json" && format != "csv" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        r, err := runs.Variance(ctx, c.Param("id"), c.Query("against"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        if format == "json" {
+            c.JSON(http.StatusOK, r)
+            return
+        }
+        content, err := services.VarianceCSV(r)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "variance report failed", "detail": err.Error()})
+            return
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("variance-%s.csv", r.RunID)))
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+    })
+
+    rg.POST("/payroll/runs/:id/generate", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+        defer cancel()
+        run, err := runs.Regenerate(ctx, middleware.CurrentUser(c), c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.POST("/payroll/runs/:id/submit", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.Submit(ctx, middleware.CurrentUser(c), c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.POST("/payroll/runs/:id/approve", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.Approve(ctx, middleware.CurrentUser(c), middleware.CurrentRoles(c), c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.POST("/payroll/runs/:id/reject", func(c *gin.Context) {
+        var in struct {
+            Reason string `json:"reason"`
+        }
+        if err := c.BindJSON(&in); err != nil || in.Reason == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "reason required"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.Reject(ctx, middleware.CurrentUser(c), c.Param("id"), in.Reason)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.POST("/payroll/runs/:id/finalize", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.Finalize(ctx, middleware.CurrentUser(c), c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.POST("/payroll/runs/:id/paid", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.MarkPaid(ctx, middleware.CurrentUser(c), c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, run)
+    })
+
+    rg.GET("/payroll/runs/:id/adjustments", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.Adjustments(ctx, c.Param("id"))
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // the only correction allowed once a run is finalized
+    rg.POST("/payroll/runs/:id/adjustments", func(c *gin.Context) {
+        var in models.PayrollAdjustment
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        a, err := runs.AddAdjustment(ctx, middleware.CurrentUser(c), c.Param("id"), in)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, a)
+    })
+
+    // recompute closed periods after a back-dated salary or attendance change
+    rg.POST("/payroll/retro", func(c *gin.Context) {
+        var in services.RetroRequest
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+        defer cancel()
+        items, err := runs.Retro(ctx, middleware.CurrentUser(c), in)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // 13th-month entitlement of one employee up to a date (default 31 December)
+    rg.GET("/payroll/thirteenth-month/:employee_id", func(c *gin.Context) {
+        through := c.Query("through")
+        if through == "" {
+            through = time.Now().Format("2006") + "-12-31"
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        tm, err := runs.ThirteenthMonth(ctx, c.Param("employee_id"), through)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, tm)
+    })
+
+    rg.POST("/payroll/thirteenth-month/runs", func(c *gin.Context) {
+        var in struct {
+            Year      int    `json:"year"`
+            PayDate   string `json:"pay_date"`
+            Frequency string `json:"frequency"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+        defer cancel()
+        run, err := runs.CreateThirteenthMonthRun(ctx, middleware.CurrentUser(c), in.Year, in.PayDate, in.Frequency)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, run)
+    })
+
+    // compute final pay for a separation without saving it
+    rg.POST("/payroll/final-pay", func(c *gin.Context) {
+        var in models.FinalPayInput
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        fp, err := runs.FinalPay(ctx, in)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, fp)
+    })
+
+    // start the final-pay run; finalizing it marks the employee separated
+    rg.POST("/payroll/final-pay/runs", func(c *gin.Context) {
+        var in struct {
+            models.FinalPayInput
+            PayDate string `json:"pay_date"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        run, err := runs.CreateFinalPayRun(ctx, middleware.CurrentUser(c), in.FinalPayInput, in.PayDate)
+        if err != nil {
+            writeRunError(c, err)
+            return
+        }
+        c.JSON(http.StatusCreated, run)
+    })
+
+    rg.GET("/payroll/retro/report", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := runs.RetroReport(ctx, c.Query("employee_id"), c.Query("from"), c.Query("to"))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+}
+
+// writeRunError maps payroll run errors to HTTP responses.
+func writeRunError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, mongo.ErrNoDocuments):
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case errors.Is(err, services.ErrInvalidPayrollRequest), errors.Is(err, services.ErrInvalidAdjustment), errors.Is(err, services.ErrNoSalary):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrNotApprover):
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrPeriodOverlap), errors.Is(err, services.ErrRunExists), errors.Is(err, services.ErrRunState),
+        errors.Is(err, services.ErrRunLocked), errors.Is(err, services.ErrSelfApproval), errors.Is(err, services.ErrRunChanged):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "payroll run failed", "detail": err.Error()})
+    }
+}
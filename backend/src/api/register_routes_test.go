@@ -1,11 +1,15 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ronaldpalay/hris/src/middleware"
+	"github.com/ronaldpalay/hris/src/money"
 	"github.com/ronaldpalay/hris/src/services"
 )
 
@@ -15,7 +19,7 @@ func TestRegisterAuthRoutes(t *testing.T) {
 	r := gin.New()
 	g := r.Group("/api")
 	authStore := services.NewInMemoryUserStore()
-	RegisterAuthRoutes(g, authStore, []byte("test-secret"))
+	RegisterAuthRoutes(g, authStore, nil, nil, []byte("test-secret"))
 
 	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
 	w := httptest.NewRecorder()
@@ -44,8 +48,9 @@ func TestRegisterPayrollRoutes(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	g := r.Group("/api")
-	pRepo := services.NewInMemoryPayrollRepo()
-	RegisterPayrollRoutes(g, pRepo)
+	records := services.NewPayrollRecordService(services.NewInMemoryPayrollRepo(), nil, money.DefaultRoundingPolicy())
+	RegisterPayrollRoutes(g, records)
+	RegisterPayrollRecordRoutes(g, records)
 
 	req := httptest.NewRequest(http.MethodPost, "/api/payroll", nil)
 	w := httptest.NewRecorder()
@@ -53,4 +58,429 @@ func TestRegisterPayrollRoutes(t *testing.T) {
 	if w.Code == http.StatusNotFound {
 		t.Fatalf("payroll route not registered; got 404")
 	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll", strings.NewReader(`{"payroll_id":"pay-1","employee_id":"E-1","period":"2025-08","gross":1500,"deductions":100,"taxes":165.44}`)))
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"net":1234.56`) {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/api/payroll/records?period=2025-08&limit=10": http.StatusOK,
+		"/api/payroll/records?limit=x":                 http.StatusBadRequest,
+		"/api/payroll/records/totals":                  http.StatusOK,
+		"/api/payroll/records/pay-1":                   http.StatusOK,
+		"/api/payroll/records/pay-2":                   http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll/records/pay-1/void", strings.NewReader(`{"reason":"entered twice"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"voided"`) {
+		t.Fatalf("void: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRegisterPayrollEngineRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	svc := services.NewPayrollService(services.NewInMemoryEmployeeRepo(), nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	RegisterPayrollEngineRoutes(g, svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payroll/calculate", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusNotFound {
+		t.Fatalf("payroll calculate route not registered; got 404")
+	}
+}
+
+func TestRegisterPayrollRunRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	RegisterPayrollRunRoutes(g, services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/payroll/runs", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("payroll runs route: got %d", w.Code)
+	}
+	for path, want := range map[string]int{
+		"/api/payroll/runs/run-1/variance?format=xml": http.StatusBadRequest,
+		"/api/payroll/runs/run-1/variance?format=csv": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterSelfServiceRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	runs := services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil)
+	renderer, _ := services.NewPayslipRenderer(services.PayslipCompany{Name: "HRIS"}, "", false)
+	RegisterSelfServiceRoutes(g, services.NewUserService(services.NewInMemoryUserStore(), emps, nil), runs, renderer, services.NewLoanService(services.NewInMemoryLoanStore(), emps, nil))
+
+	for path, want := range map[string]int{
+		"/api/me/payslips/ps-1.pdf": http.StatusForbidden, // no account linked to an employee
+		"/api/me/payslips/ps-1":     http.StatusNotFound,
+		"/api/me/loans":             http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterDisbursementRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	layouts, _ := services.DefaultBankLayouts()
+	RegisterDisbursementRoutes(g, services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil), layouts)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/bank-layouts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bank layouts route: got %d", w.Code)
+	}
+	for body, want := range map[string]int{
+		`{"layout":"nope"}`:  http.StatusBadRequest,
+		`{"layout":"fixed"}`: http.StatusNotFound, // no such run
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll/runs/run-1/bank-export", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", body, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterRemittanceRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	runs := services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil)
+	RegisterRemittanceRoutes(g, services.NewRemittanceService(runs, services.NewInMemoryRemittanceStore(), services.RemittanceEmployer{}, nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/remittances/outstanding?year=2025", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("outstanding route: got %d", w.Code)
+	}
+	for body, want := range map[string]int{
+		`{"agency":"bir","month":"2025-06"}`: http.StatusBadRequest,
+		`{"agency":"sss","month":"2025-06"}`: http.StatusBadRequest, // no employer number, nothing finalized
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll/remittances", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", body, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterBIRRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	runs := services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil)
+	tables, _ := services.DefaultTaxTables()
+	bir, _ := services.NewBIRService(runs, tables, services.BIREmployer{Name: "HRIS"}, "")
+	RegisterBIRRoutes(g, bir)
+
+	for path, want := range map[string]int{
+		"/api/payroll/bir/2316?year=2025":                 http.StatusOK,
+		"/api/payroll/bir/2316/E-1.pdf?year=2025":         http.StatusNotFound,
+		"/api/payroll/bir/reconciliation?year=2025":       http.StatusOK,
+		"/api/payroll/bir/alphalist?year=2025":            http.StatusBadRequest, // no employer TIN, nothing finalized
+		"/api/payroll/bir/alphalist?year=2025&format=xls": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterGLRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	chart, _ := services.DefaultChartOfAccounts()
+	RegisterGLRoutes(g, services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil), chart)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/gl-accounts", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"net_pay":"2100"`) {
+		t.Fatalf("gl accounts route: got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/runs/run-1/journal", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("journal route: got %d", w.Code)
+	}
+	for body, want := range map[string]int{
+		`{"format":"xml"}`: http.StatusBadRequest,
+		`{"format":"csv"}`: http.StatusNotFound, // no such run
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll/runs/run-1/gl-export", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", body, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterExchangeRateRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	engine := services.NewPayrollService(emps, nil, nil, services.DefaultPayrollConfig(), money.DefaultRoundingPolicy(), services.DefaultPayrollRules()...)
+	runs := services.NewPayrollRunService(services.NewInMemoryPayrollRunStore(), emps, engine, nil, nil)
+	records := services.NewPayrollRecordService(services.NewInMemoryPayrollRepo(), nil, money.DefaultRoundingPolicy())
+	fx, _ := services.NewExchangeRateService(services.NewInMemoryExchangeRateStore(), nil, "PHP", "")
+	RegisterExchangeRateRoutes(g, fx, runs, records)
+
+	for _, tc := range []struct {
+		contentType, body string
+		want              int
+	}{
+		{"application/json", `{"from":"USD","to":"PHP","rate":"56.25","effective_date":"2025-06-01"}`, http.StatusCreated},
+		{"application/json", `{"from":"USD","to":"PHP","rate":"0","effective_date":"2025-06-01"}`, http.StatusBadRequest},
+		{"text/csv", "from,to,rate,effective_date\nEUR,PHP,61.10,2025-06-01\n", http.StatusCreated},
+		{"text/csv", "currency,rate\nEUR,61.10\n", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/payroll/exchange-rates", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s: got %d, want %d: %s", tc.body, w.Code, tc.want, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/exchange-rates?to=php", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":2`) {
+		t.Fatalf("list rates: got %d %s", w.Code, w.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/api/payroll/runs/run-1/cost":                            http.StatusNotFound,
+		"/api/payroll/records/cost?period=2025-06":                http.StatusOK,
+		"/api/payroll/records/cost?period=2025-06&rate_date=soon": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestRegisterLeaveRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	_, _ = emps.Create(context.Background(), map[string]interface{}{"employee_id": "E-1"})
+	RegisterLeaveRoutes(g, services.NewUserService(services.NewInMemoryUserStore(), emps, nil), services.NewLeaveService(services.NewInMemoryLeaveStore(), emps, nil, nil))
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/api/leave/types", "", http.StatusOK},
+		{http.MethodGet, "/api/leave/requests", "", http.StatusForbidden}, // no account linked to an employee
+		{http.MethodGet, "/api/leave/approvals", "", http.StatusOK},
+		{http.MethodPost, "/api/leave/requests", `{"type":"vacation","start_date":"2025-06-02","end_date":"2025-06-02"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/leave/requests", `{"employee_id":"E-1","type":"vacation","start_date":"2025-06-02","end_date":"2025-06-02"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/leave/requests/leave-1/approve", "", http.StatusNotFound},
+		{http.MethodPost, "/api/leave/requests/leave-1/reject", `{"comment":`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if w.Code != tc.want {
+			t.Fatalf("%s %s: got %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
+
+func TestRegisterLeaveBalanceRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	policies, _ := services.DefaultLeaveAccrualPolicies()
+	ledger, err := services.NewLeaveLedgerService(services.NewInMemoryLeaveLedgerStore(), services.NewInMemoryLeaveStore(), emps, nil, policies, "2025-01-01")
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	RegisterLeaveBalanceRoutes(g, services.NewUserService(services.NewInMemoryUserStore(), emps, nil), ledger)
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/api/leave/accrual-policies", "", http.StatusOK},
+		{http.MethodGet, "/api/leave/balances", "", http.StatusBadRequest}, // no account linked to an employee
+		{http.MethodGet, "/api/leave/balances?employee_id=E-1", "", http.StatusForbidden},
+		{http.MethodGet, "/api/leave/ledger", "", http.StatusForbidden},
+		{http.MethodPost, "/api/leave/ledger", `{"employee_id":"E-1","type":"vacation","days":2,"note":"opening balance"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/leave/ledger", `{"days":`, http.StatusBadRequest},
+		{http.MethodPost, "/api/leave/accruals/run", "", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if w.Code != tc.want {
+			t.Fatalf("%s %s: got %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
+
+func TestRegisterHolidayRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	_, _ = emps.Create(context.Background(), map[string]interface{}{"employee_id": "E-1"})
+	calendar := services.NewHolidayCalendar(services.NewInMemoryHolidayStore(), nil, nil)
+	RegisterHolidayRoutes(g, calendar)
+	RegisterHolidayAdminRoutes(g, calendar, emps)
+
+	for _, tc := range []struct {
+		method, path, ct, body string
+		want                   int
+	}{
+		{http.MethodPost, "/api/holidays", "text/csv", "date,name,kind\r\n2025-06-12,Independence Day,regular\r\n", http.StatusCreated},
+		{http.MethodPost, "/api/holidays", "text/calendar", "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20251225\r\nSUMMARY:Christmas Day\r\nEND:VEVENT\r\n", http.StatusBadRequest}, // no kind
+		{http.MethodPost, "/api/holidays?kind=regular", "text/calendar", "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20251225\r\nSUMMARY:Christmas Day\r\nEND:VEVENT\r\n", http.StatusCreated},
+		{http.MethodPost, "/api/holidays", "application/json", `[{"date":"2025-08-21","name":"Ninoy Aquino Day","kind":"special"}]`, http.StatusCreated},
+		{http.MethodPost, "/api/holidays", "application/json", `[{"date":"2025-08-21","name":"Ninoy Aquino Day","kind":"optional"}]`, http.StatusBadRequest},
+		{http.MethodGet, "/api/holidays?from=2025-01-01&to=2025-12-31", "", "", http.StatusOK},
+		{http.MethodGet, "/api/holidays/work-weeks", "", "", http.StatusOK},
+		{http.MethodGet, "/api/holidays/days?employee_id=E-1&from=2025-06-09&to=2025-06-13", "", "", http.StatusOK},
+		{http.MethodGet, "/api/holidays/days?employee_id=E-9&from=2025-06-09&to=2025-06-13", "", "", http.StatusNotFound},
+		{http.MethodGet, "/api/holidays/days?employee_id=E-1&from=2025-06-13&to=2025-06-09", "", "", http.StatusBadRequest},
+		{http.MethodDelete, "/api/holidays/hol-unknown", "", "", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.ct != "" {
+			req.Header.Set("Content-Type", tc.ct)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s %s: got %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+		if strings.HasPrefix(tc.path, "/api/holidays/days?employee_id=E-1") && w.Code == http.StatusOK && !strings.Contains(w.Body.String(), `"working_days":4`) {
+			t.Fatalf("days: %s", w.Body.String())
+		}
+	}
+}
+
+func TestRegisterLeaveCalendarRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	ctx := context.Background()
+	emps := services.NewInMemoryEmployeeRepo()
+	_, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1"})
+	store := services.NewInMemoryUserStore()
+	_ = store.CreateUserWithHash(ctx, "hr", "x", []string{services.RoleHR})
+	users := services.NewUserService(store, emps, nil)
+	leave := services.NewLeaveService(services.NewInMemoryLeaveStore(), emps, nil, nil)
+	calendar := services.NewLeaveCalendarService(leave, services.NewInMemoryCalendarFeedStore(), nil, 0)
+	// stands in for AuthMiddleware
+	me := g.Group("", func(c *gin.Context) {
+		c.Set(middleware.ContextUserKey, "hr")
+		c.Set(middleware.ContextRolesKey, []string{services.RoleHR})
+	})
+	RegisterLeaveCalendarRoutes(me, users, calendar, "http://hris.test/api/leave/calendar.ics?token=")
+	RegisterLeaveFeedRoutes(g, users, calendar)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/leave/calendar?from=2025-06-01&to=2025-06-30", http.StatusOK},
+		{http.MethodGet, "/api/leave/calendar?from=2025-06-30&to=2025-06-01", http.StatusBadRequest},
+		{http.MethodGet, "/api/leave/calendar?max_out=0", http.StatusBadRequest},
+		{http.MethodDelete, "/api/leave/calendar/feed", http.StatusNotFound},
+		{http.MethodGet, "/api/leave/calendar.ics", http.StatusNotFound},
+		{http.MethodGet, "/api/leave/calendar.ics?token=unknown", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Fatalf("%s %s: got %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/leave/calendar/feed", nil))
+	i := strings.Index(w.Body.String(), "?token=")
+	if w.Code != http.StatusCreated || i < 0 {
+		t.Fatalf("feed token: %d %s", w.Code, w.Body.String())
+	}
+	token := w.Body.String()[i+len("?token=") : i+len("?token=")+64]
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/leave/calendar.ics?token="+token, nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") || !strings.HasPrefix(w.Body.String(), "BEGIN:VCALENDAR") {
+		t.Fatalf("feed: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRegisterLoanRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/api")
+	emps := services.NewInMemoryEmployeeRepo()
+	_, _ = emps.Create(context.Background(), map[string]interface{}{"employee_id": "E-1"})
+	RegisterLoanRoutes(g, services.NewLoanService(services.NewInMemoryLoanStore(), emps, nil))
+
+	for body, want := range map[string]int{
+		`{"employee_id":"E-1","type":"sss_loan","principal":"12000","terms":24,"start_period":"2025-07-15"}`: http.StatusCreated,
+		`{"employee_id":"E-1","type":"car_loan","principal":"12000","terms":24,"start_period":"2025-07-15"}`: http.StatusBadRequest,
+		`{"employee_id":"E-9","type":"sss_loan","principal":"12000","terms":24,"start_period":"2025-07-15"}`: http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/payroll/loans", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d", body, w.Code, want)
+		}
+		if want == http.StatusCreated && !strings.Contains(w.Body.String(), `"installment":500.00`) {
+			t.Fatalf("loan: %s", w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/payroll/loans?employee_id=E-1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":1`) {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
 }
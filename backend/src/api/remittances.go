@@ -0,0 +1,110 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+)
+
+// RegisterRemittanceRoutes registers the SSS, PhilHealth and Pag-IBIG
+// remittance reports and their submission tracking; mount it behind
+// payroll/admin auth.
+func RegisterRemittanceRoutes(rg *gin.RouterGroup, remittances *services.RemittanceService) {
+    rg.GET("/payroll/remittances", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, err := remittances.List(ctx, services.RemittanceFilter{Agency: c.Query("agency"), Month: c.Query("month"), Year: c.Query("year")})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    rg.GET("/payroll/remittances/outstanding", func(c *gin.Context) {
+        year := time.Now().Year()
+        if y := c.Query("year"); y != "" {
+            n, err := strconv.Atoi(y)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "year must be a number"})
+                return
+            }
+            year = n
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        items, err := remittances.Outstanding(ctx, year)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+
+    // the report is the response body; its record travels in headers
+    rg.POST("/payroll/remittances", func(c *gin.Context) {
+        var in struct {
+            Agency string `json:"agency"`
+            Month  string `json:"month"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        f, err := remittances.Generate(ctx, middleware.CurrentUser(c), in.Agency, in.Month)
+        if err != nil {
+            writeRemittanceError(c, err)
+            return
+        }
+        contentType := "text/csv; charset=utf-8"
+        if f.Remittance.Agency == models.AgencySSS {
+            contentType = "text/plain; charset=utf-8"
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Remittance.FileName))
+        c.Header("X-Remittance-ID", f.Remittance.RemittanceID)
+        c.Header("X-Remittance-Checksum", f.Remittance.Checksum)
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusCreated, contentType, f.Content)
+    })
+
+    rg.POST("/payroll/remittances/:id/submit", func(c *gin.Context) {
+        var in struct {
+            ReferenceNumber string `json:"reference_number"`
+            PaidOn          string `json:"paid_on"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        r, err := remittances.Submit(ctx, middleware.CurrentUser(c), c.Param("id"), in.ReferenceNumber, in.PaidOn)
+        if err != nil {
+            writeRemittanceError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, r)
+    })
+}
+
+// writeRemittanceError maps remittance errors to HTTP responses.
+func writeRemittanceError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, services.ErrUnknownAgency):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrAlreadyRemitted), errors.Is(err, services.ErrRemittanceState):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        writeExportError(c, err)
+    }
+}
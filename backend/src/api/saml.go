@@ -0,0 +1,84 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterSAMLRoutes exposes the SAML service provider endpoints. A
+// successful assertion signs in as the local account linked to its NameID
+// (or one provisioned for it, see UserService.SAMLAccount) and then goes
+// through the same suspension and MFA checks as /auth/login.
+func RegisterSAMLRoutes(rg *gin.RouterGroup, sp *services.SAMLServiceProvider, users *services.UserService, authStore services.AuthStore, mfa *services.MFAService, jwtSecret []byte) {
+    rg.GET("/auth/saml/metadata", func(c *gin.Context) {
+        c.Data(http.StatusOK, "application/samlmetadata+xml", sp.Metadata())
+    })
+
+    rg.GET("/auth/saml/login", func(c *gin.Context) {
+        u, err := sp.AuthnRequestURL(c.Query("relay_state"))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build authn request"})
+            return
+        }
+        c.Redirect(http.StatusFound, u)
+    })
+
+    rg.POST("/auth/saml/acs", func(c *gin.Context) {
+        resp := c.PostForm("SAMLResponse")
+        if resp == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "SAMLResponse required"})
+            return
+        }
+        a, err := sp.ParseResponse(resp)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid saml response"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        u, err := users.SAMLAccount(ctx, a.NameID, a.Roles)
+        if errors.Is(err, services.ErrSAMLAlreadyLinked) || errors.Is(err, mongo.ErrNoDocuments) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "no account for this identity"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
+            return
+        }
+        if u.Status == models.UserStatusSuspended {
+            c.JSON(http.StatusForbidden, gin.H{"error": "account suspended"})
+            return
+        }
+        relay := c.PostForm("RelayState")
+        if mfa != nil {
+            enabled, err := mfa.Enabled(ctx, u.Username)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
+                return
+            }
+            if enabled || mfa.Required(u.Roles) {
+                s, err := issueMFAChallenge(u.Username, u.Roles, jwtSecret)
+                if err != nil {
+                    c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
+                    return
+                }
+                c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_enrolled": enabled, "mfa_token": s, "relay_state": relay})
+                return
+            }
+        }
+        s, err := issueToken(u.Username, u.Roles, jwtSecret)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
+            return
+        }
+        loginSucceeded(authStore, nil, u.Username)
+        c.JSON(http.StatusOK, gin.H{"token": s, "relay_state": relay})
+    })
+}
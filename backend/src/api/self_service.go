@@ -0,0 +1,101 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterSelfServiceRoutes registers the /me endpoints; mount them behind
+// AuthMiddleware. The caller's employee record is the one linked to their
+// user account.
+func RegisterSelfServiceRoutes(rg *gin.RouterGroup, users *services.UserService, runs *services.PayrollRunService, payslips *services.PayslipRenderer, loans *services.LoanService) {
+    // employeeOf resolves the caller's employee id or writes the error
+    employeeOf := func(c *gin.Context, ctx context.Context) (string, bool) {
+        u, err := users.Get(ctx, middleware.CurrentUser(c))
+        if err != nil || u.EmployeeID == "" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "account is not linked to an employee"})
+            return "", false
+        }
+        return u.EmployeeID, true
+    }
+
+    rg.GET("/me/payslips", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        empID, ok := employeeOf(c, ctx)
+        if !ok {
+            return
+        }
+        items, err := runs.ReleasedPayslips(ctx, empID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "password_protected": payslips.Protected()})
+    })
+
+    // gin takes the whole segment as the parameter, so the extension is checked here
+    rg.GET("/me/payslips/:file", func(c *gin.Context) {
+        id := strings.TrimSuffix(c.Param("file"), ".pdf")
+        if id == c.Param("file") || id == "" {
+            c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        empID, ok := employeeOf(c, ctx)
+        if !ok {
+            return
+        }
+        v, err := runs.PayslipView(ctx, empID, id)
+        if errors.Is(err, mongo.ErrNoDocuments) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        doc, err := payslips.Render(v)
+        if errors.Is(err, services.ErrNoPayslipPassword) {
+            c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "payslip rendering failed", "detail": err.Error()})
+            return
+        }
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".pdf"))
+        c.Header("Cache-Control", "no-store")
+        c.Data(http.StatusOK, "application/pdf", doc)
+    })
+
+    // balances, ledger and remaining schedule of the caller's loans
+    rg.GET("/me/loans", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        empID, ok := employeeOf(c, ctx)
+        if !ok {
+            return
+        }
+        list, err := loans.List(ctx, services.LoanFilter{EmployeeID: empID})
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        items := make([]services.LoanView, 0, len(list))
+        for _, l := range list {
+            items = append(items, services.NewLoanView(l))
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+    })
+}
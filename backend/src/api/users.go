@@ -0,0 +1,202 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/ronaldpalay/hris/src/middleware"
+    "github.com/ronaldpalay/hris/src/services"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RegisterUserRoutes registers admin account management; mount it behind admin auth.
+func RegisterUserRoutes(rg *gin.RouterGroup, users *services.UserService, pw *services.PasswordService) {
+    rg.GET("/users", func(c *gin.Context) {
+        page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+        perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+        f := services.UserFilter{
+            Role:       c.Query("role"),
+            Status:     c.Query("status"),
+            EmployeeID: c.Query("employee_id"),
+            Query:      c.Query("q"),
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        items, total, err := users.List(ctx, page, perPage, f)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+    })
+
+    // accounts created here must change their password at first login
+    rg.POST("/users", func(c *gin.Context) {
+        var in struct {
+            Username   string   `json:"username"`
+            Password   string   `json:"password"`
+            Email      string   `json:"email"`
+            Roles      []string `json:"roles"`
+            EmployeeID string   `json:"employee_id"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid"})
+            return
+        }
+        if in.Username == "" || in.Password == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "username and password required"})
+            return
+        }
+        if err := services.ValidateRoles(in.Roles); err != nil {
+            writeUserError(c, err, "create user failed")
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        actor := middleware.CurrentUser(c)
+        if _, err := users.Get(ctx, in.Username); err == nil {
+            c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
+            return
+        }
+        // a link that cannot be made must not leave an unlinked account behind
+        if in.EmployeeID != "" {
+            if err := users.CanLinkEmployee(ctx, in.Username, in.EmployeeID); err != nil {
+                writeUserError(c, err, "link employee failed")
+                return
+            }
+        }
+        if err := pw.CreateUser(ctx, actor, in.Username, in.Password, in.Email, in.Roles); err != nil {
+            writeUserError(c, err, "create user failed")
+            return
+        }
+        if in.EmployeeID != "" {
+            if err := users.LinkEmployee(ctx, actor, in.Username, in.EmployeeID); err != nil {
+                if derr := users.Delete(ctx, actor, in.Username); derr != nil {
+                    writeUserError(c, derr, "link employee failed")
+                    return
+                }
+                writeUserError(c, err, "link employee failed")
+                return
+            }
+        }
+        u, err := users.Get(ctx, in.Username)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+            return
+        }
+        c.JSON(http.StatusCreated, u)
+    })
+
+    rg.GET("/users/:username", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        u, err := users.Get(ctx, c.Param("username"))
+        if err != nil {
+            writeUserError(c, err, "db error")
+            return
+        }
+        c.JSON(http.StatusOK, u)
+    })
+
+    // PATCH accepts any of roles, email, employee_id and saml_name_id ("" unlinks)
+    rg.PATCH("/users/:username", func(c *gin.Context) {
+        var in struct {
+            Roles      *[]string `json:"roles"`
+            Email      *string   `json:"email"`
+            EmployeeID *string   `json:"employee_id"`
+            SAMLNameID *string   `json:"saml_name_id"`
+        }
+        if err := c.BindJSON(&in); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid"})
+            return
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        username, actor := c.Param("username"), middleware.CurrentUser(c)
+        if _, err := users.Get(ctx, username); err != nil {
+            writeUserError(c, err, "db error")
+            return
+        }
+        if in.Roles != nil {
+            if err := users.SetRoles(ctx, actor, username, *in.Roles); err != nil {
+                writeUserError(c, err, "update failed")
+                return
+            }
+        }
+        if in.Email != nil {
+            if err := users.SetEmail(ctx, actor, username, *in.Email); err != nil {
+                writeUserError(c, err, "update failed")
+                return
+            }
+        }
+        if in.EmployeeID != nil {
+            if err := users.LinkEmployee(ctx, actor, username, *in.EmployeeID); err != nil {
+                writeUserError(c, err, "update failed")
+                return
+            }
+        }
+        if in.SAMLNameID != nil {
+            if err := users.LinkSAML(ctx, actor, username, *in.SAMLNameID); err != nil {
+                writeUserError(c, err, "update failed")
+                return
+            }
+        }
+        u, err := users.Get(ctx, username)
+        if err != nil {
+            writeUserError(c, err, "db error")
+            return
+        }
+        c.JSON(http.StatusOK, u)
+    })
+
+    rg.POST("/users/:username/suspend", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := users.Suspend(ctx, middleware.CurrentUser(c), c.Param("username")); err != nil {
+            writeUserError(c, err, "suspend failed")
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    rg.POST("/users/:username/reactivate", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := users.Reactivate(ctx, middleware.CurrentUser(c), c.Param("username")); err != nil {
+            writeUserError(c, err, "reactivate failed")
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    rg.DELETE("/users/:username", func(c *gin.Context) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := users.Delete(ctx, middleware.CurrentUser(c), c.Param("username")); err != nil {
+            writeUserError(c, err, "delete failed")
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+}
+
+// writeUserError maps account management errors to HTTP responses.
+func writeUserError(c *gin.Context, err error, fallback string) {
+    var pe *services.PasswordPolicyError
+    switch {
+    case errors.As(err, &pe):
+        c.JSON(http.StatusBadRequest, gin.H{"error": "password policy", "violations": pe.Violations})
+    case err == mongo.ErrNoDocuments:
+        c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+    case err == services.ErrUnknownRole, err == services.ErrEmployeeNotFound:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case err == services.ErrSelfModification, err == services.ErrEmployeeAlreadyLinked, err == services.ErrSAMLAlreadyLinked:
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+    }
+}
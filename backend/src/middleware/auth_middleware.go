@@ -1,6 +1,7 @@
 package middleware
 
 import (
+    "context"
     "fmt"
     "net/http"
     "strings"
@@ -9,8 +10,18 @@ import (
     "github.com/golang-jwt/jwt/v5"
 )
 
-// parseToken parses the JWT token string and returns the claims if valid.
-func parseToken(tok string, secret []byte) (jwt.MapClaims, error) {
+// TokenTypeMFAChallenge marks the short-lived token handed out between the
+// password step and the MFA step. It is not a session token.
+const TokenTypeMFAChallenge = "mfa_challenge"
+
+// Context keys set by AuthMiddleware.
+const (
+    ContextUserKey  = "auth_user"
+    ContextRolesKey = "auth_roles"
+)
+
+// ParseToken parses the JWT token string and returns the claims if valid.
+func ParseToken(tok string, secret []byte) (jwt.MapClaims, error) {
     p, err := jwt.ParseWithClaims(tok, jwt.MapClaims{}, func(t *jwt.Token) (interface{}, error) {
         if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
             return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
@@ -27,6 +38,47 @@ func parseToken(tok string, secret []byte) (jwt.MapClaims, error) {
     return claims, nil
 }
 
+// parseToken parses a session token; MFA challenge tokens are rejected.
+func parseToken(tok string, secret []byte) (jwt.MapClaims, error) {
+    claims, err := ParseToken(tok, secret)
+    if err != nil {
+        return nil, err
+    }
+    if claims["typ"] == TokenTypeMFAChallenge {
+        return nil, fmt.Errorf("mfa challenge token is not a session token")
+    }
+    return claims, nil
+}
+
+// ClaimRoles returns the roles claim, which can be []interface{}, []string, or string.
+func ClaimRoles(claims jwt.MapClaims) []string {
+    switch rs := claims["roles"].(type) {
+    case []interface{}:
+        out := make([]string, 0, len(rs))
+        for _, r := range rs {
+            if s, ok := r.(string); ok {
+                out = append(out, s)
+            }
+        }
+        return out
+    case []string:
+        return rs
+    case string:
+        return []string{rs}
+    }
+    return nil
+}
+
+// CurrentUser returns the authenticated username set by AuthMiddleware.
+func CurrentUser(c *gin.Context) string {
+    return c.GetString(ContextUserKey)
+}
+
+// CurrentRoles returns the authenticated user's roles set by AuthMiddleware.
+func CurrentRoles(c *gin.Context) []string {
+    return c.GetStringSlice(ContextRolesKey)
+}
+
 // AuthMiddleware validates JWT from the Authorization header using the provided secret.
 func AuthMiddleware(secret []byte) gin.HandlerFunc {
     return func(c *gin.Context) {
@@ -36,18 +88,54 @@ func AuthMiddleware(secret []byte) gin.HandlerFunc {
             return
         }
         tok := strings.TrimPrefix(h, "Bearer ")
-        _, err := parseToken(tok, secret)
+        claims, err := parseToken(tok, secret)
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+            return
+        }
+        sub, _ := claims["sub"].(string)
+        c.Set(ContextUserKey, sub)
+        c.Set(ContextRolesKey, ClaimRoles(claims))
+        c.Next()
+    }
+}
+
+// AccountLookup returns the current roles of an account, or an error when the
+// account no longer exists or may not sign in.
+type AccountLookup func(ctx context.Context, username string) ([]string, error)
+
+// ActiveAccount runs after AuthMiddleware and checks the token's account
+// against the store, so suspensions and role changes apply to tokens already
+// issued. The stored roles replace those in the token.
+func ActiveAccount(lookup AccountLookup) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        roles, err := lookup(c.Request.Context(), CurrentUser(c))
         if err != nil {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
             return
         }
+        c.Set(ContextRolesKey, roles)
         c.Next()
     }
 }
 
 // RequireRole checks that the JWT contains the required role
 func RequireRole(role string, secret []byte) gin.HandlerFunc {
+    return RequireAnyRole(secret, role)
+}
+
+// RequireAnyRole admits callers holding at least one of roles. Behind
+// AuthMiddleware it checks the roles already on the context.
+func RequireAnyRole(secret []byte, roles ...string) gin.HandlerFunc {
     return func(c *gin.Context) {
+        if _, ok := c.Get(ContextRolesKey); ok {
+            if hasAnyRole(CurrentRoles(c), roles) {
+                c.Next()
+                return
+            }
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+            return
+        }
         h := c.GetHeader("Authorization")
         if !strings.HasPrefix(h, "Bearer ") {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
@@ -59,28 +147,25 @@ func RequireRole(role string, secret []byte) gin.HandlerFunc {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
             return
         }
-        // roles can be []interface{}, []string, or string
-        switch rs := claims["roles"].(type) {
-        case []interface{}:
-            for _, r := range rs {
-                if s, ok := r.(string); ok && s == role {
-                    c.Next()
-                    return
-                }
-            }
-        case []string:
-            for _, s := range rs {
-                if s == role {
-                    c.Next()
-                    return
-                }
-            }
-        case string:
-            if rs == role {
-                c.Next()
-                return
-            }
+        held := ClaimRoles(claims)
+        if hasAnyRole(held, roles) {
+            sub, _ := claims["sub"].(string)
+            c.Set(ContextUserKey, sub)
+            c.Set(ContextRolesKey, held)
+            c.Next()
+            return
         }
         c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
     }
 }
+
+func hasAnyRole(held, roles []string) bool {
+    for _, r := range held {
+        for _, want := range roles {
+            if r == want {
+                return true
+            }
+        }
+    }
+    return false
+}
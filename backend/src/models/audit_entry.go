@@ -0,0 +1,11 @@
+package models
+
+// AuditEntry is an immutable record of a change to sensitive data (FR-014).
+type AuditEntry struct {
+    EntryID   string                 `bson:"entry_id" json:"entry_id"`
+    Actor     string                 `bson:"actor" json:"actor"`
+    Action    string                 `bson:"action" json:"action"` // e.g. mfa.reset, leave.approve
+    Target    string                 `bson:"target,omitempty" json:"target,omitempty"`
+    Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+    Timestamp int64                  `bson:"timestamp" json:"timestamp"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// CalendarFeedToken grants read access to a user's leave calendar feed
+// without signing in, so calendar clients can subscribe to it. Only the hash
+// of the token is stored; each user has at most one.
+type CalendarFeedToken struct {
+    TokenHash string `bson:"token_hash" json:"-"`
+    Username  string `bson:"username" json:"username"`
+    CreatedAt int64  `bson:"created_at" json:"created_at"`
+}
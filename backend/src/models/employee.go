@@ -1,5 +1,7 @@
 package models
 
+import "github.com/ronaldpalay/hris/src/money"
+
 // Employee represents a person in the HRIS.
 type Employee struct {
     EmployeeID          string               `bson:"employee_id" json:"employee_id"`
@@ -7,12 +9,18 @@ type Employee struct {
     PreferredName       string               `bson:"preferred_name,omitempty" json:"preferred_name,omitempty"`
     Email               string               `bson:"email,omitempty" json:"email,omitempty"`
     Phone               string               `bson:"phone,omitempty" json:"phone,omitempty"`
+    BirthDate           string               `bson:"birth_date,omitempty" json:"birth_date,omitempty"`
+    TIN                 string               `bson:"tin,omitempty" json:"tin,omitempty"` // BIR taxpayer identification number
+    SSSNumber           string               `bson:"sss_number,omitempty" json:"sss_number,omitempty"`
+    PhilHealthNumber    string               `bson:"philhealth_number,omitempty" json:"philhealth_number,omitempty"`
+    PagIBIGNumber       string               `bson:"pagibig_number,omitempty" json:"pagibig_number,omitempty"` // HDMF membership id (MID)
     HireDate            string               `bson:"hire_date,omitempty" json:"hire_date,omitempty"`
     TerminationDate     *string              `bson:"termination_date,omitempty" json:"termination_date,omitempty"`
     EmploymentStatus    string               `bson:"employment_status,omitempty" json:"employment_status,omitempty"`
     JobHistory          []JobHistoryEntry    `bson:"job_history,omitempty" json:"job_history,omitempty"`
     CompensationRecords []CompensationRecord `bson:"compensation_records,omitempty" json:"compensation_records,omitempty"`
     ManagerID           string               `bson:"manager_id,omitempty" json:"manager_id,omitempty"`
+    BankAccount         *BankAccount         `bson:"bank_account,omitempty" json:"bank_account,omitempty"`
     Version             int                  `bson:"version,omitempty" json:"version,omitempty"`
 }
 
@@ -20,14 +28,28 @@ type Employee struct {
 type JobHistoryEntry struct {
     Title      string  `bson:"title" json:"title"`
     Department string  `bson:"department,omitempty" json:"department,omitempty"`
+    OrgUnitID  string  `bson:"org_unit_id,omitempty" json:"org_unit_id,omitempty"`
+    CostCenter string  `bson:"cost_center,omitempty" json:"cost_center,omitempty"` // payroll costs are booked here
     StartDate  string  `bson:"start_date,omitempty" json:"start_date,omitempty"`
     EndDate    *string `bson:"end_date,omitempty" json:"end_date,omitempty"`
 }
 
+// BankAccount is where the employee's net pay is credited.
+type BankAccount struct {
+    Bank          string `bson:"bank,omitempty" json:"bank,omitempty"`
+    AccountNumber string `bson:"account_number" json:"account_number"`
+    AccountName   string `bson:"account_name,omitempty" json:"account_name,omitempty"`
+}
+
 // CompensationRecord describes a pay/compensation change or entry.
 type CompensationRecord struct {
-    Amount        float64 `bson:"amount" json:"amount"`
-    Currency      string  `bson:"currency,omitempty" json:"currency,omitempty"`
-    EffectiveDate string  `bson:"effective_date,omitempty" json:"effective_date,omitempty"`
-    Type          string  `bson:"type,omitempty" json:"type,omitempty"` // e.g. salary, bonus
+    Amount        money.Money `bson:"amount" json:"amount"`
+    Currency      string      `bson:"currency,omitempty" json:"currency,omitempty"`
+    EffectiveDate string      `bson:"effective_date,omitempty" json:"effective_date,omitempty"`
+    Type          string      `bson:"type,omitempty" json:"type,omitempty"` // e.g. salary, allowance, bonus
+    Basis         string      `bson:"basis,omitempty" json:"basis,omitempty"` // salary: monthly (default) or daily
+    Name          string      `bson:"name,omitempty" json:"name,omitempty"` // allowance name, e.g. rice subsidy
+    Taxable       *bool       `bson:"taxable,omitempty" json:"taxable,omitempty"` // allowances: nil means taxable
+    DeMinimis     string      `bson:"de_minimis,omitempty" json:"de_minimis,omitempty"` // allowances: de minimis category, e.g. rice_subsidy
+    EndDate       string      `bson:"end_date,omitempty" json:"end_date,omitempty"`
 }
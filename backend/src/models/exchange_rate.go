@@ -0,0 +1,13 @@
+package models
+
+// ExchangeRate converts one unit of From into Rate units of To from
+// EffectiveDate until the next rate of the pair takes effect.
+type ExchangeRate struct {
+    From          string `bson:"from" json:"from"` // ISO 4217, e.g. USD
+    To            string `bson:"to" json:"to"`
+    Rate          string `bson:"rate" json:"rate"` // decimal, e.g. "56.125"
+    EffectiveDate string `bson:"effective_date" json:"effective_date"`
+    Source        string `bson:"source,omitempty" json:"source,omitempty"` // e.g. BSP reference rate
+    CreatedBy     string `bson:"created_by" json:"created_by"`
+    CreatedAt     int64  `bson:"created_at" json:"created_at"`
+}
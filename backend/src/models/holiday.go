@@ -0,0 +1,27 @@
+package models
+
+// Holiday kinds.
+const (
+    HolidayRegular = "regular"
+    HolidaySpecial = "special_non_working"
+)
+
+// Holiday is a non-working day on the calendar. An empty Location applies
+// everywhere; otherwise only to employees whose location matches.
+type Holiday struct {
+    HolidayID string `bson:"holiday_id" json:"holiday_id"`
+    Date      string `bson:"date" json:"date"` // YYYY-MM-DD
+    Name      string `bson:"name" json:"name"`
+    Kind      string `bson:"kind" json:"kind"` // regular, special_non_working
+    Location  string `bson:"location,omitempty" json:"location,omitempty"`
+    Source    string `bson:"source,omitempty" json:"source,omitempty"` // e.g. Proclamation No. 727
+    CreatedBy string `bson:"created_by,omitempty" json:"created_by,omitempty"`
+    CreatedAt int64  `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
+
+// HolidayWork is time worked on a holiday or rest day, paid at the
+// calendar's premium.
+type HolidayWork struct {
+    Date  string  `bson:"date" json:"date"`
+    Hours float64 `bson:"hours" json:"hours"`
+}
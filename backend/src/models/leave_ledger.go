@@ -0,0 +1,26 @@
+package models
+
+// Leave ledger entry kinds.
+const (
+    LeaveEntryAccrual    = "accrual"
+    LeaveEntryUsage      = "usage"
+    LeaveEntryAdjustment = "adjustment"
+    LeaveEntryCarryOver  = "carry_over"
+    LeaveEntryForfeiture = "forfeiture"
+)
+
+// LeaveLedgerEntry is one movement of an employee's leave balance. The
+// balance of a leave type is the sum of its entries' Days up to a date.
+type LeaveLedgerEntry struct {
+    EntryID    string  `bson:"entry_id" json:"entry_id"`
+    EmployeeID string  `bson:"employee_id" json:"employee_id"`
+    Type       string  `bson:"type" json:"type"` // leave type, e.g. vacation
+    Kind       string  `bson:"kind" json:"kind"` // accrual, usage, adjustment, carry_over, forfeiture
+    Days       float64 `bson:"days" json:"days"` // credits are positive, debits negative
+    Date       string  `bson:"date" json:"date"` // effective date
+    Period     string  `bson:"period,omitempty" json:"period,omitempty"` // accrual month or grant year, or the leave year closed
+    RequestID  string  `bson:"request_id,omitempty" json:"request_id,omitempty"`
+    Note       string  `bson:"note,omitempty" json:"note,omitempty"`
+    CreatedBy  string  `bson:"created_by,omitempty" json:"created_by,omitempty"`
+    CreatedAt  int64   `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
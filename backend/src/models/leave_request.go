@@ -1,15 +1,57 @@
 package models
 
+// Leave request states.
+const (
+    LeavePending   = "pending"
+    LeaveApproved  = "approved"
+    LeaveRejected  = "rejected"
+    LeaveCancelled = "canceled"
+)
+
+// Leave approval actions recorded in the approver history.
+const (
+    LeaveActionSubmit  = "submitted"
+    LeaveActionApprove = "approved"
+    LeaveActionReject  = "rejected"
+    LeaveActionCancel  = "canceled"
+)
+
+// LeaveApprovalStep is one level of a request's approval chain. An empty
+// ApproverID is a level anyone with the HR or admin role may decide.
+type LeaveApprovalStep struct {
+    Level      int    `bson:"level" json:"level"` // from 1
+    ApproverID string `bson:"approver_id,omitempty" json:"approver_id,omitempty"`
+}
+
+// LeaveApproval is one entry of a request's approver history.
+type LeaveApproval struct {
+    ApproverID string `bson:"approver_id" json:"approver_id"` // employee id, or the user when not linked to an employee
+    Actor      string `bson:"actor" json:"actor"`             // user account
+    Action     string `bson:"action" json:"action"`
+    Level      int    `bson:"level,omitempty" json:"level,omitempty"`
+    Timestamp  int64  `bson:"timestamp" json:"timestamp"`
+    Comment    string `bson:"comment,omitempty" json:"comment,omitempty"`
+}
+
 // LeaveRequest represents an employee's request for leave/time off.
 type LeaveRequest struct {
-    RequestID   string  `bson:"request_id" json:"request_id"`
-    EmployeeID  string  `bson:"employee_id" json:"employee_id"`
-    Type        string  `bson:"type" json:"type"` // e.g. vacation, sick
-    StartDate   string  `bson:"start_date" json:"start_date"`
-    EndDate     string  `bson:"end_date" json:"end_date"`
-    Reason      string  `bson:"reason,omitempty" json:"reason,omitempty"`
-    Status      string  `bson:"status" json:"status"` // pending, approved, rejected
-    ApproverID  *string `bson:"approver_id,omitempty" json:"approver_id,omitempty"`
-    CreatedAt   int64   `bson:"created_at,omitempty" json:"created_at,omitempty"`
-    Version     int     `bson:"version,omitempty" json:"version,omitempty"`
+    RequestID       string              `bson:"request_id" json:"request_id"`
+    EmployeeID      string              `bson:"employee_id" json:"employee_id"`
+    Type            string              `bson:"type" json:"type"` // e.g. vacation, sick
+    StartDate       string              `bson:"start_date" json:"start_date"`
+    EndDate         string              `bson:"end_date" json:"end_date"`
+    StartHalfDay    bool                `bson:"start_half_day,omitempty" json:"start_half_day,omitempty"` // leave starts at noon
+    EndHalfDay      bool                `bson:"end_half_day,omitempty" json:"end_half_day,omitempty"`     // leave ends at noon
+    DurationDays    float64             `bson:"duration_days" json:"duration_days"` // working days
+    Reason          string              `bson:"reason,omitempty" json:"reason,omitempty"`
+    Status          string              `bson:"status" json:"status"` // pending, approved, rejected, canceled
+    ApproverID      *string             `bson:"approver_id,omitempty" json:"approver_id,omitempty"` // next approver while pending, else who decided
+    Approvals       []LeaveApprovalStep `bson:"approvals" json:"approvals"`
+    Level           int                 `bson:"level" json:"level"` // approval levels completed
+    ApproverHistory []LeaveApproval     `bson:"approver_history" json:"approver_history"`
+    BalanceImpact   float64             `bson:"balance_impact,omitempty" json:"balance_impact,omitempty"` // days taken from the balance once approved
+    CreatedBy       string              `bson:"created_by,omitempty" json:"created_by,omitempty"`
+    CreatedAt       int64               `bson:"created_at,omitempty" json:"created_at,omitempty"`
+    UpdatedAt       int64               `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+    Version         int                 `bson:"version,omitempty" json:"version,omitempty"`
 }
@@ -0,0 +1,62 @@
+package models
+
+import "github.com/ronaldpalay/hris/src/money"
+
+// Loan types. The type is also the payslip line code of the installments.
+const (
+    LoanSalary      = "salary_loan"
+    LoanSSS         = "sss_loan"
+    LoanPagIBIG     = "pagibig_loan"
+    LoanCashAdvance = "cash_advance"
+    LoanOther       = "recurring_deduction" // e.g. a uniform or equipment charge
+)
+
+// Loan states.
+const (
+    LoanActive    = "active"
+    LoanPaid      = "paid"
+    LoanCancelled = "cancelled"
+)
+
+// Loan ledger entry kinds.
+const (
+    LedgerDeduction = "deduction" // installment deducted by a finalized run
+    LedgerDeferred  = "deferred"  // installment skipped by the net pay floor
+)
+
+// LoanLedgerEntry is one movement of a loan balance.
+type LoanLedgerEntry struct {
+    Kind      string      `bson:"kind" json:"kind"`
+    RunID     string      `bson:"run_id,omitempty" json:"run_id,omitempty"`
+    PayslipID string      `bson:"payslip_id,omitempty" json:"payslip_id,omitempty"`
+    PeriodEnd string      `bson:"period_end,omitempty" json:"period_end,omitempty"`
+    Amount    money.Money `bson:"amount" json:"amount"`     // reduces the balance
+    Deferred  money.Money `bson:"deferred" json:"deferred"` // part of the installment not deducted
+    Balance   money.Money `bson:"balance" json:"balance"`   // after the entry
+    Note      string      `bson:"note,omitempty" json:"note,omitempty"`
+    CreatedBy string      `bson:"created_by" json:"created_by"`
+    CreatedAt int64       `bson:"created_at" json:"created_at"`
+}
+
+// Loan is an amount an employee repays through payroll: a salary, SSS or
+// Pag-IBIG loan, a cash advance or any other recurring deduction. Each pay
+// period from StartPeriod on deducts Installment until Balance reaches zero.
+type Loan struct {
+    LoanID       string            `bson:"loan_id" json:"loan_id"`
+    EmployeeID   string            `bson:"employee_id" json:"employee_id"`
+    Type         string            `bson:"type" json:"type"`
+    Label        string            `bson:"label,omitempty" json:"label,omitempty"`
+    Reference    string            `bson:"reference,omitempty" json:"reference,omitempty"` // e.g. the SSS loan number
+    Currency     string            `bson:"currency" json:"currency"`
+    Principal    money.Money       `bson:"principal" json:"principal"`       // total to repay, interest included
+    Installment  money.Money       `bson:"installment" json:"installment"`   // per pay period
+    Terms        int               `bson:"terms" json:"terms"`               // scheduled installments
+    StartPeriod  string            `bson:"start_period" json:"start_period"` // first pay period ending on or after this date
+    Balance      money.Money       `bson:"balance" json:"balance"`
+    Status       string            `bson:"status" json:"status"`
+    Ledger       []LoanLedgerEntry `bson:"ledger,omitempty" json:"ledger,omitempty"`
+    CreatedBy    string            `bson:"created_by" json:"created_by"`
+    CreatedAt    int64             `bson:"created_at" json:"created_at"`
+    ClosedAt     int64             `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+    CancelReason string            `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// MFAEnrollment holds a user's TOTP secret and hashed recovery codes.
+type MFAEnrollment struct {
+    Username      string   `bson:"username" json:"username"`
+    Secret        string   `bson:"secret" json:"-"` // base32 TOTP secret
+    Confirmed     bool     `bson:"confirmed" json:"confirmed"`
+    RecoveryCodes []string `bson:"recovery_codes,omitempty" json:"-"` // sha256 hex of unused codes
+    LastUsedStep  int64    `bson:"last_used_step,omitempty" json:"-"`  // rejects TOTP code reuse
+    EnrolledAt    int64    `bson:"enrolled_at,omitempty" json:"enrolled_at,omitempty"`
+}
@@ -1,15 +1,29 @@
 package models
 
-// PayrollRecord represents a payroll entry for an employee.
+import "github.com/ronaldpalay/hris/src/money"
+
+// Payroll record states.
+const (
+    PayrollRecordActive = "active"
+    PayrollRecordVoided = "voided" // kept for the audit trail, left out of totals
+)
+
+// PayrollRecord represents a payroll entry for an employee. Amounts are in
+// Currency and stored as Decimal128.
 type PayrollRecord struct {
-    PayrollID  string  `bson:"payroll_id" json:"payroll_id"`
-    EmployeeID string  `bson:"employee_id" json:"employee_id"`
-    Period     string  `bson:"period" json:"period"` // e.g. 2025-08
-    Gross      float64 `bson:"gross" json:"gross"`
-    Deductions float64 `bson:"deductions" json:"deductions"`
-    Taxes      float64 `bson:"taxes" json:"taxes"`
-    Net        float64 `bson:"net" json:"net"`
-    Currency   string  `bson:"currency,omitempty" json:"currency,omitempty"`
-    CreatedAt  int64   `bson:"created_at,omitempty" json:"created_at,omitempty"`
-    Version    int     `bson:"version,omitempty" json:"version,omitempty"`
+    PayrollID  string      `bson:"payroll_id" json:"payroll_id"`
+    EmployeeID string      `bson:"employee_id" json:"employee_id"`
+    Period     string      `bson:"period" json:"period"` // e.g. 2025-08
+    Gross      money.Money `bson:"gross" json:"gross"`
+    Deductions money.Money `bson:"deductions" json:"deductions"`
+    Taxes      money.Money `bson:"taxes" json:"taxes"`
+    Net        money.Money `bson:"net" json:"net"`
+    Currency   string      `bson:"currency,omitempty" json:"currency,omitempty"`
+    Status     string      `bson:"status,omitempty" json:"status,omitempty"` // active when empty
+    CreatedBy  string      `bson:"created_by,omitempty" json:"created_by,omitempty"`
+    CreatedAt  int64       `bson:"created_at,omitempty" json:"created_at,omitempty"`
+    VoidedBy   string      `bson:"voided_by,omitempty" json:"voided_by,omitempty"`
+    VoidReason string      `bson:"void_reason,omitempty" json:"void_reason,omitempty"`
+    VoidedAt   int64       `bson:"voided_at,omitempty" json:"voided_at,omitempty"`
+    Version    int         `bson:"version,omitempty" json:"version,omitempty"`
 }
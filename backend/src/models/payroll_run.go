@@ -0,0 +1,173 @@
+package models
+
+import "github.com/ronaldpalay/hris/src/money"
+
+// Payroll run states, in lifecycle order.
+const (
+    RunDraft     = "draft"
+    RunReview    = "review"
+    RunApproved  = "approved"
+    RunFinalized = "finalized"
+    RunPaid      = "paid"
+)
+
+// Payroll run types. Regular runs pay a pay period; thirteenth-month and
+// final-pay runs are off-cycle.
+const (
+    RunRegular         = "regular"
+    RunThirteenthMonth = "thirteenth_month"
+    RunFinalPay        = "final_pay"
+)
+
+// PayPeriod is a span of days paid together on one pay date.
+type PayPeriod struct {
+    PeriodID  string `bson:"period_id" json:"period_id"`
+    Start     string `bson:"start" json:"start"` // YYYY-MM-DD
+    End       string `bson:"end" json:"end"`
+    Frequency string `bson:"frequency" json:"frequency"` // monthly, semi_monthly, weekly, daily
+    PayDate   string `bson:"pay_date,omitempty" json:"pay_date,omitempty"`
+    CreatedAt int64  `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
+
+// RunTotals sums the payslips of a run in one currency.
+type RunTotals struct {
+    Currency              string      `bson:"currency" json:"currency"`
+    Headcount             int         `bson:"headcount" json:"headcount"`
+    Gross                 money.Money `bson:"gross" json:"gross"`
+    Deductions            money.Money `bson:"deductions" json:"deductions"`
+    Taxes                 money.Money `bson:"taxes" json:"taxes"`
+    Net                   money.Money `bson:"net" json:"net"`
+    EmployerContributions money.Money `bson:"employer_contributions" json:"employer_contributions"`
+}
+
+// RunException records an employee a run could not pay.
+type RunException struct {
+    EmployeeID string `bson:"employee_id" json:"employee_id"`
+    Error      string `bson:"error" json:"error"`
+}
+
+// Run anomaly flags raised by the variance report.
+const (
+    AnomalyGrossSwing          = "gross_swing"
+    AnomalyNetSwing            = "net_swing"
+    AnomalyNewEmployee         = "new_employee"
+    AnomalyDroppedEmployee     = "dropped_employee"
+    AnomalyNegativeNet         = "negative_net"
+    AnomalyMissingContribution = "missing_contribution"
+    AnomalyTerminated          = "terminated"
+    AnomalyNotHired            = "not_hired"
+)
+
+// RunAnomaly is a payslip a reviewer should look at before approving.
+type RunAnomaly struct {
+    EmployeeID string `bson:"employee_id" json:"employee_id"`
+    Flag       string `bson:"flag" json:"flag"`
+    Detail     string `bson:"detail,omitempty" json:"detail,omitempty"`
+}
+
+// RunTransition is one step in a run's history.
+type RunTransition struct {
+    From   string `bson:"from" json:"from"`
+    To     string `bson:"to" json:"to"`
+    Actor  string `bson:"actor" json:"actor"`
+    Reason string `bson:"reason,omitempty" json:"reason,omitempty"`
+    At     int64  `bson:"at" json:"at"`
+}
+
+// Export kinds recorded on a run.
+const (
+    ExportBank = "bank"
+    ExportGL   = "gl" // general-ledger journal
+)
+
+// RunExport records a file produced from a run, e.g. a bank credit file.
+// Voided exports no longer block producing a new one.
+type RunExport struct {
+    ExportID   string      `bson:"export_id" json:"export_id"`
+    Kind       string      `bson:"kind" json:"kind"`
+    Layout     string      `bson:"layout" json:"layout"`
+    FileName   string      `bson:"file_name" json:"file_name"`
+    Checksum   string      `bson:"checksum" json:"checksum"` // SHA-256 of the file, hex
+    Records    int         `bson:"records" json:"records"`
+    Currency   string      `bson:"currency" json:"currency"`
+    Total      money.Money `bson:"total" json:"total"`
+    Reference  string      `bson:"reference,omitempty" json:"reference,omitempty"`
+    CreatedBy  string      `bson:"created_by" json:"created_by"`
+    CreatedAt  int64       `bson:"created_at" json:"created_at"`
+    VoidedBy   string      `bson:"voided_by,omitempty" json:"voided_by,omitempty"`
+    VoidReason string      `bson:"void_reason,omitempty" json:"void_reason,omitempty"`
+    VoidedAt   int64       `bson:"voided_at,omitempty" json:"voided_at,omitempty"`
+}
+
+// PayrollRun generates and tracks the payslips of one pay period through
+// review, approval, finalization and payment. Payslips are locked once the
+// run is finalized; corrections are PayrollAdjustments.
+type PayrollRun struct {
+    RunID       string          `bson:"run_id" json:"run_id"`
+    Type        string          `bson:"type,omitempty" json:"type,omitempty"` // regular when empty
+    PeriodID    string          `bson:"period_id,omitempty" json:"period_id,omitempty"`
+    Year        int             `bson:"year,omitempty" json:"year,omitempty"` // thirteenth-month runs
+    FinalPay    *FinalPayInput  `bson:"final_pay,omitempty" json:"final_pay,omitempty"`
+    PeriodStart string          `bson:"period_start" json:"period_start"`
+    PeriodEnd   string          `bson:"period_end" json:"period_end"`
+    Frequency   string          `bson:"frequency" json:"frequency"`
+    PayDate     string          `bson:"pay_date,omitempty" json:"pay_date,omitempty"`
+    Status      string          `bson:"status" json:"status"`
+    Totals      []RunTotals     `bson:"totals" json:"totals"` // one entry per payslip currency
+    Exceptions  []RunException  `bson:"exceptions,omitempty" json:"exceptions,omitempty"`
+    Anomalies   []RunAnomaly    `bson:"anomalies,omitempty" json:"anomalies,omitempty"` // flagged on submission for review
+    History     []RunTransition `bson:"history,omitempty" json:"history,omitempty"`
+    CreatedBy   string          `bson:"created_by" json:"created_by"`
+    CreatedAt   int64           `bson:"created_at" json:"created_at"`
+    SubmittedBy string          `bson:"submitted_by,omitempty" json:"submitted_by,omitempty"`
+    ApprovedBy  string          `bson:"approved_by,omitempty" json:"approved_by,omitempty"`
+    FinalizedAt int64           `bson:"finalized_at,omitempty" json:"finalized_at,omitempty"`
+    PaidAt      int64           `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+    Exports     []RunExport     `bson:"exports,omitempty" json:"exports,omitempty"`
+    Version     int             `bson:"version,omitempty" json:"version,omitempty"`
+}
+
+// Adjustment sources.
+const (
+    AdjustmentManual = "manual"
+    AdjustmentRetro  = "retro"
+)
+
+// FinalPayDeduction is an amount still owed by a separating employee, e.g.
+// an outstanding loan balance.
+type FinalPayDeduction struct {
+    Code   string      `bson:"code" json:"code"`
+    Label  string      `bson:"label,omitempty" json:"label,omitempty"`
+    Amount money.Money `bson:"amount" json:"amount"`
+}
+
+// FinalPayInput describes a separation to compute final pay for.
+type FinalPayInput struct {
+    EmployeeID     string              `bson:"employee_id" json:"employee_id"`
+    SeparationDate string              `bson:"separation_date" json:"separation_date"` // last day employed
+    Frequency      string              `bson:"frequency,omitempty" json:"frequency,omitempty"`
+    LeaveDays      float64             `bson:"leave_days,omitempty" json:"leave_days,omitempty"` // unused convertible leave
+    Deductions     []FinalPayDeduction `bson:"deductions,omitempty" json:"deductions,omitempty"`
+    Reason         string              `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// PayrollAdjustment corrects a finalized run. It is paid (or recovered) as a
+// line on the employee's next run and never edits the original payslip.
+type PayrollAdjustment struct {
+    AdjustmentID string      `bson:"adjustment_id" json:"adjustment_id"`
+    RunID        string      `bson:"run_id" json:"run_id"` // the run being corrected
+    EmployeeID   string      `bson:"employee_id" json:"employee_id"`
+    Code         string      `bson:"code" json:"code"`
+    Label        string      `bson:"label,omitempty" json:"label,omitempty"`
+    Kind         string      `bson:"kind" json:"kind"` // earning or deduction
+    Amount       money.Money `bson:"amount" json:"amount"`
+    Taxable      bool        `bson:"taxable,omitempty" json:"taxable,omitempty"`
+    Reason       string      `bson:"reason" json:"reason"`
+    Source       string      `bson:"source,omitempty" json:"source,omitempty"` // manual (default) or retro
+    PayslipID    string      `bson:"payslip_id,omitempty" json:"payslip_id,omitempty"` // payslip being corrected
+    PeriodStart  string      `bson:"period_start,omitempty" json:"period_start,omitempty"`
+    PeriodEnd    string      `bson:"period_end,omitempty" json:"period_end,omitempty"`
+    AppliedRunID string      `bson:"applied_run_id,omitempty" json:"applied_run_id,omitempty"` // set when a finalized run pays it
+    CreatedBy    string      `bson:"created_by" json:"created_by"`
+    CreatedAt    int64       `bson:"created_at" json:"created_at"`
+}
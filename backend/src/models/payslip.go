@@ -0,0 +1,63 @@
+package models
+
+import "github.com/ronaldpalay/hris/src/money"
+
+// Payslip line kinds. Earnings make up gross; deductions, employee
+// contributions and tax are subtracted from it; employer shares are shown
+// for costing only.
+const (
+    LineEarning      = "earning"
+    LineDeduction    = "deduction"
+    LineContribution = "contribution"
+    LineTax          = "tax"
+    LineEmployer     = "employer"
+)
+
+// PayslipLine is one computed amount with the inputs and formula behind it.
+type PayslipLine struct {
+    Code    string            `bson:"code" json:"code"` // e.g. basic, overtime, sss_ee
+    Label   string            `bson:"label" json:"label"`
+    Kind    string            `bson:"kind" json:"kind"`
+    Amount  money.Money       `bson:"amount" json:"amount"`
+    Taxable bool              `bson:"taxable,omitempty" json:"taxable,omitempty"` // earnings subject to withholding tax
+    // DeMinimis names the de minimis category of a benefit (e.g. rice_subsidy);
+    // only the part above the category ceiling is taxed.
+    DeMinimis string `bson:"de_minimis,omitempty" json:"de_minimis,omitempty"`
+    // OtherBenefit marks 13th month pay and other benefits, exempt up to the
+    // annual threshold.
+    OtherBenefit bool `bson:"other_benefit,omitempty" json:"other_benefit,omitempty"`
+    Inputs  map[string]string `bson:"inputs,omitempty" json:"inputs,omitempty"`
+    Formula string            `bson:"formula,omitempty" json:"formula,omitempty"`
+}
+
+// AttendanceSummary aggregates time data for a pay period.
+type AttendanceSummary struct {
+    DaysWorked       float64 `bson:"days_worked,omitempty" json:"days_worked"` // used for daily-rated employees
+    AbsentDays       float64 `bson:"absent_days,omitempty" json:"absent_days"`
+    LateMinutes      int64   `bson:"late_minutes,omitempty" json:"late_minutes"`
+    UndertimeMinutes int64   `bson:"undertime_minutes,omitempty" json:"undertime_minutes"`
+    OvertimeMinutes  int64   `bson:"overtime_minutes,omitempty" json:"overtime_minutes"`
+    NightDiffMinutes int64   `bson:"night_diff_minutes,omitempty" json:"night_diff_minutes"`
+    // HolidayWork is paid on top of days_worked, which counts ordinary days only.
+    HolidayWork []HolidayWork `bson:"holiday_work,omitempty" json:"holiday_work,omitempty"`
+}
+
+// Payslip is the calculated pay of one employee for one pay period.
+type Payslip struct {
+    PayslipID             string             `bson:"payslip_id" json:"payslip_id"`
+    RunID                 string             `bson:"run_id,omitempty" json:"run_id,omitempty"`
+    EmployeeID            string             `bson:"employee_id" json:"employee_id"`
+    PeriodStart           string             `bson:"period_start" json:"period_start"` // YYYY-MM-DD
+    PeriodEnd             string             `bson:"period_end" json:"period_end"`
+    Frequency             string             `bson:"frequency" json:"frequency"` // monthly, semi_monthly, weekly, daily
+    Currency              string             `bson:"currency" json:"currency"`
+    Attendance            *AttendanceSummary `bson:"attendance,omitempty" json:"attendance,omitempty"` // inputs kept for retro recalculation
+    UnpaidLeaveDays       float64            `bson:"unpaid_leave_days,omitempty" json:"unpaid_leave_days,omitempty"`
+    Lines                 []PayslipLine      `bson:"lines" json:"lines"`
+    Gross                 money.Money        `bson:"gross" json:"gross"`
+    Deductions            money.Money        `bson:"deductions" json:"deductions"`
+    Taxes                 money.Money        `bson:"taxes" json:"taxes"`
+    Net                   money.Money        `bson:"net" json:"net"`
+    EmployerContributions money.Money        `bson:"employer_contributions" json:"employer_contributions"`
+    CreatedAt             int64              `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "github.com/ronaldpalay/hris/src/money"
+
+// Government agencies receiving monthly contribution remittances.
+const (
+    AgencySSS        = "sss"
+    AgencyPhilHealth = "philhealth"
+    AgencyPagIBIG    = "pagibig"
+)
+
+// Remittance states.
+const (
+    RemittanceGenerated  = "generated"  // file produced, not yet filed
+    RemittanceSuperseded = "superseded" // replaced by a later file for the same month
+    RemittanceSubmitted  = "submitted"  // filed and paid; carries the agency reference number
+)
+
+// Remittance records a contribution report generated for one agency and
+// month (SSS R3, PhilHealth RF-1 or Pag-IBIG MCRF) and its submission. A
+// supplementary report covers only contributions finalized after the month
+// was submitted.
+type Remittance struct {
+    RemittanceID    string      `bson:"remittance_id" json:"remittance_id"`
+    Agency          string      `bson:"agency" json:"agency"`
+    Month           string      `bson:"month" json:"month"` // YYYY-MM
+    Status          string      `bson:"status" json:"status"`
+    Supplements     string      `bson:"supplements,omitempty" json:"supplements,omitempty"` // submission this report adds to
+    FileName        string      `bson:"file_name" json:"file_name"`
+    Checksum        string      `bson:"checksum" json:"checksum"` // SHA-256 of the file, hex
+    RunIDs          []string    `bson:"run_ids" json:"run_ids"`
+    Employees       int         `bson:"employees" json:"employees"`
+    Currency        string      `bson:"currency" json:"currency"`
+    EmployeeShare   money.Money `bson:"employee_share" json:"employee_share"`
+    EmployerShare   money.Money `bson:"employer_share" json:"employer_share"` // includes SSS EC
+    Total           money.Money `bson:"total" json:"total"`
+    ReferenceNumber string      `bson:"reference_number,omitempty" json:"reference_number,omitempty"`
+    PaidOn          string      `bson:"paid_on,omitempty" json:"paid_on,omitempty"`
+    SubmittedBy     string      `bson:"submitted_by,omitempty" json:"submitted_by,omitempty"`
+    SubmittedAt     int64       `bson:"submitted_at,omitempty" json:"submitted_at,omitempty"`
+    CreatedBy       string      `bson:"created_by" json:"created_by"`
+    CreatedAt       int64       `bson:"created_at" json:"created_at"`
+}
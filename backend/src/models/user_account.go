@@ -2,9 +2,31 @@ package models
 
 // UserAccount represents an authentication user for the HRIS.
 type UserAccount struct {
-    Username     string   `bson:"username" json:"username"`
-    PasswordHash string   `bson:"password_hash" json:"-"`
-    Email        string   `bson:"email,omitempty" json:"email,omitempty"`
-    Roles        []string `bson:"roles,omitempty" json:"roles,omitempty"`
-    CreatedAt    int64    `bson:"created_at,omitempty" json:"created_at,omitempty"`
+    Username           string   `bson:"username" json:"username"`
+    PasswordHash       string   `bson:"password_hash" json:"-"`
+    PasswordHistory    []string `bson:"password_history,omitempty" json:"-"` // previous hashes, newest first
+    PasswordChangedAt  int64    `bson:"password_changed_at,omitempty" json:"password_changed_at,omitempty"`
+    MustChangePassword bool     `bson:"must_change_password,omitempty" json:"must_change_password,omitempty"`
+    Email              string   `bson:"email,omitempty" json:"email,omitempty"`
+    Roles              []string `bson:"roles,omitempty" json:"roles,omitempty"`
+    EmployeeID         string   `bson:"employee_id,omitempty" json:"employee_id,omitempty"`
+    SAMLNameID         string   `bson:"saml_name_id,omitempty" json:"saml_name_id,omitempty"` // IdP NameID that signs in as this account
+    Status             string   `bson:"status,omitempty" json:"status,omitempty"` // active (default), suspended
+    LastLogin          int64    `bson:"last_login,omitempty" json:"last_login,omitempty"`
+    CreatedAt          int64    `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
+
+// Account statuses. An empty status is treated as active.
+const (
+    UserStatusActive    = "active"
+    UserStatusSuspended = "suspended"
+)
+
+// PasswordResetToken is a single-use, expiring password reset grant. Only the
+// hash of the token is stored.
+type PasswordResetToken struct {
+    TokenHash string `bson:"token_hash" json:"-"`
+    Username  string `bson:"username" json:"username"`
+    ExpiresAt int64  `bson:"expires_at" json:"expires_at"`
+    UsedAt    int64  `bson:"used_at,omitempty" json:"used_at,omitempty"`
 }
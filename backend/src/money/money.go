@@ -0,0 +1,475 @@
+// Package money implements the fixed-point amount type used by payroll and
+// compensation. Amounts are held as integers of 1/10000 of the currency unit
+// so sums never drift, and are rounded to the currency's minor unit only where
+// a rounding rule says so. In MongoDB an amount is stored as Decimal128.
+package money
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "strconv"
+    "strings"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/bsontype"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scale is the number of decimal places kept internally.
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+// DefaultCurrency is assumed when a record does not name one.
+const DefaultCurrency = "PHP"
+
+// minorUnits lists currencies whose minor unit is not 1/100.
+var minorUnits = map[string]int{
+    "JPY": 0, "KRW": 0, "VND": 0, "IDR": 0,
+    "BHD": 3, "KWD": 3, "OMR": 3,
+}
+
+// MinorUnits returns the number of decimal places of currency's minor unit.
+func MinorUnits(currency string) int {
+    if n, ok := minorUnits[strings.ToUpper(currency)]; ok {
+        return n
+    }
+    return 2
+}
+
+// Rounding selects how ties are broken when an amount loses precision.
+type Rounding int
+
+const (
+    // HalfEven rounds ties to the even neighbour (banker's rounding).
+    HalfEven Rounding = iota
+    // HalfUp rounds ties away from zero.
+    HalfUp
+)
+
+// ParseRounding accepts "half_even" and "half_up".
+func ParseRounding(s string) (Rounding, error) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "half_even", "half-even", "bankers":
+        return HalfEven, nil
+    case "half_up", "half-up":
+        return HalfUp, nil
+    }
+    return HalfEven, fmt.Errorf("money: unknown rounding %q", s)
+}
+
+func (r Rounding) String() string {
+    if r == HalfUp {
+        return "half_up"
+    }
+    return "half_even"
+}
+
+// Money is an amount in a currency. The zero value is zero with no currency;
+// it adopts the currency of whatever it is combined with.
+type Money struct {
+    units    int64
+    currency string
+}
+
+// ErrCurrencyMismatch is returned by Cmp for amounts in different currencies.
+var ErrCurrencyMismatch = errors.New("money: currency mismatch")
+
+// Zero returns zero in currency.
+func Zero(currency string) Money { return Money{currency: currency} }
+
+// FromMinor builds an amount from minor units, e.g. centavos.
+func FromMinor(minor int64, currency string) Money {
+    p := pow10(Scale - MinorUnits(currency))
+    return Money{units: minor * p, currency: currency}
+}
+
+// Parse reads a decimal string such as "1234.56" or "-0.5". Digits beyond
+// Scale are rounded half-even.
+func Parse(s, currency string) (Money, error) {
+    s = strings.TrimSpace(s)
+    if s == "" || strings.ContainsAny(s, "/eE") {
+        return Money{}, fmt.Errorf("money: invalid amount %q", s)
+    }
+    r, ok := new(big.Rat).SetString(s)
+    if !ok {
+        return Money{}, fmt.Errorf("money: invalid amount %q", s)
+    }
+    u, err := roundRat(r.Mul(r, big.NewRat(unit, 1)), HalfEven)
+    if err != nil {
+        return Money{}, err
+    }
+    return Money{units: u, currency: currency}, nil
+}
+
+// MustParse is Parse for constants; it panics on malformed input.
+func MustParse(s, currency string) Money {
+    m, err := Parse(s, currency)
+    if err != nil {
+        panic(err)
+    }
+    return m
+}
+
+// FromFloat converts a legacy float amount using its shortest decimal form,
+// so 165.44 becomes exactly 165.44. Round the result to the minor unit when
+// the float came from arithmetic rather than input.
+func FromFloat(f float64, currency string) (Money, error) {
+    return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// FromDecimal128 converts a stored Decimal128, which may be in exponent form
+// such as 1E+3. Digits beyond Scale are rounded half-even.
+func FromDecimal128(d primitive.Decimal128, currency string) (Money, error) {
+    bi, exp, err := d.BigInt()
+    if err != nil {
+        return Money{}, fmt.Errorf("money: invalid amount %q: %w", d.String(), err)
+    }
+    r := new(big.Rat).SetInt(bi)
+    if exp += Scale; exp >= 0 {
+        r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)))
+    } else {
+        r.Quo(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-exp)), nil)))
+    }
+    u, err := roundRat(r, HalfEven)
+    if err != nil {
+        return Money{}, err
+    }
+    return Money{units: u, currency: currency}, nil
+}
+
+// Currency returns the ISO 4217 code, or "" for an untyped zero.
+func (m Money) Currency() string { return m.currency }
+
+// WithCurrency returns the same amount labelled with currency. It is meant
+// for amounts decoded without one (JSON and BSON carry only the number).
+func (m Money) WithCurrency(currency string) Money {
+    m.currency = currency
+    return m
+}
+
+func (m Money) IsZero() bool { return m.units == 0 }
+
+// Sign returns -1, 0 or 1.
+func (m Money) Sign() int {
+    switch {
+    case m.units < 0:
+        return -1
+    case m.units > 0:
+        return 1
+    }
+    return 0
+}
+
+func (m Money) Neg() Money { return Money{units: -m.units, currency: m.currency} }
+
+func (m Money) Abs() Money {
+    if m.units < 0 {
+        return m.Neg()
+    }
+    return m
+}
+
+// Add returns m + o. Mixing two different currencies is a programming error
+// and panics; convert first.
+func (m Money) Add(o Money) Money {
+    return Money{units: m.units + o.units, currency: m.join(o)}
+}
+
+// Sub returns m - o under the same currency rule as Add.
+func (m Money) Sub(o Money) Money {
+    return Money{units: m.units - o.units, currency: m.join(o)}
+}
+
+// Mul multiplies by an integer quantity.
+func (m Money) Mul(n int64) Money {
+    return Money{units: m.units * n, currency: m.currency}
+}
+
+// MulRatio multiplies by num/den keeping Scale places, e.g. MulRatio(5, 100)
+// for 5%. The internal result is rounded with mode.
+func (m Money) MulRatio(num, den int64, mode Rounding) Money {
+    r := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(m.units), big.NewInt(num)), big.NewInt(den))
+    u, err := roundRat(r, mode)
+    if err != nil {
+        panic(err)
+    }
+    return Money{units: u, currency: m.currency}
+}
+
+// MulRate multiplies by a decimal rate such as "0.05" or "1.25".
+func (m Money) MulRate(rate string, mode Rounding) (Money, error) {
+    r, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+    if !ok || strings.ContainsAny(rate, "eE") {
+        return Money{}, fmt.Errorf("money: invalid rate %q", rate)
+    }
+    u, err := roundRat(r.Mul(r, new(big.Rat).SetInt64(m.units)), mode)
+    if err != nil {
+        return Money{}, err
+    }
+    return Money{units: u, currency: m.currency}, nil
+}
+
+// Div divides by n, rounding the internal result with mode.
+func (m Money) Div(n int64, mode Rounding) Money {
+    return m.MulRatio(1, n, mode)
+}
+
+// Ratio returns m/o as a big.Rat, e.g. to prorate by days worked.
+func (m Money) Ratio(o Money) *big.Rat {
+    if o.units == 0 {
+        return new(big.Rat)
+    }
+    return big.NewRat(m.units, o.units)
+}
+
+// Round rounds to the currency's minor unit.
+func (m Money) Round(mode Rounding) Money {
+    return m.RoundTo(MinorUnits(m.currency), mode)
+}
+
+// RoundTo rounds to places decimals (0..Scale).
+func (m Money) RoundTo(places int, mode Rounding) Money {
+    if places >= Scale {
+        return m
+    }
+    if places < 0 {
+        places = 0
+    }
+    p := pow10(Scale - places)
+    q, _ := roundRat(big.NewRat(m.units, p), mode)
+    return Money{units: q * p, currency: m.currency}
+}
+
+// Minor returns the amount in minor units, rounded with mode.
+func (m Money) Minor(mode Rounding) int64 {
+    return m.Round(mode).units / pow10(Scale-MinorUnits(m.currency))
+}
+
+// Cmp compares two amounts; both must share a currency (or be untyped).
+func (m Money) Cmp(o Money) (int, error) {
+    if m.currency != "" && o.currency != "" && m.currency != o.currency {
+        return 0, ErrCurrencyMismatch
+    }
+    switch {
+    case m.units < o.units:
+        return -1, nil
+    case m.units > o.units:
+        return 1, nil
+    }
+    return 0, nil
+}
+
+// LessThan reports m < o and panics on mixed currencies like Add.
+func (m Money) LessThan(o Money) bool {
+    m.join(o)
+    return m.units < o.units
+}
+
+// Equal reports whether both amount and currency match.
+func (m Money) Equal(o Money) bool { return m.units == o.units && m.currency == o.currency }
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+    if o.LessThan(m) {
+        return o
+    }
+    return m
+}
+
+// Max returns the larger of m and o.
+func (m Money) Max(o Money) Money {
+    if m.LessThan(o) {
+        return o
+    }
+    return m
+}
+
+// String formats the amount with at least the currency's minor digits and
+// any further significant internal digits, without a currency code.
+func (m Money) String() string {
+    neg := m.units < 0
+    u := m.units
+    if neg {
+        u = -u
+    }
+    s := strconv.FormatInt(u/unit, 10)
+    frac := fmt.Sprintf("%04d", u%unit)
+    minDigits := MinorUnits(m.currency)
+    for len(frac) > minDigits && frac[len(frac)-1] == '0' {
+        frac = frac[:len(frac)-1]
+    }
+    if frac != "" {
+        s += "." + frac
+    }
+    if neg {
+        s = "-" + s
+    }
+    return s
+}
+
+// Format renders the amount rounded half-even to the minor unit with its
+// currency, e.g. "PHP 1,234.50".
+func (m Money) Format() string {
+    r := m.Round(HalfEven)
+    s := r.String()
+    neg := strings.HasPrefix(s, "-")
+    s = strings.TrimPrefix(s, "-")
+    intPart, frac := s, ""
+    if i := strings.IndexByte(s, '.'); i >= 0 {
+        intPart, frac = s[:i], s[i:]
+    }
+    var b strings.Builder
+    for i, c := range intPart {
+        if i > 0 && (len(intPart)-i)%3 == 0 {
+            b.WriteByte(',')
+        }
+        b.WriteRune(c)
+    }
+    out := b.String() + frac
+    if neg {
+        out = "-" + out
+    }
+    if m.currency != "" {
+        out = m.currency + " " + out
+    }
+    return out
+}
+
+// Float64 is for display and charts only; never feed it back into payroll.
+func (m Money) Float64() float64 {
+    return float64(m.units) / unit
+}
+
+// MarshalJSON writes the amount as a JSON number so existing clients keep
+// working; the text is exact.
+func (m Money) MarshalJSON() ([]byte, error) {
+    return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string.
+func (m *Money) UnmarshalJSON(b []byte) error {
+    s := string(b)
+    if s == "null" {
+        *m = Money{currency: m.currency}
+        return nil
+    }
+    if uq, err := strconv.Unquote(s); err == nil {
+        s = uq
+    }
+    v, err := Parse(s, m.currency)
+    if err != nil {
+        return err
+    }
+    *m = v
+    return nil
+}
+
+// MarshalBSONValue stores the amount as Decimal128.
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+    d, err := primitive.ParseDecimal128(m.String())
+    if err != nil {
+        return 0, nil, err
+    }
+    return bson.MarshalValue(d)
+}
+
+// UnmarshalBSONValue reads Decimal128 and, for documents not yet migrated,
+// doubles, integers and strings.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+    rv := bson.RawValue{Type: t, Value: data}
+    var (
+        v   Money
+        err error
+    )
+    switch t {
+    case bsontype.Decimal128:
+        v, err = FromDecimal128(rv.Decimal128(), m.currency)
+    case bsontype.Double:
+        v, err = FromFloat(rv.Double(), m.currency)
+    case bsontype.Int32:
+        v = Money{units: int64(rv.Int32()) * unit, currency: m.currency}
+    case bsontype.Int64:
+        v = Money{units: rv.Int64() * unit, currency: m.currency}
+    case bsontype.String:
+        v, err = Parse(rv.StringValue(), m.currency)
+    case bsontype.Null, bsontype.Undefined:
+        v = Money{currency: m.currency}
+    default:
+        err = fmt.Errorf("money: cannot decode BSON %s", t)
+    }
+    if err != nil {
+        return err
+    }
+    *m = v
+    return nil
+}
+
+func (m Money) join(o Money) string {
+    switch {
+    case m.currency == "":
+        return o.currency
+    case o.currency == "" || o.currency == m.currency:
+        return m.currency
+    }
+    panic(fmt.Sprintf("money: currency mismatch %s/%s", m.currency, o.currency))
+}
+
+// roundRat rounds r to an integer using mode.
+func roundRat(r *big.Rat, mode Rounding) (int64, error) {
+    q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+    if rem.Sign() != 0 {
+        twice := new(big.Int).Abs(rem)
+        twice.Lsh(twice, 1)
+        c := twice.Cmp(r.Denom())
+        away := c > 0 || (c == 0 && (mode == HalfUp || q.Bit(0) == 1))
+        if away {
+            q.Add(q, big.NewInt(int64(r.Sign())))
+        }
+    }
+    if !q.IsInt64() {
+        return 0, errors.New("money: amount out of range")
+    }
+    return q.Int64(), nil
+}
+
+func pow10(n int) int64 {
+    p := int64(1)
+    for i := 0; i < n; i++ {
+        p *= 10
+    }
+    return p
+}
+
+// FromValue converts a loosely typed document value (JSON-decoded float,
+// string, Decimal128, integer, nil or Money) into an amount in currency.
+func FromValue(v interface{}, currency string) (Money, error) {
+    switch x := v.(type) {
+    case nil:
+        return Zero(currency), nil
+    case Money:
+        if x.currency == "" {
+            x.currency = currency
+        }
+        return x, nil
+    case float64:
+        return FromFloat(x, currency)
+    case float32:
+        return FromFloat(float64(x), currency)
+    case int:
+        return Money{units: int64(x) * unit, currency: currency}, nil
+    case int32:
+        return Money{units: int64(x) * unit, currency: currency}, nil
+    case int64:
+        return Money{units: x * unit, currency: currency}, nil
+    case string:
+        return Parse(x, currency)
+    case json.Number:
+        return Parse(x.String(), currency)
+    case primitive.Decimal128:
+        return FromDecimal128(x, currency)
+    }
+    return Money{}, fmt.Errorf("money: cannot convert %T", v)
+}
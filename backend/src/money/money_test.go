@@ -0,0 +1,151 @@
+package money
+
+import (
+    "encoding/json"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRounding(t *testing.T) {
+    cases := []struct {
+        in   string
+        mode Rounding
+        want string
+    }{
+        {"2.345", HalfEven, "2.34"},
+        {"2.355", HalfEven, "2.36"},
+        {"2.345", HalfUp, "2.35"},
+        {"-2.345", HalfUp, "-2.35"},
+        {"-2.345", HalfEven, "-2.34"},
+        {"2.3449", HalfUp, "2.34"},
+        {"0.005", HalfEven, "0.00"},
+    }
+    for _, c := range cases {
+        if got := MustParse(c.in, "PHP").Round(c.mode).String(); got != c.want {
+            t.Fatalf("%s %v: got %s want %s", c.in, c.mode, got, c.want)
+        }
+    }
+    if got := MustParse("1234.5", "JPY").Round(HalfEven).String(); got != "1234" {
+        t.Fatalf("JPY rounding: got %s", got)
+    }
+}
+
+func TestNoDriftAcrossManyPayslips(t *testing.T) {
+    // 0.1 + 0.2 style drift must not appear however many lines are summed
+    total := Zero("PHP")
+    line := MustParse("165.44", "PHP")
+    for i := 0; i < 10000; i++ {
+        total = total.Add(line)
+    }
+    if total.String() != "1654400.00" {
+        t.Fatalf("got %s", total)
+    }
+    f, _ := FromFloat(1500.00-100.00-165.44, "PHP")
+    if f.Round(HalfEven).String() != "1234.56" {
+        t.Fatalf("float conversion: got %s", f)
+    }
+}
+
+func TestMulRatioAndDiv(t *testing.T) {
+    salary := MustParse("25000", "PHP")
+    if got := salary.MulRatio(5, 100, HalfEven).String(); got != "1250.00" {
+        t.Fatalf("5%%: got %s", got)
+    }
+    if got := MustParse("100", "PHP").Div(3, HalfEven).String(); got != "33.3333" {
+        t.Fatalf("div: got %s", got)
+    }
+    r, err := salary.MulRate("0.0225", HalfUp)
+    if err != nil || r.String() != "562.50" {
+        t.Fatalf("rate: %v %s", err, r)
+    }
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Fatalf("expected panic")
+        }
+    }()
+    MustParse("1", "PHP").Add(MustParse("1", "USD"))
+}
+
+func TestJSONAndBSON(t *testing.T) {
+    type rec struct {
+        Gross Money `json:"gross" bson:"gross"`
+    }
+    var r rec
+    if err := json.Unmarshal([]byte(`{"gross": 1500.10}`), &r); err != nil || r.Gross.String() != "1500.10" {
+        t.Fatalf("json number: %v %s", err, r.Gross)
+    }
+    if err := json.Unmarshal([]byte(`{"gross": "99.995"}`), &r); err != nil || r.Gross.String() != "99.995" {
+        t.Fatalf("json string: %v %s", err, r.Gross)
+    }
+    b, _ := json.Marshal(rec{Gross: MustParse("1234.5", "PHP")})
+    if string(b) != `{"gross":1234.50}` {
+        t.Fatalf("json out: %s", b)
+    }
+
+    raw, err := bson.Marshal(rec{Gross: MustParse("1234.56", "PHP")})
+    if err != nil {
+        t.Fatalf("bson marshal: %v", err)
+    }
+    var doc bson.M
+    _ = bson.Unmarshal(raw, &doc)
+    if d, ok := doc["gross"].(primitive.Decimal128); !ok || d.String() != "1234.56" {
+        t.Fatalf("expected Decimal128, got %T %v", doc["gross"], doc["gross"])
+    }
+    var back rec
+    if err := bson.Unmarshal(raw, &back); err != nil || back.Gross.String() != "1234.56" {
+        t.Fatalf("bson round trip: %v %s", err, back.Gross)
+    }
+    legacy, _ := bson.Marshal(bson.M{"gross": 165.44})
+    if err := bson.Unmarshal(legacy, &back); err != nil || back.Gross.String() != "165.44" {
+        t.Fatalf("legacy double: %v %s", err, back.Gross)
+    }
+}
+
+func TestFromDecimal128(t *testing.T) {
+    for in, want := range map[string]string{
+        "1E+3":      "1000.00",
+        "1.5E+2":    "150.00",
+        "-25E-1":    "-2.50",
+        "1234.56":   "1234.56",
+        "0.123456":  "0.1235",
+        "0.00005E0": "0.00",
+    } {
+        d, err := primitive.ParseDecimal128(in)
+        if err != nil {
+            t.Fatalf("parse %s: %v", in, err)
+        }
+        m, err := FromDecimal128(d, "PHP")
+        if err != nil || m.String() != want {
+            t.Errorf("%s: got %s %v, want %s", in, m, err, want)
+        }
+    }
+    huge, _ := primitive.ParseDecimal128("1E+30")
+    if _, err := FromDecimal128(huge, "PHP"); err == nil {
+        t.Fatal("expected an error for an out-of-range amount")
+    }
+    if _, err := FromDecimal128(primitive.NewDecimal128(0x7800000000000000, 0), "PHP"); err == nil {
+        t.Fatal("expected an error for infinity")
+    }
+}
+
+func TestRoundingPolicy(t *testing.T) {
+    p, err := ParseRoundingPolicy("default=half_even;sss=half_up")
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    m := MustParse("10.125", "PHP")
+    if p.Round("sss", m).String() != "10.13" || p.Round("tax", m).String() != "10.12" {
+        t.Fatalf("policy: %s %s", p.Round("sss", m), p.Round("tax", m))
+    }
+    if got := MustParse("-1234567.891", "").Format(); got != "-1,234,567.89" {
+        t.Fatalf("format untyped: %s", got)
+    }
+    if got := MustParse("1234567.891", "PHP").Format(); got != "PHP 1,234,567.89" {
+        t.Fatalf("format: %s", got)
+    }
+}
@@ -0,0 +1,58 @@
+package money
+
+import (
+    "strings"
+)
+
+// RoundingPolicy chooses the rounding mode per payroll component (gross,
+// sss, tax, ...). Components without an entry use Default.
+type RoundingPolicy struct {
+    Default    Rounding
+    Components map[string]Rounding
+}
+
+// DefaultRoundingPolicy rounds everything half-even.
+func DefaultRoundingPolicy() RoundingPolicy {
+    return RoundingPolicy{Default: HalfEven, Components: map[string]Rounding{}}
+}
+
+// Mode returns the rounding mode for component.
+func (p RoundingPolicy) Mode(component string) Rounding {
+    if r, ok := p.Components[component]; ok {
+        return r
+    }
+    return p.Default
+}
+
+// Round rounds m to its minor unit using the component's mode.
+func (p RoundingPolicy) Round(component string, m Money) Money {
+    return m.Round(p.Mode(component))
+}
+
+// ParseRoundingPolicy parses "default=half_even;sss=half_up;tax=half_up".
+// Unknown modes are reported; the policy parsed so far is still returned.
+func ParseRoundingPolicy(spec string) (RoundingPolicy, error) {
+    p := DefaultRoundingPolicy()
+    var firstErr error
+    for _, pair := range strings.Split(spec, ";") {
+        pair = strings.TrimSpace(pair)
+        i := strings.Index(pair, "=")
+        if i <= 0 {
+            continue
+        }
+        k := strings.TrimSpace(pair[:i])
+        r, err := ParseRounding(pair[i+1:])
+        if err != nil {
+            if firstErr == nil {
+                firstErr = err
+            }
+            continue
+        }
+        if k == "default" {
+            p.Default = r
+        } else {
+            p.Components[k] = r
+        }
+    }
+    return p, firstErr
+}
@@ -0,0 +1,280 @@
+// Package pdf writes simple text documents as PDF 1.4: pages of lines set in
+// the standard Courier faces, so no fonts need embedding. Documents can be
+// protected with a user password (RC4 128-bit, standard security handler
+// revision 3), which every common viewer supports.
+package pdf
+
+import (
+    "bytes"
+    "crypto/md5"
+    "crypto/rand"
+    "crypto/rc4"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Page geometry in points (A4).
+const (
+    PageWidth  = 595
+    PageHeight = 842
+    margin     = 40
+)
+
+// Line is one line of text. Bold lines use Courier-Bold.
+type Line struct {
+    Text string
+    Size float64 // font size in points; 9 when zero
+    Bold bool
+}
+
+// Document collects lines and breaks them into pages on Write.
+type Document struct {
+    Title string
+    Lines []Line
+}
+
+// Add appends a line.
+func (d *Document) Add(text string, size float64, bold bool) {
+    d.Lines = append(d.Lines, Line{Text: text, Size: size, Bold: bold})
+}
+
+// pages splits the lines so each page fits between the margins.
+func (d *Document) pages() [][]Line {
+    var out [][]Line
+    var cur []Line
+    y := float64(PageHeight - margin)
+    for _, l := range d.Lines {
+        lead := leading(l)
+        if y-lead < margin && len(cur) > 0 {
+            out = append(out, cur)
+            cur, y = nil, PageHeight-margin
+        }
+        cur = append(cur, l)
+        y -= lead
+    }
+    return append(out, cur)
+}
+
+func leading(l Line) float64 {
+    if l.Size == 0 {
+        return 9 * 1.35
+    }
+    return l.Size * 1.35
+}
+
+// Write renders the document to w. A non-empty password encrypts it; the
+// password is then needed to open the file.
+func (d *Document) Write(w io.Writer, password string) error {
+    var objs [][]byte // objs[i] is object i+1
+    add := func(body string) int {
+        objs = append(objs, []byte(body))
+        return len(objs)
+    }
+    // reserve catalog and page tree so pages can point at them
+    add("")
+    add("")
+    regular := add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+    bold := add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+    type stream struct {
+        num  int
+        data []byte
+    }
+    var streams []stream
+    var kids []string
+    for _, page := range d.pages() {
+        var b bytes.Buffer
+        b.WriteString("BT\n")
+        y := float64(PageHeight - margin)
+        for _, l := range page {
+            size := l.Size
+            if size == 0 {
+                size = 9
+            }
+            font := "F1"
+            if l.Bold {
+                font = "F2"
+            }
+            y -= leading(l)
+            fmt.Fprintf(&b, "/%s %.1f Tf 1 0 0 1 %d %.2f Tm (%s) Tj\n", font, size, margin, y, escape(l.Text))
+        }
+        b.WriteString("ET\n")
+        content := add("")
+        streams = append(streams, stream{content, b.Bytes()})
+        page := add(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+            PageWidth, PageHeight, regular, bold, content))
+        kids = append(kids, fmt.Sprintf("%d 0 R", page))
+    }
+    objs[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+    objs[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+
+    id := make([]byte, 16)
+    if _, err := rand.Read(id); err != nil {
+        return err
+    }
+    var sec *security
+    encrypt := 0
+    if password != "" {
+        var err error
+        if sec, err = newSecurity(password, id); err != nil {
+            return err
+        }
+        encrypt = add(sec.dict())
+    }
+    for _, s := range streams {
+        data := s.data
+        if sec != nil {
+            data = sec.crypt(s.num, data)
+        }
+        objs[s.num-1] = append([]byte(fmt.Sprintf("<< /Length %d >>\nstream\n", len(data))), append(data, []byte("\nendstream")...)...)
+    }
+    info := 0
+    if d.Title != "" {
+        // strings outside streams are encrypted with their object's key too
+        info = add("")
+        if sec != nil {
+            objs[info-1] = []byte(fmt.Sprintf("<< /Title <%x> >>", sec.crypt(info, []byte(d.Title))))
+        } else {
+            objs[info-1] = []byte(fmt.Sprintf("<< /Title (%s) >>", escape(d.Title)))
+        }
+    }
+    return flush(w, objs, id, encrypt, info)
+}
+
+// flush writes the objects, cross-reference table and trailer.
+func flush(w io.Writer, objs [][]byte, id []byte, encrypt, info int) error {
+    var b bytes.Buffer
+    b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+    offsets := make([]int, len(objs))
+    for i, o := range objs {
+        offsets[i] = b.Len()
+        fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+    }
+    xref := b.Len()
+    fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+    for _, off := range offsets {
+        fmt.Fprintf(&b, "%010d 00000 n \n", off)
+    }
+    fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /ID [<%x> <%x>]", len(objs)+1, id, id)
+    if encrypt > 0 {
+        fmt.Fprintf(&b, " /Encrypt %d 0 R", encrypt)
+    }
+    if info > 0 {
+        fmt.Fprintf(&b, " /Info %d 0 R", info)
+    }
+    fmt.Fprintf(&b, " >>\nstartxref\n%d\n%%%%EOF\n", xref)
+    _, err := w.Write(b.Bytes())
+    return err
+}
+
+// escape makes s a PDF literal string body in WinAnsi; characters outside
+// Latin-1 become '?'.
+func escape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case r == '\\' || r == '(' || r == ')':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r == '\t':
+            b.WriteString("    ")
+        case r < 32:
+        case r < 256:
+            b.WriteByte(byte(r))
+        default:
+            b.WriteByte('?')
+        }
+    }
+    return b.String()
+}
+
+// padding is the password padding string from the PDF specification.
+var padding = []byte{
+    0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+    0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// permissions allows printing and copying but not modification.
+const permissions int32 = -3904 | 4 | 16
+
+// security holds the standard security handler values for one document.
+type security struct {
+    key  []byte
+    o, u []byte
+}
+
+func pad(password string) []byte {
+    p := []byte(password)
+    if len(p) > 32 {
+        p = p[:32]
+    }
+    return append(p, padding[:32-len(p)]...)
+}
+
+func rc4Crypt(key, data []byte) []byte {
+    c, _ := rc4.NewCipher(key)
+    out := make([]byte, len(data))
+    c.XORKeyStream(out, data)
+    return out
+}
+
+// rc4Rounds applies RC4 with key, then 19 more times with key XOR i.
+func rc4Rounds(key, data []byte) []byte {
+    out := rc4Crypt(key, data)
+    k := make([]byte, len(key))
+    for i := 1; i <= 19; i++ {
+        for j := range key {
+            k[j] = key[j] ^ byte(i)
+        }
+        out = rc4Crypt(k, out)
+    }
+    return out
+}
+
+// newSecurity derives the O, U and file key (algorithms 3.2–3.5). The owner
+// password is random; nobody can lift the protection without regenerating.
+func newSecurity(user string, id []byte) (*security, error) {
+    owner := make([]byte, 16)
+    if _, err := rand.Read(owner); err != nil {
+        return nil, err
+    }
+    h := md5.Sum(pad(fmt.Sprintf("%x", owner)))
+    ok := h[:]
+    for i := 0; i < 50; i++ {
+        s := md5.Sum(ok)
+        ok = s[:]
+    }
+    s := &security{o: rc4Rounds(ok, pad(user))}
+    s.key = fileKey(user, s.o, id)
+    uh := md5.Sum(append(append([]byte{}, padding...), id...))
+    s.u = append(rc4Rounds(s.key, uh[:]), make([]byte, 16)...)
+    return s, nil
+}
+
+// fileKey computes the 128-bit document key from the user password.
+func fileKey(user string, o, id []byte) []byte {
+    var p [4]byte
+    perm := permissions
+    binary.LittleEndian.PutUint32(p[:], uint32(perm))
+    in := append(append(append(pad(user), o...), p[:]...), id...)
+    sum := md5.Sum(in)
+    key := sum[:]
+    for i := 0; i < 50; i++ {
+        s := md5.Sum(key)
+        key = s[:]
+    }
+    return key
+}
+
+// crypt encrypts (or decrypts) data belonging to object num.
+func (s *security) crypt(num int, data []byte) []byte {
+    k := append(append([]byte{}, s.key...), byte(num), byte(num>>8), byte(num>>16), 0, 0)
+    sum := md5.Sum(k)
+    return rc4Crypt(sum[:], data)
+}
+
+func (s *security) dict() string {
+    return fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /P %d /O <%x> /U <%x> >>", permissions, s.o, s.u)
+}
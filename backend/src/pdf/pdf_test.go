@@ -0,0 +1,84 @@
+package pdf
+
+import (
+    "bytes"
+    "crypto/md5"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestDocument_WritePlain(t *testing.T) {
+    d := &Document{Title: "Payslip"}
+    for i := 0; i < 100; i++ {
+        d.Add("line (with parens) \\ "+strconv.Itoa(i), 0, i == 0)
+    }
+    var b bytes.Buffer
+    if err := d.Write(&b, ""); err != nil {
+        t.Fatalf("write: %v", err)
+    }
+    out := b.String()
+    if !strings.HasPrefix(out, "%PDF-1.4") || !strings.HasSuffix(out, "%%EOF\n") {
+        t.Fatalf("not a pdf: %q", out[:20])
+    }
+    if !strings.Contains(out, "/Count 2") || !strings.Contains(out, `(line \(with parens\) \\ 99)`) {
+        t.Fatalf("expected two pages with escaped text")
+    }
+    // every xref offset points at its object
+    m := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(out)
+    xref, _ := strconv.Atoi(m[1])
+    entries := strings.Split(out[xref:], "\n")[3:]
+    for i, e := range entries[:5] {
+        off, _ := strconv.Atoi(e[:10])
+        if !strings.HasPrefix(out[off:], strconv.Itoa(i+1)+" 0 obj") {
+            t.Fatalf("xref entry %d points at %q", i+1, out[off:off+10])
+        }
+    }
+}
+
+func TestDocument_WriteEncrypted(t *testing.T) {
+    d := &Document{}
+    d.Add("NET PAY 12345.67", 0, false)
+    var b bytes.Buffer
+    if err := d.Write(&b, "199001011234"); err != nil {
+        t.Fatalf("write: %v", err)
+    }
+    out := b.String()
+    if strings.Contains(out, "NET PAY") || !strings.Contains(out, "/Filter /Standard /V 2 /R 3") {
+        t.Fatalf("content must be encrypted")
+    }
+
+    // open it the way a viewer does: derive the key from the password and
+    // check it against /U, then decrypt the content stream
+    hex := func(name string) []byte {
+        m := regexp.MustCompile(name + ` ?<([0-9a-f]+)>`).FindStringSubmatch(out)
+        raw := make([]byte, len(m[1])/2)
+        for i := range raw {
+            v, _ := strconv.ParseUint(m[1][2*i:2*i+2], 16, 8)
+            raw[i] = byte(v)
+        }
+        return raw
+    }
+    o, u, id := hex("/O"), hex("/U"), hex(`/ID \[`)
+    check := func(password string) *security {
+        s := &security{key: fileKey(password, o, id)}
+        sum := md5.Sum(append(append([]byte{}, padding...), id...))
+        if !bytes.Equal(rc4Rounds(s.key, sum[:]), u[:16]) {
+            return nil
+        }
+        return s
+    }
+    if check("wrong") != nil {
+        t.Fatalf("wrong password accepted")
+    }
+    s := check("199001011234")
+    if s == nil {
+        t.Fatalf("password rejected")
+    }
+    start := strings.Index(out, "stream\n") + len("stream\n")
+    end := strings.Index(out, "\nendstream")
+    if plain := s.crypt(5, []byte(out[start:end])); !bytes.Contains(plain, []byte("(NET PAY 12345.67) Tj")) {
+        t.Fatalf("decrypted stream: %q", plain)
+    }
+}
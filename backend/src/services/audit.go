@@ -0,0 +1,106 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditLog is an append-only log of sensitive changes. Entries are never
+// updated or deleted.
+type AuditLog interface {
+    Record(ctx context.Context, e models.AuditEntry) error
+    // List returns entries for target (all entries when target is empty), newest first.
+    List(ctx context.Context, target string) ([]models.AuditEntry, error)
+}
+
+// newAuditEntry fills the id and timestamp of an entry.
+func newAuditEntry(actor, action, target string, details map[string]interface{}) models.AuditEntry {
+    now := time.Now()
+    return models.AuditEntry{
+        EntryID:   fmt.Sprintf("aud-%d", now.UnixNano()),
+        Actor:     actor,
+        Action:    action,
+        Target:    target,
+        Details:   details,
+        Timestamp: now.Unix(),
+    }
+}
+
+// recordAudit writes an entry when a log is configured.
+func recordAudit(ctx context.Context, log AuditLog, actor, action, target string, details map[string]interface{}) error {
+    if log == nil {
+        return nil
+    }
+    return log.Record(ctx, newAuditEntry(actor, action, target, details))
+}
+
+// InMemoryAuditLog keeps audit entries in memory.
+type InMemoryAuditLog struct {
+    mu      sync.Mutex
+    entries []models.AuditEntry
+}
+
+func NewInMemoryAuditLog() *InMemoryAuditLog {
+    return &InMemoryAuditLog{}
+}
+
+func (l *InMemoryAuditLog) Record(ctx context.Context, e models.AuditEntry) error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.entries = append(l.entries, e)
+    return nil
+}
+
+func (l *InMemoryAuditLog) List(ctx context.Context, target string) ([]models.AuditEntry, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    out := []models.AuditEntry{}
+    for i := len(l.entries) - 1; i >= 0; i-- {
+        if target == "" || l.entries[i].Target == target {
+            out = append(out, l.entries[i])
+        }
+    }
+    return out, nil
+}
+
+// MongoAuditLog stores audit entries in MongoDB (insert only).
+type MongoAuditLog struct {
+    coll *mongo.Collection
+}
+
+func NewMongoAuditLog(coll *mongo.Collection) *MongoAuditLog {
+    return &MongoAuditLog{coll: coll}
+}
+
+func (l *MongoAuditLog) Record(ctx context.Context, e models.AuditEntry) error {
+    _, err := l.coll.InsertOne(ctx, e)
+    return err
+}
+
+func (l *MongoAuditLog) List(ctx context.Context, target string) ([]models.AuditEntry, error) {
+    filter := bson.M{}
+    if target != "" {
+        filter["target"] = target
+    }
+    cur, err := l.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+    defer cur.Close(ctx)
+    out := []models.AuditEntry{}
+    for cur.Next(ctx) {
+        var e models.AuditEntry
+        if err := cur.Decode(&e); err != nil {
+            continue
+        }
+        out = append(out, e)
+    }
+    return out, nil
+}
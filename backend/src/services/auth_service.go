@@ -2,29 +2,76 @@ package services
 
 import (
     "context"
+    "sync"
+    "time"
 
+    "github.com/ronaldpalay/hris/src/models"
     "golang.org/x/crypto/bcrypt"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// passwordHistoryLimit caps how many previous hashes a store keeps.
+const passwordHistoryLimit = 24
+
 // AuthStore defines the methods an auth backing store must implement.
 type AuthStore interface {
     CreateUser(ctx context.Context, username, password string, roles []string) error
     ValidateCredentials(ctx context.Context, username, password string) (bool, []string, error)
     // CreateUserWithHash allows creating a user when you already have a password hash
     CreateUserWithHash(ctx context.Context, username, passwordHash string, roles []string) error
+    // GetUser returns the account or mongo.ErrNoDocuments.
+    GetUser(ctx context.Context, username string) (*models.UserAccount, error)
+    // GetUserBySAMLNameID returns the account linked to the IdP identity
+    // nameID or mongo.ErrNoDocuments.
+    GetUserBySAMLNameID(ctx context.Context, nameID string) (*models.UserAccount, error)
+    // CreateSAMLUser creates a password-less account linked to nameID in one
+    // write. It returns ErrSAMLAlreadyLinked when username or nameID is taken.
+    CreateSAMLUser(ctx context.Context, username, nameID string, roles []string) error
+    // UpdatePassword replaces the hash, moving the old one into the history.
+    UpdatePassword(ctx context.Context, username, passwordHash string, mustChange bool) error
+    // UpdateUser applies the non-nil fields of upd.
+    UpdateUser(ctx context.Context, username string, upd UserUpdate) error
+    ListUsers(ctx context.Context) ([]models.UserAccount, error)
+    DeleteUser(ctx context.Context, username string) error
+    // RecordLogin stores the time of a successful login.
+    RecordLogin(ctx context.Context, username string, at time.Time) error
+}
+
+// UserUpdate lists account fields that can be changed; nil fields are left alone.
+type UserUpdate struct {
+    Email              *string
+    MustChangePassword *bool
+    Roles              *[]string
+    Status             *string
+    EmployeeID         *string
+    SAMLNameID         *string
+}
+
+// suspended reports whether the account may not log in.
+func suspended(status string) bool {
+    return status == models.UserStatusSuspended
+}
+
+// dummyHash is computed at startup so the first login for an unknown
+// username does not pay for generating it.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("hris-timing-equalizer"), bcrypt.DefaultCost)
+
+// equalizeTiming runs a bcrypt comparison against a throwaway hash so a login
+// for an unknown username takes as long as one with a wrong password.
+func equalizeTiming(password string) {
+    _ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
 }
 
 // InMemoryUserStore is a tiny store used for tests and simple setups.
 type InMemoryUserStore struct {
-    users map[string]string // username -> passwordHash
-    roles map[string][]string
+    mu    sync.Mutex
+    users map[string]*models.UserAccount
 }
 
 func NewInMemoryUserStore() *InMemoryUserStore {
-    return &InMemoryUserStore{users: map[string]string{}, roles: map[string][]string{}}
+    return &InMemoryUserStore{users: map[string]*models.UserAccount{}}
 }
 
 func (s *InMemoryUserStore) CreateUser(ctx context.Context, username, password string, roles []string) error {
@@ -36,21 +83,161 @@ func (s *InMemoryUserStore) CreateUser(ctx context.Context, username, password s
 }
 
 func (s *InMemoryUserStore) CreateUserWithHash(ctx context.Context, username, passwordHash string, roles []string) error {
-    s.users[username] = passwordHash
-    s.roles[username] = roles
-    _ = ctx
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    // upsert like the mongo store: recreating a user updates roles/hash
+    if u, ok := s.users[username]; ok {
+        u.PasswordHash = passwordHash
+        u.Roles = roles
+        return nil
+    }
+    s.users[username] = &models.UserAccount{Username: username, PasswordHash: passwordHash, Roles: roles, CreatedAt: time.Now().Unix()}
     return nil
 }
 
 func (s *InMemoryUserStore) ValidateCredentials(ctx context.Context, username, password string) (bool, []string, error) {
-    h, ok := s.users[username]
+    s.mu.Lock()
+    u, ok := s.users[username]
+    var h, status string
+    var roles []string
+    if ok {
+        h, roles, status = u.PasswordHash, u.Roles, u.Status
+    }
+    s.mu.Unlock()
     if !ok {
+        equalizeTiming(password)
         return false, nil, nil
     }
-    if err := bcrypt.CompareHashAndPassword([]byte(h), []byte(password)); err != nil {
+    if err := bcrypt.CompareHashAndPassword([]byte(h), []byte(password)); err != nil || suspended(status) {
         return false, nil, nil
     }
-    return true, s.roles[username], nil
+    return true, roles, nil
+}
+
+func (s *InMemoryUserStore) GetUser(ctx context.Context, username string) (*models.UserAccount, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    u, ok := s.users[username]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    cp := *u
+    cp.PasswordHistory = append([]string(nil), u.PasswordHistory...)
+    cp.Roles = append([]string(nil), u.Roles...)
+    return &cp, nil
+}
+
+func (s *InMemoryUserStore) GetUserBySAMLNameID(ctx context.Context, nameID string) (*models.UserAccount, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, u := range s.users {
+        if nameID != "" && u.SAMLNameID == nameID {
+            cp := *u
+            cp.PasswordHistory = append([]string(nil), u.PasswordHistory...)
+            cp.Roles = append([]string(nil), u.Roles...)
+            return &cp, nil
+        }
+    }
+    return nil, mongo.ErrNoDocuments
+}
+
+func (s *InMemoryUserStore) CreateSAMLUser(ctx context.Context, username, nameID string, roles []string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.users[username]; ok {
+        return ErrSAMLAlreadyLinked
+    }
+    for _, u := range s.users {
+        if u.SAMLNameID == nameID {
+            return ErrSAMLAlreadyLinked
+        }
+    }
+    s.users[username] = &models.UserAccount{Username: username, Roles: append([]string(nil), roles...), SAMLNameID: nameID, CreatedAt: time.Now().Unix()}
+    return nil
+}
+
+func (s *InMemoryUserStore) UpdatePassword(ctx context.Context, username, passwordHash string, mustChange bool) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    u, ok := s.users[username]
+    if !ok {
+        return mongo.ErrNoDocuments
+    }
+    u.PasswordHistory = append([]string{u.PasswordHash}, u.PasswordHistory...)
+    if len(u.PasswordHistory) > passwordHistoryLimit {
+        u.PasswordHistory = u.PasswordHistory[:passwordHistoryLimit]
+    }
+    u.PasswordHash = passwordHash
+    u.MustChangePassword = mustChange
+    u.PasswordChangedAt = time.Now().Unix()
+    return nil
+}
+
+func (s *InMemoryUserStore) UpdateUser(ctx context.Context, username string, upd UserUpdate) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    u, ok := s.users[username]
+    if !ok {
+        return mongo.ErrNoDocuments
+    }
+    if upd.Email != nil {
+        u.Email = *upd.Email
+    }
+    if upd.MustChangePassword != nil {
+        u.MustChangePassword = *upd.MustChangePassword
+    }
+    if upd.Roles != nil {
+        u.Roles = append([]string(nil), (*upd.Roles)...)
+    }
+    if upd.Status != nil {
+        u.Status = *upd.Status
+    }
+    if upd.EmployeeID != nil {
+        u.EmployeeID = *upd.EmployeeID
+    }
+    if upd.SAMLNameID != nil {
+        // the same identity cannot sign in as two accounts
+        for name, other := range s.users {
+            if name != username && *upd.SAMLNameID != "" && other.SAMLNameID == *upd.SAMLNameID {
+                return ErrSAMLAlreadyLinked
+            }
+        }
+        u.SAMLNameID = *upd.SAMLNameID
+    }
+    return nil
+}
+
+func (s *InMemoryUserStore) ListUsers(ctx context.Context) ([]models.UserAccount, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make([]models.UserAccount, 0, len(s.users))
+    for _, u := range s.users {
+        cp := *u
+        cp.Roles = append([]string(nil), u.Roles...)
+        out = append(out, cp)
+    }
+    return out, nil
+}
+
+func (s *InMemoryUserStore) DeleteUser(ctx context.Context, username string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.users[username]; !ok {
+        return mongo.ErrNoDocuments
+    }
+    delete(s.users, username)
+    return nil
+}
+
+func (s *InMemoryUserStore) RecordLogin(ctx context.Context, username string, at time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    u, ok := s.users[username]
+    if !ok {
+        return mongo.ErrNoDocuments
+    }
+    u.LastLogin = at.Unix()
+    return nil
 }
 
 // MongoUserStore implements AuthStore using a MongoDB collection.
@@ -66,6 +253,19 @@ func NewMongoUserStore(client *mongo.Client, dbName, collName string) *MongoUser
     return &MongoUserStore{coll: client.Database(dbName).Collection(collName)}
 }
 
+// EnsureIndexes creates the unique saml_name_id index. It is sparse because
+// only accounts linked to the IdP carry the field.
+func (m *MongoUserStore) EnsureIndexes(ctx context.Context) error {
+    if m.coll == nil {
+        return nil
+    }
+    _, err := m.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "saml_name_id", Value: 1}},
+        Options: options.Index().SetUnique(true).SetSparse(true),
+    })
+    return err
+}
+
 func (m *MongoUserStore) CreateUser(ctx context.Context, username, password string, roles []string) error {
     h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
     if err != nil {
@@ -81,7 +281,7 @@ func (m *MongoUserStore) CreateUserWithHash(ctx context.Context, username, passw
     doc := bson.M{"username": username, "password_hash": passwordHash, "roles": roles}
     // upsert so creating same user updates roles/hash
     opts := options.Update().SetUpsert(true)
-    _, err := m.coll.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": doc}, opts)
+    _, err := m.coll.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": doc, "$setOnInsert": bson.M{"created_at": time.Now().Unix()}}, opts)
     return err
 }
 
@@ -92,17 +292,172 @@ func (m *MongoUserStore) ValidateCredentials(ctx context.Context, username, pass
     var out struct {
         PasswordHash string   `bson:"password_hash"`
         Roles        []string `bson:"roles"`
+        Status       string   `bson:"status"`
     }
     err := m.coll.FindOne(ctx, bson.M{"username": username}).Decode(&out)
     if err != nil {
         if err == mongo.ErrNoDocuments {
+            equalizeTiming(password)
             return false, nil, nil
         }
         return false, nil, err
     }
-    if err := bcrypt.CompareHashAndPassword([]byte(out.PasswordHash), []byte(password)); err != nil {
+    if err := bcrypt.CompareHashAndPassword([]byte(out.PasswordHash), []byte(password)); err != nil || suspended(out.Status) {
         return false, nil, nil
     }
     return true, out.Roles, nil
 }
 
+func (m *MongoUserStore) GetUser(ctx context.Context, username string) (*models.UserAccount, error) {
+    if m.coll == nil {
+        return nil, mongo.ErrNoDocuments
+    }
+    var u models.UserAccount
+    if err := m.coll.FindOne(ctx, bson.M{"username": username}).Decode(&u); err != nil {
+        return nil, err
+    }
+    return &u, nil
+}
+
+func (m *MongoUserStore) GetUserBySAMLNameID(ctx context.Context, nameID string) (*models.UserAccount, error) {
+    if m.coll == nil || nameID == "" {
+        return nil, mongo.ErrNoDocuments
+    }
+    var u models.UserAccount
+    if err := m.coll.FindOne(ctx, bson.M{"saml_name_id": nameID}).Decode(&u); err != nil {
+        return nil, err
+    }
+    return &u, nil
+}
+
+func (m *MongoUserStore) CreateSAMLUser(ctx context.Context, username, nameID string, roles []string) error {
+    if m.coll == nil {
+        return nil
+    }
+    doc := bson.M{"username": username, "password_hash": "", "roles": roles, "saml_name_id": nameID, "created_at": time.Now().Unix()}
+    // insert only: an existing account with the name is not taken over
+    res, err := m.coll.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$setOnInsert": doc}, options.Update().SetUpsert(true))
+    if mongo.IsDuplicateKeyError(err) {
+        return ErrSAMLAlreadyLinked
+    }
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount > 0 {
+        return ErrSAMLAlreadyLinked
+    }
+    return nil
+}
+
+func (m *MongoUserStore) UpdatePassword(ctx context.Context, username, passwordHash string, mustChange bool) error {
+    cur, err := m.GetUser(ctx, username)
+    if err != nil {
+        return err
+    }
+    upd := bson.M{
+        "$set": bson.M{"password_hash": passwordHash, "must_change_password": mustChange, "password_changed_at": time.Now().Unix()},
+        "$push": bson.M{"password_history": bson.M{"$each": []string{cur.PasswordHash}, "$position": 0, "$slice": passwordHistoryLimit}},
+    }
+    // match on the old hash so two concurrent changes cannot both succeed
+    res, err := m.coll.UpdateOne(ctx, bson.M{"username": username, "password_hash": cur.PasswordHash}, upd)
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
+
+func (m *MongoUserStore) UpdateUser(ctx context.Context, username string, upd UserUpdate) error {
+    if m.coll == nil {
+        return mongo.ErrNoDocuments
+    }
+    set, unset := bson.M{}, bson.M{}
+    if upd.Email != nil {
+        set["email"] = *upd.Email
+    }
+    if upd.MustChangePassword != nil {
+        set["must_change_password"] = *upd.MustChangePassword
+    }
+    if upd.Roles != nil {
+        set["roles"] = *upd.Roles
+    }
+    if upd.Status != nil {
+        set["status"] = *upd.Status
+    }
+    if upd.EmployeeID != nil {
+        set["employee_id"] = *upd.EmployeeID
+    }
+    if upd.SAMLNameID != nil {
+        // unlinked accounts drop the field so the sparse index skips them
+        if *upd.SAMLNameID == "" {
+            unset["saml_name_id"] = ""
+        } else {
+            set["saml_name_id"] = *upd.SAMLNameID
+        }
+    }
+    if len(set) == 0 && len(unset) == 0 {
+        return nil
+    }
+    doc := bson.M{}
+    if len(set) > 0 {
+        doc["$set"] = set
+    }
+    if len(unset) > 0 {
+        doc["$unset"] = unset
+    }
+    res, err := m.coll.UpdateOne(ctx, bson.M{"username": username}, doc)
+    if mongo.IsDuplicateKeyError(err) && upd.SAMLNameID != nil {
+        return ErrSAMLAlreadyLinked
+    }
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
+
+func (m *MongoUserStore) ListUsers(ctx context.Context) ([]models.UserAccount, error) {
+    if m.coll == nil {
+        return []models.UserAccount{}, nil
+    }
+    cur, err := m.coll.Find(ctx, bson.M{})
+    if err != nil {
+        return nil, err
+    }
+    defer cur.Close(ctx)
+    out := []models.UserAccount{}
+    for cur.Next(ctx) {
+        var u models.UserAccount
+        if err := cur.Decode(&u); err != nil {
+            continue
+        }
+        out = append(out, u)
+    }
+    return out, nil
+}
+
+func (m *MongoUserStore) DeleteUser(ctx context.Context, username string) error {
+    if m.coll == nil {
+        return mongo.ErrNoDocuments
+    }
+    res, err := m.coll.DeleteOne(ctx, bson.M{"username": username})
+    if err != nil {
+        return err
+    }
+    if res.DeletedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
+
+func (m *MongoUserStore) RecordLogin(ctx context.Context, username string, at time.Time) error {
+    if m.coll == nil {
+        return nil
+    }
+    _, err := m.coll.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"last_login": at.Unix()}})
+    return err
+}
@@ -0,0 +1,502 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    _ "embed"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "text/template"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+//go:embed layouts/bank.json
+var defaultBankLayouts []byte
+
+var (
+    // ErrUnknownLayout is returned for a layout name not in the configuration.
+    ErrUnknownLayout = errors.New("unknown export layout")
+    // ErrAlreadyExported is returned when a run's payslips in a currency were
+    // already exported and not voided.
+    ErrAlreadyExported = errors.New("run already exported; void the earlier export first")
+    // ErrExportValidation wraps *ExportValidationError.
+    ErrExportValidation = errors.New("export validation failed")
+)
+
+// ExportValidationError lists every problem found before producing a file.
+type ExportValidationError struct {
+    Problems []string
+}
+
+func (e *ExportValidationError) Error() string {
+    return fmt.Sprintf("%v: %s", ErrExportValidation, strings.Join(e.Problems, "; "))
+}
+
+func (e *ExportValidationError) Unwrap() error { return ErrExportValidation }
+
+// BankField is one column (CSV) or fixed-width slot of a record. The value
+// comes from Source (see bankSources) or is the literal Value.
+type BankField struct {
+    Name     string `json:"name"`
+    Source   string `json:"source,omitempty"`
+    Value    string `json:"value,omitempty"`
+    Format   string `json:"format,omitempty"` // amounts: decimal (default) or cents; dates: a Go time layout
+    Width    int    `json:"width,omitempty"`  // fixed-width layouts
+    Align    string `json:"align,omitempty"`  // left (default) or right
+    Pad      string `json:"pad,omitempty"`    // pad character, space by default
+    Truncate bool   `json:"truncate,omitempty"`
+}
+
+// BankLayout describes a bank's credit file: an optional batch header, a
+// detail record per employee and an optional control trailer.
+type BankLayout struct {
+    Name           string      `json:"name"`
+    Description    string      `json:"description,omitempty"`
+    Format         string      `json:"format"` // csv or fixed
+    Delimiter      string      `json:"delimiter,omitempty"`
+    ColumnHeaders  bool        `json:"column_headers,omitempty"` // csv: first line names the detail fields
+    LineEnding     string      `json:"line_ending,omitempty"`
+    Currency       string      `json:"currency,omitempty"`
+    AccountDigits  int         `json:"account_digits,omitempty"` // required account number length, 0 for any
+    CompanyName    string      `json:"company_name,omitempty"`
+    CompanyAccount string      `json:"company_account,omitempty"`
+    FileName       string      `json:"file_name,omitempty"` // text/template over the batch fields
+    Header         []BankField `json:"header,omitempty"`
+    Detail         []BankField `json:"detail"`
+    Trailer        []BankField `json:"trailer,omitempty"`
+}
+
+// bankSources lists the fields a layout can use, by record.
+var bankSources = map[string]bool{
+    // batch: header, trailer and file name
+    "company_name": true, "company_account": true, "pay_date": true, "pay_date_compact": true, "run_id": true,
+    "batch_id": true, "record_count": true, "control_total": true, "currency": true,
+    // detail
+    "sequence": true, "employee_id": true, "employee_name": true, "bank": true, "account_number": true, "account_name": true, "amount": true,
+}
+
+// BankLayouts holds the configured layouts by name.
+type BankLayouts struct {
+    layouts map[string]BankLayout
+}
+
+// DefaultBankLayouts loads the generic layouts embedded in the binary.
+func DefaultBankLayouts() (*BankLayouts, error) {
+    return LoadBankLayouts(defaultBankLayouts)
+}
+
+// LoadBankLayouts parses a {"layouts": [...]} document and checks every
+// layout.
+func LoadBankLayouts(data []byte) (*BankLayouts, error) {
+    var doc struct {
+        Layouts []BankLayout `json:"layouts"`
+    }
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("bank layouts: %w", err)
+    }
+    out := &BankLayouts{layouts: map[string]BankLayout{}}
+    for _, l := range doc.Layouts {
+        if err := l.validate(); err != nil {
+            return nil, fmt.Errorf("bank layout %q: %w", l.Name, err)
+        }
+        out.layouts[l.Name] = l
+    }
+    return out, nil
+}
+
+func (l *BankLayout) validate() error {
+    if l.Name == "" {
+        return errors.New("name required")
+    }
+    if l.Format != "csv" && l.Format != "fixed" {
+        return fmt.Errorf("format must be csv or fixed, not %q", l.Format)
+    }
+    if len(l.Detail) == 0 {
+        return errors.New("detail fields required")
+    }
+    if len([]rune(l.Delimiter)) > 1 {
+        return errors.New("delimiter must be one character")
+    }
+    for _, fields := range [][]BankField{l.Header, l.Detail, l.Trailer} {
+        for _, f := range fields {
+            if f.Source != "" && !bankSources[f.Source] {
+                return fmt.Errorf("field %q: unknown source %q", f.Name, f.Source)
+            }
+            if l.Format == "fixed" && f.Width <= 0 {
+                return fmt.Errorf("field %q: width required", f.Name)
+            }
+            if len([]rune(f.Pad)) > 1 {
+                return fmt.Errorf("field %q: pad must be one character", f.Name)
+            }
+        }
+    }
+    if l.FileName != "" {
+        if _, err := template.New("file").Parse(l.FileName); err != nil {
+            return fmt.Errorf("file_name: %w", err)
+        }
+    }
+    return nil
+}
+
+// Get returns the layout called name.
+func (b *BankLayouts) Get(name string) (BankLayout, error) {
+    l, ok := b.layouts[name]
+    if !ok {
+        return BankLayout{}, fmt.Errorf("%w: %q", ErrUnknownLayout, name)
+    }
+    return l, nil
+}
+
+// List returns the layouts sorted by name.
+func (b *BankLayouts) List() []BankLayout {
+    out := make([]BankLayout, 0, len(b.layouts))
+    for _, l := range b.layouts {
+        out = append(out, l)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out
+}
+
+// SetCompany fills the company name and account of layouts that do not set
+// their own.
+func (b *BankLayouts) SetCompany(name, account string) {
+    for k, l := range b.layouts {
+        if l.CompanyName == "" {
+            l.CompanyName = name
+        }
+        if l.CompanyAccount == "" {
+            l.CompanyAccount = account
+        }
+        b.layouts[k] = l
+    }
+}
+
+// ExportFile is a generated file and its record on the run.
+type ExportFile struct {
+    Export  models.RunExport
+    Content []byte
+}
+
+// exportSeq keeps export ids unique within a timestamp.
+var exportSeq int64
+
+// BankExport produces the credit file of a finalized run in layout: one
+// record per payslip in the layout's currency, crediting the net pay to the
+// employee's bank_account. Every employee must have a valid account number
+// and a positive net pay, or nothing is produced. The export is recorded on
+// the run with its checksum; a second export of the run in the same currency
+// is refused until the earlier export is voided.
+func (s *PayrollRunService) BankExport(ctx context.Context, actor, runID string, layout BankLayout) (*ExportFile, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.Status != models.RunFinalized {
+        return nil, fmt.Errorf("%w: only finalized runs are disbursed, run is %s", ErrRunState, run.Status)
+    }
+    cur := layout.Currency
+    if cur == "" {
+        cur = money.DefaultCurrency
+    }
+    for _, e := range run.Exports {
+        if e.Kind == models.ExportBank && e.VoidedAt == 0 && e.Currency == cur {
+            return nil, fmt.Errorf("%w: %s", ErrAlreadyExported, e.ExportID)
+        }
+    }
+    slips, err := s.store.ListPayslips(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(slips, func(i, j int) bool { return slips[i].EmployeeID < slips[j].EmployeeID })
+
+    var problems []string
+    if layout.CompanyAccount == "" && layoutUses(layout, "company_account") {
+        problems = append(problems, "company account is not configured")
+    }
+    var details []map[string]string
+    total := money.Zero(cur)
+    for _, p := range slips {
+        if p.Currency != cur {
+            continue
+        }
+        emp, err := s.employees.Get(ctx, p.EmployeeID)
+        if err != nil {
+            problems = append(problems, fmt.Sprintf("%s: employee record not found", p.EmployeeID))
+            continue
+        }
+        acct := bankAccount(emp)
+        number := strings.NewReplacer(" ", "", "-", "").Replace(acct.AccountNumber)
+        switch {
+        case number == "":
+            problems = append(problems, fmt.Sprintf("%s: no bank account number", p.EmployeeID))
+        case strings.Trim(number, "0123456789") != "":
+            problems = append(problems, fmt.Sprintf("%s: account number %q is not numeric", p.EmployeeID, acct.AccountNumber))
+        case layout.AccountDigits > 0 && len(number) != layout.AccountDigits:
+            problems = append(problems, fmt.Sprintf("%s: account number must have %d digits", p.EmployeeID, layout.AccountDigits))
+        }
+        if p.Net.Sign() <= 0 {
+            problems = append(problems, fmt.Sprintf("%s: net pay %s is not payable", p.EmployeeID, p.Net))
+        }
+        name := acct.AccountName
+        if name == "" {
+            name = employeeName(emp)
+        }
+        total = total.Add(p.Net.Round(money.HalfEven))
+        details = append(details, map[string]string{
+            "sequence": strconv.Itoa(len(details) + 1), "employee_id": p.EmployeeID, "employee_name": employeeName(emp),
+            "bank": acct.Bank, "account_number": number, "account_name": name, "amount": p.Net.Round(money.HalfEven).String(), "currency": cur,
+        })
+    }
+    if len(details) == 0 {
+        problems = append(problems, fmt.Sprintf("no %s payslips to disburse", cur))
+    }
+    if len(problems) > 0 {
+        return nil, &ExportValidationError{Problems: problems}
+    }
+
+    batchID, err := s.nextBatchID(ctx)
+    if err != nil {
+        return nil, err
+    }
+    payDate := run.PayDate
+    if payDate == "" {
+        payDate = run.PeriodEnd
+    }
+    batch := map[string]string{
+        "company_name": layout.CompanyName, "company_account": layout.CompanyAccount, "pay_date": payDate,
+        "pay_date_compact": strings.ReplaceAll(payDate, "-", ""), "run_id": runID, "batch_id": strconv.Itoa(batchID),
+        "record_count": strconv.Itoa(len(details)), "control_total": total.Round(money.HalfEven).String(), "currency": cur,
+    }
+    content, err := layout.write(batch, details)
+    if err != nil {
+        return nil, &ExportValidationError{Problems: []string{err.Error()}}
+    }
+    sum := sha256.Sum256(content)
+    checksum := hex.EncodeToString(sum[:])
+
+    fileName := fmt.Sprintf("%s-%s.txt", layout.Name, runID)
+    if layout.FileName != "" {
+        var b bytes.Buffer
+        if err := template.Must(template.New("file").Parse(layout.FileName)).Execute(&b, batch); err != nil {
+            return nil, err
+        }
+        fileName = b.String()
+    }
+    now := s.now()
+    e := models.RunExport{
+        ExportID:  fmt.Sprintf("exp-%d-%d", now.UnixNano(), atomic.AddInt64(&exportSeq, 1)),
+        Kind:      models.ExportBank,
+        Layout:    layout.Name,
+        FileName:  fileName,
+        Checksum:  checksum,
+        Records:   len(details),
+        Currency:  cur,
+        Total:     total,
+        CreatedBy: actor,
+        CreatedAt: now.Unix(),
+    }
+    run.Exports = append(run.Exports, e)
+    run.Version++
+    if err := s.store.SaveRun(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.export", runID, map[string]interface{}{
+        "export_id": e.ExportID, "kind": e.Kind, "layout": e.Layout, "checksum": checksum, "records": e.Records, "total": total.String(),
+    }); err != nil {
+        return nil, err
+    }
+    return &ExportFile{Export: e, Content: content}, nil
+}
+
+// VoidExport marks an export as not used, e.g. after the bank rejected the
+// file, so the run can be exported again.
+func (s *PayrollRunService) VoidExport(ctx context.Context, actor, runID, exportID, reason string) (*models.RunExport, error) {
+    if strings.TrimSpace(reason) == "" {
+        return nil, fmt.Errorf("%w: reason required", ErrInvalidPayrollRequest)
+    }
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    for i := range run.Exports {
+        e := &run.Exports[i]
+        if e.ExportID != exportID {
+            continue
+        }
+        if e.VoidedAt != 0 {
+            return nil, fmt.Errorf("%w: export already voided", ErrRunState)
+        }
+        e.VoidedBy, e.VoidReason, e.VoidedAt = actor, reason, s.now().Unix()
+        run.Version++
+        if err := s.store.SaveRun(ctx, run); err != nil {
+            return nil, err
+        }
+        if err := recordAudit(ctx, s.audit, actor, "payroll_run.export_void", runID, map[string]interface{}{"export_id": exportID, "reason": reason}); err != nil {
+            return nil, err
+        }
+        return e, nil
+    }
+    return nil, fmt.Errorf("%w: export %s", ErrInvalidPayrollRequest, exportID)
+}
+
+// nextBatchID numbers bank files across all runs, voided ones included.
+func (s *PayrollRunService) nextBatchID(ctx context.Context) (int, error) {
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return 0, err
+    }
+    n := 1
+    for _, r := range runs {
+        for _, e := range r.Exports {
+            if e.Kind == models.ExportBank {
+                n++
+            }
+        }
+    }
+    return n, nil
+}
+
+// bankAccount reads the employee's bank_account, which may be stored as a
+// decoded map or a struct.
+func bankAccount(emp map[string]interface{}) models.BankAccount {
+    var acct models.BankAccount
+    switch v := emp["bank_account"].(type) {
+    case map[string]interface{}:
+        acct.Bank, _ = v["bank"].(string)
+        acct.AccountNumber, _ = v["account_number"].(string)
+        acct.AccountName, _ = v["account_name"].(string)
+    case models.BankAccount:
+        acct = v
+    case *models.BankAccount:
+        if v != nil {
+            acct = *v
+        }
+    }
+    return acct
+}
+
+// layoutUses reports whether any field of l reads source.
+func layoutUses(l BankLayout, source string) bool {
+    for _, fields := range [][]BankField{l.Header, l.Detail, l.Trailer} {
+        for _, f := range fields {
+            if f.Source == source {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// write renders the header, details and trailer.
+func (l BankLayout) write(batch map[string]string, details []map[string]string) ([]byte, error) {
+    var records [][]string
+    if l.Format == "csv" && l.ColumnHeaders {
+        var names []string
+        for _, f := range l.Detail {
+            names = append(names, f.Name)
+        }
+        records = append(records, names)
+    }
+    build := func(fields []BankField, values map[string]string) error {
+        if len(fields) == 0 {
+            return nil
+        }
+        var rec []string
+        for _, f := range fields {
+            v, err := l.value(f, values)
+            if err != nil {
+                return err
+            }
+            rec = append(rec, v)
+        }
+        records = append(records, rec)
+        return nil
+    }
+    if err := build(l.Header, batch); err != nil {
+        return nil, err
+    }
+    for _, d := range details {
+        if err := build(l.Detail, d); err != nil {
+            return nil, fmt.Errorf("%s: %w", d["employee_id"], err)
+        }
+    }
+    if err := build(l.Trailer, batch); err != nil {
+        return nil, err
+    }
+
+    eol := l.LineEnding
+    if eol == "" {
+        eol = "\n"
+    }
+    var b bytes.Buffer
+    if l.Format == "fixed" {
+        for _, rec := range records {
+            b.WriteString(strings.Join(rec, ""))
+            b.WriteString(eol)
+        }
+        return b.Bytes(), nil
+    }
+    w := csv.NewWriter(&b)
+    if l.Delimiter != "" {
+        w.Comma = []rune(l.Delimiter)[0]
+    }
+    w.UseCRLF = eol == "\r\n"
+    if err := w.WriteAll(records); err != nil {
+        return nil, err
+    }
+    return b.Bytes(), nil
+}
+
+// value formats one field. Fixed-width values that do not fit are an error
+// unless the field may be truncated, so account numbers and amounts are
+// never cut.
+func (l BankLayout) value(f BankField, values map[string]string) (string, error) {
+    v := f.Value
+    if f.Source != "" {
+        v = values[f.Source]
+    }
+    switch {
+    case f.Format == "cents" && (f.Source == "amount" || f.Source == "control_total"):
+        m, err := money.Parse(v, values["currency"])
+        if err != nil {
+            return "", err
+        }
+        v = strconv.FormatInt(m.Minor(money.HalfEven), 10)
+    case f.Format != "" && f.Source != "" && strings.HasPrefix(f.Source, "pay_date"):
+        d, err := time.Parse("2006-01-02", values["pay_date"])
+        if err != nil {
+            return "", err
+        }
+        v = d.Format(f.Format)
+    }
+    if l.Format != "fixed" {
+        return v, nil
+    }
+    n := len([]rune(v))
+    if n > f.Width {
+        if !f.Truncate {
+            return "", fmt.Errorf("field %s: %q is longer than %d", f.Name, v, f.Width)
+        }
+        return string([]rune(v)[:f.Width]), nil
+    }
+    pad := f.Pad
+    if pad == "" {
+        pad = " "
+    }
+    fill := strings.Repeat(pad, f.Width-n)
+    if f.Align == "right" {
+        return fill + v, nil
+    }
+    return v + fill, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+)
+
+func TestLoadBankLayouts(t *testing.T) {
+    layouts, err := DefaultBankLayouts()
+    if err != nil {
+        t.Fatalf("default layouts: %v", err)
+    }
+    if got := layouts.List(); len(got) != 2 || got[0].Name != "csv" || got[1].Name != "fixed" {
+        t.Fatalf("layouts: %+v", got)
+    }
+    if _, err := layouts.Get("nope"); !errors.Is(err, ErrUnknownLayout) {
+        t.Fatalf("expected ErrUnknownLayout, got %v", err)
+    }
+    bad := []string{
+        `{"layouts":[{"name":"x","format":"xml","detail":[{"name":"a","source":"amount"}]}]}`,
+        `{"layouts":[{"name":"x","format":"csv","detail":[{"name":"a","source":"salary"}]}]}`,
+        `{"layouts":[{"name":"x","format":"fixed","detail":[{"name":"a","source":"amount"}]}]}`,
+    }
+    for _, doc := range bad {
+        if _, err := LoadBankLayouts([]byte(doc)); err == nil {
+            t.Fatalf("accepted %s", doc)
+        }
+    }
+}
+
+func TestPayrollRunService_BankExport(t *testing.T) {
+    ctx := context.Background()
+    svc, audit := newRunTestService(t)
+    layouts, _ := DefaultBankLayouts()
+    layouts.SetCompany("Acme Inc.", "9990001112")
+    fixed, _ := layouts.Get("fixed")
+    csvLayout, _ := layouts.Get("csv")
+
+    p, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-15", PayDate: "2025-06-13"})
+    run, _ := svc.CreateRun(ctx, "clerk", p.PeriodID)
+    if _, err := svc.BankExport(ctx, "finance", run.RunID, fixed); !errors.Is(err, ErrRunState) {
+        t.Fatalf("draft run exported: %v", err)
+    }
+    closeRun(t, svc, run.RunID)
+
+    // every missing or malformed account is reported at once
+    _, _ = svc.employees.Update(ctx, "E-2", map[string]interface{}{"bank_account": map[string]interface{}{"account_number": "12345"}}, nil)
+    _, err := svc.BankExport(ctx, "finance", run.RunID, fixed)
+    var invalid *ExportValidationError
+    if !errors.As(err, &invalid) || len(invalid.Problems) != 2 {
+        t.Fatalf("expected two problems, got %v", err)
+    }
+
+    _, _ = svc.employees.Update(ctx, "E-1", map[string]interface{}{"bank_account": map[string]interface{}{"account_number": "1234-567-890", "account_name": "Juan Dela Cruz"}}, nil)
+    _, _ = svc.employees.Update(ctx, "E-2", map[string]interface{}{"bank_account": map[string]interface{}{"account_number": "0987654321"}}, nil)
+    f, err := svc.BankExport(ctx, "finance", run.RunID, fixed)
+    if err != nil {
+        t.Fatalf("export: %v", err)
+    }
+    slips, _ := svc.Payslips(ctx, run.RunID)
+    if len(slips) != 2 || slips[0].EmployeeID != "E-1" {
+        t.Fatalf("payslips: %+v", slips)
+    }
+    total := slips[0].Net.Add(slips[1].Net)
+    lines := strings.Split(strings.TrimSuffix(string(f.Content), "\r\n"), "\r\n")
+    if len(lines) != 4 || !strings.HasPrefix(lines[0], "H999000111206132025000") || !strings.HasPrefix(lines[1], "D1234567890") {
+        t.Fatalf("file:\n%s", f.Content)
+    }
+    cents := strings.Replace(total.String(), ".", "", 1)
+    if lines[3] != "T000002"+strings.Repeat("0", 15-len(cents))+cents {
+        t.Fatalf("trailer %q, total %s", lines[3], total)
+    }
+    sum := sha256.Sum256(f.Content)
+    if f.Export.Checksum != hex.EncodeToString(sum[:]) || f.Export.FileName != "PAY20250613.txt" || f.Export.Records != 2 || !f.Export.Total.Equal(total) {
+        t.Fatalf("export record: %+v", f.Export)
+    }
+    got, _ := svc.GetRun(ctx, run.RunID)
+    if len(got.Exports) != 1 || got.Exports[0].Checksum != f.Export.Checksum {
+        t.Fatalf("export not recorded: %+v", got.Exports)
+    }
+    entries, _ := audit.List(ctx, run.RunID)
+    exported := false
+    for _, e := range entries {
+        exported = exported || e.Action == "payroll_run.export" && e.Actor == "finance"
+    }
+    if !exported {
+        t.Fatalf("audit: %+v", entries)
+    }
+
+    // the run cannot be paid twice until the first file is voided
+    if _, err := svc.BankExport(ctx, "finance", run.RunID, csvLayout); !errors.Is(err, ErrAlreadyExported) {
+        t.Fatalf("expected ErrAlreadyExported, got %v", err)
+    }
+    if _, err := svc.VoidExport(ctx, "finance", run.RunID, f.Export.ExportID, ""); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("void without reason: %v", err)
+    }
+    if _, err := svc.VoidExport(ctx, "finance", run.RunID, f.Export.ExportID, "bank rejected the file"); err != nil {
+        t.Fatalf("void: %v", err)
+    }
+    f, err = svc.BankExport(ctx, "finance", run.RunID, csvLayout)
+    if err != nil {
+        t.Fatalf("csv export: %v", err)
+    }
+    // payslips in another currency are disbursed by their own file
+    usd := csvLayout
+    usd.Currency = "USD"
+    if _, err := svc.BankExport(ctx, "finance", run.RunID, usd); !errors.As(err, &invalid) || invalid.Problems[0] != "no USD payslips to disburse" {
+        t.Fatalf("expected only the USD export to be checked, got %v", err)
+    }
+    rows := strings.Split(strings.TrimSpace(string(f.Content)), "\n")
+    if len(rows) != 4 || rows[0] != "H,9990001112,Acme Inc.,2025-06-13,2" || rows[1] != "D,1234567890,Juan Dela Cruz,"+slips[0].Net.String()+",E-1" || rows[3] != "T,2,"+total.String() {
+        t.Fatalf("csv:\n%s", f.Content)
+    }
+
+    // of two exports racing on the same run only one is recorded
+    if _, err := svc.VoidExport(ctx, "finance", run.RunID, f.Export.ExportID, "wrong file"); err != nil {
+        t.Fatalf("void: %v", err)
+    }
+    svc.store = &racingRunStore{PayrollRunStore: svc.store, race: func() {
+        if _, err := svc.BankExport(ctx, "finance", run.RunID, csvLayout); err != nil {
+            t.Fatalf("first export: %v", err)
+        }
+    }}
+    if _, err := svc.BankExport(ctx, "finance", run.RunID, csvLayout); !errors.Is(err, ErrRunChanged) {
+        t.Fatalf("expected ErrRunChanged, got %v", err)
+    }
+    got, _ = svc.GetRun(ctx, run.RunID)
+    active := 0
+    for _, e := range got.Exports {
+        if e.VoidedAt == 0 {
+            active++
+        }
+    }
+    if active != 1 {
+        t.Fatalf("expected one active export, got %+v", got.Exports)
+    }
+}
+
+// racingRunStore runs race once, between a caller's read of a run and its
+// save, as a concurrent request would.
+type racingRunStore struct {
+    PayrollRunStore
+    race func()
+}
+
+func (s *racingRunStore) ListPayslips(ctx context.Context, runID string) ([]models.Payslip, error) {
+    if race := s.race; race != nil {
+        s.race = nil
+        race()
+    }
+    return s.PayrollRunStore.ListPayslips(ctx, runID)
+}
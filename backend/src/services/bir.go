@@ -0,0 +1,491 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    _ "embed"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+//go:embed templates/bir2316.tmpl
+var defaultCertificateTemplate string
+
+// ErrNoTaxTables is returned by the BIR reports when the withholding tables
+// could not be loaded.
+var ErrNoTaxTables = errors.New("withholding tax tables are not loaded")
+
+// BIREmployer is the withholding agent printed on the 2316 and the
+// alphalist.
+type BIREmployer struct {
+    Name    string
+    Address string
+    TIN     string // 9 digits, optionally followed by the branch code
+    Branch  string // 4-digit branch code; defaults to the TIN suffix or 0000
+    RDO     string // revenue district office code
+}
+
+// Certificate2316 is an employee's compensation and tax withheld for the
+// year from finalized payroll, as reported on BIR Form 2316 and the 1604-C
+// alphalist. Amounts from a previous employer are not tracked and stay zero.
+type Certificate2316 struct {
+    Year       int         `json:"year"`
+    EmployeeID string      `json:"employee_id"`
+    TIN        string      `json:"tin"`
+    LastName   string      `json:"last_name"`
+    FirstName  string      `json:"first_name"`
+    MiddleName string      `json:"middle_name,omitempty"`
+    BirthDate  string      `json:"birth_date,omitempty"`
+    From       string      `json:"from"`
+    To         string      `json:"to"`
+    Separated  bool        `json:"separated"` // left before 31 December
+    Employer   BIREmployer `json:"-"`
+    Currency   string      `json:"currency"`
+    Payslips   int         `json:"payslips"`
+
+    Gross                    money.Money `json:"gross"`
+    ExemptOtherBenefits      money.Money `json:"exempt_other_benefits"` // 13th month and other benefits up to the threshold
+    ExemptDeMinimis          money.Money `json:"exempt_de_minimis"`
+    Contributions            money.Money `json:"contributions"` // mandatory employee shares
+    OtherNonTaxable          money.Money `json:"other_non_taxable"`
+    TotalNonTaxable          money.Money `json:"total_non_taxable"`
+    TaxableBasic             money.Money `json:"taxable_basic"` // net of mandatory contributions
+    TaxableOvertime          money.Money `json:"taxable_overtime"`
+    TaxableOtherBenefits     money.Money `json:"taxable_other_benefits"`
+    OtherTaxable             money.Money `json:"other_taxable"`
+    TotalTaxable             money.Money `json:"total_taxable"`
+    PreviousEmployerTaxable  money.Money `json:"previous_employer_taxable"`
+    PreviousEmployerWithheld money.Money `json:"previous_employer_withheld"`
+    TaxDue                   money.Money `json:"tax_due"`
+    WithheldJanNov           money.Money `json:"withheld_jan_nov"`
+    WithheldDecember         money.Money `json:"withheld_december"` // includes the year-end adjustment
+    TaxWithheld              money.Money `json:"tax_withheld"`
+
+    // cross-checks for the reconciliation report
+    payslipGross money.Money
+    payslipTaxes money.Money
+    withoutTax   int
+}
+
+// BIRService builds the year-end BIR reports from finalized payroll runs.
+type BIRService struct {
+    runs     *PayrollRunService
+    tables   *TaxTables
+    employer BIREmployer
+    tmpl     *template.Template
+}
+
+// NewBIRService parses tmpl for the 2316 (the embedded default when empty).
+// tables may be nil, in which case every report fails with ErrNoTaxTables.
+func NewBIRService(runs *PayrollRunService, tables *TaxTables, employer BIREmployer, tmpl string) (*BIRService, error) {
+    if tmpl == "" {
+        tmpl = defaultCertificateTemplate
+    }
+    t, err := template.New("bir2316").Funcs(reportFuncs).Parse(tmpl)
+    if err != nil {
+        return nil, fmt.Errorf("2316 template: %w", err)
+    }
+    return &BIRService{runs: runs, tables: tables, employer: employer, tmpl: t}, nil
+}
+
+// Certificates computes the 2316 figures of every employee paid in year by
+// a finalized or paid run, ordered by last name.
+func (s *BIRService) Certificates(ctx context.Context, year int) ([]Certificate2316, error) {
+    if s.tables == nil {
+        return nil, ErrNoTaxTables
+    }
+    table, err := s.tables.For(fmt.Sprintf("%04d-12-31", year))
+    if err != nil {
+        return nil, err
+    }
+    runs, err := s.runs.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    prefix := fmt.Sprintf("%04d-", year)
+    byEmp := map[string]*Certificate2316{}
+    for _, r := range runs {
+        if (r.Status != models.RunFinalized && r.Status != models.RunPaid) || !strings.HasPrefix(r.PeriodEnd, prefix) {
+            continue
+        }
+        slips, err := s.runs.store.ListPayslips(ctx, r.RunID)
+        if err != nil {
+            return nil, err
+        }
+        for _, p := range slips {
+            // the BIR tables and forms are in pesos
+            if p.Currency != money.DefaultCurrency {
+                continue
+            }
+            c := byEmp[p.EmployeeID]
+            if c == nil {
+                c = newCertificate(year, p.EmployeeID, p.Currency)
+                byEmp[p.EmployeeID] = c
+            }
+            c.add(p)
+        }
+    }
+
+    out := make([]Certificate2316, 0, len(byEmp))
+    for _, c := range byEmp {
+        if err := s.finish(ctx, c, table); err != nil {
+            return nil, err
+        }
+        out = append(out, *c)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i].LastName+" "+out[i].FirstName, out[j].LastName+" "+out[j].FirstName
+        if a != b {
+            return a < b
+        }
+        return out[i].EmployeeID < out[j].EmployeeID
+    })
+    return out, nil
+}
+
+// Certificate returns one employee's 2316 figures, or mongo.ErrNoDocuments
+// when they were not paid in year.
+func (s *BIRService) Certificate(ctx context.Context, year int, employeeID string) (*Certificate2316, error) {
+    all, err := s.Certificates(ctx, year)
+    if err != nil {
+        return nil, err
+    }
+    for i := range all {
+        if all[i].EmployeeID == employeeID {
+            return &all[i], nil
+        }
+    }
+    return nil, mongo.ErrNoDocuments
+}
+
+// Render2316 prints the certificate as a PDF.
+func (s *BIRService) Render2316(c *Certificate2316) ([]byte, error) {
+    c.Employer = s.employer
+    return templatePDF(s.tmpl, c, fmt.Sprintf("BIR Form 2316 %d %s", c.Year, c.EmployeeID), "")
+}
+
+func newCertificate(year int, employeeID, cur string) *Certificate2316 {
+    z := money.Zero(cur)
+    return &Certificate2316{
+        Year: year, EmployeeID: employeeID, Currency: cur,
+        Gross: z, ExemptOtherBenefits: z, ExemptDeMinimis: z, Contributions: z, OtherNonTaxable: z, TotalNonTaxable: z,
+        TaxableBasic: z, TaxableOvertime: z, TaxableOtherBenefits: z, OtherTaxable: z, TotalTaxable: z,
+        PreviousEmployerTaxable: z, PreviousEmployerWithheld: z, TaxDue: z, WithheldJanNov: z, WithheldDecember: z, TaxWithheld: z,
+        payslipGross: z, payslipTaxes: z,
+    }
+}
+
+// add accumulates a payslip. The split between taxable and exempt pay comes
+// from the inputs the withholding rule recorded on the slip.
+func (c *Certificate2316) add(p models.Payslip) {
+    c.Payslips++
+    c.payslipGross = c.payslipGross.Add(p.Gross)
+    c.payslipTaxes = c.payslipTaxes.Add(p.Taxes)
+    input := func(l models.PayslipLine, key string) money.Money {
+        m, err := money.Parse(l.Inputs[key], p.Currency)
+        if err != nil {
+            return money.Zero(p.Currency)
+        }
+        return m
+    }
+    taxed := false
+    for _, l := range p.Lines {
+        switch {
+        case l.Kind == models.LineEarning:
+            c.Gross = c.Gross.Add(l.Amount)
+            if l.Taxable {
+                switch {
+                case thirteenthMonthCodes[l.Code]:
+                    c.TaxableBasic = c.TaxableBasic.Add(l.Amount)
+                case l.Code == "overtime":
+                    c.TaxableOvertime = c.TaxableOvertime.Add(l.Amount)
+                default:
+                    c.OtherTaxable = c.OtherTaxable.Add(l.Amount)
+                }
+            }
+        case l.Code == "withholding_tax":
+            taxed = true
+            contributions, other, taxableOther := input(l, "contributions"), input(l, "other_benefits"), input(l, "taxable_other_benefits")
+            c.Contributions = c.Contributions.Add(contributions)
+            c.TaxableBasic = c.TaxableBasic.Sub(contributions)
+            c.TaxableOtherBenefits = c.TaxableOtherBenefits.Add(taxableOther)
+            c.ExemptOtherBenefits = c.ExemptOtherBenefits.Add(other.Sub(taxableOther))
+            c.ExemptDeMinimis = c.ExemptDeMinimis.Add(input(l, "exempt_de_minimis"))
+            c.TotalTaxable = c.TotalTaxable.Add(input(l, "taxable_compensation"))
+            c.TaxWithheld = c.TaxWithheld.Add(l.Amount)
+            if p.PeriodEnd < fmt.Sprintf("%04d-12-01", c.Year) {
+                c.WithheldJanNov = c.WithheldJanNov.Add(l.Amount)
+            } else {
+                c.WithheldDecember = c.WithheldDecember.Add(l.Amount)
+            }
+        }
+    }
+    if !taxed {
+        c.withoutTax++
+    }
+}
+
+// finish fills in the employee details, the exempt remainder and the
+// annual tax due.
+func (s *BIRService) finish(ctx context.Context, c *Certificate2316, table *TaxTable) error {
+    c.TotalNonTaxable = c.Gross.Sub(c.TotalTaxable)
+    c.OtherNonTaxable = c.TotalNonTaxable.Sub(c.ExemptOtherBenefits).Sub(c.ExemptDeMinimis).Sub(c.Contributions)
+    due, err := table.Tax(TaxPeriodAnnual, c.TotalTaxable.Add(c.PreviousEmployerTaxable))
+    if err != nil {
+        return err
+    }
+    c.TaxDue = due
+
+    c.From, c.To = fmt.Sprintf("%04d-01-01", c.Year), fmt.Sprintf("%04d-12-31", c.Year)
+    emp, err := s.runs.employees.Get(ctx, c.EmployeeID)
+    if err != nil {
+        // payslips outlive deleted employee records; report them by id
+        c.LastName = c.EmployeeID
+        return nil
+    }
+    c.TIN, _ = emp["tin"].(string)
+    c.BirthDate, _ = emp["birth_date"].(string)
+    if legal, ok := emp["legal_name"].(map[string]interface{}); ok {
+        c.FirstName, _ = legal["first"].(string)
+        c.MiddleName, _ = legal["middle"].(string)
+        c.LastName, _ = legal["last"].(string)
+    }
+    if c.LastName == "" {
+        c.LastName = employeeName(emp)
+    }
+    if d, _ := emp["hire_date"].(string); d > c.From && d <= c.To {
+        c.From = d
+    }
+    if d, _ := emp["termination_date"].(string); d != "" && d >= c.From && d < c.To {
+        c.To, c.Separated = d, true
+    }
+    return nil
+}
+
+// Alphalist writes the 1604-C alphalist of employees for year. format is
+// "dat" for the BIR Alphalist Data Entry layout (H header, one D line per
+// employee, C control totals per schedule) or "csv" for a spreadsheet with
+// the same columns. Schedule 1 lists employees separated before 31
+// December, schedule 2 those employed at year end. Every employee and the
+// employer need a TIN; all missing ones are reported together.
+func (s *BIRService) Alphalist(ctx context.Context, year int, format string) (content []byte, fileName string, err error) {
+    if format != "dat" && format != "csv" {
+        return nil, "", fmt.Errorf("%w: format must be dat or csv", ErrInvalidPayrollRequest)
+    }
+    certs, err := s.Certificates(ctx, year)
+    if err != nil {
+        return nil, "", err
+    }
+    var problems []string
+    tin, branch, ok := splitTIN(s.employer.TIN, s.employer.Branch)
+    if !ok {
+        problems = append(problems, "employer TIN is missing or invalid")
+    }
+    empTIN := map[string][2]string{}
+    for _, c := range certs {
+        t, b, ok := splitTIN(c.TIN, "")
+        if !ok {
+            problems = append(problems, fmt.Sprintf("%s: TIN is missing or invalid", c.EmployeeID))
+        }
+        empTIN[c.EmployeeID] = [2]string{t, b}
+    }
+    if len(certs) == 0 {
+        problems = append(problems, fmt.Sprintf("no finalized payroll in %d", year))
+    }
+    if len(problems) > 0 {
+        return nil, "", &ExportValidationError{Problems: problems}
+    }
+
+    asOf := fmt.Sprintf("12/31/%04d", year)
+    amounts := func(c Certificate2316) []string {
+        var out []string
+        for _, m := range []money.Money{c.Gross, c.ExemptOtherBenefits, c.ExemptDeMinimis, c.Contributions, c.OtherNonTaxable, c.TotalNonTaxable,
+            c.TaxableBasic, c.TaxableOtherBenefits, c.OtherTaxable.Add(c.TaxableOvertime), c.TotalTaxable, c.TaxDue,
+            c.WithheldJanNov, c.WithheldDecember, c.TaxWithheld, c.TaxDue.Sub(c.TaxWithheld)} {
+            out = append(out, m.Round(money.HalfEven).String())
+        }
+        return out
+    }
+    var records [][]string
+    if format == "csv" {
+        records = append(records, []string{"SCHEDULE", "SEQ", "TIN", "BRANCH", "LAST NAME", "FIRST NAME", "MIDDLE NAME", "EMPLOYEE ID", "FROM", "TO",
+            "GROSS COMPENSATION", "EXEMPT 13TH MONTH AND OTHER BENEFITS", "DE MINIMIS", "CONTRIBUTIONS", "OTHER NON-TAXABLE", "TOTAL NON-TAXABLE",
+            "TAXABLE BASIC SALARY", "TAXABLE 13TH MONTH AND OTHER BENEFITS", "OTHER TAXABLE", "TOTAL TAXABLE", "TAX DUE",
+            "WITHHELD JAN-NOV", "WITHHELD DECEMBER", "TOTAL WITHHELD", "UNDER (OVER) WITHHELD"})
+    } else {
+        records = append(records, []string{"H1604C", tin, branch, asOf, strings.ToUpper(s.employer.Name), s.employer.RDO})
+    }
+    for _, schedule := range []string{"1", "2"} {
+        seq := 0
+        totals := newCertificate(year, "", money.DefaultCurrency)
+        for _, c := range certs {
+            if (schedule == "1") != c.Separated {
+                continue
+            }
+            seq++
+            t := empTIN[c.EmployeeID]
+            row := []string{strconv.Itoa(seq), t[0], t[1], strings.ToUpper(c.LastName), strings.ToUpper(c.FirstName), strings.ToUpper(c.MiddleName)}
+            if format == "csv" {
+                row = append(append([]string{schedule}, row...), c.EmployeeID, c.From, c.To)
+            } else {
+                row = append(append([]string{"D" + schedule, "1604C", tin, branch, asOf}, row...), usDate(c.From), usDate(c.To))
+            }
+            records = append(records, append(row, amounts(c)...))
+            totals.Gross, totals.ExemptOtherBenefits, totals.ExemptDeMinimis = totals.Gross.Add(c.Gross), totals.ExemptOtherBenefits.Add(c.ExemptOtherBenefits), totals.ExemptDeMinimis.Add(c.ExemptDeMinimis)
+            totals.Contributions, totals.OtherNonTaxable, totals.TotalNonTaxable = totals.Contributions.Add(c.Contributions), totals.OtherNonTaxable.Add(c.OtherNonTaxable), totals.TotalNonTaxable.Add(c.TotalNonTaxable)
+            totals.TaxableBasic, totals.TaxableOtherBenefits = totals.TaxableBasic.Add(c.TaxableBasic), totals.TaxableOtherBenefits.Add(c.TaxableOtherBenefits)
+            totals.OtherTaxable, totals.TotalTaxable, totals.TaxDue = totals.OtherTaxable.Add(c.OtherTaxable).Add(c.TaxableOvertime), totals.TotalTaxable.Add(c.TotalTaxable), totals.TaxDue.Add(c.TaxDue)
+            totals.WithheldJanNov, totals.WithheldDecember, totals.TaxWithheld = totals.WithheldJanNov.Add(c.WithheldJanNov), totals.WithheldDecember.Add(c.WithheldDecember), totals.TaxWithheld.Add(c.TaxWithheld)
+        }
+        if format == "dat" && seq > 0 {
+            records = append(records, append([]string{"C" + schedule, "1604C", tin, branch, asOf}, amounts(*totals)...))
+        }
+    }
+
+    var b bytes.Buffer
+    w := csv.NewWriter(&b)
+    w.UseCRLF = true
+    if err := w.WriteAll(records); err != nil {
+        return nil, "", err
+    }
+    if format == "csv" {
+        return b.Bytes(), fmt.Sprintf("alphalist-1604C-%04d.csv", year), nil
+    }
+    return b.Bytes(), fmt.Sprintf("%s%s1231%04d1604C.DAT", tin, branch, year), nil
+}
+
+// TaxReconciliationItem is one employee's year-end check.
+type TaxReconciliationItem struct {
+    EmployeeID   string      `json:"employee_id"`
+    Name         string      `json:"name"`
+    Payslips     int         `json:"payslips"`
+    Gross        money.Money `json:"gross"`         // sum of earning lines
+    PayslipGross money.Money `json:"payslip_gross"` // sum of payslip gross totals
+    TotalTaxable money.Money `json:"total_taxable"`
+    TaxDue       money.Money `json:"tax_due"`
+    TaxWithheld  money.Money `json:"tax_withheld"` // sum of withholding lines
+    PayslipTaxes money.Money `json:"payslip_taxes"`
+    Difference   money.Money `json:"difference"` // tax due − withheld; negative is over-withheld
+    Issues       []string    `json:"issues,omitempty"`
+}
+
+// TaxReconciliation compares the 2316 figures with the payroll they come
+// from and with the annual tax due.
+type TaxReconciliation struct {
+    Year          int                     `json:"year"`
+    Employees     int                     `json:"employees"`
+    Flagged       int                     `json:"flagged"`
+    Gross         money.Money             `json:"gross"`
+    TaxDue        money.Money             `json:"tax_due"`
+    TaxWithheld   money.Money             `json:"tax_withheld"`
+    RegisterGross money.Money             `json:"register_gross"` // from the run totals
+    RegisterTaxes money.Money             `json:"register_taxes"`
+    Issues        []string                `json:"issues,omitempty"`
+    Items         []TaxReconciliationItem `json:"items"`
+}
+
+// Reconcile flags employees whose tax withheld differs from the annual tax
+// due (typically separated employees without a final pay run), whose
+// payslip totals do not add up to their lines, who were paid without a
+// withholding computation or have no TIN. The certificate totals are also
+// checked against the totals of the runs themselves.
+func (s *BIRService) Reconcile(ctx context.Context, year int) (*TaxReconciliation, error) {
+    certs, err := s.Certificates(ctx, year)
+    if err != nil {
+        return nil, err
+    }
+    z := money.Zero(money.DefaultCurrency)
+    rec := &TaxReconciliation{Year: year, Employees: len(certs), Gross: z, TaxDue: z, TaxWithheld: z, RegisterGross: z, RegisterTaxes: z, Items: []TaxReconciliationItem{}}
+    for _, c := range certs {
+        it := TaxReconciliationItem{
+            EmployeeID: c.EmployeeID, Name: strings.TrimSpace(c.LastName + ", " + c.FirstName), Payslips: c.Payslips,
+            Gross: c.Gross, PayslipGross: c.payslipGross, TotalTaxable: c.TotalTaxable, TaxDue: c.TaxDue,
+            TaxWithheld: c.TaxWithheld, PayslipTaxes: c.payslipTaxes, Difference: c.TaxDue.Sub(c.TaxWithheld),
+        }
+        if !it.Difference.IsZero() {
+            it.Issues = append(it.Issues, fmt.Sprintf("tax withheld %s differs from annual tax due %s", c.TaxWithheld, c.TaxDue))
+        }
+        if !c.Gross.Equal(c.payslipGross) {
+            it.Issues = append(it.Issues, fmt.Sprintf("payslip gross %s differs from earnings %s", c.payslipGross, c.Gross))
+        }
+        if !c.TaxWithheld.Equal(c.payslipTaxes) {
+            it.Issues = append(it.Issues, fmt.Sprintf("payslip taxes %s differ from withholding lines %s", c.payslipTaxes, c.TaxWithheld))
+        }
+        if c.withoutTax > 0 {
+            it.Issues = append(it.Issues, fmt.Sprintf("%d payslips without a withholding tax computation", c.withoutTax))
+        }
+        if c.TotalTaxable.Sign() < 0 {
+            it.Issues = append(it.Issues, "negative taxable compensation")
+        }
+        if _, _, ok := splitTIN(c.TIN, ""); !ok {
+            it.Issues = append(it.Issues, "no valid TIN")
+        }
+        if len(it.Issues) > 0 {
+            rec.Flagged++
+        }
+        rec.Gross = rec.Gross.Add(c.Gross)
+        rec.TaxDue = rec.TaxDue.Add(c.TaxDue)
+        rec.TaxWithheld = rec.TaxWithheld.Add(c.TaxWithheld)
+        rec.Items = append(rec.Items, it)
+    }
+
+    runs, err := s.runs.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    prefix := fmt.Sprintf("%04d-", year)
+    for _, r := range runs {
+        if (r.Status != models.RunFinalized && r.Status != models.RunPaid) || !strings.HasPrefix(r.PeriodEnd, prefix) {
+            continue
+        }
+        for _, t := range r.Totals {
+            if t.Currency == money.DefaultCurrency {
+                rec.RegisterGross = rec.RegisterGross.Add(t.Gross)
+                rec.RegisterTaxes = rec.RegisterTaxes.Add(t.Taxes)
+            }
+        }
+    }
+    if !rec.RegisterGross.Equal(rec.Gross) {
+        rec.Issues = append(rec.Issues, fmt.Sprintf("run totals gross %s differs from certificates %s", rec.RegisterGross, rec.Gross))
+    }
+    if !rec.RegisterTaxes.Equal(rec.TaxWithheld) {
+        rec.Issues = append(rec.Issues, fmt.Sprintf("run totals taxes %s differ from tax withheld %s", rec.RegisterTaxes, rec.TaxWithheld))
+    }
+    return rec, nil
+}
+
+// splitTIN splits a TIN into its 9 digits and 4-digit branch code; branch
+// overrides a branch code in the TIN and defaults to 0000.
+func splitTIN(raw, branch string) (string, string, bool) {
+    n, ok := govNumber(raw)
+    if !ok || (len(n) != 9 && len(n) != 12 && len(n) != 13) {
+        return "", "", false
+    }
+    b := "0000"
+    if len(n) > 9 {
+        b = fmt.Sprintf("%04s", n[9:])
+    }
+    if branch != "" {
+        b = branch
+    }
+    return n[:9], b, true
+}
+
+// usDate turns YYYY-MM-DD into MM/DD/YYYY.
+func usDate(d string) string {
+    t, err := time.Parse("2006-01-02", d)
+    if err != nil {
+        return d
+    }
+    return t.Format("01/02/2006")
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+)
+
+func TestBIRService_YearEnd(t *testing.T) {
+    ctx := context.Background()
+    runs, _ := newRunTestService(t)
+    for month := 1; month <= 12; month++ {
+        last := []int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}[month-1]
+        for _, span := range [][2]int{{1, 15}, {16, last}} {
+            p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: fmt.Sprintf("2025-%02d-%02d", month, span[0]), End: fmt.Sprintf("2025-%02d-%02d", month, span[1])})
+            run, err := runs.CreateRun(ctx, "clerk", p.PeriodID)
+            if err != nil {
+                t.Fatalf("run: %v", err)
+            }
+            closeRun(t, runs, run.RunID)
+        }
+    }
+    _, _ = runs.employees.Update(ctx, "E-1", map[string]interface{}{"tin": "123-456-789", "legal_name": map[string]interface{}{"first": "Juan", "last": "Dela Cruz"}}, nil)
+    _, _ = runs.employees.Update(ctx, "E-2", map[string]interface{}{"legal_name": map[string]interface{}{"first": "Maria", "last": "Santos"}}, nil)
+    _, _ = runs.employees.Update(ctx, "E-3", map[string]interface{}{"tin": "987-654-321-000", "legal_name": map[string]interface{}{"first": "Pedro", "last": "Reyes"}}, nil)
+
+    tables, _ := DefaultTaxTables()
+    svc, err := NewBIRService(runs, tables, BIREmployer{Name: "Acme Inc.", TIN: "000-111-222"}, "")
+    if err != nil {
+        t.Fatalf("service: %v", err)
+    }
+    c, err := svc.Certificate(ctx, 2025, "E-1")
+    if err != nil {
+        t.Fatalf("certificate: %v", err)
+    }
+    // 360,000 taxable: 15% of the excess over 250,000, all withheld by the December annualization
+    if c.Gross.String() != "360000.00" || c.TotalTaxable.String() != "360000.00" || c.TaxDue.String() != "16500.00" || !c.TaxWithheld.Equal(c.TaxDue) ||
+        !c.WithheldJanNov.Add(c.WithheldDecember).Equal(c.TaxWithheld) || c.Separated || c.From != "2025-01-01" {
+        t.Fatalf("E-1: %+v", c)
+    }
+    // E-3 left in May without a final pay run, so the periodic tax was never trued up
+    e3, _ := svc.Certificate(ctx, 2025, "E-3")
+    if !e3.Separated || e3.To != "2025-05-31" || !e3.TaxDue.IsZero() || e3.TaxWithheld.Sign() <= 0 {
+        t.Fatalf("E-3: %+v", e3)
+    }
+    if _, err := svc.Certificate(ctx, 2025, "E-4"); err == nil {
+        t.Fatalf("E-4 was never paid")
+    }
+
+    doc, err := svc.Render2316(c)
+    if err != nil || !bytes.HasPrefix(doc, []byte("%PDF-")) || !bytes.Contains(doc, []byte("360,000.00")) || !bytes.Contains(doc, []byte("16,500.00")) {
+        t.Fatalf("2316: %v", err)
+    }
+
+    rec, err := svc.Reconcile(ctx, 2025)
+    if err != nil {
+        t.Fatalf("reconcile: %v", err)
+    }
+    if rec.Employees != 3 || rec.Flagged != 2 || len(rec.Issues) != 0 || !rec.RegisterGross.Equal(rec.Gross) {
+        t.Fatalf("reconciliation: %+v", rec)
+    }
+    for _, it := range rec.Items {
+        flagged := strings.Join(it.Issues, "; ")
+        switch it.EmployeeID {
+        case "E-1":
+            if flagged != "" {
+                t.Fatalf("E-1 flagged: %s", flagged)
+            }
+        case "E-2":
+            if flagged != "no valid TIN" {
+                t.Fatalf("E-2: %s", flagged)
+            }
+        case "E-3":
+            if !strings.Contains(flagged, "differs from annual tax due") || it.Difference.Sign() >= 0 {
+                t.Fatalf("E-3: %+v", it)
+            }
+        }
+    }
+
+    _, _, err = svc.Alphalist(ctx, 2025, "dat")
+    var invalid *ExportValidationError
+    if !errors.As(err, &invalid) || len(invalid.Problems) != 1 || !strings.HasPrefix(invalid.Problems[0], "E-2") {
+        t.Fatalf("expected missing TIN for E-2, got %v", err)
+    }
+    _, _ = runs.employees.Update(ctx, "E-2", map[string]interface{}{"tin": "111222333"}, nil)
+    dat, name, err := svc.Alphalist(ctx, 2025, "dat")
+    if err != nil || name != "0001112220000123120251604C.DAT" {
+        t.Fatalf("alphalist: %v %s", err, name)
+    }
+    lines := strings.Split(strings.TrimSuffix(string(dat), "\r\n"), "\r\n")
+    // header, E-3 and its control line, E-1, E-2 and their control line
+    if len(lines) != 6 || !strings.HasPrefix(lines[0], "H1604C,000111222,0000,12/31/2025,ACME INC.") ||
+        !strings.HasPrefix(lines[1], "D1,1604C,000111222,0000,12/31/2025,1,987654321,0000,REYES,PEDRO,,01/01/2025,05/31/2025,") ||
+        !strings.HasPrefix(lines[3], "D2,1604C,000111222,0000,12/31/2025,1,123456789,0000,DELA CRUZ,JUAN,,01/01/2025,12/31/2025,360000.00,") ||
+        !strings.HasPrefix(lines[5], "C2,1604C,000111222,0000,12/31/2025,600000.00,") {
+        t.Fatalf("dat:\n%s", dat)
+    }
+    csvOut, name, err := svc.Alphalist(ctx, 2025, "csv")
+    if err != nil || name != "alphalist-1604C-2025.csv" || len(strings.Split(strings.TrimSpace(string(csvOut)), "\n")) != 4 {
+        t.Fatalf("csv: %v\n%s", err, csvOut)
+    }
+    if _, _, err := svc.Alphalist(ctx, 2025, "xls"); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("format: %v", err)
+    }
+}
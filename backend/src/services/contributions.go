@@ -0,0 +1,431 @@
+package services
+
+import (
+    "embed"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "sort"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// statutoryFS holds the published contribution tables shipped with the
+// server. HRIS_CONTRIBUTION_TABLES_DIR can point at a newer set.
+//
+//go:embed statutory/*.json
+var statutoryFS embed.FS
+
+// How a monthly contribution is spread over semi-monthly payrolls.
+const (
+    SplitEven   = "split"  // half on each cut-off
+    SplitFirst  = "first"  // all on the 1st-15th payroll
+    SplitSecond = "second" // all on the 16th-end payroll
+)
+
+// SSSBracket maps a compensation range to its monthly salary credit and the
+// published employee, employer and EC amounts. Max is nil on the top bracket.
+type SSSBracket struct {
+    Min money.Money  `json:"min"`
+    Max *money.Money `json:"max,omitempty"`
+    MSC money.Money  `json:"msc"`
+    EE  money.Money  `json:"ee"`
+    ER  money.Money  `json:"er"`
+    EC  money.Money  `json:"ec"`
+}
+
+// SSSTable is one version of the SSS contribution schedule.
+type SSSTable struct {
+    EffectiveDate string       `json:"effective_date"`
+    Source        string       `json:"source"`
+    Brackets      []SSSBracket `json:"brackets"`
+}
+
+// PhilHealthTable is one version of the PhilHealth premium schedule: rate ×
+// monthly basic salary clamped to [Floor, Ceiling], shared with the employer.
+type PhilHealthTable struct {
+    EffectiveDate string      `json:"effective_date"`
+    Source        string      `json:"source"`
+    Rate          string      `json:"rate"`
+    Floor         money.Money `json:"floor"`
+    Ceiling       money.Money `json:"ceiling"`
+    EmployeeShare string      `json:"employee_share"`
+}
+
+// PagIBIGTier sets rates for compensation up to Max (nil: no upper bound).
+type PagIBIGTier struct {
+    Max    *money.Money `json:"max,omitempty"`
+    EERate string       `json:"ee_rate"`
+    ERRate string       `json:"er_rate"`
+}
+
+// PagIBIGTable is one version of the HDMF schedule; rates apply to the
+// compensation capped at MaxFundSalary.
+type PagIBIGTable struct {
+    EffectiveDate string        `json:"effective_date"`
+    Source        string        `json:"source"`
+    MaxFundSalary money.Money   `json:"max_fund_salary"`
+    Tiers         []PagIBIGTier `json:"tiers"`
+}
+
+// ContributionTables holds every version of the three schedules, oldest first.
+type ContributionTables struct {
+    SSS        []SSSTable
+    PhilHealth []PhilHealthTable
+    PagIBIG    []PagIBIGTable
+}
+
+// DefaultContributionTables loads the tables embedded in the binary.
+func DefaultContributionTables() (*ContributionTables, error) {
+    sub, err := fs.Sub(statutoryFS, "statutory")
+    if err != nil {
+        return nil, err
+    }
+    return LoadContributionTables(sub)
+}
+
+// LoadContributionTables reads sss.json, philhealth.json and pagibig.json
+// from fsys.
+func LoadContributionTables(fsys fs.FS) (*ContributionTables, error) {
+    t := &ContributionTables{}
+    if err := readVersions(fsys, "sss.json", &t.SSS); err != nil {
+        return nil, err
+    }
+    if err := readVersions(fsys, "philhealth.json", &t.PhilHealth); err != nil {
+        return nil, err
+    }
+    if err := readVersions(fsys, "pagibig.json", &t.PagIBIG); err != nil {
+        return nil, err
+    }
+    sort.Slice(t.SSS, func(i, j int) bool { return t.SSS[i].EffectiveDate < t.SSS[j].EffectiveDate })
+    sort.Slice(t.PhilHealth, func(i, j int) bool { return t.PhilHealth[i].EffectiveDate < t.PhilHealth[j].EffectiveDate })
+    sort.Slice(t.PagIBIG, func(i, j int) bool { return t.PagIBIG[i].EffectiveDate < t.PagIBIG[j].EffectiveDate })
+    for _, v := range t.SSS {
+        if len(v.Brackets) == 0 {
+            return nil, fmt.Errorf("sss.json %s: no brackets", v.EffectiveDate)
+        }
+        for i := 1; i < len(v.Brackets); i++ {
+            if !v.Brackets[i-1].Min.LessThan(v.Brackets[i].Min) {
+                return nil, fmt.Errorf("sss.json %s: brackets not ascending at %s", v.EffectiveDate, v.Brackets[i].Min)
+            }
+        }
+    }
+    for _, v := range t.PagIBIG {
+        if len(v.Tiers) == 0 {
+            return nil, fmt.Errorf("pagibig.json %s: no tiers", v.EffectiveDate)
+        }
+    }
+    t.labelPesos()
+    return t, nil
+}
+
+// labelPesos marks the decoded amounts as pesos; JSON carries only the
+// number and the schedules are published in PHP.
+func (t *ContributionTables) labelPesos() {
+    php := func(m money.Money) money.Money { return m.WithCurrency("PHP") }
+    phpPtr := func(m *money.Money) *money.Money {
+        if m == nil {
+            return nil
+        }
+        v := php(*m)
+        return &v
+    }
+    for i := range t.SSS {
+        for j := range t.SSS[i].Brackets {
+            b := &t.SSS[i].Brackets[j]
+            b.Min, b.Max, b.MSC, b.EE, b.ER, b.EC = php(b.Min), phpPtr(b.Max), php(b.MSC), php(b.EE), php(b.ER), php(b.EC)
+        }
+    }
+    for i := range t.PhilHealth {
+        t.PhilHealth[i].Floor, t.PhilHealth[i].Ceiling = php(t.PhilHealth[i].Floor), php(t.PhilHealth[i].Ceiling)
+    }
+    for i := range t.PagIBIG {
+        t.PagIBIG[i].MaxFundSalary = php(t.PagIBIG[i].MaxFundSalary)
+        for j := range t.PagIBIG[i].Tiers {
+            t.PagIBIG[i].Tiers[j].Max = phpPtr(t.PagIBIG[i].Tiers[j].Max)
+        }
+    }
+}
+
+func readVersions(fsys fs.FS, name string, out interface{}) error {
+    b, err := fs.ReadFile(fsys, name)
+    if err != nil {
+        return err
+    }
+    var doc struct {
+        Versions json.RawMessage `json:"versions"`
+    }
+    if err := json.Unmarshal(b, &doc); err != nil {
+        return fmt.Errorf("%s: %w", name, err)
+    }
+    if err := json.Unmarshal(doc.Versions, out); err != nil {
+        return fmt.Errorf("%s: %w", name, err)
+    }
+    return nil
+}
+
+// ErrNoContributionTable is returned when no table version covers a date.
+var ErrNoContributionTable = errors.New("no contribution table in effect")
+
+// SSSFor returns the SSS table in effect on date (YYYY-MM-DD).
+func (t *ContributionTables) SSSFor(date string) (*SSSTable, error) {
+    for i := len(t.SSS) - 1; i >= 0; i-- {
+        if t.SSS[i].EffectiveDate <= date {
+            return &t.SSS[i], nil
+        }
+    }
+    return nil, fmt.Errorf("%w: sss on %s", ErrNoContributionTable, date)
+}
+
+// PhilHealthFor returns the PhilHealth table in effect on date.
+func (t *ContributionTables) PhilHealthFor(date string) (*PhilHealthTable, error) {
+    for i := len(t.PhilHealth) - 1; i >= 0; i-- {
+        if t.PhilHealth[i].EffectiveDate <= date {
+            return &t.PhilHealth[i], nil
+        }
+    }
+    return nil, fmt.Errorf("%w: philhealth on %s", ErrNoContributionTable, date)
+}
+
+// PagIBIGFor returns the Pag-IBIG table in effect on date.
+func (t *ContributionTables) PagIBIGFor(date string) (*PagIBIGTable, error) {
+    for i := len(t.PagIBIG) - 1; i >= 0; i-- {
+        if t.PagIBIG[i].EffectiveDate <= date {
+            return &t.PagIBIG[i], nil
+        }
+    }
+    return nil, fmt.Errorf("%w: pagibig on %s", ErrNoContributionTable, date)
+}
+
+// Lookup returns the bracket for a monthly compensation.
+func (t *SSSTable) Lookup(comp money.Money) SSSBracket {
+    b := t.Brackets[0]
+    for _, br := range t.Brackets {
+        if comp.LessThan(br.Min) {
+            break
+        }
+        b = br
+    }
+    return b
+}
+
+// Shares returns the monthly employee and employer premiums for basic salary.
+func (t *PhilHealthTable) Shares(basic money.Money) (base, ee, er money.Money, err error) {
+    base = basic.Max(t.Floor.WithCurrency(basic.Currency())).Min(t.Ceiling.WithCurrency(basic.Currency()))
+    premium, err := base.MulRate(t.Rate, money.HalfEven)
+    if err != nil {
+        return base, ee, er, err
+    }
+    premium = premium.Round(money.HalfEven)
+    ee, err = premium.MulRate(t.EmployeeShare, money.HalfEven)
+    if err != nil {
+        return base, ee, er, err
+    }
+    ee = ee.Round(money.HalfEven)
+    return base, ee, premium.Sub(ee), nil
+}
+
+// Contributions returns the monthly employee and employer savings for comp.
+func (t *PagIBIGTable) Contributions(comp money.Money) (base money.Money, tier PagIBIGTier, ee, er money.Money, err error) {
+    tier = t.Tiers[len(t.Tiers)-1]
+    for _, tr := range t.Tiers {
+        if tr.Max == nil || !tr.Max.WithCurrency(comp.Currency()).LessThan(comp) {
+            tier = tr
+            break
+        }
+    }
+    base = comp.Min(t.MaxFundSalary.WithCurrency(comp.Currency()))
+    if ee, err = base.MulRate(tier.EERate, money.HalfEven); err != nil {
+        return
+    }
+    if er, err = base.MulRate(tier.ERRate, money.HalfEven); err != nil {
+        return
+    }
+    return base, tier, ee.Round(money.HalfEven), er.Round(money.HalfEven), nil
+}
+
+// periodShare returns the part of a monthly amount that falls on this payroll
+// and a description of the split for the payslip formula. Weekly and daily
+// payrolls deduct the whole month on the last payroll ending in it.
+func periodShare(pc *PayrollContext, monthly money.Money, split string) (money.Money, string) {
+    end, _ := time.Parse("2006-01-02", pc.Request.PeriodEnd)
+    switch pc.Request.Frequency {
+    case FrequencyMonthly:
+        return monthly, "monthly"
+    case FrequencyWeekly, FrequencyDaily:
+        days := 7
+        if pc.Request.Frequency == FrequencyDaily {
+            days = 1
+        }
+        if end.AddDate(0, 0, days).Month() != end.Month() {
+            return monthly, "full month on the last payroll of the month"
+        }
+        return money.Zero(monthly.Currency()), "full month on the last payroll of the month"
+    }
+    firstHalf := end.Day() <= 15
+    switch split {
+    case SplitFirst:
+        if firstHalf {
+            return monthly, "full month on first cut-off"
+        }
+        return money.Zero(monthly.Currency()), "full month on first cut-off"
+    case SplitSecond:
+        if firstHalf {
+            return money.Zero(monthly.Currency()), "full month on second cut-off"
+        }
+        return monthly, "full month on second cut-off"
+    }
+    // the second half takes the odd centavo so both halves add up to the month
+    half := monthly.Div(2, money.HalfEven).Round(money.HalfUp)
+    if firstHalf {
+        return half, "half of monthly on each cut-off"
+    }
+    return monthly.Sub(half), "half of monthly on each cut-off"
+}
+
+// ContributionRules returns the SSS, PhilHealth and Pag-IBIG rules sharing
+// one set of tables and semi-monthly split.
+func ContributionRules(tables *ContributionTables, split string) []PayrollRule {
+    return []PayrollRule{SSSRule{Tables: tables, Split: split}, PhilHealthRule{Tables: tables, Split: split}, PagIBIGRule{Tables: tables, Split: split}}
+}
+
+// ExpectedContributions returns the employee-share line codes the configured
+// contribution rules deduct on a regular peso payslip of frequency ending
+// periodEnd, following each rule's semi-monthly split (see periodShare).
+func (s *PayrollService) ExpectedContributions(frequency, periodEnd string) map[string]bool {
+    if frequency == "" {
+        frequency = FrequencySemiMonthly
+    }
+    pc := &PayrollContext{Request: PayrollRequest{PeriodEnd: periodEnd, Frequency: frequency}}
+    out := map[string]bool{}
+    for _, r := range s.rules {
+        var code, split string
+        switch r := r.(type) {
+        case SSSRule:
+            code, split = "sss_ee", r.Split
+        case PhilHealthRule:
+            code, split = "philhealth_ee", r.Split
+        case PagIBIGRule:
+            code, split = "pagibig_ee", r.Split
+        default:
+            continue
+        }
+        if amt, _ := periodShare(pc, money.MustParse("1", "PHP"), split); !amt.IsZero() {
+            out[code] = true
+        }
+    }
+    return out
+}
+
+// contributionLines builds the employee (deducted) and employer lines of a
+// scheme, dropping zero amounts.
+func contributionLines(pc *PayrollContext, split string, lines []models.PayslipLine) []models.PayslipLine {
+    out := lines[:0]
+    for _, l := range lines {
+        monthly := l.Amount
+        amt, how := periodShare(pc, monthly, split)
+        if amt.IsZero() {
+            continue
+        }
+        l.Amount = amt
+        l.Inputs["monthly_amount"] = monthly.String()
+        l.Inputs["split"] = how
+        out = append(out, l)
+    }
+    return out
+}
+
+// SSSRule deducts the SSS employee share and records the employer share and
+// EC from the bracket of the monthly salary.
+type SSSRule struct {
+    Tables *ContributionTables
+    Split  string
+}
+
+func (SSSRule) Name() string { return "sss" }
+
+func (r SSSRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    // the tables are in pesos; other payroll currencies are not covered here
+    if pc.Request.OffCycle || pc.Currency != "PHP" {
+        return nil, nil
+    }
+    t, err := r.Tables.SSSFor(pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    comp := pc.MonthlyRate()
+    b := t.Lookup(comp)
+    in := func() map[string]string {
+        return map[string]string{"monthly_compensation": comp.String(), "msc": b.MSC.String(), "table": t.EffectiveDate}
+    }
+    return contributionLines(pc, r.Split, []models.PayslipLine{
+        {Code: "sss_ee", Label: "SSS contribution", Kind: models.LineContribution, Amount: b.EE, Inputs: in(), Formula: "SSS table employee share for msc"},
+        {Code: "sss_er", Label: "SSS employer share", Kind: models.LineEmployer, Amount: b.ER, Inputs: in(), Formula: "SSS table employer share for msc"},
+        {Code: "sss_ec", Label: "SSS employees' compensation", Kind: models.LineEmployer, Amount: b.EC, Inputs: in(), Formula: "SSS table EC for msc"},
+    }), nil
+}
+
+// PhilHealthRule deducts the PhilHealth employee share.
+type PhilHealthRule struct {
+    Tables *ContributionTables
+    Split  string
+}
+
+func (PhilHealthRule) Name() string { return "philhealth" }
+
+func (r PhilHealthRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    // the tables are in pesos; other payroll currencies are not covered here
+    if pc.Request.OffCycle || pc.Currency != "PHP" {
+        return nil, nil
+    }
+    t, err := r.Tables.PhilHealthFor(pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    basic := pc.MonthlyRate()
+    base, ee, er, err := t.Shares(basic)
+    if err != nil {
+        return nil, err
+    }
+    in := func() map[string]string {
+        return map[string]string{"monthly_basic": basic.String(), "premium_base": base.String(), "rate": t.Rate, "floor": t.Floor.String(), "ceiling": t.Ceiling.String(), "table": t.EffectiveDate}
+    }
+    return contributionLines(pc, r.Split, []models.PayslipLine{
+        {Code: "philhealth_ee", Label: "PhilHealth contribution", Kind: models.LineContribution, Amount: ee, Inputs: in(), Formula: "clamp(monthly_basic, floor, ceiling) × rate × employee_share"},
+        {Code: "philhealth_er", Label: "PhilHealth employer share", Kind: models.LineEmployer, Amount: er, Inputs: in(), Formula: "clamp(monthly_basic, floor, ceiling) × rate − employee share"},
+    }), nil
+}
+
+// PagIBIGRule deducts the Pag-IBIG (HDMF) employee savings.
+type PagIBIGRule struct {
+    Tables *ContributionTables
+    Split  string
+}
+
+func (PagIBIGRule) Name() string { return "pagibig" }
+
+func (r PagIBIGRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    // the tables are in pesos; other payroll currencies are not covered here
+    if pc.Request.OffCycle || pc.Currency != "PHP" {
+        return nil, nil
+    }
+    t, err := r.Tables.PagIBIGFor(pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    comp := pc.MonthlyRate()
+    base, tier, ee, er, err := t.Contributions(comp)
+    if err != nil {
+        return nil, err
+    }
+    in := func(rate string) map[string]string {
+        return map[string]string{"monthly_compensation": comp.String(), "fund_salary": base.String(), "max_fund_salary": t.MaxFundSalary.String(), "rate": rate, "table": t.EffectiveDate}
+    }
+    return contributionLines(pc, r.Split, []models.PayslipLine{
+        {Code: "pagibig_ee", Label: "Pag-IBIG contribution", Kind: models.LineContribution, Amount: ee, Inputs: in(tier.EERate), Formula: "min(monthly_compensation, max_fund_salary) × rate"},
+        {Code: "pagibig_er", Label: "Pag-IBIG employer share", Kind: models.LineEmployer, Amount: er, Inputs: in(tier.ERRate), Formula: "min(monthly_compensation, max_fund_salary) × rate"},
+    }), nil
+}
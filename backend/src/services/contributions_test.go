@@ -0,0 +1,172 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func loadTables(t *testing.T) *ContributionTables {
+    t.Helper()
+    tables, err := DefaultContributionTables()
+    if err != nil {
+        t.Fatalf("load tables: %v", err)
+    }
+    return tables
+}
+
+func TestSSSTable_PublishedBrackets(t *testing.T) {
+    tables := loadTables(t)
+    cases := []struct {
+        date, comp, msc, ee, er, ec string
+    }{
+        {"2025-06-30", "25000", "25000.00", "1250.00", "2500.00", "30.00"},
+        {"2025-06-30", "3000", "5000.00", "250.00", "500.00", "10.00"},
+        {"2025-06-30", "14749.99", "14500.00", "725.00", "1450.00", "10.00"},
+        {"2025-06-30", "14750", "15000.00", "750.00", "1500.00", "30.00"},
+        {"2025-06-30", "80000", "35000.00", "1750.00", "3500.00", "30.00"},
+        {"2024-12-31", "25000", "25000.00", "1125.00", "2375.00", "30.00"},
+        {"2024-12-31", "50000", "30000.00", "1350.00", "2850.00", "30.00"},
+    }
+    for _, c := range cases {
+        tbl, err := tables.SSSFor(c.date)
+        if err != nil {
+            t.Fatalf("%s: %v", c.date, err)
+        }
+        b := tbl.Lookup(money.MustParse(c.comp, "PHP"))
+        if b.MSC.String() != c.msc || b.EE.String() != c.ee || b.ER.String() != c.er || b.EC.String() != c.ec {
+            t.Fatalf("%s %s: got msc %s ee %s er %s ec %s", c.date, c.comp, b.MSC, b.EE, b.ER, b.EC)
+        }
+    }
+    if _, err := tables.SSSFor("2010-01-01"); !errors.Is(err, ErrNoContributionTable) {
+        t.Fatalf("expected ErrNoContributionTable, got %v", err)
+    }
+}
+
+func TestPhilHealthAndPagIBIG_PublishedRates(t *testing.T) {
+    tables := loadTables(t)
+    ph := []struct {
+        date, basic, ee, er string
+    }{
+        {"2025-06-30", "25000", "625.00", "625.00"},
+        {"2025-06-30", "8000", "250.00", "250.00"},     // floor 10,000
+        {"2025-06-30", "150000", "2500.00", "2500.00"}, // ceiling 100,000
+        {"2023-06-30", "25000", "500.00", "500.00"},
+        {"2023-06-30", "150000", "1600.00", "1600.00"}, // ceiling 80,000
+    }
+    for _, c := range ph {
+        tbl, _ := tables.PhilHealthFor(c.date)
+        _, ee, er, err := tbl.Shares(money.MustParse(c.basic, "PHP"))
+        if err != nil || ee.String() != c.ee || er.String() != c.er {
+            t.Fatalf("philhealth %s %s: %v ee %s er %s", c.date, c.basic, err, ee, er)
+        }
+    }
+    hdmf := []struct {
+        date, comp, ee, er string
+    }{
+        {"2025-06-30", "25000", "200.00", "200.00"},
+        {"2025-06-30", "1500", "15.00", "30.00"},
+        {"2025-06-30", "6000", "120.00", "120.00"},
+        {"2023-06-30", "25000", "100.00", "100.00"},
+    }
+    for _, c := range hdmf {
+        tbl, _ := tables.PagIBIGFor(c.date)
+        _, _, ee, er, err := tbl.Contributions(money.MustParse(c.comp, "PHP"))
+        if err != nil || ee.String() != c.ee || er.String() != c.er {
+            t.Fatalf("pagibig %s %s: %v ee %s er %s", c.date, c.comp, err, ee, er)
+        }
+    }
+}
+
+func TestPeriodShare_SemiMonthlySplit(t *testing.T) {
+    monthly := money.MustParse("625.03", "PHP")
+    pc := func(end string) *PayrollContext {
+        return &PayrollContext{Request: PayrollRequest{PeriodEnd: end, Frequency: FrequencySemiMonthly}}
+    }
+    first, _ := periodShare(pc("2025-06-15"), monthly, SplitEven)
+    second, _ := periodShare(pc("2025-06-30"), monthly, SplitEven)
+    if first.String() != "312.52" || second.String() != "312.51" {
+        t.Fatalf("split: %s + %s", first, second)
+    }
+    if amt, _ := periodShare(pc("2025-06-15"), monthly, SplitSecond); !amt.IsZero() {
+        t.Fatalf("second-only split charged first cut-off: %s", amt)
+    }
+    if amt, _ := periodShare(pc("2025-06-30"), monthly, SplitSecond); !amt.Equal(monthly) {
+        t.Fatalf("second-only split: %s", amt)
+    }
+    monthlyPC := &PayrollContext{Request: PayrollRequest{PeriodEnd: "2025-06-30", Frequency: FrequencyMonthly}}
+    if amt, _ := periodShare(monthlyPC, monthly, SplitEven); !amt.Equal(monthly) {
+        t.Fatalf("monthly payroll: %s", amt)
+    }
+}
+
+func TestPayrollService_WithContributionRules(t *testing.T) {
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    svc := NewPayrollService(newPayrollTestRepo(t), nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    p, err := svc.Calculate(context.Background(), PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15"})
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    want := map[string]string{"sss_ee": "750.00", "sss_er": "1500.00", "sss_ec": "15.00", "philhealth_ee": "375.00", "philhealth_er": "375.00", "pagibig_ee": "100.00", "pagibig_er": "100.00"}
+    for code, amt := range want {
+        l := findLine(p, code)
+        if l == nil || l.Amount.String() != amt || l.Inputs["table"] == "" {
+            t.Fatalf("%s: want %s, got %+v", code, amt, l)
+        }
+    }
+    if findLine(p, "sss_er").Kind != models.LineEmployer {
+        t.Fatalf("employer share must not be deducted")
+    }
+    if p.Deductions.String() != "1225.00" || p.EmployerContributions.String() != "1990.00" {
+        t.Fatalf("deductions %s employer %s", p.Deductions, p.EmployerContributions)
+    }
+}
+
+func TestContributionRules_SkipOtherCurrencies(t *testing.T) {
+    repo := NewInMemoryEmployeeRepo()
+    _, _ = repo.Create(context.Background(), map[string]interface{}{"employee_id": "E-2", "compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "amount": money.MustParse("5000", "USD"), "effective_date": "2025-01-01", "currency": "USD"},
+    }})
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    svc := NewPayrollService(repo, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    p, err := svc.Calculate(context.Background(), PayrollRequest{EmployeeID: "E-2", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15"})
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // a USD salary must not be bracketed against the peso tables
+    for _, l := range p.Lines {
+        if strings.HasPrefix(l.Code, "sss_") || strings.HasPrefix(l.Code, "philhealth_") || strings.HasPrefix(l.Code, "pagibig_") {
+            t.Fatalf("unexpected contribution line %+v", l)
+        }
+    }
+    if p.Currency != "USD" || !p.Deductions.IsZero() {
+        t.Fatalf("payslip: %s deductions %s", p.Currency, p.Deductions)
+    }
+}
+
+func TestLoadContributionTables_FromDirectory(t *testing.T) {
+    fsys := fstest.MapFS{
+        "sss.json": {Data: []byte(`{"versions":[{"effective_date":"2030-01-01","brackets":[
+            {"min":"0","max":"9999.99","msc":"10000","ee":"600","er":"1200","ec":"10"},
+            {"min":"10000","msc":"20000","ee":"1200","er":"2400","ec":"30"}]}]}`)},
+        "philhealth.json": {Data: []byte(`{"versions":[{"effective_date":"2030-01-01","rate":"0.06","floor":"10000","ceiling":"120000","employee_share":"0.5"}]}`)},
+        "pagibig.json":    {Data: []byte(`{"versions":[{"effective_date":"2030-01-01","max_fund_salary":"15000","tiers":[{"ee_rate":"0.02","er_rate":"0.02"}]}]}`)},
+    }
+    tables, err := LoadContributionTables(fsys)
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    sss, _ := tables.SSSFor("2030-02-15")
+    if b := sss.Lookup(money.MustParse("12000", "PHP")); b.EE.String() != "1200.00" {
+        t.Fatalf("custom sss: %s", b.EE)
+    }
+    fsys["sss.json"] = &fstest.MapFile{Data: []byte(`{"versions":[{"effective_date":"2030-01-01","brackets":[]}]}`)}
+    if _, err := LoadContributionTables(fsys); err == nil {
+        t.Fatalf("expected error for empty brackets")
+    }
+}
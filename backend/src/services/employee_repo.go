@@ -121,6 +121,7 @@ func (r *MongoEmployeeRepo) List(ctx context.Context) ([]map[string]interface{},
         if err := cur.Decode(&doc); err != nil {
             continue
         }
+        decodeMoney(doc)
         out = append(out, doc)
     }
     return out, nil
@@ -143,6 +144,7 @@ func (r *MongoEmployeeRepo) Get(ctx context.Context, id string) (map[string]inte
     if err := r.coll.FindOne(ctx, filter).Decode(&doc); err != nil {
         return nil, err
     }
+    decodeMoney(doc)
     return doc, nil
 }
 
@@ -171,6 +173,7 @@ func (r *MongoEmployeeRepo) Update(ctx context.Context, id string, doc map[strin
     if _, err := r.coll.UpdateOne(ctx, filter, bson.M{"$set": cur}); err != nil {
         return nil, err
     }
+    decodeMoney(cur)
     return cur, nil
 }
 
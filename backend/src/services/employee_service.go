@@ -12,13 +12,20 @@ import (
 
 // EmployeeService provides CRUD for employees and validation around the repo.
 type EmployeeService struct {
-    repo EmployeeRepo
+    repo  EmployeeRepo
+    audit AuditLog
 }
 
 func NewEmployeeService(repo EmployeeRepo) *EmployeeService {
     return &EmployeeService{repo: repo}
 }
 
+// SetAuditLog records the changes made on behalf of other services, such as
+// separations, to a.
+func (s *EmployeeService) SetAuditLog(a AuditLog) {
+    s.audit = a
+}
+
 func (s *EmployeeService) Create(ctx context.Context, emp map[string]interface{}) (map[string]interface{}, error) {
     if emp == nil {
         return nil, errors.New("employee is required")
@@ -49,6 +56,24 @@ func (s *EmployeeService) Update(ctx context.Context, id string, patch map[strin
     return s.repo.Update(ctx, id, patch, expectedVersion)
 }
 
+// RecordSeparation marks the employee terminated as of separationDate with
+// the outcome of their final pay, and audits it.
+func (s *EmployeeService) RecordSeparation(ctx context.Context, actor, id, separationDate string, finalPay map[string]interface{}) error {
+    if _, err := time.Parse("2006-01-02", separationDate); err != nil {
+        return errors.New("invalid separation date")
+    }
+    if _, err := s.repo.Update(ctx, id, map[string]interface{}{
+        "employment_status": "terminated",
+        "termination_date":  separationDate,
+        "final_pay":         finalPay,
+    }, nil); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "employee.separate", id, map[string]interface{}{
+        "separation_date": separationDate, "final_pay": finalPay,
+    })
+}
+
 func (s *EmployeeService) Delete(ctx context.Context, id string) error {
     return s.repo.Delete(ctx, id)
 }
@@ -0,0 +1,544 @@
+package services
+
+import (
+    "context"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+    // ErrInvalidExchangeRate wraps malformed exchange rates and rate files.
+    ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+    // ErrNoExchangeRate is returned when no rate of a pair is in effect on a date.
+    ErrNoExchangeRate = errors.New("no exchange rate in effect")
+)
+
+// Rate date policies: which date of a report picks the exchange rate.
+const (
+    RateDatePeriodEnd = "period_end"
+    RateDatePayDate   = "pay_date" // falls back to the period end
+)
+
+// ExchangeRateFilter narrows rate listings; empty fields match everything.
+type ExchangeRateFilter struct {
+    From string
+    To   string
+}
+
+func (f ExchangeRateFilter) match(r models.ExchangeRate) bool {
+    return (f.From == "" || r.From == f.From) && (f.To == "" || r.To == f.To)
+}
+
+// ExchangeRateStore persists exchange rates, one per pair and effective date.
+type ExchangeRateStore interface {
+    // Save adds rates, replacing any of the same pair and effective date.
+    Save(ctx context.Context, rates []models.ExchangeRate) error
+    // List returns matching rates by pair, newest effective date first.
+    List(ctx context.Context, f ExchangeRateFilter) ([]models.ExchangeRate, error)
+}
+
+// ConvertedMoney is an amount converted to the reporting currency, with the
+// original amount and the rate used.
+type ConvertedMoney struct {
+    Amount           money.Money `json:"amount"`
+    Currency         string      `json:"currency"`
+    Original         money.Money `json:"original"`
+    OriginalCurrency string      `json:"original_currency"`
+    Rate             string      `json:"rate"`
+    RateDate         string      `json:"rate_date"` // effective date of the rate; empty when not converted
+}
+
+// ExchangeRateService keeps dated exchange rates and converts report figures
+// to the reporting currency.
+type ExchangeRateService struct {
+    store    ExchangeRateStore
+    audit    AuditLog
+    currency string
+    rateDate string
+    rounding money.Rounding
+    now      func() time.Time
+}
+
+// NewExchangeRateService creates the service. Reports are converted to
+// currency (PHP when empty) at the rate in effect on rateDate: a policy
+// (RateDatePeriodEnd, the default, or RateDatePayDate) or a fixed YYYY-MM-DD.
+func NewExchangeRateService(store ExchangeRateStore, audit AuditLog, currency, rateDate string) (*ExchangeRateService, error) {
+    currency = strings.ToUpper(strings.TrimSpace(currency))
+    if currency == "" {
+        currency = money.DefaultCurrency
+    }
+    if !currencyCode(currency) {
+        return nil, fmt.Errorf("%w: reporting currency %q", ErrInvalidExchangeRate, currency)
+    }
+    if rateDate == "" {
+        rateDate = RateDatePeriodEnd
+    }
+    if rateDate != RateDatePeriodEnd && rateDate != RateDatePayDate && !validDate(rateDate) {
+        return nil, fmt.Errorf("%w: rate date must be period_end, pay_date or YYYY-MM-DD", ErrInvalidExchangeRate)
+    }
+    return &ExchangeRateService{store: store, audit: audit, currency: currency, rateDate: rateDate, rounding: money.HalfEven, now: time.Now}, nil
+}
+
+// Currency returns the reporting currency.
+func (s *ExchangeRateService) Currency() string { return s.currency }
+
+// RateDate resolves the rate date of a report covering periodEnd and paid
+// on payDate; override, when set, is either a policy or a date.
+func (s *ExchangeRateService) RateDate(override, periodEnd, payDate string) (string, error) {
+    policy := s.rateDate
+    if override != "" {
+        policy = override
+    }
+    switch {
+    case policy == RateDatePeriodEnd:
+        return periodEnd, nil
+    case policy == RateDatePayDate:
+        if payDate != "" {
+            return payDate, nil
+        }
+        return periodEnd, nil
+    case validDate(policy):
+        return policy, nil
+    }
+    return "", fmt.Errorf("%w: rate date must be period_end, pay_date or YYYY-MM-DD", ErrInvalidExchangeRate)
+}
+
+// Add records rates, replacing those of the same pair and effective date.
+func (s *ExchangeRateService) Add(ctx context.Context, actor, source string, rates []models.ExchangeRate) ([]models.ExchangeRate, error) {
+    now := s.now().Unix()
+    var problems []string
+    for i := range rates {
+        r := &rates[i]
+        r.From, r.To = strings.ToUpper(strings.TrimSpace(r.From)), strings.ToUpper(strings.TrimSpace(r.To))
+        r.Rate, r.EffectiveDate = strings.TrimSpace(r.Rate), strings.TrimSpace(r.EffectiveDate)
+        if err := validateExchangeRate(*r); err != "" {
+            problems = append(problems, err)
+            continue
+        }
+        if r.Source == "" {
+            r.Source = source
+        }
+        r.CreatedBy, r.CreatedAt = actor, now
+    }
+    if len(problems) > 0 {
+        return nil, fmt.Errorf("%w: %s", ErrInvalidExchangeRate, strings.Join(problems, "; "))
+    }
+    if len(rates) == 0 {
+        return nil, fmt.Errorf("%w: no rates", ErrInvalidExchangeRate)
+    }
+    if err := s.store.Save(ctx, rates); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "exchange_rate.save", "exchange_rates", map[string]interface{}{"rates": len(rates), "source": source}); err != nil {
+        return nil, err
+    }
+    return rates, nil
+}
+
+// ImportCSV reads rates with a header naming the columns from, to, rate and
+// effective_date (source optional) and records them all, or none when a row
+// is invalid.
+func (s *ExchangeRateService) ImportCSV(ctx context.Context, actor string, r io.Reader) ([]models.ExchangeRate, error) {
+    rates, err := ParseExchangeRatesCSV(r)
+    if err != nil {
+        return nil, err
+    }
+    return s.Add(ctx, actor, "csv", rates)
+}
+
+// ParseExchangeRatesCSV reads a rate file without validating the rates.
+func ParseExchangeRatesCSV(r io.Reader) ([]models.ExchangeRate, error) {
+    cr := csv.NewReader(r)
+    cr.TrimLeadingSpace = true
+    rows, err := cr.ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeRate, err)
+    }
+    if len(rows) == 0 {
+        return nil, fmt.Errorf("%w: empty file", ErrInvalidExchangeRate)
+    }
+    col := map[string]int{}
+    for i, h := range rows[0] {
+        col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+    }
+    for _, h := range []string{"from", "to", "rate", "effective_date"} {
+        if _, ok := col[h]; !ok {
+            return nil, fmt.Errorf("%w: header must name from, to, rate and effective_date", ErrInvalidExchangeRate)
+        }
+    }
+    get := func(row []string, h string) string {
+        if i, ok := col[h]; ok && i < len(row) {
+            return strings.TrimSpace(row[i])
+        }
+        return ""
+    }
+    var rates []models.ExchangeRate
+    for _, row := range rows[1:] {
+        if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+            continue
+        }
+        rates = append(rates, models.ExchangeRate{From: get(row, "from"), To: get(row, "to"), Rate: get(row, "rate"), EffectiveDate: get(row, "effective_date"), Source: get(row, "source")})
+    }
+    return rates, nil
+}
+
+func validateExchangeRate(r models.ExchangeRate) string {
+    pair := r.From + "/" + r.To
+    switch {
+    case !currencyCode(r.From) || !currencyCode(r.To):
+        return fmt.Sprintf("%s: currencies must be ISO 4217 codes", pair)
+    case r.From == r.To:
+        return fmt.Sprintf("%s: currencies must differ", pair)
+    case !validDate(r.EffectiveDate):
+        return fmt.Sprintf("%s: effective_date must be YYYY-MM-DD", pair)
+    }
+    if v, ok := new(big.Rat).SetString(r.Rate); !ok || v.Sign() <= 0 || strings.ContainsAny(r.Rate, "eE/") {
+        return fmt.Sprintf("%s %s: rate must be a positive decimal", pair, r.EffectiveDate)
+    }
+    return ""
+}
+
+func currencyCode(c string) bool {
+    if len(c) != 3 {
+        return false
+    }
+    for _, r := range c {
+        if r < 'A' || r > 'Z' {
+            return false
+        }
+    }
+    return true
+}
+
+func validDate(d string) bool {
+    _, err := time.Parse("2006-01-02", d)
+    return err == nil
+}
+
+// List returns recorded rates.
+func (s *ExchangeRateService) List(ctx context.Context, f ExchangeRateFilter) ([]models.ExchangeRate, error) {
+    f.From, f.To = strings.ToUpper(f.From), strings.ToUpper(f.To)
+    return s.store.List(ctx, f)
+}
+
+// Rate returns the rate converting from into to on date: the latest rate of
+// the pair effective on or before date, else the inverse of the latest
+// reverse rate. The effective date of the rate used is returned with it.
+func (s *ExchangeRateService) Rate(ctx context.Context, from, to, date string) (rate string, effective string, err error) {
+    from, to = strings.ToUpper(from), strings.ToUpper(to)
+    if from == to {
+        return "1", "", nil
+    }
+    r, err := s.latest(ctx, from, to, date)
+    if err != nil || r != nil {
+        if r == nil {
+            return "", "", err
+        }
+        return r.Rate, r.EffectiveDate, nil
+    }
+    r, err = s.latest(ctx, to, from, date)
+    if err != nil {
+        return "", "", err
+    }
+    if r == nil {
+        return "", "", fmt.Errorf("%w: %s/%s on %s", ErrNoExchangeRate, from, to, date)
+    }
+    v, _ := new(big.Rat).SetString(r.Rate)
+    // ten decimals keep the inverse exact to well below a centavo on
+    // payroll-sized amounts
+    return strings.TrimRight(strings.TrimRight(v.Inv(v).FloatString(10), "0"), "."), r.EffectiveDate, nil
+}
+
+func (s *ExchangeRateService) latest(ctx context.Context, from, to, date string) (*models.ExchangeRate, error) {
+    rates, err := s.store.List(ctx, ExchangeRateFilter{From: from, To: to})
+    if err != nil {
+        return nil, err
+    }
+    for i := range rates {
+        if rates[i].EffectiveDate <= date {
+            return &rates[i], nil
+        }
+    }
+    return nil, nil
+}
+
+// Convert converts m to the reporting currency at the rate in effect on date,
+// rounded to the reporting currency's minor unit.
+func (s *ExchangeRateService) Convert(ctx context.Context, m money.Money, date string) (ConvertedMoney, error) {
+    return s.converter(ctx, date).convert(m)
+}
+
+// converter converts many amounts of one report, caching rates per currency.
+type converter struct {
+    fx    *ExchangeRateService
+    ctx   context.Context
+    date  string
+    rates map[string][2]string
+}
+
+func (s *ExchangeRateService) converter(ctx context.Context, date string) *converter {
+    return &converter{fx: s, ctx: ctx, date: date, rates: map[string][2]string{}}
+}
+
+func (c *converter) convert(m money.Money) (ConvertedMoney, error) {
+    from := m.Currency()
+    if from == "" {
+        from = money.DefaultCurrency
+    }
+    r, ok := c.rates[from]
+    if !ok {
+        rate, effective, err := c.fx.Rate(c.ctx, from, c.fx.currency, c.date)
+        if err != nil {
+            return ConvertedMoney{}, err
+        }
+        r = [2]string{rate, effective}
+        c.rates[from] = r
+    }
+    amt, err := m.WithCurrency(c.fx.currency).MulRate(r[0], c.fx.rounding)
+    if err != nil {
+        return ConvertedMoney{}, err
+    }
+    return ConvertedMoney{Amount: amt.Round(c.fx.rounding), Currency: c.fx.currency, Original: m, OriginalCurrency: from, Rate: r[0], RateDate: r[1]}, nil
+}
+
+// ConvertedRunTotals is one currency's run totals in the reporting currency.
+type ConvertedRunTotals struct {
+    Currency              string         `json:"currency"` // original
+    Headcount             int            `json:"headcount"`
+    Gross                 ConvertedMoney `json:"gross"`
+    Deductions            ConvertedMoney `json:"deductions"`
+    Taxes                 ConvertedMoney `json:"taxes"`
+    Net                   ConvertedMoney `json:"net"`
+    EmployerContributions ConvertedMoney `json:"employer_contributions"`
+}
+
+// RunCostReport sums a run's totals in the reporting currency. Cost is gross
+// pay plus employer contributions.
+type RunCostReport struct {
+    RunID                 string               `json:"run_id"`
+    Currency              string               `json:"currency"`
+    RateDate              string               `json:"rate_date"`
+    Totals                []ConvertedRunTotals `json:"totals"`
+    Headcount             int                  `json:"headcount"`
+    Gross                 money.Money          `json:"gross"`
+    Deductions            money.Money          `json:"deductions"`
+    Taxes                 money.Money          `json:"taxes"`
+    Net                   money.Money          `json:"net"`
+    EmployerContributions money.Money          `json:"employer_contributions"`
+    Cost                  money.Money          `json:"cost"`
+}
+
+// RunCost converts the totals of run to the reporting currency; rateDate
+// overrides the service's rate date policy.
+func (s *ExchangeRateService) RunCost(ctx context.Context, runs *PayrollRunService, runID, rateDate string) (*RunCostReport, error) {
+    run, err := runs.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    date, err := s.RateDate(rateDate, run.PeriodEnd, run.PayDate)
+    if err != nil {
+        return nil, err
+    }
+    z := money.Zero(s.currency)
+    rep := &RunCostReport{RunID: run.RunID, Currency: s.currency, RateDate: date, Totals: []ConvertedRunTotals{},
+        Gross: z, Deductions: z, Taxes: z, Net: z, EmployerContributions: z}
+    c := s.converter(ctx, date)
+    for _, t := range run.Totals {
+        ct := ConvertedRunTotals{Currency: t.Currency, Headcount: t.Headcount}
+        for _, f := range []struct {
+            dst *ConvertedMoney
+            src money.Money
+            sum *money.Money
+        }{
+            {&ct.Gross, t.Gross, &rep.Gross},
+            {&ct.Deductions, t.Deductions, &rep.Deductions},
+            {&ct.Taxes, t.Taxes, &rep.Taxes},
+            {&ct.Net, t.Net, &rep.Net},
+            {&ct.EmployerContributions, t.EmployerContributions, &rep.EmployerContributions},
+        } {
+            if *f.dst, err = c.convert(f.src.WithCurrency(t.Currency)); err != nil {
+                return nil, err
+            }
+            *f.sum = f.sum.Add(f.dst.Amount)
+        }
+        rep.Headcount += t.Headcount
+        rep.Totals = append(rep.Totals, ct)
+    }
+    rep.Cost = rep.Gross.Add(rep.EmployerContributions)
+    return rep, nil
+}
+
+// ConvertedPeriodTotals is one currency's payroll record totals in the
+// reporting currency.
+type ConvertedPeriodTotals struct {
+    Currency   string         `json:"currency"` // original
+    Records    int            `json:"records"`
+    Gross      ConvertedMoney `json:"gross"`
+    Deductions ConvertedMoney `json:"deductions"`
+    Taxes      ConvertedMoney `json:"taxes"`
+    Net        ConvertedMoney `json:"net"`
+}
+
+// PeriodCostReport sums a period's payroll records in the reporting currency.
+type PeriodCostReport struct {
+    Period     string                  `json:"period"`
+    Currency   string                  `json:"currency"`
+    RateDate   string                  `json:"rate_date"`
+    Totals     []ConvertedPeriodTotals `json:"totals"`
+    Records    int                     `json:"records"`
+    Gross      money.Money             `json:"gross"`
+    Deductions money.Money             `json:"deductions"`
+    Taxes      money.Money             `json:"taxes"`
+    Net        money.Money             `json:"net"`
+}
+
+// PeriodCost converts the active payroll record totals of period (YYYY-MM)
+// to the reporting currency. Records have no pay date, so the pay date policy
+// uses the last day of the month as well.
+func (s *ExchangeRateService) PeriodCost(ctx context.Context, records *PayrollRecordService, period, rateDate string) (*PeriodCostReport, error) {
+    start, err := time.Parse("2006-01", period)
+    if err != nil {
+        return nil, fmt.Errorf("%w: period must be YYYY-MM", ErrInvalidPayrollRecord)
+    }
+    date, err := s.RateDate(rateDate, start.AddDate(0, 1, -1).Format("2006-01-02"), "")
+    if err != nil {
+        return nil, err
+    }
+    totals, err := records.Totals(ctx, period)
+    if err != nil {
+        return nil, err
+    }
+    z := money.Zero(s.currency)
+    rep := &PeriodCostReport{Period: period, Currency: s.currency, RateDate: date, Totals: []ConvertedPeriodTotals{}, Gross: z, Deductions: z, Taxes: z, Net: z}
+    c := s.converter(ctx, date)
+    for _, t := range totals {
+        ct := ConvertedPeriodTotals{Currency: t.Currency, Records: t.Records}
+        for _, f := range []struct {
+            dst *ConvertedMoney
+            src money.Money
+            sum *money.Money
+        }{
+            {&ct.Gross, t.Gross, &rep.Gross},
+            {&ct.Deductions, t.Deductions, &rep.Deductions},
+            {&ct.Taxes, t.Taxes, &rep.Taxes},
+            {&ct.Net, t.Net, &rep.Net},
+        } {
+            if *f.dst, err = c.convert(f.src.WithCurrency(t.Currency)); err != nil {
+                return nil, err
+            }
+            *f.sum = f.sum.Add(f.dst.Amount)
+        }
+        rep.Records += t.Records
+        rep.Totals = append(rep.Totals, ct)
+    }
+    return rep, nil
+}
+
+func exchangeRateKey(r models.ExchangeRate) string {
+    return r.From + "/" + r.To + "/" + r.EffectiveDate
+}
+
+// sortExchangeRates orders rates by pair, newest effective date first.
+func sortExchangeRates(out []models.ExchangeRate) {
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].From != out[j].From {
+            return out[i].From < out[j].From
+        }
+        if out[i].To != out[j].To {
+            return out[i].To < out[j].To
+        }
+        return out[i].EffectiveDate > out[j].EffectiveDate
+    })
+}
+
+// InMemoryExchangeRateStore keeps exchange rates in memory.
+type InMemoryExchangeRateStore struct {
+    mu sync.Mutex
+    m  map[string]models.ExchangeRate
+}
+
+func NewInMemoryExchangeRateStore() *InMemoryExchangeRateStore {
+    return &InMemoryExchangeRateStore{m: map[string]models.ExchangeRate{}}
+}
+
+func (s *InMemoryExchangeRateStore) Save(ctx context.Context, rates []models.ExchangeRate) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, r := range rates {
+        s.m[exchangeRateKey(r)] = r
+    }
+    return nil
+}
+
+func (s *InMemoryExchangeRateStore) List(ctx context.Context, f ExchangeRateFilter) ([]models.ExchangeRate, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.ExchangeRate{}
+    for _, r := range s.m {
+        if f.match(r) {
+            out = append(out, r)
+        }
+    }
+    sortExchangeRates(out)
+    return out, nil
+}
+
+// MongoExchangeRateStore stores exchange rates in MongoDB.
+type MongoExchangeRateStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoExchangeRateStore(coll *mongo.Collection) *MongoExchangeRateStore {
+    return &MongoExchangeRateStore{coll: coll}
+}
+
+// EnsureIndexes makes the pair and effective date unique.
+func (s *MongoExchangeRateStore) EnsureIndexes(ctx context.Context) error {
+    _, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys:    bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}, {Key: "effective_date", Value: -1}},
+        Options: options.Index().SetUnique(true),
+    })
+    return err
+}
+
+func (s *MongoExchangeRateStore) Save(ctx context.Context, rates []models.ExchangeRate) error {
+    for _, r := range rates {
+        filter := bson.M{"from": r.From, "to": r.To, "effective_date": r.EffectiveDate}
+        if _, err := s.coll.ReplaceOne(ctx, filter, r, options.Replace().SetUpsert(true)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *MongoExchangeRateStore) List(ctx context.Context, f ExchangeRateFilter) ([]models.ExchangeRate, error) {
+    filter := bson.M{}
+    if f.From != "" {
+        filter["from"] = f.From
+    }
+    if f.To != "" {
+        filter["to"] = f.To
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}, {Key: "effective_date", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.ExchangeRate{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
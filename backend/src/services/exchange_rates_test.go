@@ -0,0 +1,121 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+const testRates = "from,to,rate,effective_date,source\r\n" +
+    "USD,PHP,56.00,2025-06-01,BSP\r\n" +
+    "usd,php,57.50,2025-07-01,BSP\r\n"
+
+func TestExchangeRateService_Convert(t *testing.T) {
+    ctx := context.Background()
+    audit := NewInMemoryAuditLog()
+    fx, err := NewExchangeRateService(NewInMemoryExchangeRateStore(), audit, "", "")
+    if err != nil {
+        t.Fatalf("service: %v", err)
+    }
+    if _, err := fx.ImportCSV(ctx, "finance", strings.NewReader(testRates)); err != nil {
+        t.Fatalf("import: %v", err)
+    }
+    if items, _ := fx.List(ctx, ExchangeRateFilter{From: "usd"}); len(items) != 2 || items[0].EffectiveDate != "2025-07-01" || items[1].Source != "BSP" {
+        t.Fatalf("list: %+v", items)
+    }
+
+    c, err := fx.Convert(ctx, money.MustParse("1000.50", "USD"), "2025-06-30")
+    if err != nil || c.Amount.String() != "56028.00" || c.Currency != "PHP" || c.OriginalCurrency != "USD" || c.Rate != "56.00" || c.RateDate != "2025-06-01" {
+        t.Fatalf("convert: %v %+v", err, c)
+    }
+    if c, _ := fx.Convert(ctx, money.MustParse("1000", "USD"), "2025-07-01"); c.Amount.String() != "57500.00" {
+        t.Fatalf("july rate: %+v", c)
+    }
+    if c, _ := fx.Convert(ctx, money.MustParse("1000", "PHP"), "2025-01-01"); c.Amount.String() != "1000.00" || c.Rate != "1" {
+        t.Fatalf("same currency: %+v", c)
+    }
+    if _, err := fx.Convert(ctx, money.MustParse("1000", "USD"), "2025-05-31"); !errors.Is(err, ErrNoExchangeRate) {
+        t.Fatalf("expected ErrNoExchangeRate, got %v", err)
+    }
+    // the reverse pair converts through the inverse rate
+    if rate, effective, err := fx.Rate(ctx, "PHP", "USD", "2025-06-15"); err != nil || rate != "0.0178571429" || effective != "2025-06-01" {
+        t.Fatalf("inverse: %v %s %s", err, rate, effective)
+    }
+
+    for _, bad := range []string{
+        "from,to,rate\r\nUSD,PHP,56\r\n",
+        "from,to,rate,effective_date\r\nUSD,PHP,56,2025-08-01\r\nUSD,PHP,-1,2025-09-01\r\n",
+        "from,to,rate,effective_date\r\nUSD,USD,1,2025-08-01\r\n",
+        "from,to,rate,effective_date\r\nUSD,PHP,56,Aug 2025\r\n",
+    } {
+        if _, err := fx.ImportCSV(ctx, "finance", strings.NewReader(bad)); !errors.Is(err, ErrInvalidExchangeRate) {
+            t.Fatalf("expected ErrInvalidExchangeRate for %q, got %v", bad, err)
+        }
+    }
+    if items, _ := fx.List(ctx, ExchangeRateFilter{}); len(items) != 2 {
+        t.Fatalf("rejected file saved rates: %+v", items)
+    }
+    if entries, _ := audit.List(ctx, "exchange_rates"); len(entries) != 1 {
+        t.Fatalf("audit: %+v", entries)
+    }
+    if _, err := NewExchangeRateService(NewInMemoryExchangeRateStore(), nil, "PHP", "month_end"); !errors.Is(err, ErrInvalidExchangeRate) {
+        t.Fatalf("expected ErrInvalidExchangeRate, got %v", err)
+    }
+}
+
+func TestExchangeRateService_Cost(t *testing.T) {
+    ctx := context.Background()
+    runs, _ := newRunTestService(t)
+    _, _ = runs.employees.Create(ctx, map[string]interface{}{"employee_id": "E-9", "compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "amount": 4000, "currency": "USD", "effective_date": "2025-01-01"},
+    }})
+    fx, _ := NewExchangeRateService(NewInMemoryExchangeRateStore(), nil, "PHP", RateDatePeriodEnd)
+    if _, err := fx.ImportCSV(ctx, "finance", strings.NewReader(testRates)); err != nil {
+        t.Fatalf("import: %v", err)
+    }
+    p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-16", End: "2025-06-30", PayDate: "2025-07-05"})
+    run, err := runs.CreateRun(ctx, "clerk", p.PeriodID)
+    if err != nil || len(run.Totals) != 2 {
+        t.Fatalf("run: %v %+v", err, run)
+    }
+
+    rep, err := fx.RunCost(ctx, runs, run.RunID, "")
+    if err != nil || rep.RateDate != "2025-06-30" || len(rep.Totals) != 2 || rep.Headcount != 3 {
+        t.Fatalf("cost: %v %+v", err, rep)
+    }
+    usd := rep.Totals[1]
+    if usd.Currency != "USD" || usd.Gross.Original.String() != "2000.00" || usd.Gross.Amount.String() != "112000.00" || usd.Gross.Rate != "56.00" {
+        t.Fatalf("usd totals: %+v", usd)
+    }
+    php := rep.Totals[0]
+    if want := php.Gross.Amount.Add(usd.Gross.Amount); !rep.Gross.Equal(want) || !rep.Cost.Equal(rep.Gross.Add(rep.EmployerContributions)) {
+        t.Fatalf("sums: %+v", rep)
+    }
+    if rep, _ := fx.RunCost(ctx, runs, run.RunID, RateDatePayDate); rep.RateDate != "2025-07-05" || rep.Totals[1].Gross.Amount.String() != "115000.00" {
+        t.Fatalf("pay date: %+v", rep)
+    }
+    if _, err := fx.RunCost(ctx, runs, run.RunID, "2025-01-01"); !errors.Is(err, ErrNoExchangeRate) {
+        t.Fatalf("expected ErrNoExchangeRate, got %v", err)
+    }
+
+    records := NewPayrollRecordService(NewInMemoryPayrollRepo(), nil, money.DefaultRoundingPolicy())
+    for _, r := range []models.PayrollRecord{
+        {EmployeeID: "E-1", Period: "2025-06", Gross: money.MustParse("30000", "PHP")},
+        {EmployeeID: "E-9", Period: "2025-06", Currency: "USD", Gross: money.MustParse("4000", "USD"), Taxes: money.MustParse("400", "USD")},
+    } {
+        if _, err := records.Create(ctx, "clerk", r); err != nil {
+            t.Fatalf("record: %v", err)
+        }
+    }
+    pc, err := fx.PeriodCost(ctx, records, "2025-06", "")
+    if err != nil || pc.RateDate != "2025-06-30" || pc.Records != 2 || pc.Gross.String() != "254000.00" || pc.Net.String() != "231600.00" {
+        t.Fatalf("period cost: %v %+v", err, pc)
+    }
+    if _, err := fx.PeriodCost(ctx, records, "June", ""); !errors.Is(err, ErrInvalidPayrollRecord) {
+        t.Fatalf("expected ErrInvalidPayrollRecord, got %v", err)
+    }
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// finalPayDueDays is how long after separation final pay is due (DOLE
+// Labor Advisory No. 06-20).
+const finalPayDueDays = 30
+
+// leaveConversionExemptDays is the number of converted leave days exempt
+// from tax as de minimis.
+const leaveConversionExemptDays = 10
+
+// FinalPay is the computed final pay of a separating employee.
+type FinalPay struct {
+    EmployeeID      string              `json:"employee_id"`
+    SeparationDate  string              `json:"separation_date"`
+    DueDate         string              `json:"due_date"`
+    LastSalaryPaid  bool                `json:"last_salary_paid"` // the cut-off with the separation date was already paid
+    ThirteenthMonth *ThirteenthMonthPay `json:"thirteenth_month"`
+    Payslip         *models.Payslip     `json:"payslip"`
+
+    request PayrollRequest
+}
+
+// FinalPay computes final pay without saving it: the salary of the last
+// cut-off up to the separation date (unless a closed run already paid it),
+// the pro-rated 13th month, converted leave and pending adjustments, less the
+// outstanding balance of recorded loans and the deductions given, with the
+// year's tax annualized.
+func (s *PayrollRunService) FinalPay(ctx context.Context, in models.FinalPayInput) (*FinalPay, error) {
+    fp, err := s.finalPay(ctx, in)
+    if err != nil {
+        return nil, err
+    }
+    pending, err := s.store.ListAdjustments(ctx, AdjustmentFilter{EmployeeID: in.EmployeeID, PendingOnly: true})
+    if err != nil {
+        return nil, err
+    }
+    for _, a := range pending {
+        fp.request.Adjustments = append(fp.request.Adjustments, AdjustmentInput{AdjustmentID: a.AdjustmentID, PayslipID: a.PayslipID, Code: a.Code, Label: a.Label, Kind: a.Kind, Amount: a.Amount, Taxable: a.Taxable})
+    }
+    if fp.Payslip, err = s.engine.Calculate(ctx, fp.request); err != nil {
+        return nil, err
+    }
+    return fp, nil
+}
+
+// finalPay validates in and builds the payroll request for it.
+func (s *PayrollRunService) finalPay(ctx context.Context, in models.FinalPayInput) (*FinalPay, error) {
+    if in.EmployeeID == "" {
+        return nil, fmt.Errorf("%w: employee_id required", ErrInvalidPayrollRequest)
+    }
+    sep, err := time.Parse("2006-01-02", in.SeparationDate)
+    if err != nil {
+        return nil, fmt.Errorf("%w: separation_date %v", ErrInvalidPayrollRequest, err)
+    }
+    if in.Frequency == "" {
+        in.Frequency = FrequencySemiMonthly
+    }
+    // weekly and daily periods have no fixed cut-off to settle in
+    if in.Frequency != FrequencyMonthly && in.Frequency != FrequencySemiMonthly {
+        return nil, fmt.Errorf("%w: final pay frequency must be monthly or semi-monthly", ErrInvalidPayrollRequest)
+    }
+    if in.LeaveDays < 0 {
+        return nil, fmt.Errorf("%w: leave_days must not be negative", ErrInvalidPayrollRequest)
+    }
+    emp, err := s.employees.Get(ctx, in.EmployeeID)
+    if err != nil {
+        return nil, err
+    }
+
+    // the cut-off containing the separation date
+    cutStart, cutEnd := semiMonthlyCutOff(in.SeparationDate)
+    if in.Frequency == FrequencyMonthly {
+        cutStart = sep.Format("2006-01") + "-01"
+        cutEnd = time.Date(sep.Year(), sep.Month()+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+    }
+    fp := &FinalPay{EmployeeID: in.EmployeeID, SeparationDate: in.SeparationDate, DueDate: addDays(in.SeparationDate, finalPayDueDays)}
+    req := PayrollRequest{
+        EmployeeID:  in.EmployeeID,
+        PeriodStart: cutStart,
+        PeriodEnd:   cutEnd,
+        Frequency:   in.Frequency,
+        Annualize:   true,
+        SettleLoans: true,
+    }
+    if fp.ThirteenthMonth, err = s.ThirteenthMonth(ctx, in.EmployeeID, in.SeparationDate); err != nil {
+        return nil, err
+    }
+    if fp.ThirteenthMonth.PaidThrough >= in.SeparationDate {
+        // only the separation benefits remain
+        fp.LastSalaryPaid = true
+        req.OffCycle = true
+        req.PeriodEnd = in.SeparationDate
+    } else {
+        // working days after separation are unpaid
+        absent := 0.0
+        if in.SeparationDate < req.PeriodEnd {
+            if absent, err = s.calendar.WorkingDays(ctx, emp, addDays(in.SeparationDate, 1), req.PeriodEnd, false, false); err != nil {
+                return nil, err
+            }
+        }
+        req.Attendance = &AttendanceSummary{AbsentDays: absent}
+    }
+    if fp.ThirteenthMonth.Due.Sign() > 0 {
+        req.Adjustments = append(req.Adjustments, fp.ThirteenthMonth.adjustment())
+    }
+
+    if in.LeaveDays > 0 {
+        _, daily, err := s.engine.Rates(ctx, in.EmployeeID, req.PeriodStart, in.SeparationDate)
+        if err != nil {
+            return nil, err
+        }
+        exempt := in.LeaveDays
+        if exempt > leaveConversionExemptDays {
+            exempt = leaveConversionExemptDays
+        }
+        for _, part := range []struct {
+            days    float64
+            taxable bool
+            label   string
+        }{{exempt, false, "Leave conversion"}, {in.LeaveDays - exempt, true, "Leave conversion (taxable)"}} {
+            if part.days <= 0 {
+                continue
+            }
+            amt, err := daily.MulRate(qty(part.days), money.HalfEven)
+            if err != nil {
+                return nil, err
+            }
+            req.Adjustments = append(req.Adjustments, AdjustmentInput{
+                Code: "leave_conversion", Label: fmt.Sprintf("%s, %s days", part.label, qty(part.days)), Kind: models.LineEarning, Amount: amt, Taxable: part.taxable,
+            })
+        }
+    }
+    for _, d := range in.Deductions {
+        if d.Amount.Sign() <= 0 {
+            return nil, fmt.Errorf("%w: deduction %q must be positive", ErrInvalidPayrollRequest, d.Code)
+        }
+        code := strings.TrimSpace(d.Code)
+        if code == "" {
+            code = "loan"
+        }
+        req.Deductions = append(req.Deductions, DeductionInput{Code: code, Label: d.Label, Amount: d.Amount})
+    }
+    fp.request = req
+    return fp, nil
+}
+
+// CreateFinalPayRun starts a draft off-cycle run holding the final pay of
+// one employee. The employee is left out of regular runs from the final
+// cut-off on; paying the run records the separation on the employee for the
+// archive flow. payDate defaults to the due date.
+func (s *PayrollRunService) CreateFinalPayRun(ctx context.Context, actor string, in models.FinalPayInput, payDate string) (*models.PayrollRun, error) {
+    fp, err := s.finalPay(ctx, in)
+    if err != nil {
+        return nil, err
+    }
+    if payDate == "" {
+        payDate = fp.DueDate
+    } else if _, err := time.Parse("2006-01-02", payDate); err != nil {
+        return nil, fmt.Errorf("%w: pay_date %v", ErrInvalidPayrollRequest, err)
+    }
+    separated, err := s.finalPayEmployees(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if separated[in.EmployeeID] != "" {
+        return nil, ErrRunExists
+    }
+    if in.Frequency == "" {
+        in.Frequency = FrequencySemiMonthly
+    }
+    now := s.now()
+    run := &models.PayrollRun{
+        RunID:       fmt.Sprintf("run-%d", now.UnixNano()),
+        Type:        models.RunFinalPay,
+        FinalPay:    &in,
+        PeriodStart: fp.request.PeriodStart,
+        PeriodEnd:   fp.request.PeriodEnd,
+        Frequency:   in.Frequency,
+        PayDate:     payDate,
+        Status:      models.RunDraft,
+        CreatedBy:   actor,
+        CreatedAt:   now.Unix(),
+    }
+    if err := s.generate(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.create", run.RunID, map[string]interface{}{
+        "type": run.Type, "employee_id": in.EmployeeID, "separation_date": in.SeparationDate, "reason": in.Reason,
+    }); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// finalPayEmployees maps employees with a final-pay run to the start of its
+// period.
+func (s *PayrollRunService) finalPayEmployees(ctx context.Context) (map[string]string, error) {
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    out := map[string]string{}
+    for _, r := range runs {
+        if r.Type == models.RunFinalPay && r.FinalPay != nil {
+            out[r.FinalPay.EmployeeID] = r.PeriodStart
+        }
+    }
+    return out, nil
+}
+
+// recordSeparation stores the outcome of a final-pay run on the employee so
+// the archive flow can see the employee was paid out.
+func (s *PayrollRunService) recordSeparation(ctx context.Context, actor string, run *models.PayrollRun) error {
+    if run.Type != models.RunFinalPay || run.FinalPay == nil {
+        return nil
+    }
+    slips, err := s.store.ListPayslips(ctx, run.RunID)
+    if err != nil {
+        return err
+    }
+    summary := map[string]interface{}{"run_id": run.RunID, "status": run.Status, "pay_date": run.PayDate}
+    for _, p := range slips {
+        summary["net"] = p.Net.String()
+        summary["currency"] = p.Currency
+    }
+    return s.people.RecordSeparation(ctx, actor, run.FinalPay.EmployeeID, run.FinalPay.SeparationDate, summary)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestPayrollRunService_ThirteenthMonth(t *testing.T) {
+    ctx := context.Background()
+    svc, _ := newRunTestService(t)
+    p, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-01-01", End: "2025-01-15"})
+    jan, err := svc.CreateRun(ctx, "clerk", p.PeriodID)
+    if err != nil {
+        t.Fatalf("run: %v", err)
+    }
+    closeRun(t, svc, jan.RunID)
+
+    // January's first half paid, the rest of the year projected at 20,000
+    tm, err := svc.ThirteenthMonth(ctx, "E-2", "2025-12-31")
+    if err != nil || tm.PaidThrough != "2025-01-15" || tm.BasicEarned.String() != "10000.00" || tm.Due.String() != "20000.00" {
+        t.Fatalf("E-2: %v %+v", err, tm)
+    }
+    // up to 5 June: 15,000 paid, then 15,000 for late January, 120,000 for
+    // February to May and 5/15 of 15,000 for 1–5 June; ÷ 12
+    tm, _ = svc.ThirteenthMonth(ctx, "E-1", "2025-06-05")
+    if tm.Projected.String() != "140000.00" || tm.Due.String() != "12916.67" {
+        t.Fatalf("E-1: %+v", tm)
+    }
+    // leaver: five months at 25,000
+    tm, _ = svc.ThirteenthMonth(ctx, "E-3", "2025-12-31")
+    if tm.Through != "2025-05-31" || tm.Due.String() != "10416.67" {
+        t.Fatalf("E-3: %+v", tm)
+    }
+
+    run, err := svc.CreateThirteenthMonthRun(ctx, "clerk", 2025, "", "")
+    if err != nil {
+        t.Fatalf("13th month run: %v", err)
+    }
+    if run.Type != models.RunThirteenthMonth || run.PayDate != "2025-12-24" || run.Totals[0].Headcount != 3 {
+        t.Fatalf("run: %+v", run)
+    }
+    if _, err := svc.CreateThirteenthMonthRun(ctx, "clerk", 2025, "", ""); !errors.Is(err, ErrRunExists) {
+        t.Fatalf("expected ErrRunExists, got %v", err)
+    }
+    slips, _ := svc.Payslips(ctx, run.RunID)
+    for _, p := range slips {
+        if findLine(&p, "basic") != nil || findLine(&p, "thirteenth_month") == nil {
+            t.Fatalf("off-cycle payslip must only pay the 13th month: %+v", p.Lines)
+        }
+        // below the 90,000 exemption
+        if !p.Taxes.IsZero() {
+            t.Fatalf("13th month taxed: %+v", p)
+        }
+    }
+    closeRun(t, svc, run.RunID)
+    tm, _ = svc.ThirteenthMonth(ctx, "E-2", "2025-12-31")
+    if tm.AlreadyPaid.String() != "20000.00" || !tm.Due.IsZero() {
+        t.Fatalf("after payment: %+v", tm)
+    }
+}
+
+func TestPayrollRunService_FinalPay(t *testing.T) {
+    ctx := context.Background()
+    svc, audit := newRunTestService(t)
+    cal := NewHolidayCalendar(NewInMemoryHolidayStore(), nil, nil)
+    if _, err := cal.ImportCSV(ctx, "hr", strings.NewReader("date,name,kind\r\n2025-06-24,Founding day,special\r\n")); err != nil {
+        t.Fatalf("holidays: %v", err)
+    }
+    svc.SetCalendar(cal)
+    in := models.FinalPayInput{
+        EmployeeID: "E-1", SeparationDate: "2025-06-20", LeaveDays: 12, Reason: "resignation",
+        Deductions: []models.FinalPayDeduction{{Code: "sss_loan", Amount: money.MustParse("5000", "")}},
+    }
+    fp, err := svc.FinalPay(ctx, in)
+    if err != nil {
+        t.Fatalf("final pay: %v", err)
+    }
+    // six weekdays after separation, less the holiday
+    p := fp.Payslip
+    if fp.DueDate != "2025-07-20" || fp.LastSalaryPaid || p.PeriodStart != "2025-06-16" || p.Attendance.AbsentDays != 5 {
+        t.Fatalf("final pay: %+v", fp)
+    }
+    if l := findLine(p, "thirteenth_month"); l == nil || l.Amount.String() != "14166.67" || !l.OtherBenefit {
+        t.Fatalf("13th month: %+v", p.Lines)
+    }
+    var exempt, taxable int
+    for _, l := range p.Lines {
+        if l.Code == "leave_conversion" {
+            if l.Taxable {
+                taxable++
+            } else {
+                exempt++
+            }
+        }
+    }
+    if exempt != 1 || taxable != 1 || findLine(p, "sss_loan") == nil || findLine(p, "withholding_tax").Inputs["annual_tax_due"] == "" {
+        t.Fatalf("final pay lines: %+v", p.Lines)
+    }
+
+    run, err := svc.CreateFinalPayRun(ctx, "clerk", in, "")
+    if err != nil || run.PayDate != "2025-07-20" {
+        t.Fatalf("final pay run: %v %+v", err, run)
+    }
+    if _, err := svc.CreateFinalPayRun(ctx, "clerk", in, ""); !errors.Is(err, ErrRunExists) {
+        t.Fatalf("expected ErrRunExists, got %v", err)
+    }
+    // the regular run of the last cut-off leaves E-1 to final pay
+    period, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-16", End: "2025-06-30"})
+    regular, _ := svc.CreateRun(ctx, "clerk", period.PeriodID)
+    slips, _ := svc.Payslips(ctx, regular.RunID)
+    for _, s := range slips {
+        if s.EmployeeID == "E-1" {
+            t.Fatalf("E-1 paid twice")
+        }
+    }
+
+    closeRun(t, svc, run.RunID)
+    emp, _ := svc.employees.Get(ctx, "E-1")
+    summary, _ := emp["final_pay"].(map[string]interface{})
+    if emp["termination_date"] != "2025-06-20" || emp["employment_status"] != "terminated" || summary["run_id"] != run.RunID {
+        t.Fatalf("separation not recorded: %+v", emp)
+    }
+    if entries, _ := audit.List(ctx, "E-1"); len(entries) != 1 || entries[0].Action != "employee.separate" || entries[0].Actor != "clerk" {
+        t.Fatalf("separation audit: %+v", entries)
+    }
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    _ "embed"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync/atomic"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+//go:embed accounting/chart_of_accounts.json
+var defaultChartOfAccounts []byte
+
+// ErrJournalUnbalanced is returned when a run's journal debits do not equal
+// its credits; nothing is exported.
+var ErrJournalUnbalanced = errors.New("journal does not balance")
+
+// GLAccount is a general-ledger account payroll posts to.
+type GLAccount struct {
+    Number string `json:"number"`
+    Name   string `json:"name"`
+}
+
+// GLMapping books payslip lines of Kind and Code ("*" for any code of the
+// kind) to accounts. Earnings need a debit account; contributions,
+// deductions and taxes a credit (liability) account; employer shares both.
+type GLMapping struct {
+    Kind   string `json:"kind"`
+    Code   string `json:"code"`
+    Debit  string `json:"debit,omitempty"`
+    Credit string `json:"credit,omitempty"`
+}
+
+// ChartOfAccounts maps payslip lines to general-ledger accounts. NetPay is
+// the account credited with the employees' net pay.
+type ChartOfAccounts struct {
+    Accounts []GLAccount `json:"accounts"`
+    NetPay   string      `json:"net_pay"`
+    Mappings []GLMapping `json:"mappings"`
+    names    map[string]string
+}
+
+// DefaultChartOfAccounts loads the chart embedded in the binary.
+func DefaultChartOfAccounts() (*ChartOfAccounts, error) {
+    return LoadChartOfAccounts(defaultChartOfAccounts)
+}
+
+// LoadChartOfAccounts parses a chart of accounts and checks that every
+// mapping names known accounts on the sides its kind needs.
+func LoadChartOfAccounts(data []byte) (*ChartOfAccounts, error) {
+    var c ChartOfAccounts
+    if err := json.Unmarshal(data, &c); err != nil {
+        return nil, fmt.Errorf("chart of accounts: %w", err)
+    }
+    c.names = map[string]string{}
+    for _, a := range c.Accounts {
+        if a.Number == "" {
+            return nil, errors.New("chart of accounts: account number required")
+        }
+        if _, dup := c.names[a.Number]; dup {
+            return nil, fmt.Errorf("chart of accounts: account %s listed twice", a.Number)
+        }
+        c.names[a.Number] = a.Name
+    }
+    if _, ok := c.names[c.NetPay]; !ok {
+        return nil, fmt.Errorf("chart of accounts: net_pay account %q is not in the chart", c.NetPay)
+    }
+    for _, m := range c.Mappings {
+        var debit, credit bool
+        switch m.Kind {
+        case models.LineEarning:
+            debit = true
+        case models.LineContribution, models.LineDeduction, models.LineTax:
+            credit = true
+        case models.LineEmployer:
+            debit, credit = true, true
+        default:
+            return nil, fmt.Errorf("chart of accounts: unknown line kind %q", m.Kind)
+        }
+        if m.Code == "" {
+            return nil, fmt.Errorf("chart of accounts: %s mapping without code", m.Kind)
+        }
+        for _, side := range []struct {
+            name, account string
+            needed        bool
+        }{{"debit", m.Debit, debit}, {"credit", m.Credit, credit}} {
+            switch {
+            case side.needed && side.account == "":
+                return nil, fmt.Errorf("chart of accounts: %s %s needs a %s account", m.Kind, m.Code, side.name)
+            case !side.needed && side.account != "":
+                return nil, fmt.Errorf("chart of accounts: %s %s takes no %s account", m.Kind, m.Code, side.name)
+            }
+            if _, ok := c.names[side.account]; side.account != "" && !ok {
+                return nil, fmt.Errorf("chart of accounts: %s %s: account %s is not in the chart", m.Kind, m.Code, side.account)
+            }
+        }
+    }
+    return &c, nil
+}
+
+// mapping returns the mapping of a payslip line, preferring an exact code
+// over the kind's wildcard.
+func (c *ChartOfAccounts) mapping(kind, code string) (GLMapping, bool) {
+    var wildcard *GLMapping
+    for i, m := range c.Mappings {
+        if m.Kind != kind {
+            continue
+        }
+        if m.Code == code {
+            return m, true
+        }
+        if m.Code == "*" && wildcard == nil {
+            wildcard = &c.Mappings[i]
+        }
+    }
+    if wildcard != nil {
+        return *wildcard, true
+    }
+    return GLMapping{}, false
+}
+
+// JournalLine is the net posting to an account for one cost center and org
+// unit; exactly one of Debit and Credit is non-zero.
+type JournalLine struct {
+    Account     string      `json:"account"`
+    AccountName string      `json:"account_name"`
+    CostCenter  string      `json:"cost_center,omitempty"`
+    OrgUnit     string      `json:"org_unit,omitempty"`
+    Debit       money.Money `json:"debit"`
+    Credit      money.Money `json:"credit"`
+}
+
+// Journal is the general-ledger entry of a run in one currency.
+type Journal struct {
+    RunID       string        `json:"run_id"`
+    Reference   string        `json:"reference"`
+    Date        string        `json:"date"` // pay date, or period end
+    Currency    string        `json:"currency"`
+    Lines       []JournalLine `json:"lines"`
+    TotalDebit  money.Money   `json:"total_debit"`
+    TotalCredit money.Money   `json:"total_credit"`
+    Balanced    bool          `json:"balanced"`
+}
+
+// Journal builds the journal of a finalized or paid run, one per payslip
+// currency. Lines are grouped by the cost center and org unit of each
+// employee's job at the end of the period. A payslip line the chart does not
+// map is an *ExportValidationError; the journals are returned unchecked for
+// balance so they can be previewed.
+func (s *PayrollRunService) Journal(ctx context.Context, runID string, chart *ChartOfAccounts) ([]Journal, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.Status != models.RunFinalized && run.Status != models.RunPaid {
+        return nil, fmt.Errorf("%w: only finalized runs are journalized, run is %s", ErrRunState, run.Status)
+    }
+    slips, err := s.store.ListPayslips(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    date := run.PayDate
+    if date == "" {
+        date = run.PeriodEnd
+    }
+
+    type key struct{ currency, costCenter, orgUnit, account string }
+    // positive amounts are debits, negative ones credits
+    balances := map[key]money.Money{}
+    post := func(k key, amt money.Money) {
+        if b, ok := balances[k]; ok {
+            amt = b.Add(amt)
+        }
+        balances[k] = amt
+    }
+    var problems []string
+    unmapped := map[string]bool{}
+    for _, p := range slips {
+        var costCenter, orgUnit string
+        if emp, err := s.employees.Get(ctx, p.EmployeeID); err == nil {
+            costCenter, orgUnit = jobAssignment(emp, run.PeriodEnd)
+        }
+        at := func(account string) key { return key{p.Currency, costCenter, orgUnit, account} }
+        for _, l := range p.Lines {
+            m, ok := chart.mapping(l.Kind, l.Code)
+            if !ok {
+                if id := l.Kind + " " + l.Code; !unmapped[id] {
+                    unmapped[id] = true
+                    problems = append(problems, fmt.Sprintf("%s line %s has no account mapping", l.Kind, l.Code))
+                }
+                continue
+            }
+            switch l.Kind {
+            case models.LineEarning:
+                post(at(m.Debit), l.Amount)
+            case models.LineEmployer:
+                post(at(m.Debit), l.Amount)
+                post(at(m.Credit), l.Amount.Neg())
+            default:
+                post(at(m.Credit), l.Amount.Neg())
+            }
+        }
+        post(at(chart.NetPay), p.Net.Neg())
+    }
+    if len(problems) > 0 {
+        return nil, &ExportValidationError{Problems: problems}
+    }
+
+    byCurrency := map[string]*Journal{}
+    var out []*Journal
+    for k, amt := range balances {
+        amt = amt.Round(money.HalfEven)
+        if amt.IsZero() {
+            continue
+        }
+        j := byCurrency[k.currency]
+        if j == nil {
+            j = &Journal{RunID: runID, Reference: "PAYROLL-" + runID, Date: date, Currency: k.currency,
+                TotalDebit: money.Zero(k.currency), TotalCredit: money.Zero(k.currency)}
+            byCurrency[k.currency] = j
+            out = append(out, j)
+        }
+        line := JournalLine{Account: k.account, AccountName: chart.names[k.account], CostCenter: k.costCenter, OrgUnit: k.orgUnit,
+            Debit: money.Zero(k.currency), Credit: money.Zero(k.currency)}
+        if amt.Sign() > 0 {
+            line.Debit = amt
+            j.TotalDebit = j.TotalDebit.Add(amt)
+        } else {
+            line.Credit = amt.Neg()
+            j.TotalCredit = j.TotalCredit.Add(amt.Neg())
+        }
+        j.Lines = append(j.Lines, line)
+    }
+    sort.Slice(out, func(i, k int) bool { return out[i].Currency < out[k].Currency })
+    journals := make([]Journal, 0, len(out))
+    for _, j := range out {
+        // debits first, then by cost center, org unit and account
+        sort.Slice(j.Lines, func(a, b int) bool {
+            x, y := j.Lines[a], j.Lines[b]
+            if dx, dy := x.Debit.Sign() > 0, y.Debit.Sign() > 0; dx != dy {
+                return dx
+            }
+            if x.CostCenter != y.CostCenter {
+                return x.CostCenter < y.CostCenter
+            }
+            if x.OrgUnit != y.OrgUnit {
+                return x.OrgUnit < y.OrgUnit
+            }
+            return x.Account < y.Account
+        })
+        j.Balanced = j.TotalDebit.Equal(j.TotalCredit)
+        journals = append(journals, *j)
+    }
+    return journals, nil
+}
+
+// GLExport writes the run's journal in currency ("" for the default) as csv
+// or json and records it on the run. A journal whose debits and credits
+// differ is refused with ErrJournalUnbalanced. As with bank files, a second
+// export is refused until the earlier one is voided.
+func (s *PayrollRunService) GLExport(ctx context.Context, actor, runID string, chart *ChartOfAccounts, currency, format string) (*ExportFile, error) {
+    if currency == "" {
+        currency = money.DefaultCurrency
+    }
+    if format != "csv" && format != "json" {
+        return nil, fmt.Errorf("%w: format must be csv or json", ErrInvalidPayrollRequest)
+    }
+    journals, err := s.Journal(ctx, runID, chart)
+    if err != nil {
+        return nil, err
+    }
+    var j *Journal
+    for i := range journals {
+        if journals[i].Currency == currency {
+            j = &journals[i]
+        }
+    }
+    if j == nil {
+        return nil, &ExportValidationError{Problems: []string{fmt.Sprintf("no %s payslips to journalize", currency)}}
+    }
+    if !j.Balanced {
+        return nil, fmt.Errorf("%w: debits %s, credits %s", ErrJournalUnbalanced, j.TotalDebit, j.TotalCredit)
+    }
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range run.Exports {
+        if e.Kind == models.ExportGL && e.Currency == currency && e.VoidedAt == 0 {
+            return nil, fmt.Errorf("%w: %s", ErrAlreadyExported, e.ExportID)
+        }
+    }
+
+    var content []byte
+    if format == "json" {
+        if content, err = json.MarshalIndent(j, "", "  "); err != nil {
+            return nil, err
+        }
+    } else {
+        records := [][]string{{"date", "reference", "currency", "account", "account_name", "cost_center", "org_unit", "debit", "credit", "memo"}}
+        memo := fmt.Sprintf("Payroll %s to %s", run.PeriodStart, run.PeriodEnd)
+        for _, l := range j.Lines {
+            records = append(records, []string{j.Date, j.Reference, j.Currency, l.Account, l.AccountName, l.CostCenter, l.OrgUnit, l.Debit.String(), l.Credit.String(), memo})
+        }
+        if content, err = writeCSV(records); err != nil {
+            return nil, err
+        }
+    }
+    sum := sha256.Sum256(content)
+    now := s.now()
+    e := models.RunExport{
+        ExportID:  fmt.Sprintf("exp-%d-%d", now.UnixNano(), atomic.AddInt64(&exportSeq, 1)),
+        Kind:      models.ExportGL,
+        Layout:    format,
+        FileName:  fmt.Sprintf("journal-%s-%s.%s", runID, strings.ToLower(currency), format),
+        Checksum:  hex.EncodeToString(sum[:]),
+        Records:   len(j.Lines),
+        Currency:  currency,
+        Total:     j.TotalDebit,
+        Reference: j.Reference,
+        CreatedBy: actor,
+        CreatedAt: now.Unix(),
+    }
+    run.Exports = append(run.Exports, e)
+    run.Version++
+    if err := s.store.SaveRun(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.export", runID, map[string]interface{}{
+        "export_id": e.ExportID, "kind": e.Kind, "layout": e.Layout, "checksum": e.Checksum, "records": e.Records, "total": e.Total.String(),
+    }); err != nil {
+        return nil, err
+    }
+    return &ExportFile{Export: e, Content: content}, nil
+}
+
+// jobAssignment returns the cost center and org unit of the latest job
+// started on or before date, so a separated employee's final pay is booked
+// where they last worked. Jobs without an org unit fall back to their
+// department.
+func jobAssignment(emp map[string]interface{}, date string) (costCenter, orgUnit string) {
+    raw, ok := emp["job_history"]
+    if !ok || raw == nil {
+        return "", ""
+    }
+    b, err := bson.Marshal(bson.M{"j": raw})
+    if err != nil {
+        return "", ""
+    }
+    var out struct {
+        J []models.JobHistoryEntry `bson:"j"`
+    }
+    if err := bson.Unmarshal(b, &out); err != nil {
+        return "", ""
+    }
+    var current *models.JobHistoryEntry
+    for i, j := range out.J {
+        if j.StartDate > date {
+            continue
+        }
+        if current == nil || j.StartDate >= current.StartDate {
+            current = &out.J[i]
+        }
+    }
+    if current == nil {
+        return "", ""
+    }
+    orgUnit = current.OrgUnitID
+    if orgUnit == "" {
+        orgUnit = current.Department
+    }
+    return current.CostCenter, orgUnit
+}
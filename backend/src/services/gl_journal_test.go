@@ -0,0 +1,104 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestPayrollRunService_GLJournal(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    salary := func(amount float64) []interface{} {
+        return []interface{}{map[string]interface{}{"type": "salary", "amount": amount, "effective_date": "2025-01-01"}}
+    }
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "compensation_records": salary(30000), "job_history": []interface{}{
+        map[string]interface{}{"title": "Clerk", "department": "Sales", "start_date": "2024-01-01", "end_date": "2024-12-31"},
+        map[string]interface{}{"title": "Analyst", "org_unit_id": "OU-OPS", "cost_center": "CC-100", "start_date": "2025-01-01"},
+    }})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-2", "compensation_records": salary(20000), "job_history": []interface{}{
+        map[string]interface{}{"title": "Associate", "department": "Sales", "cost_center": "CC-200", "start_date": "2025-01-01"},
+    }})
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    engine := NewPayrollService(emps, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    runs := NewPayrollRunService(NewInMemoryPayrollRunStore(), emps, engine, NewInMemoryAuditLog(), nil)
+    p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-16", End: "2025-06-30", PayDate: "2025-06-30"})
+    run, err := runs.CreateRun(ctx, "clerk", p.PeriodID)
+    if err != nil {
+        t.Fatalf("run: %v", err)
+    }
+    chart, err := DefaultChartOfAccounts()
+    if err != nil {
+        t.Fatalf("chart: %v", err)
+    }
+    if _, err := runs.Journal(ctx, run.RunID, chart); !errors.Is(err, ErrRunState) {
+        t.Fatalf("draft journalized: %v", err)
+    }
+    closeRun(t, runs, run.RunID)
+
+    journals, err := runs.Journal(ctx, run.RunID, chart)
+    if err != nil || len(journals) != 1 {
+        t.Fatalf("journal: %v %+v", err, journals)
+    }
+    j := journals[0]
+    if !j.Balanced || j.Date != "2025-06-30" || j.Currency != "PHP" {
+        t.Fatalf("journal: %+v", j)
+    }
+    debits := map[string]string{}
+    for _, l := range j.Lines {
+        if l.Debit.Sign() > 0 == (l.Credit.Sign() > 0) {
+            t.Fatalf("line posts both sides: %+v", l)
+        }
+        if l.Account == "6100" {
+            debits[l.CostCenter+"/"+l.OrgUnit] = l.Debit.String()
+        }
+    }
+    // half a month's salary, booked where each employee works
+    if debits["CC-100/OU-OPS"] != "15000.00" || debits["CC-200/Sales"] != "10000.00" || len(debits) != 2 {
+        t.Fatalf("salary debits: %v", debits)
+    }
+
+    // every line must have an account
+    partial, _ := LoadChartOfAccounts([]byte(`{"accounts":[{"number":"2100"},{"number":"6100"}],"net_pay":"2100","mappings":[{"kind":"earning","code":"*","debit":"6100"}]}`))
+    var invalid *ExportValidationError
+    if _, err := runs.Journal(ctx, run.RunID, partial); !errors.As(err, &invalid) || !strings.Contains(strings.Join(invalid.Problems, "; "), "contribution line sss_ee has no account mapping") {
+        t.Fatalf("expected unmapped lines, got %v", err)
+    }
+    if _, err := LoadChartOfAccounts([]byte(`{"accounts":[{"number":"2100"}],"net_pay":"2100","mappings":[{"kind":"employer","code":"sss_er","debit":"2100"}]}`)); err == nil {
+        t.Fatalf("employer mapping without credit account accepted")
+    }
+
+    f, err := runs.GLExport(ctx, "finance", run.RunID, chart, "", "csv")
+    if err != nil {
+        t.Fatalf("export: %v", err)
+    }
+    rows := strings.Split(strings.TrimSuffix(string(f.Content), "\r\n"), "\r\n")
+    if len(rows) != len(j.Lines)+1 || rows[0] != "date,reference,currency,account,account_name,cost_center,org_unit,debit,credit,memo" ||
+        f.Export.Kind != models.ExportGL || !f.Export.Total.Equal(j.TotalDebit) {
+        t.Fatalf("csv:\n%s", f.Content)
+    }
+    if _, err := runs.GLExport(ctx, "finance", run.RunID, chart, "", "json"); !errors.Is(err, ErrAlreadyExported) {
+        t.Fatalf("expected ErrAlreadyExported, got %v", err)
+    }
+    if _, err := runs.VoidExport(ctx, "finance", run.RunID, f.Export.ExportID, "posted to the wrong period"); err != nil {
+        t.Fatalf("void: %v", err)
+    }
+    if f, err := runs.GLExport(ctx, "finance", run.RunID, chart, "", "json"); err != nil || !strings.Contains(string(f.Content), `"balanced": true`) {
+        t.Fatalf("json: %v", err)
+    }
+
+    // a payslip whose net pay does not follow from its lines cannot be posted
+    slips, _ := runs.store.ListPayslips(ctx, run.RunID)
+    slips[0].Net = slips[0].Net.Add(money.MustParse("0.01", "PHP"))
+    _ = runs.store.ReplacePayslips(ctx, run.RunID, slips)
+    if journals, _ := runs.Journal(ctx, run.RunID, chart); journals[0].Balanced {
+        t.Fatalf("tampered journal balanced")
+    }
+    if _, err := runs.GLExport(ctx, "finance", run.RunID, chart, "", "csv"); !errors.Is(err, ErrJournalUnbalanced) {
+        t.Fatalf("expected ErrJournalUnbalanced, got %v", err)
+    }
+}
@@ -0,0 +1,694 @@
+package services
+
+import (
+    "bufio"
+    "context"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCalendar wraps malformed holidays, holiday files and work weeks.
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+// DefaultWorkWeek is the work week of employees with no pattern of their own.
+const DefaultWorkWeek = "default"
+
+// maxCalendarDays bounds the range a calendar query may span.
+const maxCalendarDays = 2 * 366
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// WorkWeek is a named pattern of working weekdays; the other days are rest
+// days.
+type WorkWeek struct {
+    Name string   `json:"name"`
+    Days []string `json:"days"`
+    work [7]bool
+}
+
+// ParseWorkWeeks parses "six_day=mon-sat;night=sun-thu;split=mon,wed,fri".
+// Ranges may wrap around the week. A "default" pattern replaces Monday to
+// Friday.
+func ParseWorkWeeks(spec string) ([]WorkWeek, error) {
+    weeks := []WorkWeek{newWorkWeek(DefaultWorkWeek, [7]bool{false, true, true, true, true, true, false})}
+    for _, pair := range strings.Split(spec, ";") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+        i := strings.Index(pair, "=")
+        if i <= 0 {
+            return nil, fmt.Errorf("%w: work week %q", ErrInvalidCalendar, pair)
+        }
+        name := strings.ToLower(strings.TrimSpace(pair[:i]))
+        var work [7]bool
+        for _, part := range strings.Split(pair[i+1:], ",") {
+            from, to := part, part
+            if j := strings.Index(part, "-"); j >= 0 {
+                from, to = part[:j], part[j+1:]
+            }
+            a, b := weekdayIndex(from), weekdayIndex(to)
+            if a < 0 || b < 0 {
+                return nil, fmt.Errorf("%w: work week %s: unknown day in %q", ErrInvalidCalendar, name, part)
+            }
+            for d := a; ; d = (d + 1) % 7 {
+                work[d] = true
+                if d == b {
+                    break
+                }
+            }
+        }
+        w := newWorkWeek(name, work)
+        if name == DefaultWorkWeek {
+            weeks[0] = w
+        } else {
+            weeks = append(weeks, w)
+        }
+    }
+    return weeks, nil
+}
+
+func weekdayIndex(name string) int {
+    name = strings.ToLower(strings.TrimSpace(name))
+    for i, n := range weekdayNames {
+        if len(name) >= 3 && strings.HasPrefix(name, n) {
+            return i
+        }
+    }
+    return -1
+}
+
+func newWorkWeek(name string, work [7]bool) WorkWeek {
+    w := WorkWeek{Name: name, Days: []string{}, work: work}
+    for i, ok := range work {
+        if ok {
+            w.Days = append(w.Days, weekdayNames[i])
+        }
+    }
+    return w
+}
+
+// CalendarDay is one day of an employee's calendar. Premium is the multiple
+// of the daily rate earned for working it under the Labor Code: 1.30 on a
+// rest day or special non-working holiday (1.50 when both), 2.00 on a
+// regular holiday (2.60 on a rest day) and 3.00 on a double regular holiday
+// (3.90 on a rest day).
+type CalendarDay struct {
+    Date     string           `json:"date"`
+    Weekday  string           `json:"weekday"`
+    RestDay  bool             `json:"rest_day"`
+    Holidays []models.Holiday `json:"holidays,omitempty"`
+    Working  bool             `json:"working"`
+    Premium  string           `json:"premium"`
+}
+
+// regular counts the day's regular holidays.
+func (d CalendarDay) regular() int {
+    n := 0
+    for _, h := range d.Holidays {
+        if h.Kind == models.HolidayRegular {
+            n++
+        }
+    }
+    return n
+}
+
+func dayPremium(restDay bool, regular, special int) string {
+    switch {
+    case regular >= 2 && restDay:
+        return "3.90"
+    case regular >= 2:
+        return "3.00"
+    case regular == 1 && restDay:
+        return "2.60"
+    case regular == 1:
+        return "2.00"
+    case special > 0 && restDay:
+        return "1.50"
+    case special > 0, restDay:
+        return "1.30"
+    }
+    return "1.00"
+}
+
+// HolidayFilter selects holidays; empty fields match all. A Location keeps
+// the nationwide holidays and those of that location.
+type HolidayFilter struct {
+    From     string
+    To       string
+    Location string
+}
+
+func (f HolidayFilter) match(h models.Holiday) bool {
+    return (f.From == "" || h.Date >= f.From) &&
+        (f.To == "" || h.Date <= f.To) &&
+        (f.Location == "" || h.Location == "" || strings.EqualFold(h.Location, f.Location))
+}
+
+// HolidayStore persists holidays.
+type HolidayStore interface {
+    Save(ctx context.Context, holidays []models.Holiday) error
+    List(ctx context.Context, f HolidayFilter) ([]models.Holiday, error)
+    Delete(ctx context.Context, holidayID string) error
+}
+
+var holidaySeq int64
+
+// HolidayCalendar keeps the holiday calendar and the work-week patterns and
+// answers which days an employee works. An employee follows the pattern
+// named by their work_week field, else the one named by their shift, else
+// the default; holidays apply when nationwide or at their location.
+type HolidayCalendar struct {
+    store HolidayStore
+    audit AuditLog
+    weeks []WorkWeek
+    now   func() time.Time
+}
+
+// NewHolidayCalendar creates the calendar; no weeks means a Monday to Friday
+// default.
+func NewHolidayCalendar(store HolidayStore, audit AuditLog, weeks []WorkWeek) *HolidayCalendar {
+    if len(weeks) == 0 {
+        weeks, _ = ParseWorkWeeks("")
+    }
+    return &HolidayCalendar{store: store, audit: audit, weeks: weeks, now: time.Now}
+}
+
+// WorkWeeks returns the work-week patterns.
+func (c *HolidayCalendar) WorkWeeks() []WorkWeek {
+    return append([]WorkWeek(nil), c.weeks...)
+}
+
+func (c *HolidayCalendar) workWeek(name string) (WorkWeek, bool) {
+    for _, w := range c.weeks {
+        if w.Name == strings.ToLower(name) {
+            return w, true
+        }
+    }
+    return WorkWeek{}, false
+}
+
+// employeeWeek resolves the employee's work week.
+func (c *HolidayCalendar) employeeWeek(emp map[string]interface{}) (WorkWeek, error) {
+    if name, _ := emp["work_week"].(string); name != "" {
+        w, ok := c.workWeek(name)
+        if !ok {
+            return WorkWeek{}, fmt.Errorf("%w: unknown work week %q", ErrInvalidCalendar, name)
+        }
+        return w, nil
+    }
+    if shift, _ := emp["shift"].(string); shift != "" {
+        if w, ok := c.workWeek(shift); ok {
+            return w, nil
+        }
+    }
+    w, _ := c.workWeek(DefaultWorkWeek)
+    return w, nil
+}
+
+// normalizeHoliday checks h and canonicalizes its kind.
+func normalizeHoliday(h *models.Holiday) error {
+    h.Name, h.Location = strings.TrimSpace(h.Name), strings.TrimSpace(h.Location)
+    switch strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(h.Kind))) {
+    case "regular", "regular_holiday":
+        h.Kind = models.HolidayRegular
+    case "special", "special_non_working", "special_holiday", "special_non_working_holiday":
+        h.Kind = models.HolidaySpecial
+    default:
+        return fmt.Errorf("%w: %s %s: kind must be regular or special_non_working", ErrInvalidCalendar, h.Date, h.Name)
+    }
+    switch {
+    case !validDate(h.Date):
+        return fmt.Errorf("%w: %q: date must be YYYY-MM-DD", ErrInvalidCalendar, h.Date)
+    case h.Name == "":
+        return fmt.Errorf("%w: %s: name required", ErrInvalidCalendar, h.Date)
+    }
+    return nil
+}
+
+// Add validates and saves holidays; nothing is saved if any is invalid. A
+// holiday with the date, name and location of a saved one replaces it.
+func (c *HolidayCalendar) Add(ctx context.Context, actor, source string, holidays []models.Holiday) ([]models.Holiday, error) {
+    if len(holidays) == 0 {
+        return nil, fmt.Errorf("%w: no holidays", ErrInvalidCalendar)
+    }
+    for i := range holidays {
+        if err := normalizeHoliday(&holidays[i]); err != nil {
+            return nil, err
+        }
+    }
+    sort.SliceStable(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+    existing, err := c.store.List(ctx, HolidayFilter{From: holidays[0].Date, To: holidays[len(holidays)-1].Date})
+    if err != nil {
+        return nil, err
+    }
+    key := func(h models.Holiday) string {
+        return h.Date + "|" + strings.ToLower(h.Location) + "|" + strings.ToLower(h.Name)
+    }
+    ids := map[string]string{}
+    for _, h := range existing {
+        ids[key(h)] = h.HolidayID
+    }
+    now := c.now()
+    for i := range holidays {
+        h := &holidays[i]
+        if h.HolidayID = ids[key(*h)]; h.HolidayID == "" {
+            h.HolidayID = fmt.Sprintf("hol-%d-%d", now.UnixNano(), atomic.AddInt64(&holidaySeq, 1))
+            ids[key(*h)] = h.HolidayID
+        }
+        if h.Source == "" {
+            h.Source = source
+        }
+        h.CreatedBy, h.CreatedAt = actor, now.Unix()
+    }
+    if err := c.store.Save(ctx, holidays); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, c.audit, actor, "holiday.save", "holidays", map[string]interface{}{
+        "source": source, "count": len(holidays), "from": holidays[0].Date, "to": holidays[len(holidays)-1].Date,
+    }); err != nil {
+        return nil, err
+    }
+    return holidays, nil
+}
+
+// ImportCSV adds the holidays of a CSV with date, name and kind columns and
+// optional location and source columns.
+func (c *HolidayCalendar) ImportCSV(ctx context.Context, actor string, r io.Reader) ([]models.Holiday, error) {
+    cr := csv.NewReader(r)
+    cr.TrimLeadingSpace = true
+    rows, err := cr.ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+    }
+    if len(rows) == 0 {
+        return nil, fmt.Errorf("%w: empty file", ErrInvalidCalendar)
+    }
+    col := map[string]int{}
+    for i, h := range rows[0] {
+        col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+    }
+    for _, h := range []string{"date", "name", "kind"} {
+        if _, ok := col[h]; !ok {
+            return nil, fmt.Errorf("%w: header must name date, name and kind", ErrInvalidCalendar)
+        }
+    }
+    get := func(row []string, h string) string {
+        if i, ok := col[h]; ok && i < len(row) {
+            return strings.TrimSpace(row[i])
+        }
+        return ""
+    }
+    var holidays []models.Holiday
+    for _, row := range rows[1:] {
+        if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+            continue
+        }
+        holidays = append(holidays, models.Holiday{Date: get(row, "date"), Name: get(row, "name"), Kind: get(row, "kind"), Location: get(row, "location"), Source: get(row, "source")})
+    }
+    return c.Add(ctx, actor, "csv", holidays)
+}
+
+// ImportICal adds the all-day events of an iCalendar file as holidays of
+// kind at location (empty for nationwide). An event whose CATEGORIES name a
+// regular or special holiday takes that kind instead; multi-day events add
+// one holiday a day.
+func (c *HolidayCalendar) ImportICal(ctx context.Context, actor string, r io.Reader, kind, location string) ([]models.Holiday, error) {
+    lines, err := unfoldICal(r)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+    }
+    var (
+        holidays []models.Holiday
+        ev       map[string]string
+    )
+    for _, line := range lines {
+        switch {
+        case line == "BEGIN:VEVENT":
+            ev = map[string]string{}
+        case line == "END:VEVENT" && ev != nil:
+            hs, err := icalHolidays(ev, kind, location)
+            if err != nil {
+                return nil, err
+            }
+            holidays = append(holidays, hs...)
+            ev = nil
+        case ev != nil:
+            i := strings.Index(line, ":")
+            if i <= 0 {
+                continue
+            }
+            // drop parameters such as DTSTART;VALUE=DATE
+            name := strings.ToUpper(strings.SplitN(line[:i], ";", 2)[0])
+            ev[name] = line[i+1:]
+        }
+    }
+    return c.Add(ctx, actor, "ical", holidays)
+}
+
+// unfoldICal joins the continuation lines of an iCalendar file.
+func unfoldICal(r io.Reader) ([]string, error) {
+    sc := bufio.NewScanner(r)
+    var out []string
+    for sc.Scan() {
+        line := strings.TrimRight(sc.Text(), "\r")
+        if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(out) > 0 {
+            out[len(out)-1] += line[1:]
+            continue
+        }
+        out = append(out, strings.TrimPrefix(line, "\ufeff"))
+    }
+    return out, sc.Err()
+}
+
+func icalHolidays(ev map[string]string, kind, location string) ([]models.Holiday, error) {
+    summary := strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(ev["SUMMARY"])
+    start, err := icalDate(ev["DTSTART"])
+    if err != nil {
+        return nil, fmt.Errorf("%w: %s: DTSTART %q", ErrInvalidCalendar, summary, ev["DTSTART"])
+    }
+    // DTEND of an all-day event is the day after it ends
+    end := start.AddDate(0, 0, 1)
+    if ev["DTEND"] != "" {
+        if end, err = icalDate(ev["DTEND"]); err != nil || end.Before(start) {
+            return nil, fmt.Errorf("%w: %s: DTEND %q", ErrInvalidCalendar, summary, ev["DTEND"])
+        }
+        if end.Equal(start) {
+            end = start.AddDate(0, 0, 1)
+        }
+    }
+    if cat := strings.ToLower(ev["CATEGORIES"]); strings.Contains(cat, "regular") {
+        kind = models.HolidayRegular
+    } else if strings.Contains(cat, "special") {
+        kind = models.HolidaySpecial
+    }
+    var out []models.Holiday
+    for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+        out = append(out, models.Holiday{Date: d.Format("2006-01-02"), Name: summary, Kind: kind, Location: location})
+    }
+    return out, nil
+}
+
+func icalDate(v string) (time.Time, error) {
+    if len(v) < 8 {
+        return time.Time{}, errors.New("short date")
+    }
+    return time.Parse("20060102", v[:8])
+}
+
+// List returns holidays by date.
+func (c *HolidayCalendar) List(ctx context.Context, f HolidayFilter) ([]models.Holiday, error) {
+    return c.store.List(ctx, f)
+}
+
+// Delete removes a holiday.
+func (c *HolidayCalendar) Delete(ctx context.Context, actor, holidayID string) error {
+    if err := c.store.Delete(ctx, holidayID); err != nil {
+        return err
+    }
+    return recordAudit(ctx, c.audit, actor, "holiday.delete", holidayID, nil)
+}
+
+// Days returns the employee's calendar from from to to inclusive.
+func (c *HolidayCalendar) Days(ctx context.Context, emp map[string]interface{}, from, to string) ([]CalendarDay, error) {
+    start, err := time.Parse("2006-01-02", from)
+    if err != nil {
+        return nil, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidCalendar)
+    }
+    end, err := time.Parse("2006-01-02", to)
+    if err != nil {
+        return nil, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidCalendar)
+    }
+    if end.Before(start) || end.Sub(start) > maxCalendarDays*24*time.Hour {
+        return nil, fmt.Errorf("%w: range must run forwards over at most %d days", ErrInvalidCalendar, maxCalendarDays)
+    }
+    week, err := c.employeeWeek(emp)
+    if err != nil {
+        return nil, err
+    }
+    location, _ := emp["location"].(string)
+    holidays, err := c.store.List(ctx, HolidayFilter{From: from, To: to})
+    if err != nil {
+        return nil, err
+    }
+    byDate := map[string][]models.Holiday{}
+    for _, h := range holidays {
+        if h.Location == "" || (location != "" && strings.EqualFold(h.Location, location)) {
+            byDate[h.Date] = append(byDate[h.Date], h)
+        }
+    }
+    var out []CalendarDay
+    for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+        day := CalendarDay{Date: d.Format("2006-01-02"), Weekday: weekdayNames[d.Weekday()], RestDay: !week.work[d.Weekday()]}
+        day.Holidays = byDate[day.Date]
+        regular := day.regular()
+        day.Working = !day.RestDay && len(day.Holidays) == 0
+        day.Premium = dayPremium(day.RestDay, regular, len(day.Holidays)-regular)
+        out = append(out, day)
+    }
+    return out, nil
+}
+
+// WorkingDays counts the employee's working days from start to end
+// inclusive, leaving out rest days and holidays. A half-day start (leave
+// from noon) or end (leave until noon) counts that day as half; a one-day
+// span with either is half a day.
+func (c *HolidayCalendar) WorkingDays(ctx context.Context, emp map[string]interface{}, start, end string, startHalf, endHalf bool) (float64, error) {
+    days, err := c.Days(ctx, emp, start, end)
+    if err != nil {
+        return 0, err
+    }
+    n := 0.0
+    for i, d := range days {
+        if !d.Working {
+            continue
+        }
+        switch {
+        case (i == 0 && startHalf) || (i == len(days)-1 && endHalf):
+            n += 0.5
+        default:
+            n++
+        }
+    }
+    return n, nil
+}
+
+// HolidayPayRule pays work on holidays and rest days at the calendar's
+// premium, and regular holidays not worked to daily-rated employees. A
+// monthly salary already pays working days and holidays, so only the
+// premium above the day's pay is added for those; rest days, and all
+// holiday work of daily-rated employees, are paid in full.
+type HolidayPayRule struct {
+    Calendar *HolidayCalendar
+}
+
+func (HolidayPayRule) Name() string { return "holiday_pay" }
+
+func (r HolidayPayRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    if pc.Request.OffCycle {
+        return nil, nil
+    }
+    daily := pc.Salary.Basis == "daily"
+    if len(pc.Attendance.HolidayWork) == 0 && !daily {
+        return nil, nil
+    }
+    days, err := r.Calendar.Days(pc.Ctx, pc.Employee, pc.Request.PeriodStart, pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    byDate := map[string]CalendarDay{}
+    for _, d := range days {
+        byDate[d.Date] = d
+    }
+    var lines []models.PayslipLine
+    hourly := pc.HourlyRate()
+    worked := map[string]bool{}
+    for _, w := range pc.Attendance.HolidayWork {
+        d, ok := byDate[w.Date]
+        switch {
+        case !ok:
+            return nil, fmt.Errorf("holiday work on %s is outside the period", w.Date)
+        case d.Working:
+            return nil, fmt.Errorf("%s is an ordinary working day, not a holiday or rest day", w.Date)
+        case w.Hours <= 0:
+            continue
+        }
+        worked[w.Date] = true
+        paid := "0"
+        if !daily && !d.RestDay {
+            paid = "1"
+        }
+        rate, _ := new(big.Rat).SetString(d.Premium)
+        covered, _ := new(big.Rat).SetString(paid)
+        amt, err := hourly.MulRate(qty(w.Hours), money.HalfEven)
+        if err == nil {
+            amt, err = amt.MulRate(rate.Sub(rate, covered).FloatString(2), money.HalfEven)
+        }
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: "holiday_premium", Label: premiumLabel(d) + " (" + d.Date + ")", Kind: models.LineEarning, Amount: amt, Taxable: true,
+            Inputs:  map[string]string{"hourly_rate": hourly.String(), "hours": qty(w.Hours), "premium": d.Premium, "paid": paid},
+            Formula: "hourly_rate × hours × (premium − paid)",
+        })
+    }
+    if daily {
+        n := 0
+        for _, d := range days {
+            if !d.RestDay && d.regular() > 0 && !worked[d.Date] {
+                n++
+            }
+        }
+        if n > 0 {
+            rate := pc.DailyRate()
+            lines = append(lines, models.PayslipLine{
+                Code: "holiday_pay", Label: "Regular holiday pay", Kind: models.LineEarning, Amount: rate.MulRatio(int64(n), 1, money.HalfEven), Taxable: true,
+                Inputs:  map[string]string{"daily_rate": rate.String(), "regular_holidays": qty(float64(n))},
+                Formula: "daily_rate × regular_holidays",
+            })
+        }
+    }
+    return lines, nil
+}
+
+func premiumLabel(d CalendarDay) string {
+    switch regular := d.regular(); {
+    case regular >= 2:
+        return "Double holiday premium"
+    case regular == 1:
+        return "Regular holiday premium"
+    case len(d.Holidays) > 0:
+        return "Special holiday premium"
+    }
+    return "Rest day premium"
+}
+
+// InMemoryHolidayStore keeps holidays in memory.
+type InMemoryHolidayStore struct {
+    mu sync.Mutex
+    m  map[string]models.Holiday
+}
+
+func NewInMemoryHolidayStore() *InMemoryHolidayStore {
+    return &InMemoryHolidayStore{m: map[string]models.Holiday{}}
+}
+
+func (s *InMemoryHolidayStore) Save(ctx context.Context, holidays []models.Holiday) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, h := range holidays {
+        s.m[h.HolidayID] = h
+    }
+    return nil
+}
+
+func (s *InMemoryHolidayStore) List(ctx context.Context, f HolidayFilter) ([]models.Holiday, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.Holiday{}
+    for _, h := range s.m {
+        if f.match(h) {
+            out = append(out, h)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Date != out[j].Date {
+            return out[i].Date < out[j].Date
+        }
+        return out[i].HolidayID < out[j].HolidayID
+    })
+    return out, nil
+}
+
+func (s *InMemoryHolidayStore) Delete(ctx context.Context, holidayID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.m[holidayID]; !ok {
+        return mongo.ErrNoDocuments
+    }
+    delete(s.m, holidayID)
+    return nil
+}
+
+// MongoHolidayStore stores holidays in MongoDB.
+type MongoHolidayStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoHolidayStore(coll *mongo.Collection) *MongoHolidayStore {
+    return &MongoHolidayStore{coll: coll}
+}
+
+// EnsureIndexes makes holiday ids unique and indexes the date.
+func (s *MongoHolidayStore) EnsureIndexes(ctx context.Context) error {
+    _, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.D{{Key: "holiday_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "date", Value: 1}}},
+    })
+    return err
+}
+
+func (s *MongoHolidayStore) Save(ctx context.Context, holidays []models.Holiday) error {
+    for _, h := range holidays {
+        if _, err := s.coll.ReplaceOne(ctx, bson.M{"holiday_id": h.HolidayID}, h, options.Replace().SetUpsert(true)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *MongoHolidayStore) List(ctx context.Context, f HolidayFilter) ([]models.Holiday, error) {
+    filter := bson.M{}
+    date := bson.M{}
+    if f.From != "" {
+        date["$gte"] = f.From
+    }
+    if f.To != "" {
+        date["$lte"] = f.To
+    }
+    if len(date) > 0 {
+        filter["date"] = date
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "holiday_id", Value: 1}}))
+    if err != nil {
+        return nil, err
+    }
+    var all []models.Holiday
+    if err := cur.All(ctx, &all); err != nil {
+        return nil, err
+    }
+    // locations match case-insensitively
+    out := []models.Holiday{}
+    for _, h := range all {
+        if f.match(h) {
+            out = append(out, h)
+        }
+    }
+    return out, nil
+}
+
+func (s *MongoHolidayStore) Delete(ctx context.Context, holidayID string) error {
+    res, err := s.coll.DeleteOne(ctx, bson.M{"holiday_id": holidayID})
+    if err != nil {
+        return err
+    }
+    if res.DeletedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
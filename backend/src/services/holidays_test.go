@@ -0,0 +1,180 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+const testHolidaysCSV = "date,name,kind,location\r\n" +
+    "2025-06-12,Independence Day,regular,\r\n" +
+    "2025-06-06,Cebu charter day,special,cebu\r\n" +
+    "2025-06-09,Davao day,special,Davao\r\n"
+
+const testHolidaysICal = "BEGIN:VCALENDAR\r\n" +
+    "BEGIN:VEVENT\r\n" +
+    "DTSTART;VALUE=DATE:20251231\r\n" +
+    "DTEND;VALUE=DATE:20260102\r\n" +
+    "SUMMARY:Last day of the year\\, and New Year\r\n" +
+    "CATEGORIES:Special holiday\r\n" +
+    "END:VEVENT\r\n" +
+    "BEGIN:VEVENT\r\n" +
+    "DTSTART;VALUE=DATE:20251225\r\n" +
+    "SUMMARY:Christ\r\n" +
+    " mas Day\r\n" +
+    "END:VEVENT\r\n" +
+    "END:VCALENDAR\r\n"
+
+func newHolidayTestCalendar(t *testing.T) (*HolidayCalendar, *InMemoryAuditLog) {
+    t.Helper()
+    weeks, err := ParseWorkWeeks("six_day=mon-sat;night=sun-thu")
+    if err != nil {
+        t.Fatalf("work weeks: %v", err)
+    }
+    audit := NewInMemoryAuditLog()
+    c := NewHolidayCalendar(NewInMemoryHolidayStore(), audit, weeks)
+    if _, err := c.ImportCSV(context.Background(), "hr", strings.NewReader(testHolidaysCSV)); err != nil {
+        t.Fatalf("import: %v", err)
+    }
+    return c, audit
+}
+
+func TestHolidayCalendar_Import(t *testing.T) {
+    ctx := context.Background()
+    c, audit := newHolidayTestCalendar(t)
+
+    items, err := c.ImportICal(ctx, "hr", strings.NewReader(testHolidaysICal), "regular", "")
+    if err != nil || len(items) != 3 {
+        t.Fatalf("ical: %v %+v", err, items)
+    }
+    if items[0].Date != "2025-12-25" || items[0].Name != "Christmas Day" || items[0].Kind != models.HolidayRegular {
+        t.Fatalf("folded event: %+v", items[0])
+    }
+    if items[2].Date != "2026-01-01" || items[2].Name != "Last day of the year, and New Year" || items[2].Kind != models.HolidaySpecial {
+        t.Fatalf("multi-day event: %+v", items[2])
+    }
+    // the same holiday again replaces the saved one
+    again, _ := c.ImportCSV(ctx, "hr", strings.NewReader("date,name,kind\r\n2025-06-12,Independence Day,Regular Holiday\r\n"))
+    all, _ := c.List(ctx, HolidayFilter{})
+    if len(all) != 6 || again[0].HolidayID != all[2].HolidayID {
+        t.Fatalf("reimport: %+v %+v", again, all)
+    }
+    if items, _ := c.List(ctx, HolidayFilter{From: "2025-06-01", To: "2025-06-30", Location: "Cebu"}); len(items) != 2 {
+        t.Fatalf("cebu holidays: %+v", items)
+    }
+
+    for _, bad := range []string{
+        "date,name\r\n2025-06-12,Independence Day\r\n",
+        "date,name,kind\r\n2025-06-12,Independence Day,optional\r\n",
+        "date,name,kind\r\nJune 12,Independence Day,regular\r\n",
+        "date,name,kind\r\n2025-06-12,,regular\r\n",
+    } {
+        if _, err := c.ImportCSV(ctx, "hr", strings.NewReader(bad)); !errors.Is(err, ErrInvalidCalendar) {
+            t.Fatalf("expected ErrInvalidCalendar for %q, got %v", bad, err)
+        }
+    }
+    if _, err := c.ImportICal(ctx, "hr", strings.NewReader("BEGIN:VEVENT\r\nDTSTART:20250101\r\nSUMMARY:New Year\r\nEND:VEVENT\r\n"), "", ""); !errors.Is(err, ErrInvalidCalendar) {
+        t.Fatalf("ical without a kind: %v", err)
+    }
+    if entries, _ := audit.List(ctx, "holidays"); len(entries) != 3 {
+        t.Fatalf("audit: %+v", entries)
+    }
+    if err := c.Delete(ctx, "hr", all[0].HolidayID); err != nil {
+        t.Fatalf("delete: %v", err)
+    }
+    if _, err := ParseWorkWeeks("four_day=mon-thu;x=funday"); !errors.Is(err, ErrInvalidCalendar) {
+        t.Fatalf("expected ErrInvalidCalendar, got %v", err)
+    }
+}
+
+func TestHolidayCalendar_WorkingDays(t *testing.T) {
+    ctx := context.Background()
+    c, _ := newHolidayTestCalendar(t)
+    office := map[string]interface{}{"employee_id": "E-1"}
+    cebu := map[string]interface{}{"employee_id": "E-2", "location": "Cebu", "shift": "six_day"}
+    night := map[string]interface{}{"employee_id": "E-3", "work_week": "night"}
+
+    // June 2 to 13: ten weekdays less Independence Day
+    for _, tc := range []struct {
+        emp        map[string]interface{}
+        start, end string
+        half       [2]bool
+        want       float64
+    }{
+        {office, "2025-06-02", "2025-06-13", [2]bool{}, 9},
+        {cebu, "2025-06-02", "2025-06-13", [2]bool{}, 9}, // Saturday worked, Cebu holiday off
+        {night, "2025-06-01", "2025-06-07", [2]bool{}, 5},
+        {office, "2025-06-02", "2025-06-04", [2]bool{true, true}, 2},
+        {office, "2025-06-02", "2025-06-02", [2]bool{false, true}, 0.5},
+        {office, "2025-06-12", "2025-06-12", [2]bool{true, false}, 0},
+    } {
+        if n, err := c.WorkingDays(ctx, tc.emp, tc.start, tc.end, tc.half[0], tc.half[1]); err != nil || n != tc.want {
+            t.Fatalf("%v %s..%s: got %v %v, want %v", tc.emp["employee_id"], tc.start, tc.end, n, err, tc.want)
+        }
+    }
+
+    days, err := c.Days(ctx, cebu, "2025-06-06", "2025-06-08")
+    if err != nil || len(days) != 3 {
+        t.Fatalf("days: %v %+v", err, days)
+    }
+    if d := days[0]; d.Working || d.Premium != "1.30" || len(d.Holidays) != 1 {
+        t.Fatalf("local special holiday: %+v", d)
+    }
+    if d := days[1]; !d.Working || d.RestDay || d.Premium != "1.00" {
+        t.Fatalf("six-day Saturday: %+v", d)
+    }
+    if d := days[2]; !d.RestDay || d.Premium != "1.30" {
+        t.Fatalf("Sunday: %+v", d)
+    }
+    if _, err := c.WorkingDays(ctx, map[string]interface{}{"work_week": "flexi"}, "2025-06-02", "2025-06-02", false, false); !errors.Is(err, ErrInvalidCalendar) {
+        t.Fatalf("expected ErrInvalidCalendar, got %v", err)
+    }
+}
+
+func TestHolidayPayRule(t *testing.T) {
+    ctx := context.Background()
+    c, _ := newHolidayTestCalendar(t)
+    repo := NewInMemoryEmployeeRepo()
+    _, _ = repo.Create(ctx, map[string]interface{}{"employee_id": "E-1", "location": "Cebu", "compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "amount": 26100.0, "effective_date": "2025-01-01"},
+    }})
+    _, _ = repo.Create(ctx, map[string]interface{}{"employee_id": "E-2", "compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "basis": "daily", "amount": 800.0, "effective_date": "2025-01-01"},
+    }})
+    svc := NewPayrollService(repo, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), append(DefaultPayrollRules(), HolidayPayRule{Calendar: c})...)
+
+    // monthly: 1,200 a day, 150 an hour
+    p, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15", Attendance: &AttendanceSummary{
+        HolidayWork: []models.HolidayWork{{Date: "2025-06-12", Hours: 8}, {Date: "2025-06-06", Hours: 4}, {Date: "2025-06-07", Hours: 8}},
+    }})
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    var amounts []string
+    for _, l := range p.Lines {
+        if l.Code == "holiday_premium" {
+            amounts = append(amounts, l.Label+"="+l.Amount.String())
+        }
+    }
+    if want := "Regular holiday premium (2025-06-12)=1200.00,Special holiday premium (2025-06-06)=180.00,Rest day premium (2025-06-07)=1560.00"; strings.Join(amounts, ",") != want {
+        t.Fatalf("premiums: %v", amounts)
+    }
+    if _, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15", Attendance: &AttendanceSummary{
+        HolidayWork: []models.HolidayWork{{Date: "2025-06-10", Hours: 8}},
+    }}); err == nil {
+        t.Fatal("an ordinary working day was paid as holiday work")
+    }
+
+    // daily-rated: the regular holiday not worked is paid
+    p, err = svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-2", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15", Attendance: &AttendanceSummary{DaysWorked: 10}})
+    if err != nil {
+        t.Fatalf("daily: %v", err)
+    }
+    if l := findLine(p, "holiday_pay"); l == nil || l.Amount.String() != "800.00" {
+        t.Fatalf("holiday pay: %+v", l)
+    }
+}
@@ -0,0 +1,641 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+    // ErrInvalidLeave wraps malformed leave requests.
+    ErrInvalidLeave = errors.New("invalid leave request")
+    // ErrLeaveState is returned for an action the request's status does not allow.
+    ErrLeaveState = errors.New("leave request status does not allow this action")
+    // ErrLeaveForbidden is returned when the actor may not see or act on a request.
+    ErrLeaveForbidden = errors.New("not allowed to act on this leave request")
+    // ErrLeaveOverlap is returned when a request overlaps a pending or approved one.
+    ErrLeaveOverlap = errors.New("leave overlaps another request")
+)
+
+// LeavePolicy configures a leave type. Levels approvals are required,
+// walking up the employee's manager_id chain; when the chain ends early the
+// remaining decision goes to HR.
+type LeavePolicy struct {
+    Type   string `json:"type"`
+    Label  string `json:"label"`
+    Levels int    `json:"levels"`
+}
+
+// DefaultLeavePolicies returns the built-in leave types, each approved by the
+// direct manager.
+func DefaultLeavePolicies() []LeavePolicy {
+    return []LeavePolicy{
+        {Type: "vacation", Label: "Vacation leave", Levels: 1},
+        {Type: "sick", Label: "Sick leave", Levels: 1},
+        {Type: "emergency", Label: "Emergency leave", Levels: 1},
+        {Type: "maternity", Label: "Maternity leave", Levels: 1},
+        {Type: "paternity", Label: "Paternity leave", Levels: 1},
+        {Type: "solo_parent", Label: "Solo parent leave", Levels: 1},
+        {Type: "unpaid", Label: "Leave without pay", Levels: 1},
+    }
+}
+
+// ParseLeaveApprovalLevels applies "vacation=2;sick=1" to policies; types not
+// among them are added with their type as label.
+func ParseLeaveApprovalLevels(spec string, policies []LeavePolicy) ([]LeavePolicy, error) {
+    out := append([]LeavePolicy(nil), policies...)
+    for _, pair := range strings.Split(spec, ";") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+        i := strings.Index(pair, "=")
+        if i <= 0 {
+            return nil, fmt.Errorf("%w: approval levels %q", ErrInvalidLeave, pair)
+        }
+        typ := strings.ToLower(strings.TrimSpace(pair[:i]))
+        n, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+        if err != nil || n < 1 {
+            return nil, fmt.Errorf("%w: approval levels %q", ErrInvalidLeave, pair)
+        }
+        found := false
+        for j := range out {
+            if out[j].Type == typ {
+                out[j].Levels, found = n, true
+            }
+        }
+        if !found {
+            out = append(out, LeavePolicy{Type: typ, Label: typ, Levels: n})
+        }
+    }
+    return out, nil
+}
+
+// LeaveActor is the user acting on leave requests. EmployeeID is the
+// employee linked to the account, if any.
+type LeaveActor struct {
+    User       string
+    EmployeeID string
+    Roles      []string
+}
+
+// hr reports whether the actor may act on any request.
+func (a LeaveActor) hr() bool {
+    return hasRole(a.Roles, RoleHR) || hasRole(a.Roles, RoleAdmin)
+}
+
+// approverID identifies the actor in the approver history.
+func (a LeaveActor) approverID() string {
+    if a.EmployeeID != "" {
+        return a.EmployeeID
+    }
+    return a.User
+}
+
+// LeaveFilter selects leave requests; empty fields match all. From and To
+// keep requests overlapping that span.
+type LeaveFilter struct {
+    EmployeeID string
+    Status     string
+    Type       string
+    From       string
+    To         string
+}
+
+func (f LeaveFilter) match(r models.LeaveRequest) bool {
+    return (f.EmployeeID == "" || r.EmployeeID == f.EmployeeID) &&
+        (f.Status == "" || r.Status == f.Status) &&
+        (f.Type == "" || r.Type == f.Type) &&
+        (f.From == "" || r.EndDate >= f.From) &&
+        (f.To == "" || r.StartDate <= f.To)
+}
+
+// LeaveStore persists leave requests. Save stores a new request (Version 1)
+// or replaces the one whose version is r.Version-1; it fails with
+// ErrLeaveState when the stored request has moved on, so two deciders cannot
+// both act on the same state.
+type LeaveStore interface {
+    Save(ctx context.Context, r *models.LeaveRequest) error
+    Get(ctx context.Context, requestID string) (*models.LeaveRequest, error)
+    List(ctx context.Context, f LeaveFilter) ([]models.LeaveRequest, error)
+}
+
+// LeaveBalances keeps the employees' leave balances. Check fails when the
+// balance projected to a new request's start does not cover it. Take charges
+// an approved request and returns the days taken; it fails when the balance
+// does not cover the request. Restore gives back what Take charged when an
+// approved request is canceled.
+type LeaveBalances interface {
+    Check(ctx context.Context, r *models.LeaveRequest) error
+    Take(ctx context.Context, actor string, r *models.LeaveRequest) (float64, error)
+    Restore(ctx context.Context, actor string, r *models.LeaveRequest) error
+}
+
+var leaveSeq int64
+
+// LeaveService takes leave requests through submission and single or
+// multi-level approval along the manager chain.
+type LeaveService struct {
+    store     LeaveStore
+    employees EmployeeRepo
+    audit     AuditLog
+    policies  []LeavePolicy
+    balances  LeaveBalances
+    calendar  *HolidayCalendar
+    now       func() time.Time
+}
+
+// NewLeaveService creates the service; no policies means
+// DefaultLeavePolicies. Leave is counted in Monday to Friday working days
+// until SetCalendar.
+func NewLeaveService(store LeaveStore, employees EmployeeRepo, audit AuditLog, policies []LeavePolicy) *LeaveService {
+    if len(policies) == 0 {
+        policies = DefaultLeavePolicies()
+    }
+    calendar := NewHolidayCalendar(NewInMemoryHolidayStore(), nil, nil)
+    return &LeaveService{store: store, employees: employees, audit: audit, policies: policies, calendar: calendar, now: time.Now}
+}
+
+// SetBalances charges approved requests to b.
+func (s *LeaveService) SetBalances(b LeaveBalances) {
+    s.balances = b
+}
+
+// SetCalendar counts leave in the working days of c, leaving out holidays
+// and the employee's rest days.
+func (s *LeaveService) SetCalendar(c *HolidayCalendar) {
+    s.calendar = c
+}
+
+// Policies returns the configured leave types.
+func (s *LeaveService) Policies() []LeavePolicy {
+    return append([]LeavePolicy(nil), s.policies...)
+}
+
+func (s *LeaveService) policy(typ string) (LeavePolicy, bool) {
+    for _, p := range s.policies {
+        if p.Type == typ {
+            return p, true
+        }
+    }
+    return LeavePolicy{}, false
+}
+
+// Submit files a leave request for the actor's employee, or for any
+// employee when the actor is HR, and routes it to the first approver.
+func (s *LeaveService) Submit(ctx context.Context, actor LeaveActor, r models.LeaveRequest) (*models.LeaveRequest, error) {
+    if r.EmployeeID == "" {
+        r.EmployeeID = actor.EmployeeID
+    }
+    if r.EmployeeID == "" {
+        return nil, fmt.Errorf("%w: employee_id required", ErrInvalidLeave)
+    }
+    if r.EmployeeID != actor.EmployeeID && !actor.hr() {
+        return nil, ErrLeaveForbidden
+    }
+    r.Type = strings.ToLower(strings.TrimSpace(r.Type))
+    p, ok := s.policy(r.Type)
+    if !ok {
+        return nil, fmt.Errorf("%w: unknown leave type %q", ErrInvalidLeave, r.Type)
+    }
+    if !validDate(r.StartDate) || !validDate(r.EndDate) {
+        return nil, fmt.Errorf("%w: start_date and end_date must be YYYY-MM-DD", ErrInvalidLeave)
+    }
+    if r.EndDate < r.StartDate {
+        return nil, fmt.Errorf("%w: end_date before start_date", ErrInvalidLeave)
+    }
+    if r.StartDate == r.EndDate && r.StartHalfDay && r.EndHalfDay {
+        return nil, fmt.Errorf("%w: a one-day request is either start_half_day or end_half_day", ErrInvalidLeave)
+    }
+    emp, err := s.employees.Get(ctx, r.EmployeeID)
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return nil, fmt.Errorf("%w: employee %s not found", ErrInvalidLeave, r.EmployeeID)
+    }
+    if err != nil {
+        return nil, err
+    }
+    days, err := s.calendar.WorkingDays(ctx, emp, r.StartDate, r.EndDate, r.StartHalfDay, r.EndHalfDay)
+    if errors.Is(err, ErrInvalidCalendar) {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidLeave, err)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if days <= 0 {
+        return nil, fmt.Errorf("%w: no working days between %s and %s", ErrInvalidLeave, r.StartDate, r.EndDate)
+    }
+    if !payrollEligible(emp, r.StartDate, r.EndDate) {
+        return nil, fmt.Errorf("%w: employee %s is not employed from %s to %s", ErrInvalidLeave, r.EmployeeID, r.StartDate, r.EndDate)
+    }
+    existing, err := s.store.List(ctx, LeaveFilter{EmployeeID: r.EmployeeID, From: r.StartDate, To: r.EndDate})
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range existing {
+        if (e.Status == models.LeavePending || e.Status == models.LeaveApproved) && leaveOverlaps(r, e) {
+            return nil, fmt.Errorf("%w: %s (%s to %s)", ErrLeaveOverlap, e.RequestID, e.StartDate, e.EndDate)
+        }
+    }
+    r.DurationDays = days
+    if s.balances != nil {
+        if err := s.balances.Check(ctx, &r); err != nil {
+            return nil, err
+        }
+    }
+    steps, err := s.approvalChain(ctx, r.EmployeeID, emp, p.Levels)
+    if err != nil {
+        return nil, err
+    }
+
+    now := s.now()
+    r.RequestID = fmt.Sprintf("leave-%d-%d", now.UnixNano(), atomic.AddInt64(&leaveSeq, 1))
+    r.Status = models.LeavePending
+    r.Approvals, r.Level = steps, 0
+    r.ApproverID = nextApprover(&r)
+    r.BalanceImpact = 0
+    r.ApproverHistory = []models.LeaveApproval{{ApproverID: actor.approverID(), Actor: actor.User, Action: models.LeaveActionSubmit, Timestamp: now.Unix(), Comment: r.Reason}}
+    r.CreatedBy, r.CreatedAt, r.UpdatedAt, r.Version = actor.User, now.Unix(), now.Unix(), 1
+    if err := s.store.Save(ctx, &r); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, "leave.submit", r.RequestID, map[string]interface{}{
+        "employee_id": r.EmployeeID, "type": r.Type, "start_date": r.StartDate, "end_date": r.EndDate, "duration_days": r.DurationDays, "levels": len(steps),
+    }); err != nil {
+        return nil, err
+    }
+    return &r, nil
+}
+
+// approvalChain walks up manager_id for levels approvers. A chain that ends
+// early, or loops, ends with one HR level.
+func (s *LeaveService) approvalChain(ctx context.Context, employeeID string, emp map[string]interface{}, levels int) ([]models.LeaveApprovalStep, error) {
+    seen := map[string]bool{employeeID: true}
+    var steps []models.LeaveApprovalStep
+    for len(steps) < levels {
+        mgr, _ := emp["manager_id"].(string)
+        if mgr == "" || seen[mgr] {
+            break
+        }
+        next, err := s.employees.Get(ctx, mgr)
+        if errors.Is(err, mongo.ErrNoDocuments) {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        seen[mgr] = true
+        steps = append(steps, models.LeaveApprovalStep{Level: len(steps) + 1, ApproverID: mgr})
+        emp = next
+    }
+    if len(steps) < levels {
+        steps = append(steps, models.LeaveApprovalStep{Level: len(steps) + 1})
+    }
+    return steps, nil
+}
+
+// leaveOverlaps reports whether a and b share part of a day; leave until
+// noon leaves the afternoon free for leave from noon.
+func leaveOverlaps(a, b models.LeaveRequest) bool {
+    if a.StartDate > b.EndDate || b.StartDate > a.EndDate {
+        return false
+    }
+    return !(a.EndDate == b.StartDate && a.EndHalfDay && b.StartHalfDay) &&
+        !(b.EndDate == a.StartDate && b.EndHalfDay && a.StartHalfDay)
+}
+
+// nextApprover is the employee the pending request waits on; nil for an HR
+// level.
+func nextApprover(r *models.LeaveRequest) *string {
+    if r.Level >= len(r.Approvals) || r.Approvals[r.Level].ApproverID == "" {
+        return nil
+    }
+    id := r.Approvals[r.Level].ApproverID
+    return &id
+}
+
+// awaiting reports whether the pending request waits on actor.
+func awaiting(r *models.LeaveRequest, actor LeaveActor) bool {
+    if r.Status != models.LeavePending || r.Level >= len(r.Approvals) || actor.EmployeeID == r.EmployeeID {
+        return false
+    }
+    step := r.Approvals[r.Level]
+    if step.ApproverID == "" {
+        return actor.hr()
+    }
+    return step.ApproverID == actor.EmployeeID
+}
+
+// Approve records the actor's approval of the current level; the last level
+// approves the request and charges the leave balance. HR may approve any
+// level; nobody approves their own request.
+func (s *LeaveService) Approve(ctx context.Context, actor LeaveActor, requestID, comment string) (*models.LeaveRequest, error) {
+    return s.decide(ctx, actor, requestID, comment, true)
+}
+
+// Reject turns down a pending request at the current level; a comment is
+// required.
+func (s *LeaveService) Reject(ctx context.Context, actor LeaveActor, requestID, comment string) (*models.LeaveRequest, error) {
+    if strings.TrimSpace(comment) == "" {
+        return nil, fmt.Errorf("%w: comment required", ErrInvalidLeave)
+    }
+    return s.decide(ctx, actor, requestID, comment, false)
+}
+
+func (s *LeaveService) decide(ctx context.Context, actor LeaveActor, requestID, comment string, approve bool) (*models.LeaveRequest, error) {
+    r, err := s.store.Get(ctx, requestID)
+    if err != nil {
+        return nil, err
+    }
+    if r.Status != models.LeavePending {
+        return nil, fmt.Errorf("%w: request is %s", ErrLeaveState, r.Status)
+    }
+    if actor.EmployeeID == r.EmployeeID || !(awaiting(r, actor) || actor.hr()) {
+        return nil, ErrLeaveForbidden
+    }
+    prev := copyLeaveRequest(*r)
+    now := s.now().Unix()
+    level := r.Approvals[r.Level].Level
+    entry := models.LeaveApproval{ApproverID: actor.approverID(), Actor: actor.User, Level: level, Timestamp: now, Comment: comment}
+    action := "leave.reject"
+    if approve {
+        entry.Action = models.LeaveActionApprove
+        action = "leave.approve"
+        r.Level++
+        if r.Level == len(r.Approvals) {
+            if s.balances != nil {
+                // fail early; Take checks again once the approval is saved
+                if err := s.balances.Check(ctx, r); err != nil {
+                    return nil, err
+                }
+            }
+            r.Status = models.LeaveApproved
+            id := actor.approverID()
+            r.ApproverID = &id
+        } else {
+            r.ApproverID = nextApprover(r)
+        }
+    } else {
+        entry.Action = models.LeaveActionReject
+        r.Status = models.LeaveRejected
+        id := actor.approverID()
+        r.ApproverID = &id
+    }
+    r.ApproverHistory = append(r.ApproverHistory, entry)
+    r.UpdatedAt = now
+    r.Version++
+    if err := s.store.Save(ctx, r); err != nil {
+        return nil, err
+    }
+    // the balance is charged only by whoever saved the approval
+    if r.Status == models.LeaveApproved && s.balances != nil {
+        days, err := s.balances.Take(ctx, actor.User, r)
+        if err != nil {
+            return nil, s.revert(ctx, prev, r, err)
+        }
+        if days != 0 {
+            r.BalanceImpact = days
+            r.Version++
+            if err := s.store.Save(ctx, r); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, action, r.RequestID, map[string]interface{}{
+        "employee_id": r.EmployeeID, "level": level, "status": r.Status, "comment": comment,
+    }); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// Cancel withdraws a pending request, or an approved one that has not
+// started yet, giving its days back to the balance. The employee or HR may
+// cancel; HR may also cancel leave already under way.
+func (s *LeaveService) Cancel(ctx context.Context, actor LeaveActor, requestID, comment string) (*models.LeaveRequest, error) {
+    r, err := s.store.Get(ctx, requestID)
+    if err != nil {
+        return nil, err
+    }
+    if actor.EmployeeID != r.EmployeeID && !actor.hr() {
+        return nil, ErrLeaveForbidden
+    }
+    now := s.now()
+    switch r.Status {
+    case models.LeavePending:
+    case models.LeaveApproved:
+        if r.StartDate <= now.Format("2006-01-02") && !actor.hr() {
+            return nil, fmt.Errorf("%w: leave has started; ask HR to cancel it", ErrLeaveState)
+        }
+    default:
+        return nil, fmt.Errorf("%w: request is %s", ErrLeaveState, r.Status)
+    }
+    prev := copyLeaveRequest(*r)
+    r.Status = models.LeaveCancelled
+    r.ApproverHistory = append(r.ApproverHistory, models.LeaveApproval{ApproverID: actor.approverID(), Actor: actor.User, Action: models.LeaveActionCancel, Timestamp: now.Unix(), Comment: comment})
+    r.UpdatedAt = now.Unix()
+    r.Version++
+    if err := s.store.Save(ctx, r); err != nil {
+        return nil, err
+    }
+    if prev.Status == models.LeaveApproved && s.balances != nil && r.BalanceImpact != 0 {
+        if err := s.balances.Restore(ctx, actor.User, r); err != nil {
+            return nil, s.revert(ctx, prev, r, err)
+        }
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, "leave.cancel", r.RequestID, map[string]interface{}{
+        "employee_id": r.EmployeeID, "comment": comment, "balance_impact": r.BalanceImpact,
+    }); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// revert puts back the request as it was before a transition whose balance
+// change failed, and returns that failure.
+func (s *LeaveService) revert(ctx context.Context, prev models.LeaveRequest, r *models.LeaveRequest, cause error) error {
+    prev.Version = r.Version + 1
+    if err := s.store.Save(ctx, &prev); err != nil {
+        return fmt.Errorf("%v; restoring %s: %w", cause, r.RequestID, err)
+    }
+    return cause
+}
+
+// Get returns a request the actor may see: their own, one they approve or,
+// for HR, any.
+func (s *LeaveService) Get(ctx context.Context, actor LeaveActor, requestID string) (*models.LeaveRequest, error) {
+    r, err := s.store.Get(ctx, requestID)
+    if err != nil {
+        return nil, err
+    }
+    if actor.hr() || (actor.EmployeeID != "" && actor.EmployeeID == r.EmployeeID) {
+        return r, nil
+    }
+    for _, step := range r.Approvals {
+        if actor.EmployeeID != "" && step.ApproverID == actor.EmployeeID {
+            return r, nil
+        }
+    }
+    return nil, ErrLeaveForbidden
+}
+
+// List returns matching requests, latest start first. Employees only see
+// their own.
+func (s *LeaveService) List(ctx context.Context, actor LeaveActor, f LeaveFilter) ([]models.LeaveRequest, error) {
+    if !actor.hr() {
+        if actor.EmployeeID == "" || (f.EmployeeID != "" && f.EmployeeID != actor.EmployeeID) {
+            return nil, ErrLeaveForbidden
+        }
+        f.EmployeeID = actor.EmployeeID
+    }
+    return s.store.List(ctx, f)
+}
+
+// Pending returns the requests waiting on the actor's decision.
+func (s *LeaveService) Pending(ctx context.Context, actor LeaveActor) ([]models.LeaveRequest, error) {
+    items, err := s.store.List(ctx, LeaveFilter{Status: models.LeavePending})
+    if err != nil {
+        return nil, err
+    }
+    out := []models.LeaveRequest{}
+    for i := range items {
+        if awaiting(&items[i], actor) {
+            out = append(out, items[i])
+        }
+    }
+    return out, nil
+}
+
+// sortLeaveRequests orders requests by latest start, then newest first.
+func sortLeaveRequests(out []models.LeaveRequest) {
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].StartDate != out[j].StartDate {
+            return out[i].StartDate > out[j].StartDate
+        }
+        return out[i].RequestID > out[j].RequestID
+    })
+}
+
+func copyLeaveRequest(r models.LeaveRequest) models.LeaveRequest {
+    r.Approvals = append([]models.LeaveApprovalStep(nil), r.Approvals...)
+    r.ApproverHistory = append([]models.LeaveApproval(nil), r.ApproverHistory...)
+    if r.ApproverID != nil {
+        id := *r.ApproverID
+        r.ApproverID = &id
+    }
+    return r
+}
+
+// InMemoryLeaveStore keeps leave requests in memory.
+type InMemoryLeaveStore struct {
+    mu sync.Mutex
+    m  map[string]models.LeaveRequest
+}
+
+func NewInMemoryLeaveStore() *InMemoryLeaveStore {
+    return &InMemoryLeaveStore{m: map[string]models.LeaveRequest{}}
+}
+
+func (s *InMemoryLeaveStore) Save(ctx context.Context, r *models.LeaveRequest) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if cur, ok := s.m[r.RequestID]; ok && r.Version > 1 && cur.Version != r.Version-1 {
+        return fmt.Errorf("%w: request %s was changed meanwhile", ErrLeaveState, r.RequestID)
+    }
+    s.m[r.RequestID] = copyLeaveRequest(*r)
+    return nil
+}
+
+func (s *InMemoryLeaveStore) Get(ctx context.Context, requestID string) (*models.LeaveRequest, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r, ok := s.m[requestID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    r = copyLeaveRequest(r)
+    return &r, nil
+}
+
+func (s *InMemoryLeaveStore) List(ctx context.Context, f LeaveFilter) ([]models.LeaveRequest, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.LeaveRequest{}
+    for _, r := range s.m {
+        if f.match(r) {
+            out = append(out, copyLeaveRequest(r))
+        }
+    }
+    sortLeaveRequests(out)
+    return out, nil
+}
+
+// MongoLeaveStore stores leave requests in MongoDB.
+type MongoLeaveStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoLeaveStore(coll *mongo.Collection) *MongoLeaveStore {
+    return &MongoLeaveStore{coll: coll}
+}
+
+func (s *MongoLeaveStore) Save(ctx context.Context, r *models.LeaveRequest) error {
+    if r.Version <= 1 {
+        _, err := s.coll.ReplaceOne(ctx, bson.M{"request_id": r.RequestID}, r, options.Replace().SetUpsert(true))
+        return err
+    }
+    res, err := s.coll.ReplaceOne(ctx, bson.M{"request_id": r.RequestID, "version": r.Version - 1}, r)
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount == 0 {
+        return fmt.Errorf("%w: request %s was changed meanwhile", ErrLeaveState, r.RequestID)
+    }
+    return nil
+}
+
+func (s *MongoLeaveStore) Get(ctx context.Context, requestID string) (*models.LeaveRequest, error) {
+    var r models.LeaveRequest
+    if err := s.coll.FindOne(ctx, bson.M{"request_id": requestID}).Decode(&r); err != nil {
+        return nil, err
+    }
+    return &r, nil
+}
+
+func (s *MongoLeaveStore) List(ctx context.Context, f LeaveFilter) ([]models.LeaveRequest, error) {
+    filter := bson.M{}
+    if f.EmployeeID != "" {
+        filter["employee_id"] = f.EmployeeID
+    }
+    if f.Status != "" {
+        filter["status"] = f.Status
+    }
+    if f.Type != "" {
+        filter["type"] = f.Type
+    }
+    if f.From != "" {
+        filter["end_date"] = bson.M{"$gte": f.From}
+    }
+    if f.To != "" {
+        filter["start_date"] = bson.M{"$lte": f.To}
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "start_date", Value: -1}, {Key: "request_id", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.LeaveRequest{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
@@ -0,0 +1,738 @@
+package services
+
+import (
+    "context"
+    _ "embed"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//go:embed leave/accrual_policies.json
+var defaultLeaveAccrualPolicies []byte
+
+var (
+    // ErrInsufficientLeave is returned when the projected leave balance does
+    // not cover a request.
+    ErrInsufficientLeave = errors.New("insufficient leave balance")
+    // ErrInvalidLeaveAccrual wraps malformed accrual policies and ledger entries.
+    ErrInvalidLeaveAccrual = errors.New("invalid leave accrual")
+)
+
+// Leave accrual methods.
+const (
+    AccrueMonthly = "monthly"
+    AccrueAnnual  = "annual"
+    AccrueManual  = "manual"
+)
+
+// LeaveAccrualTier replaces the policy's days from Years of completed
+// service.
+type LeaveAccrualTier struct {
+    Years int     `json:"years"`
+    Days  float64 `json:"days"`
+}
+
+// LeaveAccrualPolicy credits the balance of a leave type. Monthly policies
+// credit Days at each month end, prorated by calendar day in the months an
+// employee joins or leaves; annual policies grant Days on January 1, and a
+// share for the months left on the hire date; manual balances only move
+// through adjustments. MaxBalance stops accruals at that balance (0 for no
+// cap). CarryOver caps what a closed leave year passes on and forfeits the
+// rest; nil carries everything.
+type LeaveAccrualPolicy struct {
+    Type       string             `json:"type"`
+    Method     string             `json:"method"`
+    Days       float64            `json:"days"`
+    Tiers      []LeaveAccrualTier `json:"tiers,omitempty"`
+    MaxBalance float64            `json:"max_balance,omitempty"`
+    CarryOver  *float64           `json:"carry_over,omitempty"`
+}
+
+// rate is the days accrued after years of service.
+func (p LeaveAccrualPolicy) rate(years int) float64 {
+    days, best := p.Days, -1
+    for _, t := range p.Tiers {
+        if t.Years <= years && t.Years > best {
+            days, best = t.Days, t.Years
+        }
+    }
+    return days
+}
+
+// DefaultLeaveAccrualPolicies returns the built-in policies: the CSC 1.25
+// days of vacation and sick leave a month.
+func DefaultLeaveAccrualPolicies() ([]LeaveAccrualPolicy, error) {
+    return LoadLeaveAccrualPolicies(defaultLeaveAccrualPolicies)
+}
+
+// LoadLeaveAccrualPolicies parses a JSON array of accrual policies.
+func LoadLeaveAccrualPolicies(data []byte) ([]LeaveAccrualPolicy, error) {
+    var out []LeaveAccrualPolicy
+    if err := json.Unmarshal(data, &out); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidLeaveAccrual, err)
+    }
+    seen := map[string]bool{}
+    for i := range out {
+        p := &out[i]
+        p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+        p.Method = strings.ToLower(strings.TrimSpace(p.Method))
+        switch {
+        case p.Type == "":
+            return nil, fmt.Errorf("%w: policy %d has no type", ErrInvalidLeaveAccrual, i+1)
+        case seen[p.Type]:
+            return nil, fmt.Errorf("%w: duplicate policy for %s", ErrInvalidLeaveAccrual, p.Type)
+        case p.Method != AccrueMonthly && p.Method != AccrueAnnual && p.Method != AccrueManual:
+            return nil, fmt.Errorf("%w: %s: unknown method %q", ErrInvalidLeaveAccrual, p.Type, p.Method)
+        case p.Days < 0 || p.MaxBalance < 0 || (p.CarryOver != nil && *p.CarryOver < 0):
+            return nil, fmt.Errorf("%w: %s: negative days", ErrInvalidLeaveAccrual, p.Type)
+        }
+        for _, t := range p.Tiers {
+            if t.Years < 0 || t.Days < 0 {
+                return nil, fmt.Errorf("%w: %s: negative tier", ErrInvalidLeaveAccrual, p.Type)
+            }
+        }
+        seen[p.Type] = true
+    }
+    return out, nil
+}
+
+// LeaveLedgerFilter selects ledger entries; empty fields match all. From and
+// To bound the effective date.
+type LeaveLedgerFilter struct {
+    EmployeeID string
+    Type       string
+    Kind       string
+    From       string
+    To         string
+}
+
+func (f LeaveLedgerFilter) match(e models.LeaveLedgerEntry) bool {
+    return (f.EmployeeID == "" || e.EmployeeID == f.EmployeeID) &&
+        (f.Type == "" || e.Type == f.Type) &&
+        (f.Kind == "" || e.Kind == f.Kind) &&
+        (f.From == "" || e.Date >= f.From) &&
+        (f.To == "" || e.Date <= f.To)
+}
+
+// LeaveLedgerStore persists leave ledger entries; entries are never changed
+// once added.
+type LeaveLedgerStore interface {
+    Add(ctx context.Context, entries []models.LeaveLedgerEntry) error
+    List(ctx context.Context, f LeaveLedgerFilter) ([]models.LeaveLedgerEntry, error)
+}
+
+// LeaveBalance is an employee's balance of a leave type as of a date.
+// CarriedOver, Accrued, Used and Adjusted cover the calendar year of AsOf.
+// Booked is approved leave after AsOf and Pending the requests still
+// awaiting approval; Available is what is left for new requests before
+// future accruals.
+type LeaveBalance struct {
+    EmployeeID  string  `json:"employee_id"`
+    Type        string  `json:"type"`
+    AsOf        string  `json:"as_of"`
+    CarriedOver float64 `json:"carried_over"`
+    Accrued     float64 `json:"accrued"`
+    Used        float64 `json:"used"`
+    Adjusted    float64 `json:"adjusted"`
+    Balance     float64 `json:"balance"`
+    Booked      float64 `json:"booked"`
+    Pending     float64 `json:"pending"`
+    Available   float64 `json:"available"`
+}
+
+// LeaveAccrualResult reports what a ledger run posted.
+type LeaveAccrualResult struct {
+    AsOf     string `json:"as_of"`
+    Accruals int    `json:"accruals"`
+    Closings int    `json:"closings"`
+}
+
+var leaveEntrySeq int64
+
+// LeaveLedgerService keeps leave balances as a ledger of accrual, usage,
+// adjustment, carry-over and forfeiture entries. It implements
+// LeaveBalances for the LeaveService.
+type LeaveLedgerService struct {
+    store     LeaveLedgerStore
+    requests  LeaveStore
+    employees EmployeeRepo
+    audit     AuditLog
+    policies  []LeaveAccrualPolicy
+    start     string
+    now       func() time.Time
+}
+
+// NewLeaveLedgerService creates the ledger. Accruals are posted from the
+// later of start (YYYY-MM-DD) and the hire date; an empty start is January 1
+// of the current year. Leave types without a policy have no balance.
+func NewLeaveLedgerService(store LeaveLedgerStore, requests LeaveStore, employees EmployeeRepo, audit AuditLog, policies []LeaveAccrualPolicy, start string) (*LeaveLedgerService, error) {
+    if start == "" {
+        start = fmt.Sprintf("%d-01-01", time.Now().Year())
+    }
+    if !validDate(start) {
+        return nil, fmt.Errorf("%w: start %q must be YYYY-MM-DD", ErrInvalidLeaveAccrual, start)
+    }
+    return &LeaveLedgerService{store: store, requests: requests, employees: employees, audit: audit, policies: policies, start: start, now: time.Now}, nil
+}
+
+// Policies returns the accrual policies.
+func (s *LeaveLedgerService) Policies() []LeaveAccrualPolicy {
+    return append([]LeaveAccrualPolicy(nil), s.policies...)
+}
+
+func (s *LeaveLedgerService) policy(typ string) (LeaveAccrualPolicy, bool) {
+    for _, p := range s.policies {
+        if p.Type == typ {
+            return p, true
+        }
+    }
+    return LeaveAccrualPolicy{}, false
+}
+
+// roundDays keeps leave days to three decimals.
+func roundDays(d float64) float64 {
+    return math.Round(d*1000) / 1000
+}
+
+// serviceYears counts the years of service completed on at.
+func serviceYears(hire string, at time.Time) int {
+    h, err := time.Parse("2006-01-02", hire)
+    if err != nil {
+        return 0
+    }
+    years := at.Year() - h.Year()
+    if at.Month() < h.Month() || (at.Month() == h.Month() && at.Day() < h.Day()) {
+        years--
+    }
+    if years < 0 {
+        return 0
+    }
+    return years
+}
+
+// accruals returns the accruals of p due to emp through the date that are
+// not among posted. Months and years already accrued are skipped.
+func (s *LeaveLedgerService) accruals(emp map[string]interface{}, p LeaveAccrualPolicy, posted []models.LeaveLedgerEntry, through string) []models.LeaveLedgerEntry {
+    id, _ := emp["employee_id"].(string)
+    hire, _ := emp["hire_date"].(string)
+    term, _ := emp["termination_date"].(string)
+    status, _ := emp["employment_status"].(string)
+    if term == "" && separatedStatus(status) {
+        return nil
+    }
+    done := map[string]bool{}
+    balance := 0.0
+    for _, e := range posted {
+        if e.Kind == models.LeaveEntryAccrual {
+            done[e.Period] = true
+        }
+        balance += e.Days
+    }
+    from := s.start
+    if hire > from {
+        from = hire
+    }
+    start, err := time.Parse("2006-01-02", from)
+    if err != nil {
+        return nil
+    }
+
+    var due []models.LeaveLedgerEntry
+    switch p.Method {
+    case AccrueMonthly:
+        for m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); ; m = m.AddDate(0, 1, 0) {
+            last := m.AddDate(0, 1, -1)
+            first, end := m.Format("2006-01-02"), last.Format("2006-01-02")
+            if end > through || (term != "" && term < first) {
+                break
+            }
+            period := m.Format("2006-01")
+            if done[period] {
+                continue
+            }
+            lo, hi := m, last
+            if from > first {
+                lo = start
+            }
+            if term != "" && term < end {
+                hi, _ = time.Parse("2006-01-02", term)
+            }
+            share := float64(hi.Sub(lo)/(24*time.Hour)+1) / float64(last.Day())
+            due = append(due, models.LeaveLedgerEntry{Days: p.rate(serviceYears(hire, last)) * share, Date: end, Period: period})
+        }
+    case AccrueAnnual:
+        for y := start.Year(); ; y++ {
+            date, share := fmt.Sprintf("%d-01-01", y), 1.0
+            if from > date {
+                // the grant predates the ledger unless the employee joined this year
+                if from != hire {
+                    continue
+                }
+                date, share = hire, float64(13-int(start.Month()))/12
+            }
+            if date > through || (term != "" && term < date) {
+                break
+            }
+            period := strconv.Itoa(y)
+            if done[period] {
+                continue
+            }
+            at, _ := time.Parse("2006-01-02", date)
+            due = append(due, models.LeaveLedgerEntry{Days: p.rate(serviceYears(hire, at)) * share, Date: date, Period: period})
+        }
+    }
+
+    out := []models.LeaveLedgerEntry{}
+    for _, e := range due {
+        e.Days = roundDays(e.Days)
+        if p.MaxBalance > 0 && balance+e.Days > p.MaxBalance {
+            e.Days = roundDays(math.Max(p.MaxBalance-balance, 0))
+            e.Note = fmt.Sprintf("capped at %g days", p.MaxBalance)
+        } else if e.Days == 0 {
+            continue
+        }
+        balance += e.Days
+        e.EmployeeID, e.Type, e.Kind = id, p.Type, models.LeaveEntryAccrual
+        out = append(out, e)
+    }
+    return out
+}
+
+// closings returns the carry-over and forfeiture entries closing the leave
+// years before through. A closed year moves the carried days from December
+// 31 to January 1 and forfeits the rest; years that ended without a balance
+// need no entries.
+func (s *LeaveLedgerService) closings(p LeaveAccrualPolicy, employeeID string, posted []models.LeaveLedgerEntry, through string) []models.LeaveLedgerEntry {
+    if p.CarryOver == nil {
+        return nil
+    }
+    closed := map[string]bool{}
+    for _, e := range posted {
+        if e.Kind == models.LeaveEntryCarryOver || e.Kind == models.LeaveEntryForfeiture {
+            closed[e.Period] = true
+        }
+    }
+    first, _ := strconv.Atoi(s.start[:4])
+    last, _ := strconv.Atoi(through[:4])
+    var out []models.LeaveLedgerEntry
+    for y := first; y < last; y++ {
+        period := strconv.Itoa(y)
+        if closed[period] {
+            continue
+        }
+        yearEnd := period + "-12-31"
+        balance := 0.0
+        for _, e := range posted {
+            if e.Date <= yearEnd {
+                balance += e.Days
+            }
+        }
+        balance = roundDays(balance)
+        if balance <= 0 {
+            continue
+        }
+        carried := math.Min(balance, *p.CarryOver)
+        entry := models.LeaveLedgerEntry{EmployeeID: employeeID, Type: p.Type, Period: period}
+        if carried > 0 {
+            out = append(out,
+                withEntry(entry, models.LeaveEntryCarryOver, -carried, yearEnd, fmt.Sprintf("carried to %d", y+1)),
+                withEntry(entry, models.LeaveEntryCarryOver, carried, fmt.Sprintf("%d-01-01", y+1), "carried from "+period))
+        }
+        if forfeited := roundDays(balance - carried); forfeited > 0 {
+            out = append(out, withEntry(entry, models.LeaveEntryForfeiture, -forfeited, yearEnd, fmt.Sprintf("over the %g day carry-over limit", *p.CarryOver)))
+        }
+    }
+    return out
+}
+
+func withEntry(e models.LeaveLedgerEntry, kind string, days float64, date, note string) models.LeaveLedgerEntry {
+    e.Kind, e.Days, e.Date, e.Note = kind, days, date, note
+    return e
+}
+
+// post stamps and stores entries.
+func (s *LeaveLedgerService) post(ctx context.Context, actor string, entries []models.LeaveLedgerEntry) error {
+    if len(entries) == 0 {
+        return nil
+    }
+    now := s.now()
+    for i := range entries {
+        entries[i].EntryID = fmt.Sprintf("leave-entry-%d-%d", now.UnixNano(), atomic.AddInt64(&leaveEntrySeq, 1))
+        entries[i].CreatedBy, entries[i].CreatedAt = actor, now.Unix()
+    }
+    return s.store.Add(ctx, entries)
+}
+
+// Run posts the accruals due through asOf (empty for today) and closes the
+// leave years that ended before it. Entries already posted are skipped, so
+// the scheduled job may run as often as wanted. Only HR and admins may run
+// it.
+func (s *LeaveLedgerService) Run(ctx context.Context, actor LeaveActor, asOf string) (*LeaveAccrualResult, error) {
+    if !actor.hr() {
+        return nil, ErrLeaveForbidden
+    }
+    if asOf == "" {
+        asOf = s.now().Format("2006-01-02")
+    }
+    if !validDate(asOf) {
+        return nil, fmt.Errorf("%w: as_of must be YYYY-MM-DD", ErrInvalidLeaveAccrual)
+    }
+    emps, err := s.employees.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    res := &LeaveAccrualResult{AsOf: asOf}
+    for _, emp := range emps {
+        id, _ := emp["employee_id"].(string)
+        if id == "" {
+            continue
+        }
+        for _, p := range s.policies {
+            posted, err := s.store.List(ctx, LeaveLedgerFilter{EmployeeID: id, Type: p.Type})
+            if err != nil {
+                return nil, err
+            }
+            due := s.accruals(emp, p, posted, asOf)
+            if err := s.post(ctx, actor.User, due); err != nil {
+                return nil, err
+            }
+            closing := s.closings(p, id, append(posted, due...), asOf)
+            if err := s.post(ctx, actor.User, closing); err != nil {
+                return nil, err
+            }
+            res.Accruals += len(due)
+            res.Closings += len(closing)
+        }
+    }
+    if res.Accruals+res.Closings == 0 {
+        return res, nil
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, "leave.accrue", "leave_ledger", map[string]interface{}{
+        "as_of": asOf, "accruals": res.Accruals, "closings": res.Closings,
+    }); err != nil {
+        return nil, err
+    }
+    return res, nil
+}
+
+// Adjust posts a manual adjustment; HR only, and a note is required.
+func (s *LeaveLedgerService) Adjust(ctx context.Context, actor LeaveActor, e models.LeaveLedgerEntry) (*models.LeaveLedgerEntry, error) {
+    if !actor.hr() {
+        return nil, ErrLeaveForbidden
+    }
+    e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+    if _, ok := s.policy(e.Type); !ok {
+        return nil, fmt.Errorf("%w: leave type %q has no balance", ErrInvalidLeaveAccrual, e.Type)
+    }
+    if e.Date == "" {
+        e.Date = s.now().Format("2006-01-02")
+    }
+    switch {
+    case !validDate(e.Date):
+        return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidLeaveAccrual)
+    case roundDays(e.Days) == 0:
+        return nil, fmt.Errorf("%w: days required", ErrInvalidLeaveAccrual)
+    case strings.TrimSpace(e.Note) == "":
+        return nil, fmt.Errorf("%w: note required", ErrInvalidLeaveAccrual)
+    }
+    if _, err := s.employees.Get(ctx, e.EmployeeID); errors.Is(err, mongo.ErrNoDocuments) {
+        return nil, fmt.Errorf("%w: employee %s not found", ErrInvalidLeaveAccrual, e.EmployeeID)
+    } else if err != nil {
+        return nil, err
+    }
+    e.Kind, e.Days, e.Period, e.RequestID = models.LeaveEntryAdjustment, roundDays(e.Days), "", ""
+    entries := []models.LeaveLedgerEntry{e}
+    if err := s.post(ctx, actor.User, entries); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, "leave.adjust", e.EmployeeID, map[string]interface{}{
+        "entry_id": entries[0].EntryID, "type": e.Type, "days": e.Days, "date": e.Date, "note": e.Note,
+    }); err != nil {
+        return nil, err
+    }
+    return &entries[0], nil
+}
+
+// Entries lists ledger entries, oldest first. Employees only see their own.
+func (s *LeaveLedgerService) Entries(ctx context.Context, actor LeaveActor, f LeaveLedgerFilter) ([]models.LeaveLedgerEntry, error) {
+    if !actor.hr() {
+        if actor.EmployeeID == "" || (f.EmployeeID != "" && f.EmployeeID != actor.EmployeeID) {
+            return nil, ErrLeaveForbidden
+        }
+        f.EmployeeID = actor.EmployeeID
+    }
+    return s.store.List(ctx, f)
+}
+
+// Balances returns the employee's balance of every leave type with a
+// policy as of asOf (empty for today). Employees only see their own.
+func (s *LeaveLedgerService) Balances(ctx context.Context, actor LeaveActor, employeeID, asOf string) ([]LeaveBalance, error) {
+    if employeeID == "" {
+        employeeID = actor.EmployeeID
+    }
+    if employeeID == "" {
+        return nil, fmt.Errorf("%w: employee_id required", ErrInvalidLeaveAccrual)
+    }
+    if employeeID != actor.EmployeeID && !actor.hr() {
+        return nil, ErrLeaveForbidden
+    }
+    if asOf == "" {
+        asOf = s.now().Format("2006-01-02")
+    }
+    if !validDate(asOf) {
+        return nil, fmt.Errorf("%w: as_of must be YYYY-MM-DD", ErrInvalidLeaveAccrual)
+    }
+    posted, err := s.store.List(ctx, LeaveLedgerFilter{EmployeeID: employeeID})
+    if err != nil {
+        return nil, err
+    }
+    pending, err := s.requests.List(ctx, LeaveFilter{EmployeeID: employeeID, Status: models.LeavePending})
+    if err != nil {
+        return nil, err
+    }
+    out := []LeaveBalance{}
+    for _, p := range s.policies {
+        b := LeaveBalance{EmployeeID: employeeID, Type: p.Type, AsOf: asOf}
+        for _, e := range posted {
+            if e.Type != p.Type {
+                continue
+            }
+            if e.Date > asOf {
+                if e.Kind == models.LeaveEntryUsage {
+                    b.Booked -= e.Days
+                }
+                continue
+            }
+            b.Balance += e.Days
+            if e.Date[:4] != asOf[:4] {
+                continue
+            }
+            switch e.Kind {
+            case models.LeaveEntryAccrual:
+                b.Accrued += e.Days
+            case models.LeaveEntryUsage:
+                b.Used -= e.Days
+            case models.LeaveEntryAdjustment:
+                b.Adjusted += e.Days
+            case models.LeaveEntryCarryOver:
+                if e.Days > 0 {
+                    b.CarriedOver += e.Days
+                }
+            }
+        }
+        for _, r := range pending {
+            if r.Type == p.Type {
+                b.Pending += r.DurationDays
+            }
+        }
+        b.CarriedOver, b.Accrued, b.Used, b.Adjusted = roundDays(b.CarriedOver), roundDays(b.Accrued), roundDays(b.Used), roundDays(b.Adjusted)
+        b.Balance, b.Booked, b.Pending = roundDays(b.Balance), roundDays(b.Booked), roundDays(b.Pending)
+        b.Available = roundDays(b.Balance - b.Booked - b.Pending)
+        out = append(out, b)
+    }
+    return out, nil
+}
+
+// Check fails with ErrInsufficientLeave when, with r added to the approved
+// and other pending leave, the balance projected with the accruals due by
+// then goes negative on the start of r or of any later leave. Leave types
+// without a policy are not checked.
+func (s *LeaveLedgerService) Check(ctx context.Context, r *models.LeaveRequest) error {
+    p, ok := s.policy(r.Type)
+    if !ok {
+        return nil
+    }
+    emp, err := s.employees.Get(ctx, r.EmployeeID)
+    if err != nil {
+        return err
+    }
+    posted, err := s.store.List(ctx, LeaveLedgerFilter{EmployeeID: r.EmployeeID, Type: p.Type})
+    if err != nil {
+        return err
+    }
+    pending, err := s.requests.List(ctx, LeaveFilter{EmployeeID: r.EmployeeID, Status: models.LeavePending, Type: p.Type})
+    if err != nil {
+        return err
+    }
+    others := pending[:0]
+    checkpoints := []string{r.StartDate}
+    for _, q := range pending {
+        if q.RequestID != r.RequestID {
+            others = append(others, q)
+            checkpoints = append(checkpoints, q.StartDate)
+        }
+    }
+    for _, e := range posted {
+        if e.Kind == models.LeaveEntryUsage && e.Days < 0 {
+            checkpoints = append(checkpoints, e.Date)
+        }
+    }
+    sort.Strings(checkpoints)
+    last := checkpoints[len(checkpoints)-1]
+    if last < r.StartDate {
+        last = r.StartDate
+    }
+    entries := append(posted, s.accruals(emp, p, posted, last)...)
+    for _, d := range checkpoints {
+        if d < r.StartDate {
+            continue
+        }
+        balance := -r.DurationDays
+        for _, e := range entries {
+            if e.Date <= d {
+                balance += e.Days
+            }
+        }
+        for _, q := range others {
+            if q.StartDate <= d {
+                balance -= q.DurationDays
+            }
+        }
+        if balance = roundDays(balance); balance < 0 {
+            return fmt.Errorf("%w: %g %s days requested, %g available on %s", ErrInsufficientLeave, r.DurationDays, r.Type, math.Max(balance+r.DurationDays, 0), d)
+        }
+    }
+    return nil
+}
+
+// Take checks the balance again and books the approved request as usage on
+// its start date.
+func (s *LeaveLedgerService) Take(ctx context.Context, actor string, r *models.LeaveRequest) (float64, error) {
+    if _, ok := s.policy(r.Type); !ok {
+        return 0, nil
+    }
+    if err := s.Check(ctx, r); err != nil {
+        return 0, err
+    }
+    entry := models.LeaveLedgerEntry{EmployeeID: r.EmployeeID, Type: r.Type, Kind: models.LeaveEntryUsage, Days: -r.DurationDays, Date: r.StartDate, RequestID: r.RequestID}
+    if err := s.post(ctx, actor, []models.LeaveLedgerEntry{entry}); err != nil {
+        return 0, err
+    }
+    return r.DurationDays, nil
+}
+
+// Restore reverses the usage of a canceled request.
+func (s *LeaveLedgerService) Restore(ctx context.Context, actor string, r *models.LeaveRequest) error {
+    if _, ok := s.policy(r.Type); !ok {
+        return nil
+    }
+    entry := models.LeaveLedgerEntry{EmployeeID: r.EmployeeID, Type: r.Type, Kind: models.LeaveEntryUsage, Days: r.BalanceImpact, Date: r.StartDate, RequestID: r.RequestID, Note: "request canceled"}
+    return s.post(ctx, actor, []models.LeaveLedgerEntry{entry})
+}
+
+// sortLeaveEntries orders entries by effective date, then as posted.
+func sortLeaveEntries(out []models.LeaveLedgerEntry) {
+    sort.SliceStable(out, func(i, j int) bool {
+        if out[i].Date != out[j].Date {
+            return out[i].Date < out[j].Date
+        }
+        return out[i].CreatedAt < out[j].CreatedAt
+    })
+}
+
+// InMemoryLeaveLedgerStore keeps the leave ledger in memory.
+type InMemoryLeaveLedgerStore struct {
+    mu      sync.Mutex
+    entries []models.LeaveLedgerEntry
+}
+
+func NewInMemoryLeaveLedgerStore() *InMemoryLeaveLedgerStore {
+    return &InMemoryLeaveLedgerStore{}
+}
+
+func (s *InMemoryLeaveLedgerStore) Add(ctx context.Context, entries []models.LeaveLedgerEntry) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.entries = append(s.entries, entries...)
+    return nil
+}
+
+func (s *InMemoryLeaveLedgerStore) List(ctx context.Context, f LeaveLedgerFilter) ([]models.LeaveLedgerEntry, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.LeaveLedgerEntry{}
+    for _, e := range s.entries {
+        if f.match(e) {
+            out = append(out, e)
+        }
+    }
+    sortLeaveEntries(out)
+    return out, nil
+}
+
+// MongoLeaveLedgerStore stores the leave ledger in MongoDB.
+type MongoLeaveLedgerStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoLeaveLedgerStore(coll *mongo.Collection) *MongoLeaveLedgerStore {
+    return &MongoLeaveLedgerStore{coll: coll}
+}
+
+// EnsureIndexes keeps accruals and year closings from being posted twice
+// when runs overlap.
+func (s *MongoLeaveLedgerStore) EnsureIndexes(ctx context.Context) error {
+    _, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+        Keys: bson.D{{Key: "employee_id", Value: 1}, {Key: "type", Value: 1}, {Key: "kind", Value: 1}, {Key: "period", Value: 1}, {Key: "date", Value: 1}},
+        Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"period": bson.M{"$exists": true}}),
+    })
+    return err
+}
+
+func (s *MongoLeaveLedgerStore) Add(ctx context.Context, entries []models.LeaveLedgerEntry) error {
+    docs := make([]interface{}, len(entries))
+    for i := range entries {
+        docs[i] = entries[i]
+    }
+    _, err := s.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+    if mongo.IsDuplicateKeyError(err) {
+        // another run posted the same period
+        return nil
+    }
+    return err
+}
+
+func (s *MongoLeaveLedgerStore) List(ctx context.Context, f LeaveLedgerFilter) ([]models.LeaveLedgerEntry, error) {
+    filter := bson.M{}
+    if f.EmployeeID != "" {
+        filter["employee_id"] = f.EmployeeID
+    }
+    if f.Type != "" {
+        filter["type"] = f.Type
+    }
+    if f.Kind != "" {
+        filter["kind"] = f.Kind
+    }
+    date := bson.M{}
+    if f.From != "" {
+        date["$gte"] = f.From
+    }
+    if f.To != "" {
+        date["$lte"] = f.To
+    }
+    if len(date) > 0 {
+        filter["date"] = date
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "created_at", Value: 1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.LeaveLedgerEntry{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
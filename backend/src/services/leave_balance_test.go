@@ -0,0 +1,167 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+)
+
+const testAccrualPolicies = `[
+  {"type": "vacation", "method": "monthly", "days": 1.25, "carry_over": 5},
+  {"type": "sick", "method": "monthly", "days": 1.25, "max_balance": 3},
+  {"type": "solo_parent", "method": "annual", "days": 5, "tiers": [{"years": 3, "days": 7}]}
+]`
+
+func balanceOf(t *testing.T, items []LeaveBalance, typ string) LeaveBalance {
+    t.Helper()
+    for _, b := range items {
+        if b.Type == typ {
+            return b
+        }
+    }
+    t.Fatalf("no %s balance in %+v", typ, items)
+    return LeaveBalance{}
+}
+
+func TestLeaveLedgerService_Accruals(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "hire_date": "2024-03-10"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-3", "hire_date": "2020-01-01", "termination_date": "2025-03-20"})
+    policies, err := LoadLeaveAccrualPolicies([]byte(testAccrualPolicies))
+    if err != nil {
+        t.Fatalf("policies: %v", err)
+    }
+    audit := NewInMemoryAuditLog()
+    ledger, _ := NewLeaveLedgerService(NewInMemoryLeaveLedgerStore(), NewInMemoryLeaveStore(), emps, audit, policies, "2024-01-01")
+    ledger.now = func() time.Time { return time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC) }
+    hr := LeaveActor{User: "hr", Roles: []string{RoleHR}}
+
+    if _, err := ledger.Run(ctx, LeaveActor{User: "emp", EmployeeID: "E-1"}, ""); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("employee ran accruals: %v", err)
+    }
+    res, err := ledger.Run(ctx, hr, "")
+    if err != nil || res.AsOf != "2025-06-02" || res.Accruals == 0 || res.Closings != 6 {
+        t.Fatalf("run: %v %+v", err, res)
+    }
+    if again, _ := ledger.Run(ctx, hr, ""); again.Accruals != 0 || again.Closings != 0 {
+        t.Fatalf("second run posted again: %+v", again)
+    }
+    if entries, _ := audit.List(ctx, "leave_ledger"); len(entries) != 1 {
+        t.Fatalf("audit: %+v", entries)
+    }
+
+    // hired March 10: 22 of 31 days of March, then 1.25 a month; 2024 closes
+    // carrying 5 days and forfeiting the rest
+    items, err := ledger.Balances(ctx, hr, "E-1", "")
+    if err != nil {
+        t.Fatalf("balances: %v", err)
+    }
+    if vl := balanceOf(t, items, "vacation"); vl.Balance != 11.25 || vl.CarriedOver != 5 || vl.Accrued != 6.25 || vl.Available != 11.25 {
+        t.Fatalf("vacation: %+v", vl)
+    }
+    forfeited, _ := ledger.Entries(ctx, hr, LeaveLedgerFilter{EmployeeID: "E-1", Kind: models.LeaveEntryForfeiture})
+    if len(forfeited) != 1 || forfeited[0].Days != -7.137 || forfeited[0].Date != "2024-12-31" {
+        t.Fatalf("forfeiture: %+v", forfeited)
+    }
+    if sl := balanceOf(t, items, "sick"); sl.Balance != 3 {
+        t.Fatalf("sick leave above its cap: %+v", sl)
+    }
+    // ten twelfths of the grant in the hire year, the full grant on January 1
+    if sp := balanceOf(t, items, "solo_parent"); sp.Balance != 9.167 {
+        t.Fatalf("solo parent: %+v", sp)
+    }
+
+    // the tenure tier applies, and accruals stop with the termination
+    items, _ = ledger.Balances(ctx, hr, "E-3", "2025-06-02")
+    if sp := balanceOf(t, items, "solo_parent"); sp.Balance != 14 {
+        t.Fatalf("tiered grant: %+v", sp)
+    }
+    if vl := balanceOf(t, items, "vacation"); vl.Balance != 8.306 || vl.Accrued != 3.306 {
+        t.Fatalf("terminated: %+v", vl)
+    }
+
+    if _, err := ledger.Balances(ctx, LeaveActor{User: "emp", EmployeeID: "E-1"}, "E-3", ""); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("saw another employee's balance: %v", err)
+    }
+    if _, err := LoadLeaveAccrualPolicies([]byte(`[{"type":"vacation","method":"weekly","days":1}]`)); !errors.Is(err, ErrInvalidLeaveAccrual) {
+        t.Fatalf("expected ErrInvalidLeaveAccrual, got %v", err)
+    }
+}
+
+func TestLeaveLedgerService_Requests(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "hire_date": "2024-03-10", "manager_id": "M-1"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "M-1"})
+    policies, _ := DefaultLeaveAccrualPolicies()
+    requests := NewInMemoryLeaveStore()
+    ledger, _ := NewLeaveLedgerService(NewInMemoryLeaveLedgerStore(), requests, emps, nil, policies, "2025-01-01")
+    clock := func() time.Time { return time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC) }
+    ledger.now = clock
+    leave := NewLeaveService(requests, emps, nil, nil)
+    leave.now = clock
+    leave.SetBalances(ledger)
+    emp := LeaveActor{User: "emp", EmployeeID: "E-1"}
+    boss := LeaveActor{User: "boss", EmployeeID: "M-1"}
+    hr := LeaveActor{User: "hr", Roles: []string{RoleHR}}
+    if _, err := ledger.Run(ctx, hr, "2025-06-02"); err != nil {
+        t.Fatalf("run: %v", err)
+    }
+
+    // 6.25 days accrued January to May
+    first, err := leave.Submit(ctx, emp, models.LeaveRequest{Type: "vacation", StartDate: "2025-06-16", EndDate: "2025-06-20"})
+    if err != nil || first.DurationDays != 5 {
+        t.Fatalf("submit: %v %+v", err, first)
+    }
+    // June's accrual is due by July
+    if _, err := leave.Submit(ctx, emp, models.LeaveRequest{Type: "vacation", StartDate: "2025-07-01", EndDate: "2025-07-02"}); err != nil {
+        t.Fatalf("projected accrual: %v", err)
+    }
+    if _, err := leave.Submit(ctx, emp, models.LeaveRequest{Type: "vacation", StartDate: "2025-07-07", EndDate: "2025-07-07"}); !errors.Is(err, ErrInsufficientLeave) {
+        t.Fatalf("expected ErrInsufficientLeave, got %v", err)
+    }
+    // unpaid leave has no balance
+    if _, err := leave.Submit(ctx, emp, models.LeaveRequest{Type: "unpaid", StartDate: "2025-07-07", EndDate: "2025-07-11"}); err != nil {
+        t.Fatalf("unpaid: %v", err)
+    }
+
+    r, err := leave.Approve(ctx, boss, first.RequestID, "")
+    if err != nil || r.BalanceImpact != 5 {
+        t.Fatalf("approve: %v %+v", err, r)
+    }
+    items, _ := ledger.Balances(ctx, emp, "", "")
+    if vl := balanceOf(t, items, "vacation"); vl.Balance != 6.25 || vl.Booked != 5 || vl.Pending != 2 || vl.Available != -0.75 {
+        t.Fatalf("vacation: %+v", vl)
+    }
+    if _, err := leave.Cancel(ctx, emp, r.RequestID, "plans changed"); err != nil {
+        t.Fatalf("cancel: %v", err)
+    }
+    usage, _ := ledger.Entries(ctx, emp, LeaveLedgerFilter{Kind: models.LeaveEntryUsage})
+    if len(usage) != 2 || usage[0].Days+usage[1].Days != 0 || usage[1].RequestID != r.RequestID {
+        t.Fatalf("usage: %+v", usage)
+    }
+
+    if _, err := ledger.Adjust(ctx, emp, models.LeaveLedgerEntry{EmployeeID: "E-1", Type: "vacation", Days: 10, Note: "gift"}); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("employee adjusted: %v", err)
+    }
+    for _, bad := range []models.LeaveLedgerEntry{
+        {EmployeeID: "E-1", Type: "vacation", Days: 2},
+        {EmployeeID: "E-1", Type: "unpaid", Days: 2, Note: "no balance"},
+        {EmployeeID: "E-9", Type: "vacation", Days: 2, Note: "unknown employee"},
+    } {
+        if _, err := ledger.Adjust(ctx, hr, bad); !errors.Is(err, ErrInvalidLeaveAccrual) {
+            t.Fatalf("expected ErrInvalidLeaveAccrual for %+v, got %v", bad, err)
+        }
+    }
+    e, err := ledger.Adjust(ctx, hr, models.LeaveLedgerEntry{EmployeeID: "E-1", Type: "Vacation", Days: 4.5, Note: "opening balance"})
+    if err != nil || e.Kind != models.LeaveEntryAdjustment || e.Date != "2025-06-02" {
+        t.Fatalf("adjust: %v %+v", err, e)
+    }
+    if _, err := leave.Submit(ctx, emp, models.LeaveRequest{Type: "vacation", StartDate: "2025-07-14", EndDate: "2025-07-14"}); err != nil {
+        t.Fatalf("after adjustment: %v", err)
+    }
+}
@@ -0,0 +1,529 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidFeedToken covers unknown and revoked calendar feed tokens.
+var ErrInvalidFeedToken = errors.New("invalid calendar feed token")
+
+// DefaultLeaveMaxOut is how many people of a team may be out on the same
+// day before the day is flagged.
+const DefaultLeaveMaxOut = 2
+
+// LeaveCalendarQuery selects a team calendar. Unit keeps the employees whose
+// current job is in that org unit, or department; no From and To mean the
+// current month. MaxOut overrides the service's limit.
+type LeaveCalendarQuery struct {
+    Unit   string
+    From   string
+    To     string
+    MaxOut int
+}
+
+// LeaveCalendarEntry is an approved or pending request on a team calendar.
+type LeaveCalendarEntry struct {
+    RequestID    string  `json:"request_id"`
+    EmployeeID   string  `json:"employee_id"`
+    Name         string  `json:"name"`
+    Type         string  `json:"type"`
+    Label        string  `json:"label"`
+    Status       string  `json:"status"`
+    StartDate    string  `json:"start_date"`
+    EndDate      string  `json:"end_date"`
+    StartHalfDay bool    `json:"start_half_day,omitempty"`
+    EndHalfDay   bool    `json:"end_half_day,omitempty"`
+    DurationDays float64 `json:"duration_days"`
+    UpdatedAt    int64   `json:"updated_at,omitempty"`
+}
+
+// LeaveCalendarDay lists who is out on a day. People only count on their
+// working days; Overlap flags days with more than MaxOut people out, pending
+// requests included.
+type LeaveCalendarDay struct {
+    Date     string           `json:"date"`
+    Approved []string         `json:"approved,omitempty"` // employee ids
+    Pending  []string         `json:"pending,omitempty"`
+    Out      int              `json:"out"`
+    Holidays []models.Holiday `json:"holidays,omitempty"`
+    Overlap  bool             `json:"overlap"`
+}
+
+// LeaveCalendar is a team's leave over a range of days.
+type LeaveCalendar struct {
+    Unit    string               `json:"unit,omitempty"`
+    From    string               `json:"from"`
+    To      string               `json:"to"`
+    MaxOut  int                  `json:"max_out"`
+    Team    int                  `json:"team"` // employees in scope
+    Entries []LeaveCalendarEntry `json:"entries"`
+    Days    []LeaveCalendarDay   `json:"days"`
+}
+
+// CalendarFeedStore persists hashed feed tokens.
+type CalendarFeedStore interface {
+    // Save replaces the user's token.
+    Save(ctx context.Context, t models.CalendarFeedToken) error
+    Get(ctx context.Context, tokenHash string) (*models.CalendarFeedToken, error)
+    Delete(ctx context.Context, username string) error
+}
+
+// LeaveCalendarService shows who is out across a team, from the leave
+// requests and the holiday calendar, and publishes it as an iCalendar feed.
+// HR and admins see everyone; others see themselves and the employees below
+// them on the manager_id chain.
+type LeaveCalendarService struct {
+    leave  *LeaveService
+    feeds  CalendarFeedStore
+    audit  AuditLog
+    maxOut int
+    now    func() time.Time
+}
+
+// NewLeaveCalendarService creates the service over leave's requests,
+// employees and holiday calendar; maxOut below 1 means DefaultLeaveMaxOut.
+func NewLeaveCalendarService(leave *LeaveService, feeds CalendarFeedStore, audit AuditLog, maxOut int) *LeaveCalendarService {
+    if maxOut < 1 {
+        maxOut = DefaultLeaveMaxOut
+    }
+    return &LeaveCalendarService{leave: leave, feeds: feeds, audit: audit, maxOut: maxOut, now: time.Now}
+}
+
+// Calendar returns the approved and pending leave of the actor's team.
+func (s *LeaveCalendarService) Calendar(ctx context.Context, actor LeaveActor, q LeaveCalendarQuery) (*LeaveCalendar, error) {
+    from, to, err := s.span(q.From, q.To)
+    if err != nil {
+        return nil, err
+    }
+    if q.MaxOut < 0 {
+        return nil, fmt.Errorf("%w: max_out must be positive", ErrInvalidLeave)
+    }
+    cal := &LeaveCalendar{Unit: q.Unit, From: from, To: to, MaxOut: s.maxOut, Entries: []LeaveCalendarEntry{}, Days: []LeaveCalendarDay{}}
+    if q.MaxOut > 0 {
+        cal.MaxOut = q.MaxOut
+    }
+    team, err := s.team(ctx, actor, q.Unit, from, to)
+    if err != nil {
+        return nil, err
+    }
+    cal.Team = len(team)
+
+    start, _ := time.Parse("2006-01-02", from)
+    end, _ := time.Parse("2006-01-02", to)
+    index := map[string]int{}
+    for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+        index[d.Format("2006-01-02")] = len(cal.Days)
+        cal.Days = append(cal.Days, LeaveCalendarDay{Date: d.Format("2006-01-02")})
+    }
+    holidays, err := s.leave.calendar.List(ctx, HolidayFilter{From: from, To: to})
+    if err != nil {
+        return nil, err
+    }
+    locations := map[string]bool{}
+    for _, emp := range team {
+        if l, _ := emp["location"].(string); l != "" {
+            locations[strings.ToLower(l)] = true
+        }
+    }
+    for _, h := range holidays {
+        if h.Location == "" || locations[strings.ToLower(h.Location)] {
+            d := &cal.Days[index[h.Date]]
+            d.Holidays = append(d.Holidays, h)
+        }
+    }
+
+    requests, err := s.leave.store.List(ctx, LeaveFilter{From: from, To: to})
+    if err != nil {
+        return nil, err
+    }
+    working := map[string]map[string]bool{}
+    out := make([]map[string]bool, len(cal.Days))
+    for _, r := range requests {
+        emp, ok := team[r.EmployeeID]
+        if !ok || (r.Status != models.LeavePending && r.Status != models.LeaveApproved) {
+            continue
+        }
+        works, ok := working[r.EmployeeID]
+        if !ok {
+            days, err := s.leave.calendar.Days(ctx, emp, from, to)
+            if errors.Is(err, ErrInvalidCalendar) {
+                return nil, fmt.Errorf("%w: employee %s: %v", ErrInvalidLeave, r.EmployeeID, err)
+            }
+            if err != nil {
+                return nil, err
+            }
+            works = map[string]bool{}
+            for _, d := range days {
+                works[d.Date] = d.Working
+            }
+            working[r.EmployeeID] = works
+        }
+        label := r.Type
+        if p, ok := s.leave.policy(r.Type); ok {
+            label = p.Label
+        }
+        cal.Entries = append(cal.Entries, LeaveCalendarEntry{
+            RequestID: r.RequestID, EmployeeID: r.EmployeeID, Name: employeeName(emp), Type: r.Type, Label: label, Status: r.Status,
+            StartDate: r.StartDate, EndDate: r.EndDate, StartHalfDay: r.StartHalfDay, EndHalfDay: r.EndHalfDay, DurationDays: r.DurationDays, UpdatedAt: r.UpdatedAt,
+        })
+        for date, i := range index {
+            if date < r.StartDate || date > r.EndDate || !works[date] {
+                continue
+            }
+            d := &cal.Days[i]
+            if r.Status == models.LeaveApproved {
+                d.Approved = append(d.Approved, r.EmployeeID)
+            } else {
+                d.Pending = append(d.Pending, r.EmployeeID)
+            }
+            if out[i] == nil {
+                out[i] = map[string]bool{}
+            }
+            out[i][r.EmployeeID] = true
+        }
+    }
+    sort.Slice(cal.Entries, func(i, j int) bool {
+        a, b := cal.Entries[i], cal.Entries[j]
+        if a.StartDate != b.StartDate {
+            return a.StartDate < b.StartDate
+        }
+        if a.EmployeeID != b.EmployeeID {
+            return a.EmployeeID < b.EmployeeID
+        }
+        return a.RequestID < b.RequestID
+    })
+    for i := range cal.Days {
+        d := &cal.Days[i]
+        sort.Strings(d.Approved)
+        sort.Strings(d.Pending)
+        d.Out = len(out[i])
+        d.Overlap = d.Out > cal.MaxOut
+    }
+    return cal, nil
+}
+
+// span validates a calendar range; none means the current month.
+func (s *LeaveCalendarService) span(from, to string) (string, string, error) {
+    if from == "" && to == "" {
+        now := s.now()
+        first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+        return first.Format("2006-01-02"), first.AddDate(0, 1, -1).Format("2006-01-02"), nil
+    }
+    start, err := time.Parse("2006-01-02", from)
+    if err != nil {
+        return "", "", fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidLeave)
+    }
+    end, err := time.Parse("2006-01-02", to)
+    if err != nil {
+        return "", "", fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidLeave)
+    }
+    if end.Before(start) || end.Sub(start) > maxCalendarDays*24*time.Hour {
+        return "", "", fmt.Errorf("%w: range must run forwards over at most %d days", ErrInvalidLeave, maxCalendarDays)
+    }
+    return from, to, nil
+}
+
+// team returns the employees in the actor's scope employed during the range,
+// by id, keeping those of unit when given.
+func (s *LeaveCalendarService) team(ctx context.Context, actor LeaveActor, unit, from, to string) (map[string]map[string]interface{}, error) {
+    if !actor.hr() && actor.EmployeeID == "" {
+        return nil, ErrLeaveForbidden
+    }
+    all, err := s.leave.employees.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    byID := map[string]map[string]interface{}{}
+    reports := map[string][]string{}
+    for _, emp := range all {
+        id, _ := emp["employee_id"].(string)
+        if id == "" {
+            continue
+        }
+        byID[id] = emp
+        if mgr, _ := emp["manager_id"].(string); mgr != "" {
+            reports[mgr] = append(reports[mgr], id)
+        }
+    }
+    scope := map[string]bool{}
+    if actor.hr() {
+        for id := range byID {
+            scope[id] = true
+        }
+    } else {
+        // walk down the reporting lines; scope guards against manager loops
+        queue := []string{actor.EmployeeID}
+        for len(queue) > 0 {
+            id := queue[0]
+            queue = queue[1:]
+            if scope[id] {
+                continue
+            }
+            scope[id] = true
+            queue = append(queue, reports[id]...)
+        }
+    }
+    out := map[string]map[string]interface{}{}
+    for id := range scope {
+        emp, ok := byID[id]
+        if !ok || !payrollEligible(emp, from, to) {
+            continue
+        }
+        if unit != "" {
+            if _, u := jobAssignment(emp, to); !strings.EqualFold(u, unit) {
+                continue
+            }
+        }
+        out[id] = emp
+    }
+    return out, nil
+}
+
+// IssueFeedToken creates a feed token for the actor, replacing any earlier
+// one. The token is only ever returned here.
+func (s *LeaveCalendarService) IssueFeedToken(ctx context.Context, actor LeaveActor) (string, error) {
+    if actor.User == "" {
+        return "", ErrLeaveForbidden
+    }
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    token := hex.EncodeToString(b)
+    if err := s.feeds.Save(ctx, models.CalendarFeedToken{TokenHash: hashFeedToken(token), Username: actor.User, CreatedAt: s.now().Unix()}); err != nil {
+        return "", err
+    }
+    if err := recordAudit(ctx, s.audit, actor.User, "leave.feed_token", actor.User, nil); err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+// RevokeFeedToken stops the actor's feed.
+func (s *LeaveCalendarService) RevokeFeedToken(ctx context.Context, actor LeaveActor) error {
+    if err := s.feeds.Delete(ctx, actor.User); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor.User, "leave.feed_revoke", actor.User, nil)
+}
+
+// FeedOwner returns the user a feed token belongs to.
+func (s *LeaveCalendarService) FeedOwner(ctx context.Context, token string) (string, error) {
+    if token == "" {
+        return "", ErrInvalidFeedToken
+    }
+    t, err := s.feeds.Get(ctx, hashFeedToken(token))
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return "", ErrInvalidFeedToken
+    }
+    if err != nil {
+        return "", err
+    }
+    return t.Username, nil
+}
+
+// Feed renders the actor's team calendar from 30 days back to a year ahead
+// as iCalendar: an all-day event per request, holiday and flagged day.
+func (s *LeaveCalendarService) Feed(ctx context.Context, actor LeaveActor, unit string) ([]byte, error) {
+    now := s.now().UTC()
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+    cal, err := s.Calendar(ctx, actor, LeaveCalendarQuery{Unit: unit, From: today.AddDate(0, 0, -30).Format("2006-01-02"), To: today.AddDate(1, 0, 0).Format("2006-01-02")})
+    if err != nil {
+        return nil, err
+    }
+    return leaveCalendarICal(cal, now), nil
+}
+
+func hashFeedToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// leaveCalendarICal renders cal; stamp dates events without an update time.
+func leaveCalendarICal(cal *LeaveCalendar, stamp time.Time) []byte {
+    var w icalWriter
+    name := "Leave calendar"
+    if cal.Unit != "" {
+        name += " " + cal.Unit
+    }
+    w.line("BEGIN", "VCALENDAR")
+    w.line("VERSION", "2.0")
+    w.line("PRODID", "-//HRIS//Leave calendar//EN")
+    w.line("CALSCALE", "GREGORIAN")
+    w.line("METHOD", "PUBLISH")
+    w.line("X-WR-CALNAME", icalText(name))
+    event := func(uid, date, endDate, summary string, updated time.Time, extra ...string) {
+        start, _ := time.Parse("2006-01-02", date)
+        end, _ := time.Parse("2006-01-02", endDate)
+        w.line("BEGIN", "VEVENT")
+        w.line("UID", uid)
+        w.line("DTSTAMP", updated.UTC().Format("20060102T150405Z"))
+        w.line("DTSTART;VALUE=DATE", start.Format("20060102"))
+        // DTEND of an all-day event is the day after it ends
+        w.line("DTEND;VALUE=DATE", end.AddDate(0, 0, 1).Format("20060102"))
+        w.line("SUMMARY", icalText(summary))
+        w.line("TRANSP", "TRANSPARENT")
+        for i := 0; i+1 < len(extra); i += 2 {
+            w.line(extra[i], extra[i+1])
+        }
+        w.line("END", "VEVENT")
+    }
+    for _, e := range cal.Entries {
+        updated := stamp
+        if e.UpdatedAt > 0 {
+            updated = time.Unix(e.UpdatedAt, 0)
+        }
+        summary, status := e.Name+": "+e.Label, "CONFIRMED"
+        if e.Status == models.LeavePending {
+            summary, status = summary+" (pending)", "TENTATIVE"
+        }
+        var notes []string
+        if e.StartHalfDay {
+            notes = append(notes, "From noon on "+e.StartDate+".")
+        }
+        if e.EndHalfDay {
+            notes = append(notes, "Until noon on "+e.EndDate+".")
+        }
+        extra := []string{"STATUS", status}
+        if len(notes) > 0 {
+            extra = append(extra, "DESCRIPTION", icalText(strings.Join(notes, " ")))
+        }
+        event(e.RequestID+"@hris", e.StartDate, e.EndDate, summary, updated, extra...)
+    }
+    for _, d := range cal.Days {
+        for _, h := range d.Holidays {
+            category := "Regular holiday"
+            if h.Kind == models.HolidaySpecial {
+                category = "Special non-working holiday"
+            }
+            event(h.HolidayID+"@hris", h.Date, h.Date, h.Name, stamp, "CATEGORIES", icalText(category))
+        }
+        if d.Overlap {
+            event("overlap-"+d.Date+"@hris", d.Date, d.Date, fmt.Sprintf("%d people out (limit %d)", d.Out, cal.MaxOut), stamp, "CATEGORIES", "Leave overlap")
+        }
+    }
+    w.line("END", "VCALENDAR")
+    return w.b.Bytes()
+}
+
+// icalWriter writes CRLF-terminated content lines folded at 75 octets.
+type icalWriter struct {
+    b bytes.Buffer
+}
+
+func (w *icalWriter) line(name, value string) {
+    s := name + ":" + value
+    limit := 75
+    for len(s) > limit {
+        // never split a UTF-8 sequence
+        i := limit
+        for i > 0 && !utf8.RuneStart(s[i]) {
+            i--
+        }
+        w.b.WriteString(s[:i] + "\r\n ")
+        s = s[i:]
+        limit = 74
+    }
+    w.b.WriteString(s + "\r\n")
+}
+
+// icalText escapes an iCalendar TEXT value.
+func icalText(s string) string {
+    return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// InMemoryCalendarFeedStore keeps feed tokens in memory.
+type InMemoryCalendarFeedStore struct {
+    mu sync.Mutex
+    m  map[string]models.CalendarFeedToken // by username
+}
+
+func NewInMemoryCalendarFeedStore() *InMemoryCalendarFeedStore {
+    return &InMemoryCalendarFeedStore{m: map[string]models.CalendarFeedToken{}}
+}
+
+func (s *InMemoryCalendarFeedStore) Save(ctx context.Context, t models.CalendarFeedToken) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.m[t.Username] = t
+    return nil
+}
+
+func (s *InMemoryCalendarFeedStore) Get(ctx context.Context, tokenHash string) (*models.CalendarFeedToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, t := range s.m {
+        if t.TokenHash == tokenHash {
+            return &t, nil
+        }
+    }
+    return nil, mongo.ErrNoDocuments
+}
+
+func (s *InMemoryCalendarFeedStore) Delete(ctx context.Context, username string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.m[username]; !ok {
+        return mongo.ErrNoDocuments
+    }
+    delete(s.m, username)
+    return nil
+}
+
+// MongoCalendarFeedStore stores feed tokens in MongoDB.
+type MongoCalendarFeedStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoCalendarFeedStore(coll *mongo.Collection) *MongoCalendarFeedStore {
+    return &MongoCalendarFeedStore{coll: coll}
+}
+
+// EnsureIndexes makes token hashes and usernames unique.
+func (s *MongoCalendarFeedStore) EnsureIndexes(ctx context.Context) error {
+    _, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+    })
+    return err
+}
+
+func (s *MongoCalendarFeedStore) Save(ctx context.Context, t models.CalendarFeedToken) error {
+    _, err := s.coll.ReplaceOne(ctx, bson.M{"username": t.Username}, t, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoCalendarFeedStore) Get(ctx context.Context, tokenHash string) (*models.CalendarFeedToken, error) {
+    var t models.CalendarFeedToken
+    if err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&t); err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+func (s *MongoCalendarFeedStore) Delete(ctx context.Context, username string) error {
+    res, err := s.coll.DeleteOne(ctx, bson.M{"username": username})
+    if err != nil {
+        return err
+    }
+    if res.DeletedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
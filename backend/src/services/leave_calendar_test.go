@@ -0,0 +1,183 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+)
+
+func newLeaveCalendarTestService(t *testing.T) *LeaveCalendarService {
+    t.Helper()
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    ops := []interface{}{map[string]interface{}{"title": "Analyst", "org_unit_id": "OU-OPS", "start_date": "2024-01-01"}}
+    for _, e := range []map[string]interface{}{
+        {"employee_id": "M-1", "location": "Cebu"},
+        {"employee_id": "E-1", "manager_id": "M-1", "legal_name": map[string]interface{}{"first": "Ana", "last": "Cruz"}, "job_history": ops},
+        {"employee_id": "E-2", "manager_id": "M-1", "preferred_name": "Ben", "job_history": ops},
+        {"employee_id": "E-3", "manager_id": "E-2", "job_history": []interface{}{map[string]interface{}{"title": "Clerk", "department": "Finance", "start_date": "2024-01-01"}}},
+        {"employee_id": "E-9", "manager_id": "M-9"},
+    } {
+        if _, err := emps.Create(ctx, e); err != nil {
+            t.Fatalf("employee: %v", err)
+        }
+    }
+    cal := NewHolidayCalendar(NewInMemoryHolidayStore(), nil, nil)
+    if _, err := cal.ImportCSV(ctx, "hr", strings.NewReader("date,name,kind,location\r\n2025-06-12,Independence Day,regular,\r\n2025-06-06,Cebu charter day,special,Cebu\r\n2025-06-09,Davao day,special,Davao\r\n")); err != nil {
+        t.Fatalf("holidays: %v", err)
+    }
+    requests := NewInMemoryLeaveStore()
+    for _, r := range []models.LeaveRequest{
+        {RequestID: "leave-1", EmployeeID: "E-1", Type: "vacation", StartDate: "2025-06-09", EndDate: "2025-06-13", StartHalfDay: true, Status: models.LeaveApproved},
+        {RequestID: "leave-2", EmployeeID: "E-2", Type: "sick", StartDate: "2025-06-10", EndDate: "2025-06-11", Status: models.LeavePending},
+        {RequestID: "leave-3", EmployeeID: "E-3", Type: "vacation", StartDate: "2025-06-11", EndDate: "2025-06-11", Status: models.LeaveApproved},
+        {RequestID: "leave-4", EmployeeID: "E-9", Type: "vacation", StartDate: "2025-06-11", EndDate: "2025-06-11", Status: models.LeaveApproved},
+        {RequestID: "leave-5", EmployeeID: "E-2", Type: "vacation", StartDate: "2025-06-13", EndDate: "2025-06-13", Status: models.LeaveCancelled},
+    } {
+        _ = requests.Save(ctx, &r)
+    }
+    leave := NewLeaveService(requests, emps, nil, nil)
+    leave.SetCalendar(cal)
+    svc := NewLeaveCalendarService(leave, NewInMemoryCalendarFeedStore(), NewInMemoryAuditLog(), 0)
+    svc.now = func() time.Time { return time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC) }
+    return svc
+}
+
+func outByDate(cal *LeaveCalendar) map[string]int {
+    out := map[string]int{}
+    for _, d := range cal.Days {
+        out[d.Date] = d.Out
+    }
+    return out
+}
+
+func TestLeaveCalendarService_Calendar(t *testing.T) {
+    ctx := context.Background()
+    svc := newLeaveCalendarTestService(t)
+    boss := LeaveActor{User: "boss", EmployeeID: "M-1"}
+
+    cal, err := svc.Calendar(ctx, boss, LeaveCalendarQuery{From: "2025-06-06", To: "2025-06-13"})
+    if err != nil {
+        t.Fatalf("calendar: %v", err)
+    }
+    // E-9 reports elsewhere; the canceled request is left out
+    if cal.Team != 4 || cal.MaxOut != DefaultLeaveMaxOut || len(cal.Entries) != 3 || cal.Entries[0].Name != "Ana Cruz" || cal.Entries[0].Label != "Vacation leave" {
+        t.Fatalf("calendar: %+v", cal)
+    }
+    // nobody is out on the holiday; the Davao holiday is not the team's
+    want := map[string]int{"2025-06-06": 0, "2025-06-09": 1, "2025-06-10": 2, "2025-06-11": 3, "2025-06-12": 0, "2025-06-13": 1}
+    for date, n := range outByDate(cal) {
+        if w, ok := want[date]; ok && n != w {
+            t.Fatalf("%s: %d out, want %d", date, n, w)
+        }
+    }
+    for _, d := range cal.Days {
+        if d.Overlap != (d.Date == "2025-06-11") {
+            t.Fatalf("overlap: %+v", d)
+        }
+        if (len(d.Holidays) > 0) != (d.Date == "2025-06-06" || d.Date == "2025-06-12") {
+            t.Fatalf("holidays: %+v", d)
+        }
+    }
+    if d := cal.Days[5]; d.Date != "2025-06-11" || strings.Join(d.Approved, ",") != "E-1,E-3" || strings.Join(d.Pending, ",") != "E-2" {
+        t.Fatalf("June 11: %+v", d)
+    }
+
+    cal, _ = svc.Calendar(ctx, boss, LeaveCalendarQuery{Unit: "ou-ops", From: "2025-06-06", To: "2025-06-13", MaxOut: 1})
+    if cal.Team != 2 || outByDate(cal)["2025-06-11"] != 2 || !cal.Days[5].Overlap {
+        t.Fatalf("unit: %+v", cal)
+    }
+    // further down the chain, and only one's own leave without reports
+    if cal, _ := svc.Calendar(ctx, LeaveActor{User: "ben", EmployeeID: "E-2"}, LeaveCalendarQuery{From: "2025-06-06", To: "2025-06-13"}); cal.Team != 2 || len(cal.Entries) != 2 {
+        t.Fatalf("E-2: %+v", cal)
+    }
+    if cal, _ := svc.Calendar(ctx, LeaveActor{User: "ana", EmployeeID: "E-1"}, LeaveCalendarQuery{From: "2025-06-06", To: "2025-06-13"}); cal.Team != 1 || len(cal.Entries) != 1 {
+        t.Fatalf("E-1: %+v", cal)
+    }
+    if cal, _ := svc.Calendar(ctx, LeaveActor{User: "hr", Roles: []string{RoleHR}}, LeaveCalendarQuery{}); cal.Team != 5 || cal.From != "2025-06-01" || cal.To != "2025-06-30" || outByDate(cal)["2025-06-11"] != 4 {
+        t.Fatalf("hr: %+v", cal)
+    }
+
+    if _, err := svc.Calendar(ctx, LeaveActor{User: "nobody"}, LeaveCalendarQuery{}); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("expected ErrLeaveForbidden, got %v", err)
+    }
+    for _, q := range []LeaveCalendarQuery{
+        {From: "2025-06-13", To: "2025-06-06"},
+        {From: "2025-06-06"},
+        {From: "2025-01-01", To: "2027-12-31"},
+    } {
+        if _, err := svc.Calendar(ctx, boss, q); !errors.Is(err, ErrInvalidLeave) {
+            t.Fatalf("expected ErrInvalidLeave for %+v, got %v", q, err)
+        }
+    }
+}
+
+func TestLeaveCalendarService_Feed(t *testing.T) {
+    ctx := context.Background()
+    svc := newLeaveCalendarTestService(t)
+    boss := LeaveActor{User: "boss", EmployeeID: "M-1"}
+
+    token, err := svc.IssueFeedToken(ctx, boss)
+    if err != nil || len(token) != 64 {
+        t.Fatalf("token: %v %q", err, token)
+    }
+    if owner, err := svc.FeedOwner(ctx, token); err != nil || owner != "boss" {
+        t.Fatalf("owner: %v %q", err, owner)
+    }
+    body, err := svc.Feed(ctx, boss, "")
+    if err != nil {
+        t.Fatalf("feed: %v", err)
+    }
+    ics := string(body)
+    for _, want := range []string{
+        "BEGIN:VCALENDAR\r\n",
+        "UID:leave-1@hris\r\nDTSTAMP:",
+        "DTSTART;VALUE=DATE:20250609\r\nDTEND;VALUE=DATE:20250614\r\nSUMMARY:Ana Cruz: Vacation leave\r\n",
+        "SUMMARY:Ben: Sick leave (pending)\r\nTRANSP:TRANSPARENT\r\nSTATUS:TENTATIVE\r\n",
+        "DESCRIPTION:From noon on 2025-06-09.\r\n",
+        "SUMMARY:Independence Day\r\nTRANSP:TRANSPARENT\r\nCATEGORIES:Regular holiday\r\n",
+        "UID:overlap-2025-06-11@hris\r\n",
+        "SUMMARY:3 people out (limit 2)\r\n",
+        "END:VCALENDAR\r\n",
+    } {
+        if !strings.Contains(ics, want) {
+            t.Fatalf("feed lacks %q:\n%s", want, ics)
+        }
+    }
+    if strings.Contains(ics, "Davao") || strings.Contains(ics, "leave-4@") {
+        t.Fatalf("feed shows more than the team:\n%s", ics)
+    }
+
+    // a new token replaces the old one
+    again, _ := svc.IssueFeedToken(ctx, boss)
+    if _, err := svc.FeedOwner(ctx, token); !errors.Is(err, ErrInvalidFeedToken) {
+        t.Fatalf("old token still works: %v", err)
+    }
+    if err := svc.RevokeFeedToken(ctx, boss); err != nil {
+        t.Fatalf("revoke: %v", err)
+    }
+    if _, err := svc.FeedOwner(ctx, again); !errors.Is(err, ErrInvalidFeedToken) {
+        t.Fatalf("revoked token still works: %v", err)
+    }
+}
+
+func TestLeaveCalendarICal_Folding(t *testing.T) {
+    cal := &LeaveCalendar{Entries: []LeaveCalendarEntry{{
+        RequestID: "leave-1", Name: "María Dolores de los Santos-Villanueva, Jr. of Quezon City", Label: "Leave; without pay", Status: models.LeaveApproved,
+        StartDate: "2025-06-09", EndDate: "2025-06-09",
+    }}}
+    ics := string(leaveCalendarICal(cal, time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)))
+    for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+        if len(line) > 75 {
+            t.Fatalf("line of %d octets: %q", len(line), line)
+        }
+    }
+    unfolded, _ := unfoldICal(strings.NewReader(ics))
+    if !strings.Contains(strings.Join(unfolded, "\n"), `SUMMARY:María Dolores de los Santos-Villanueva\, Jr. of Quezon City: Leave\; without pay`) {
+        t.Fatalf("summary: %s", ics)
+    }
+}
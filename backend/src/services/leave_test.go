@@ -0,0 +1,232 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+)
+
+// fakeLeaveBalances records what approvals charged; Take fails with fail
+// when it is set.
+type fakeLeaveBalances struct {
+    taken map[string]float64
+    fail  error
+}
+
+func (b *fakeLeaveBalances) Check(ctx context.Context, r *models.LeaveRequest) error {
+    return nil
+}
+
+func (b *fakeLeaveBalances) Take(ctx context.Context, actor string, r *models.LeaveRequest) (float64, error) {
+    if b.fail != nil {
+        return 0, b.fail
+    }
+    b.taken[r.RequestID] += r.DurationDays
+    return r.DurationDays, nil
+}
+
+func (b *fakeLeaveBalances) Restore(ctx context.Context, actor string, r *models.LeaveRequest) error {
+    b.taken[r.RequestID] -= r.BalanceImpact
+    return nil
+}
+
+func newLeaveTestService(t *testing.T) (*LeaveService, *InMemoryAuditLog, *fakeLeaveBalances) {
+    t.Helper()
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "manager_id": "M-1"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "M-1", "manager_id": "M-2"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "M-2"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-3", "termination_date": "2025-05-31"})
+    policies, err := ParseLeaveApprovalLevels("vacation=2", DefaultLeavePolicies())
+    if err != nil {
+        t.Fatalf("policies: %v", err)
+    }
+    audit := NewInMemoryAuditLog()
+    svc := NewLeaveService(NewInMemoryLeaveStore(), emps, audit, policies)
+    svc.now = func() time.Time { return time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC) }
+    b := &fakeLeaveBalances{taken: map[string]float64{}}
+    svc.SetBalances(b)
+    return svc, audit, b
+}
+
+func TestLeaveService_MultiLevelApproval(t *testing.T) {
+    ctx := context.Background()
+    svc, audit, balances := newLeaveTestService(t)
+    emp := LeaveActor{User: "emp", EmployeeID: "E-1", Roles: []string{RoleEmployee}}
+    m1 := LeaveActor{User: "boss", EmployeeID: "M-1", Roles: []string{RoleManager}}
+    m2 := LeaveActor{User: "bigboss", EmployeeID: "M-2", Roles: []string{RoleManager}}
+
+    // Friday to Tuesday: three working days
+    r, err := svc.Submit(ctx, emp, models.LeaveRequest{Type: "Vacation", StartDate: "2025-06-13", EndDate: "2025-06-17", Reason: "family trip"})
+    if err != nil || r.DurationDays != 3 || r.Status != models.LeavePending || len(r.Approvals) != 2 || *r.ApproverID != "M-1" {
+        t.Fatalf("submit: %v %+v", err, r)
+    }
+    if _, err := svc.Submit(ctx, emp, models.LeaveRequest{Type: "sick", StartDate: "2025-06-17", EndDate: "2025-06-17"}); !errors.Is(err, ErrLeaveOverlap) {
+        t.Fatalf("expected ErrLeaveOverlap, got %v", err)
+    }
+    if _, err := svc.Approve(ctx, m2, r.RequestID, ""); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("second level approved out of turn: %v", err)
+    }
+    if items, _ := svc.Pending(ctx, m1); len(items) != 1 {
+        t.Fatalf("pending for M-1: %+v", items)
+    }
+
+    r, err = svc.Approve(ctx, m1, r.RequestID, "ok")
+    if err != nil || r.Status != models.LeavePending || r.Level != 1 || *r.ApproverID != "M-2" {
+        t.Fatalf("first level: %v %+v", err, r)
+    }
+    if items, _ := svc.Pending(ctx, m1); len(items) != 0 {
+        t.Fatalf("still pending for M-1: %+v", items)
+    }
+    r, err = svc.Approve(ctx, m2, r.RequestID, "")
+    if err != nil || r.Status != models.LeaveApproved || r.BalanceImpact != 3 || balances.taken[r.RequestID] != 3 {
+        t.Fatalf("second level: %v %+v", err, r)
+    }
+    if h := r.ApproverHistory; len(h) != 3 || h[0].Action != models.LeaveActionSubmit || h[1].ApproverID != "M-1" || h[1].Level != 1 || h[2].ApproverID != "M-2" || h[2].Action != models.LeaveActionApprove {
+        t.Fatalf("history: %+v", h)
+    }
+    if _, err := svc.Reject(ctx, m2, r.RequestID, "changed my mind"); !errors.Is(err, ErrLeaveState) {
+        t.Fatalf("expected ErrLeaveState, got %v", err)
+    }
+
+    // the employee may withdraw approved leave before it starts
+    if _, err := svc.Cancel(ctx, m1, r.RequestID, ""); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("manager cancelled: %v", err)
+    }
+    r, err = svc.Cancel(ctx, emp, r.RequestID, "trip postponed")
+    if err != nil || r.Status != models.LeaveCancelled || balances.taken[r.RequestID] != 0 {
+        t.Fatalf("cancel: %v %+v", err, r)
+    }
+    entries, _ := audit.List(ctx, r.RequestID)
+    if len(entries) != 4 || entries[0].Action != "leave.cancel" {
+        t.Fatalf("audit: %+v", entries)
+    }
+
+    // a rejection needs a reason and ends the request
+    r, _ = svc.Submit(ctx, emp, models.LeaveRequest{Type: "sick", StartDate: "2025-06-17", EndDate: "2025-06-17"})
+    if len(r.Approvals) != 1 {
+        t.Fatalf("sick leave is single level: %+v", r.Approvals)
+    }
+    if _, err := svc.Reject(ctx, m1, r.RequestID, ""); !errors.Is(err, ErrInvalidLeave) {
+        t.Fatalf("expected ErrInvalidLeave, got %v", err)
+    }
+    if r, err := svc.Reject(ctx, m1, r.RequestID, "peak season"); err != nil || r.Status != models.LeaveRejected || *r.ApproverID != "M-1" {
+        t.Fatalf("reject: %v %+v", err, r)
+    }
+    if items, err := svc.List(ctx, emp, LeaveFilter{}); err != nil || len(items) != 2 {
+        t.Fatalf("list: %v %+v", err, items)
+    }
+    if _, err := svc.List(ctx, emp, LeaveFilter{EmployeeID: "M-1"}); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("listed another employee's leave: %v", err)
+    }
+}
+
+func TestLeaveService_StaleDecisions(t *testing.T) {
+    ctx := context.Background()
+    svc, _, balances := newLeaveTestService(t)
+    emp := LeaveActor{User: "emp", EmployeeID: "E-1"}
+    m1 := LeaveActor{User: "boss", EmployeeID: "M-1"}
+    hr := LeaveActor{User: "hr", Roles: []string{RoleHR}}
+
+    // a failed charge leaves the request pending
+    r, _ := svc.Submit(ctx, emp, models.LeaveRequest{Type: "sick", StartDate: "2025-06-17", EndDate: "2025-06-18"})
+    balances.fail = ErrInsufficientLeave
+    if _, err := svc.Approve(ctx, m1, r.RequestID, ""); !errors.Is(err, ErrInsufficientLeave) {
+        t.Fatalf("expected ErrInsufficientLeave, got %v", err)
+    }
+    if got, _ := svc.Get(ctx, hr, r.RequestID); got.Status != models.LeavePending || len(got.ApproverHistory) != 1 || balances.taken[r.RequestID] != 0 {
+        t.Fatalf("after failed charge: %+v", got)
+    }
+
+    // a decision taken on a stale copy is refused and charges nothing
+    balances.fail = nil
+    stale, _ := svc.store.Get(ctx, r.RequestID)
+    if _, err := svc.Approve(ctx, m1, r.RequestID, ""); err != nil {
+        t.Fatalf("approve: %v", err)
+    }
+    stale.Status = models.LeaveRejected
+    stale.Version++
+    if err := svc.store.Save(ctx, stale); !errors.Is(err, ErrLeaveState) {
+        t.Fatalf("expected ErrLeaveState, got %v", err)
+    }
+    if got, _ := svc.Get(ctx, hr, r.RequestID); got.Status != models.LeaveApproved || balances.taken[r.RequestID] != 2 {
+        t.Fatalf("after stale save: %+v %v", got, balances.taken)
+    }
+}
+
+func TestLeaveService_HRLevelAndValidation(t *testing.T) {
+    ctx := context.Background()
+    svc, _, _ := newLeaveTestService(t)
+    hr := LeaveActor{User: "hr", Roles: []string{RoleHR}}
+    m2 := LeaveActor{User: "bigboss", EmployeeID: "M-2", Roles: []string{RoleManager, RoleHR}}
+
+    // M-2 has no manager: HR decides
+    r, err := svc.Submit(ctx, m2, models.LeaveRequest{Type: "vacation", StartDate: "2025-06-02", EndDate: "2025-06-02"})
+    if err != nil || len(r.Approvals) != 1 || r.Approvals[0].ApproverID != "" || r.ApproverID != nil {
+        t.Fatalf("submit: %v %+v", err, r)
+    }
+    if _, err := svc.Approve(ctx, m2, r.RequestID, ""); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("self approval: %v", err)
+    }
+    if r, err := svc.Approve(ctx, hr, r.RequestID, ""); err != nil || r.Status != models.LeaveApproved || r.ApproverHistory[1].ApproverID != "hr" {
+        t.Fatalf("hr approval: %v %+v", err, r)
+    }
+    // started leave can only be cancelled by HR
+    if _, err := svc.Cancel(ctx, LeaveActor{User: "bigboss", EmployeeID: "M-2"}, r.RequestID, ""); !errors.Is(err, ErrLeaveState) {
+        t.Fatalf("expected ErrLeaveState, got %v", err)
+    }
+
+    for _, bad := range []models.LeaveRequest{
+        {EmployeeID: "E-1", Type: "sabbatical", StartDate: "2025-06-02", EndDate: "2025-06-02"},
+        {EmployeeID: "E-1", Type: "vacation", StartDate: "2025-06-03", EndDate: "2025-06-02"},
+        {EmployeeID: "E-1", Type: "vacation", StartDate: "2025-06-07", EndDate: "2025-06-08"}, // weekend
+        {EmployeeID: "E-3", Type: "vacation", StartDate: "2025-06-09", EndDate: "2025-06-09"}, // terminated
+        {EmployeeID: "E-9", Type: "vacation", StartDate: "2025-06-09", EndDate: "2025-06-09"},
+    } {
+        if _, err := svc.Submit(ctx, hr, bad); !errors.Is(err, ErrInvalidLeave) {
+            t.Fatalf("expected ErrInvalidLeave for %+v, got %v", bad, err)
+        }
+    }
+    if _, err := svc.Submit(ctx, LeaveActor{User: "emp", EmployeeID: "E-1"}, models.LeaveRequest{EmployeeID: "M-1", Type: "sick", StartDate: "2025-06-09", EndDate: "2025-06-09"}); !errors.Is(err, ErrLeaveForbidden) {
+        t.Fatalf("filed for someone else: %v", err)
+    }
+    if _, err := ParseLeaveApprovalLevels("vacation=0", nil); !errors.Is(err, ErrInvalidLeave) {
+        t.Fatalf("expected ErrInvalidLeave, got %v", err)
+    }
+}
+
+func TestLeaveService_HalfDaysAndHolidays(t *testing.T) {
+    ctx := context.Background()
+    svc, _, _ := newLeaveTestService(t)
+    cal := NewHolidayCalendar(NewInMemoryHolidayStore(), nil, nil)
+    if _, err := cal.Add(ctx, "hr", "manual", []models.Holiday{{Date: "2025-06-12", Name: "Independence Day", Kind: models.HolidayRegular}}); err != nil {
+        t.Fatalf("holiday: %v", err)
+    }
+    svc.SetCalendar(cal)
+    emp := LeaveActor{User: "emp", EmployeeID: "E-1"}
+
+    // June 9 to 13 less the holiday and the morning of the 9th
+    r, err := svc.Submit(ctx, emp, models.LeaveRequest{Type: "vacation", StartDate: "2025-06-09", EndDate: "2025-06-13", StartHalfDay: true})
+    if err != nil || r.DurationDays != 3.5 {
+        t.Fatalf("submit: %v %+v", err, r)
+    }
+    // the other half of June 9 is still free
+    if r, err := svc.Submit(ctx, emp, models.LeaveRequest{Type: "sick", StartDate: "2025-06-09", EndDate: "2025-06-09", EndHalfDay: true}); err != nil || r.DurationDays != 0.5 {
+        t.Fatalf("other half: %v %+v", err, r)
+    }
+    if _, err := svc.Submit(ctx, emp, models.LeaveRequest{Type: "sick", StartDate: "2025-06-13", EndDate: "2025-06-13", StartHalfDay: true}); !errors.Is(err, ErrLeaveOverlap) {
+        t.Fatalf("expected ErrLeaveOverlap, got %v", err)
+    }
+    for _, bad := range []models.LeaveRequest{
+        {Type: "vacation", StartDate: "2025-06-16", EndDate: "2025-06-16", StartHalfDay: true, EndHalfDay: true},
+        {Type: "vacation", StartDate: "2025-06-12", EndDate: "2025-06-12"}, // holiday
+    } {
+        if _, err := svc.Submit(ctx, emp, bad); !errors.Is(err, ErrInvalidLeave) {
+            t.Fatalf("expected ErrInvalidLeave for %+v, got %v", bad, err)
+        }
+    }
+}
@@ -0,0 +1,553 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+    // ErrInvalidLoan wraps malformed loan entries.
+    ErrInvalidLoan = errors.New("invalid loan")
+    // ErrLoanState is returned for an action the loan's status does not allow.
+    ErrLoanState = errors.New("loan status does not allow this action")
+)
+
+var loanLabels = map[string]string{
+    models.LoanSalary:      "Salary loan",
+    models.LoanSSS:         "SSS loan",
+    models.LoanPagIBIG:     "Pag-IBIG loan",
+    models.LoanCashAdvance: "Cash advance",
+    models.LoanOther:       "Recurring deduction",
+}
+
+// LoanFilter selects loans; empty fields match all.
+type LoanFilter struct {
+    EmployeeID string
+    Status     string
+    Type       string
+}
+
+func (f LoanFilter) match(l models.Loan) bool {
+    return (f.EmployeeID == "" || l.EmployeeID == f.EmployeeID) &&
+        (f.Status == "" || l.Status == f.Status) &&
+        (f.Type == "" || l.Type == f.Type)
+}
+
+// LoanStore persists loans with their ledgers.
+type LoanStore interface {
+    Save(ctx context.Context, l *models.Loan) error
+    Get(ctx context.Context, loanID string) (*models.Loan, error)
+    List(ctx context.Context, f LoanFilter) ([]models.Loan, error)
+}
+
+// LoanService records employee loans and recurring deductions. Installments
+// are deducted by LoanRule and posted to each loan's ledger when the run is
+// finalized.
+type LoanService struct {
+    store     LoanStore
+    employees EmployeeRepo
+    audit     AuditLog
+    now       func() time.Time
+}
+
+// NewLoanService creates the service.
+func NewLoanService(store LoanStore, employees EmployeeRepo, audit AuditLog) *LoanService {
+    return &LoanService{store: store, employees: employees, audit: audit, now: time.Now}
+}
+
+// loanSeq keeps loan ids unique within a timestamp.
+var loanSeq int64
+
+// Create validates and stores a loan. Either the installment or the number
+// of terms is required; the other is derived from the principal, rounding
+// the installment up so the last one is never larger than the rest.
+func (s *LoanService) Create(ctx context.Context, actor string, l models.Loan) (*models.Loan, error) {
+    if l.EmployeeID == "" {
+        return nil, fmt.Errorf("%w: employee_id required", ErrInvalidLoan)
+    }
+    if _, ok := loanLabels[l.Type]; !ok {
+        return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidLoan, l.Type)
+    }
+    if _, err := time.Parse("2006-01-02", l.StartPeriod); err != nil {
+        return nil, fmt.Errorf("%w: start_period %v", ErrInvalidLoan, err)
+    }
+    if _, err := s.employees.Get(ctx, l.EmployeeID); err != nil {
+        return nil, err
+    }
+    if l.Currency == "" {
+        l.Currency = money.DefaultCurrency
+    }
+    l.Principal = l.Principal.WithCurrency(l.Currency).Round(money.HalfEven)
+    l.Installment = l.Installment.WithCurrency(l.Currency).Round(money.HalfEven)
+    if l.Principal.Sign() <= 0 {
+        return nil, fmt.Errorf("%w: principal must be positive", ErrInvalidLoan)
+    }
+    if l.Installment.Sign() < 0 || l.Terms < 0 {
+        return nil, fmt.Errorf("%w: installment and terms must not be negative", ErrInvalidLoan)
+    }
+    switch {
+    case l.Installment.IsZero() && l.Terms == 0:
+        return nil, fmt.Errorf("%w: installment or terms required", ErrInvalidLoan)
+    case l.Installment.IsZero():
+        l.Installment = l.Principal.Div(int64(l.Terms), money.HalfEven).Round(money.HalfEven)
+        if l.Installment.Mul(int64(l.Terms)).LessThan(l.Principal) {
+            l.Installment = l.Installment.Add(money.FromMinor(1, l.Currency))
+        }
+    case l.Installment.LessThan(l.Principal):
+        p, i := l.Principal.Minor(money.HalfEven), l.Installment.Minor(money.HalfEven)
+        l.Terms = int((p + i - 1) / i)
+    default:
+        l.Installment, l.Terms = l.Principal, 1
+    }
+    if l.Label == "" {
+        l.Label = loanLabels[l.Type]
+    }
+    now := s.now()
+    l.LoanID = fmt.Sprintf("loan-%d-%d", now.UnixNano(), atomic.AddInt64(&loanSeq, 1))
+    l.Balance = l.Principal
+    l.Status = models.LoanActive
+    l.Ledger = nil
+    l.CreatedBy, l.CreatedAt = actor, now.Unix()
+    l.ClosedAt, l.CancelReason = 0, ""
+    if err := s.store.Save(ctx, &l); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "loan.create", l.LoanID, map[string]interface{}{
+        "employee_id": l.EmployeeID, "type": l.Type, "principal": l.Principal.String(), "installment": l.Installment.String(), "terms": l.Terms,
+    }); err != nil {
+        return nil, err
+    }
+    return &l, nil
+}
+
+// Get returns a loan with its ledger.
+func (s *LoanService) Get(ctx context.Context, loanID string) (*models.Loan, error) {
+    return s.store.Get(ctx, loanID)
+}
+
+// List returns the loans matching f, newest first.
+func (s *LoanService) List(ctx context.Context, f LoanFilter) ([]models.Loan, error) {
+    return s.store.List(ctx, f)
+}
+
+// Cancel stops further deductions of an active loan, e.g. when it was
+// settled outside payroll. Its ledger is kept.
+func (s *LoanService) Cancel(ctx context.Context, actor, loanID, reason string) (*models.Loan, error) {
+    if strings.TrimSpace(reason) == "" {
+        return nil, fmt.Errorf("%w: reason required", ErrInvalidLoan)
+    }
+    l, err := s.store.Get(ctx, loanID)
+    if err != nil {
+        return nil, err
+    }
+    if l.Status != models.LoanActive {
+        return nil, fmt.Errorf("%w: loan is %s", ErrLoanState, l.Status)
+    }
+    l.Status, l.CancelReason, l.ClosedAt = models.LoanCancelled, reason, s.now().Unix()
+    if err := s.store.Save(ctx, l); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "loan.cancel", loanID, map[string]interface{}{"reason": reason, "balance": l.Balance.String()}); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+// LoanInstallment is one projected installment of a loan.
+type LoanInstallment struct {
+    Sequence int         `json:"sequence"` // counted from the loan's first installment
+    Amount   money.Money `json:"amount"`
+    Balance  money.Money `json:"balance"` // after the installment
+}
+
+// LoanView is a loan with its projected schedule.
+type LoanView struct {
+    models.Loan
+    Schedule []LoanInstallment `json:"schedule"`
+}
+
+// NewLoanView projects the schedule of l.
+func NewLoanView(l models.Loan) LoanView {
+    return LoanView{Loan: l, Schedule: LoanSchedule(l)}
+}
+
+// LoanSchedule projects the remaining installments of a loan from its
+// current balance. Deferred installments push the schedule out by a period
+// each.
+func LoanSchedule(l models.Loan) []LoanInstallment {
+    out := []LoanInstallment{}
+    if l.Status != models.LoanActive || l.Installment.Sign() <= 0 {
+        return out
+    }
+    seq := 0
+    for _, e := range l.Ledger {
+        if e.Kind == models.LedgerDeduction {
+            seq++
+        }
+    }
+    for bal := l.Balance; bal.Sign() > 0; {
+        amt := l.Installment.Min(bal)
+        bal = bal.Sub(amt)
+        seq++
+        out = append(out, LoanInstallment{Sequence: seq, Amount: amt, Balance: bal})
+    }
+    return out
+}
+
+// ActiveLoans returns the employee's active loans whose first period ends
+// on or before periodEnd, oldest first. It is the LoanSource of LoanRule.
+func (s *LoanService) ActiveLoans(ctx context.Context, employeeID, periodEnd string) ([]models.Loan, error) {
+    loans, err := s.store.List(ctx, LoanFilter{EmployeeID: employeeID, Status: models.LoanActive})
+    if err != nil {
+        return nil, err
+    }
+    out := loans[:0]
+    for _, l := range loans {
+        if l.StartPeriod <= periodEnd && l.Balance.Sign() > 0 {
+            out = append(out, l)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].StartPeriod != out[j].StartPeriod {
+            return out[i].StartPeriod < out[j].StartPeriod
+        }
+        return out[i].LoanID < out[j].LoanID
+    })
+    return out, nil
+}
+
+// PostRun writes a ledger entry for every loan line of a run's payslips:
+// the installment deducted and any part deferred by the net pay floor. It is
+// called when the run is finalized; a loan closed or paid down by another
+// run since the payslips were generated stops the run until it is
+// regenerated. Every loan is checked before any is saved, and a failed save
+// puts back the loans already saved. Posting a run twice has no effect.
+func (s *LoanService) PostRun(ctx context.Context, actor string, run *models.PayrollRun, slips []models.Payslip) error {
+    type posting struct {
+        slip models.Payslip
+        line models.PayslipLine
+    }
+    byLoan := map[string][]posting{}
+    var ids []string
+    for _, p := range slips {
+        for _, line := range p.Lines {
+            id := line.Inputs["loan_id"]
+            if id == "" {
+                continue
+            }
+            if _, seen := byLoan[id]; !seen {
+                ids = append(ids, id)
+            }
+            byLoan[id] = append(byLoan[id], posting{p, line})
+        }
+    }
+    var changed, originals []*models.Loan
+    for _, id := range ids {
+        l, err := s.store.Get(ctx, id)
+        if err != nil {
+            return fmt.Errorf("loan %s: %w", id, err)
+        }
+        posted := false
+        for _, e := range l.Ledger {
+            posted = posted || e.RunID == run.RunID
+        }
+        if posted {
+            continue
+        }
+        orig := *l
+        orig.Ledger = append([]models.LoanLedgerEntry(nil), l.Ledger...)
+        if l.Status != models.LoanActive {
+            return fmt.Errorf("%w: loan %s is %s; reject and regenerate", ErrRunState, id, l.Status)
+        }
+        now := s.now().Unix()
+        for _, p := range byLoan[id] {
+            amt := p.line.Amount.WithCurrency(l.Currency)
+            if l.Balance.LessThan(amt) {
+                return fmt.Errorf("%w: loan %s balance is %s; reject and regenerate", ErrRunState, id, l.Balance)
+            }
+            deferred, _ := money.Parse(p.line.Inputs["deferred"], l.Currency)
+            kind := models.LedgerDeduction
+            if amt.IsZero() {
+                kind = models.LedgerDeferred
+            }
+            l.Balance = l.Balance.Sub(amt)
+            l.Ledger = append(l.Ledger, models.LoanLedgerEntry{
+                Kind: kind, RunID: run.RunID, PayslipID: p.slip.PayslipID, PeriodEnd: run.PeriodEnd,
+                Amount: amt, Deferred: deferred, Balance: l.Balance, CreatedBy: actor, CreatedAt: now,
+            })
+        }
+        if l.Balance.IsZero() {
+            l.Status, l.ClosedAt = models.LoanPaid, now
+        }
+        changed, originals = append(changed, l), append(originals, &orig)
+    }
+    for i, l := range changed {
+        if err := s.store.Save(ctx, l); err != nil {
+            for _, o := range originals[:i] {
+                if rerr := s.store.Save(ctx, o); rerr != nil {
+                    return fmt.Errorf("%v; restoring loan %s: %w", err, o.LoanID, rerr)
+                }
+            }
+            return err
+        }
+    }
+    for _, l := range changed {
+        last := l.Ledger[len(l.Ledger)-1]
+        if err := recordAudit(ctx, s.audit, actor, "loan.post", l.LoanID, map[string]interface{}{
+            "run_id": run.RunID, "amount": last.Amount.String(), "deferred": last.Deferred.String(), "balance": l.Balance.String(),
+        }); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// UnpostRun removes the ledger entries PostRun wrote for run, giving the
+// amounts back to the balances and reopening loans the run paid off.
+func (s *LoanService) UnpostRun(ctx context.Context, actor string, run *models.PayrollRun, slips []models.Payslip) error {
+    seen := map[string]bool{}
+    for _, p := range slips {
+        for _, line := range p.Lines {
+            id := line.Inputs["loan_id"]
+            if id == "" || seen[id] {
+                continue
+            }
+            seen[id] = true
+            l, err := s.store.Get(ctx, id)
+            if err != nil {
+                return fmt.Errorf("loan %s: %w", id, err)
+            }
+            kept := l.Ledger[:0]
+            restored := money.Zero(l.Currency)
+            for _, e := range l.Ledger {
+                if e.RunID == run.RunID {
+                    restored = restored.Add(e.Amount)
+                    continue
+                }
+                kept = append(kept, e)
+            }
+            if len(kept) == len(l.Ledger) {
+                continue
+            }
+            l.Ledger, l.Balance = kept, l.Balance.Add(restored)
+            if l.Status == models.LoanPaid && !l.Balance.IsZero() {
+                l.Status, l.ClosedAt = models.LoanActive, 0
+            }
+            if err := s.store.Save(ctx, l); err != nil {
+                return err
+            }
+            if err := recordAudit(ctx, s.audit, actor, "loan.unpost", l.LoanID, map[string]interface{}{
+                "run_id": run.RunID, "amount": restored.String(), "balance": l.Balance.String(),
+            }); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// LoanLedger posts the loan installments of a finalized run.
+type LoanLedger interface {
+    PostRun(ctx context.Context, actor string, run *models.PayrollRun, slips []models.Payslip) error
+    // UnpostRun reverses PostRun when the run could not be finalized after all.
+    UnpostRun(ctx context.Context, actor string, run *models.PayrollRun, slips []models.Payslip) error
+}
+
+// LoanSource supplies the loans LoanRule deducts.
+type LoanSource interface {
+    ActiveLoans(ctx context.Context, employeeID, periodEnd string) ([]models.Loan, error)
+}
+
+// LoanDeferral policies applied when an installment would take net pay
+// below the floor.
+const (
+    DeferSkip    = "skip"    // deduct nothing this period
+    DeferPartial = "partial" // deduct down to the floor, defer the rest
+)
+
+// LoanRule deducts loan installments after tax, oldest loan first. An
+// installment that would leave net pay below Floor (in the payslip
+// currency) is deferred by the Deferral policy; the balance then runs for
+// more periods. Off-cycle runs deduct nothing unless the request settles
+// loans, as final pay does with the whole balance.
+type LoanRule struct {
+    Loans    LoanSource
+    Floor    string // minimum net pay, e.g. "5000"; zero when empty
+    Deferral string // skip (default) or partial
+}
+
+func (LoanRule) Name() string { return "loans" }
+
+func (r LoanRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    if pc.Request.OffCycle && !pc.Request.SettleLoans {
+        return nil, nil
+    }
+    loans, err := r.Loans.ActiveLoans(pc.Ctx, pc.Request.EmployeeID, pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    floor := money.Zero(pc.Currency)
+    if r.Floor != "" {
+        if floor, err = money.Parse(r.Floor, pc.Currency); err != nil {
+            return nil, fmt.Errorf("net pay floor: %w", err)
+        }
+    }
+    net := pc.Sum(models.LineEarning).Sub(pc.Sum(models.LineDeduction)).Sub(pc.Sum(models.LineContribution)).Sub(pc.Sum(models.LineTax))
+    var lines []models.PayslipLine
+    for _, l := range loans {
+        if l.Currency != pc.Currency {
+            continue
+        }
+        due := l.Installment.Min(l.Balance)
+        formula := "min(installment, balance)"
+        if pc.Request.SettleLoans {
+            due, formula = l.Balance, "balance"
+        }
+        amt := due
+        if room := net.Sub(floor).Max(money.Zero(pc.Currency)); room.LessThan(amt) {
+            amt = money.Zero(pc.Currency)
+            if r.Deferral == DeferPartial {
+                amt = room
+            }
+            formula += ", limited to net_pay − net_pay_floor"
+        }
+        net = net.Sub(amt)
+        label := l.Label
+        if l.Reference != "" {
+            label += " " + l.Reference
+        }
+        if amt.IsZero() {
+            label += " (deferred)"
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: l.Type, Label: label, Kind: models.LineDeduction, Amount: amt,
+            Inputs: map[string]string{
+                "loan_id": l.LoanID, "installment": l.Installment.String(), "balance": l.Balance.String(),
+                "net_pay_floor": floor.String(), "deferred": due.Sub(amt).String(),
+            },
+            Formula: formula,
+        })
+    }
+    return lines, nil
+}
+
+func restoreLoanCurrency(l *models.Loan) {
+    l.Principal = l.Principal.WithCurrency(l.Currency)
+    l.Installment = l.Installment.WithCurrency(l.Currency)
+    l.Balance = l.Balance.WithCurrency(l.Currency)
+    for i := range l.Ledger {
+        e := &l.Ledger[i]
+        e.Amount = e.Amount.WithCurrency(l.Currency)
+        e.Deferred = e.Deferred.WithCurrency(l.Currency)
+        e.Balance = e.Balance.WithCurrency(l.Currency)
+    }
+}
+
+// InMemoryLoanStore keeps loans in memory.
+type InMemoryLoanStore struct {
+    mu sync.Mutex
+    m  map[string]models.Loan
+}
+
+func NewInMemoryLoanStore() *InMemoryLoanStore {
+    return &InMemoryLoanStore{m: map[string]models.Loan{}}
+}
+
+func (s *InMemoryLoanStore) Save(ctx context.Context, l *models.Loan) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    cp := *l
+    cp.Ledger = append([]models.LoanLedgerEntry(nil), l.Ledger...)
+    s.m[l.LoanID] = cp
+    return nil
+}
+
+func (s *InMemoryLoanStore) Get(ctx context.Context, loanID string) (*models.Loan, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    l, ok := s.m[loanID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    l.Ledger = append([]models.LoanLedgerEntry(nil), l.Ledger...)
+    return &l, nil
+}
+
+func (s *InMemoryLoanStore) List(ctx context.Context, f LoanFilter) ([]models.Loan, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.Loan{}
+    for _, l := range s.m {
+        if f.match(l) {
+            l.Ledger = append([]models.LoanLedgerEntry(nil), l.Ledger...)
+            out = append(out, l)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].CreatedAt != out[j].CreatedAt {
+            return out[i].CreatedAt > out[j].CreatedAt
+        }
+        return out[i].LoanID > out[j].LoanID
+    })
+    return out, nil
+}
+
+// MongoLoanStore stores loans in MongoDB.
+type MongoLoanStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoLoanStore(coll *mongo.Collection) *MongoLoanStore {
+    return &MongoLoanStore{coll: coll}
+}
+
+func (s *MongoLoanStore) Save(ctx context.Context, l *models.Loan) error {
+    _, err := s.coll.ReplaceOne(ctx, bson.M{"loan_id": l.LoanID}, l, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoLoanStore) Get(ctx context.Context, loanID string) (*models.Loan, error) {
+    var l models.Loan
+    if err := s.coll.FindOne(ctx, bson.M{"loan_id": loanID}).Decode(&l); err != nil {
+        return nil, err
+    }
+    restoreLoanCurrency(&l)
+    return &l, nil
+}
+
+func (s *MongoLoanStore) List(ctx context.Context, f LoanFilter) ([]models.Loan, error) {
+    filter := bson.M{}
+    if f.EmployeeID != "" {
+        filter["employee_id"] = f.EmployeeID
+    }
+    if f.Status != "" {
+        filter["status"] = f.Status
+    }
+    if f.Type != "" {
+        filter["type"] = f.Type
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "loan_id", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.Loan{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    for i := range out {
+        restoreLoanCurrency(&out[i])
+    }
+    return out, nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestLoanService_Create(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1"})
+    svc := NewLoanService(NewInMemoryLoanStore(), emps, NewInMemoryAuditLog())
+
+    byTerms, err := svc.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanSalary, Principal: money.MustParse("1000", "PHP"), Terms: 3, StartPeriod: "2025-06-15"})
+    if err != nil || byTerms.Installment.String() != "333.34" || byTerms.Status != models.LoanActive || !byTerms.Balance.Equal(byTerms.Principal) {
+        t.Fatalf("by terms: %v %+v", err, byTerms)
+    }
+    if s := LoanSchedule(*byTerms); len(s) != 3 || s[2].Amount.String() != "333.32" || !s[2].Balance.IsZero() {
+        t.Fatalf("schedule: %+v", s)
+    }
+    byInstallment, err := svc.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanPagIBIG, Principal: money.MustParse("1000", "PHP"), Installment: money.MustParse("300", "PHP"), StartPeriod: "2025-06-15"})
+    if err != nil || byInstallment.Terms != 4 || byInstallment.Label != "Pag-IBIG loan" {
+        t.Fatalf("by installment: %v %+v", err, byInstallment)
+    }
+    for _, l := range []models.Loan{
+        {EmployeeID: "E-1", Type: "car_loan", Principal: money.MustParse("1000", "PHP"), Terms: 2, StartPeriod: "2025-06-15"},
+        {EmployeeID: "E-1", Type: models.LoanSalary, Terms: 2, StartPeriod: "2025-06-15"},
+        {EmployeeID: "E-1", Type: models.LoanSalary, Principal: money.MustParse("1000", "PHP"), StartPeriod: "2025-06-15"},
+        {EmployeeID: "E-1", Type: models.LoanSalary, Principal: money.MustParse("1000", "PHP"), Terms: 2, StartPeriod: "June"},
+    } {
+        if _, err := svc.Create(ctx, "finance", l); !errors.Is(err, ErrInvalidLoan) {
+            t.Fatalf("expected ErrInvalidLoan for %+v, got %v", l, err)
+        }
+    }
+}
+
+func TestLoanRule_DeductsAndPosts(t *testing.T) {
+    ctx := context.Background()
+    runs, _ := newRunTestService(t)
+    loans := NewLoanService(NewInMemoryLoanStore(), runs.employees, NewInMemoryAuditLog())
+    runs.engine.AddRule(LoanRule{Loans: loans, Floor: "5000"})
+    runs.SetLoanLedger(loans)
+
+    sss, _ := loans.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanSSS, Reference: "SL-1", Principal: money.MustParse("1000", "PHP"), Terms: 2, StartPeriod: "2025-06-01"})
+    // 10,000 a period would leave E-1 with less than the 5,000 floor
+    advance, _ := loans.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanCashAdvance, Principal: money.MustParse("20000", "PHP"), Installment: money.MustParse("10000", "PHP"), StartPeriod: "2025-06-01"})
+    // not due yet
+    later, _ := loans.Create(ctx, "finance", models.Loan{EmployeeID: "E-2", Type: models.LoanSalary, Principal: money.MustParse("2000", "PHP"), Terms: 2, StartPeriod: "2025-07-01"})
+
+    var first *models.PayrollRun
+    for _, span := range [][2]string{{"2025-06-01", "2025-06-15"}, {"2025-06-16", "2025-06-30"}} {
+        p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: span[0], End: span[1]})
+        run, err := runs.CreateRun(ctx, "clerk", p.PeriodID)
+        if err != nil {
+            t.Fatalf("run: %v", err)
+        }
+        slips, _ := runs.Payslips(ctx, run.RunID)
+        for _, ps := range slips {
+            if ps.EmployeeID != "E-1" {
+                continue
+            }
+            lines := map[string]models.PayslipLine{}
+            for _, l := range ps.Lines {
+                lines[l.Code] = l
+            }
+            if l := lines[models.LoanSSS]; l.Amount.String() != "500.00" || l.Label != "SSS loan SL-1" || l.Kind != models.LineDeduction {
+                t.Fatalf("sss loan line: %+v", l)
+            }
+            if l := lines[models.LoanCashAdvance]; !l.Amount.IsZero() || l.Inputs["deferred"] != "10000.00" {
+                t.Fatalf("cash advance line: %+v", l)
+            }
+            if ps.Net.LessThan(money.MustParse("5000", "PHP")) {
+                t.Fatalf("net pay below floor: %s", ps.Net)
+            }
+        }
+        if first == nil {
+            first = run
+        }
+        closeRun(t, runs, run.RunID)
+    }
+
+    got, _ := loans.Get(ctx, sss.LoanID)
+    if got.Status != models.LoanPaid || !got.Balance.IsZero() || len(got.Ledger) != 2 || got.Ledger[0].Balance.String() != "500.00" || got.Ledger[1].Kind != models.LedgerDeduction {
+        t.Fatalf("sss loan: %+v", got)
+    }
+    got, _ = loans.Get(ctx, advance.LoanID)
+    if got.Status != models.LoanActive || got.Balance.String() != "20000.00" || len(got.Ledger) != 2 || got.Ledger[0].Kind != models.LedgerDeferred || len(LoanSchedule(*got)) != 2 {
+        t.Fatalf("cash advance: %+v", got)
+    }
+    if got, _ := loans.Get(ctx, later.LoanID); len(got.Ledger) != 0 {
+        t.Fatalf("loan deducted before its start period: %+v", got)
+    }
+
+    // posting is idempotent per run
+    slips, _ := runs.Payslips(ctx, first.RunID)
+    if err := loans.PostRun(ctx, "clerk", first, slips); err != nil {
+        t.Fatalf("repost: %v", err)
+    }
+    if got, _ := loans.Get(ctx, advance.LoanID); len(got.Ledger) != 2 {
+        t.Fatalf("reposted: %+v", got.Ledger)
+    }
+
+    if _, err := loans.Cancel(ctx, "finance", advance.LoanID, ""); !errors.Is(err, ErrInvalidLoan) {
+        t.Fatalf("reason required: %v", err)
+    }
+    if _, err := loans.Cancel(ctx, "finance", advance.LoanID, "settled in cash"); err != nil {
+        t.Fatalf("cancel: %v", err)
+    }
+    if _, err := loans.Cancel(ctx, "finance", sss.LoanID, "paid"); !errors.Is(err, ErrLoanState) {
+        t.Fatalf("expected ErrLoanState, got %v", err)
+    }
+}
+
+// finalizeFailingStore fails to save any run as finalized.
+type finalizeFailingStore struct {
+    PayrollRunStore
+}
+
+func (s finalizeFailingStore) SaveRun(ctx context.Context, r *models.PayrollRun) error {
+    if r.Status == models.RunFinalized {
+        return errors.New("write failed")
+    }
+    return s.PayrollRunStore.SaveRun(ctx, r)
+}
+
+func TestPayrollRunService_FinalizeUndoesLoanPostings(t *testing.T) {
+    ctx := context.Background()
+    runs, _ := newRunTestService(t)
+    loans := NewLoanService(NewInMemoryLoanStore(), runs.employees, NewInMemoryAuditLog())
+    runs.engine.AddRule(LoanRule{Loans: loans})
+    runs.SetLoanLedger(loans)
+    loan, _ := loans.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanSSS, Principal: money.MustParse("500", "PHP"), Terms: 1, StartPeriod: "2025-06-01"})
+
+    p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-15"})
+    run, _ := runs.CreateRun(ctx, "clerk", p.PeriodID)
+    _, _ = runs.Submit(ctx, "clerk", run.RunID)
+    _, _ = runs.Approve(ctx, "boss", []string{RoleAdmin}, run.RunID)
+    store := runs.store
+    runs.store = finalizeFailingStore{store}
+    if _, err := runs.Finalize(ctx, "clerk", run.RunID); err == nil {
+        t.Fatal("finalize succeeded")
+    }
+    if got, _ := loans.Get(ctx, loan.LoanID); got.Status != models.LoanActive || got.Balance.String() != "500.00" || len(got.Ledger) != 0 {
+        t.Fatalf("loan left posted: %+v", got)
+    }
+
+    runs.store = store
+    if _, err := runs.Finalize(ctx, "clerk", run.RunID); err != nil {
+        t.Fatalf("finalize: %v", err)
+    }
+    if got, _ := loans.Get(ctx, loan.LoanID); got.Status != models.LoanPaid || len(got.Ledger) != 1 {
+        t.Fatalf("loan: %+v", got)
+    }
+}
+
+func TestLoanRule_PartialDeferral(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1"})
+    loans := NewLoanService(NewInMemoryLoanStore(), emps, nil)
+    _, _ = loans.Create(ctx, "finance", models.Loan{EmployeeID: "E-1", Type: models.LoanCashAdvance, Principal: money.MustParse("5000", "PHP"), Installment: money.MustParse("2500", "PHP"), StartPeriod: "2025-06-01"})
+    pc := &PayrollContext{
+        Ctx: ctx, Currency: "PHP", Request: PayrollRequest{EmployeeID: "E-1", PeriodEnd: "2025-06-15"},
+        Lines: []models.PayslipLine{{Code: "basic", Kind: models.LineEarning, Amount: money.MustParse("6000", "PHP")}},
+    }
+    lines, err := LoanRule{Loans: loans, Floor: "5000", Deferral: DeferPartial}.Apply(pc)
+    if err != nil || len(lines) != 1 || lines[0].Amount.String() != "1000.00" || lines[0].Inputs["deferred"] != "1500.00" {
+        t.Fatalf("partial: %v %+v", err, lines)
+    }
+    // final pay takes the whole balance
+    pc.Request.OffCycle, pc.Request.SettleLoans = true, true
+    pc.Lines[0].Amount = money.MustParse("20000", "PHP")
+    if lines, _ := (LoanRule{Loans: loans}).Apply(pc); len(lines) != 1 || lines[0].Amount.String() != "5000.00" {
+        t.Fatalf("settle: %+v", lines)
+    }
+    pc.Request.SettleLoans = false
+    if lines, _ := (LoanRule{Loans: loans}).Apply(pc); len(lines) != 0 {
+        t.Fatalf("off-cycle run deducted a loan: %+v", lines)
+    }
+}
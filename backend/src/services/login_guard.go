@@ -0,0 +1,176 @@
+package services
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// LoginGuardConfig tunes brute-force protection for the login endpoints.
+type LoginGuardConfig struct {
+    MaxFailures     int           // failures per username before lockout
+    IPMaxFailures   int           // failures per client IP before lockout
+    LockoutDuration time.Duration // how long a lockout lasts
+    BaseDelay       time.Duration // backoff after the first failure, doubled per failure
+    MaxDelay        time.Duration // backoff cap
+}
+
+// DefaultLoginGuardConfig returns conservative defaults.
+func DefaultLoginGuardConfig() LoginGuardConfig {
+    return LoginGuardConfig{
+        MaxFailures:     5,
+        IPMaxFailures:   50,
+        LockoutDuration: 15 * time.Minute,
+        BaseDelay:       time.Second,
+        MaxDelay:        30 * time.Second,
+    }
+}
+
+type attemptState struct {
+    failures    int
+    lastFailure time.Time
+    lockedUntil time.Time
+}
+
+// Lockout describes a currently locked username or IP.
+type Lockout struct {
+    Key         string `json:"key"` // username or "ip:<addr>"
+    Failures    int    `json:"failures"`
+    LockedUntil int64  `json:"locked_until"`
+}
+
+// LoginGuard tracks failed logins per username and per client IP. Usernames
+// are tracked whether or not the account exists so lockouts do not reveal it.
+type LoginGuard struct {
+    cfg       LoginGuardConfig
+    audit     AuditLog
+    mu        sync.Mutex
+    attempts  map[string]*attemptState
+    lastPrune time.Time
+    now       func() time.Time
+}
+
+func NewLoginGuard(cfg LoginGuardConfig, audit AuditLog) *LoginGuard {
+    return &LoginGuard{cfg: cfg, audit: audit, attempts: map[string]*attemptState{}, now: time.Now}
+}
+
+func userKey(username string) string { return strings.ToLower(strings.TrimSpace(username)) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// Check returns how long the caller must wait before another attempt for
+// username from ip is allowed. Zero means the attempt may proceed.
+func (g *LoginGuard) Check(username, ip string) time.Duration {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    now := g.now()
+    g.prune(now)
+    wait := g.waitFor(userKey(username), now, true)
+    // IPs are only locked, not slowed down, so one typo in a shared office
+    // network does not delay everyone else behind the same address
+    if w := g.waitFor(ipKey(ip), now, false); w > wait {
+        wait = w
+    }
+    return wait
+}
+
+func (g *LoginGuard) waitFor(key string, now time.Time, backoff bool) time.Duration {
+    st, ok := g.attempts[key]
+    if !ok {
+        return 0
+    }
+    if now.Before(st.lockedUntil) {
+        return st.lockedUntil.Sub(now)
+    }
+    if !backoff || st.failures == 0 {
+        return 0
+    }
+    delay := g.cfg.BaseDelay << uint(st.failures-1)
+    if delay <= 0 || delay > g.cfg.MaxDelay {
+        delay = g.cfg.MaxDelay
+    }
+    if next := st.lastFailure.Add(delay); now.Before(next) {
+        return next.Sub(now)
+    }
+    return 0
+}
+
+// RecordFailure counts a failed attempt and locks the username or IP once
+// its threshold is reached. Lockouts are written to the audit log.
+func (g *LoginGuard) RecordFailure(ctx context.Context, username, ip string) error {
+    g.mu.Lock()
+    now := g.now()
+    var locked []Lockout
+    for _, k := range []struct {
+        key string
+        max int
+    }{{userKey(username), g.cfg.MaxFailures}, {ipKey(ip), g.cfg.IPMaxFailures}} {
+        st, ok := g.attempts[k.key]
+        if !ok {
+            st = &attemptState{}
+            g.attempts[k.key] = st
+        }
+        st.failures++
+        st.lastFailure = now
+        if k.max > 0 && st.failures >= k.max && !now.Before(st.lockedUntil) {
+            st.lockedUntil = now.Add(g.cfg.LockoutDuration)
+            locked = append(locked, Lockout{Key: k.key, Failures: st.failures, LockedUntil: st.lockedUntil.Unix()})
+        }
+    }
+    g.mu.Unlock()
+    for _, l := range locked {
+        details := map[string]interface{}{"failures": l.Failures, "locked_until": l.LockedUntil, "ip": ip}
+        if err := recordAudit(ctx, g.audit, "system", "auth.lockout", l.Key, details); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// RecordSuccess clears the failure history for username. The IP history is
+// kept so an attacker cannot reset it by signing in to their own account.
+func (g *LoginGuard) RecordSuccess(username string) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    delete(g.attempts, userKey(username))
+}
+
+// Unlock clears a lockout for a username (or "ip:<addr>") on behalf of actor.
+func (g *LoginGuard) Unlock(ctx context.Context, actor, key string) error {
+    if !strings.HasPrefix(key, "ip:") {
+        key = userKey(key)
+    }
+    g.mu.Lock()
+    delete(g.attempts, key)
+    g.mu.Unlock()
+    return recordAudit(ctx, g.audit, actor, "auth.unlock", key, nil)
+}
+
+// Lockouts lists the usernames and IPs that are currently locked.
+func (g *LoginGuard) Lockouts() []Lockout {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    now := g.now()
+    out := []Lockout{}
+    for k, st := range g.attempts {
+        if now.Before(st.lockedUntil) {
+            out = append(out, Lockout{Key: k, Failures: st.failures, LockedUntil: st.lockedUntil.Unix()})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+    return out
+}
+
+// prune forgets idle entries at most once a minute. Caller holds g.mu.
+func (g *LoginGuard) prune(now time.Time) {
+    if now.Sub(g.lastPrune) < time.Minute {
+        return
+    }
+    g.lastPrune = now
+    for k, st := range g.attempts {
+        if now.After(st.lockedUntil) && now.Sub(st.lastFailure) > g.cfg.LockoutDuration {
+            delete(g.attempts, k)
+        }
+    }
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestLoginGuard_BackoffAndLockout(t *testing.T) {
+    audit := NewInMemoryAuditLog()
+    cfg := LoginGuardConfig{MaxFailures: 3, IPMaxFailures: 10, LockoutDuration: 15 * time.Minute, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+    g := NewLoginGuard(cfg, audit)
+    ctx := context.Background()
+    now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+    g.now = func() time.Time { return now }
+
+    if w := g.Check("alice", "10.0.0.1"); w != 0 {
+        t.Fatalf("expected no wait before failures, got %v", w)
+    }
+    _ = g.RecordFailure(ctx, "alice", "10.0.0.1")
+    if w := g.Check("Alice", "10.0.0.2"); w != time.Second {
+        t.Fatalf("expected 1s backoff (case-insensitive username), got %v", w)
+    }
+    now = now.Add(time.Second)
+    _ = g.RecordFailure(ctx, "alice", "10.0.0.1")
+    if w := g.Check("alice", "10.0.0.2"); w != 2*time.Second {
+        t.Fatalf("expected 2s backoff, got %v", w)
+    }
+    now = now.Add(2 * time.Second)
+    _ = g.RecordFailure(ctx, "alice", "10.0.0.1")
+    if w := g.Check("alice", "10.0.0.2"); w != 15*time.Minute {
+        t.Fatalf("expected lockout, got %v", w)
+    }
+    entries, _ := audit.List(ctx, "alice")
+    if len(entries) != 1 || entries[0].Action != "auth.lockout" {
+        t.Fatalf("expected lockout audit entry, got %+v", entries)
+    }
+    if l := g.Lockouts(); len(l) != 1 || l[0].Key != "alice" {
+        t.Fatalf("unexpected lockouts: %+v", l)
+    }
+
+    if err := g.Unlock(ctx, "admin", "alice"); err != nil {
+        t.Fatalf("unlock: %v", err)
+    }
+    if w := g.Check("alice", "10.0.0.2"); w != 0 {
+        t.Fatalf("expected no wait after unlock, got %v", w)
+    }
+    entries, _ = audit.List(ctx, "alice")
+    if entries[0].Action != "auth.unlock" || entries[0].Actor != "admin" {
+        t.Fatalf("expected unlock audit entry, got %+v", entries[0])
+    }
+}
+
+func TestLoginGuard_IPThreshold(t *testing.T) {
+    g := NewLoginGuard(LoginGuardConfig{MaxFailures: 100, IPMaxFailures: 2, LockoutDuration: time.Minute, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, nil)
+    now := time.Now()
+    g.now = func() time.Time { return now }
+    // spraying different usernames from one address still trips the IP limit
+    _ = g.RecordFailure(context.Background(), "u1", "10.0.0.9")
+    _ = g.RecordFailure(context.Background(), "u2", "10.0.0.9")
+    if w := g.Check("u3", "10.0.0.9"); w != time.Minute {
+        t.Fatalf("expected ip lockout, got %v", w)
+    }
+}
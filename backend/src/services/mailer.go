@@ -0,0 +1,88 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// MailMessage is a plain-text email.
+type MailMessage struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// Mailer delivers outbound email (password resets, notifications).
+type Mailer interface {
+    Send(ctx context.Context, msg MailMessage) error
+}
+
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// rfc822 renders msg as a minimal RFC 5322 message.
+func rfc822(from string, msg MailMessage, now time.Time) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", headerSanitizer.Replace(from))
+    fmt.Fprintf(&b, "To: %s\r\n", headerSanitizer.Replace(msg.To))
+    fmt.Fprintf(&b, "Subject: %s\r\n", headerSanitizer.Replace(msg.Subject))
+    fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+    b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+    return []byte(b.String())
+}
+
+// FileMailer writes each message as an .eml file into Dir. It is the local
+// stand-in for development and tests.
+type FileMailer struct {
+    Dir  string
+    From string
+    mu   sync.Mutex
+    seq  int
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+    return &FileMailer{Dir: dir, From: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg MailMessage) error {
+    if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+        return err
+    }
+    m.mu.Lock()
+    m.seq++
+    seq := m.seq
+    m.mu.Unlock()
+    now := time.Now()
+    name := fmt.Sprintf("%d-%04d.eml", now.UnixNano(), seq)
+    return os.WriteFile(filepath.Join(m.Dir, name), rfc822(m.From, msg, now), 0o600)
+}
+
+// SMTPMailer sends mail through an SMTP relay (or a local SMTP stand-in such
+// as MailHog). Auth is optional.
+type SMTPMailer struct {
+    Addr string // host:port
+    From string
+    Auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+    m := &SMTPMailer{Addr: addr, From: from}
+    if username != "" {
+        host := addr
+        if i := strings.LastIndex(addr, ":"); i >= 0 {
+            host = addr[:i]
+        }
+        m.Auth = smtp.PlainAuth("", username, password, host)
+    }
+    return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+    return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, rfc822(m.From, msg, time.Now()))
+}
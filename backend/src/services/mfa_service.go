@@ -0,0 +1,231 @@
+package services
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidMFACode is returned when a TOTP or recovery code does not match.
+var ErrInvalidMFACode = errors.New("invalid mfa code")
+
+const recoveryCodeCount = 10
+
+// MFAStore persists MFA enrollments keyed by username.
+type MFAStore interface {
+    Get(ctx context.Context, username string) (*models.MFAEnrollment, error)
+    Save(ctx context.Context, e *models.MFAEnrollment) error
+    Delete(ctx context.Context, username string) error
+}
+
+// MFAService handles TOTP enrollment, second-step verification and resets.
+type MFAService struct {
+    store         MFAStore
+    audit         AuditLog
+    issuer        string
+    requiredRoles []string
+    now           func() time.Time
+}
+
+func NewMFAService(store MFAStore, audit AuditLog, issuer string, requiredRoles []string) *MFAService {
+    return &MFAService{store: store, audit: audit, issuer: issuer, requiredRoles: requiredRoles, now: time.Now}
+}
+
+// Required reports whether policy demands MFA for a user holding roles.
+func (s *MFAService) Required(roles []string) bool {
+    for _, r := range roles {
+        for _, req := range s.requiredRoles {
+            if r == req {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Enabled reports whether username has a confirmed enrollment.
+func (s *MFAService) Enabled(ctx context.Context, username string) (bool, error) {
+    e, err := s.store.Get(ctx, username)
+    if err == mongo.ErrNoDocuments {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return e.Confirmed, nil
+}
+
+// BeginEnrollment creates a new unconfirmed secret and returns it with its
+// provisioning URI. An existing confirmed enrollment must be reset first.
+func (s *MFAService) BeginEnrollment(ctx context.Context, username string) (string, string, error) {
+    enabled, err := s.Enabled(ctx, username)
+    if err != nil {
+        return "", "", err
+    }
+    if enabled {
+        return "", "", errors.New("mfa already enabled")
+    }
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        return "", "", err
+    }
+    if err := s.store.Save(ctx, &models.MFAEnrollment{Username: username, Secret: secret}); err != nil {
+        return "", "", err
+    }
+    return secret, TOTPProvisioningURI(s.issuer, username, secret), nil
+}
+
+// ConfirmEnrollment activates the pending secret once the user proves they
+// can generate codes, and returns the plaintext recovery codes (shown once).
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, username, code string) ([]string, error) {
+    e, err := s.store.Get(ctx, username)
+    if err != nil {
+        return nil, err
+    }
+    if e.Confirmed {
+        return nil, errors.New("mfa already enabled")
+    }
+    step, ok := matchTOTP(e.Secret, strings.TrimSpace(code), s.now(), e.LastUsedStep)
+    if !ok {
+        return nil, ErrInvalidMFACode
+    }
+    codes := make([]string, recoveryCodeCount)
+    e.RecoveryCodes = make([]string, recoveryCodeCount)
+    for i := range codes {
+        b := make([]byte, 5)
+        if _, err := rand.Read(b); err != nil {
+            return nil, err
+        }
+        c := hex.EncodeToString(b)
+        codes[i] = c[:5] + "-" + c[5:]
+        e.RecoveryCodes[i] = hashRecoveryCode(codes[i])
+    }
+    e.Confirmed = true
+    e.LastUsedStep = step
+    e.EnrolledAt = s.now().Unix()
+    if err := s.store.Save(ctx, e); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, username, "mfa.enroll", username, nil); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code.
+func (s *MFAService) Verify(ctx context.Context, username, code string) error {
+    e, err := s.store.Get(ctx, username)
+    if err != nil || !e.Confirmed {
+        return ErrInvalidMFACode
+    }
+    code = strings.TrimSpace(code)
+    if step, ok := matchTOTP(e.Secret, code, s.now(), e.LastUsedStep); ok {
+        e.LastUsedStep = step
+        return s.store.Save(ctx, e)
+    }
+    h := hashRecoveryCode(code)
+    for i, rc := range e.RecoveryCodes {
+        if rc == h {
+            e.RecoveryCodes = append(e.RecoveryCodes[:i], e.RecoveryCodes[i+1:]...)
+            if err := s.store.Save(ctx, e); err != nil {
+                return err
+            }
+            return recordAudit(ctx, s.audit, username, "mfa.recovery_code_used", username, map[string]interface{}{"remaining": len(e.RecoveryCodes)})
+        }
+    }
+    return ErrInvalidMFACode
+}
+
+// Reset removes a user's enrollment (e.g. lost device) and records who did it.
+func (s *MFAService) Reset(ctx context.Context, actor, username string) error {
+    if err := s.store.Delete(ctx, username); err != nil && err != mongo.ErrNoDocuments {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "mfa.reset", username, nil)
+}
+
+func hashRecoveryCode(code string) string {
+    sum := sha256.Sum256([]byte(strings.ToLower(strings.ReplaceAll(code, "-", ""))))
+    return hex.EncodeToString(sum[:])
+}
+
+// InMemoryMFAStore keeps enrollments in memory.
+type InMemoryMFAStore struct {
+    mu sync.Mutex
+    m  map[string]models.MFAEnrollment
+}
+
+func NewInMemoryMFAStore() *InMemoryMFAStore {
+    return &InMemoryMFAStore{m: map[string]models.MFAEnrollment{}}
+}
+
+func (s *InMemoryMFAStore) Get(ctx context.Context, username string) (*models.MFAEnrollment, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    e, ok := s.m[username]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    e.RecoveryCodes = append([]string(nil), e.RecoveryCodes...)
+    return &e, nil
+}
+
+func (s *InMemoryMFAStore) Save(ctx context.Context, e *models.MFAEnrollment) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.m[e.Username] = *e
+    return nil
+}
+
+func (s *InMemoryMFAStore) Delete(ctx context.Context, username string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.m[username]; !ok {
+        return mongo.ErrNoDocuments
+    }
+    delete(s.m, username)
+    return nil
+}
+
+// MongoMFAStore stores enrollments in MongoDB.
+type MongoMFAStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoMFAStore(coll *mongo.Collection) *MongoMFAStore {
+    return &MongoMFAStore{coll: coll}
+}
+
+func (s *MongoMFAStore) Get(ctx context.Context, username string) (*models.MFAEnrollment, error) {
+    var e models.MFAEnrollment
+    if err := s.coll.FindOne(ctx, bson.M{"username": username}).Decode(&e); err != nil {
+        return nil, err
+    }
+    return &e, nil
+}
+
+func (s *MongoMFAStore) Save(ctx context.Context, e *models.MFAEnrollment) error {
+    _, err := s.coll.ReplaceOne(ctx, bson.M{"username": e.Username}, e, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoMFAStore) Delete(ctx context.Context, username string) error {
+    res, err := s.coll.DeleteOne(ctx, bson.M{"username": username})
+    if err != nil {
+        return err
+    }
+    if res.DeletedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestMFAService_EnrollVerifyReset(t *testing.T) {
+    audit := NewInMemoryAuditLog()
+    svc := NewMFAService(NewInMemoryMFAStore(), audit, "HRIS", []string{RoleAdmin, RolePayroll})
+    ctx := context.Background()
+    now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+    svc.now = func() time.Time { return now }
+
+    if !svc.Required([]string{"employee", "payroll"}) || svc.Required([]string{"employee"}) {
+        t.Fatalf("unexpected role policy result")
+    }
+    secret, uri, err := svc.BeginEnrollment(ctx, "payroll1")
+    if err != nil {
+        t.Fatalf("begin enrollment: %v", err)
+    }
+    if uri != TOTPProvisioningURI("HRIS", "payroll1", secret) {
+        t.Fatalf("unexpected provisioning uri: %s", uri)
+    }
+    if ok, _ := svc.Enabled(ctx, "payroll1"); ok {
+        t.Fatalf("mfa must not be enabled before confirmation")
+    }
+    code, _ := TOTPCode(secret, now)
+    codes, err := svc.ConfirmEnrollment(ctx, "payroll1", code)
+    if err != nil {
+        t.Fatalf("confirm: %v", err)
+    }
+    if len(codes) != recoveryCodeCount {
+        t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+    }
+    // the confirmation code was consumed; the next step's code works once
+    if err := svc.Verify(ctx, "payroll1", code); err != ErrInvalidMFACode {
+        t.Fatalf("expected replayed code to fail, got %v", err)
+    }
+    now = now.Add(30 * time.Second)
+    next, _ := TOTPCode(secret, now)
+    if err := svc.Verify(ctx, "payroll1", next); err != nil {
+        t.Fatalf("verify totp: %v", err)
+    }
+    // recovery codes are single use
+    if err := svc.Verify(ctx, "payroll1", codes[0]); err != nil {
+        t.Fatalf("verify recovery code: %v", err)
+    }
+    if err := svc.Verify(ctx, "payroll1", codes[0]); err != ErrInvalidMFACode {
+        t.Fatalf("expected reused recovery code to fail, got %v", err)
+    }
+
+    if err := svc.Reset(ctx, "admin", "payroll1"); err != nil {
+        t.Fatalf("reset: %v", err)
+    }
+    if ok, _ := svc.Enabled(ctx, "payroll1"); ok {
+        t.Fatalf("mfa still enabled after reset")
+    }
+    entries, _ := audit.List(ctx, "payroll1")
+    if len(entries) == 0 || entries[0].Action != "mfa.reset" || entries[0].Actor != "admin" {
+        t.Fatalf("expected mfa.reset audit entry, got %+v", entries)
+    }
+}
+
+func TestTOTPCode_RFC6238Vector(t *testing.T) {
+    // RFC 6238 appendix B, SHA1 seed "12345678901234567890", T=59 -> 94287082 (8 digits)
+    secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+    got, err := TOTPCode(secret, time.Unix(59, 0))
+    if err != nil {
+        t.Fatalf("totp: %v", err)
+    }
+    if got != "287082" {
+        t.Fatalf("TOTPCode = %s; want 287082", got)
+    }
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeMoney replaces the Decimal128 values of a document read from MongoDB
+// with money.Money so API responses render them as plain numbers. A nested
+// document's "currency" field applies to the amounts inside it.
+func decodeMoney(doc map[string]interface{}) {
+    decodeMoneyIn(doc, money.DefaultCurrency)
+}
+
+func decodeMoneyIn(doc map[string]interface{}, currency string) {
+    if c, ok := doc["currency"].(string); ok && c != "" {
+        currency = c
+    }
+    for k, v := range doc {
+        doc[k] = decodeMoneyValue(v, currency)
+    }
+}
+
+func decodeMoneyValue(v interface{}, currency string) interface{} {
+    switch x := v.(type) {
+    case primitive.Decimal128:
+        if m, err := money.FromDecimal128(x, currency); err == nil {
+            return m
+        }
+    case map[string]interface{}:
+        decodeMoneyIn(x, currency)
+    case primitive.M:
+        decodeMoneyIn(x, currency)
+    case primitive.A:
+        for i := range x {
+            x[i] = decodeMoneyValue(x[i], currency)
+        }
+    case []interface{}:
+        for i := range x {
+            x[i] = decodeMoneyValue(x[i], currency)
+        }
+    }
+    return v
+}
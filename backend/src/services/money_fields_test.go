@@ -0,0 +1,27 @@
+package services
+
+import (
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecodeMoney(t *testing.T) {
+    gross, _ := primitive.ParseDecimal128("1500.10")
+    amt, _ := primitive.ParseDecimal128("1200")
+    doc := map[string]interface{}{
+        "gross": gross,
+        "compensation_records": primitive.A{
+            map[string]interface{}{"amount": amt, "currency": "USD"},
+        },
+    }
+    decodeMoney(doc)
+    if m, ok := doc["gross"].(money.Money); !ok || m.String() != "1500.10" || m.Currency() != "PHP" {
+        t.Fatalf("gross: %#v", doc["gross"])
+    }
+    rec := doc["compensation_records"].(primitive.A)[0].(map[string]interface{})
+    if m, ok := rec["amount"].(money.Money); !ok || m.Currency() != "USD" || m.String() != "1200.00" {
+        t.Fatalf("nested amount: %#v", rec["amount"])
+    }
+}
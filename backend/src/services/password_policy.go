@@ -0,0 +1,118 @@
+package services
+
+import (
+    "bufio"
+    _ "embed"
+    "fmt"
+    "io"
+    "strings"
+    "unicode"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+// PasswordPolicyError lists every rule a candidate password broke.
+type PasswordPolicyError struct {
+    Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+    return "password policy: " + strings.Join(e.Violations, "; ")
+}
+
+// PasswordPolicy defines the rules new passwords must satisfy.
+type PasswordPolicy struct {
+    MinLength     int
+    RequireUpper  bool
+    RequireLower  bool
+    RequireDigit  bool
+    RequireSymbol bool
+    // HistorySize rejects reuse of the current and the last HistorySize-1 passwords.
+    HistorySize int
+    breached    map[string]bool
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured,
+// checking candidates against the bundled breached-password list.
+func DefaultPasswordPolicy() *PasswordPolicy {
+    p := &PasswordPolicy{MinLength: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, HistorySize: 5}
+    _ = p.LoadBreachedPasswords(strings.NewReader(bundledBreachedPasswords))
+    return p
+}
+
+// LoadBreachedPasswords adds one password per line from r ('#' starts a comment).
+func (p *PasswordPolicy) LoadBreachedPasswords(r io.Reader) error {
+    if p.breached == nil {
+        p.breached = map[string]bool{}
+    }
+    sc := bufio.NewScanner(r)
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        p.breached[strings.ToLower(line)] = true
+    }
+    return sc.Err()
+}
+
+// Validate checks password against the composition rules and breached list.
+func (p *PasswordPolicy) Validate(username, password string) error {
+    var v []string
+    if len([]rune(password)) < p.MinLength {
+        v = append(v, fmt.Sprintf("must be at least %d characters", p.MinLength))
+    }
+    var upper, lower, digit, symbol bool
+    for _, r := range password {
+        switch {
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsDigit(r):
+            digit = true
+        default:
+            symbol = true
+        }
+    }
+    if p.RequireUpper && !upper {
+        v = append(v, "must contain an uppercase letter")
+    }
+    if p.RequireLower && !lower {
+        v = append(v, "must contain a lowercase letter")
+    }
+    if p.RequireDigit && !digit {
+        v = append(v, "must contain a digit")
+    }
+    if p.RequireSymbol && !symbol {
+        v = append(v, "must contain a symbol")
+    }
+    lp := strings.ToLower(password)
+    if p.breached[lp] {
+        v = append(v, "appears in a list of breached passwords")
+    }
+    if username != "" && strings.Contains(lp, strings.ToLower(username)) {
+        v = append(v, "must not contain the username")
+    }
+    if len(v) > 0 {
+        return &PasswordPolicyError{Violations: v}
+    }
+    return nil
+}
+
+// checkReuse rejects password if it matches the current hash or recent history.
+func (p *PasswordPolicy) checkReuse(password, currentHash string, history []string) error {
+    hashes := append([]string{currentHash}, history...)
+    if p.HistorySize < len(hashes) {
+        hashes = hashes[:p.HistorySize]
+    }
+    for _, h := range hashes {
+        if h != "" && bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+            return &PasswordPolicyError{Violations: []string{fmt.Sprintf("must not reuse any of the last %d passwords", p.HistorySize)}}
+        }
+    }
+    return nil
+}
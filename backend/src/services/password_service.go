@@ -0,0 +1,291 @@
+package services
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "golang.org/x/crypto/bcrypt"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+    // ErrBadCredentials is returned when the current password does not match.
+    ErrBadCredentials = errors.New("bad credentials")
+    // ErrInvalidResetToken covers unknown, used and expired reset tokens.
+    ErrInvalidResetToken = errors.New("invalid or expired reset token")
+    // ErrSessionRequired is returned when a password change without a session
+    // is attempted for an account that is not required to change its password.
+    ErrSessionRequired = errors.New("password change requires a session")
+)
+
+// PasswordResetStore persists hashed reset tokens.
+type PasswordResetStore interface {
+    Save(ctx context.Context, t models.PasswordResetToken) error
+    // Get returns the token, used or not, or mongo.ErrNoDocuments.
+    Get(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+    // Consume marks the token used and returns it; it fails if the token is
+    // unknown or already used.
+    Consume(ctx context.Context, tokenHash string, usedAt int64) (*models.PasswordResetToken, error)
+    // Release makes a consumed token usable again.
+    Release(ctx context.Context, tokenHash string) error
+}
+
+// PasswordService implements password creation, change and reset flows on top
+// of an AuthStore, enforcing the configured PasswordPolicy.
+type PasswordService struct {
+    store    AuthStore
+    policy   *PasswordPolicy
+    resets   PasswordResetStore
+    mailer   Mailer
+    audit    AuditLog
+    resetURL string // link sent by email; the token is appended
+    resetTTL time.Duration
+    now      func() time.Time
+}
+
+func NewPasswordService(store AuthStore, policy *PasswordPolicy, resets PasswordResetStore, mailer Mailer, audit AuditLog, resetURL string) *PasswordService {
+    return &PasswordService{store: store, policy: policy, resets: resets, mailer: mailer, audit: audit, resetURL: resetURL, resetTTL: 30 * time.Minute, now: time.Now}
+}
+
+// CreateUser creates an account on behalf of an admin. The password must
+// satisfy the policy and has to be changed at first login.
+func (s *PasswordService) CreateUser(ctx context.Context, actor, username, password, email string, roles []string) error {
+    if err := s.policy.Validate(username, password); err != nil {
+        return err
+    }
+    h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    if err := s.store.CreateUserWithHash(ctx, username, string(h), roles); err != nil {
+        return err
+    }
+    mustChange := true
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{Email: &email, MustChangePassword: &mustChange}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.create", username, map[string]interface{}{"roles": roles})
+}
+
+// Change sets a new password after verifying the current one.
+func (s *PasswordService) Change(ctx context.Context, username, current, next string) error {
+    return s.change(ctx, username, current, next, false)
+}
+
+// ChangeRequired is Change for callers without a session: it only succeeds
+// for accounts flagged must_change_password, which cannot log in otherwise.
+func (s *PasswordService) ChangeRequired(ctx context.Context, username, current, next string) error {
+    return s.change(ctx, username, current, next, true)
+}
+
+func (s *PasswordService) change(ctx context.Context, username, current, next string, required bool) error {
+    ok, _, err := s.store.ValidateCredentials(ctx, username, current)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return ErrBadCredentials
+    }
+    if required {
+        u, err := s.store.GetUser(ctx, username)
+        if err != nil {
+            return err
+        }
+        if !u.MustChangePassword {
+            return ErrSessionRequired
+        }
+    }
+    if err := s.setPassword(ctx, username, next); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, username, "password.change", username, nil)
+}
+
+// RequestReset emails a single-use reset link when username exists and has an
+// email address. It returns nil either way so callers cannot probe accounts.
+func (s *PasswordService) RequestReset(ctx context.Context, username string) error {
+    u, err := s.store.GetUser(ctx, username)
+    if err == mongo.ErrNoDocuments || (err == nil && u.Email == "") {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return err
+    }
+    token := hex.EncodeToString(b)
+    expires := s.now().Add(s.resetTTL)
+    if err := s.resets.Save(ctx, models.PasswordResetToken{TokenHash: hashResetToken(token), Username: username, ExpiresAt: expires.Unix()}); err != nil {
+        return err
+    }
+    body := fmt.Sprintf("A password reset was requested for your HRIS account %q.\n\nUse this link within %d minutes to choose a new password:\n%s%s\n\nIf you did not request this, you can ignore this email.\n",
+        username, int(s.resetTTL.Minutes()), s.resetURL, token)
+    if err := s.mailer.Send(ctx, MailMessage{To: u.Email, Subject: "HRIS password reset", Body: body}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, username, "password.reset_requested", username, nil)
+}
+
+// Reset sets the new password with a reset token. The token is used up only
+// when the password is written, so a password the policy rejects can be
+// retried with the same link.
+func (s *PasswordService) Reset(ctx context.Context, token, next string) error {
+    h := hashResetToken(token)
+    now := s.now()
+    t, err := s.resets.Get(ctx, h)
+    if err != nil || t.UsedAt != 0 || now.Unix() >= t.ExpiresAt {
+        return ErrInvalidResetToken
+    }
+    hash, err := s.newPasswordHash(ctx, t.Username, next)
+    if err != nil {
+        return err
+    }
+    if _, err := s.resets.Consume(ctx, h, now.Unix()); err != nil {
+        return ErrInvalidResetToken
+    }
+    if err := s.store.UpdatePassword(ctx, t.Username, hash, false); err != nil {
+        if rerr := s.resets.Release(ctx, h); rerr != nil {
+            return fmt.Errorf("%v; releasing reset token: %w", err, rerr)
+        }
+        return err
+    }
+    return recordAudit(ctx, s.audit, t.Username, "password.reset", t.Username, nil)
+}
+
+func (s *PasswordService) setPassword(ctx context.Context, username, next string) error {
+    h, err := s.newPasswordHash(ctx, username, next)
+    if err != nil {
+        return err
+    }
+    return s.store.UpdatePassword(ctx, username, h, false)
+}
+
+// newPasswordHash checks next against the policy and the user's previous
+// passwords and returns its hash.
+func (s *PasswordService) newPasswordHash(ctx context.Context, username, next string) (string, error) {
+    u, err := s.store.GetUser(ctx, username)
+    if err != nil {
+        return "", err
+    }
+    if err := s.policy.Validate(username, next); err != nil {
+        return "", err
+    }
+    if err := s.policy.checkReuse(next, u.PasswordHash, u.PasswordHistory); err != nil {
+        return "", err
+    }
+    h, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+    if err != nil {
+        return "", err
+    }
+    return string(h), nil
+}
+
+func hashResetToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// InMemoryPasswordResetStore keeps reset tokens in memory.
+type InMemoryPasswordResetStore struct {
+    mu sync.Mutex
+    m  map[string]models.PasswordResetToken
+}
+
+func NewInMemoryPasswordResetStore() *InMemoryPasswordResetStore {
+    return &InMemoryPasswordResetStore{m: map[string]models.PasswordResetToken{}}
+}
+
+func (s *InMemoryPasswordResetStore) Save(ctx context.Context, t models.PasswordResetToken) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.m[t.TokenHash] = t
+    return nil
+}
+
+func (s *InMemoryPasswordResetStore) Get(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    t, ok := s.m[tokenHash]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    return &t, nil
+}
+
+func (s *InMemoryPasswordResetStore) Consume(ctx context.Context, tokenHash string, usedAt int64) (*models.PasswordResetToken, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    t, ok := s.m[tokenHash]
+    if !ok || t.UsedAt != 0 {
+        return nil, mongo.ErrNoDocuments
+    }
+    t.UsedAt = usedAt
+    s.m[tokenHash] = t
+    return &t, nil
+}
+
+func (s *InMemoryPasswordResetStore) Release(ctx context.Context, tokenHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    t, ok := s.m[tokenHash]
+    if !ok {
+        return mongo.ErrNoDocuments
+    }
+    t.UsedAt = 0
+    s.m[tokenHash] = t
+    return nil
+}
+
+// MongoPasswordResetStore stores reset tokens in MongoDB.
+type MongoPasswordResetStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoPasswordResetStore(coll *mongo.Collection) *MongoPasswordResetStore {
+    return &MongoPasswordResetStore{coll: coll}
+}
+
+func (s *MongoPasswordResetStore) Save(ctx context.Context, t models.PasswordResetToken) error {
+    _, err := s.coll.InsertOne(ctx, t)
+    return err
+}
+
+func (s *MongoPasswordResetStore) Get(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+    var t models.PasswordResetToken
+    if err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&t); err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+func (s *MongoPasswordResetStore) Consume(ctx context.Context, tokenHash string, usedAt int64) (*models.PasswordResetToken, error) {
+    var t models.PasswordResetToken
+    filter := bson.M{"token_hash": tokenHash, "used_at": bson.M{"$exists": false}}
+    opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+    if err := s.coll.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": usedAt}}, opts).Decode(&t); err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+func (s *MongoPasswordResetStore) Release(ctx context.Context, tokenHash string) error {
+    res, err := s.coll.UpdateOne(ctx, bson.M{"token_hash": tokenHash}, bson.M{"$unset": bson.M{"used_at": ""}})
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
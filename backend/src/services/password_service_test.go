@@ -0,0 +1,113 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "regexp"
+    "testing"
+    "time"
+)
+
+type recordingMailer struct {
+    sent []MailMessage
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg MailMessage) error {
+    m.sent = append(m.sent, msg)
+    return nil
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+    p := DefaultPasswordPolicy()
+    cases := map[string]bool{
+        "short1A":             false,
+        "alllowercase12345":   false,
+        "P@ssw0rd123":         false, // breached and too short
+        "Password1234":        false, // on the bundled breached list
+        "juan-Dela-Cruz-2025": false, // contains username
+        "Mabini-Street-1898":  true,
+    }
+    for pw, ok := range cases {
+        err := p.Validate("juan", pw)
+        if ok && err != nil {
+            t.Fatalf("%q: unexpected error %v", pw, err)
+        }
+        var pe *PasswordPolicyError
+        if !ok && !errors.As(err, &pe) {
+            t.Fatalf("%q: expected policy error, got %v", pw, err)
+        }
+    }
+}
+
+func TestPasswordService_ChangeAndHistory(t *testing.T) {
+    store := NewInMemoryUserStore()
+    svc := NewPasswordService(store, DefaultPasswordPolicy(), NewInMemoryPasswordResetStore(), &recordingMailer{}, NewInMemoryAuditLog(), "https://hris.test/reset?token=")
+    ctx := context.Background()
+    if err := svc.CreateUser(ctx, "admin", "maria", "Sampaguita-2025", "maria@agency.gov.ph", []string{RoleEmployee}); err != nil {
+        t.Fatalf("create: %v", err)
+    }
+    if u, _ := store.GetUser(ctx, "maria"); !u.MustChangePassword || u.Email != "maria@agency.gov.ph" {
+        t.Fatalf("expected forced change and email, got %+v", u)
+    }
+    if err := svc.Change(ctx, "maria", "wrong", "Narra-Tree-1898"); err != ErrBadCredentials {
+        t.Fatalf("expected ErrBadCredentials, got %v", err)
+    }
+    if err := svc.ChangeRequired(ctx, "maria", "Sampaguita-2025", "Narra-Tree-1898"); err != nil {
+        t.Fatalf("change: %v", err)
+    }
+    if u, _ := store.GetUser(ctx, "maria"); u.MustChangePassword {
+        t.Fatalf("must_change_password should be cleared")
+    }
+    // once cleared, changing without a session is refused
+    if err := svc.ChangeRequired(ctx, "maria", "Narra-Tree-1898", "Mabini-Street-1898"); err != ErrSessionRequired {
+        t.Fatalf("expected ErrSessionRequired, got %v", err)
+    }
+    // going back to the previous password is reuse
+    var pe *PasswordPolicyError
+    if err := svc.Change(ctx, "maria", "Narra-Tree-1898", "Sampaguita-2025"); !errors.As(err, &pe) {
+        t.Fatalf("expected reuse to be rejected, got %v", err)
+    }
+}
+
+func TestPasswordService_ResetFlow(t *testing.T) {
+    store := NewInMemoryUserStore()
+    mailer := &recordingMailer{}
+    svc := NewPasswordService(store, DefaultPasswordPolicy(), NewInMemoryPasswordResetStore(), mailer, NewInMemoryAuditLog(), "https://hris.test/reset?token=")
+    ctx := context.Background()
+    if err := svc.CreateUser(ctx, "admin", "jose", "Sampaguita-2025", "jose@agency.gov.ph", nil); err != nil {
+        t.Fatalf("create: %v", err)
+    }
+    // unknown users get the same nil result and no email
+    if err := svc.RequestReset(ctx, "nobody"); err != nil || len(mailer.sent) != 0 {
+        t.Fatalf("unexpected result for unknown user: %v %d", err, len(mailer.sent))
+    }
+    if err := svc.RequestReset(ctx, "jose"); err != nil {
+        t.Fatalf("request reset: %v", err)
+    }
+    if len(mailer.sent) != 1 || mailer.sent[0].To != "jose@agency.gov.ph" {
+        t.Fatalf("expected one reset email, got %+v", mailer.sent)
+    }
+    token := regexp.MustCompile(`token=([0-9a-f]{64})`).FindStringSubmatch(mailer.sent[0].Body)[1]
+    // a password the policy rejects leaves the link usable
+    var pe *PasswordPolicyError
+    if err := svc.Reset(ctx, token, "short"); !errors.As(err, &pe) {
+        t.Fatalf("expected a policy error, got %v", err)
+    }
+    if err := svc.Reset(ctx, token, "Narra-Tree-1898"); err != nil {
+        t.Fatalf("reset: %v", err)
+    }
+    if ok, _, _ := store.ValidateCredentials(ctx, "jose", "Narra-Tree-1898"); !ok {
+        t.Fatalf("new password not set")
+    }
+    if err := svc.Reset(ctx, token, "Another-Tree-1899"); err != ErrInvalidResetToken {
+        t.Fatalf("expected single-use token, got %v", err)
+    }
+
+    // expired tokens are refused
+    _ = svc.RequestReset(ctx, "jose")
+    expired := regexp.MustCompile(`token=([0-9a-f]{64})`).FindStringSubmatch(mailer.sent[1].Body)[1]
+    svc.now = func() time.Time { return time.Now().Add(time.Hour) }
+    if err := svc.Reset(ctx, expired, "Another-Tree-1899"); err != ErrInvalidResetToken {
+        t.Fatalf("expected expired token to fail, got %v", err)
+    }
+}
@@ -3,50 +3,313 @@ package services
 import (
     "context"
     "errors"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
     "sync"
+    "sync/atomic"
+    "time"
 
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+    // ErrInvalidPayrollRecord wraps malformed payroll records.
+    ErrInvalidPayrollRecord = errors.New("invalid payroll record")
+    // ErrPayrollRecordExists is returned when the payroll_id is taken.
+    ErrPayrollRecordExists = errors.New("payroll record already exists")
+    // ErrPayrollRecordVoided is returned when voiding a voided record.
+    ErrPayrollRecordVoided = errors.New("payroll record already voided")
+    // ErrPayrollRecordChanged is returned when a record was updated since
+    // it was read.
+    ErrPayrollRecordChanged = errors.New("payroll record changed since it was read")
+)
+
+// Page limits of payroll record listings.
+const (
+    DefaultPayrollPageSize = 50
+    MaxPayrollPageSize     = 500
+)
+
+// PayrollFilter selects payroll records; empty fields match all. Status
+// active also matches records stored before statuses existed. Limit 0
+// returns every match.
+type PayrollFilter struct {
+    EmployeeID string
+    Period     string
+    Status     string
+    Offset     int
+    Limit      int
+}
+
+// Paged returns f with the page size defaulted to DefaultPayrollPageSize
+// and capped at MaxPayrollPageSize.
+func (f PayrollFilter) Paged() PayrollFilter {
+    if f.Offset < 0 {
+        f.Offset = 0
+    }
+    if f.Limit <= 0 {
+        f.Limit = DefaultPayrollPageSize
+    }
+    if f.Limit > MaxPayrollPageSize {
+        f.Limit = MaxPayrollPageSize
+    }
+    return f
+}
+
+func (f PayrollFilter) match(r models.PayrollRecord) bool {
+    status := r.Status
+    if status == "" {
+        status = models.PayrollRecordActive
+    }
+    return (f.EmployeeID == "" || r.EmployeeID == f.EmployeeID) &&
+        (f.Period == "" || r.Period == f.Period) &&
+        (f.Status == "" || status == f.Status)
+}
+
 // PayrollRepo abstracts payroll storage operations.
 type PayrollRepo interface {
-    Create(ctx context.Context, doc map[string]interface{}) (map[string]interface{}, error)
-    ListByEmployee(ctx context.Context, employeeID string) ([]map[string]interface{}, error)
+    Create(ctx context.Context, r *models.PayrollRecord) error
+    Get(ctx context.Context, payrollID string) (*models.PayrollRecord, error)
+    // Update replaces the record stored at r.Version-1 and returns
+    // ErrPayrollRecordChanged when another update came first.
+    Update(ctx context.Context, r *models.PayrollRecord) error
+    // List returns one page of the matches, newest period first, and the
+    // number of matches.
+    List(ctx context.Context, f PayrollFilter) ([]models.PayrollRecord, int, error)
+}
+
+// PayrollRecordService records payroll entries entered outside payroll
+// runs. Records are never deleted; a void keeps the record and who voided
+// it.
+type PayrollRecordService struct {
+    repo     PayrollRepo
+    audit    AuditLog
+    rounding money.RoundingPolicy
+    now      func() time.Time
+}
+
+// NewPayrollRecordService creates the service.
+func NewPayrollRecordService(repo PayrollRepo, audit AuditLog, rounding money.RoundingPolicy) *PayrollRecordService {
+    return &PayrollRecordService{repo: repo, audit: audit, rounding: rounding, now: time.Now}
+}
+
+var payrollPeriodPattern = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])$`)
+
+// payrollSeq keeps generated payroll ids unique within a timestamp.
+var payrollSeq int64
+
+// Create stores a record. Amounts are rounded per component and net is
+// always derived from them, so floats never reach storage.
+func (s *PayrollRecordService) Create(ctx context.Context, actor string, r models.PayrollRecord) (*models.PayrollRecord, error) {
+    if strings.TrimSpace(r.EmployeeID) == "" {
+        return nil, fmt.Errorf("%w: employee_id required", ErrInvalidPayrollRecord)
+    }
+    if !payrollPeriodPattern.MatchString(r.Period) {
+        return nil, fmt.Errorf("%w: period must be YYYY-MM", ErrInvalidPayrollRecord)
+    }
+    if r.Currency == "" {
+        r.Currency = money.DefaultCurrency
+    }
+    r.Gross = s.rounding.Round("gross", r.Gross.WithCurrency(r.Currency))
+    r.Deductions = s.rounding.Round("deductions", r.Deductions.WithCurrency(r.Currency))
+    r.Taxes = s.rounding.Round("taxes", r.Taxes.WithCurrency(r.Currency))
+    r.Net = s.rounding.Round("net", r.Gross.Sub(r.Deductions).Sub(r.Taxes))
+    now := s.now()
+    if r.PayrollID == "" {
+        r.PayrollID = fmt.Sprintf("pay-%d-%d", now.UnixNano(), atomic.AddInt64(&payrollSeq, 1))
+    }
+    r.Status = models.PayrollRecordActive
+    r.CreatedBy, r.CreatedAt = actor, now.Unix()
+    r.VoidedBy, r.VoidReason, r.VoidedAt = "", "", 0
+    r.Version = 1
+    if err := s.repo.Create(ctx, &r); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_record.create", r.PayrollID, map[string]interface{}{
+        "employee_id": r.EmployeeID, "period": r.Period, "net": r.Net.String(),
+    }); err != nil {
+        return nil, err
+    }
+    return &r, nil
+}
+
+// Get returns a record, voided or not.
+func (s *PayrollRecordService) Get(ctx context.Context, payrollID string) (*models.PayrollRecord, error) {
+    return s.repo.Get(ctx, payrollID)
+}
+
+// List returns a page of records (see PayrollFilter.Paged) and the number
+// of matches.
+func (s *PayrollRecordService) List(ctx context.Context, f PayrollFilter) ([]models.PayrollRecord, int, error) {
+    return s.repo.List(ctx, f.Paged())
+}
+
+// Void marks a record as not paid. The record stays readable with who
+// voided it and why, and drops out of the period totals.
+func (s *PayrollRecordService) Void(ctx context.Context, actor, payrollID, reason string) (*models.PayrollRecord, error) {
+    if strings.TrimSpace(reason) == "" {
+        return nil, fmt.Errorf("%w: reason required", ErrInvalidPayrollRecord)
+    }
+    r, err := s.repo.Get(ctx, payrollID)
+    if err != nil {
+        return nil, err
+    }
+    if r.Status == models.PayrollRecordVoided {
+        return nil, ErrPayrollRecordVoided
+    }
+    r.Status, r.VoidedBy, r.VoidReason, r.VoidedAt = models.PayrollRecordVoided, actor, reason, s.now().Unix()
+    r.Version++
+    if err := s.repo.Update(ctx, r); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_record.void", payrollID, map[string]interface{}{
+        "employee_id": r.EmployeeID, "period": r.Period, "reason": reason,
+    }); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// PayrollPeriodTotals sums the active records of a period in one currency.
+type PayrollPeriodTotals struct {
+    Period     string      `json:"period"`
+    Currency   string      `json:"currency"`
+    Records    int         `json:"records"`
+    Gross      money.Money `json:"gross"`
+    Deductions money.Money `json:"deductions"`
+    Taxes      money.Money `json:"taxes"`
+    Net        money.Money `json:"net"`
+}
+
+// Totals sums active records per period and currency, newest period first;
+// period "" covers every period.
+func (s *PayrollRecordService) Totals(ctx context.Context, period string) ([]PayrollPeriodTotals, error) {
+    records, _, err := s.repo.List(ctx, PayrollFilter{Period: period, Status: models.PayrollRecordActive})
+    if err != nil {
+        return nil, err
+    }
+    byKey := map[[2]string]*PayrollPeriodTotals{}
+    var out []*PayrollPeriodTotals
+    for _, r := range records {
+        k := [2]string{r.Period, r.Currency}
+        t := byKey[k]
+        if t == nil {
+            z := money.Zero(r.Currency)
+            t = &PayrollPeriodTotals{Period: r.Period, Currency: r.Currency, Gross: z, Deductions: z, Taxes: z, Net: z}
+            byKey[k] = t
+            out = append(out, t)
+        }
+        t.Records++
+        t.Gross = t.Gross.Add(r.Gross)
+        t.Deductions = t.Deductions.Add(r.Deductions)
+        t.Taxes = t.Taxes.Add(r.Taxes)
+        t.Net = t.Net.Add(r.Net)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Period != out[j].Period {
+            return out[i].Period > out[j].Period
+        }
+        return out[i].Currency < out[j].Currency
+    })
+    totals := make([]PayrollPeriodTotals, 0, len(out))
+    for _, t := range out {
+        totals = append(totals, *t)
+    }
+    return totals, nil
+}
+
+// sortPayrollRecords orders records newest period first, then by employee.
+func sortPayrollRecords(out []models.PayrollRecord) {
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Period != out[j].Period {
+            return out[i].Period > out[j].Period
+        }
+        if out[i].EmployeeID != out[j].EmployeeID {
+            return out[i].EmployeeID < out[j].EmployeeID
+        }
+        return out[i].PayrollID < out[j].PayrollID
+    })
+}
+
+func restorePayrollRecordCurrency(r *models.PayrollRecord) {
+    if r.Currency == "" {
+        r.Currency = money.DefaultCurrency
+    }
+    r.Gross = r.Gross.WithCurrency(r.Currency)
+    r.Deductions = r.Deductions.WithCurrency(r.Currency)
+    r.Taxes = r.Taxes.WithCurrency(r.Currency)
+    r.Net = r.Net.WithCurrency(r.Currency)
 }
 
 // InMemoryPayrollRepo is a simple in-memory payroll store.
 type InMemoryPayrollRepo struct {
-    mu    sync.Mutex
-    m     map[string]map[string]interface{}
-    byEmp map[string][]string
+    mu sync.Mutex
+    m  map[string]models.PayrollRecord
 }
 
 func NewInMemoryPayrollRepo() *InMemoryPayrollRepo {
-    return &InMemoryPayrollRepo{m: map[string]map[string]interface{}{}, byEmp: map[string][]string{}}
+    return &InMemoryPayrollRepo{m: map[string]models.PayrollRecord{}}
+}
+
+func (r *InMemoryPayrollRepo) Create(ctx context.Context, rec *models.PayrollRecord) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if _, ok := r.m[rec.PayrollID]; ok {
+        return fmt.Errorf("%w: %s", ErrPayrollRecordExists, rec.PayrollID)
+    }
+    r.m[rec.PayrollID] = *rec
+    return nil
+}
+
+func (r *InMemoryPayrollRepo) Get(ctx context.Context, payrollID string) (*models.PayrollRecord, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    rec, ok := r.m[payrollID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    return &rec, nil
 }
 
-func (r *InMemoryPayrollRepo) Create(ctx context.Context, doc map[string]interface{}) (map[string]interface{}, error) {
+func (r *InMemoryPayrollRepo) Update(ctx context.Context, rec *models.PayrollRecord) error {
     r.mu.Lock()
     defer r.mu.Unlock()
-    id, _ := doc["id"].(string)
-    r.m[id] = doc
-    eid, _ := doc["employee_id"].(string)
-    r.byEmp[eid] = append(r.byEmp[eid], id)
-    return doc, nil
+    cur, ok := r.m[rec.PayrollID]
+    if !ok {
+        return mongo.ErrNoDocuments
+    }
+    if cur.Version != rec.Version-1 {
+        return fmt.Errorf("%w: %s", ErrPayrollRecordChanged, rec.PayrollID)
+    }
+    r.m[rec.PayrollID] = *rec
+    return nil
 }
 
-func (r *InMemoryPayrollRepo) ListByEmployee(ctx context.Context, employeeID string) ([]map[string]interface{}, error) {
+func (r *InMemoryPayrollRepo) List(ctx context.Context, f PayrollFilter) ([]models.PayrollRecord, int, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
-    ids := r.byEmp[employeeID]
-    out := make([]map[string]interface{}, 0, len(ids))
-    for _, id := range ids {
-        if d, ok := r.m[id]; ok {
-            out = append(out, d)
+    out := []models.PayrollRecord{}
+    for _, rec := range r.m {
+        if f.match(rec) {
+            out = append(out, rec)
         }
     }
-    return out, nil
+    sortPayrollRecords(out)
+    total := len(out)
+    if f.Offset > len(out) {
+        f.Offset = len(out)
+    }
+    out = out[f.Offset:]
+    if f.Limit > 0 && f.Limit < len(out) {
+        out = out[:f.Limit]
+    }
+    return out, total, nil
 }
 
 // MongoPayrollRepo stores payrolls in MongoDB.
@@ -58,29 +321,91 @@ func NewMongoPayrollRepo(coll *mongo.Collection) *MongoPayrollRepo {
     return &MongoPayrollRepo{coll: coll}
 }
 
-func (r *MongoPayrollRepo) Create(ctx context.Context, doc map[string]interface{}) (map[string]interface{}, error) {
-    if _, ok := doc["id"]; !ok {
-        return nil, errors.New("id required")
+// EnsureIndexes creates the unique payroll_id index and the
+// (employee_id, period) lookup index.
+func (r *MongoPayrollRepo) EnsureIndexes(ctx context.Context) error {
+    _, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {Keys: bson.D{{Key: "payroll_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+        {Keys: bson.D{{Key: "employee_id", Value: 1}, {Key: "period", Value: 1}}},
+        {Keys: bson.D{{Key: "period", Value: 1}, {Key: "status", Value: 1}}},
+    })
+    return err
+}
+
+func (r *MongoPayrollRepo) Create(ctx context.Context, rec *models.PayrollRecord) error {
+    if rec.PayrollID == "" {
+        return fmt.Errorf("%w: payroll_id required", ErrInvalidPayrollRecord)
     }
-    if _, err := r.coll.InsertOne(ctx, doc); err != nil {
+    if _, err := r.coll.InsertOne(ctx, rec); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            return fmt.Errorf("%w: %s", ErrPayrollRecordExists, rec.PayrollID)
+        }
+        return err
+    }
+    return nil
+}
+
+func (r *MongoPayrollRepo) Get(ctx context.Context, payrollID string) (*models.PayrollRecord, error) {
+    var rec models.PayrollRecord
+    if err := r.coll.FindOne(ctx, bson.M{"payroll_id": payrollID}).Decode(&rec); err != nil {
         return nil, err
     }
-    return doc, nil
+    restorePayrollRecordCurrency(&rec)
+    return &rec, nil
 }
 
-func (r *MongoPayrollRepo) ListByEmployee(ctx context.Context, employeeID string) ([]map[string]interface{}, error) {
-    cur, err := r.coll.Find(ctx, bson.M{"employee_id": employeeID})
+func (r *MongoPayrollRepo) Update(ctx context.Context, rec *models.PayrollRecord) error {
+    // records stored before versions existed have no version field
+    var version interface{} = rec.Version - 1
+    if rec.Version <= 1 {
+        version = bson.M{"$in": bson.A{nil, 0}}
+    }
+    res, err := r.coll.ReplaceOne(ctx, bson.M{"payroll_id": rec.PayrollID, "version": version}, rec)
     if err != nil {
-        return nil, err
+        return err
     }
-    defer cur.Close(ctx)
-    var out []map[string]interface{}
-    for cur.Next(ctx) {
-        var doc map[string]interface{}
-        if err := cur.Decode(&doc); err != nil {
-            continue
+    if res.MatchedCount == 0 {
+        if _, err := r.Get(ctx, rec.PayrollID); err != nil {
+            return err
         }
-        out = append(out, doc)
+        return fmt.Errorf("%w: %s", ErrPayrollRecordChanged, rec.PayrollID)
+    }
+    return nil
+}
+
+func (r *MongoPayrollRepo) List(ctx context.Context, f PayrollFilter) ([]models.PayrollRecord, int, error) {
+    filter := bson.M{}
+    if f.EmployeeID != "" {
+        filter["employee_id"] = f.EmployeeID
+    }
+    if f.Period != "" {
+        filter["period"] = f.Period
+    }
+    switch f.Status {
+    case "":
+    case models.PayrollRecordActive:
+        filter["status"] = bson.M{"$ne": models.PayrollRecordVoided}
+    default:
+        filter["status"] = f.Status
+    }
+    total, err := r.coll.CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, err
+    }
+    opts := options.Find().SetSort(bson.D{{Key: "period", Value: -1}, {Key: "employee_id", Value: 1}, {Key: "payroll_id", Value: 1}}).SetSkip(int64(f.Offset))
+    if f.Limit > 0 {
+        opts.SetLimit(int64(f.Limit))
+    }
+    cur, err := r.coll.Find(ctx, filter, opts)
+    if err != nil {
+        return nil, 0, err
+    }
+    out := []models.PayrollRecord{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, 0, err
+    }
+    for i := range out {
+        restorePayrollRecordCurrency(&out[i])
     }
-    return out, nil
+    return out, int(total), nil
 }
@@ -0,0 +1,91 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestPayrollRecordService(t *testing.T) {
+    ctx := context.Background()
+    audit := NewInMemoryAuditLog()
+    svc := NewPayrollRecordService(NewInMemoryPayrollRepo(), audit, money.DefaultRoundingPolicy())
+    add := func(id, emp, period, gross string) {
+        t.Helper()
+        if _, err := svc.Create(ctx, "clerk", models.PayrollRecord{PayrollID: id, EmployeeID: emp, Period: period, Gross: money.MustParse(gross, ""), Taxes: money.MustParse("100", "")}); err != nil {
+            t.Fatalf("create %s: %v", id, err)
+        }
+    }
+    add("pay-1", "E-1", "2025-07", "1000")
+    add("pay-2", "E-2", "2025-07", "2000")
+    add("pay-3", "E-1", "2025-08", "1500.005")
+    add("pay-4", "E-2", "2025-08", "2500")
+
+    r, err := svc.Get(ctx, "pay-3")
+    if err != nil || r.Gross.String() != "1500.00" || r.Net.String() != "1400.00" || r.Currency != "PHP" || r.Status != models.PayrollRecordActive {
+        t.Fatalf("get: %v %+v", err, r)
+    }
+    if _, err := svc.Create(ctx, "clerk", models.PayrollRecord{PayrollID: "pay-1", EmployeeID: "E-1", Period: "2025-09"}); !errors.Is(err, ErrPayrollRecordExists) {
+        t.Fatalf("expected ErrPayrollRecordExists, got %v", err)
+    }
+    if _, err := svc.Create(ctx, "clerk", models.PayrollRecord{EmployeeID: "E-1", Period: "Aug 2025"}); !errors.Is(err, ErrInvalidPayrollRecord) {
+        t.Fatalf("expected ErrInvalidPayrollRecord, got %v", err)
+    }
+
+    page, total, err := svc.List(ctx, PayrollFilter{Limit: 3})
+    if err != nil || total != 4 || len(page) != 3 || page[0].PayrollID != "pay-3" || page[2].PayrollID != "pay-1" {
+        t.Fatalf("page 1: %v %d %+v", err, total, page)
+    }
+    if page, _, _ := svc.List(ctx, PayrollFilter{Limit: 3, Offset: 3}); len(page) != 1 || page[0].PayrollID != "pay-2" {
+        t.Fatalf("page 2: %+v", page)
+    }
+    if page, total, _ := svc.List(ctx, PayrollFilter{EmployeeID: "E-2", Period: "2025-08"}); total != 1 || page[0].PayrollID != "pay-4" {
+        t.Fatalf("by employee and period: %+v", page)
+    }
+
+    if _, err := svc.Void(ctx, "boss", "pay-4", " "); !errors.Is(err, ErrInvalidPayrollRecord) {
+        t.Fatalf("reason required: %v", err)
+    }
+    v, err := svc.Void(ctx, "boss", "pay-4", "entered twice")
+    if err != nil || v.Status != models.PayrollRecordVoided || v.VoidedBy != "boss" || v.Version != 2 {
+        t.Fatalf("void: %v %+v", err, v)
+    }
+    if _, err := svc.Void(ctx, "boss", "pay-4", "again"); !errors.Is(err, ErrPayrollRecordVoided) {
+        t.Fatalf("expected ErrPayrollRecordVoided, got %v", err)
+    }
+    // an update from a stale read is refused
+    stale, _ := svc.Get(ctx, "pay-3")
+    fresh := *stale
+    fresh.Version++
+    if err := svc.repo.Update(ctx, &fresh); err != nil {
+        t.Fatalf("update: %v", err)
+    }
+    stale.Version++
+    if err := svc.repo.Update(ctx, stale); !errors.Is(err, ErrPayrollRecordChanged) {
+        t.Fatalf("expected ErrPayrollRecordChanged, got %v", err)
+    }
+    // voided records stay readable
+    if _, total, _ := svc.List(ctx, PayrollFilter{Status: models.PayrollRecordVoided}); total != 1 {
+        t.Fatalf("voided: %d", total)
+    }
+    if _, total, _ := svc.List(ctx, PayrollFilter{Status: models.PayrollRecordActive}); total != 3 {
+        t.Fatalf("active: %d", total)
+    }
+
+    totals, err := svc.Totals(ctx, "")
+    if err != nil || len(totals) != 2 {
+        t.Fatalf("totals: %v %+v", err, totals)
+    }
+    if aug := totals[0]; aug.Period != "2025-08" || aug.Records != 1 || aug.Gross.String() != "1500.00" || aug.Net.String() != "1400.00" {
+        t.Fatalf("august: %+v", aug)
+    }
+    if jul := totals[1]; jul.Records != 2 || jul.Gross.String() != "3000.00" || jul.Taxes.String() != "200.00" {
+        t.Fatalf("july: %+v", jul)
+    }
+    if entries, _ := audit.List(ctx, "pay-4"); len(entries) != 2 {
+        t.Fatalf("audit: %+v", entries)
+    }
+}
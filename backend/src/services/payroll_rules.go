@@ -0,0 +1,208 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// DefaultPayrollRules returns the built-in earning and deduction rules in
+// evaluation order. Contribution, loan and tax rules are appended by callers.
+func DefaultPayrollRules() []PayrollRule {
+    return []PayrollRule{BasicPayRule{}, AllowanceRule{}, OvertimeRule{}, RequestDeductionRule{}, AdjustmentRule{}}
+}
+
+// BasicPayRule pays the period's share of the salary and takes off absences,
+// unpaid leave, tardiness and undertime.
+type BasicPayRule struct{}
+
+func (BasicPayRule) Name() string { return "basic" }
+
+func (BasicPayRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    if pc.Request.OffCycle {
+        return nil, nil
+    }
+    var lines []models.PayslipLine
+    daily := pc.DailyRate()
+    if pc.Salary.Basis == "daily" {
+        if pc.Attendance.DaysWorked <= 0 {
+            return nil, errors.New("days_worked required for daily-rated employees")
+        }
+        amt, err := daily.MulRate(qty(pc.Attendance.DaysWorked), money.HalfEven)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: "basic", Label: "Basic pay", Kind: models.LineEarning, Amount: amt, Taxable: true,
+            Inputs:  map[string]string{"daily_rate": daily.String(), "days_worked": qty(pc.Attendance.DaysWorked)},
+            Formula: "daily_rate × days_worked",
+        })
+    } else {
+        lines = append(lines, models.PayslipLine{
+            Code: "basic", Label: "Basic pay", Kind: models.LineEarning, Amount: pc.PerPeriod(pc.Salary.Amount), Taxable: true,
+            Inputs:  map[string]string{"monthly_rate": pc.Salary.Amount.String(), "periods_per_year": qty(float64(pc.PeriodsPerYear()))},
+            Formula: "monthly_rate × 12 ÷ periods_per_year",
+        })
+        if days := pc.Attendance.AbsentDays + pc.UnpaidLeaveDays; days > 0 {
+            amt, err := daily.MulRate(qty(days), money.HalfEven)
+            if err != nil {
+                return nil, err
+            }
+            lines = append(lines, models.PayslipLine{
+                Code: "absences", Label: "Absences and unpaid leave", Kind: models.LineEarning, Amount: amt.Neg(), Taxable: true,
+                Inputs: map[string]string{
+                    "daily_rate": daily.String(), "absent_days": qty(pc.Attendance.AbsentDays), "unpaid_leave_days": qty(pc.UnpaidLeaveDays),
+                    "factor_days": qty(float64(pc.Config.FactorDays)),
+                },
+                Formula: "-(daily_rate × (absent_days + unpaid_leave_days)); daily_rate = monthly_rate × 12 ÷ factor_days",
+            })
+        }
+    }
+    if mins := pc.Attendance.LateMinutes + pc.Attendance.UndertimeMinutes; mins > 0 {
+        hourly := pc.HourlyRate()
+        lines = append(lines, models.PayslipLine{
+            Code: "tardiness", Label: "Tardiness and undertime", Kind: models.LineEarning, Amount: hourly.MulRatio(mins, 60, money.HalfEven).Neg(), Taxable: true,
+            Inputs:  map[string]string{"hourly_rate": hourly.String(), "late_minutes": qty(float64(pc.Attendance.LateMinutes)), "undertime_minutes": qty(float64(pc.Attendance.UndertimeMinutes))},
+            Formula: "-(hourly_rate × (late_minutes + undertime_minutes) ÷ 60)",
+        })
+    }
+    return lines, nil
+}
+
+// AllowanceRule pays each active allowance's share for the period.
+type AllowanceRule struct{}
+
+func (AllowanceRule) Name() string { return "allowances" }
+
+func (AllowanceRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    if pc.Request.OffCycle {
+        return nil, nil
+    }
+    var lines []models.PayslipLine
+    for _, a := range pc.Allowances {
+        label := a.Name
+        if label == "" {
+            label = "Allowance"
+        }
+        // de minimis benefits are taxed by the withholding rule only above their ceiling
+        taxable := (a.Taxable == nil || *a.Taxable) && a.DeMinimis == ""
+        lines = append(lines, models.PayslipLine{
+            Code: "allowance", Label: label, Kind: models.LineEarning, Amount: pc.PerPeriod(a.Amount), Taxable: taxable, DeMinimis: a.DeMinimis,
+            Inputs:  map[string]string{"monthly_amount": a.Amount.String(), "periods_per_year": qty(float64(pc.PeriodsPerYear()))},
+            Formula: "monthly_amount × 12 ÷ periods_per_year",
+        })
+    }
+    return lines, nil
+}
+
+// OvertimeRule pays overtime and night differential premiums.
+type OvertimeRule struct{}
+
+func (OvertimeRule) Name() string { return "overtime" }
+
+func (OvertimeRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    if pc.Request.OffCycle {
+        return nil, nil
+    }
+    var lines []models.PayslipLine
+    hourly := pc.HourlyRate()
+    if m := pc.Attendance.OvertimeMinutes; m > 0 {
+        amt, err := hourly.MulRatio(m, 60, money.HalfEven).MulRate(pc.Config.OvertimeRate, money.HalfEven)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: "overtime", Label: "Overtime", Kind: models.LineEarning, Amount: amt, Taxable: true,
+            Inputs:  map[string]string{"hourly_rate": hourly.String(), "overtime_minutes": qty(float64(m)), "overtime_rate": pc.Config.OvertimeRate},
+            Formula: "hourly_rate × overtime_minutes ÷ 60 × overtime_rate",
+        })
+    }
+    if m := pc.Attendance.NightDiffMinutes; m > 0 {
+        amt, err := hourly.MulRatio(m, 60, money.HalfEven).MulRate(pc.Config.NightDiffRate, money.HalfEven)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: "night_diff", Label: "Night differential", Kind: models.LineEarning, Amount: amt, Taxable: true,
+            Inputs:  map[string]string{"hourly_rate": hourly.String(), "night_diff_minutes": qty(float64(m)), "night_diff_rate": pc.Config.NightDiffRate},
+            Formula: "hourly_rate × night_diff_minutes ÷ 60 × night_diff_rate",
+        })
+    }
+    return lines, nil
+}
+
+// requestAmount labels an amount supplied with the request, which JSON
+// carries without a currency, as being in the payslip's currency. Amounts
+// labelled otherwise are left for the engine to reject.
+func requestAmount(pc *PayrollContext, m money.Money) money.Money {
+    if m.Currency() == "" {
+        return m.WithCurrency(pc.Currency)
+    }
+    return m
+}
+
+// RequestDeductionRule turns deductions supplied with the request (e.g. a
+// cash advance) into deduction lines.
+type RequestDeductionRule struct{}
+
+func (RequestDeductionRule) Name() string { return "deductions" }
+
+func (RequestDeductionRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    var lines []models.PayslipLine
+    for _, d := range pc.Request.Deductions {
+        if d.Amount.Sign() < 0 {
+            return nil, errors.New("deduction amounts must not be negative")
+        }
+        code := d.Code
+        if code == "" {
+            code = "deduction"
+        }
+        label := d.Label
+        if label == "" {
+            label = code
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: code, Label: label, Kind: models.LineDeduction, Amount: requestAmount(pc, d.Amount),
+            Inputs:  map[string]string{"amount": d.Amount.String()},
+            Formula: "amount",
+        })
+    }
+    return lines, nil
+}
+
+// AdjustmentRule adds corrections carried into the payslip.
+type AdjustmentRule struct{}
+
+func (AdjustmentRule) Name() string { return "adjustments" }
+
+func (AdjustmentRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    var lines []models.PayslipLine
+    for _, a := range pc.Request.Adjustments {
+        if a.Kind != models.LineEarning && a.Kind != models.LineDeduction {
+            return nil, fmt.Errorf("adjustment %s: kind must be earning or deduction", a.Code)
+        }
+        code := a.Code
+        if code == "" {
+            code = "adjustment"
+        }
+        label := a.Label
+        if label == "" {
+            label = "Adjustment"
+        }
+        in := map[string]string{"amount": a.Amount.String()}
+        if a.AdjustmentID != "" {
+            in["adjustment_id"] = a.AdjustmentID
+        }
+        if a.PayslipID != "" {
+            in["original_payslip_id"] = a.PayslipID
+        }
+        lines = append(lines, models.PayslipLine{
+            Code: code, Label: label, Kind: a.Kind, Amount: requestAmount(pc, a.Amount), Taxable: a.Kind == models.LineEarning && a.Taxable && !a.OtherBenefit,
+            OtherBenefit: a.Kind == models.LineEarning && a.OtherBenefit,
+            Inputs: in, Formula: "amount",
+        })
+    }
+    return lines, nil
+}
@@ -0,0 +1,767 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+var (
+    // ErrPeriodOverlap is returned when a pay period overlaps another of the same frequency.
+    ErrPeriodOverlap = errors.New("pay period overlaps an existing period")
+    // ErrRunExists is returned when the period already has a run.
+    ErrRunExists = errors.New("pay period already has a payroll run")
+    // ErrRunState is returned for a transition the run's status does not allow.
+    ErrRunState = errors.New("payroll run status does not allow this action")
+    // ErrRunLocked is returned when changing a run after finalization.
+    ErrRunLocked = errors.New("payroll run is finalized; record an adjustment instead")
+    // ErrNotApprover is returned when the actor lacks an approver role.
+    ErrNotApprover = errors.New("approval requires an approver role")
+    // ErrSelfApproval is returned when the submitter tries to approve their own run.
+    ErrSelfApproval = errors.New("a run cannot be approved by its submitter")
+    // ErrInvalidAdjustment wraps malformed adjustment entries.
+    ErrInvalidAdjustment = errors.New("invalid payroll adjustment")
+    // ErrRunChanged is returned when a run was saved by someone else since
+    // it was read, e.g. two exports of the same run at once.
+    ErrRunChanged = errors.New("payroll run changed since it was read")
+)
+
+// PayrollRunService moves payroll runs through draft → review → approved →
+// finalized → paid. Draft runs can be regenerated; finalized runs are locked
+// and corrected only through adjustments paid on a later run.
+type PayrollRunService struct {
+    store         PayrollRunStore
+    employees     EmployeeRepo
+    engine        *PayrollService
+    audit         AuditLog
+    approverRoles []string
+    loans         LoanLedger
+    variance      VariancePolicy
+    people        *EmployeeService
+    calendar      *HolidayCalendar
+    now           func() time.Time
+}
+
+// NewPayrollRunService creates the service; approverRoles may approve runs
+// (admin when empty).
+func NewPayrollRunService(store PayrollRunStore, employees EmployeeRepo, engine *PayrollService, audit AuditLog, approverRoles []string) *PayrollRunService {
+    if len(approverRoles) == 0 {
+        approverRoles = []string{RoleAdmin}
+    }
+    people := NewEmployeeService(employees)
+    people.SetAuditLog(audit)
+    calendar := NewHolidayCalendar(NewInMemoryHolidayStore(), nil, nil)
+    return &PayrollRunService{store: store, employees: employees, engine: engine, audit: audit, approverRoles: approverRoles, people: people, calendar: calendar, now: time.Now}
+}
+
+// SetCalendar counts the working days of final pay on c instead of an empty
+// calendar.
+func (s *PayrollRunService) SetCalendar(c *HolidayCalendar) {
+    s.calendar = c
+}
+
+// SetLoanLedger posts loan installments to l whenever a run is finalized.
+func (s *PayrollRunService) SetLoanLedger(l LoanLedger) {
+    s.loans = l
+}
+
+// CreatePeriod validates and stores a pay period.
+func (s *PayrollRunService) CreatePeriod(ctx context.Context, actor string, p models.PayPeriod) (*models.PayPeriod, error) {
+    if p.Frequency == "" {
+        p.Frequency = FrequencySemiMonthly
+    }
+    if !validFrequency(p.Frequency) {
+        return nil, fmt.Errorf("%w: unsupported frequency %q", ErrInvalidPayrollRequest, p.Frequency)
+    }
+    start, err := time.Parse("2006-01-02", p.Start)
+    if err != nil {
+        return nil, fmt.Errorf("%w: start %v", ErrInvalidPayrollRequest, err)
+    }
+    end, err := time.Parse("2006-01-02", p.End)
+    if err != nil {
+        return nil, fmt.Errorf("%w: end %v", ErrInvalidPayrollRequest, err)
+    }
+    if end.Before(start) {
+        return nil, fmt.Errorf("%w: end before start", ErrInvalidPayrollRequest)
+    }
+    if p.PayDate != "" {
+        if _, err := time.Parse("2006-01-02", p.PayDate); err != nil {
+            return nil, fmt.Errorf("%w: pay_date %v", ErrInvalidPayrollRequest, err)
+        }
+    }
+    existing, err := s.store.ListPeriods(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range existing {
+        if e.Frequency == p.Frequency && e.Start <= p.End && p.Start <= e.End {
+            return nil, ErrPeriodOverlap
+        }
+    }
+    p.PeriodID = fmt.Sprintf("pp-%s-%s", p.Start, p.End)
+    p.CreatedAt = s.now().Unix()
+    if err := s.store.SavePeriod(ctx, &p); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "pay_period.create", p.PeriodID, nil); err != nil {
+        return nil, err
+    }
+    return &p, nil
+}
+
+// ListPeriods returns pay periods by start date.
+func (s *PayrollRunService) ListPeriods(ctx context.Context) ([]models.PayPeriod, error) {
+    return s.store.ListPeriods(ctx)
+}
+
+// CreateRun starts a draft run for a period and generates its payslips.
+func (s *PayrollRunService) CreateRun(ctx context.Context, actor, periodID string) (*models.PayrollRun, error) {
+    p, err := s.store.GetPeriod(ctx, periodID)
+    if err != nil {
+        return nil, err
+    }
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for _, r := range runs {
+        if r.PeriodID == periodID {
+            return nil, ErrRunExists
+        }
+    }
+    now := s.now()
+    run := &models.PayrollRun{
+        RunID:       fmt.Sprintf("run-%d", now.UnixNano()),
+        Type:        models.RunRegular,
+        PeriodID:    p.PeriodID,
+        PeriodStart: p.Start,
+        PeriodEnd:   p.End,
+        Frequency:   p.Frequency,
+        PayDate:     p.PayDate,
+        Status:      models.RunDraft,
+        CreatedBy:   actor,
+        CreatedAt:   now.Unix(),
+    }
+    if err := s.generate(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.create", run.RunID, map[string]interface{}{"period_id": periodID}); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// Regenerate recalculates a draft run, e.g. after attendance corrections.
+func (s *PayrollRunService) Regenerate(ctx context.Context, actor, runID string) (*models.PayrollRun, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if err := runEditable(run); err != nil {
+        return nil, err
+    }
+    if err := s.generate(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.generate", run.RunID, nil); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// runEditable allows payslip changes only while the run is a draft.
+func runEditable(run *models.PayrollRun) error {
+    switch run.Status {
+    case models.RunDraft:
+        return nil
+    case models.RunFinalized, models.RunPaid:
+        return ErrRunLocked
+    }
+    return ErrRunState
+}
+
+// generate computes payslips for every eligible employee, carrying pending
+// adjustments, and saves them with the run totals.
+func (s *PayrollRunService) generate(ctx context.Context, run *models.PayrollRun) error {
+    emps, err := s.employees.List(ctx)
+    if err != nil {
+        return err
+    }
+    sort.Slice(emps, func(i, j int) bool { return fmt.Sprint(emps[i]["employee_id"]) < fmt.Sprint(emps[j]["employee_id"]) })
+    separated, err := s.finalPayEmployees(ctx)
+    if err != nil {
+        return err
+    }
+    var slips []models.Payslip
+    run.Exceptions, run.Anomalies = nil, nil
+    for _, emp := range emps {
+        id, _ := emp["employee_id"].(string)
+        if id == "" {
+            continue
+        }
+        req, ok, err := s.runRequest(ctx, run, emp, separated)
+        if err != nil {
+            run.Exceptions = append(run.Exceptions, models.RunException{EmployeeID: id, Error: err.Error()})
+            continue
+        }
+        if !ok {
+            continue
+        }
+        // manual and retro adjustments ride on regular and final-pay runs
+        if run.Type != models.RunThirteenthMonth {
+            pending, err := s.store.ListAdjustments(ctx, AdjustmentFilter{EmployeeID: id, PendingOnly: true})
+            if err != nil {
+                return err
+            }
+            for _, a := range pending {
+                req.Adjustments = append(req.Adjustments, AdjustmentInput{AdjustmentID: a.AdjustmentID, PayslipID: a.PayslipID, Code: a.Code, Label: a.Label, Kind: a.Kind, Amount: a.Amount, Taxable: a.Taxable})
+            }
+        }
+        p, err := s.engine.Calculate(ctx, req)
+        if errors.Is(err, ErrNoSalary) {
+            continue
+        }
+        if err != nil {
+            run.Exceptions = append(run.Exceptions, models.RunException{EmployeeID: id, Error: err.Error()})
+            continue
+        }
+        p.RunID = run.RunID
+        p.PayslipID = fmt.Sprintf("ps-%s-%s", run.RunID, id)
+        slips = append(slips, *p)
+    }
+    run.Totals = runTotals(slips)
+    if err := s.store.ReplacePayslips(ctx, run.RunID, slips); err != nil {
+        return err
+    }
+    run.Version++
+    return s.store.SaveRun(ctx, run)
+}
+
+// runRequest builds the payroll request for one employee of run; ok is
+// false when the employee is not part of it.
+func (s *PayrollRunService) runRequest(ctx context.Context, run *models.PayrollRun, emp map[string]interface{}, separated map[string]string) (PayrollRequest, bool, error) {
+    id, _ := emp["employee_id"].(string)
+    switch run.Type {
+    case models.RunFinalPay:
+        if run.FinalPay == nil || run.FinalPay.EmployeeID != id {
+            return PayrollRequest{}, false, nil
+        }
+        fp, err := s.finalPay(ctx, *run.FinalPay)
+        if err != nil {
+            return PayrollRequest{}, false, err
+        }
+        return fp.request, true, nil
+    case models.RunThirteenthMonth:
+        // final pay already includes the pro-rated 13th month
+        if separated[id] != "" || !payrollEligible(emp, run.PeriodStart, run.PeriodEnd) {
+            return PayrollRequest{}, false, nil
+        }
+        tm, err := s.ThirteenthMonth(ctx, id, fmt.Sprintf("%d-12-31", run.Year))
+        if err != nil || tm.Due.Sign() <= 0 {
+            return PayrollRequest{}, false, err
+        }
+        return PayrollRequest{
+            EmployeeID: id, PeriodStart: run.PeriodStart, PeriodEnd: run.PeriodEnd, Frequency: run.Frequency, OffCycle: true,
+            Adjustments: []AdjustmentInput{tm.adjustment()},
+        }, true, nil
+    }
+    if start := separated[id]; start != "" && start <= run.PeriodEnd {
+        return PayrollRequest{}, false, nil
+    }
+    if !payrollEligible(emp, run.PeriodStart, run.PeriodEnd) {
+        return PayrollRequest{}, false, nil
+    }
+    return PayrollRequest{EmployeeID: id, PeriodStart: run.PeriodStart, PeriodEnd: run.PeriodEnd, Frequency: run.Frequency}, true, nil
+}
+
+// regularRun reports whether run pays a pay period; runs stored before run
+// types existed have no type.
+func regularRun(run *models.PayrollRun) bool {
+    return run.Type == "" || run.Type == models.RunRegular
+}
+
+// payrollEligible excludes employees not yet hired or already separated
+// before the period. Separated employees without a termination date are
+// excluded by status.
+func payrollEligible(emp map[string]interface{}, start, end string) bool {
+    if hire, _ := emp["hire_date"].(string); hire != "" && hire > end {
+        return false
+    }
+    if term, _ := emp["termination_date"].(string); term != "" {
+        return term >= start
+    }
+    status, _ := emp["employment_status"].(string)
+    return !separatedStatus(status)
+}
+
+// separatedStatus reports whether an employment status means the employee
+// has left.
+func separatedStatus(status string) bool {
+    switch strings.ToLower(status) {
+    case "terminated", "separated", "resigned", "inactive":
+        return true
+    }
+    return false
+}
+
+// runTotals sums payslips per currency.
+func runTotals(slips []models.Payslip) []models.RunTotals {
+    byCur := map[string]*models.RunTotals{}
+    var order []string
+    for _, p := range slips {
+        t, ok := byCur[p.Currency]
+        if !ok {
+            z := money.Zero(p.Currency)
+            t = &models.RunTotals{Currency: p.Currency, Gross: z, Deductions: z, Taxes: z, Net: z, EmployerContributions: z}
+            byCur[p.Currency] = t
+            order = append(order, p.Currency)
+        }
+        t.Headcount++
+        t.Gross = t.Gross.Add(p.Gross)
+        t.Deductions = t.Deductions.Add(p.Deductions)
+        t.Taxes = t.Taxes.Add(p.Taxes)
+        t.Net = t.Net.Add(p.Net)
+        t.EmployerContributions = t.EmployerContributions.Add(p.EmployerContributions)
+    }
+    sort.Strings(order)
+    out := make([]models.RunTotals, 0, len(order))
+    for _, c := range order {
+        out = append(out, *byCur[c])
+    }
+    return out
+}
+
+// GetRun returns a run or mongo.ErrNoDocuments.
+func (s *PayrollRunService) GetRun(ctx context.Context, runID string) (*models.PayrollRun, error) {
+    return s.store.GetRun(ctx, runID)
+}
+
+// ListRuns returns runs by period, optionally only those with status.
+func (s *PayrollRunService) ListRuns(ctx context.Context, status string) ([]models.PayrollRun, error) {
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil || status == "" {
+        return runs, err
+    }
+    out := []models.PayrollRun{}
+    for _, r := range runs {
+        if r.Status == status {
+            out = append(out, r)
+        }
+    }
+    return out, nil
+}
+
+// Payslips returns the payslips of a run.
+func (s *PayrollRunService) Payslips(ctx context.Context, runID string) ([]models.Payslip, error) {
+    if _, err := s.store.GetRun(ctx, runID); err != nil {
+        return nil, err
+    }
+    return s.store.ListPayslips(ctx, runID)
+}
+
+// transition moves run from one of from to to and records who did it.
+func (s *PayrollRunService) transition(ctx context.Context, run *models.PayrollRun, to, actor, reason string, from ...string) error {
+    allowed := false
+    for _, f := range from {
+        if run.Status == f {
+            allowed = true
+        }
+    }
+    if !allowed {
+        if run.Status == models.RunFinalized || run.Status == models.RunPaid {
+            if to == models.RunDraft {
+                return ErrRunLocked
+            }
+        }
+        return fmt.Errorf("%w: %s → %s", ErrRunState, run.Status, to)
+    }
+    run.History = append(run.History, models.RunTransition{From: run.Status, To: to, Actor: actor, Reason: reason, At: s.now().Unix()})
+    prev := run.Status
+    run.Status = to
+    run.Version++
+    if err := s.store.SaveRun(ctx, run); err != nil {
+        return err
+    }
+    details := map[string]interface{}{"from": prev, "to": to}
+    if reason != "" {
+        details["reason"] = reason
+    }
+    return recordAudit(ctx, s.audit, actor, "payroll_run."+to, run.RunID, details)
+}
+
+// Submit sends a draft run for review, flagging its anomalies against the
+// previous period for the reviewer.
+func (s *PayrollRunService) Submit(ctx context.Context, actor, runID string) (*models.PayrollRun, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.Status == models.RunDraft {
+        prev, err := s.previousRun(ctx, run)
+        if err != nil {
+            return nil, err
+        }
+        report, err := s.varianceReport(ctx, run, prev)
+        if err != nil {
+            return nil, err
+        }
+        run.Anomalies = report.flagged()
+    }
+    run.SubmittedBy = actor
+    if err := s.transition(ctx, run, models.RunReview, actor, "", models.RunDraft); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// Approve approves a run under review. The actor needs an approver role and
+// must not be the submitter.
+func (s *PayrollRunService) Approve(ctx context.Context, actor string, roles []string, runID string) (*models.PayrollRun, error) {
+    ok := false
+    for _, r := range s.approverRoles {
+        if hasRole(roles, r) {
+            ok = true
+        }
+    }
+    if !ok {
+        return nil, ErrNotApprover
+    }
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.SubmittedBy == actor {
+        return nil, ErrSelfApproval
+    }
+    run.ApprovedBy = actor
+    if err := s.transition(ctx, run, models.RunApproved, actor, "", models.RunReview); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// Reject returns a run under review or approved to draft.
+func (s *PayrollRunService) Reject(ctx context.Context, actor, runID, reason string) (*models.PayrollRun, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    run.ApprovedBy = ""
+    if err := s.transition(ctx, run, models.RunDraft, actor, reason, models.RunReview, models.RunApproved); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// Finalize locks an approved run, marks the adjustments it paid and posts
+// its loan installments. A final-pay run also records the separation on the
+// employee.
+func (s *PayrollRunService) Finalize(ctx context.Context, actor, runID string) (*models.PayrollRun, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.Status != models.RunApproved {
+        return nil, fmt.Errorf("%w: %s → %s", ErrRunState, run.Status, models.RunFinalized)
+    }
+    slips, err := s.store.ListPayslips(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    // check everything before writing: adjustments paid elsewhere here, loans
+    // in PostRun, which saves nothing unless every loan can be posted
+    paid := map[string]bool{}
+    for _, p := range slips {
+        for _, l := range p.Lines {
+            if id := l.Inputs["adjustment_id"]; id != "" {
+                paid[id] = true
+            }
+        }
+    }
+    var apply []models.PayrollAdjustment
+    if len(paid) > 0 {
+        adjs, err := s.store.ListAdjustments(ctx, AdjustmentFilter{})
+        if err != nil {
+            return nil, err
+        }
+        for _, a := range adjs {
+            if !paid[a.AdjustmentID] {
+                continue
+            }
+            // another run already paid it since this one was generated
+            if a.AppliedRunID != "" && a.AppliedRunID != runID {
+                return nil, fmt.Errorf("%w: adjustment %s was paid by run %s; reject and regenerate", ErrRunState, a.AdjustmentID, a.AppliedRunID)
+            }
+            apply = append(apply, a)
+        }
+    }
+    if s.loans != nil {
+        if err := s.loans.PostRun(ctx, actor, run, slips); err != nil {
+            return nil, err
+        }
+    }
+    var applied []models.PayrollAdjustment
+    for _, a := range apply {
+        prev := a
+        a.AppliedRunID = runID
+        if err := s.store.SaveAdjustment(ctx, &a); err != nil {
+            return nil, s.undoFinalize(ctx, actor, run, slips, applied, err)
+        }
+        applied = append(applied, prev)
+    }
+    run.FinalizedAt = s.now().Unix()
+    if err := s.transition(ctx, run, models.RunFinalized, actor, "", models.RunApproved); err != nil {
+        // only the audit entry failed if the run was saved
+        if saved, gerr := s.store.GetRun(ctx, runID); gerr == nil && saved.Status == models.RunFinalized {
+            return nil, err
+        }
+        return nil, s.undoFinalize(ctx, actor, run, slips, applied, err)
+    }
+    if err := s.recordSeparation(ctx, actor, run); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// undoFinalize reverses the writes of a finalization that failed part way:
+// the adjustments marked paid go back to how they were and the loan postings
+// are removed. It returns cause, with any failure to undo.
+func (s *PayrollRunService) undoFinalize(ctx context.Context, actor string, run *models.PayrollRun, slips []models.Payslip, adjustments []models.PayrollAdjustment, cause error) error {
+    for i := range adjustments {
+        if err := s.store.SaveAdjustment(ctx, &adjustments[i]); err != nil {
+            return fmt.Errorf("%v; restoring adjustment %s: %w", cause, adjustments[i].AdjustmentID, err)
+        }
+    }
+    if s.loans != nil {
+        if err := s.loans.UnpostRun(ctx, actor, run, slips); err != nil {
+            return fmt.Errorf("%v; unposting loans: %w", cause, err)
+        }
+    }
+    return cause
+}
+
+// MarkPaid records that a finalized run was disbursed.
+func (s *PayrollRunService) MarkPaid(ctx context.Context, actor, runID string) (*models.PayrollRun, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    run.PaidAt = s.now().Unix()
+    if err := s.transition(ctx, run, models.RunPaid, actor, "", models.RunFinalized); err != nil {
+        return nil, err
+    }
+    if err := s.recordSeparation(ctx, actor, run); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// DeleteRun discards a draft run and its payslips.
+func (s *PayrollRunService) DeleteRun(ctx context.Context, actor, runID string) error {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return err
+    }
+    if err := runEditable(run); err != nil {
+        return err
+    }
+    if err := s.store.DeleteRun(ctx, runID); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "payroll_run.delete", runID, nil)
+}
+
+// AddAdjustment records a correction against a finalized or paid run. It is
+// paid on the employee's next run.
+func (s *PayrollRunService) AddAdjustment(ctx context.Context, actor, runID string, a models.PayrollAdjustment) (*models.PayrollAdjustment, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    if run.Status != models.RunFinalized && run.Status != models.RunPaid {
+        return nil, fmt.Errorf("%w: adjust a %s run by regenerating it", ErrRunState, run.Status)
+    }
+    if a.EmployeeID == "" || strings.TrimSpace(a.Reason) == "" {
+        return nil, fmt.Errorf("%w: employee_id and reason required", ErrInvalidAdjustment)
+    }
+    if a.Kind != models.LineEarning && a.Kind != models.LineDeduction {
+        return nil, fmt.Errorf("%w: kind must be earning or deduction", ErrInvalidAdjustment)
+    }
+    if a.Amount.IsZero() {
+        return nil, fmt.Errorf("%w: amount required", ErrInvalidAdjustment)
+    }
+    if a.Code == "" {
+        a.Code = "adjustment"
+    }
+    a.Source = models.AdjustmentManual
+    return s.saveAdjustment(ctx, actor, run, a)
+}
+
+// adjustmentSeq keeps ids unique when several adjustments share a timestamp.
+var adjustmentSeq int64
+
+// saveAdjustment assigns the id and bookkeeping fields of a new adjustment
+// against run and stores it.
+func (s *PayrollRunService) saveAdjustment(ctx context.Context, actor string, run *models.PayrollRun, a models.PayrollAdjustment) (*models.PayrollAdjustment, error) {
+    runID := run.RunID
+    now := s.now()
+    a.AdjustmentID = fmt.Sprintf("adj-%d-%d", now.UnixNano(), atomic.AddInt64(&adjustmentSeq, 1))
+    a.RunID = runID
+    a.AppliedRunID = ""
+    a.CreatedBy = actor
+    a.CreatedAt = now.Unix()
+    if err := s.store.SaveAdjustment(ctx, &a); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_adjustment.create", a.AdjustmentID, map[string]interface{}{
+        "run_id": runID, "employee_id": a.EmployeeID, "amount": a.Amount.String(), "reason": a.Reason, "source": a.Source,
+    }); err != nil {
+        return nil, err
+    }
+    return &a, nil
+}
+
+// Adjustments lists adjustments recorded against a run.
+func (s *PayrollRunService) Adjustments(ctx context.Context, runID string) ([]models.PayrollAdjustment, error) {
+    return s.store.ListAdjustments(ctx, AdjustmentFilter{RunID: runID})
+}
+
+// RunDiffLine compares one employee's pay with the previous period.
+type RunDiffLine struct {
+    EmployeeID    string       `json:"employee_id"`
+    Change        string       `json:"change"` // new, removed, changed, unchanged
+    PreviousGross *money.Money `json:"previous_gross,omitempty"`
+    Gross         *money.Money `json:"gross,omitempty"`
+    PreviousNet   *money.Money `json:"previous_net,omitempty"`
+    Net           *money.Money `json:"net,omitempty"`
+    NetChange     *money.Money `json:"net_change,omitempty"`
+}
+
+// RunDiff compares a run with the previous finalized run of its frequency.
+type RunDiff struct {
+    RunID          string             `json:"run_id"`
+    PreviousRunID  string             `json:"previous_run_id,omitempty"`
+    Totals         []models.RunTotals `json:"totals"`
+    PreviousTotals []models.RunTotals `json:"previous_totals,omitempty"`
+    Lines          []RunDiffLine      `json:"lines"`
+}
+
+// Diff compares runID with the latest finalized or paid run of the same
+// frequency that ended before it started. Off-cycle runs have nothing to
+// compare with and list every payslip as new.
+func (s *PayrollRunService) Diff(ctx context.Context, runID string) (*RunDiff, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    d := &RunDiff{RunID: runID, Totals: run.Totals, Lines: []RunDiffLine{}}
+    prev, err := s.previousRun(ctx, run)
+    if err != nil {
+        return nil, err
+    }
+    cur, err := s.store.ListPayslips(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    before := map[string]models.Payslip{}
+    if prev != nil {
+        d.PreviousRunID = prev.RunID
+        d.PreviousTotals = prev.Totals
+        slips, err := s.store.ListPayslips(ctx, prev.RunID)
+        if err != nil {
+            return nil, err
+        }
+        for _, p := range slips {
+            before[p.EmployeeID] = p
+        }
+    }
+    for _, p := range cur {
+        p := p
+        l := RunDiffLine{EmployeeID: p.EmployeeID, Gross: &p.Gross, Net: &p.Net, Change: "new"}
+        if b, ok := before[p.EmployeeID]; ok {
+            b := b
+            l.PreviousGross, l.PreviousNet = &b.Gross, &b.Net
+            l.Change = "changed"
+            if b.Currency == p.Currency {
+                change := p.Net.Sub(b.Net)
+                l.NetChange = &change
+                if change.IsZero() && b.Gross.Equal(p.Gross) {
+                    l.Change = "unchanged"
+                }
+            }
+            delete(before, p.EmployeeID)
+        }
+        d.Lines = append(d.Lines, l)
+    }
+    for _, b := range before {
+        b := b
+        d.Lines = append(d.Lines, RunDiffLine{EmployeeID: b.EmployeeID, Change: "removed", PreviousGross: &b.Gross, PreviousNet: &b.Net})
+    }
+    sort.Slice(d.Lines, func(i, j int) bool { return d.Lines[i].EmployeeID < d.Lines[j].EmployeeID })
+    return d, nil
+}
+
+func (s *PayrollRunService) previousRun(ctx context.Context, run *models.PayrollRun) (*models.PayrollRun, error) {
+    if !regularRun(run) {
+        return nil, nil
+    }
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    var prev *models.PayrollRun
+    for i := range runs {
+        r := &runs[i]
+        if !regularRun(r) || r.Frequency != run.Frequency || r.PeriodEnd >= run.PeriodStart {
+            continue
+        }
+        if r.Status != models.RunFinalized && r.Status != models.RunPaid {
+            continue
+        }
+        if prev == nil || r.PeriodEnd > prev.PeriodEnd {
+            prev = r
+        }
+    }
+    return prev, nil
+}
+
+// TaxYearToDate implements TaxHistorySource from the payslips of finalized
+// and paid runs.
+func (s *PayrollRunService) TaxYearToDate(ctx context.Context, employeeID string, year int, before string) (TaxYearToDate, error) {
+    ytd := TaxYearToDate{}
+    closed, err := s.closedRuns(ctx)
+    if err != nil {
+        return ytd, err
+    }
+    slips, err := s.store.EmployeePayslips(ctx, employeeID)
+    if err != nil {
+        return ytd, err
+    }
+    prefix := strconv.Itoa(year) + "-"
+    for _, p := range slips {
+        if !closed[p.RunID] || !strings.HasPrefix(p.PeriodEnd, prefix) || p.PeriodStart >= before {
+            continue
+        }
+        for _, l := range p.Lines {
+            if l.Code != "withholding_tax" {
+                continue
+            }
+            if m, err := money.Parse(l.Inputs["taxable_compensation"], p.Currency); err == nil {
+                ytd.TaxableCompensation = ytd.TaxableCompensation.Add(m)
+            }
+            if m, err := money.Parse(l.Inputs["other_benefits"], p.Currency); err == nil {
+                ytd.OtherBenefits = ytd.OtherBenefits.Add(m)
+            }
+        }
+        ytd.TaxWithheld = ytd.TaxWithheld.Add(p.Taxes)
+    }
+    return ytd, nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func newRunTestService(t *testing.T) (*PayrollRunService, *InMemoryAuditLog) {
+    t.Helper()
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    salary := func(amount float64) []interface{} {
+        return []interface{}{map[string]interface{}{"type": "salary", "amount": amount, "effective_date": "2025-01-01"}}
+    }
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "compensation_records": salary(30000)})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-2", "compensation_records": salary(20000)})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-3", "compensation_records": salary(25000), "employment_status": "terminated", "termination_date": "2025-05-31"})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-4"}) // no salary yet
+    taxTables, err := DefaultTaxTables()
+    if err != nil {
+        t.Fatalf("tax tables: %v", err)
+    }
+    engine := NewPayrollService(emps, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), DefaultPayrollRules()...)
+    audit := NewInMemoryAuditLog()
+    svc := NewPayrollRunService(NewInMemoryPayrollRunStore(), emps, engine, audit, nil)
+    engine.AddRule(WithholdingTaxRule{Tables: taxTables, History: svc})
+    return svc, audit
+}
+
+// closeRun takes a draft run through review, approval and finalization.
+func closeRun(t *testing.T, svc *PayrollRunService, runID string) {
+    t.Helper()
+    ctx := context.Background()
+    if _, err := svc.Submit(ctx, "clerk", runID); err != nil {
+        t.Fatalf("submit: %v", err)
+    }
+    if _, err := svc.Approve(ctx, "boss", []string{RoleAdmin}, runID); err != nil {
+        t.Fatalf("approve: %v", err)
+    }
+    if _, err := svc.Finalize(ctx, "clerk", runID); err != nil {
+        t.Fatalf("finalize: %v", err)
+    }
+}
+
+func TestPayrollRunService_Lifecycle(t *testing.T) {
+    ctx := context.Background()
+    svc, audit := newRunTestService(t)
+    p, err := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-15", PayDate: "2025-06-15"})
+    if err != nil {
+        t.Fatalf("period: %v", err)
+    }
+    if _, err := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-10", End: "2025-06-25"}); !errors.Is(err, ErrPeriodOverlap) {
+        t.Fatalf("expected overlap, got %v", err)
+    }
+    // other frequencies keep their own calendar
+    if _, err := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-09", End: "2025-06-15", Frequency: FrequencyWeekly}); err != nil {
+        t.Fatalf("weekly period: %v", err)
+    }
+    if _, err := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-14", Frequency: "fortnightly"}); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("expected ErrInvalidPayrollRequest, got %v", err)
+    }
+    run, err := svc.CreateRun(ctx, "clerk", p.PeriodID)
+    if err != nil {
+        t.Fatalf("create run: %v", err)
+    }
+    // E-3 left before the period and E-4 has no salary
+    if run.Status != models.RunDraft || len(run.Totals) != 1 || run.Totals[0].Headcount != 2 || run.Totals[0].Gross.String() != "25000.00" {
+        t.Fatalf("draft run: %+v", run)
+    }
+    if _, err := svc.CreateRun(ctx, "clerk", p.PeriodID); !errors.Is(err, ErrRunExists) {
+        t.Fatalf("expected ErrRunExists, got %v", err)
+    }
+
+    if _, err := svc.Submit(ctx, "clerk", run.RunID); err != nil {
+        t.Fatalf("submit: %v", err)
+    }
+    if _, err := svc.Approve(ctx, "clerk2", []string{RolePayroll}, run.RunID); !errors.Is(err, ErrNotApprover) {
+        t.Fatalf("payroll role must not approve: %v", err)
+    }
+    if _, err := svc.Approve(ctx, "clerk", []string{RoleAdmin}, run.RunID); !errors.Is(err, ErrSelfApproval) {
+        t.Fatalf("submitter must not approve: %v", err)
+    }
+    if _, err := svc.Regenerate(ctx, "clerk", run.RunID); !errors.Is(err, ErrRunState) {
+        t.Fatalf("regenerate under review: %v", err)
+    }
+    if _, err := svc.Finalize(ctx, "clerk", run.RunID); !errors.Is(err, ErrRunState) {
+        t.Fatalf("finalize before approval: %v", err)
+    }
+    if _, err := svc.Approve(ctx, "boss", []string{RoleAdmin}, run.RunID); err != nil {
+        t.Fatalf("approve: %v", err)
+    }
+    run, err = svc.Finalize(ctx, "clerk", run.RunID)
+    if err != nil || run.Status != models.RunFinalized {
+        t.Fatalf("finalize: %v %+v", err, run)
+    }
+
+    // finalized runs are locked
+    if _, err := svc.Regenerate(ctx, "clerk", run.RunID); !errors.Is(err, ErrRunLocked) {
+        t.Fatalf("regenerate finalized: %v", err)
+    }
+    if err := svc.DeleteRun(ctx, "clerk", run.RunID); !errors.Is(err, ErrRunLocked) {
+        t.Fatalf("delete finalized: %v", err)
+    }
+    if _, err := svc.Reject(ctx, "boss", run.RunID, "oops"); !errors.Is(err, ErrRunLocked) {
+        t.Fatalf("reject finalized: %v", err)
+    }
+    run, err = svc.MarkPaid(ctx, "clerk", run.RunID)
+    if err != nil || run.Status != models.RunPaid || len(run.History) != 4 {
+        t.Fatalf("paid: %v %+v", err, run)
+    }
+    entries, _ := audit.List(ctx, run.RunID)
+    if len(entries) != 5 {
+        t.Fatalf("expected create + 4 transitions audited, got %d", len(entries))
+    }
+}
+
+func TestPayrollRunService_AdjustmentsDiffAndYearToDate(t *testing.T) {
+    ctx := context.Background()
+    svc, _ := newRunTestService(t)
+    p1, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-15"})
+    p2, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-16", End: "2025-06-30"})
+    run1, err := svc.CreateRun(ctx, "clerk", p1.PeriodID)
+    if err != nil {
+        t.Fatalf("run1: %v", err)
+    }
+    adj := models.PayrollAdjustment{EmployeeID: "E-1", Kind: models.LineEarning, Amount: money.MustParse("500", ""), Taxable: true, Reason: "missed overtime"}
+    if _, err := svc.AddAdjustment(ctx, "clerk", run1.RunID, adj); !errors.Is(err, ErrRunState) {
+        t.Fatalf("draft runs are regenerated, not adjusted: %v", err)
+    }
+    closeRun(t, svc, run1.RunID)
+    if _, err := svc.AddAdjustment(ctx, "clerk", run1.RunID, models.PayrollAdjustment{EmployeeID: "E-1", Kind: models.LineEarning, Amount: money.MustParse("1", "")}); !errors.Is(err, ErrInvalidAdjustment) {
+        t.Fatalf("reason required: %v", err)
+    }
+    a, err := svc.AddAdjustment(ctx, "clerk", run1.RunID, adj)
+    if err != nil {
+        t.Fatalf("adjust: %v", err)
+    }
+
+    run2, err := svc.CreateRun(ctx, "clerk", p2.PeriodID)
+    if err != nil {
+        t.Fatalf("run2: %v", err)
+    }
+    slips, _ := svc.Payslips(ctx, run2.RunID)
+    var e1 *models.Payslip
+    for i := range slips {
+        if slips[i].EmployeeID == "E-1" {
+            e1 = &slips[i]
+        }
+    }
+    if l := findLine(e1, "adjustment"); l == nil || l.Amount.String() != "500.00" || l.Inputs["adjustment_id"] != a.AdjustmentID {
+        t.Fatalf("adjustment not carried: %+v", e1.Lines)
+    }
+
+    d, err := svc.Diff(ctx, run2.RunID)
+    if err != nil || d.PreviousRunID != run1.RunID || len(d.Lines) != 2 {
+        t.Fatalf("diff: %v %+v", err, d)
+    }
+    if d.Lines[0].EmployeeID != "E-1" || d.Lines[0].Change != "changed" || d.Lines[1].Change != "unchanged" {
+        t.Fatalf("diff lines: %+v", d.Lines)
+    }
+
+    closeRun(t, svc, run2.RunID)
+    pending, _ := svc.store.ListAdjustments(ctx, AdjustmentFilter{PendingOnly: true})
+    if len(pending) != 0 {
+        t.Fatalf("adjustment should be applied: %+v", pending)
+    }
+
+    ytd, err := svc.TaxYearToDate(ctx, "E-1", 2025, "2025-07-01")
+    if err != nil {
+        t.Fatalf("ytd: %v", err)
+    }
+    want := money.Zero("PHP")
+    for _, runID := range []string{run1.RunID, run2.RunID} {
+        slips, _ := svc.Payslips(ctx, runID)
+        for _, p := range slips {
+            if p.EmployeeID == "E-1" {
+                want = want.Add(p.Taxes)
+            }
+        }
+    }
+    if want.IsZero() || !ytd.TaxWithheld.Equal(want) || ytd.TaxableCompensation.String() != "30500.00" {
+        t.Fatalf("ytd: %+v want withheld %s", ytd, want)
+    }
+}
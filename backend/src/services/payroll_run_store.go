@@ -0,0 +1,386 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdjustmentFilter selects payroll adjustments; empty fields match all.
+type AdjustmentFilter struct {
+    RunID       string
+    EmployeeID  string
+    PendingOnly bool // not yet paid by a finalized run
+}
+
+func (f AdjustmentFilter) match(a models.PayrollAdjustment) bool {
+    return (f.RunID == "" || a.RunID == f.RunID) &&
+        (f.EmployeeID == "" || a.EmployeeID == f.EmployeeID) &&
+        (!f.PendingOnly || a.AppliedRunID == "")
+}
+
+// PayrollRunStore persists pay periods, runs, their payslips and adjustments.
+type PayrollRunStore interface {
+    SavePeriod(ctx context.Context, p *models.PayPeriod) error
+    GetPeriod(ctx context.Context, periodID string) (*models.PayPeriod, error)
+    ListPeriods(ctx context.Context) ([]models.PayPeriod, error)
+    // SaveRun stores r, whose Version must be one more than the stored
+    // run's; it returns ErrRunChanged when another save came first.
+    SaveRun(ctx context.Context, r *models.PayrollRun) error
+    GetRun(ctx context.Context, runID string) (*models.PayrollRun, error)
+    ListRuns(ctx context.Context) ([]models.PayrollRun, error)
+    // DeleteRun removes the run and its payslips.
+    DeleteRun(ctx context.Context, runID string) error
+    // ReplacePayslips swaps the run's payslips for slips.
+    ReplacePayslips(ctx context.Context, runID string, slips []models.Payslip) error
+    ListPayslips(ctx context.Context, runID string) ([]models.Payslip, error)
+    EmployeePayslips(ctx context.Context, employeeID string) ([]models.Payslip, error)
+    SaveAdjustment(ctx context.Context, a *models.PayrollAdjustment) error
+    ListAdjustments(ctx context.Context, f AdjustmentFilter) ([]models.PayrollAdjustment, error)
+}
+
+// restorePayslipCurrency labels decoded amounts with the payslip currency;
+// BSON stores only the number.
+func restorePayslipCurrency(p *models.Payslip) {
+    cur := p.Currency
+    for i := range p.Lines {
+        p.Lines[i].Amount = p.Lines[i].Amount.WithCurrency(cur)
+    }
+    p.Gross = p.Gross.WithCurrency(cur)
+    p.Deductions = p.Deductions.WithCurrency(cur)
+    p.Taxes = p.Taxes.WithCurrency(cur)
+    p.Net = p.Net.WithCurrency(cur)
+    p.EmployerContributions = p.EmployerContributions.WithCurrency(cur)
+}
+
+func restoreRunCurrency(r *models.PayrollRun) {
+    for i := range r.Totals {
+        t := &r.Totals[i]
+        t.Gross = t.Gross.WithCurrency(t.Currency)
+        t.Deductions = t.Deductions.WithCurrency(t.Currency)
+        t.Taxes = t.Taxes.WithCurrency(t.Currency)
+        t.Net = t.Net.WithCurrency(t.Currency)
+        t.EmployerContributions = t.EmployerContributions.WithCurrency(t.Currency)
+    }
+    for i := range r.Exports {
+        r.Exports[i].Total = r.Exports[i].Total.WithCurrency(r.Exports[i].Currency)
+    }
+}
+
+// InMemoryPayrollRunStore keeps payroll runs in memory.
+type InMemoryPayrollRunStore struct {
+    mu          sync.Mutex
+    periods     map[string]models.PayPeriod
+    runs        map[string]models.PayrollRun
+    payslips    map[string][]models.Payslip // by run
+    adjustments []models.PayrollAdjustment
+}
+
+func NewInMemoryPayrollRunStore() *InMemoryPayrollRunStore {
+    return &InMemoryPayrollRunStore{
+        periods:  map[string]models.PayPeriod{},
+        runs:     map[string]models.PayrollRun{},
+        payslips: map[string][]models.Payslip{},
+    }
+}
+
+func (s *InMemoryPayrollRunStore) SavePeriod(ctx context.Context, p *models.PayPeriod) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.periods[p.PeriodID] = *p
+    return nil
+}
+
+func (s *InMemoryPayrollRunStore) GetPeriod(ctx context.Context, periodID string) (*models.PayPeriod, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    p, ok := s.periods[periodID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    return &p, nil
+}
+
+func (s *InMemoryPayrollRunStore) ListPeriods(ctx context.Context) ([]models.PayPeriod, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make([]models.PayPeriod, 0, len(s.periods))
+    for _, p := range s.periods {
+        out = append(out, p)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+    return out, nil
+}
+
+func (s *InMemoryPayrollRunStore) SaveRun(ctx context.Context, r *models.PayrollRun) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if cur, ok := s.runs[r.RunID]; ok && cur.Version != r.Version-1 {
+        return fmt.Errorf("%w: %s", ErrRunChanged, r.RunID)
+    }
+    cp := *r
+    cp.Totals = append([]models.RunTotals(nil), r.Totals...)
+    cp.Exceptions = append([]models.RunException(nil), r.Exceptions...)
+    cp.History = append([]models.RunTransition(nil), r.History...)
+    cp.Exports = append([]models.RunExport(nil), r.Exports...)
+    s.runs[r.RunID] = cp
+    return nil
+}
+
+func (s *InMemoryPayrollRunStore) GetRun(ctx context.Context, runID string) (*models.PayrollRun, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r, ok := s.runs[runID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    r.Totals = append([]models.RunTotals(nil), r.Totals...)
+    r.Exceptions = append([]models.RunException(nil), r.Exceptions...)
+    r.History = append([]models.RunTransition(nil), r.History...)
+    r.Exports = append([]models.RunExport(nil), r.Exports...)
+    return &r, nil
+}
+
+func (s *InMemoryPayrollRunStore) ListRuns(ctx context.Context) ([]models.PayrollRun, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make([]models.PayrollRun, 0, len(s.runs))
+    for _, r := range s.runs {
+        out = append(out, r)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].PeriodStart < out[j].PeriodStart })
+    return out, nil
+}
+
+func (s *InMemoryPayrollRunStore) DeleteRun(ctx context.Context, runID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if _, ok := s.runs[runID]; !ok {
+        return mongo.ErrNoDocuments
+    }
+    delete(s.runs, runID)
+    delete(s.payslips, runID)
+    return nil
+}
+
+func (s *InMemoryPayrollRunStore) ReplacePayslips(ctx context.Context, runID string, slips []models.Payslip) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.payslips[runID] = append([]models.Payslip(nil), slips...)
+    return nil
+}
+
+func (s *InMemoryPayrollRunStore) ListPayslips(ctx context.Context, runID string) ([]models.Payslip, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]models.Payslip{}, s.payslips[runID]...), nil
+}
+
+func (s *InMemoryPayrollRunStore) EmployeePayslips(ctx context.Context, employeeID string) ([]models.Payslip, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.Payslip{}
+    for _, slips := range s.payslips {
+        for _, p := range slips {
+            if p.EmployeeID == employeeID {
+                out = append(out, p)
+            }
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].PeriodEnd < out[j].PeriodEnd })
+    return out, nil
+}
+
+func (s *InMemoryPayrollRunStore) SaveAdjustment(ctx context.Context, a *models.PayrollAdjustment) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for i := range s.adjustments {
+        if s.adjustments[i].AdjustmentID == a.AdjustmentID {
+            s.adjustments[i] = *a
+            return nil
+        }
+    }
+    s.adjustments = append(s.adjustments, *a)
+    return nil
+}
+
+func (s *InMemoryPayrollRunStore) ListAdjustments(ctx context.Context, f AdjustmentFilter) ([]models.PayrollAdjustment, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.PayrollAdjustment{}
+    for _, a := range s.adjustments {
+        if f.match(a) {
+            out = append(out, a)
+        }
+    }
+    return out, nil
+}
+
+// MongoPayrollRunStore stores periods, runs, payslips and adjustments in
+// separate MongoDB collections.
+type MongoPayrollRunStore struct {
+    periods     *mongo.Collection
+    runs        *mongo.Collection
+    payslips    *mongo.Collection
+    adjustments *mongo.Collection
+}
+
+func NewMongoPayrollRunStore(periods, runs, payslips, adjustments *mongo.Collection) *MongoPayrollRunStore {
+    return &MongoPayrollRunStore{periods: periods, runs: runs, payslips: payslips, adjustments: adjustments}
+}
+
+func (s *MongoPayrollRunStore) SavePeriod(ctx context.Context, p *models.PayPeriod) error {
+    _, err := s.periods.ReplaceOne(ctx, bson.M{"period_id": p.PeriodID}, p, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoPayrollRunStore) GetPeriod(ctx context.Context, periodID string) (*models.PayPeriod, error) {
+    var p models.PayPeriod
+    if err := s.periods.FindOne(ctx, bson.M{"period_id": periodID}).Decode(&p); err != nil {
+        return nil, err
+    }
+    return &p, nil
+}
+
+func (s *MongoPayrollRunStore) ListPeriods(ctx context.Context) ([]models.PayPeriod, error) {
+    cur, err := s.periods.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"start": 1}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.PayPeriod{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+func (s *MongoPayrollRunStore) SaveRun(ctx context.Context, r *models.PayrollRun) error {
+    // runs stored before versions existed have no version field
+    var version interface{} = r.Version - 1
+    if r.Version <= 1 {
+        version = bson.M{"$in": bson.A{nil, 0}}
+    }
+    res, err := s.runs.ReplaceOne(ctx, bson.M{"run_id": r.RunID, "version": version}, r)
+    if err != nil {
+        return err
+    }
+    if res.MatchedCount > 0 {
+        return nil
+    }
+    if _, err := s.GetRun(ctx, r.RunID); !errors.Is(err, mongo.ErrNoDocuments) {
+        if err != nil {
+            return err
+        }
+        return fmt.Errorf("%w: %s", ErrRunChanged, r.RunID)
+    }
+    _, err = s.runs.InsertOne(ctx, r)
+    return err
+}
+
+func (s *MongoPayrollRunStore) GetRun(ctx context.Context, runID string) (*models.PayrollRun, error) {
+    var r models.PayrollRun
+    if err := s.runs.FindOne(ctx, bson.M{"run_id": runID}).Decode(&r); err != nil {
+        return nil, err
+    }
+    restoreRunCurrency(&r)
+    return &r, nil
+}
+
+func (s *MongoPayrollRunStore) ListRuns(ctx context.Context) ([]models.PayrollRun, error) {
+    cur, err := s.runs.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"period_start": 1}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.PayrollRun{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    for i := range out {
+        restoreRunCurrency(&out[i])
+    }
+    return out, nil
+}
+
+func (s *MongoPayrollRunStore) DeleteRun(ctx context.Context, runID string) error {
+    res, err := s.runs.DeleteOne(ctx, bson.M{"run_id": runID})
+    if err != nil {
+        return err
+    }
+    if res.DeletedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    _, err = s.payslips.DeleteMany(ctx, bson.M{"run_id": runID})
+    return err
+}
+
+func (s *MongoPayrollRunStore) ReplacePayslips(ctx context.Context, runID string, slips []models.Payslip) error {
+    if _, err := s.payslips.DeleteMany(ctx, bson.M{"run_id": runID}); err != nil {
+        return err
+    }
+    if len(slips) == 0 {
+        return nil
+    }
+    docs := make([]interface{}, len(slips))
+    for i := range slips {
+        docs[i] = slips[i]
+    }
+    _, err := s.payslips.InsertMany(ctx, docs)
+    return err
+}
+
+func (s *MongoPayrollRunStore) findPayslips(ctx context.Context, filter bson.M) ([]models.Payslip, error) {
+    cur, err := s.payslips.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "period_end", Value: 1}, {Key: "employee_id", Value: 1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.Payslip{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    for i := range out {
+        restorePayslipCurrency(&out[i])
+    }
+    return out, nil
+}
+
+func (s *MongoPayrollRunStore) ListPayslips(ctx context.Context, runID string) ([]models.Payslip, error) {
+    return s.findPayslips(ctx, bson.M{"run_id": runID})
+}
+
+func (s *MongoPayrollRunStore) EmployeePayslips(ctx context.Context, employeeID string) ([]models.Payslip, error) {
+    return s.findPayslips(ctx, bson.M{"employee_id": employeeID})
+}
+
+func (s *MongoPayrollRunStore) SaveAdjustment(ctx context.Context, a *models.PayrollAdjustment) error {
+    _, err := s.adjustments.ReplaceOne(ctx, bson.M{"adjustment_id": a.AdjustmentID}, a, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoPayrollRunStore) ListAdjustments(ctx context.Context, f AdjustmentFilter) ([]models.PayrollAdjustment, error) {
+    filter := bson.M{}
+    if f.RunID != "" {
+        filter["run_id"] = f.RunID
+    }
+    if f.EmployeeID != "" {
+        filter["employee_id"] = f.EmployeeID
+    }
+    if f.PendingOnly {
+        filter["applied_run_id"] = bson.M{"$in": bson.A{nil, ""}}
+    }
+    cur, err := s.adjustments.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.PayrollAdjustment{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
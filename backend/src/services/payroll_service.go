@@ -0,0 +1,391 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+// Pay frequencies supported by the engine.
+const (
+    FrequencyMonthly     = "monthly"
+    FrequencySemiMonthly = "semi_monthly"
+    FrequencyWeekly      = "weekly"
+    FrequencyDaily       = "daily"
+)
+
+// validFrequency reports whether the engine can pay at frequency f.
+func validFrequency(f string) bool {
+    switch f {
+    case FrequencyMonthly, FrequencySemiMonthly, FrequencyWeekly, FrequencyDaily:
+        return true
+    }
+    return false
+}
+
+var (
+    // ErrNoSalary is returned when no salary record is in effect for the period.
+    ErrNoSalary = errors.New("no salary in effect for period")
+    // ErrInvalidPayrollRequest wraps malformed periods and frequencies.
+    ErrInvalidPayrollRequest = errors.New("invalid payroll request")
+)
+
+// AttendanceSummary aggregates time data for a pay period.
+type AttendanceSummary = models.AttendanceSummary
+
+// AttendanceSource supplies attendance for a period (dates are YYYY-MM-DD).
+type AttendanceSource interface {
+    AttendanceSummary(ctx context.Context, employeeID, start, end string) (AttendanceSummary, error)
+}
+
+// LeaveSource reports leave days in a period that are not paid.
+type LeaveSource interface {
+    UnpaidLeaveDays(ctx context.Context, employeeID, start, end string) (float64, error)
+}
+
+// DeductionInput is a one-off or scheduled deduction supplied with a request.
+type DeductionInput struct {
+    Code   string      `json:"code"`
+    Label  string      `json:"label"`
+    Amount money.Money `json:"amount"`
+}
+
+// AdjustmentInput is a correction carried into this payslip, e.g. a
+// PayrollAdjustment against a finalized run. Kind is earning or deduction.
+type AdjustmentInput struct {
+    AdjustmentID string      `json:"adjustment_id,omitempty"`
+    PayslipID    string      `json:"payslip_id,omitempty"` // payslip being corrected
+    Code         string      `json:"code"`
+    Label        string      `json:"label"`
+    Kind         string      `json:"kind"`
+    Amount       money.Money `json:"amount"`
+    Taxable      bool        `json:"taxable,omitempty"`
+    OtherBenefit bool        `json:"other_benefit,omitempty"` // 13th month and other benefits
+}
+
+// PayrollRequest asks for one employee's payslip.
+type PayrollRequest struct {
+    EmployeeID  string             `json:"employee_id"`
+    PeriodStart string             `json:"period_start"`
+    PeriodEnd   string             `json:"period_end"`
+    Frequency   string             `json:"frequency"`
+    Attendance  *AttendanceSummary `json:"attendance,omitempty"` // overrides the AttendanceSource
+    Deductions  []DeductionInput   `json:"deductions,omitempty"`
+    Adjustments []AdjustmentInput  `json:"adjustments,omitempty"`
+    YearToDate  *TaxYearToDate     `json:"year_to_date,omitempty"` // overrides the withholding rule's history
+    Annualize   bool               `json:"annualize,omitempty"`    // year-end tax adjustment outside December, e.g. final pay
+    // OffCycle pays only the supplied adjustments and deductions: no salary,
+    // allowances, overtime or contributions (e.g. a 13th-month run).
+    OffCycle bool `json:"off_cycle,omitempty"`
+    // SettleLoans deducts the whole balance of active loans, e.g. on final pay.
+    SettleLoans bool `json:"settle_loans,omitempty"`
+}
+
+// PayrollContext is the state rules read from and add lines to. Rules run in
+// order, so a tax rule sees every earning and contribution before it.
+type PayrollContext struct {
+    Ctx             context.Context
+    Request         PayrollRequest
+    Employee        map[string]interface{}
+    Currency        string
+    Salary          models.CompensationRecord
+    Allowances      []models.CompensationRecord
+    Attendance      AttendanceSummary
+    UnpaidLeaveDays float64
+    Config          PayrollConfig
+    Rounding        money.RoundingPolicy
+    Lines           []models.PayslipLine
+}
+
+// PayrollRule computes some payslip lines. Rules are the engine's extension
+// point: earnings, contributions, loans and tax are all rules.
+type PayrollRule interface {
+    Name() string
+    Apply(pc *PayrollContext) ([]models.PayslipLine, error)
+}
+
+// PayrollConfig holds the rate conventions used by the built-in rules.
+type PayrollConfig struct {
+    FactorDays    int64  // paid days per year used to derive the daily rate
+    HoursPerDay   int64
+    OvertimeRate  string // multiplier of the hourly rate, e.g. "1.25"
+    NightDiffRate string // premium on the hourly rate, e.g. "0.10"
+}
+
+// DefaultPayrollConfig follows common Philippine practice: 261 paid days
+// (five-day week), 8-hour days, 125% overtime and 10% night differential.
+func DefaultPayrollConfig() PayrollConfig {
+    return PayrollConfig{FactorDays: 261, HoursPerDay: 8, OvertimeRate: "1.25", NightDiffRate: "0.10"}
+}
+
+// PayrollService computes payslips from compensation, attendance, leave and
+// the configured rules.
+type PayrollService struct {
+    employees  EmployeeRepo
+    attendance AttendanceSource
+    leave      LeaveSource
+    rules      []PayrollRule
+    cfg        PayrollConfig
+    rounding   money.RoundingPolicy
+    now        func() time.Time
+}
+
+// NewPayrollService creates the engine. attendance and leave may be nil, in
+// which case full attendance and no unpaid leave are assumed.
+func NewPayrollService(employees EmployeeRepo, attendance AttendanceSource, leave LeaveSource, cfg PayrollConfig, rounding money.RoundingPolicy, rules ...PayrollRule) *PayrollService {
+    return &PayrollService{employees: employees, attendance: attendance, leave: leave, rules: rules, cfg: cfg, rounding: rounding, now: time.Now}
+}
+
+// AddRule appends a rule after the configured ones.
+func (s *PayrollService) AddRule(r PayrollRule) {
+    s.rules = append(s.rules, r)
+}
+
+// Calculate builds the payslip for req without storing it.
+func (s *PayrollService) Calculate(ctx context.Context, req PayrollRequest) (*models.Payslip, error) {
+    if req.Frequency == "" {
+        req.Frequency = FrequencySemiMonthly
+    }
+    if !validFrequency(req.Frequency) {
+        return nil, fmt.Errorf("%w: unsupported frequency %q", ErrInvalidPayrollRequest, req.Frequency)
+    }
+    start, err := time.Parse("2006-01-02", req.PeriodStart)
+    if err != nil {
+        return nil, fmt.Errorf("%w: period_start %v", ErrInvalidPayrollRequest, err)
+    }
+    end, err := time.Parse("2006-01-02", req.PeriodEnd)
+    if err != nil {
+        return nil, fmt.Errorf("%w: period_end %v", ErrInvalidPayrollRequest, err)
+    }
+    if end.Before(start) {
+        return nil, fmt.Errorf("%w: period_end before period_start", ErrInvalidPayrollRequest)
+    }
+    emp, err := s.employees.Get(ctx, req.EmployeeID)
+    if err != nil {
+        return nil, err
+    }
+    recs, err := compensationRecords(emp)
+    if err != nil {
+        return nil, err
+    }
+    salary, allowances, ok := compensationInEffect(recs, req.PeriodStart, req.PeriodEnd)
+    if !ok {
+        return nil, ErrNoSalary
+    }
+    // a payslip is in one currency; allowances are not converted
+    for _, a := range allowances {
+        if c := a.Amount.Currency(); c != salary.Amount.Currency() {
+            return nil, fmt.Errorf("%w: allowance %q is in %s, the salary in %s", ErrInvalidPayrollRequest, a.Name, c, salary.Amount.Currency())
+        }
+    }
+    pc := &PayrollContext{
+        Ctx:        ctx,
+        Request:    req,
+        Employee:   emp,
+        Currency:   salary.Amount.Currency(),
+        Salary:     salary,
+        Allowances: allowances,
+        Config:     s.cfg,
+        Rounding:   s.rounding,
+    }
+    switch {
+    case req.Attendance != nil:
+        pc.Attendance = *req.Attendance
+    case s.attendance != nil:
+        if pc.Attendance, err = s.attendance.AttendanceSummary(ctx, req.EmployeeID, req.PeriodStart, req.PeriodEnd); err != nil {
+            return nil, err
+        }
+    }
+    if s.leave != nil {
+        if pc.UnpaidLeaveDays, err = s.leave.UnpaidLeaveDays(ctx, req.EmployeeID, req.PeriodStart, req.PeriodEnd); err != nil {
+            return nil, err
+        }
+    }
+    for _, r := range s.rules {
+        lines, err := r.Apply(pc)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", r.Name(), err)
+        }
+        for i := range lines {
+            // an untyped zero adopts the payslip currency; anything else must be in it
+            if c := lines[i].Amount.Currency(); c != pc.Currency && !(c == "" && lines[i].Amount.IsZero()) {
+                return nil, fmt.Errorf("%s: %w: line %s is in %s, the payslip in %s", r.Name(), money.ErrCurrencyMismatch, lines[i].Code, c, pc.Currency)
+            }
+            lines[i].Amount = s.rounding.Round(lines[i].Code, lines[i].Amount.Add(money.Zero(pc.Currency)))
+        }
+        pc.Lines = append(pc.Lines, lines...)
+    }
+    p := &models.Payslip{
+        PayslipID:       fmt.Sprintf("ps-%s-%s", req.EmployeeID, req.PeriodEnd),
+        EmployeeID:      req.EmployeeID,
+        PeriodStart:     req.PeriodStart,
+        PeriodEnd:       req.PeriodEnd,
+        Frequency:       req.Frequency,
+        Currency:        pc.Currency,
+        Attendance:      &pc.Attendance,
+        UnpaidLeaveDays: pc.UnpaidLeaveDays,
+        Lines:           pc.Lines,
+        CreatedAt:       s.now().Unix(),
+    }
+    p.Gross = pc.Sum(models.LineEarning)
+    p.Deductions = pc.Sum(models.LineDeduction).Add(pc.Sum(models.LineContribution))
+    p.Taxes = pc.Sum(models.LineTax)
+    p.Net = p.Gross.Sub(p.Deductions).Sub(p.Taxes)
+    p.EmployerContributions = pc.Sum(models.LineEmployer)
+    return p, nil
+}
+
+// Sum totals the lines of kind computed so far.
+func (pc *PayrollContext) Sum(kind string) money.Money {
+    total := money.Zero(pc.Currency)
+    for _, l := range pc.Lines {
+        if l.Kind == kind {
+            total = total.Add(l.Amount)
+        }
+    }
+    return total
+}
+
+// Line returns the amount of the line with code, or zero.
+func (pc *PayrollContext) Line(code string) money.Money {
+    total := money.Zero(pc.Currency)
+    for _, l := range pc.Lines {
+        if l.Code == code {
+            total = total.Add(l.Amount)
+        }
+    }
+    return total
+}
+
+// TaxableEarnings totals taxable earnings computed so far.
+func (pc *PayrollContext) TaxableEarnings() money.Money {
+    total := money.Zero(pc.Currency)
+    for _, l := range pc.Lines {
+        if l.Kind == models.LineEarning && l.Taxable {
+            total = total.Add(l.Amount)
+        }
+    }
+    return total
+}
+
+// PeriodsPerYear is 12 for monthly, 24 for semi-monthly and 52 for weekly
+// payroll; daily payroll pays the factor days.
+func (pc *PayrollContext) PeriodsPerYear() int64 {
+    switch pc.Request.Frequency {
+    case FrequencySemiMonthly:
+        return 24
+    case FrequencyWeekly:
+        return 52
+    case FrequencyDaily:
+        return pc.Config.FactorDays
+    }
+    return 12
+}
+
+// PerPeriod returns the period's share of a monthly amount (monthly × 12 ÷
+// periods per year).
+func (pc *PayrollContext) PerPeriod(monthly money.Money) money.Money {
+    return monthly.MulRatio(12, pc.PeriodsPerYear(), money.HalfEven)
+}
+
+// MonthlyRate returns the salary expressed per month. Daily-rated salaries
+// are converted with the factor days.
+func (pc *PayrollContext) MonthlyRate() money.Money {
+    if pc.Salary.Basis == "daily" {
+        return pc.Salary.Amount.MulRatio(pc.Config.FactorDays, 12, money.HalfEven)
+    }
+    return pc.Salary.Amount
+}
+
+// DailyRate returns the salary per day (monthly × 12 ÷ factor days).
+func (pc *PayrollContext) DailyRate() money.Money {
+    if pc.Salary.Basis == "daily" {
+        return pc.Salary.Amount
+    }
+    return pc.Salary.Amount.MulRatio(12, pc.Config.FactorDays, money.HalfEven)
+}
+
+// HourlyRate returns the daily rate divided by the hours in a day.
+func (pc *PayrollContext) HourlyRate() money.Money {
+    return pc.DailyRate().Div(pc.Config.HoursPerDay, money.HalfEven)
+}
+
+// Rates returns the monthly and daily rates of the salary in effect during
+// [start, end], or ErrNoSalary.
+func (s *PayrollService) Rates(ctx context.Context, employeeID, start, end string) (monthly, daily money.Money, err error) {
+    emp, err := s.employees.Get(ctx, employeeID)
+    if err != nil {
+        return money.Money{}, money.Money{}, err
+    }
+    recs, err := compensationRecords(emp)
+    if err != nil {
+        return money.Money{}, money.Money{}, err
+    }
+    salary, _, ok := compensationInEffect(recs, start, end)
+    if !ok {
+        return money.Money{}, money.Money{}, ErrNoSalary
+    }
+    pc := &PayrollContext{Salary: salary, Config: s.cfg}
+    return pc.MonthlyRate(), pc.DailyRate(), nil
+}
+
+// compensationRecords decodes the employee document's compensation_records,
+// which may hold JSON floats, Money values or stored Decimal128.
+func compensationRecords(emp map[string]interface{}) ([]models.CompensationRecord, error) {
+    raw, ok := emp["compensation_records"]
+    if !ok || raw == nil {
+        return nil, nil
+    }
+    b, err := bson.Marshal(bson.M{"r": raw})
+    if err != nil {
+        return nil, err
+    }
+    var out struct {
+        R []models.CompensationRecord `bson:"r"`
+    }
+    if err := bson.Unmarshal(b, &out); err != nil {
+        return nil, err
+    }
+    for i := range out.R {
+        cur := out.R[i].Currency
+        if cur == "" {
+            cur = money.DefaultCurrency
+        }
+        out.R[i].Amount = out.R[i].Amount.WithCurrency(cur)
+    }
+    return out.R, nil
+}
+
+// compensationInEffect picks the latest salary effective on or before end and
+// the allowances active at any point in [start, end].
+func compensationInEffect(recs []models.CompensationRecord, start, end string) (models.CompensationRecord, []models.CompensationRecord, bool) {
+    sort.SliceStable(recs, func(i, j int) bool { return recs[i].EffectiveDate < recs[j].EffectiveDate })
+    var salary models.CompensationRecord
+    found := false
+    var allowances []models.CompensationRecord
+    for _, r := range recs {
+        if r.EffectiveDate > end {
+            continue
+        }
+        switch r.Type {
+        case "salary", "basic":
+            salary, found = r, true
+        case "allowance":
+            if r.EndDate == "" || r.EndDate >= start {
+                allowances = append(allowances, r)
+            }
+        }
+    }
+    return salary, allowances, found
+}
+
+func qty(f float64) string {
+    return strconv.FormatFloat(f, 'f', -1, 64)
+}
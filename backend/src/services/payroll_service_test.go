@@ -0,0 +1,159 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+type stubLeave float64
+
+func (s stubLeave) UnpaidLeaveDays(ctx context.Context, employeeID, start, end string) (float64, error) {
+    return float64(s), nil
+}
+
+// flatTaxRule withholds 10% of taxable earnings to show rules can be plugged in.
+type flatTaxRule struct{}
+
+func (flatTaxRule) Name() string { return "flat_tax" }
+
+func (flatTaxRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    base := pc.TaxableEarnings()
+    return []models.PayslipLine{{Code: "tax", Label: "Tax", Kind: models.LineTax, Amount: base.MulRatio(10, 100, money.HalfEven),
+        Inputs: map[string]string{"taxable": base.String()}, Formula: "taxable × 10%"}}, nil
+}
+
+func newPayrollTestRepo(t *testing.T) EmployeeRepo {
+    t.Helper()
+    repo := NewInMemoryEmployeeRepo()
+    f := false
+    _, _ = repo.Create(context.Background(), map[string]interface{}{
+        "employee_id": "E-1",
+        "compensation_records": []interface{}{
+            map[string]interface{}{"type": "salary", "amount": 25000.0, "effective_date": "2024-01-01"},
+            map[string]interface{}{"type": "salary", "amount": money.MustParse("30000", "PHP"), "effective_date": "2025-01-01", "currency": "PHP"},
+            map[string]interface{}{"type": "salary", "amount": 40000.0, "effective_date": "2026-01-01"},
+            map[string]interface{}{"type": "allowance", "name": "Rice subsidy", "amount": 2000.0, "effective_date": "2025-01-01", "taxable": f},
+            map[string]interface{}{"type": "allowance", "name": "Old transport", "amount": 900.0, "effective_date": "2024-01-01", "end_date": "2024-12-31"},
+        },
+    })
+    return repo
+}
+
+func findLine(p *models.Payslip, code string) *models.PayslipLine {
+    for i := range p.Lines {
+        if p.Lines[i].Code == code {
+            return &p.Lines[i]
+        }
+    }
+    return nil
+}
+
+func TestPayrollService_SemiMonthlyPayslip(t *testing.T) {
+    svc := NewPayrollService(newPayrollTestRepo(t), nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), DefaultPayrollRules()...)
+    p, err := svc.Calculate(context.Background(), PayrollRequest{
+        EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15", Frequency: FrequencySemiMonthly,
+        Attendance: &AttendanceSummary{AbsentDays: 1, LateMinutes: 30, OvertimeMinutes: 120},
+        Deductions: []DeductionInput{{Code: "cash_advance", Label: "Cash advance", Amount: money.MustParse("500", "")}},
+    })
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    want := map[string]string{"basic": "15000.00", "absences": "-1379.31", "tardiness": "-86.21", "overtime": "431.03", "allowance": "1000.00", "cash_advance": "500.00"}
+    for code, amt := range want {
+        l := findLine(p, code)
+        if l == nil || l.Amount.String() != amt {
+            t.Fatalf("%s: want %s, got %+v", code, amt, l)
+        }
+        if l.Formula == "" || len(l.Inputs) == 0 {
+            t.Fatalf("%s: missing formula or inputs", code)
+        }
+    }
+    if findLine(p, "allowance").Taxable {
+        t.Fatalf("rice subsidy is non-taxable")
+    }
+    if p.Gross.String() != "14965.51" || p.Deductions.String() != "500.00" || p.Net.String() != "14465.51" || p.Currency != "PHP" {
+        t.Fatalf("totals: gross %s deductions %s net %s %s", p.Gross, p.Deductions, p.Net, p.Currency)
+    }
+}
+
+func TestPayrollService_PluggableRuleAndLeave(t *testing.T) {
+    rules := append(DefaultPayrollRules(), flatTaxRule{})
+    svc := NewPayrollService(newPayrollTestRepo(t), nil, stubLeave(2), DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    p, err := svc.Calculate(context.Background(), PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-30", Frequency: FrequencyMonthly})
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // 30000 - 2 × 1379.3103 = 27241.38 taxable; the allowance is not
+    if l := findLine(p, "absences"); l == nil || l.Amount.String() != "-2758.62" {
+        t.Fatalf("unpaid leave: %+v", l)
+    }
+    if p.Taxes.String() != "2724.14" || p.Net.String() != "26517.24" {
+        t.Fatalf("taxes %s net %s", p.Taxes, p.Net)
+    }
+}
+
+func TestPayrollService_WeeklyAndDaily(t *testing.T) {
+    taxTables, err := DefaultTaxTables()
+    if err != nil {
+        t.Fatalf("tax tables: %v", err)
+    }
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    rules = append(rules, WithholdingTaxRule{Tables: taxTables})
+    svc := NewPayrollService(newPayrollTestRepo(t), nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    ctx := context.Background()
+    for _, tc := range []struct {
+        frequency, start, end string
+        basic, allowance      string
+        contributions         bool
+    }{
+        // 30,000 × 12 ÷ 52; contributions wait for the month's last week
+        {FrequencyWeekly, "2025-06-14", "2025-06-20", "6923.08", "461.54", false},
+        {FrequencyWeekly, "2025-06-21", "2025-06-27", "6923.08", "461.54", true},
+        // 30,000 × 12 ÷ 261 factor days
+        {FrequencyDaily, "2025-06-27", "2025-06-27", "1379.31", "91.95", false},
+        {FrequencyDaily, "2025-06-30", "2025-06-30", "1379.31", "91.95", true},
+    } {
+        ytd := &TaxYearToDate{}
+        p, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: tc.start, PeriodEnd: tc.end, Frequency: tc.frequency, YearToDate: ytd})
+        if err != nil {
+            t.Fatalf("%s %s: %v", tc.frequency, tc.end, err)
+        }
+        if findLine(p, "basic").Amount.String() != tc.basic || findLine(p, "allowance").Amount.String() != tc.allowance {
+            t.Fatalf("%s %s lines: %+v", tc.frequency, tc.end, p.Lines)
+        }
+        if (findLine(p, "sss_ee") != nil) != tc.contributions {
+            t.Fatalf("%s %s contributions: %+v", tc.frequency, tc.end, p.Lines)
+        }
+        if l := findLine(p, "withholding_tax"); l == nil || l.Inputs["period"] != tc.frequency {
+            t.Fatalf("%s %s tax: %+v", tc.frequency, tc.end, l)
+        }
+    }
+}
+
+func TestPayrollService_Errors(t *testing.T) {
+    svc := NewPayrollService(newPayrollTestRepo(t), nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), DefaultPayrollRules()...)
+    ctx := context.Background()
+    if _, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2023-01-01", PeriodEnd: "2023-01-31", Frequency: FrequencyMonthly}); err != ErrNoSalary {
+        t.Fatalf("expected ErrNoSalary, got %v", err)
+    }
+    if _, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-01-01", PeriodEnd: "2025-01-31", Frequency: "fortnightly"}); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("expected ErrInvalidPayrollRequest, got %v", err)
+    }
+
+    // nothing on a payslip is silently relabelled or dropped for its currency
+    usd := DeductionInput{Code: "advance", Amount: money.MustParse("100", "USD")}
+    if _, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15", Deductions: []DeductionInput{usd}}); !errors.Is(err, money.ErrCurrencyMismatch) {
+        t.Fatalf("expected ErrCurrencyMismatch, got %v", err)
+    }
+    _, _ = svc.employees.Update(ctx, "E-1", map[string]interface{}{"compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "amount": 30000.0, "effective_date": "2025-01-01"},
+        map[string]interface{}{"type": "allowance", "name": "Housing", "amount": 500.0, "currency": "USD", "effective_date": "2025-01-01"},
+    }}, nil)
+    if _, err := svc.Calculate(ctx, PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15"}); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("expected the USD allowance to be rejected, got %v", err)
+    }
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "sort"
+    "strings"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// Default variance thresholds: a gross or net swing is flagged when it is at
+// least 20% of the previous amount and at least 1,000 in the payslip currency.
+const (
+    DefaultVarianceThreshold = "0.2"
+    DefaultVarianceMinChange = "1000"
+)
+
+// VariancePolicy sets how large a period-over-period swing must be to flag.
+type VariancePolicy struct {
+    Threshold string // relative change, e.g. "0.2" for 20%
+    MinChange string // absolute change in the payslip currency
+}
+
+func (p VariancePolicy) withDefaults() VariancePolicy {
+    if strings.TrimSpace(p.Threshold) == "" {
+        p.Threshold = DefaultVarianceThreshold
+    }
+    if strings.TrimSpace(p.MinChange) == "" {
+        p.MinChange = DefaultVarianceMinChange
+    }
+    return p
+}
+
+func (p VariancePolicy) validate() error {
+    p = p.withDefaults()
+    if r, ok := new(big.Rat).SetString(p.Threshold); !ok || r.Sign() < 0 {
+        return fmt.Errorf("%w: variance threshold %q", ErrInvalidPayrollRequest, p.Threshold)
+    }
+    if m, err := money.Parse(p.MinChange, ""); err != nil || m.Sign() < 0 {
+        return fmt.Errorf("%w: variance minimum change %q", ErrInvalidPayrollRequest, p.MinChange)
+    }
+    return nil
+}
+
+// swing reports whether the change from prev to cur crosses the policy.
+func (p VariancePolicy) swing(prev, cur money.Money) bool {
+    p = p.withDefaults()
+    change := cur.Sub(prev).Abs()
+    if change.IsZero() {
+        return false
+    }
+    min, err := money.Parse(p.MinChange, cur.Currency())
+    if err != nil || change.LessThan(min) {
+        return false
+    }
+    limit, err := prev.Abs().MulRate(p.Threshold, money.HalfEven)
+    return err == nil && !change.LessThan(limit)
+}
+
+// SetVariancePolicy replaces the thresholds of the variance report.
+func (s *PayrollRunService) SetVariancePolicy(p VariancePolicy) error {
+    if err := p.validate(); err != nil {
+        return err
+    }
+    s.variance = p.withDefaults()
+    return nil
+}
+
+// VarianceLine compares one employee's payslip with the other period.
+type VarianceLine struct {
+    EmployeeID         string              `json:"employee_id"`
+    Name               string              `json:"name"`
+    Currency           string              `json:"currency"`
+    PreviousGross      *money.Money        `json:"previous_gross,omitempty"`
+    Gross              *money.Money        `json:"gross,omitempty"`
+    GrossChange        *money.Money        `json:"gross_change,omitempty"`
+    GrossChangePercent string              `json:"gross_change_percent,omitempty"`
+    PreviousNet        *money.Money        `json:"previous_net,omitempty"`
+    Net                *money.Money        `json:"net,omitempty"`
+    NetChange          *money.Money        `json:"net_change,omitempty"`
+    NetChangePercent   string              `json:"net_change_percent,omitempty"`
+    Anomalies          []models.RunAnomaly `json:"anomalies,omitempty"`
+}
+
+// VarianceReport compares a run with another, by default the previous
+// finalized run of its frequency, and flags payslips worth a second look.
+type VarianceReport struct {
+    RunID               string         `json:"run_id"`
+    PeriodStart         string         `json:"period_start"`
+    PeriodEnd           string         `json:"period_end"`
+    PreviousRunID       string         `json:"previous_run_id,omitempty"`
+    PreviousPeriodStart string         `json:"previous_period_start,omitempty"`
+    PreviousPeriodEnd   string         `json:"previous_period_end,omitempty"`
+    Policy              VariancePolicy `json:"policy"`
+    Lines               []VarianceLine `json:"lines"`
+    Anomalies           int            `json:"anomalies"`
+}
+
+// flagged lists the anomalies of every line.
+func (r *VarianceReport) flagged() []models.RunAnomaly {
+    var out []models.RunAnomaly
+    for _, l := range r.Lines {
+        out = append(out, l.Anomalies...)
+    }
+    return out
+}
+
+// statutoryContributions are the employee-share line codes every regular
+// payslip is expected to carry, with the scheme named in anomalies.
+var statutoryContributions = []struct{ code, scheme string }{
+    {"sss_ee", "SSS"},
+    {"philhealth_ee", "PhilHealth"},
+    {"pagibig_ee", "Pag-IBIG"},
+}
+
+// Variance compares runID with againstID, or with the previous finalized run
+// of its frequency when againstID is empty. Besides gross and net swings and
+// new or dropped employees it flags negative net pay, missing statutory
+// contributions and payslips of employees terminated before or hired after
+// the period.
+func (s *PayrollRunService) Variance(ctx context.Context, runID, againstID string) (*VarianceReport, error) {
+    run, err := s.store.GetRun(ctx, runID)
+    if err != nil {
+        return nil, err
+    }
+    var prev *models.PayrollRun
+    if againstID != "" {
+        if againstID == runID {
+            return nil, fmt.Errorf("%w: cannot compare a run with itself", ErrInvalidPayrollRequest)
+        }
+        if prev, err = s.store.GetRun(ctx, againstID); err != nil {
+            return nil, err
+        }
+    } else if prev, err = s.previousRun(ctx, run); err != nil {
+        return nil, err
+    }
+    return s.varianceReport(ctx, run, prev)
+}
+
+func (s *PayrollRunService) varianceReport(ctx context.Context, run, prev *models.PayrollRun) (*VarianceReport, error) {
+    r := &VarianceReport{RunID: run.RunID, PeriodStart: run.PeriodStart, PeriodEnd: run.PeriodEnd, Policy: s.variance.withDefaults(), Lines: []VarianceLine{}}
+    cur, err := s.store.ListPayslips(ctx, run.RunID)
+    if err != nil {
+        return nil, err
+    }
+    before := map[string]models.Payslip{}
+    if prev != nil {
+        r.PreviousRunID, r.PreviousPeriodStart, r.PreviousPeriodEnd = prev.RunID, prev.PeriodStart, prev.PeriodEnd
+        slips, err := s.store.ListPayslips(ctx, prev.RunID)
+        if err != nil {
+            return nil, err
+        }
+        for _, p := range slips {
+            before[p.EmployeeID] = p
+        }
+    }
+    emps, err := s.employees.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    byID := map[string]map[string]interface{}{}
+    for _, e := range emps {
+        if id, _ := e["employee_id"].(string); id != "" {
+            byID[id] = e
+        }
+    }
+    // the schemes deducted on this cut-off, e.g. none of them on the second
+    // cut-off under a first cut-off split
+    expected := s.engine.ExpectedContributions(run.Frequency, run.PeriodEnd)
+
+    for _, p := range cur {
+        p := p
+        l := VarianceLine{EmployeeID: p.EmployeeID, Name: p.EmployeeID, Currency: p.Currency, Gross: &p.Gross, Net: &p.Net}
+        emp := byID[p.EmployeeID]
+        if emp != nil {
+            l.Name = employeeName(emp)
+        }
+        flag := func(f, detail string, args ...interface{}) {
+            l.Anomalies = append(l.Anomalies, models.RunAnomaly{EmployeeID: p.EmployeeID, Flag: f, Detail: fmt.Sprintf(detail, args...)})
+        }
+        if b, ok := before[p.EmployeeID]; ok {
+            b := b
+            l.PreviousGross, l.PreviousNet = &b.Gross, &b.Net
+            if b.Currency == p.Currency {
+                gc, nc := p.Gross.Sub(b.Gross), p.Net.Sub(b.Net)
+                l.GrossChange, l.GrossChangePercent = &gc, changePercent(gc, b.Gross)
+                l.NetChange, l.NetChangePercent = &nc, changePercent(nc, b.Net)
+                if r.Policy.swing(b.Gross, p.Gross) {
+                    flag(models.AnomalyGrossSwing, "gross %s → %s", b.Gross, p.Gross)
+                }
+                if r.Policy.swing(b.Net, p.Net) {
+                    flag(models.AnomalyNetSwing, "net %s → %s", b.Net, p.Net)
+                }
+            }
+            delete(before, p.EmployeeID)
+        } else if prev != nil {
+            flag(models.AnomalyNewEmployee, "no payslip in %s", prev.RunID)
+        }
+        if p.Net.Sign() < 0 {
+            flag(models.AnomalyNegativeNet, "net %s", p.Net)
+        }
+        // the statutory tables are in pesos; other currencies are not deducted
+        if regularRun(run) && p.Currency == "PHP" {
+            have := map[string]bool{}
+            for _, pl := range p.Lines {
+                if pl.Kind == models.LineContribution && !pl.Amount.IsZero() {
+                    have[pl.Code] = true
+                }
+            }
+            for _, c := range statutoryContributions {
+                if expected[c.code] && !have[c.code] {
+                    flag(models.AnomalyMissingContribution, "no %s contribution", c.scheme)
+                }
+            }
+        }
+        // final pay is paid after separation by design
+        if emp != nil && run.Type != models.RunFinalPay {
+            if hire, _ := emp["hire_date"].(string); hire != "" && hire > run.PeriodEnd {
+                flag(models.AnomalyNotHired, "hired %s", hire)
+            }
+            if term, _ := emp["termination_date"].(string); term != "" && term < run.PeriodStart {
+                flag(models.AnomalyTerminated, "terminated %s", term)
+            } else if status, _ := emp["employment_status"].(string); term == "" && separatedStatus(status) {
+                flag(models.AnomalyTerminated, "employment status %s", status)
+            }
+        }
+        r.Lines = append(r.Lines, l)
+    }
+    for _, b := range before {
+        b := b
+        l := VarianceLine{EmployeeID: b.EmployeeID, Name: b.EmployeeID, Currency: b.Currency, PreviousGross: &b.Gross, PreviousNet: &b.Net}
+        if emp := byID[b.EmployeeID]; emp != nil {
+            l.Name = employeeName(emp)
+        }
+        l.Anomalies = []models.RunAnomaly{{EmployeeID: b.EmployeeID, Flag: models.AnomalyDroppedEmployee, Detail: fmt.Sprintf("paid in %s", prev.RunID)}}
+        r.Lines = append(r.Lines, l)
+    }
+    sort.Slice(r.Lines, func(i, j int) bool { return r.Lines[i].EmployeeID < r.Lines[j].EmployeeID })
+    for _, l := range r.Lines {
+        r.Anomalies += len(l.Anomalies)
+    }
+    return r, nil
+}
+
+// changePercent formats change as a percentage of base to one decimal; empty
+// when base is zero.
+func changePercent(change, base money.Money) string {
+    if base.IsZero() {
+        return ""
+    }
+    pct := change.Ratio(base)
+    return pct.Mul(pct, big.NewRat(100, 1)).FloatString(1)
+}
+
+// VarianceCSV renders r with one row per employee; the anomalies of a row are
+// joined with semicolons.
+func VarianceCSV(r *VarianceReport) ([]byte, error) {
+    amount := func(m *money.Money) string {
+        if m == nil {
+            return ""
+        }
+        return m.String()
+    }
+    records := [][]string{{"employee_id", "name", "currency", "previous_gross", "gross", "gross_change", "gross_change_percent",
+        "previous_net", "net", "net_change", "net_change_percent", "flags", "details"}}
+    for _, l := range r.Lines {
+        var flags, details []string
+        for _, a := range l.Anomalies {
+            flags = append(flags, a.Flag)
+            details = append(details, a.Detail)
+        }
+        records = append(records, []string{l.EmployeeID, l.Name, l.Currency,
+            amount(l.PreviousGross), amount(l.Gross), amount(l.GrossChange), l.GrossChangePercent,
+            amount(l.PreviousNet), amount(l.Net), amount(l.NetChange), l.NetChangePercent,
+            strings.Join(flags, ";"), strings.Join(details, "; ")})
+    }
+    return writeCSV(records)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestPayrollRunService_Variance(t *testing.T) {
+    ctx := context.Background()
+    svc, _ := newRunTestService(t)
+    // contributions are all deducted on the second cut-off
+    for _, r := range ContributionRules(loadTables(t), SplitSecond) {
+        svc.engine.AddRule(r)
+    }
+    p1, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-01", End: "2025-06-15"})
+    run1, err := svc.CreateRun(ctx, "clerk", p1.PeriodID)
+    if err != nil {
+        t.Fatalf("run 1: %v", err)
+    }
+    closeRun(t, svc, run1.RunID)
+
+    salary := func(amount float64) []interface{} {
+        return []interface{}{map[string]interface{}{"type": "salary", "amount": amount, "effective_date": "2025-01-01"}}
+    }
+    // E-1 gets a 50% raise, E-2 leaves and E-5 joins
+    _, _ = svc.employees.Update(ctx, "E-1", map[string]interface{}{"compensation_records": salary(45000)}, nil)
+    _, _ = svc.employees.Update(ctx, "E-2", map[string]interface{}{"termination_date": "2025-06-10"}, nil)
+    _, _ = svc.employees.Create(ctx, map[string]interface{}{"employee_id": "E-5", "hire_date": "2025-06-20", "compensation_records": salary(18000)})
+    _, _ = svc.employees.Create(ctx, map[string]interface{}{"employee_id": "E-6", "hire_date": "2025-07-01", "compensation_records": salary(18000)})
+
+    p2, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-06-16", End: "2025-06-30"})
+    run2, err := svc.CreateRun(ctx, "clerk", p2.PeriodID)
+    if err != nil {
+        t.Fatalf("run 2: %v", err)
+    }
+    // slips edited behind the engine's back: a payslip for a terminated and a
+    // not yet hired employee, and a negative net without contributions
+    slips, _ := svc.Payslips(ctx, run2.RunID)
+    for i := range slips {
+        if slips[i].EmployeeID == "E-5" {
+            slips[i].Net = money.MustParse("-25", "PHP")
+            slips[i].Lines = nil
+        }
+    }
+    slips = append(slips,
+        models.Payslip{EmployeeID: "E-3", RunID: run2.RunID, Currency: "PHP", Gross: money.MustParse("12500", "PHP"), Net: money.MustParse("12500", "PHP")},
+        models.Payslip{EmployeeID: "E-6", RunID: run2.RunID, Currency: "PHP", Gross: money.MustParse("9000", "PHP"), Net: money.MustParse("9000", "PHP")})
+    if err := svc.store.ReplacePayslips(ctx, run2.RunID, slips); err != nil {
+        t.Fatalf("replace: %v", err)
+    }
+
+    r, err := svc.Variance(ctx, run2.RunID, "")
+    if err != nil || r.PreviousRunID != run1.RunID || len(r.Lines) != 5 {
+        t.Fatalf("variance: %v %+v", err, r)
+    }
+    flags := map[string][]string{}
+    for _, l := range r.Lines {
+        for _, a := range l.Anomalies {
+            flags[l.EmployeeID] = append(flags[l.EmployeeID], a.Flag)
+        }
+    }
+    want := map[string]string{
+        "E-1": "gross_swing,net_swing",
+        "E-2": "dropped_employee",
+        "E-3": "new_employee,missing_contribution,missing_contribution,missing_contribution,terminated",
+        "E-5": "new_employee,negative_net,missing_contribution,missing_contribution,missing_contribution",
+        "E-6": "new_employee,missing_contribution,missing_contribution,missing_contribution,not_hired",
+    }
+    for id, w := range want {
+        if got := strings.Join(flags[id], ","); got != w {
+            t.Fatalf("%s flags: got %s, want %s", id, got, w)
+        }
+    }
+    if e1 := r.Lines[0]; e1.GrossChange.String() != "7500.00" || e1.GrossChangePercent != "50.0" || r.Anomalies != 18 {
+        t.Fatalf("E-1 line: %+v (%d anomalies)", e1, r.Anomalies)
+    }
+
+    // a raise under the thresholds is not a swing
+    if err := svc.SetVariancePolicy(VariancePolicy{Threshold: "0.6"}); err != nil {
+        t.Fatalf("policy: %v", err)
+    }
+    if r, _ := svc.Variance(ctx, run2.RunID, run1.RunID); len(r.Lines[0].Anomalies) != 0 {
+        t.Fatalf("E-1 flagged under 60%%: %+v", r.Lines[0].Anomalies)
+    }
+    if err := svc.SetVariancePolicy(VariancePolicy{MinChange: "-1"}); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("expected ErrInvalidPayrollRequest, got %v", err)
+    }
+    if _, err := svc.Variance(ctx, run2.RunID, run2.RunID); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("self comparison: %v", err)
+    }
+
+    content, err := VarianceCSV(r)
+    if err != nil {
+        t.Fatalf("csv: %v", err)
+    }
+    rows := strings.Split(strings.TrimSpace(string(content)), "\r\n")
+    if len(rows) != 6 || !strings.HasPrefix(rows[0], "employee_id,name,currency") || !strings.HasSuffix(rows[2], "dropped_employee,paid in "+run1.RunID) {
+        t.Fatalf("csv rows: %q", rows)
+    }
+
+    // submitting for review records the anomalies on the run
+    run, err := svc.Submit(ctx, "clerk", run2.RunID)
+    if err != nil || len(run.Anomalies) != 16 {
+        t.Fatalf("submit: %v %+v", err, run)
+    }
+
+    // the expectation follows the cut-off, not what other payslips carry
+    first := NewPayrollService(nil, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), ContributionRules(loadTables(t), SplitFirst)...)
+    if got := first.ExpectedContributions("", "2025-06-30"); len(got) != 0 {
+        t.Fatalf("second cut-off under a first cut-off split: %v", got)
+    }
+    if got := first.ExpectedContributions(FrequencyMonthly, "2025-06-30"); len(got) != 3 {
+        t.Fatalf("monthly: %v", got)
+    }
+}
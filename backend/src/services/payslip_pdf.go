@@ -0,0 +1,282 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    _ "embed"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "text/template"
+    "unicode/utf8"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "github.com/ronaldpalay/hris/src/pdf"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultPayslipTemplate lays out the payslip as text lines; lines starting
+// with "# " are set as the title and "## " as section headings.
+//
+//go:embed templates/payslip.tmpl
+var defaultPayslipTemplate string
+
+// ErrNoPayslipPassword is returned when payslips are password-protected but
+// the employee has no birth date or TIN to derive the password from.
+var ErrNoPayslipPassword = errors.New("payslip password needs the employee's birth_date and tin")
+
+// PayslipCompany is the employer header printed on payslips.
+type PayslipCompany struct {
+    Name    string
+    Address string
+    TIN     string
+}
+
+// PayslipYearToDate totals the employee's released payslips of the year up
+// to and including the one shown.
+type PayslipYearToDate struct {
+    Year                  string
+    Gross                 money.Money
+    Deductions            money.Money
+    Taxes                 money.Money
+    Net                   money.Money
+    EmployerContributions money.Money
+}
+
+// PayslipView is the data a payslip template renders.
+type PayslipView struct {
+    Company      PayslipCompany
+    EmployeeName string
+    Payslip      models.Payslip
+    Earnings     []models.PayslipLine
+    Deductions   []models.PayslipLine // deductions, contributions and taxes
+    Employer     []models.PayslipLine
+    YearToDate   PayslipYearToDate
+
+    password string
+}
+
+// ReleasedPayslips returns an employee's payslips from finalized and paid
+// runs, newest first. Draft and in-review payslips are not shown to
+// employees.
+func (s *PayrollRunService) ReleasedPayslips(ctx context.Context, employeeID string) ([]models.Payslip, error) {
+    closed, err := s.closedRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    slips, err := s.store.EmployeePayslips(ctx, employeeID)
+    if err != nil {
+        return nil, err
+    }
+    out := []models.Payslip{}
+    for _, p := range slips {
+        if closed[p.RunID] {
+            out = append(out, p)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].PeriodEnd != out[j].PeriodEnd {
+            return out[i].PeriodEnd > out[j].PeriodEnd
+        }
+        return out[i].PayslipID > out[j].PayslipID
+    })
+    return out, nil
+}
+
+// PayslipView prepares a released payslip of employeeID for rendering, with
+// year-to-date totals. Payslips of other employees or unreleased runs are
+// reported as mongo.ErrNoDocuments.
+func (s *PayrollRunService) PayslipView(ctx context.Context, employeeID, payslipID string) (*PayslipView, error) {
+    slips, err := s.ReleasedPayslips(ctx, employeeID)
+    if err != nil {
+        return nil, err
+    }
+    v := &PayslipView{}
+    found := false
+    for _, p := range slips {
+        if p.PayslipID == payslipID {
+            v.Payslip, found = p, true
+        }
+    }
+    if !found {
+        return nil, mongo.ErrNoDocuments
+    }
+    emp, err := s.employees.Get(ctx, employeeID)
+    if err != nil {
+        return nil, err
+    }
+    v.EmployeeName = employeeName(emp)
+    v.password = PayslipPassword(emp)
+    for _, l := range v.Payslip.Lines {
+        switch l.Kind {
+        case models.LineEarning:
+            v.Earnings = append(v.Earnings, l)
+        case models.LineDeduction, models.LineContribution, models.LineTax:
+            v.Deductions = append(v.Deductions, l)
+        case models.LineEmployer:
+            v.Employer = append(v.Employer, l)
+        }
+    }
+
+    cur := v.Payslip.Currency
+    ytd := PayslipYearToDate{Year: v.Payslip.PeriodEnd[:4]}
+    ytd.Gross, ytd.Deductions, ytd.Taxes, ytd.Net, ytd.EmployerContributions = money.Zero(cur), money.Zero(cur), money.Zero(cur), money.Zero(cur), money.Zero(cur)
+    for _, p := range slips {
+        if p.Currency != cur || !strings.HasPrefix(p.PeriodEnd, ytd.Year) || p.PeriodEnd > v.Payslip.PeriodEnd {
+            continue
+        }
+        ytd.Gross = ytd.Gross.Add(p.Gross)
+        ytd.Deductions = ytd.Deductions.Add(p.Deductions)
+        ytd.Taxes = ytd.Taxes.Add(p.Taxes)
+        ytd.Net = ytd.Net.Add(p.Net)
+        ytd.EmployerContributions = ytd.EmployerContributions.Add(p.EmployerContributions)
+    }
+    v.YearToDate = ytd
+    return v, nil
+}
+
+// employeeName prefers the preferred name, then the legal first and last
+// names, then the id.
+func employeeName(emp map[string]interface{}) string {
+    if n, _ := emp["preferred_name"].(string); n != "" {
+        return n
+    }
+    var parts []string
+    if legal, ok := emp["legal_name"].(map[string]interface{}); ok {
+        for _, k := range []string{"first", "middle", "last"} {
+            if s, _ := legal[k].(string); s != "" {
+                parts = append(parts, s)
+            }
+        }
+    }
+    if len(parts) == 0 {
+        id, _ := emp["employee_id"].(string)
+        return id
+    }
+    return strings.Join(parts, " ")
+}
+
+// PayslipPassword is the birth date as YYYYMMDD followed by the last four
+// digits of the TIN, or "" when either is missing.
+func PayslipPassword(emp map[string]interface{}) string {
+    birth, _ := emp["birth_date"].(string)
+    tin, _ := emp["tin"].(string)
+    birth = strings.ReplaceAll(birth, "-", "")
+    var digits []rune
+    for _, r := range tin {
+        if r >= '0' && r <= '9' {
+            digits = append(digits, r)
+        }
+    }
+    if len(birth) != 8 || len(digits) < 4 {
+        return ""
+    }
+    return birth + string(digits[len(digits)-4:])
+}
+
+// PayslipRenderer turns payslip views into PDFs through a text template.
+type PayslipRenderer struct {
+    company PayslipCompany
+    tmpl    *template.Template
+    protect bool
+}
+
+// NewPayslipRenderer parses tmpl (the embedded default when empty). With
+// protect set every PDF is encrypted with the employee's PayslipPassword.
+func NewPayslipRenderer(company PayslipCompany, tmpl string, protect bool) (*PayslipRenderer, error) {
+    if tmpl == "" {
+        tmpl = defaultPayslipTemplate
+    }
+    t, err := template.New("payslip").Funcs(reportFuncs).Parse(tmpl)
+    if err != nil {
+        return nil, fmt.Errorf("payslip template: %w", err)
+    }
+    return &PayslipRenderer{company: company, tmpl: t, protect: protect}, nil
+}
+
+// Protected reports whether rendered payslips are password-protected.
+func (r *PayslipRenderer) Protected() bool { return r.protect }
+
+// Render executes the template for v and writes the result as a PDF.
+func (r *PayslipRenderer) Render(v *PayslipView) ([]byte, error) {
+    password := ""
+    if r.protect {
+        if password = v.password; password == "" {
+            return nil, ErrNoPayslipPassword
+        }
+    }
+    v.Company = r.company
+    return templatePDF(r.tmpl, v, fmt.Sprintf("Payslip %s to %s", v.Payslip.PeriodStart, v.Payslip.PeriodEnd), password)
+}
+
+// reportFuncs are available to the payslip and certificate templates.
+var reportFuncs = template.FuncMap{
+    "left":   func(s string, n int) string { return padText(s, n, false) },
+    "right":  func(s string, n int) string { return padText(s, n, true) },
+    "amount": formatAmount,
+}
+
+// templatePDF executes tmpl for data and sets the text as a PDF; lines
+// starting with "# " become the title and "## " section headings.
+func templatePDF(tmpl *template.Template, data interface{}, title, password string) ([]byte, error) {
+    var text bytes.Buffer
+    if err := tmpl.Execute(&text, data); err != nil {
+        return nil, err
+    }
+    doc := &pdf.Document{Title: title}
+    for _, line := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+        switch {
+        case strings.HasPrefix(line, "## "):
+            doc.Add(strings.TrimPrefix(line, "## "), 0, true)
+        case strings.HasPrefix(line, "# "):
+            doc.Add(strings.TrimPrefix(line, "# "), 13, true)
+        default:
+            doc.Add(line, 0, false)
+        }
+    }
+    var out bytes.Buffer
+    if err := doc.Write(&out, password); err != nil {
+        return nil, err
+    }
+    return out.Bytes(), nil
+}
+
+// padText pads s with spaces to n characters, truncating longer text.
+func padText(s string, n int, alignRight bool) string {
+    if utf8.RuneCountInString(s) > n {
+        return string([]rune(s)[:n])
+    }
+    fill := strings.Repeat(" ", n-utf8.RuneCountInString(s))
+    if alignRight {
+        return fill + s
+    }
+    return s + fill
+}
+
+// formatAmount groups thousands: 1234567.5 → 1,234,567.50.
+func formatAmount(m money.Money) string {
+    s := m.String()
+    neg := strings.HasPrefix(s, "-")
+    s = strings.TrimPrefix(s, "-")
+    whole, frac := s, ""
+    if i := strings.IndexByte(s, '.'); i >= 0 {
+        whole, frac = s[:i], s[i:]
+    }
+    if _, err := strconv.Atoi(whole); err != nil {
+        return m.String()
+    }
+    var b strings.Builder
+    for i, r := range whole {
+        if i > 0 && (len(whole)-i)%3 == 0 {
+            b.WriteByte(',')
+        }
+        b.WriteRune(r)
+    }
+    if neg {
+        return "-" + b.String() + frac
+    }
+    return b.String() + frac
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestPayslipPassword(t *testing.T) {
+    emp := map[string]interface{}{"birth_date": "1990-04-07", "tin": "123-456-789-000"}
+    if got := PayslipPassword(emp); got != "199004079000" {
+        t.Fatalf("password: %q", got)
+    }
+    if got := PayslipPassword(map[string]interface{}{"birth_date": "1990-04-07"}); got != "" {
+        t.Fatalf("no tin: %q", got)
+    }
+}
+
+func TestPayrollRunService_PayslipPDF(t *testing.T) {
+    ctx := context.Background()
+    svc, _ := newRunTestService(t)
+    var runs []*models.PayrollRun
+    for _, span := range [][2]string{{"2025-06-01", "2025-06-15"}, {"2025-06-16", "2025-06-30"}} {
+        p, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: span[0], End: span[1]})
+        run, err := svc.CreateRun(ctx, "clerk", p.PeriodID)
+        if err != nil {
+            t.Fatalf("run: %v", err)
+        }
+        runs = append(runs, run)
+    }
+    closeRun(t, svc, runs[0].RunID)
+
+    // the second run is still a draft, so employees cannot see it yet
+    slips, _ := svc.ReleasedPayslips(ctx, "E-1")
+    if len(slips) != 1 {
+        t.Fatalf("released: %+v", slips)
+    }
+    if _, err := svc.PayslipView(ctx, "E-1", "ps-"+runs[1].RunID+"-E-1"); !errors.Is(err, mongo.ErrNoDocuments) {
+        t.Fatalf("draft payslip visible: %v", err)
+    }
+    // nor another employee's
+    if _, err := svc.PayslipView(ctx, "E-2", slips[0].PayslipID); !errors.Is(err, mongo.ErrNoDocuments) {
+        t.Fatalf("other employee's payslip visible: %v", err)
+    }
+
+    closeRun(t, svc, runs[1].RunID)
+    slips, _ = svc.ReleasedPayslips(ctx, "E-1")
+    v, err := svc.PayslipView(ctx, "E-1", slips[0].PayslipID)
+    if err != nil {
+        t.Fatalf("view: %v", err)
+    }
+    if !v.YearToDate.Gross.Equal(slips[0].Gross.Add(slips[1].Gross)) || len(v.Earnings) == 0 || len(v.Deductions) == 0 {
+        t.Fatalf("view: %+v", v)
+    }
+
+    plain, err := NewPayslipRenderer(PayslipCompany{Name: "Acme (PH) Inc."}, "", false)
+    if err != nil {
+        t.Fatalf("renderer: %v", err)
+    }
+    doc, err := plain.Render(v)
+    if err != nil || !bytes.HasPrefix(doc, []byte("%PDF-")) || !bytes.Contains(doc, []byte(`(Acme \(PH\) Inc.) Tj`)) || !bytes.Contains(doc, []byte("15,000.00")) {
+        t.Fatalf("render: %v %s", err, doc)
+    }
+
+    protected, _ := NewPayslipRenderer(PayslipCompany{Name: "Acme"}, "", true)
+    if _, err := protected.Render(v); !errors.Is(err, ErrNoPayslipPassword) {
+        t.Fatalf("expected ErrNoPayslipPassword, got %v", err)
+    }
+    _, _ = svc.employees.Update(ctx, "E-1", map[string]interface{}{"birth_date": "1990-04-07", "tin": "123-456-789-000"}, nil)
+    v, _ = svc.PayslipView(ctx, "E-1", slips[0].PayslipID)
+    doc, err = protected.Render(v)
+    if err != nil || !bytes.Contains(doc, []byte("/Encrypt")) || bytes.Contains(doc, []byte("Acme")) {
+        t.Fatalf("protected render: %v", err)
+    }
+
+    if _, err := NewPayslipRenderer(PayslipCompany{}, "{{.Missing", false); err == nil {
+        t.Fatalf("bad template accepted")
+    }
+}
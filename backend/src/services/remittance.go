@@ -0,0 +1,665 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/csv"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+    // ErrUnknownAgency is returned for an agency other than sss, philhealth or pagibig.
+    ErrUnknownAgency = errors.New("unknown agency; use sss, philhealth or pagibig")
+    // ErrAlreadyRemitted is returned when generating a report for a month
+    // that was already submitted.
+    ErrAlreadyRemitted = errors.New("contributions for the month were already remitted")
+    // ErrRemittanceState is returned when submitting a superseded or
+    // already submitted report.
+    ErrRemittanceState = errors.New("remittance status does not allow this action")
+)
+
+// agencySpec describes what an agency's report needs.
+type agencySpec struct {
+    label          string
+    report         string
+    idField        string // employee document field holding the member number
+    idDigits       int
+    employerDigits []int
+}
+
+var agencySpecs = map[string]agencySpec{
+    models.AgencySSS:        {label: "SSS", report: "R3", idField: "sss_number", idDigits: 10, employerDigits: []int{10, 13}},
+    models.AgencyPhilHealth: {label: "PhilHealth", report: "RF-1", idField: "philhealth_number", idDigits: 12, employerDigits: []int{12}},
+    models.AgencyPagIBIG:    {label: "Pag-IBIG", report: "MCRF", idField: "pagibig_number", idDigits: 12, employerDigits: []int{12}},
+}
+
+// RemittanceEmployer is the employer registration printed on the reports.
+type RemittanceEmployer struct {
+    Name             string
+    SSSNumber        string
+    PhilHealthNumber string
+    PagIBIGNumber    string
+}
+
+func (e RemittanceEmployer) number(agency string) string {
+    switch agency {
+    case models.AgencySSS:
+        return e.SSSNumber
+    case models.AgencyPhilHealth:
+        return e.PhilHealthNumber
+    }
+    return e.PagIBIGNumber
+}
+
+// RemittanceFilter selects remittances; empty fields match all.
+type RemittanceFilter struct {
+    Agency string
+    Month  string // YYYY-MM
+    Year   string // YYYY
+}
+
+func (f RemittanceFilter) match(r models.Remittance) bool {
+    return (f.Agency == "" || r.Agency == f.Agency) &&
+        (f.Month == "" || r.Month == f.Month) &&
+        (f.Year == "" || strings.HasPrefix(r.Month, f.Year+"-"))
+}
+
+// RemittanceStore persists generated and submitted remittance reports.
+type RemittanceStore interface {
+    Save(ctx context.Context, r *models.Remittance) error
+    Get(ctx context.Context, remittanceID string) (*models.Remittance, error)
+    List(ctx context.Context, f RemittanceFilter) ([]models.Remittance, error)
+}
+
+// RemittanceService produces the monthly SSS R3, PhilHealth RF-1 and
+// Pag-IBIG MCRF reports from finalized payroll runs and tracks which months
+// were remitted.
+type RemittanceService struct {
+    runs     *PayrollRunService
+    store    RemittanceStore
+    employer RemittanceEmployer
+    audit    AuditLog
+    now      func() time.Time
+}
+
+func NewRemittanceService(runs *PayrollRunService, store RemittanceStore, employer RemittanceEmployer, audit AuditLog) *RemittanceService {
+    return &RemittanceService{runs: runs, store: store, employer: employer, audit: audit, now: time.Now}
+}
+
+// RemittanceLine is one employee's contributions for the month.
+type RemittanceLine struct {
+    EmployeeID   string
+    Number       string // member number, digits only
+    LastName     string
+    FirstName    string
+    MiddleName   string
+    BirthDate    string
+    HireDate     string // set when hired within the month
+    Separation   string // set when separated within the month
+    Compensation money.Money
+    EE           money.Money
+    ER           money.Money
+    EC           money.Money // SSS employees' compensation
+}
+
+// remittanceMonth gathers the contributions of agency from the payslips of
+// finalized and paid runs whose period ends in month.
+func (s *RemittanceService) remittanceMonth(ctx context.Context, agency, month string, remitted map[string]bool) ([]RemittanceLine, []string, error) {
+    runs, err := s.runs.store.ListRuns(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+    var runIDs []string
+    byEmp := map[string]*RemittanceLine{}
+    zero := money.Zero(money.DefaultCurrency)
+    for _, r := range runs {
+        if (r.Status != models.RunFinalized && r.Status != models.RunPaid) || !strings.HasPrefix(r.PeriodEnd, month) || remitted[r.RunID] {
+            continue
+        }
+        slips, err := s.runs.store.ListPayslips(ctx, r.RunID)
+        if err != nil {
+            return nil, nil, err
+        }
+        counted := false
+        for _, p := range slips {
+            if p.Currency != money.DefaultCurrency {
+                continue
+            }
+            for _, l := range p.Lines {
+                share := strings.TrimPrefix(l.Code, agency+"_")
+                // only the contribution lines; loans and other codes sharing the prefix are not remitted here
+                if share == l.Code || (share != "ee" && share != "er" && share != "ec") || l.Amount.IsZero() {
+                    continue
+                }
+                line := byEmp[p.EmployeeID]
+                if line == nil {
+                    line = &RemittanceLine{EmployeeID: p.EmployeeID, Compensation: zero, EE: zero, ER: zero, EC: zero}
+                    byEmp[p.EmployeeID] = line
+                }
+                switch share {
+                case "ee":
+                    line.EE = line.EE.Add(l.Amount)
+                case "er":
+                    line.ER = line.ER.Add(l.Amount)
+                case "ec":
+                    line.EC = line.EC.Add(l.Amount)
+                }
+                if c, err := money.Parse(l.Inputs["monthly_compensation"], money.DefaultCurrency); err == nil {
+                    line.Compensation = c
+                }
+                counted = true
+            }
+        }
+        if counted {
+            runIDs = append(runIDs, r.RunID)
+        }
+    }
+    out := make([]RemittanceLine, 0, len(byEmp))
+    for _, l := range byEmp {
+        out = append(out, *l)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].EmployeeID < out[j].EmployeeID })
+    return out, runIDs, nil
+}
+
+// RemittanceFile is a generated report and its record.
+type RemittanceFile struct {
+    Remittance models.Remittance
+    Content    []byte
+}
+
+// Generate produces agency's report for month (YYYY-MM). Every employee
+// with contributions needs a valid member number and legal name, and the
+// employer number must be configured; all problems are reported together.
+// A new file supersedes earlier unsubmitted ones. Once a month is submitted,
+// only a supplementary report can follow: it covers the runs finalized since
+// (e.g. a final-pay run) and links to the latest submission.
+func (s *RemittanceService) Generate(ctx context.Context, actor, agency, month string) (*RemittanceFile, error) {
+    spec, ok := agencySpecs[agency]
+    if !ok {
+        return nil, fmt.Errorf("%w: %q", ErrUnknownAgency, agency)
+    }
+    m, err := time.Parse("2006-01", month)
+    if err != nil {
+        return nil, fmt.Errorf("%w: month must be YYYY-MM", ErrInvalidPayrollRequest)
+    }
+    previous, err := s.store.List(ctx, RemittanceFilter{Agency: agency, Month: month})
+    if err != nil {
+        return nil, err
+    }
+    var last *models.Remittance
+    submitted, remitted := 0, map[string]bool{}
+    for i, r := range previous {
+        if r.Status != models.RemittanceSubmitted {
+            continue
+        }
+        submitted++
+        for _, id := range r.RunIDs {
+            remitted[id] = true
+        }
+        if last == nil || r.SubmittedAt > last.SubmittedAt {
+            last = &previous[i]
+        }
+    }
+    lines, runIDs, err := s.remittanceMonth(ctx, agency, month, remitted)
+    if err != nil {
+        return nil, err
+    }
+    if last != nil && len(lines) == 0 {
+        return nil, fmt.Errorf("%w: %s %s reference %s", ErrAlreadyRemitted, spec.label, month, last.ReferenceNumber)
+    }
+
+    var problems []string
+    employerNo, ok := govNumber(s.employer.number(agency))
+    if !ok || !containsInt(spec.employerDigits, len(employerNo)) {
+        problems = append(problems, fmt.Sprintf("employer %s number is missing or invalid", spec.label))
+    }
+    if len(lines) == 0 {
+        problems = append(problems, fmt.Sprintf("no finalized %s contributions for %s", spec.label, month))
+    }
+    for i := range lines {
+        l := &lines[i]
+        emp, err := s.runs.employees.Get(ctx, l.EmployeeID)
+        if err != nil {
+            problems = append(problems, fmt.Sprintf("%s: employee record not found", l.EmployeeID))
+            continue
+        }
+        raw, _ := emp[spec.idField].(string)
+        number, ok := govNumber(raw)
+        switch {
+        case raw == "":
+            problems = append(problems, fmt.Sprintf("%s: no %s number", l.EmployeeID, spec.label))
+        case !ok || len(number) != spec.idDigits:
+            problems = append(problems, fmt.Sprintf("%s: %s number %q must have %d digits", l.EmployeeID, spec.label, raw, spec.idDigits))
+        }
+        l.Number = number
+        if legal, ok := emp["legal_name"].(map[string]interface{}); ok {
+            l.FirstName, _ = legal["first"].(string)
+            l.MiddleName, _ = legal["middle"].(string)
+            l.LastName, _ = legal["last"].(string)
+        }
+        if l.LastName == "" || l.FirstName == "" {
+            problems = append(problems, fmt.Sprintf("%s: legal first and last name required", l.EmployeeID))
+        }
+        l.BirthDate, _ = emp["birth_date"].(string)
+        if agency == models.AgencyPhilHealth && l.BirthDate == "" {
+            problems = append(problems, fmt.Sprintf("%s: birth date required", l.EmployeeID))
+        }
+        if d, _ := emp["hire_date"].(string); strings.HasPrefix(d, month) {
+            l.HireDate = d
+        }
+        if d, _ := emp["termination_date"].(string); strings.HasPrefix(d, month) {
+            l.Separation = d
+        }
+    }
+    if len(problems) > 0 {
+        return nil, &ExportValidationError{Problems: problems}
+    }
+
+    var content []byte
+    switch agency {
+    case models.AgencySSS:
+        content = s.writeR3(m, employerNo, lines)
+    case models.AgencyPhilHealth:
+        content, err = s.writeRF1(m, employerNo, lines)
+    default:
+        content, err = s.writeMCRF(m, employerNo, lines)
+    }
+    if err != nil {
+        return nil, err
+    }
+    sum := sha256.Sum256(content)
+    ext := "csv"
+    if agency == models.AgencySSS {
+        ext = "txt"
+    }
+    suffix, supplements := "", ""
+    if last != nil {
+        suffix, supplements = fmt.Sprintf("-S%d", submitted), last.RemittanceID
+    }
+    now := s.now()
+    rem := models.Remittance{
+        RemittanceID:  fmt.Sprintf("rem-%s-%s-%d", agency, m.Format("200601"), now.UnixNano()),
+        Agency:        agency,
+        Month:         month,
+        Status:        models.RemittanceGenerated,
+        Supplements:   supplements,
+        FileName:      fmt.Sprintf("%s-%s-%s%s.%s", strings.ReplaceAll(spec.report, "-", ""), employerNo, m.Format("200601"), suffix, ext),
+        Checksum:      hex.EncodeToString(sum[:]),
+        RunIDs:        runIDs,
+        Employees:     len(lines),
+        Currency:      money.DefaultCurrency,
+        EmployeeShare: money.Zero(money.DefaultCurrency),
+        EmployerShare: money.Zero(money.DefaultCurrency),
+        CreatedBy:     actor,
+        CreatedAt:     now.Unix(),
+    }
+    for _, l := range lines {
+        rem.EmployeeShare = rem.EmployeeShare.Add(l.EE)
+        rem.EmployerShare = rem.EmployerShare.Add(l.ER).Add(l.EC)
+    }
+    rem.Total = rem.EmployeeShare.Add(rem.EmployerShare)
+    for _, r := range previous {
+        if r.Status == models.RemittanceGenerated {
+            r.Status = models.RemittanceSuperseded
+            if err := s.store.Save(ctx, &r); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if err := s.store.Save(ctx, &rem); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "remittance.generate", rem.RemittanceID, map[string]interface{}{
+        "agency": agency, "month": month, "employees": rem.Employees, "total": rem.Total.String(), "checksum": rem.Checksum, "supplements": supplements,
+    }); err != nil {
+        return nil, err
+    }
+    return &RemittanceFile{Remittance: rem, Content: content}, nil
+}
+
+// Submit records that a generated report was filed and paid, with the
+// agency's reference number (SSS PRN, PhilHealth SPA/PRN, Pag-IBIG
+// receipt). paidOn defaults to today.
+func (s *RemittanceService) Submit(ctx context.Context, actor, remittanceID, reference, paidOn string) (*models.Remittance, error) {
+    reference = strings.TrimSpace(reference)
+    if reference == "" {
+        return nil, fmt.Errorf("%w: reference_number required", ErrInvalidPayrollRequest)
+    }
+    if paidOn == "" {
+        paidOn = s.now().Format("2006-01-02")
+    } else if _, err := time.Parse("2006-01-02", paidOn); err != nil {
+        return nil, fmt.Errorf("%w: paid_on must be YYYY-MM-DD", ErrInvalidPayrollRequest)
+    }
+    r, err := s.store.Get(ctx, remittanceID)
+    if err != nil {
+        return nil, err
+    }
+    if r.Status != models.RemittanceGenerated {
+        return nil, fmt.Errorf("%w: remittance is %s", ErrRemittanceState, r.Status)
+    }
+    r.Status = models.RemittanceSubmitted
+    r.ReferenceNumber, r.PaidOn = reference, paidOn
+    r.SubmittedBy, r.SubmittedAt = actor, s.now().Unix()
+    if err := s.store.Save(ctx, r); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "remittance.submit", remittanceID, map[string]interface{}{
+        "agency": r.Agency, "month": r.Month, "reference_number": reference, "paid_on": paidOn, "total": r.Total.String(),
+    }); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// List returns the recorded remittances, newest month first.
+func (s *RemittanceService) List(ctx context.Context, f RemittanceFilter) ([]models.Remittance, error) {
+    return s.store.List(ctx, f)
+}
+
+// RemittanceDue compares what finalized payroll owes an agency for a month
+// with what was submitted.
+type RemittanceDue struct {
+    Agency          string      `json:"agency"`
+    Month           string      `json:"month"`
+    Status          string      `json:"status"` // outstanding, generated or remitted
+    Due             money.Money `json:"due"`
+    Remitted        money.Money `json:"remitted"`
+    Outstanding     money.Money `json:"outstanding"`
+    RemittanceID    string      `json:"remittance_id,omitempty"`
+    ReferenceNumber string      `json:"reference_number,omitempty"`
+}
+
+// Outstanding lists, for each month of year with finalized contributions
+// and each agency, what is due and what was remitted. A month is remitted
+// only when a submission covers the full amount; contributions added later
+// (e.g. by a final-pay run) leave it outstanding again.
+func (s *RemittanceService) Outstanding(ctx context.Context, year int) ([]RemittanceDue, error) {
+    recorded, err := s.store.List(ctx, RemittanceFilter{Year: fmt.Sprintf("%04d", year)})
+    if err != nil {
+        return nil, err
+    }
+    out := []RemittanceDue{}
+    for month := 1; month <= 12; month++ {
+        ym := fmt.Sprintf("%04d-%02d", year, month)
+        for _, agency := range []string{models.AgencySSS, models.AgencyPhilHealth, models.AgencyPagIBIG} {
+            lines, _, err := s.remittanceMonth(ctx, agency, ym, nil)
+            if err != nil {
+                return nil, err
+            }
+            due := money.Zero(money.DefaultCurrency)
+            for _, l := range lines {
+                due = due.Add(l.EE).Add(l.ER).Add(l.EC)
+            }
+            d := RemittanceDue{Agency: agency, Month: ym, Status: "outstanding", Due: due, Remitted: money.Zero(money.DefaultCurrency)}
+            generated := false
+            for _, r := range recorded {
+                if r.Agency != agency || r.Month != ym {
+                    continue
+                }
+                switch r.Status {
+                case models.RemittanceSubmitted:
+                    d.Remitted = d.Remitted.Add(r.Total)
+                    d.RemittanceID, d.ReferenceNumber = r.RemittanceID, r.ReferenceNumber
+                case models.RemittanceGenerated:
+                    generated = true
+                    if d.ReferenceNumber == "" {
+                        d.RemittanceID = r.RemittanceID
+                    }
+                }
+            }
+            if due.IsZero() && d.Remitted.IsZero() {
+                continue
+            }
+            d.Outstanding = due.Sub(d.Remitted)
+            switch {
+            case d.Outstanding.IsZero():
+                d.Status = "remitted"
+            case generated && d.Remitted.IsZero():
+                d.Status = models.RemittanceGenerated
+            }
+            out = append(out, d)
+        }
+    }
+    return out, nil
+}
+
+// writeR3 lays out the SSS R3 contribution collection list as fixed-width
+// text: an employer header (00), one line per employee (20) with the social
+// security and EC amounts in the column of the month within the quarter,
+// and a totals trailer (99).
+func (s *RemittanceService) writeR3(month time.Time, employerNo string, lines []RemittanceLine) []byte {
+    col := (int(month.Month()) - 1) % 3
+    quarter := func(m money.Money, width int) string {
+        var b strings.Builder
+        for i := 0; i < 3; i++ {
+            v := "0.00"
+            if i == col {
+                v = m.Round(money.HalfEven).String()
+            }
+            b.WriteString(padText(v, width, true))
+        }
+        return b.String()
+    }
+    var b bytes.Buffer
+    b.WriteString("00" + padText(strings.ToUpper(s.employer.Name), 30, false) + month.Format("012006") + padText(employerNo, 13, false) + "\r\n")
+    ss, ec := money.Zero(money.DefaultCurrency), money.Zero(money.DefaultCurrency)
+    for _, l := range lines {
+        remark := padText("", 9, false)
+        switch {
+        case l.Separation != "":
+            remark = "1" + compactDate(l.Separation)
+        case l.HireDate != "":
+            remark = "N" + compactDate(l.HireDate)
+        }
+        mi := ""
+        if l.MiddleName != "" {
+            mi = string([]rune(strings.ToUpper(l.MiddleName))[:1])
+        }
+        b.WriteString("20" + padText(strings.ToUpper(l.LastName), 15, false) + padText(strings.ToUpper(l.FirstName), 15, false) + padText(mi, 1, false) +
+            l.Number + quarter(l.EE.Add(l.ER), 9) + quarter(l.EC, 7) + remark + "\r\n")
+        ss, ec = ss.Add(l.EE).Add(l.ER), ec.Add(l.EC)
+    }
+    b.WriteString("99" + quarter(ss, 13) + quarter(ec, 11) + "\r\n")
+    return b.Bytes()
+}
+
+// writeRF1 writes the PhilHealth RF-1 employer remittance report as CSV:
+// an employer line, column headings, one row per member and a total row.
+// Status is A (active), NH (new hire) or S (separated).
+func (s *RemittanceService) writeRF1(month time.Time, employerNo string, lines []RemittanceLine) ([]byte, error) {
+    records := [][]string{
+        {"RF-1", employerNo, strings.ToUpper(s.employer.Name), month.Format("01/2006")},
+        {"PHILHEALTH NO", "SURNAME", "GIVEN NAME", "MIDDLE NAME", "DATE OF BIRTH", "PS", "ES", "STATUS", "EFFECTIVITY DATE"},
+    }
+    ps, es := money.Zero(money.DefaultCurrency), money.Zero(money.DefaultCurrency)
+    for _, l := range lines {
+        status, effective := "A", ""
+        switch {
+        case l.Separation != "":
+            status, effective = "S", l.Separation
+        case l.HireDate != "":
+            status, effective = "NH", l.HireDate
+        }
+        records = append(records, []string{l.Number, strings.ToUpper(l.LastName), strings.ToUpper(l.FirstName), strings.ToUpper(l.MiddleName), l.BirthDate,
+            l.EE.Round(money.HalfEven).String(), l.ER.Round(money.HalfEven).String(), status, effective})
+        ps, es = ps.Add(l.EE), es.Add(l.ER)
+    }
+    records = append(records, []string{"TOTAL", "", "", "", "", ps.Round(money.HalfEven).String(), es.Round(money.HalfEven).String(), "", ""})
+    return writeCSV(records)
+}
+
+// writeMCRF writes the Pag-IBIG Membership Contribution Remittance Form as
+// CSV: an employer line, column headings, one row per member and a total
+// row.
+func (s *RemittanceService) writeMCRF(month time.Time, employerNo string, lines []RemittanceLine) ([]byte, error) {
+    period := month.Format("200601")
+    records := [][]string{
+        {"MCRF", employerNo, strings.ToUpper(s.employer.Name), period},
+        {"PAG-IBIG MID NO", "EMPLOYEE ID", "LAST NAME", "FIRST NAME", "MIDDLE NAME", "PERIOD COVERED", "MONTHLY COMPENSATION", "EE SHARE", "ER SHARE", "REMARKS"},
+    }
+    ee, er := money.Zero(money.DefaultCurrency), money.Zero(money.DefaultCurrency)
+    for _, l := range lines {
+        remark := ""
+        switch {
+        case l.Separation != "":
+            remark = "SEPARATED " + l.Separation
+        case l.HireDate != "":
+            remark = "NEW HIRE " + l.HireDate
+        }
+        records = append(records, []string{l.Number, l.EmployeeID, strings.ToUpper(l.LastName), strings.ToUpper(l.FirstName), strings.ToUpper(l.MiddleName), period,
+            l.Compensation.Round(money.HalfEven).String(), l.EE.Round(money.HalfEven).String(), l.ER.Round(money.HalfEven).String(), remark})
+        ee, er = ee.Add(l.EE), er.Add(l.ER)
+    }
+    records = append(records, []string{"TOTAL", "", "", "", "", "", "", ee.Round(money.HalfEven).String(), er.Round(money.HalfEven).String(), ""})
+    return writeCSV(records)
+}
+
+func writeCSV(records [][]string) ([]byte, error) {
+    var b bytes.Buffer
+    w := csv.NewWriter(&b)
+    w.UseCRLF = true
+    if err := w.WriteAll(records); err != nil {
+        return nil, err
+    }
+    return b.Bytes(), nil
+}
+
+// govNumber strips dashes and spaces from a government-issued number and
+// reports whether only digits remain.
+func govNumber(s string) (string, bool) {
+    n := strings.NewReplacer(" ", "", "-", "").Replace(s)
+    return n, n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// compactDate turns YYYY-MM-DD into MMDDYYYY.
+func compactDate(d string) string {
+    t, err := time.Parse("2006-01-02", d)
+    if err != nil {
+        return padText("", 8, false)
+    }
+    return t.Format("01022006")
+}
+
+func containsInt(list []int, n int) bool {
+    for _, v := range list {
+        if v == n {
+            return true
+        }
+    }
+    return false
+}
+
+func restoreRemittanceCurrency(r *models.Remittance) {
+    r.EmployeeShare = r.EmployeeShare.WithCurrency(r.Currency)
+    r.EmployerShare = r.EmployerShare.WithCurrency(r.Currency)
+    r.Total = r.Total.WithCurrency(r.Currency)
+}
+
+// InMemoryRemittanceStore keeps remittances in memory.
+type InMemoryRemittanceStore struct {
+    mu sync.Mutex
+    m  map[string]models.Remittance
+}
+
+func NewInMemoryRemittanceStore() *InMemoryRemittanceStore {
+    return &InMemoryRemittanceStore{m: map[string]models.Remittance{}}
+}
+
+func (s *InMemoryRemittanceStore) Save(ctx context.Context, r *models.Remittance) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    cp := *r
+    cp.RunIDs = append([]string(nil), r.RunIDs...)
+    s.m[r.RemittanceID] = cp
+    return nil
+}
+
+func (s *InMemoryRemittanceStore) Get(ctx context.Context, remittanceID string) (*models.Remittance, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r, ok := s.m[remittanceID]
+    if !ok {
+        return nil, mongo.ErrNoDocuments
+    }
+    r.RunIDs = append([]string(nil), r.RunIDs...)
+    return &r, nil
+}
+
+func (s *InMemoryRemittanceStore) List(ctx context.Context, f RemittanceFilter) ([]models.Remittance, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.Remittance{}
+    for _, r := range s.m {
+        if f.match(r) {
+            out = append(out, r)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Month != out[j].Month {
+            return out[i].Month > out[j].Month
+        }
+        return out[i].CreatedAt > out[j].CreatedAt
+    })
+    return out, nil
+}
+
+// MongoRemittanceStore stores remittances in MongoDB.
+type MongoRemittanceStore struct {
+    coll *mongo.Collection
+}
+
+func NewMongoRemittanceStore(coll *mongo.Collection) *MongoRemittanceStore {
+    return &MongoRemittanceStore{coll: coll}
+}
+
+func (s *MongoRemittanceStore) Save(ctx context.Context, r *models.Remittance) error {
+    _, err := s.coll.ReplaceOne(ctx, bson.M{"remittance_id": r.RemittanceID}, r, options.Replace().SetUpsert(true))
+    return err
+}
+
+func (s *MongoRemittanceStore) Get(ctx context.Context, remittanceID string) (*models.Remittance, error) {
+    var r models.Remittance
+    if err := s.coll.FindOne(ctx, bson.M{"remittance_id": remittanceID}).Decode(&r); err != nil {
+        return nil, err
+    }
+    restoreRemittanceCurrency(&r)
+    return &r, nil
+}
+
+func (s *MongoRemittanceStore) List(ctx context.Context, f RemittanceFilter) ([]models.Remittance, error) {
+    filter := bson.M{}
+    if f.Agency != "" {
+        filter["agency"] = f.Agency
+    }
+    if f.Month != "" {
+        filter["month"] = f.Month
+    } else if f.Year != "" {
+        filter["month"] = bson.M{"$gte": f.Year + "-01", "$lte": f.Year + "-12"}
+    }
+    cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "month", Value: -1}, {Key: "created_at", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+    out := []models.Remittance{}
+    if err := cur.All(ctx, &out); err != nil {
+        return nil, err
+    }
+    for i := range out {
+        restoreRemittanceCurrency(&out[i])
+    }
+    return out, nil
+}
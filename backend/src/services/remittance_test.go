@@ -0,0 +1,140 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestRemittanceService_GenerateAndSubmit(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{
+        "employee_id": "E-1", "legal_name": map[string]interface{}{"first": "Juan", "middle": "Santos", "last": "Dela Cruz"}, "birth_date": "1990-04-07",
+        "hire_date": "2020-01-06", "compensation_records": []interface{}{map[string]interface{}{"type": "salary", "amount": 30000.0, "effective_date": "2025-01-01"}},
+    })
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    engine := NewPayrollService(emps, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    runs := NewPayrollRunService(NewInMemoryPayrollRunStore(), emps, engine, NewInMemoryAuditLog(), nil)
+    for _, span := range [][2]string{{"2025-06-01", "2025-06-15"}, {"2025-06-16", "2025-06-30"}} {
+        p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: span[0], End: span[1]})
+        run, err := runs.CreateRun(ctx, "clerk", p.PeriodID)
+        if err != nil {
+            t.Fatalf("run: %v", err)
+        }
+        closeRun(t, runs, run.RunID)
+    }
+    // July is still a draft and not remitted yet
+    p, _ := runs.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-07-01", End: "2025-07-15"})
+    _, _ = runs.CreateRun(ctx, "clerk", p.PeriodID)
+
+    employer := RemittanceEmployer{Name: "Acme Inc.", SSSNumber: "03-1234567-8", PhilHealthNumber: "12-345678901-2", PagIBIGNumber: "2001-2345-6789"}
+    svc := NewRemittanceService(runs, NewInMemoryRemittanceStore(), employer, NewInMemoryAuditLog())
+
+    // member numbers are checked before anything is produced
+    _, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06")
+    var invalid *ExportValidationError
+    if !errors.As(err, &invalid) || len(invalid.Problems) != 1 || !strings.Contains(invalid.Problems[0], "no SSS number") {
+        t.Fatalf("expected missing SSS number, got %v", err)
+    }
+    _, _ = emps.Update(ctx, "E-1", map[string]interface{}{"sss_number": "34-1234567-8", "philhealth_number": "1234", "pagibig_number": "1210-9876-5432"}, nil)
+    if _, err := svc.Generate(ctx, "finance", models.AgencyPhilHealth, "2025-06"); !errors.As(err, &invalid) || !strings.Contains(invalid.Problems[0], "must have 12 digits") {
+        t.Fatalf("expected invalid PhilHealth number, got %v", err)
+    }
+    if _, err := svc.Generate(ctx, "finance", "bir", "2025-06"); !errors.Is(err, ErrUnknownAgency) {
+        t.Fatalf("expected ErrUnknownAgency, got %v", err)
+    }
+
+    r3, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06")
+    if err != nil {
+        t.Fatalf("r3: %v", err)
+    }
+    lines := strings.Split(strings.TrimSuffix(string(r3.Content), "\r\n"), "\r\n")
+    // June is the third month of the quarter: 1,500 employee + 3,000 employer share
+    if len(lines) != 3 || !strings.HasPrefix(lines[0], "00ACME INC.") || !strings.Contains(lines[0], "0620250312345678") ||
+        !strings.HasPrefix(lines[1], "20DELA CRUZ      JUAN           S3412345678     0.00     0.00  4500.00") {
+        t.Fatalf("r3:\n%s", r3.Content)
+    }
+    rem := r3.Remittance
+    if rem.Status != models.RemittanceGenerated || rem.Employees != 1 || rem.FileName != "R3-0312345678-202506.txt" || len(rem.RunIDs) != 2 ||
+        rem.EmployeeShare.String() != "1500.00" || !rem.Total.Equal(rem.EmployeeShare.Add(rem.EmployerShare)) {
+        t.Fatalf("r3 record: %+v", rem)
+    }
+
+    mcrf, err := svc.Generate(ctx, "finance", models.AgencyPagIBIG, "2025-06")
+    if err != nil {
+        t.Fatalf("mcrf: %v", err)
+    }
+    if !strings.Contains(string(mcrf.Content), "121098765432,E-1,DELA CRUZ,JUAN,SANTOS,202506,") {
+        t.Fatalf("mcrf:\n%s", mcrf.Content)
+    }
+
+    due, err := svc.Outstanding(ctx, 2025)
+    if err != nil || len(due) != 3 {
+        t.Fatalf("outstanding: %v %+v", err, due)
+    }
+    for _, d := range due {
+        want := map[string]string{models.AgencySSS: models.RemittanceGenerated, models.AgencyPhilHealth: "outstanding", models.AgencyPagIBIG: models.RemittanceGenerated}[d.Agency]
+        if d.Month != "2025-06" || d.Status != want || !d.Outstanding.Equal(d.Due) {
+            t.Fatalf("due: %+v", d)
+        }
+    }
+
+    // regenerating replaces the unsubmitted file
+    again, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06")
+    if err != nil || again.Remittance.Checksum != rem.Checksum {
+        t.Fatalf("regenerate: %v", err)
+    }
+    if _, err := svc.Submit(ctx, "finance", rem.RemittanceID, "PRN-1", ""); !errors.Is(err, ErrRemittanceState) {
+        t.Fatalf("superseded file submitted: %v", err)
+    }
+    if _, err := svc.Submit(ctx, "finance", again.Remittance.RemittanceID, " ", ""); !errors.Is(err, ErrInvalidPayrollRequest) {
+        t.Fatalf("reference required: %v", err)
+    }
+    sub, err := svc.Submit(ctx, "finance", again.Remittance.RemittanceID, "PRN-1", "2025-07-10")
+    if err != nil || sub.Status != models.RemittanceSubmitted || sub.ReferenceNumber != "PRN-1" {
+        t.Fatalf("submit: %v %+v", err, sub)
+    }
+    if _, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06"); !errors.Is(err, ErrAlreadyRemitted) {
+        t.Fatalf("expected ErrAlreadyRemitted, got %v", err)
+    }
+    due, _ = svc.Outstanding(ctx, 2025)
+    if d := due[0]; d.Agency != models.AgencySSS || d.Status != "remitted" || !d.Outstanding.IsZero() || d.ReferenceNumber != "PRN-1" {
+        t.Fatalf("remitted: %+v", d)
+    }
+    if list, _ := svc.List(ctx, RemittanceFilter{Agency: models.AgencySSS, Year: "2025"}); len(list) != 2 {
+        t.Fatalf("list: %+v", list)
+    }
+
+    // contributions finalized after the submission go on a supplementary report
+    late := models.PayrollRun{RunID: "run-final-pay", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-30", Status: models.RunFinalized}
+    _ = runs.store.SaveRun(ctx, &late)
+    _ = runs.store.ReplacePayslips(ctx, late.RunID, []models.Payslip{{EmployeeID: "E-1", RunID: late.RunID, Currency: "PHP", Lines: []models.PayslipLine{
+        {Code: "sss_ee", Amount: money.MustParse("25.00", "PHP")}, {Code: "sss_er", Amount: money.MustParse("50.00", "PHP")},
+    }}})
+    due, _ = svc.Outstanding(ctx, 2025)
+    if d := due[0]; d.Agency != models.AgencySSS || d.Status != "outstanding" || d.Outstanding.String() != "75.00" {
+        t.Fatalf("after late run: %+v", d)
+    }
+    sup, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06")
+    if err != nil {
+        t.Fatalf("supplementary: %v", err)
+    }
+    if r := sup.Remittance; r.Supplements != sub.RemittanceID || len(r.RunIDs) != 1 || r.RunIDs[0] != late.RunID || r.Total.String() != "75.00" || r.FileName != "R3-0312345678-202506-S1.txt" {
+        t.Fatalf("supplementary record: %+v", r)
+    }
+    if _, err := svc.Submit(ctx, "finance", sup.Remittance.RemittanceID, "PRN-2", "2025-07-20"); err != nil {
+        t.Fatalf("submit supplementary: %v", err)
+    }
+    due, _ = svc.Outstanding(ctx, 2025)
+    if d := due[0]; d.Status != "remitted" || !d.Outstanding.IsZero() {
+        t.Fatalf("after supplementary: %+v", d)
+    }
+    if _, err := svc.Generate(ctx, "finance", models.AgencySSS, "2025-06"); !errors.Is(err, ErrAlreadyRemitted) {
+        t.Fatalf("expected ErrAlreadyRemitted, got %v", err)
+    }
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// RetroRequest describes a back-dated change to carry into closed periods:
+// a salary record effective on Since (already saved on the employee) and/or
+// corrected attendance for specific pay periods.
+type RetroRequest struct {
+    EmployeeID string                       `json:"employee_id"`
+    Since      string                       `json:"since"`                // first affected date, YYYY-MM-DD
+    Attendance map[string]AttendanceSummary `json:"attendance,omitempty"` // by pay period id
+    Reason     string                       `json:"reason"`
+}
+
+// retroComponents are the figures compared between the original and the
+// recalculated payslip, with the adjustment each difference posts as.
+var retroComponents = []struct {
+    code, label, kind string
+    taxable           bool
+    sum               func(p *models.Payslip) money.Money
+}{
+    {"retro_pay", "Retro pay", models.LineEarning, true, func(p *models.Payslip) money.Money {
+        return sumPayslipLines(p, func(l models.PayslipLine) bool { return l.Kind == models.LineEarning && l.Taxable })
+    }},
+    {"retro_pay_nontaxable", "Retro pay (non-taxable)", models.LineEarning, false, func(p *models.Payslip) money.Money {
+        return sumPayslipLines(p, func(l models.PayslipLine) bool { return l.Kind == models.LineEarning && !l.Taxable })
+    }},
+    {"retro_contribution", "Retro contributions", models.LineDeduction, false, func(p *models.Payslip) money.Money {
+        return sumPayslipLines(p, func(l models.PayslipLine) bool { return l.Kind == models.LineContribution })
+    }},
+}
+
+// sumPayslipLines totals the period's own lines matching keep; adjustment
+// lines carried from earlier periods are left out.
+func sumPayslipLines(p *models.Payslip, keep func(models.PayslipLine) bool) money.Money {
+    total := money.Zero(p.Currency)
+    for _, l := range p.Lines {
+        if l.Inputs["adjustment_id"] == "" && keep(l) {
+            total = total.Add(l.Amount)
+        }
+    }
+    return total
+}
+
+// Retro recalculates every closed payslip of the employee from Since onward
+// and posts the differences as adjustments linked to the original payslips.
+// Originals are not modified. Differences already posted by earlier retro
+// calls are subtracted, so repeating a call posts nothing new. The earliest
+// draft run, if any, is regenerated to pick the adjustments up; otherwise
+// they wait for the next run.
+func (s *PayrollRunService) Retro(ctx context.Context, actor string, req RetroRequest) ([]models.PayrollAdjustment, error) {
+    if req.EmployeeID == "" || strings.TrimSpace(req.Reason) == "" {
+        return nil, fmt.Errorf("%w: employee_id and reason required", ErrInvalidAdjustment)
+    }
+    if _, err := time.Parse("2006-01-02", req.Since); err != nil {
+        return nil, fmt.Errorf("%w: since %v", ErrInvalidAdjustment, err)
+    }
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    slips, err := s.store.EmployeePayslips(ctx, req.EmployeeID)
+    if err != nil {
+        return nil, err
+    }
+    byRun := map[string]models.Payslip{}
+    for _, p := range slips {
+        byRun[p.RunID] = p
+    }
+    existing, err := s.store.ListAdjustments(ctx, AdjustmentFilter{EmployeeID: req.EmployeeID})
+    if err != nil {
+        return nil, err
+    }
+    posted := map[string]money.Money{} // payslip id + code
+    for _, a := range existing {
+        if a.Source == models.AdjustmentRetro {
+            k := a.PayslipID + "|" + a.Code
+            posted[k] = posted[k].Add(a.Amount)
+        }
+    }
+
+    var out []models.PayrollAdjustment
+    var draft *models.PayrollRun
+    for i := range runs {
+        run := &runs[i]
+        // off-cycle runs have no salary of their own to recompute
+        if !regularRun(run) {
+            continue
+        }
+        if run.Status == models.RunDraft && (draft == nil || run.PeriodStart < draft.PeriodStart) {
+            draft = run
+        }
+        if run.Status != models.RunFinalized && run.Status != models.RunPaid {
+            continue
+        }
+        orig, ok := byRun[run.RunID]
+        if !ok || orig.PeriodEnd < req.Since {
+            continue
+        }
+        att := orig.Attendance
+        if corrected, ok := req.Attendance[run.PeriodID]; ok {
+            att = &corrected
+        }
+        recalc, err := s.engine.Calculate(ctx, PayrollRequest{
+            EmployeeID: req.EmployeeID, PeriodStart: orig.PeriodStart, PeriodEnd: orig.PeriodEnd, Frequency: orig.Frequency, Attendance: att,
+        })
+        if errors.Is(err, ErrNoSalary) {
+            recalc = &models.Payslip{Currency: orig.Currency}
+        } else if err != nil {
+            return nil, fmt.Errorf("%s: %w", orig.PayslipID, err)
+        }
+        if recalc.Currency != orig.Currency {
+            return nil, fmt.Errorf("%w: %s was paid in %s, now %s", ErrInvalidAdjustment, orig.PayslipID, orig.Currency, recalc.Currency)
+        }
+        for _, c := range retroComponents {
+            diff := c.sum(recalc).Sub(c.sum(&orig)).Sub(posted[orig.PayslipID+"|"+c.code].WithCurrency(orig.Currency))
+            if diff.IsZero() {
+                continue
+            }
+            a, err := s.saveAdjustment(ctx, actor, run, models.PayrollAdjustment{
+                EmployeeID:  req.EmployeeID,
+                Code:        c.code,
+                Label:       fmt.Sprintf("%s %s to %s", c.label, orig.PeriodStart, orig.PeriodEnd),
+                Kind:        c.kind,
+                Amount:      diff,
+                Taxable:     c.taxable,
+                Reason:      req.Reason,
+                Source:      models.AdjustmentRetro,
+                PayslipID:   orig.PayslipID,
+                PeriodStart: orig.PeriodStart,
+                PeriodEnd:   orig.PeriodEnd,
+            })
+            if err != nil {
+                return nil, err
+            }
+            out = append(out, *a)
+        }
+    }
+    if len(out) > 0 && draft != nil {
+        if err := s.generate(ctx, draft); err != nil {
+            return nil, err
+        }
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_retro.compute", req.EmployeeID, map[string]interface{}{
+        "since": req.Since, "adjustments": len(out), "reason": req.Reason,
+    }); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+// RetroReportRow lists one employee's retro adjustments. Total is the net
+// effect on pay (earnings less deductions); Pending is the part not yet paid
+// by a finalized run.
+type RetroReportRow struct {
+    EmployeeID string                     `json:"employee_id"`
+    Total      money.Money                `json:"total"`
+    Pending    money.Money                `json:"pending"`
+    Items      []models.PayrollAdjustment `json:"items"`
+}
+
+// RetroReport returns retro adjustments per employee for corrected periods
+// within [from, to]; empty arguments match everything.
+func (s *PayrollRunService) RetroReport(ctx context.Context, employeeID, from, to string) ([]RetroReportRow, error) {
+    adjs, err := s.store.ListAdjustments(ctx, AdjustmentFilter{EmployeeID: employeeID})
+    if err != nil {
+        return nil, err
+    }
+    rows := map[string]*RetroReportRow{}
+    for _, a := range adjs {
+        if a.Source != models.AdjustmentRetro || (from != "" && a.PeriodEnd < from) || (to != "" && a.PeriodStart > to) {
+            continue
+        }
+        r, ok := rows[a.EmployeeID]
+        if !ok {
+            r = &RetroReportRow{EmployeeID: a.EmployeeID}
+            rows[a.EmployeeID] = r
+        }
+        effect := a.Amount
+        if a.Kind == models.LineDeduction {
+            effect = effect.Neg()
+        }
+        r.Total = r.Total.Add(effect)
+        if a.AppliedRunID == "" {
+            r.Pending = r.Pending.Add(effect)
+        }
+        r.Items = append(r.Items, a)
+    }
+    out := make([]RetroReportRow, 0, len(rows))
+    for _, r := range rows {
+        sort.Slice(r.Items, func(i, j int) bool { return r.Items[i].PeriodStart < r.Items[j].PeriodStart })
+        out = append(out, *r)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].EmployeeID < out[j].EmployeeID })
+    return out, nil
+}
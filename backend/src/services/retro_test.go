@@ -0,0 +1,96 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestPayrollRunService_RetroSalaryAndAttendance(t *testing.T) {
+    ctx := context.Background()
+    emps := NewInMemoryEmployeeRepo()
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-1", "compensation_records": []interface{}{
+        map[string]interface{}{"type": "salary", "amount": 30000.0, "effective_date": "2025-01-01"},
+    }})
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    engine := NewPayrollService(emps, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+    svc := NewPayrollRunService(NewInMemoryPayrollRunStore(), emps, engine, NewInMemoryAuditLog(), nil)
+
+    var closed []*models.PayrollRun
+    for _, span := range [][2]string{{"2025-06-01", "2025-06-15"}, {"2025-06-16", "2025-06-30"}} {
+        p, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: span[0], End: span[1]})
+        run, err := svc.CreateRun(ctx, "clerk", p.PeriodID)
+        if err != nil {
+            t.Fatalf("run: %v", err)
+        }
+        closeRun(t, svc, run.RunID)
+        closed = append(closed, run)
+    }
+    original, _ := svc.Payslips(ctx, closed[0].RunID)
+    july, _ := svc.CreatePeriod(ctx, "clerk", models.PayPeriod{Start: "2025-07-01", End: "2025-07-15"})
+    draft, _ := svc.CreateRun(ctx, "clerk", july.PeriodID)
+
+    // a raise to 33,000 is entered late, back-dated to June
+    emp, _ := emps.Get(ctx, "E-1")
+    recs := append(emp["compensation_records"].([]interface{}), map[string]interface{}{"type": "salary", "amount": 33000.0, "effective_date": "2025-06-01"})
+    _, _ = emps.Update(ctx, "E-1", map[string]interface{}{"compensation_records": recs}, nil)
+
+    if _, err := svc.Retro(ctx, "clerk", RetroRequest{EmployeeID: "E-1", Since: "2025-06-01"}); !errors.Is(err, ErrInvalidAdjustment) {
+        t.Fatalf("reason required: %v", err)
+    }
+    adjs, err := svc.Retro(ctx, "clerk", RetroRequest{EmployeeID: "E-1", Since: "2025-06-01", Reason: "June salary increase"})
+    if err != nil {
+        t.Fatalf("retro: %v", err)
+    }
+    // per half: 1,500 more basic; SSS +75 and PhilHealth +37.50 employee share
+    if len(adjs) != 4 {
+        t.Fatalf("expected pay and contribution differences for two periods, got %+v", adjs)
+    }
+    for _, a := range adjs {
+        want := map[string]string{"retro_pay": "1500.00", "retro_contribution": "112.50"}[a.Code]
+        if a.Amount.String() != want || a.Source != models.AdjustmentRetro || a.PayslipID == "" {
+            t.Fatalf("adjustment: %+v", a)
+        }
+    }
+    if again, _ := svc.Retro(ctx, "clerk", RetroRequest{EmployeeID: "E-1", Since: "2025-06-01", Reason: "repeat"}); len(again) != 0 {
+        t.Fatalf("repeating retro must not double-post: %+v", again)
+    }
+
+    // attendance correction: one absence on the first cut-off
+    adjs, err = svc.Retro(ctx, "clerk", RetroRequest{
+        EmployeeID: "E-1", Since: "2025-06-01", Reason: "missed absence",
+        Attendance: map[string]AttendanceSummary{closed[0].PeriodID: {AbsentDays: 1}},
+    })
+    if err != nil || len(adjs) != 1 || adjs[0].Amount.String() != "-1517.24" {
+        t.Fatalf("attendance retro: %v %+v", err, adjs)
+    }
+
+    // originals are untouched
+    after, _ := svc.Payslips(ctx, closed[0].RunID)
+    if !after[0].Gross.Equal(original[0].Gross) || len(after[0].Lines) != len(original[0].Lines) {
+        t.Fatalf("original payslip changed")
+    }
+    // the open draft picked up the differences with links back
+    slips, _ := svc.Payslips(ctx, draft.RunID)
+    linked := 0
+    for _, l := range slips[0].Lines {
+        if l.Inputs["original_payslip_id"] != "" {
+            linked++
+        }
+    }
+    if linked != 5 {
+        t.Fatalf("expected 5 retro lines in the draft, got %d: %+v", linked, slips[0].Lines)
+    }
+
+    report, err := svc.RetroReport(ctx, "", "2025-06-01", "2025-06-30")
+    if err != nil || len(report) != 1 || len(report[0].Items) != 5 {
+        t.Fatalf("report: %v %+v", err, report)
+    }
+    // 3,000 − 225 − 1,517.24
+    if report[0].Total.String() != "1257.76" || !report[0].Pending.Equal(report[0].Total) {
+        t.Fatalf("report totals: %s pending %s", report[0].Total, report[0].Pending)
+    }
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+    "sort"
+    "strings"
+)
+
+// Canonical HRIS roles (see research.md "Roles").
+const (
+    RoleAdmin     = "admin"
+    RoleHR        = "hr"
+    RoleManager   = "manager"
+    RolePayroll   = "payroll"
+    RoleEmployee  = "employee"
+    RoleRecruiter = "recruiter"
+)
+
+// RoleMapper turns identity-provider attributes (groups, memberOf, ...) into
+// HRIS roles. Every external login method (SAML, OIDC) goes through the same
+// mapper so a group grants the same roles regardless of how the user signed in.
+type RoleMapper struct {
+    // Attributes lists the attribute names whose values are looked up in Mapping.
+    Attributes []string
+    // Mapping maps an attribute value to the HRIS roles it grants.
+    Mapping map[string][]string
+    // Default roles are granted to every successfully authenticated user.
+    Default []string
+}
+
+// ParseRoleMapping parses "group=role1|role2;other=role3" into a mapping.
+// The split is on the last "=" so LDAP DNs can be used as group names.
+func ParseRoleMapping(spec string) map[string][]string {
+    out := map[string][]string{}
+    for _, pair := range strings.Split(spec, ";") {
+        pair = strings.TrimSpace(pair)
+        i := strings.LastIndex(pair, "=")
+        if i <= 0 {
+            continue
+        }
+        k, v := pair[:i], pair[i+1:]
+        for _, r := range strings.Split(v, "|") {
+            if r = strings.TrimSpace(r); r != "" {
+                out[k] = append(out[k], r)
+            }
+        }
+    }
+    return out
+}
+
+// Map returns the sorted, de-duplicated roles granted by attrs.
+func (m *RoleMapper) Map(attrs map[string][]string) []string {
+    set := map[string]bool{}
+    if m == nil {
+        return []string{}
+    }
+    for _, r := range m.Default {
+        set[r] = true
+    }
+    for _, name := range m.Attributes {
+        for _, v := range attrs[name] {
+            for _, r := range m.Mapping[v] {
+                set[r] = true
+            }
+        }
+    }
+    out := make([]string, 0, len(set))
+    for r := range set {
+        out = append(out, r)
+    }
+    sort.Strings(out)
+    return out
+}
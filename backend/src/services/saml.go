@@ -0,0 +1,383 @@
+package services
+
+import (
+    "bytes"
+    "compress/flate"
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+    nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+    samlStatusOK    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+    samlBindingPOST = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+    samlBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// ErrInvalidSAMLResponse is returned for any response that fails validation.
+var ErrInvalidSAMLResponse = errors.New("invalid saml response")
+
+// SAMLConfig configures the HRIS as a SAML 2.0 service provider.
+type SAMLConfig struct {
+    EntityID       string // SP entity ID, usually the metadata URL
+    ACSURL         string // assertion consumer service (HTTP-POST)
+    Certificate    *x509.Certificate
+    PrivateKey     *rsa.PrivateKey
+    IdPEntityID    string // expected Issuer; empty skips the check
+    IdPSSOURL      string // IdP single sign-on endpoint (HTTP-Redirect)
+    IdPCertificate *x509.Certificate
+    RoleMapper     *RoleMapper
+    // AllowIdPInitiated accepts unsolicited responses (no InResponseTo).
+    AllowIdPInitiated bool
+    ClockSkew         time.Duration
+}
+
+// SAMLAssertion is the validated identity extracted from a SAML response.
+type SAMLAssertion struct {
+    NameID       string
+    SessionIndex string
+    Attributes   map[string][]string
+    Roles        []string
+}
+
+// SAMLServiceProvider issues signed AuthnRequests and validates IdP responses.
+type SAMLServiceProvider struct {
+    cfg     SAMLConfig
+    mu      sync.Mutex
+    pending map[string]time.Time // outstanding AuthnRequest IDs -> expiry
+    seen    map[string]time.Time // consumed assertion IDs -> expiry
+    now     func() time.Time
+}
+
+func NewSAMLServiceProvider(cfg SAMLConfig) (*SAMLServiceProvider, error) {
+    if cfg.EntityID == "" || cfg.ACSURL == "" {
+        return nil, errors.New("saml: entity id and acs url required")
+    }
+    if cfg.Certificate == nil || cfg.PrivateKey == nil {
+        return nil, errors.New("saml: sp certificate and key required")
+    }
+    if cfg.IdPCertificate == nil || cfg.IdPSSOURL == "" {
+        return nil, errors.New("saml: idp certificate and sso url required")
+    }
+    if cfg.ClockSkew == 0 {
+        cfg.ClockSkew = 2 * time.Minute
+    }
+    return &SAMLServiceProvider{cfg: cfg, pending: map[string]time.Time{}, seen: map[string]time.Time{}, now: time.Now}, nil
+}
+
+// ParseCertificatePEM decodes the first CERTIFICATE block in data.
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+    for {
+        var b *pem.Block
+        b, data = pem.Decode(data)
+        if b == nil {
+            return nil, errors.New("no certificate found")
+        }
+        if b.Type == "CERTIFICATE" {
+            return x509.ParseCertificate(b.Bytes)
+        }
+    }
+}
+
+// ParseRSAPrivateKeyPEM decodes a PKCS#1 or PKCS#8 RSA private key.
+func ParseRSAPrivateKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+    b, _ := pem.Decode(data)
+    if b == nil {
+        return nil, errors.New("no private key found")
+    }
+    if k, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+        return k, nil
+    }
+    k, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+    if err != nil {
+        return nil, err
+    }
+    rk, ok := k.(*rsa.PrivateKey)
+    if !ok {
+        return nil, errors.New("private key is not RSA")
+    }
+    return rk, nil
+}
+
+// Metadata returns the SP metadata document for the IdP administrator.
+func (sp *SAMLServiceProvider) Metadata() []byte {
+    cert := base64.StdEncoding.EncodeToString(sp.cfg.Certificate.Raw)
+    var b strings.Builder
+    b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+    fmt.Fprintf(&b, `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="%s" entityID="%s">`, nsDSig, escapeC14NAttr(sp.cfg.EntityID))
+    fmt.Fprintf(&b, `<md:SPSSODescriptor AuthnRequestsSigned="true" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`, nsSAMLProtocol)
+    fmt.Fprintf(&b, `<md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`, cert)
+    b.WriteString(`<md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified</md:NameIDFormat>`)
+    fmt.Fprintf(&b, `<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`, samlBindingPOST, escapeC14NAttr(sp.cfg.ACSURL))
+    b.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+    return []byte(b.String())
+}
+
+// AuthnRequestURL builds a signed HTTP-Redirect binding URL that starts a login at the IdP.
+func (sp *SAMLServiceProvider) AuthnRequestURL(relayState string) (string, error) {
+    id, err := newSAMLID()
+    if err != nil {
+        return "", err
+    }
+    now := sp.now().UTC()
+    req := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s"><saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+        nsSAMLProtocol, nsSAMLAssertion, id, now.Format(time.RFC3339), escapeC14NAttr(sp.cfg.IdPSSOURL),
+        escapeC14NAttr(sp.cfg.ACSURL), samlBindingPOST, escapeC14NText(sp.cfg.EntityID))
+
+    var zbuf bytes.Buffer
+    zw, err := flate.NewWriter(&zbuf, flate.BestCompression)
+    if err != nil {
+        return "", err
+    }
+    if _, err := zw.Write([]byte(req)); err != nil {
+        return "", err
+    }
+    if err := zw.Close(); err != nil {
+        return "", err
+    }
+    // the redirect binding signs the exact query string, in this order
+    q := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(zbuf.Bytes()))
+    if relayState != "" {
+        q += "&RelayState=" + url.QueryEscape(relayState)
+    }
+    q += "&SigAlg=" + url.QueryEscape(algRSASHA256)
+    h := sha256.Sum256([]byte(q))
+    sig, err := rsa.SignPKCS1v15(rand.Reader, sp.cfg.PrivateKey, crypto.SHA256, h[:])
+    if err != nil {
+        return "", err
+    }
+    q += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig))
+
+    sp.mu.Lock()
+    sp.prune(now)
+    sp.pending[id] = now.Add(10 * time.Minute)
+    sp.mu.Unlock()
+
+    sep := "?"
+    if strings.Contains(sp.cfg.IdPSSOURL, "?") {
+        sep = "&"
+    }
+    return sp.cfg.IdPSSOURL + sep + q, nil
+}
+
+// ParseResponse validates a base64 SAMLResponse posted to the ACS and returns
+// the asserted identity. Only data inside the verified signature is used.
+func (sp *SAMLServiceProvider) ParseResponse(samlResponse string) (*SAMLAssertion, error) {
+    raw, err := decodeBase64Text(samlResponse)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+    }
+    a, err := sp.validate(raw)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+    }
+    return a, nil
+}
+
+func (sp *SAMLServiceProvider) validate(raw []byte) (*SAMLAssertion, error) {
+    root, err := parseXMLTree(raw)
+    if err != nil {
+        return nil, err
+    }
+    if !root.is(nsSAMLProtocol, "Response") {
+        return nil, errors.New("not a samlp:Response")
+    }
+    if d := root.attr("Destination"); d != "" && d != sp.cfg.ACSURL {
+        return nil, errors.New("wrong destination")
+    }
+    status := root.child(nsSAMLProtocol, "Status")
+    if status == nil {
+        return nil, errors.New("status missing")
+    }
+    if sc := status.child(nsSAMLProtocol, "StatusCode"); sc == nil || sc.attr("Value") != samlStatusOK {
+        return nil, errors.New("idp reported failure")
+    }
+    assertions := root.childElements(nsSAMLAssertion, "Assertion")
+    if len(assertions) != 1 {
+        return nil, errors.New("exactly one unencrypted assertion required")
+    }
+    as := assertions[0]
+
+    // reject duplicate IDs so a signature cannot be moved onto a forged element
+    ids := map[string]int{}
+    root.walk(func(n *xmlNode) {
+        if id := n.attr("ID"); id != "" {
+            ids[id]++
+        }
+    })
+    for id, c := range ids {
+        if c > 1 {
+            return nil, fmt.Errorf("duplicate ID %q", id)
+        }
+    }
+    signed := false
+    if root.child(nsDSig, "Signature") != nil {
+        if err := verifyEnvelopedSignature(root, sp.cfg.IdPCertificate); err != nil {
+            return nil, fmt.Errorf("response signature: %w", err)
+        }
+        signed = true
+    }
+    if as.child(nsDSig, "Signature") != nil {
+        if err := verifyEnvelopedSignature(as, sp.cfg.IdPCertificate); err != nil {
+            return nil, fmt.Errorf("assertion signature: %w", err)
+        }
+        signed = true
+    }
+    if !signed {
+        return nil, errors.New("response is not signed")
+    }
+
+    if sp.cfg.IdPEntityID != "" {
+        if iss := as.child(nsSAMLAssertion, "Issuer"); iss == nil || iss.text() != sp.cfg.IdPEntityID {
+            return nil, errors.New("unexpected issuer")
+        }
+    }
+    now := sp.now().UTC()
+    if cond := as.child(nsSAMLAssertion, "Conditions"); cond != nil {
+        if err := sp.checkWindow(now, cond.attr("NotBefore"), cond.attr("NotOnOrAfter")); err != nil {
+            return nil, err
+        }
+        for _, ar := range cond.childElements(nsSAMLAssertion, "AudienceRestriction") {
+            ok := false
+            for _, aud := range ar.childElements(nsSAMLAssertion, "Audience") {
+                if aud.text() == sp.cfg.EntityID {
+                    ok = true
+                }
+            }
+            if !ok {
+                return nil, errors.New("audience mismatch")
+            }
+        }
+    }
+
+    subject := as.child(nsSAMLAssertion, "Subject")
+    if subject == nil {
+        return nil, errors.New("subject missing")
+    }
+    nameID := subject.child(nsSAMLAssertion, "NameID")
+    if nameID == nil || nameID.text() == "" {
+        return nil, errors.New("NameID missing")
+    }
+    inResponseTo := root.attr("InResponseTo")
+    bearer := false
+    for _, sc := range subject.childElements(nsSAMLAssertion, "SubjectConfirmation") {
+        if sc.attr("Method") != samlBearer {
+            continue
+        }
+        scd := sc.child(nsSAMLAssertion, "SubjectConfirmationData")
+        if scd == nil {
+            continue
+        }
+        if r := scd.attr("Recipient"); r != sp.cfg.ACSURL {
+            continue
+        }
+        if err := sp.checkWindow(now, scd.attr("NotBefore"), scd.attr("NotOnOrAfter")); err != nil {
+            continue
+        }
+        if irt := scd.attr("InResponseTo"); irt != "" {
+            if inResponseTo != "" && inResponseTo != irt {
+                continue
+            }
+            inResponseTo = irt
+        }
+        bearer = true
+        break
+    }
+    if !bearer {
+        return nil, errors.New("no valid bearer subject confirmation")
+    }
+
+    sp.mu.Lock()
+    defer sp.mu.Unlock()
+    sp.prune(now)
+    if inResponseTo != "" {
+        if _, ok := sp.pending[inResponseTo]; !ok {
+            return nil, errors.New("unknown or expired request id")
+        }
+    } else if !sp.cfg.AllowIdPInitiated {
+        return nil, errors.New("unsolicited response")
+    }
+    asID := as.attr("ID")
+    if asID == "" {
+        return nil, errors.New("assertion ID missing")
+    }
+    if _, replay := sp.seen[asID]; replay {
+        return nil, errors.New("assertion already used")
+    }
+    sp.seen[asID] = now.Add(time.Hour)
+    delete(sp.pending, inResponseTo)
+
+    out := &SAMLAssertion{NameID: nameID.text(), Attributes: map[string][]string{}}
+    if stmt := as.child(nsSAMLAssertion, "AuthnStatement"); stmt != nil {
+        out.SessionIndex = stmt.attr("SessionIndex")
+    }
+    for _, st := range as.childElements(nsSAMLAssertion, "AttributeStatement") {
+        for _, at := range st.childElements(nsSAMLAssertion, "Attribute") {
+            name := at.attr("Name")
+            for _, v := range at.childElements(nsSAMLAssertion, "AttributeValue") {
+                out.Attributes[name] = append(out.Attributes[name], v.text())
+            }
+        }
+    }
+    out.Roles = sp.cfg.RoleMapper.Map(out.Attributes)
+    return out, nil
+}
+
+// checkWindow validates optional NotBefore/NotOnOrAfter bounds with clock skew.
+func (sp *SAMLServiceProvider) checkWindow(now time.Time, notBefore, notOnOrAfter string) error {
+    if notBefore != "" {
+        t, err := time.Parse(time.RFC3339, notBefore)
+        if err != nil {
+            return errors.New("invalid NotBefore")
+        }
+        if now.Add(sp.cfg.ClockSkew).Before(t) {
+            return errors.New("assertion not yet valid")
+        }
+    }
+    if notOnOrAfter != "" {
+        t, err := time.Parse(time.RFC3339, notOnOrAfter)
+        if err != nil {
+            return errors.New("invalid NotOnOrAfter")
+        }
+        if !now.Add(-sp.cfg.ClockSkew).Before(t) {
+            return errors.New("assertion expired")
+        }
+    }
+    return nil
+}
+
+// prune drops expired request and assertion IDs. Caller holds sp.mu.
+func (sp *SAMLServiceProvider) prune(now time.Time) {
+    for id, exp := range sp.pending {
+        if now.After(exp) {
+            delete(sp.pending, id)
+        }
+    }
+    for id, exp := range sp.seen {
+        if now.After(exp) {
+            delete(sp.seen, id)
+        }
+    }
+}
+
+// newSAMLID returns an xs:ID-safe random identifier.
+func newSAMLID() (string, error) {
+    b := make([]byte, 20)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return "_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+    "bytes"
+    "compress/flate"
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+const (
+    testACS    = "https://hris.test/api/auth/saml/acs"
+    testEntity = "https://hris.test/api/auth/saml/metadata"
+    testIdP    = "https://idp.test/saml"
+)
+
+func newTestKeyPair(t *testing.T, cn string) (*rsa.PrivateKey, *x509.Certificate) {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("generate key: %v", err)
+    }
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject:      pkix.Name{CommonName: cn},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatalf("create cert: %v", err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatalf("parse cert: %v", err)
+    }
+    return key, cert
+}
+
+func newTestSP(t *testing.T) (*SAMLServiceProvider, *rsa.PrivateKey) {
+    t.Helper()
+    spKey, spCert := newTestKeyPair(t, "hris-sp")
+    idpKey, idpCert := newTestKeyPair(t, "idp")
+    sp, err := NewSAMLServiceProvider(SAMLConfig{
+        EntityID:       testEntity,
+        ACSURL:         testACS,
+        Certificate:    spCert,
+        PrivateKey:     spKey,
+        IdPEntityID:    testIdP,
+        IdPSSOURL:      testIdP + "/sso",
+        IdPCertificate: idpCert,
+        RoleMapper:     &RoleMapper{Attributes: []string{"groups"}, Mapping: ParseRoleMapping("hr-staff=hr;payroll-team=payroll|employee"), Default: []string{RoleEmployee}},
+    })
+    if err != nil {
+        t.Fatalf("new sp: %v", err)
+    }
+    return sp, idpKey
+}
+
+// startLogin issues an AuthnRequest and returns its ID.
+func startLogin(t *testing.T, sp *SAMLServiceProvider) string {
+    t.Helper()
+    u, err := sp.AuthnRequestURL("")
+    if err != nil {
+        t.Fatalf("authn request: %v", err)
+    }
+    pu, _ := url.Parse(u)
+    raw, _ := base64.StdEncoding.DecodeString(pu.Query().Get("SAMLRequest"))
+    xmlBytes, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+    if err != nil {
+        t.Fatalf("inflate: %v", err)
+    }
+    n, err := parseXMLTree(xmlBytes)
+    if err != nil {
+        t.Fatalf("parse authn request: %v", err)
+    }
+    return n.attr("ID")
+}
+
+func testResponse(inResponseTo, assertionID string, notOnOrAfter time.Time) string {
+    now := time.Now().UTC().Format(time.RFC3339)
+    exp := notOnOrAfter.UTC().Format(time.RFC3339)
+    return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_resp1" Version="2.0" IssueInstant="%[1]s" Destination="%[3]s" InResponseTo="%[4]s">`+
+        `<saml:Issuer>%[5]s</saml:Issuer><samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>`+
+        `<saml:Assertion ID="%[6]s" Version="2.0" IssueInstant="%[1]s"><saml:Issuer>%[5]s</saml:Issuer>`+
+        `<saml:Subject><saml:NameID>juan.delacruz@agency.gov.ph</saml:NameID><saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="%[4]s" NotOnOrAfter="%[2]s" Recipient="%[3]s"/></saml:SubjectConfirmation></saml:Subject>`+
+        `<saml:Conditions NotBefore="%[1]s" NotOnOrAfter="%[2]s"><saml:AudienceRestriction><saml:Audience>%[7]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+        `<saml:AuthnStatement AuthnInstant="%[1]s" SessionIndex="_sess1"/>`+
+        `<saml:AttributeStatement><saml:Attribute Name="groups"><saml:AttributeValue>payroll-team</saml:AttributeValue><saml:AttributeValue>unmapped</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>`+
+        `</saml:Assertion></samlp:Response>`, now, exp, testACS, inResponseTo, testIdP, assertionID, testEntity)
+}
+
+// signAssertion inserts an enveloped signature into the assertion with the given ID.
+func signAssertion(t *testing.T, doc, assertionID string, key *rsa.PrivateKey) string {
+    t.Helper()
+    root, err := parseXMLTree([]byte(doc))
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    var as *xmlNode
+    root.walk(func(n *xmlNode) {
+        if n.attr("ID") == assertionID {
+            as = n
+        }
+    })
+    digest := sha256.Sum256(as.canonicalize(nil))
+    signedInfo := fmt.Sprintf(`<ds:SignedInfo><ds:CanonicalizationMethod Algorithm="%s"/><ds:SignatureMethod Algorithm="%s"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/></ds:Transforms><ds:DigestMethod Algorithm="%s"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+        algExcC14N, algRSASHA256, assertionID, algEnveloped, algExcC14N, algSHA256, base64.StdEncoding.EncodeToString(digest[:]))
+    sigDoc, err := parseXMLTree([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo + `</ds:Signature>`))
+    if err != nil {
+        t.Fatalf("parse signature: %v", err)
+    }
+    h := sha256.Sum256(sigDoc.child(nsDSig, "SignedInfo").canonicalize(nil))
+    sv, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+    if err != nil {
+        t.Fatalf("sign: %v", err)
+    }
+    sig := `<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo + `<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sv) + `</ds:SignatureValue></ds:Signature>`
+    // the signature goes right after the assertion's Issuer
+    marker := `<saml:Assertion ID="` + assertionID + `"`
+    i := strings.Index(doc, marker)
+    j := i + strings.Index(doc[i:], "</saml:Issuer>") + len("</saml:Issuer>")
+    return doc[:j] + sig + doc[j:]
+}
+
+func TestSAML_MetadataAndSignedAuthnRequest(t *testing.T) {
+    sp, _ := newTestSP(t)
+    md := string(sp.Metadata())
+    for _, want := range []string{`entityID="` + testEntity + `"`, `AuthnRequestsSigned="true"`, `Location="` + testACS + `"`, "<ds:X509Certificate>"} {
+        if !strings.Contains(md, want) {
+            t.Fatalf("metadata missing %q", want)
+        }
+    }
+    u, err := sp.AuthnRequestURL("/dashboard")
+    if err != nil {
+        t.Fatalf("authn request: %v", err)
+    }
+    pu, _ := url.Parse(u)
+    q := pu.Query()
+    signed := "SAMLRequest=" + url.QueryEscape(q.Get("SAMLRequest")) + "&RelayState=" + url.QueryEscape(q.Get("RelayState")) + "&SigAlg=" + url.QueryEscape(q.Get("SigAlg"))
+    sig, _ := base64.StdEncoding.DecodeString(q.Get("Signature"))
+    h := sha256.Sum256([]byte(signed))
+    if err := rsa.VerifyPKCS1v15(&sp.cfg.PrivateKey.PublicKey, crypto.SHA256, h[:], sig); err != nil {
+        t.Fatalf("authn request signature invalid: %v", err)
+    }
+}
+
+func TestSAML_ParseSignedResponse(t *testing.T) {
+    sp, idpKey := newTestSP(t)
+    reqID := startLogin(t, sp)
+    doc := signAssertion(t, testResponse(reqID, "_a1", time.Now().Add(5*time.Minute)), "_a1", idpKey)
+    a, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)))
+    if err != nil {
+        t.Fatalf("parse response: %v", err)
+    }
+    if a.NameID != "juan.delacruz@agency.gov.ph" || a.SessionIndex != "_sess1" {
+        t.Fatalf("unexpected assertion: %+v", a)
+    }
+    if strings.Join(a.Roles, ",") != "employee,payroll" {
+        t.Fatalf("unexpected roles: %v", a.Roles)
+    }
+    // the same assertion cannot be replayed
+    if _, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc))); err == nil {
+        t.Fatalf("expected replay to be rejected")
+    }
+}
+
+func TestSAML_RejectsInvalidResponses(t *testing.T) {
+    sp, idpKey := newTestSP(t)
+    otherKey, _ := newTestKeyPair(t, "attacker")
+
+    cases := map[string]func(reqID string) string{
+        "unsigned": func(reqID string) string {
+            return testResponse(reqID, "_a2", time.Now().Add(5*time.Minute))
+        },
+        "wrong key": func(reqID string) string {
+            return signAssertion(t, testResponse(reqID, "_a3", time.Now().Add(5*time.Minute)), "_a3", otherKey)
+        },
+        "tampered": func(reqID string) string {
+            doc := signAssertion(t, testResponse(reqID, "_a4", time.Now().Add(5*time.Minute)), "_a4", idpKey)
+            return strings.Replace(doc, "juan.delacruz", "admin", 1)
+        },
+        "expired": func(reqID string) string {
+            return signAssertion(t, testResponse(reqID, "_a5", time.Now().Add(-10*time.Minute)), "_a5", idpKey)
+        },
+        "unknown request": func(reqID string) string {
+            return signAssertion(t, testResponse("_not-issued", "_a6", time.Now().Add(5*time.Minute)), "_a6", idpKey)
+        },
+    }
+    for name, build := range cases {
+        doc := build(startLogin(t, sp))
+        _, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doc)))
+        if !errors.Is(err, ErrInvalidSAMLResponse) {
+            t.Fatalf("%s: expected ErrInvalidSAMLResponse, got %v", name, err)
+        }
+    }
+}
+
+func TestRoleMapper_Map(t *testing.T) {
+    m := &RoleMapper{Attributes: []string{"memberOf"}, Mapping: ParseRoleMapping("cn=hr,ou=groups=hr; cn=admins,ou=groups=admin|hr")}
+    got := m.Map(map[string][]string{"memberOf": {"cn=admins,ou=groups"}, "other": {"cn=hr,ou=groups"}})
+    if strings.Join(got, ",") != "admin,hr" {
+        t.Fatalf("unexpected roles: %v", got)
+    }
+}
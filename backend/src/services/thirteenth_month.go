@@ -0,0 +1,228 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// thirteenthMonthCodes are the payslip lines that make up basic salary
+// earned for the 13th month (PD 851): basic pay less absences and tardiness.
+var thirteenthMonthCodes = map[string]bool{"basic": true, "absences": true, "tardiness": true}
+
+// ThirteenthMonthPay is an employee's 13th-month entitlement for a year: one
+// twelfth of the basic salary earned from January (or the hire date) to
+// Through (or the separation date).
+type ThirteenthMonthPay struct {
+    EmployeeID  string      `json:"employee_id"`
+    Year        int         `json:"year"`
+    From        string      `json:"from"`
+    Through     string      `json:"through"`
+    BasicEarned money.Money `json:"basic_earned"` // from finalized and paid payslips
+    PaidThrough string      `json:"paid_through,omitempty"`
+    Projected   money.Money `json:"projected"` // salary for days after PaidThrough at the current rate
+    Entitlement money.Money `json:"entitlement"`
+    AlreadyPaid money.Money `json:"already_paid"`
+    Due         money.Money `json:"due"`
+}
+
+// adjustment is the payslip entry paying the amount due.
+func (tm *ThirteenthMonthPay) adjustment() AdjustmentInput {
+    return AdjustmentInput{
+        Code:         "thirteenth_month",
+        Label:        fmt.Sprintf("13th month pay %d", tm.Year),
+        Kind:         models.LineEarning,
+        Amount:       tm.Due,
+        OtherBenefit: true,
+    }
+}
+
+// ThirteenthMonth computes the 13th-month pay of an employee for the year of
+// through. New hires count from their hire date and leavers up to their
+// termination date; amounts already paid on closed 13th-month or final-pay
+// payslips of the year are deducted from the entitlement.
+func (s *PayrollRunService) ThirteenthMonth(ctx context.Context, employeeID, through string) (*ThirteenthMonthPay, error) {
+    end, err := time.Parse("2006-01-02", through)
+    if err != nil {
+        return nil, fmt.Errorf("%w: through %v", ErrInvalidPayrollRequest, err)
+    }
+    emp, err := s.employees.Get(ctx, employeeID)
+    if err != nil {
+        return nil, err
+    }
+    tm := &ThirteenthMonthPay{EmployeeID: employeeID, Year: end.Year(), From: fmt.Sprintf("%d-01-01", end.Year()), Through: through}
+    if hire, _ := emp["hire_date"].(string); hire > tm.From {
+        tm.From = hire
+    }
+    if term, _ := emp["termination_date"].(string); term != "" && term < tm.Through {
+        tm.Through = term
+    }
+
+    closed, err := s.closedRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    slips, err := s.store.EmployeePayslips(ctx, employeeID)
+    if err != nil {
+        return nil, err
+    }
+    prefix := strconv.Itoa(tm.Year) + "-"
+    cur := ""
+    for _, p := range slips {
+        if !closed[p.RunID] || !strings.HasPrefix(p.PeriodEnd, prefix) {
+            continue
+        }
+        cur = p.Currency
+        for _, l := range p.Lines {
+            switch {
+            case l.Code == "thirteenth_month":
+                tm.AlreadyPaid = tm.AlreadyPaid.Add(l.Amount)
+            case thirteenthMonthCodes[l.Code] && l.Inputs["adjustment_id"] == "" && p.PeriodEnd <= tm.Through:
+                tm.BasicEarned = tm.BasicEarned.Add(l.Amount)
+                if p.PeriodEnd > tm.PaidThrough {
+                    tm.PaidThrough = p.PeriodEnd
+                }
+            }
+        }
+    }
+
+    // salary not yet paid by a closed run is projected at the current rate
+    start := tm.From
+    if tm.PaidThrough >= start {
+        start = addDays(tm.PaidThrough, 1)
+    }
+    if start <= tm.Through {
+        monthly, _, err := s.engine.Rates(ctx, employeeID, start, tm.Through)
+        switch {
+        case errors.Is(err, ErrNoSalary):
+        case err != nil:
+            return nil, err
+        default:
+            cur = monthly.Currency()
+            tm.Projected = projectBasic(monthly, start, tm.Through)
+        }
+    }
+    tm.BasicEarned = tm.BasicEarned.WithCurrency(cur)
+    tm.Projected = tm.Projected.WithCurrency(cur)
+    tm.AlreadyPaid = tm.AlreadyPaid.WithCurrency(cur)
+    tm.Entitlement = tm.BasicEarned.Add(tm.Projected).Div(12, money.HalfEven).Round(money.HalfEven)
+    tm.Due = tm.Entitlement.Sub(tm.AlreadyPaid).Max(money.Zero(cur))
+    return tm, nil
+}
+
+// CreateThirteenthMonthRun starts a draft off-cycle run paying the 13th
+// month of year to every employee on payroll during it, projected to
+// 31 December. payDate defaults to 24 December, the statutory deadline.
+func (s *PayrollRunService) CreateThirteenthMonthRun(ctx context.Context, actor string, year int, payDate, frequency string) (*models.PayrollRun, error) {
+    if year < 2000 || year > 9999 {
+        return nil, fmt.Errorf("%w: year %d", ErrInvalidPayrollRequest, year)
+    }
+    if payDate == "" {
+        payDate = fmt.Sprintf("%d-12-24", year)
+    }
+    if d, err := time.Parse("2006-01-02", payDate); err != nil || d.Year() != year {
+        return nil, fmt.Errorf("%w: pay_date must be a date in %d", ErrInvalidPayrollRequest, year)
+    }
+    if frequency == "" {
+        frequency = FrequencySemiMonthly
+    }
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for _, r := range runs {
+        // a later run for the same year pays only the difference, once the earlier one is closed
+        if r.Type == models.RunThirteenthMonth && r.Year == year && r.Status != models.RunFinalized && r.Status != models.RunPaid {
+            return nil, ErrRunExists
+        }
+    }
+    now := s.now()
+    run := &models.PayrollRun{
+        RunID:       fmt.Sprintf("run-%d", now.UnixNano()),
+        Type:        models.RunThirteenthMonth,
+        Year:        year,
+        PeriodStart: fmt.Sprintf("%d-01-01", year),
+        PeriodEnd:   payDate,
+        Frequency:   frequency,
+        PayDate:     payDate,
+        Status:      models.RunDraft,
+        CreatedBy:   actor,
+        CreatedAt:   now.Unix(),
+    }
+    if err := s.generate(ctx, run); err != nil {
+        return nil, err
+    }
+    if err := recordAudit(ctx, s.audit, actor, "payroll_run.create", run.RunID, map[string]interface{}{"type": run.Type, "year": year}); err != nil {
+        return nil, err
+    }
+    return run, nil
+}
+
+// projectBasic is the salary at monthly for [from, to]: half a month for each
+// 1–15 or 16–end-of-month cut-off, pro-rated by calendar days for partly
+// covered cut-offs.
+func projectBasic(monthly money.Money, from, to string) money.Money {
+    total := money.Zero(monthly.Currency())
+    d, err := time.Parse("2006-01-02", from)
+    if err != nil {
+        return total
+    }
+    for date := d.Format("2006-01-02"); date <= to; {
+        cutStart, cutEnd := semiMonthlyCutOff(date)
+        last := cutEnd
+        if to < last {
+            last = to
+        }
+        covered := daysBetween(date, last) + 1
+        total = total.Add(monthly.MulRatio(covered, 2*(daysBetween(cutStart, cutEnd)+1), money.HalfEven))
+        date = addDays(cutEnd, 1)
+    }
+    return total.Round(money.HalfEven)
+}
+
+// semiMonthlyCutOff returns the 1–15 or 16–end-of-month span containing date.
+func semiMonthlyCutOff(date string) (string, string) {
+    d, _ := time.Parse("2006-01-02", date)
+    first := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+    if d.Day() <= 15 {
+        return first.Format("2006-01-02"), first.AddDate(0, 0, 14).Format("2006-01-02")
+    }
+    return first.AddDate(0, 0, 15).Format("2006-01-02"), first.AddDate(0, 1, -1).Format("2006-01-02")
+}
+
+// closedRuns returns the ids of finalized and paid runs.
+func (s *PayrollRunService) closedRuns(ctx context.Context) (map[string]bool, error) {
+    runs, err := s.store.ListRuns(ctx)
+    if err != nil {
+        return nil, err
+    }
+    closed := map[string]bool{}
+    for _, r := range runs {
+        if r.Status == models.RunFinalized || r.Status == models.RunPaid {
+            closed[r.RunID] = true
+        }
+    }
+    return closed, nil
+}
+
+// addDays shifts a YYYY-MM-DD date; invalid dates are returned unchanged.
+func addDays(date string, n int) string {
+    d, err := time.Parse("2006-01-02", date)
+    if err != nil {
+        return date
+    }
+    return d.AddDate(0, 0, n).Format("2006-01-02")
+}
+
+// daysBetween returns the calendar days from a to b.
+func daysBetween(a, b string) int64 {
+    da, _ := time.Parse("2006-01-02", a)
+    db, _ := time.Parse("2006-01-02", b)
+    return int64(db.Sub(da).Hours() / 24)
+}
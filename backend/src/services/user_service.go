@@ -0,0 +1,335 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "strings"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+    // ErrUnknownRole is returned when a role is not one of the canonical roles.
+    ErrUnknownRole = errors.New("unknown role")
+    // ErrSelfModification prevents admins from locking themselves out.
+    ErrSelfModification = errors.New("cannot suspend, delete or demote your own account")
+    // ErrEmployeeNotFound is returned when linking to a missing employee record.
+    ErrEmployeeNotFound = errors.New("employee not found")
+    // ErrEmployeeAlreadyLinked is returned when another account owns the employee record.
+    ErrEmployeeAlreadyLinked = errors.New("employee already linked to another account")
+    // ErrSAMLAlreadyLinked is returned when another account owns the IdP identity.
+    ErrSAMLAlreadyLinked = errors.New("saml identity already linked to another account")
+    // ErrAccountSuspended is returned for sessions of a suspended account.
+    ErrAccountSuspended = errors.New("account suspended")
+)
+
+// SAMLUserPrefix namespaces the accounts provisioned for IdP identities not
+// linked to a local account.
+const SAMLUserPrefix = "saml:"
+
+var canonicalRoles = map[string]bool{
+    RoleAdmin: true, RoleHR: true, RoleManager: true, RolePayroll: true, RoleEmployee: true, RoleRecruiter: true,
+}
+
+// UserFilter narrows a user listing. Empty fields match everything; Query is
+// a case-insensitive substring match on username and email.
+type UserFilter struct {
+    Role       string
+    Status     string
+    EmployeeID string
+    Query      string
+}
+
+// UserService implements admin account management on top of an AuthStore.
+// Every change is written to the audit log.
+type UserService struct {
+    store     AuthStore
+    employees EmployeeRepo
+    audit     AuditLog
+}
+
+func NewUserService(store AuthStore, employees EmployeeRepo, audit AuditLog) *UserService {
+    return &UserService{store: store, employees: employees, audit: audit}
+}
+
+// List returns accounts sorted by username, filtered and paginated like
+// EmployeeService.List. `page` is 1-based.
+func (s *UserService) List(ctx context.Context, page, perPage int, f UserFilter) ([]models.UserAccount, int, error) {
+    users, err := s.store.ListUsers(ctx)
+    if err != nil {
+        return nil, 0, err
+    }
+    q := strings.ToLower(strings.TrimSpace(f.Query))
+    filtered := []models.UserAccount{}
+    for _, u := range users {
+        if f.Role != "" && !hasRole(u.Roles, f.Role) {
+            continue
+        }
+        if f.Status != "" && userStatus(u) != f.Status {
+            continue
+        }
+        if f.EmployeeID != "" && u.EmployeeID != f.EmployeeID {
+            continue
+        }
+        if q != "" && !strings.Contains(strings.ToLower(u.Username), q) && !strings.Contains(strings.ToLower(u.Email), q) {
+            continue
+        }
+        u.Status = userStatus(u)
+        filtered = append(filtered, u)
+    }
+    sort.Slice(filtered, func(i, j int) bool { return filtered[i].Username < filtered[j].Username })
+    total := len(filtered)
+    if perPage <= 0 {
+        perPage = 20
+    }
+    if page <= 0 {
+        page = 1
+    }
+    start := (page - 1) * perPage
+    if start >= total {
+        return []models.UserAccount{}, total, nil
+    }
+    end := start + perPage
+    if end > total {
+        end = total
+    }
+    return filtered[start:end], total, nil
+}
+
+// Get returns the account or mongo.ErrNoDocuments.
+func (s *UserService) Get(ctx context.Context, username string) (*models.UserAccount, error) {
+    u, err := s.store.GetUser(ctx, username)
+    if err != nil {
+        return nil, err
+    }
+    u.Status = userStatus(*u)
+    return u, nil
+}
+
+// ActiveRoles returns the stored roles of username so sessions pick up role
+// changes and suspensions without waiting for their token to expire.
+func (s *UserService) ActiveRoles(ctx context.Context, username string) ([]string, error) {
+    u, err := s.store.GetUser(ctx, username)
+    if err != nil {
+        return nil, err
+    }
+    if suspended(u.Status) {
+        return nil, ErrAccountSuspended
+    }
+    return u.Roles, nil
+}
+
+// SetRoles replaces the roles of username. An admin cannot drop their own
+// admin role.
+func (s *UserService) SetRoles(ctx context.Context, actor, username string, roles []string) error {
+    if err := ValidateRoles(roles); err != nil {
+        return err
+    }
+    if actor == username && !hasRole(roles, RoleAdmin) {
+        return ErrSelfModification
+    }
+    u, err := s.store.GetUser(ctx, username)
+    if err != nil {
+        return err
+    }
+    roles = append([]string{}, roles...)
+    sort.Strings(roles)
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{Roles: &roles}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.roles", username, map[string]interface{}{"from": u.Roles, "to": roles})
+}
+
+// SetEmail changes the address used for password resets.
+func (s *UserService) SetEmail(ctx context.Context, actor, username, email string) error {
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{Email: &email}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.email", username, nil)
+}
+
+// CanLinkEmployee checks that username may be linked to employeeID: the
+// employee record exists and no other account owns it. The account itself
+// need not exist yet.
+func (s *UserService) CanLinkEmployee(ctx context.Context, username, employeeID string) error {
+    if _, err := s.employees.Get(ctx, employeeID); err == mongo.ErrNoDocuments {
+        return ErrEmployeeNotFound
+    } else if err != nil {
+        return err
+    }
+    users, err := s.store.ListUsers(ctx)
+    if err != nil {
+        return err
+    }
+    for _, u := range users {
+        if u.EmployeeID == employeeID && u.Username != username {
+            return ErrEmployeeAlreadyLinked
+        }
+    }
+    return nil
+}
+
+// LinkEmployee ties username to an employee record; an empty employeeID
+// removes the link. An employee record belongs to at most one account.
+func (s *UserService) LinkEmployee(ctx context.Context, actor, username, employeeID string) error {
+    if employeeID != "" {
+        if err := s.CanLinkEmployee(ctx, username, employeeID); err != nil {
+            return err
+        }
+    }
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{EmployeeID: &employeeID}); err != nil {
+        return err
+    }
+    action := "user.link_employee"
+    if employeeID == "" {
+        action = "user.unlink_employee"
+    }
+    return recordAudit(ctx, s.audit, actor, action, username, map[string]interface{}{"employee_id": employeeID})
+}
+
+// LinkSAML lets the IdP identity nameID sign in as username; an empty
+// nameID removes the link. An identity belongs to at most one account.
+func (s *UserService) LinkSAML(ctx context.Context, actor, username, nameID string) error {
+    if nameID != "" {
+        if u, err := s.bySAMLNameID(ctx, nameID); err == nil && u.Username != username {
+            return ErrSAMLAlreadyLinked
+        } else if err != nil && err != mongo.ErrNoDocuments {
+            return err
+        }
+    }
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{SAMLNameID: &nameID}); err != nil {
+        return err
+    }
+    action := "user.link_saml"
+    if nameID == "" {
+        action = "user.unlink_saml"
+    }
+    return recordAudit(ctx, s.audit, actor, action, username, map[string]interface{}{"saml_name_id": nameID})
+}
+
+// SAMLAccount returns the account an IdP identity signs in as: the one
+// linked to nameID or, when none is, an account provisioned as
+// SAMLUserPrefix+nameID. Provisioned accounts have no password and take
+// their roles from the IdP on every login; linked accounts keep their own.
+func (s *UserService) SAMLAccount(ctx context.Context, nameID string, roles []string) (*models.UserAccount, error) {
+    if nameID == "" {
+        return nil, mongo.ErrNoDocuments
+    }
+    u, err := s.bySAMLNameID(ctx, nameID)
+    if err == mongo.ErrNoDocuments {
+        username := SAMLUserPrefix + nameID
+        err = s.store.CreateSAMLUser(ctx, username, nameID, roles)
+        if err == nil {
+            if err := recordAudit(ctx, s.audit, "saml", "user.saml_provision", username, map[string]interface{}{"roles": roles}); err != nil {
+                return nil, err
+            }
+            return s.Get(ctx, username)
+        }
+        if err != ErrSAMLAlreadyLinked {
+            return nil, err
+        }
+        // a concurrent first login provisioned it; otherwise an account
+        // already holds the name without the link
+        if u, err = s.bySAMLNameID(ctx, nameID); err == mongo.ErrNoDocuments {
+            return nil, ErrSAMLAlreadyLinked
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+    if strings.HasPrefix(u.Username, SAMLUserPrefix) && !sameRoles(u.Roles, roles) {
+        if err := s.store.UpdateUser(ctx, u.Username, UserUpdate{Roles: &roles}); err != nil {
+            return nil, err
+        }
+        if err := recordAudit(ctx, s.audit, "saml", "user.roles", u.Username, map[string]interface{}{"from": u.Roles, "to": roles}); err != nil {
+            return nil, err
+        }
+        u.Roles = roles
+    }
+    return u, nil
+}
+
+func (s *UserService) bySAMLNameID(ctx context.Context, nameID string) (*models.UserAccount, error) {
+    u, err := s.store.GetUserBySAMLNameID(ctx, nameID)
+    if err != nil {
+        return nil, err
+    }
+    u.Status = userStatus(*u)
+    return u, nil
+}
+
+func sameRoles(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    a, b = append([]string(nil), a...), append([]string(nil), b...)
+    sort.Strings(a)
+    sort.Strings(b)
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// Suspend blocks further logins for username.
+func (s *UserService) Suspend(ctx context.Context, actor, username string) error {
+    if actor == username {
+        return ErrSelfModification
+    }
+    st := models.UserStatusSuspended
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{Status: &st}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.suspend", username, nil)
+}
+
+// Reactivate lifts a suspension.
+func (s *UserService) Reactivate(ctx context.Context, actor, username string) error {
+    st := models.UserStatusActive
+    if err := s.store.UpdateUser(ctx, username, UserUpdate{Status: &st}); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.reactivate", username, nil)
+}
+
+// Delete removes the account. Prefer Suspend for people who leave so the
+// audit trail keeps pointing at an existing account.
+func (s *UserService) Delete(ctx context.Context, actor, username string) error {
+    if actor == username {
+        return ErrSelfModification
+    }
+    if err := s.store.DeleteUser(ctx, username); err != nil {
+        return err
+    }
+    return recordAudit(ctx, s.audit, actor, "user.delete", username, nil)
+}
+
+// ValidateRoles rejects roles outside the canonical set.
+func ValidateRoles(roles []string) error {
+    for _, r := range roles {
+        if !canonicalRoles[r] {
+            return ErrUnknownRole
+        }
+    }
+    return nil
+}
+
+func hasRole(roles []string, role string) bool {
+    for _, r := range roles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+func userStatus(u models.UserAccount) string {
+    if u.Status == "" {
+        return models.UserStatusActive
+    }
+    return u.Status
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUserService_ListFilters(t *testing.T) {
+    store := NewInMemoryUserStore()
+    svc := NewUserService(store, NewInMemoryEmployeeRepo(), NewInMemoryAuditLog())
+    ctx := context.Background()
+    _ = store.CreateUserWithHash(ctx, "admin", "x", []string{RoleAdmin})
+    _ = store.CreateUserWithHash(ctx, "maria", "x", []string{RoleEmployee})
+    _ = store.CreateUserWithHash(ctx, "jose", "x", []string{RoleEmployee, RolePayroll})
+    if err := svc.Suspend(ctx, "admin", "jose"); err != nil {
+        t.Fatalf("suspend: %v", err)
+    }
+
+    items, total, err := svc.List(ctx, 1, 20, UserFilter{Role: RoleEmployee})
+    if err != nil || total != 2 || items[0].Username != "jose" || items[1].Username != "maria" {
+        t.Fatalf("role filter: %v %d %+v", err, total, items)
+    }
+    items, total, _ = svc.List(ctx, 1, 20, UserFilter{Status: "active"})
+    if total != 2 || items[0].Username != "admin" || items[0].Status != "active" {
+        t.Fatalf("status filter: %d %+v", total, items)
+    }
+    items, total, _ = svc.List(ctx, 2, 1, UserFilter{Query: "A"})
+    if total != 2 || len(items) != 1 || items[0].Username != "maria" {
+        t.Fatalf("query/page: %d %+v", total, items)
+    }
+}
+
+func TestUserService_SuspendBlocksLogin(t *testing.T) {
+    store := NewInMemoryUserStore()
+    audit := NewInMemoryAuditLog()
+    svc := NewUserService(store, NewInMemoryEmployeeRepo(), audit)
+    ctx := context.Background()
+    _ = store.CreateUser(ctx, "maria", "Sampaguita-2025", []string{RoleEmployee})
+
+    if err := svc.Suspend(ctx, "maria", "maria"); err != ErrSelfModification {
+        t.Fatalf("expected ErrSelfModification, got %v", err)
+    }
+    if err := svc.Suspend(ctx, "admin", "maria"); err != nil {
+        t.Fatalf("suspend: %v", err)
+    }
+    if ok, _, _ := store.ValidateCredentials(ctx, "maria", "Sampaguita-2025"); ok {
+        t.Fatalf("suspended account must not log in")
+    }
+    if err := svc.Reactivate(ctx, "admin", "maria"); err != nil {
+        t.Fatalf("reactivate: %v", err)
+    }
+    if ok, _, _ := store.ValidateCredentials(ctx, "maria", "Sampaguita-2025"); !ok {
+        t.Fatalf("reactivated account should log in")
+    }
+    entries, _ := audit.List(ctx, "maria")
+    if len(entries) != 2 || entries[0].Action != "user.reactivate" || entries[1].Action != "user.suspend" {
+        t.Fatalf("unexpected audit entries %+v", entries)
+    }
+}
+
+func TestUserService_RolesAndEmployeeLink(t *testing.T) {
+    store := NewInMemoryUserStore()
+    emps := NewInMemoryEmployeeRepo()
+    svc := NewUserService(store, emps, NewInMemoryAuditLog())
+    ctx := context.Background()
+    _ = store.CreateUserWithHash(ctx, "admin", "x", []string{RoleAdmin})
+    _ = store.CreateUserWithHash(ctx, "maria", "x", []string{RoleEmployee})
+    _ = store.CreateUserWithHash(ctx, "jose", "x", []string{RoleEmployee})
+    _, _ = emps.Create(ctx, map[string]interface{}{"employee_id": "E-001"})
+
+    if err := svc.SetRoles(ctx, "admin", "maria", []string{"superuser"}); err != ErrUnknownRole {
+        t.Fatalf("expected ErrUnknownRole, got %v", err)
+    }
+    if err := svc.SetRoles(ctx, "admin", "admin", []string{RoleHR}); err != ErrSelfModification {
+        t.Fatalf("expected ErrSelfModification, got %v", err)
+    }
+    if err := svc.SetRoles(ctx, "admin", "maria", []string{RoleManager, RoleEmployee}); err != nil {
+        t.Fatalf("set roles: %v", err)
+    }
+    if u, _ := svc.Get(ctx, "maria"); len(u.Roles) != 2 || u.Roles[0] != RoleEmployee {
+        t.Fatalf("unexpected roles %v", u.Roles)
+    }
+
+    if err := svc.LinkEmployee(ctx, "admin", "maria", "E-404"); err != ErrEmployeeNotFound {
+        t.Fatalf("expected ErrEmployeeNotFound, got %v", err)
+    }
+    if err := svc.LinkEmployee(ctx, "admin", "maria", "E-001"); err != nil {
+        t.Fatalf("link: %v", err)
+    }
+    if err := svc.LinkEmployee(ctx, "admin", "jose", "E-001"); err != ErrEmployeeAlreadyLinked {
+        t.Fatalf("expected ErrEmployeeAlreadyLinked, got %v", err)
+    }
+    if items, total, _ := svc.List(ctx, 1, 20, UserFilter{EmployeeID: "E-001"}); total != 1 || items[0].Username != "maria" {
+        t.Fatalf("employee filter: %+v", items)
+    }
+}
+
+func TestUserService_SAMLAccount(t *testing.T) {
+    store := NewInMemoryUserStore()
+    svc := NewUserService(store, NewInMemoryEmployeeRepo(), NewInMemoryAuditLog())
+    ctx := context.Background()
+    _ = store.CreateUserWithHash(ctx, "maria", "x", []string{RoleEmployee, RoleHR})
+    _ = store.CreateUserWithHash(ctx, "saml:jose@example.com", "x", []string{RoleEmployee})
+
+    // a linked identity signs in as the local account with its own roles
+    if err := svc.LinkSAML(ctx, "admin", "maria", "maria@example.com"); err != nil {
+        t.Fatalf("link: %v", err)
+    }
+    if u, err := svc.SAMLAccount(ctx, "maria@example.com", []string{RoleAdmin}); err != nil || u.Username != "maria" || len(u.Roles) != 2 {
+        t.Fatalf("linked: %v %+v", err, u)
+    }
+    // an IdP name that matches a local username is not that account
+    if u, err := svc.SAMLAccount(ctx, "admin", []string{RoleEmployee}); err != nil || u.Username != "saml:admin" || u.Roles[0] != RoleEmployee || u.SAMLNameID != "admin" {
+        t.Fatalf("provisioned: %v %+v", err, u)
+    }
+    if err := store.CreateSAMLUser(ctx, "saml:other", "admin", nil); err != ErrSAMLAlreadyLinked {
+        t.Fatalf("expected the identity to be provisioned once, got %v", err)
+    }
+    if u, _ := svc.SAMLAccount(ctx, "admin", []string{RoleManager}); u.Username != "saml:admin" || u.Roles[0] != RoleManager {
+        t.Fatalf("roles not synced: %+v", u)
+    }
+    if _, err := svc.SAMLAccount(ctx, "jose@example.com", nil); err != ErrSAMLAlreadyLinked {
+        t.Fatalf("expected ErrSAMLAlreadyLinked, got %v", err)
+    }
+    if err := svc.LinkSAML(ctx, "admin", "saml:jose@example.com", "maria@example.com"); err != ErrSAMLAlreadyLinked {
+        t.Fatalf("expected ErrSAMLAlreadyLinked, got %v", err)
+    }
+    // suspension is reported so the caller can refuse the login
+    _ = svc.Suspend(ctx, "admin", "maria")
+    if u, _ := svc.SAMLAccount(ctx, "maria@example.com", nil); u.Status != "suspended" {
+        t.Fatalf("status: %+v", u)
+    }
+}
+
+// staleSAMLStore misses the identity on its first lookup, as when another
+// login provisions it between the lookup and the create.
+type staleSAMLStore struct {
+    AuthStore
+    missed bool
+}
+
+func (s *staleSAMLStore) GetUserBySAMLNameID(ctx context.Context, nameID string) (*models.UserAccount, error) {
+    if !s.missed {
+        s.missed = true
+        return nil, mongo.ErrNoDocuments
+    }
+    return s.AuthStore.GetUserBySAMLNameID(ctx, nameID)
+}
+
+func TestUserService_SAMLAccountConcurrentProvisioning(t *testing.T) {
+    ctx := context.Background()
+    store := NewInMemoryUserStore()
+    _ = store.CreateSAMLUser(ctx, "saml:ana@example.com", "ana@example.com", []string{RoleEmployee})
+    svc := NewUserService(&staleSAMLStore{AuthStore: store}, NewInMemoryEmployeeRepo(), NewInMemoryAuditLog())
+    if u, err := svc.SAMLAccount(ctx, "ana@example.com", []string{RoleEmployee}); err != nil || u.Username != "saml:ana@example.com" {
+        t.Fatalf("expected the account provisioned meanwhile, got %v %+v", err, u)
+    }
+}
+
+func TestInMemoryUserStore_RecordLogin(t *testing.T) {
+    store := NewInMemoryUserStore()
+    ctx := context.Background()
+    _ = store.CreateUserWithHash(ctx, "maria", "x", nil)
+    at := time.Date(2025, 6, 12, 8, 0, 0, 0, time.UTC)
+    if err := store.RecordLogin(ctx, "maria", at); err != nil {
+        t.Fatalf("record login: %v", err)
+    }
+    if u, _ := store.GetUser(ctx, "maria"); u.LastLogin != at.Unix() {
+        t.Fatalf("expected last_login %d, got %d", at.Unix(), u.LastLogin)
+    }
+}
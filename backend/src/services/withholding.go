@@ -0,0 +1,247 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "io/fs"
+    "sort"
+    "strings"
+
+    "github.com/ronaldpalay/hris/src/models"
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+// Withholding table periods. All but annual match the payroll frequencies;
+// annual is used for the year-end adjustment.
+const (
+    TaxPeriodDaily       = FrequencyDaily
+    TaxPeriodWeekly      = FrequencyWeekly
+    TaxPeriodSemiMonthly = FrequencySemiMonthly
+    TaxPeriodMonthly     = FrequencyMonthly
+    TaxPeriodAnnual      = "annual"
+)
+
+// TaxBracket taxes income at or above Over as Base + Rate × (income − Over).
+type TaxBracket struct {
+    Over money.Money `json:"over"`
+    Base money.Money `json:"base"`
+    Rate string      `json:"rate"`
+}
+
+// DeMinimisCeiling is the exempt amount of a de minimis benefit per month,
+// semester or year.
+type DeMinimisCeiling struct {
+    Amount money.Money `json:"amount"`
+    Per    string      `json:"per"`
+}
+
+// PerPeriod spreads the ceiling evenly over pay periods.
+func (c DeMinimisCeiling) PerPeriod(periodsPerYear int64) money.Money {
+    months := int64(1)
+    switch c.Per {
+    case "semester":
+        months = 6
+    case "year":
+        months = 12
+    }
+    return c.Amount.MulRatio(12, months*periodsPerYear, money.HalfEven).Round(money.HalfEven)
+}
+
+// TaxTable is one version of the BIR withholding tables.
+type TaxTable struct {
+    EffectiveDate          string                      `json:"effective_date"`
+    Source                 string                      `json:"source"`
+    OtherBenefitsExemption money.Money                 `json:"other_benefits_exemption"`
+    DeMinimis              map[string]DeMinimisCeiling `json:"de_minimis"`
+    Brackets               map[string][]TaxBracket     `json:"brackets"`
+}
+
+// TaxTables holds every version of the withholding tables, oldest first.
+type TaxTables struct {
+    Versions []TaxTable
+}
+
+// DefaultTaxTables loads the withholding tables embedded in the binary.
+func DefaultTaxTables() (*TaxTables, error) {
+    sub, err := fs.Sub(statutoryFS, "statutory")
+    if err != nil {
+        return nil, err
+    }
+    return LoadTaxTables(sub)
+}
+
+// LoadTaxTables reads withholding.json from fsys.
+func LoadTaxTables(fsys fs.FS) (*TaxTables, error) {
+    t := &TaxTables{}
+    if err := readVersions(fsys, "withholding.json", &t.Versions); err != nil {
+        return nil, err
+    }
+    sort.Slice(t.Versions, func(i, j int) bool { return t.Versions[i].EffectiveDate < t.Versions[j].EffectiveDate })
+    for _, v := range t.Versions {
+        for _, period := range []string{TaxPeriodDaily, TaxPeriodWeekly, TaxPeriodSemiMonthly, TaxPeriodMonthly, TaxPeriodAnnual} {
+            brackets := v.Brackets[period]
+            if len(brackets) == 0 {
+                return nil, fmt.Errorf("withholding.json %s: no %s brackets", v.EffectiveDate, period)
+            }
+            for i := 1; i < len(brackets); i++ {
+                if !brackets[i-1].Over.LessThan(brackets[i].Over) {
+                    return nil, fmt.Errorf("withholding.json %s: %s brackets not ascending at %s", v.EffectiveDate, period, brackets[i].Over)
+                }
+            }
+        }
+    }
+    return t, nil
+}
+
+// For returns the table in effect on date (YYYY-MM-DD).
+func (t *TaxTables) For(date string) (*TaxTable, error) {
+    for i := len(t.Versions) - 1; i >= 0; i-- {
+        if t.Versions[i].EffectiveDate <= date {
+            return &t.Versions[i], nil
+        }
+    }
+    return nil, fmt.Errorf("%w: withholding on %s", ErrNoContributionTable, date)
+}
+
+// Tax returns the tax on income for a period, rounded to centavos.
+func (t *TaxTable) Tax(period string, income money.Money) (money.Money, error) {
+    brackets, ok := t.Brackets[period]
+    if !ok {
+        return money.Money{}, fmt.Errorf("no withholding table for period %q", period)
+    }
+    cur := income.Currency()
+    if income.Sign() <= 0 {
+        return money.Zero(cur), nil
+    }
+    b := brackets[0]
+    for _, br := range brackets {
+        if income.LessThan(br.Over) {
+            break
+        }
+        b = br
+    }
+    excess, err := income.Sub(b.Over.WithCurrency(cur)).MulRate(b.Rate, money.HalfEven)
+    if err != nil {
+        return money.Money{}, err
+    }
+    return b.Base.WithCurrency(cur).Add(excess).Round(money.HalfEven), nil
+}
+
+// TaxYearToDate is what was already paid and withheld in the calendar year
+// before the current period.
+type TaxYearToDate struct {
+    TaxableCompensation money.Money `json:"taxable_compensation"` // net of mandatory contributions
+    OtherBenefits       money.Money `json:"other_benefits"`       // 13th month, other benefits and excess de minimis
+    TaxWithheld         money.Money `json:"tax_withheld"`
+}
+
+// TaxHistorySource supplies year-to-date figures from earlier payslips.
+// Only payslips whose period starts before before count.
+type TaxHistorySource interface {
+    TaxYearToDate(ctx context.Context, employeeID string, year int, before string) (TaxYearToDate, error)
+}
+
+// WithholdingTaxRule withholds income tax on compensation using the BIR
+// tables for the payroll frequency. Mandatory contributions are deducted
+// first, de minimis benefits are exempt up to their ceiling, and 13th month
+// and other benefits are exempt up to the annual threshold. The last regular
+// payroll of the year (period ending 31 December, or a request with
+// Annualize set) recomputes the tax on the whole year and withholds or refunds the
+// difference. History may be nil when requests carry YearToDate.
+type WithholdingTaxRule struct {
+    Tables  *TaxTables
+    History TaxHistorySource
+}
+
+func (WithholdingTaxRule) Name() string { return "withholding_tax" }
+
+func (r WithholdingTaxRule) Apply(pc *PayrollContext) ([]models.PayslipLine, error) {
+    // the BIR tables are in pesos; other payroll currencies are not withheld here
+    if pc.Currency != "PHP" {
+        return nil, nil
+    }
+    t, err := r.Tables.For(pc.Request.PeriodEnd)
+    if err != nil {
+        return nil, err
+    }
+    cur := pc.Currency
+    ytd := TaxYearToDate{}
+    switch {
+    case pc.Request.YearToDate != nil:
+        ytd = *pc.Request.YearToDate
+    case r.History != nil:
+        year := 0
+        fmt.Sscanf(pc.Request.PeriodEnd, "%d", &year)
+        // off-cycle payslips span earlier periods, so count everything closed before they end
+        before := pc.Request.PeriodStart
+        if pc.Request.OffCycle {
+            before = pc.Request.PeriodEnd
+        }
+        if ytd, err = r.History.TaxYearToDate(pc.Ctx, pc.Request.EmployeeID, year, before); err != nil {
+            return nil, err
+        }
+    }
+    ytd.TaxableCompensation = ytd.TaxableCompensation.WithCurrency(cur)
+    ytd.OtherBenefits = ytd.OtherBenefits.WithCurrency(cur)
+    ytd.TaxWithheld = ytd.TaxWithheld.WithCurrency(cur)
+
+    regular, other, exemptDeMinimis := money.Zero(cur), money.Zero(cur), money.Zero(cur)
+    for _, l := range pc.Lines {
+        if l.Kind != models.LineEarning {
+            continue
+        }
+        switch {
+        case l.OtherBenefit:
+            other = other.Add(l.Amount)
+        case l.DeMinimis != "":
+            // the excess over the ceiling joins other benefits; unknown categories are not exempt
+            exempt := money.Zero(cur)
+            if c, ok := t.DeMinimis[l.DeMinimis]; ok {
+                exempt = l.Amount.Min(c.PerPeriod(pc.PeriodsPerYear()).WithCurrency(cur))
+            }
+            exemptDeMinimis = exemptDeMinimis.Add(exempt)
+            other = other.Add(l.Amount.Sub(exempt))
+        case l.Taxable:
+            regular = regular.Add(l.Amount)
+        }
+    }
+    contributions := pc.Sum(models.LineContribution)
+    threshold := t.OtherBenefitsExemption.WithCurrency(cur)
+    zero := money.Zero(cur)
+    taxableOther := ytd.OtherBenefits.Add(other).Sub(threshold).Max(zero).Sub(ytd.OtherBenefits.Sub(threshold).Max(zero))
+    taxable := regular.Sub(contributions).Add(taxableOther)
+
+    in := map[string]string{
+        "taxable_earnings":         regular.String(),
+        "contributions":            contributions.String(),
+        "other_benefits":           other.String(),
+        "ytd_other_benefits":       ytd.OtherBenefits.String(),
+        "other_benefits_exemption": threshold.String(),
+        "taxable_other_benefits":   taxableOther.String(),
+        "exempt_de_minimis":        exemptDeMinimis.String(),
+        "taxable_compensation":     taxable.String(),
+        "table":                    t.EffectiveDate,
+    }
+    line := models.PayslipLine{Code: "withholding_tax", Label: "Withholding tax", Kind: models.LineTax, Inputs: in}
+    if pc.Request.Annualize || (!pc.Request.OffCycle && strings.HasSuffix(pc.Request.PeriodEnd, "-12-31")) {
+        annual := ytd.TaxableCompensation.Add(taxable)
+        due, err := t.Tax(TaxPeriodAnnual, annual)
+        if err != nil {
+            return nil, err
+        }
+        line.Amount = due.Sub(ytd.TaxWithheld)
+        line.Label = "Withholding tax (year-end adjustment)"
+        in["ytd_taxable_compensation"] = ytd.TaxableCompensation.String()
+        in["annual_taxable_compensation"] = annual.String()
+        in["annual_tax_due"] = due.String()
+        in["ytd_tax_withheld"] = ytd.TaxWithheld.String()
+        line.Formula = "annual table(ytd_taxable_compensation + taxable_compensation) − ytd_tax_withheld; negative is a refund"
+        return []models.PayslipLine{line}, nil
+    }
+    if line.Amount, err = t.Tax(pc.Request.Frequency, taxable); err != nil {
+        return nil, err
+    }
+    in["period"] = pc.Request.Frequency
+    line.Formula = "period table(taxable_earnings − contributions + taxable_other_benefits)"
+    return []models.PayslipLine{line}, nil
+}
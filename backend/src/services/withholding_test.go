@@ -0,0 +1,121 @@
+package services
+
+import (
+    "context"
+    "testing"
+
+    "github.com/ronaldpalay/hris/src/money"
+)
+
+func TestTaxTable_PublishedRates(t *testing.T) {
+    tables, err := DefaultTaxTables()
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    cases := []struct {
+        date, period, income, want string
+    }{
+        {"2025-06-30", TaxPeriodMonthly, "30000", "1375.05"},
+        {"2025-06-30", TaxPeriodMonthly, "20833", "0.00"},
+        {"2025-06-30", TaxPeriodMonthly, "100000", "16875.05"},
+        {"2025-06-15", TaxPeriodSemiMonthly, "15000", "687.45"},
+        {"2025-06-15", TaxPeriodWeekly, "10000", "894.20"},
+        {"2025-06-15", TaxPeriodDaily, "1000", "47.25"},
+        {"2025-12-31", TaxPeriodAnnual, "600000", "62500.00"},
+        {"2025-12-31", TaxPeriodAnnual, "250000", "0.00"},
+        {"2022-06-30", TaxPeriodMonthly, "30000", "1833.40"},
+        {"2022-12-31", TaxPeriodAnnual, "600000", "80000.00"},
+    }
+    for _, c := range cases {
+        tbl, err := tables.For(c.date)
+        if err != nil {
+            t.Fatalf("%s: %v", c.date, err)
+        }
+        got, err := tbl.Tax(c.period, money.MustParse(c.income, "PHP"))
+        if err != nil || got.String() != c.want {
+            t.Fatalf("%s %s %s: %v got %s want %s", c.date, c.period, c.income, err, got, c.want)
+        }
+    }
+}
+
+func newTaxTestService(t *testing.T, repo EmployeeRepo) *PayrollService {
+    t.Helper()
+    taxTables, err := DefaultTaxTables()
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    rules := append(DefaultPayrollRules(), ContributionRules(loadTables(t), SplitEven)...)
+    rules = append(rules, WithholdingTaxRule{Tables: taxTables})
+    return NewPayrollService(repo, nil, nil, DefaultPayrollConfig(), money.DefaultRoundingPolicy(), rules...)
+}
+
+func TestWithholdingTaxRule_SemiMonthly(t *testing.T) {
+    svc := newTaxTestService(t, newPayrollTestRepo(t))
+    p, err := svc.Calculate(context.Background(), PayrollRequest{EmployeeID: "E-1", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15"})
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // 15,000 basic − 1,225 contributions = 13,775; 15% over 10,417
+    l := findLine(p, "withholding_tax")
+    if l == nil || l.Amount.String() != "503.70" || l.Inputs["taxable_compensation"] != "13775.00" {
+        t.Fatalf("tax line: %+v", l)
+    }
+    if p.Taxes.String() != "503.70" || p.Net.String() != "14271.30" {
+        t.Fatalf("taxes %s net %s", p.Taxes, p.Net)
+    }
+}
+
+func TestWithholdingTaxRule_DeMinimisAndOtherBenefits(t *testing.T) {
+    repo := NewInMemoryEmployeeRepo()
+    _, _ = repo.Create(context.Background(), map[string]interface{}{
+        "employee_id": "E-2",
+        "compensation_records": []interface{}{
+            map[string]interface{}{"type": "salary", "amount": 30000.0, "effective_date": "2025-01-01"},
+            map[string]interface{}{"type": "allowance", "name": "Rice subsidy", "amount": 2500.0, "effective_date": "2025-01-01", "de_minimis": "rice_subsidy"},
+        },
+    })
+    svc := newTaxTestService(t, repo)
+    req := PayrollRequest{EmployeeID: "E-2", PeriodStart: "2025-06-01", PeriodEnd: "2025-06-15"}
+    p, err := svc.Calculate(context.Background(), req)
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // 1,250 paid against a 1,000 per cut-off ceiling; the 250 excess is under the 90,000 threshold
+    l := findLine(p, "withholding_tax")
+    if l.Amount.String() != "503.70" || l.Inputs["exempt_de_minimis"] != "1000.00" || l.Inputs["other_benefits"] != "250.00" {
+        t.Fatalf("under threshold: %+v", l)
+    }
+
+    req.YearToDate = &TaxYearToDate{OtherBenefits: money.MustParse("89900", "")}
+    p, err = svc.Calculate(context.Background(), req)
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // only 150 of the excess crosses the threshold: 13,925 taxable
+    if l := findLine(p, "withholding_tax"); l.Amount.String() != "526.20" || l.Inputs["taxable_other_benefits"] != "150.00" {
+        t.Fatalf("over threshold: %+v", l)
+    }
+}
+
+func TestWithholdingTaxRule_YearEndAnnualization(t *testing.T) {
+    svc := newTaxTestService(t, newPayrollTestRepo(t))
+    req := PayrollRequest{
+        EmployeeID: "E-1", PeriodStart: "2025-12-16", PeriodEnd: "2025-12-31",
+        YearToDate: &TaxYearToDate{TaxableCompensation: money.MustParse("300000", ""), TaxWithheld: money.MustParse("10000", "")},
+    }
+    p, err := svc.Calculate(context.Background(), req)
+    if err != nil {
+        t.Fatalf("calculate: %v", err)
+    }
+    // 313,775 for the year: 15% over 250,000 = 9,566.25, so 433.75 is refunded
+    l := findLine(p, "withholding_tax")
+    if l.Amount.String() != "-433.75" || l.Inputs["annual_tax_due"] != "9566.25" {
+        t.Fatalf("refund: %+v", l)
+    }
+
+    req.YearToDate.TaxWithheld = money.MustParse("9000", "")
+    p, _ = svc.Calculate(context.Background(), req)
+    if l := findLine(p, "withholding_tax"); l.Amount.String() != "566.25" {
+        t.Fatalf("under-withheld: %+v", l)
+    }
+}
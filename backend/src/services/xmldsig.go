@@ -0,0 +1,325 @@
+package services
+
+import (
+    "bytes"
+    "crypto"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/subtle"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+// Minimal XML-DSig support for SAML: enveloped RSA-SHA256 signatures with
+// exclusive canonicalization (no comments). Anything else is rejected.
+const (
+    nsDSig         = "http://www.w3.org/2000/09/xmldsig#"
+    algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+    algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+    algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+    algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+    nsXMLNamespace = "http://www.w3.org/XML/1998/namespace"
+)
+
+// xmlNode is a parsed element that keeps the raw prefixes needed for canonicalization.
+type xmlNode struct {
+    prefix   string
+    local    string
+    attrs    []xml.Attr        // raw attributes, Name.Space holds the prefix
+    ns       map[string]string // in-scope prefix -> namespace URI
+    children []interface{}     // *xmlNode or string
+    parent   *xmlNode
+}
+
+// parseXMLTree parses doc into an element tree. DTDs are rejected.
+func parseXMLTree(doc []byte) (*xmlNode, error) {
+    d := xml.NewDecoder(bytes.NewReader(doc))
+    var root, cur *xmlNode
+    for {
+        tok, err := d.RawToken()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        switch t := tok.(type) {
+        case xml.StartElement:
+            n := &xmlNode{prefix: t.Name.Space, local: t.Name.Local, parent: cur, ns: map[string]string{}}
+            if cur != nil {
+                for k, v := range cur.ns {
+                    n.ns[k] = v
+                }
+            }
+            for _, a := range t.Attr {
+                switch {
+                case a.Name.Space == "" && a.Name.Local == "xmlns":
+                    n.ns[""] = a.Value
+                case a.Name.Space == "xmlns":
+                    n.ns[a.Name.Local] = a.Value
+                }
+                n.attrs = append(n.attrs, a)
+            }
+            if cur == nil {
+                if root != nil {
+                    return nil, errors.New("multiple root elements")
+                }
+                root = n
+            } else {
+                cur.children = append(cur.children, n)
+            }
+            cur = n
+        case xml.EndElement:
+            if cur == nil || cur.prefix != t.Name.Space || cur.local != t.Name.Local {
+                return nil, errors.New("mismatched end element")
+            }
+            cur = cur.parent
+        case xml.CharData:
+            if cur != nil {
+                cur.children = append(cur.children, string(t))
+            }
+        case xml.Directive:
+            return nil, errors.New("xml directives are not allowed")
+        }
+    }
+    if root == nil || cur != nil {
+        return nil, errors.New("incomplete xml document")
+    }
+    return root, nil
+}
+
+// space returns the namespace URI of the node.
+func (n *xmlNode) space() string {
+    return n.ns[n.prefix]
+}
+
+func (n *xmlNode) is(space, local string) bool {
+    return n.local == local && n.space() == space
+}
+
+// attr returns the value of an unprefixed attribute.
+func (n *xmlNode) attr(name string) string {
+    for _, a := range n.attrs {
+        if a.Name.Space == "" && a.Name.Local == name {
+            return a.Value
+        }
+    }
+    return ""
+}
+
+// child returns the first direct child element matching space/local.
+func (n *xmlNode) child(space, local string) *xmlNode {
+    for _, c := range n.childElements(space, local) {
+        return c
+    }
+    return nil
+}
+
+func (n *xmlNode) childElements(space, local string) []*xmlNode {
+    var out []*xmlNode
+    for _, c := range n.children {
+        if e, ok := c.(*xmlNode); ok && e.is(space, local) {
+            out = append(out, e)
+        }
+    }
+    return out
+}
+
+// text returns the concatenated character data of the node's direct children.
+func (n *xmlNode) text() string {
+    var b strings.Builder
+    for _, c := range n.children {
+        if s, ok := c.(string); ok {
+            b.WriteString(s)
+        }
+    }
+    return strings.TrimSpace(b.String())
+}
+
+// walk visits n and all descendant elements depth-first.
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+    fn(n)
+    for _, c := range n.children {
+        if e, ok := c.(*xmlNode); ok {
+            e.walk(fn)
+        }
+    }
+}
+
+// canonicalize renders n using exclusive XML canonicalization, omitting the
+// exclude subtree (used for the enveloped-signature transform).
+func (n *xmlNode) canonicalize(exclude *xmlNode) []byte {
+    var buf bytes.Buffer
+    n.writeCanonical(&buf, map[string]string{}, exclude)
+    return buf.Bytes()
+}
+
+func (n *xmlNode) writeCanonical(buf *bytes.Buffer, rendered map[string]string, exclude *xmlNode) {
+    used := map[string]bool{n.prefix: true}
+    var attrs []xml.Attr
+    for _, a := range n.attrs {
+        if (a.Name.Space == "" && a.Name.Local == "xmlns") || a.Name.Space == "xmlns" {
+            continue
+        }
+        if a.Name.Space != "" && a.Name.Space != "xml" {
+            used[a.Name.Space] = true
+        }
+        attrs = append(attrs, a)
+    }
+    next := map[string]string{}
+    for k, v := range rendered {
+        next[k] = v
+    }
+    var decls []string
+    for p := range used {
+        uri := n.ns[p]
+        prev, seen := rendered[p]
+        if (seen && prev == uri) || (!seen && p == "" && uri == "") {
+            continue
+        }
+        decls = append(decls, p)
+        next[p] = uri
+    }
+    sort.Strings(decls)
+    attrURI := func(a xml.Attr) string {
+        switch a.Name.Space {
+        case "":
+            return ""
+        case "xml":
+            return nsXMLNamespace
+        }
+        return n.ns[a.Name.Space]
+    }
+    sort.SliceStable(attrs, func(i, j int) bool {
+        ui, uj := attrURI(attrs[i]), attrURI(attrs[j])
+        if ui != uj {
+            return ui < uj
+        }
+        return attrs[i].Name.Local < attrs[j].Name.Local
+    })
+
+    name := n.local
+    if n.prefix != "" {
+        name = n.prefix + ":" + n.local
+    }
+    buf.WriteString("<" + name)
+    for _, p := range decls {
+        if p == "" {
+            buf.WriteString(` xmlns="`)
+        } else {
+            buf.WriteString(` xmlns:` + p + `="`)
+        }
+        buf.WriteString(escapeC14NAttr(next[p]) + `"`)
+    }
+    for _, a := range attrs {
+        an := a.Name.Local
+        if a.Name.Space != "" {
+            an = a.Name.Space + ":" + a.Name.Local
+        }
+        buf.WriteString(" " + an + `="` + escapeC14NAttr(a.Value) + `"`)
+    }
+    buf.WriteString(">")
+    for _, c := range n.children {
+        switch v := c.(type) {
+        case string:
+            buf.WriteString(escapeC14NText(v))
+        case *xmlNode:
+            if v != exclude {
+                v.writeCanonical(buf, next, exclude)
+            }
+        }
+    }
+    buf.WriteString("</" + name + ">")
+}
+
+var (
+    c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+    c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeC14NText(s string) string { return c14nTextEscaper.Replace(s) }
+func escapeC14NAttr(s string) string { return c14nAttrEscaper.Replace(s) }
+
+// verifyEnvelopedSignature checks the ds:Signature that is a direct child of el
+// against cert. The signature must reference el by its ID attribute.
+func verifyEnvelopedSignature(el *xmlNode, cert *x509.Certificate) error {
+    sig := el.child(nsDSig, "Signature")
+    if sig == nil {
+        return errors.New("signature missing")
+    }
+    pub, ok := cert.PublicKey.(*rsa.PublicKey)
+    if !ok {
+        return errors.New("unsupported certificate key type")
+    }
+    si := sig.child(nsDSig, "SignedInfo")
+    if si == nil {
+        return errors.New("SignedInfo missing")
+    }
+    if cm := si.child(nsDSig, "CanonicalizationMethod"); cm == nil || cm.attr("Algorithm") != algExcC14N {
+        return errors.New("unsupported canonicalization method")
+    }
+    if sm := si.child(nsDSig, "SignatureMethod"); sm == nil || sm.attr("Algorithm") != algRSASHA256 {
+        return errors.New("unsupported signature method")
+    }
+    refs := si.childElements(nsDSig, "Reference")
+    if len(refs) != 1 {
+        return errors.New("exactly one signature reference required")
+    }
+    ref := refs[0]
+    id := el.attr("ID")
+    if id == "" || ref.attr("URI") != "#"+id {
+        return errors.New("signature does not reference the signed element")
+    }
+    if tr := ref.child(nsDSig, "Transforms"); tr != nil {
+        for _, t := range tr.childElements(nsDSig, "Transform") {
+            if alg := t.attr("Algorithm"); alg != algEnveloped && alg != algExcC14N {
+                return fmt.Errorf("unsupported transform %q", alg)
+            }
+        }
+    }
+    if dm := ref.child(nsDSig, "DigestMethod"); dm == nil || dm.attr("Algorithm") != algSHA256 {
+        return errors.New("unsupported digest method")
+    }
+    dv := ref.child(nsDSig, "DigestValue")
+    if dv == nil {
+        return errors.New("DigestValue missing")
+    }
+    wantDigest, err := decodeBase64Text(dv.text())
+    if err != nil {
+        return fmt.Errorf("DigestValue: %w", err)
+    }
+    digest := sha256.Sum256(el.canonicalize(sig))
+    if subtle.ConstantTimeCompare(digest[:], wantDigest) != 1 {
+        return errors.New("digest mismatch")
+    }
+    sv := sig.child(nsDSig, "SignatureValue")
+    if sv == nil {
+        return errors.New("SignatureValue missing")
+    }
+    sigBytes, err := decodeBase64Text(sv.text())
+    if err != nil {
+        return fmt.Errorf("SignatureValue: %w", err)
+    }
+    h := sha256.Sum256(si.canonicalize(nil))
+    if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], sigBytes); err != nil {
+        return errors.New("signature verification failed")
+    }
+    return nil
+}
+
+// decodeBase64Text decodes base64 that may be wrapped across lines.
+func decodeBase64Text(s string) ([]byte, error) {
+    s = strings.Map(func(r rune) rune {
+        if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+            return -1
+        }
+        return r
+    }, s)
+    return base64.StdEncoding.DecodeString(s)
+}
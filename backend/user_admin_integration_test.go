@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminUserManagement(t *testing.T) {
+	r := NewRouter(context.Background())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "admin", "password": "password"}, &login); code != http.StatusOK {
+		t.Fatalf("admin login status: %d", code)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	callAs := func(token, method, path string, in interface{}, out interface{}) int {
+		var body bytes.Buffer
+		if in != nil {
+			_ = json.NewEncoder(&body).Encode(in)
+		}
+		req, _ := http.NewRequest(method, ts.URL+path, &body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			_ = json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+	call := func(method, path string, in interface{}, out interface{}) int {
+		return callAs(login.Token, method, path, in, out)
+	}
+
+	// the old unauthenticated creation route is gone
+	if code := postJSON(t, ts.URL+"/api/users", map[string]string{"username": "eve", "password": "Sampaguita-2025"}, nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unauthenticated user creation, got %d", code)
+	}
+
+	// a failed employee link leaves no account behind
+	unlinked := map[string]interface{}{"username": "pedro", "password": "Sampaguita-2025", "employee_id": "no-such-employee"}
+	if code := call(http.MethodPost, "/api/secure/users", unlinked, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected the unknown employee to be rejected, got %d", code)
+	}
+	if code := call(http.MethodGet, "/api/secure/users/pedro", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("account created despite the failed link: %d", code)
+	}
+
+	newUser := map[string]interface{}{"username": "maria", "password": "Sampaguita-2025", "roles": []string{"employee"}}
+	if code := call(http.MethodPost, "/api/secure/users", newUser, nil); code != http.StatusCreated {
+		t.Fatalf("create user: %d", code)
+	}
+	if code := call(http.MethodPost, "/api/secure/users", newUser, nil); code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate user, got %d", code)
+	}
+	if code := call(http.MethodPatch, "/api/secure/users/maria", map[string]interface{}{"roles": []string{"employee", "manager"}}, nil); code != http.StatusOK {
+		t.Fatalf("patch roles: %d", code)
+	}
+
+	var list struct {
+		Items []struct {
+			Username  string   `json:"username"`
+			Roles     []string `json:"roles"`
+			Status    string   `json:"status"`
+			LastLogin int64    `json:"last_login"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if code := call(http.MethodGet, "/api/secure/users?role=manager", nil, &list); code != http.StatusOK || list.Total != 1 || list.Items[0].Username != "maria" {
+		t.Fatalf("list by role: %d %+v", code, list)
+	}
+
+	// suspended accounts cannot log in; the response matches a wrong password
+	if code := call(http.MethodPost, "/api/secure/users/maria/suspend", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("suspend: %d", code)
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "maria", "password": "Sampaguita-2025"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for suspended account, got %d", code)
+	}
+	if code := call(http.MethodPost, "/api/secure/users/maria/reactivate", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("reactivate: %d", code)
+	}
+	// the failed attempt above left a backoff on the username
+	if code := call(http.MethodPost, "/api/secure/users/maria/unlock", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("unlock: %d", code)
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "maria", "password": "Sampaguita-2025"}, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 password change required after reactivation, got %d", code)
+	}
+
+	// role changes and suspensions apply to tokens already issued
+	jose := map[string]interface{}{"username": "jose", "password": "Sampaguita-2025", "roles": []string{"admin"}}
+	if code := call(http.MethodPost, "/api/secure/users", jose, nil); code != http.StatusCreated {
+		t.Fatalf("create jose: %d", code)
+	}
+	change := map[string]string{"username": "jose", "current_password": "Sampaguita-2025", "new_password": "Narra-Tree-1898"}
+	if code := postJSON(t, ts.URL+"/api/auth/password/change", change, nil); code != http.StatusNoContent {
+		t.Fatalf("jose password change: %d", code)
+	}
+	var joseLogin struct {
+		Token string `json:"token"`
+	}
+	if code := postJSON(t, ts.URL+"/api/auth/login", map[string]string{"username": "jose", "password": "Narra-Tree-1898"}, &joseLogin); code != http.StatusOK {
+		t.Fatalf("jose login: %d", code)
+	}
+	if code := callAs(joseLogin.Token, http.MethodGet, "/api/secure/users", nil, nil); code != http.StatusOK {
+		t.Fatalf("expected jose to manage users, got %d", code)
+	}
+	if code := call(http.MethodPatch, "/api/secure/users/jose", map[string]interface{}{"roles": []string{"employee"}}, nil); code != http.StatusOK {
+		t.Fatalf("demote jose: %d", code)
+	}
+	if code := callAs(joseLogin.Token, http.MethodGet, "/api/secure/users", nil, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a demoted token, got %d", code)
+	}
+	if code := callAs(joseLogin.Token, http.MethodGet, "/api/secure/employees", nil, nil); code != http.StatusOK {
+		t.Fatalf("expected the demoted token to stay signed in, got %d", code)
+	}
+	if code := call(http.MethodPost, "/api/secure/users/jose/suspend", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("suspend jose: %d", code)
+	}
+	if code := callAs(joseLogin.Token, http.MethodGet, "/api/secure/employees", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a suspended account's token, got %d", code)
+	}
+
+	// admins cannot suspend themselves; their last login is tracked
+	if code := call(http.MethodPost, "/api/secure/users/admin/suspend", nil, nil); code != http.StatusConflict {
+		t.Fatalf("expected 409 for self-suspension, got %d", code)
+	}
+	if code := call(http.MethodGet, "/api/secure/users?q=adm", nil, &list); code != http.StatusOK || list.Total != 1 || list.Items[0].LastLogin == 0 {
+		t.Fatalf("expected admin last_login, got %d %+v", code, list)
+	}
+
+	if code := call(http.MethodDelete, "/api/secure/users/maria", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete: %d", code)
+	}
+	if code := call(http.MethodGet, "/api/secure/users/maria", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", code)
+	}
+}